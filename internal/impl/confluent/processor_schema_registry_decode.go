@@ -131,9 +131,10 @@ func init() {
 
 type decodingConfig struct {
 	avro struct {
-		useHamba  bool
-		rawUnions bool
-		mapping   *bloblang.Executor
+		useHamba     bool
+		rawUnions    bool
+		nativeValues bool
+		mapping      *bloblang.Executor
 	}
 }
 
@@ -0,0 +1,76 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confluent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hamba/avro/v2"
+	franz_sr "github.com/twmb/franz-go/pkg/sr"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/confluent/sr"
+)
+
+// SchemaDecoder decodes the payloads of messages which are encoded with an
+// Avro or Protobuf schema of a schema registry for other components. Payloads
+// are decoded like they are by the schema_registry_decode processor with
+// preserve_logical_types and raw_unions enabled, except that Avro fixed values
+// are decoded as bytes and local timestamps as timestamps.
+type SchemaDecoder struct {
+	// AvroSchema is the parsed schema when it's an Avro schema, otherwise it's
+	// nil.
+	AvroSchema avro.Schema
+
+	decoder schemaDecoder
+}
+
+// NewSchemaDecoder returns a decoder of a schema of the registry, whose
+// references are fetched with client.
+func NewSchemaDecoder(ctx context.Context, client *sr.Client, schema franz_sr.Schema) (*SchemaDecoder, error) {
+	s := &schemaRegistryDecoder{client: client}
+	s.cfg.avro.useHamba = true
+	s.cfg.avro.rawUnions = true
+	s.cfg.avro.nativeValues = true
+
+	d := &SchemaDecoder{}
+	var err error
+	switch schema.Type {
+	case franz_sr.TypeAvro:
+		if d.AvroSchema, err = s.parseHambaAvroSchema(ctx, schema); err != nil {
+			return nil, err
+		}
+		d.decoder = s.hambaAvroDecoder(d.AvroSchema)
+	case franz_sr.TypeProtobuf:
+		if d.decoder, err = s.getProtobufDecoder(ctx, schema); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported schema type %v, only Avro and Protobuf schemas are supported", schema.Type)
+	}
+	return d, nil
+}
+
+// Decode decodes the payload of a message which follows the schema ID of the
+// Confluent wire format into a structured value.
+func (d *SchemaDecoder) Decode(payload []byte) (any, error) {
+	msg := service.NewMessage(payload)
+	if err := d.decoder(msg); err != nil {
+		return nil, err
+	}
+	return msg.AsStructuredMut()
+}
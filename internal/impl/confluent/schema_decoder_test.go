@@ -0,0 +1,61 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confluent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hamba/avro/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	franz_sr "github.com/twmb/franz-go/pkg/sr"
+)
+
+func TestSchemaDecoderNativeValues(t *testing.T) {
+	const schema = `{
+  "type": "record",
+  "name": "foo",
+  "fields": [
+    { "name": "id", "type": { "type": "fixed", "name": "id", "size": 4 } },
+    { "name": "at", "type": { "type": "long", "logicalType": "local-timestamp-millis" } },
+    { "name": "note", "type": [ "null", "string" ] }
+  ]
+}`
+	// The schema has no references, so the client isn't used.
+	d, err := NewSchemaDecoder(context.Background(), nil, franz_sr.Schema{Schema: schema, Type: franz_sr.TypeAvro})
+	require.NoError(t, err)
+	require.NotNil(t, d.AvroSchema)
+
+	at := time.Date(2025, 3, 1, 14, 0, 0, 0, time.UTC)
+	payload, err := avro.Marshal(d.AvroSchema, map[string]any{
+		"id":   [4]byte{1, 2, 3, 4},
+		"at":   at,
+		"note": "bar",
+	})
+	require.NoError(t, err)
+
+	v, err := d.Decode(payload)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"id":   []byte{1, 2, 3, 4},
+		"at":   at,
+		"note": "bar",
+	}, v)
+
+	_, err = NewSchemaDecoder(context.Background(), nil, franz_sr.Schema{Schema: `{}`, Type: franz_sr.TypeJSON})
+	require.ErrorContains(t, err, "only Avro and Protobuf schemas are supported")
+}
@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/big"
+	"reflect"
 	"slices"
 	"strings"
 	"time"
@@ -49,6 +50,14 @@ func resolveHambaAvroReferences(ctx context.Context, client *sr.Client, schema f
 }
 
 func (s *schemaRegistryDecoder) getHambaAvroDecoder(ctx context.Context, schema franz_sr.Schema) (schemaDecoder, error) {
+	codec, err := s.parseHambaAvroSchema(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+	return s.hambaAvroDecoder(codec), nil
+}
+
+func (s *schemaRegistryDecoder) parseHambaAvroSchema(ctx context.Context, schema franz_sr.Schema) (avro.Schema, error) {
 	schemaSpecs, err := resolveHambaAvroReferences(ctx, s.client, schema)
 	if err != nil {
 		return nil, err
@@ -73,8 +82,11 @@ func (s *schemaRegistryDecoder) getHambaAvroDecoder(ctx context.Context, schema
 			return nil, fmt.Errorf("unable to parse schema %w", err)
 		}
 	}
+	return codec, nil
+}
 
-	decoder := func(m *service.Message) error {
+func (s *schemaRegistryDecoder) hambaAvroDecoder(codec avro.Schema) schemaDecoder {
+	return func(m *service.Message) error {
 		b, err := m.AsBytes()
 		if err != nil {
 			return fmt.Errorf("unable to extract bytes from message: %w", err)
@@ -86,18 +98,20 @@ func (s *schemaRegistryDecoder) getHambaAvroDecoder(ctx context.Context, schema
 		}
 		var w avroSchemaWalker
 		w.unnestUnions = s.cfg.avro.rawUnions
+		w.nativeValues = s.cfg.avro.nativeValues
 		if native, err = w.walk(native, codec); err != nil {
 			return fmt.Errorf("unable to transform avro data into expected format: %w", err)
 		}
 		m.SetStructuredMut(native)
 		return nil
 	}
-
-	return decoder, nil
 }
 
 type avroSchemaWalker struct {
 	unnestUnions bool
+	// Decode fixed values as bytes and local timestamps as timestamps, rather
+	// than as arrays and numbers.
+	nativeValues bool
 }
 
 func (w *avroSchemaWalker) walk(root any, schema avro.Schema) (any, error) {
@@ -153,6 +167,12 @@ func (w *avroSchemaWalker) walk(root any, schema avro.Schema) (any, error) {
 	case avro.LogicalTypeSchema:
 		l := s.Logical()
 		if l == nil {
+			// Fixed values are decoded into arrays of their size.
+			if rv := reflect.ValueOf(root); w.nativeValues && rv.Kind() == reflect.Array {
+				b := make([]byte, rv.Len())
+				reflect.Copy(reflect.ValueOf(b), rv)
+				return b, nil
+			}
 			return root, nil
 		}
 		switch l.Type() {
@@ -179,6 +199,14 @@ func (w *avroSchemaWalker) walk(root any, schema avro.Schema) (any, error) {
 				return nil, fmt.Errorf("expected time.Duration for %v got: %T", l.Type(), root)
 			}
 			return v.String(), nil
+		case avro.LocalTimestampMillis:
+			if v, ok := root.(int64); ok && w.nativeValues {
+				return time.UnixMilli(v).UTC(), nil
+			}
+		case avro.LocalTimestampMicros:
+			if v, ok := root.(int64); ok && w.nativeValues {
+				return time.UnixMicro(v).UTC(), nil
+			}
 		}
 		return root, nil
 	default:
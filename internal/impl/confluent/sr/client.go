@@ -131,6 +131,52 @@ func (c *Client) GetMode(ctx context.Context) (string, error) {
 	return res[0].Mode.String(), nil
 }
 
+// GetCompatibility returns the compatibility level of subject, or the global
+// compatibility level when the subject doesn't have one.
+func (c *Client) GetCompatibility(ctx context.Context, subject string) (sr.CompatibilityLevel, error) {
+	res := c.Client.Compatibility(sr.WithParams(ctx, sr.DefaultToGlobal), subject)
+	// There will be one and only one element in the response.
+	if res[0].Err != nil {
+		return 0, fmt.Errorf("request failed: %s", res[0].Err)
+	}
+
+	return res[0].Level, nil
+}
+
+// SetCompatibility sets the compatibility level of subject.
+func (c *Client) SetCompatibility(ctx context.Context, subject string, level sr.CompatibilityLevel) error {
+	res := c.Client.SetCompatibility(ctx, sr.SetCompatibility{Level: level}, subject)
+	// There will be one and only one element in the response.
+	if res[0].Err != nil {
+		return fmt.Errorf("request failed: %s", res[0].Err)
+	}
+
+	return nil
+}
+
+// GetSubjectMode returns the mode of subject, or the mode of the Schema
+// Registry instance when the subject doesn't have one.
+func (c *Client) GetSubjectMode(ctx context.Context, subject string) (sr.Mode, error) {
+	res := c.Client.Mode(sr.WithParams(ctx, sr.DefaultToGlobal), subject)
+	// There will be one and only one element in the response.
+	if res[0].Err != nil {
+		return 0, fmt.Errorf("request failed: %s", res[0].Err)
+	}
+
+	return res[0].Mode, nil
+}
+
+// SetSubjectMode sets the mode of subject.
+func (c *Client) SetSubjectMode(ctx context.Context, subject string, mode sr.Mode) error {
+	res := c.Client.SetMode(ctx, mode, subject)
+	// There will be one and only one element in the response.
+	if res[0].Err != nil {
+		return fmt.Errorf("request failed: %s", res[0].Err)
+	}
+
+	return nil
+}
+
 // GetSubjects returns the registered subjects.
 func (c *Client) GetSubjects(ctx context.Context, includeDeleted bool) ([]string, error) {
 	if includeDeleted {
@@ -15,7 +15,9 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"net/http"
+	"slices"
 	"strconv"
 	"sync"
 	"testing"
@@ -1006,6 +1008,7 @@ func TestRedpandaMigratorOffsetsIntegration(t *testing.T) {
 		name          string
 		cgAtEndOffset bool
 		extraCGUpdate bool
+		topicPrefix   string
 	}{
 		{
 			name:          "source consumer group points to the topic end offset",
@@ -1020,6 +1023,11 @@ func TestRedpandaMigratorOffsetsIntegration(t *testing.T) {
 			cgAtEndOffset: true,
 			extraCGUpdate: true,
 		},
+		{
+			name:          "consumer group offsets are committed on prefixed topics",
+			cgAtEndOffset: false,
+			topicPrefix:   "clusterA.",
+		},
 	}
 
 	for _, test := range tests {
@@ -1038,7 +1046,8 @@ func TestRedpandaMigratorOffsetsIntegration(t *testing.T) {
 			t.Logf("Source broker: %s", source.brokerAddr)
 			t.Logf("Destination broker: %s", destination.brokerAddr)
 
-			dummyTopic := "test"
+			dummyTopic := "orders"
+			destTopic := test.topicPrefix + dummyTopic
 			dummyMessage := `{"test":"foo"}`
 			dummyConsumerGroup := "test_cg"
 			messageCount := 5
@@ -1048,7 +1057,7 @@ func TestRedpandaMigratorOffsetsIntegration(t *testing.T) {
 			produceMessages(t, source, dummyTopic, dummyMessage, 0, messageCount, false)
 
 			// Produce the exact same messages in the destination cluster.
-			produceMessages(t, destination, dummyTopic, dummyMessage, 0, messageCount, false)
+			produceMessages(t, destination, destTopic, dummyMessage, 0, messageCount, false)
 
 			// Read the messages from the source cluster using a consumer group.
 			readMessagesWithCG(t, source, dummyTopic, dummyConsumerGroup, dummyMessage, 5, false)
@@ -1058,7 +1067,7 @@ func TestRedpandaMigratorOffsetsIntegration(t *testing.T) {
 				// The next messages need to have more recent timestamps than the existing messages, so we use
 				// `messageCount` as an offset for their timestamps.
 				produceMessages(t, source, dummyTopic, dummyMessage, messageCount, messageCount, false)
-				produceMessages(t, destination, dummyTopic, dummyMessage, messageCount, messageCount, false)
+				produceMessages(t, destination, destTopic, dummyMessage, messageCount, messageCount, false)
 			}
 
 			t.Log("Finished setting up messages in the source and destination clusters")
@@ -1074,7 +1083,8 @@ input:
 output:
   redpanda_migrator_offsets:
     seed_brokers: [ %s ]
-`, source.brokerAddr, dummyTopic, destination.brokerAddr)))
+    topic_prefix: "%s"
+`, source.brokerAddr, dummyTopic, destination.brokerAddr, test.topicPrefix)))
 			require.NoError(t, streamBuilder.SetLoggerYAML(`level: INFO`))
 
 			migratorUpdateWG := sync.WaitGroup{}
@@ -1126,23 +1136,172 @@ output:
 
 			adm := kadm.NewClient(client)
 			offsets, err := adm.FetchOffsets(context.Background(), dummyConsumerGroup)
-			currentCGOffset, ok := offsets.Lookup(dummyTopic, 0)
+			currentCGOffset, ok := offsets.Lookup(destTopic, 0)
 			require.True(t, ok)
 
 			endOffset := int64(messageCount)
 			if test.cgAtEndOffset {
-				offsets, err := adm.ListEndOffsets(context.Background(), dummyTopic)
+				offsets, err := adm.ListEndOffsets(context.Background(), destTopic)
 				require.NoError(t, err)
-				o, ok := offsets.Lookup(dummyTopic, 0)
+				o, ok := offsets.Lookup(destTopic, 0)
 				require.True(t, ok)
 				endOffset = o.Offset
 			}
 			assert.Equal(t, endOffset, currentCGOffset.At)
-			assert.Equal(t, dummyTopic, currentCGOffset.Topic)
+			assert.Equal(t, destTopic, currentCGOffset.Topic)
 		})
 	}
 }
 
+// commitTransactionalOffset commits the offset of a consumer group within a transaction, like a consume-transform-produce
+// application which uses `sendOffsetsToTransaction`, and then commits or aborts the transaction.
+func commitTransactionalOffset(ctx context.Context, t *testing.T, client *kgo.Client, txnID, group, topic string, offset int64, commit bool) {
+	t.Helper()
+
+	initReq := kmsg.NewPtrInitProducerIDRequest()
+	initReq.TransactionalID = &txnID
+	initReq.TransactionTimeoutMillis = 60000
+	initResp, err := initReq.RequestWith(ctx, client)
+	require.NoError(t, err)
+	require.NoError(t, kerr.ErrorForCode(initResp.ErrorCode))
+
+	addReq := kmsg.NewPtrAddOffsetsToTxnRequest()
+	addReq.TransactionalID = txnID
+	addReq.ProducerID = initResp.ProducerID
+	addReq.ProducerEpoch = initResp.ProducerEpoch
+	addReq.Group = group
+	addResp, err := addReq.RequestWith(ctx, client)
+	require.NoError(t, err)
+	require.NoError(t, kerr.ErrorForCode(addResp.ErrorCode))
+
+	commitReq := kmsg.NewPtrTxnOffsetCommitRequest()
+	commitReq.TransactionalID = txnID
+	commitReq.Group = group
+	commitReq.ProducerID = initResp.ProducerID
+	commitReq.ProducerEpoch = initResp.ProducerEpoch
+	commitReq.Generation = -1
+	reqTopic := kmsg.NewTxnOffsetCommitRequestTopic()
+	reqTopic.Topic = topic
+	reqPartition := kmsg.NewTxnOffsetCommitRequestTopicPartition()
+	reqPartition.Offset = offset
+	reqPartition.LeaderEpoch = -1
+	reqTopic.Partitions = append(reqTopic.Partitions, reqPartition)
+	commitReq.Topics = append(commitReq.Topics, reqTopic)
+	commitResp, err := commitReq.RequestWith(ctx, client)
+	require.NoError(t, err)
+	for _, respTopic := range commitResp.Topics {
+		for _, respPartition := range respTopic.Partitions {
+			require.NoError(t, kerr.ErrorForCode(respPartition.ErrorCode))
+		}
+	}
+
+	endReq := kmsg.NewPtrEndTxnRequest()
+	endReq.TransactionalID = txnID
+	endReq.ProducerID = initResp.ProducerID
+	endReq.ProducerEpoch = initResp.ProducerEpoch
+	endReq.Commit = commit
+	endResp, err := endReq.RequestWith(ctx, client)
+	require.NoError(t, err)
+	require.NoError(t, kerr.ErrorForCode(endResp.ErrorCode))
+}
+
+func TestRedpandaMigratorOffsetsTransactionalIntegration(t *testing.T) {
+	integration.CheckSkip(t)
+	t.Parallel()
+
+	pool, err := dockertest.NewPool("")
+	require.NoError(t, err)
+	pool.MaxWait = time.Minute
+
+	source, err := startRedpanda(t, pool, true, true)
+	require.NoError(t, err)
+
+	topic := "orders"
+	group := "txn_cg"
+	produceMessages(t, source, topic, `{"test":"foo"}`, 0, 5, false)
+
+	ctx, done := context.WithTimeout(context.Background(), time.Minute)
+	defer done()
+
+	client, err := kgo.NewClient(kgo.SeedBrokers(source.brokerAddr))
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+
+	// The offset committed within the aborted transaction must never be emitted, while the offsets committed within the
+	// committed transaction and without a transaction are.
+	commitTransactionalOffset(ctx, t, client, "txn-aborted", group, topic, 2, false)
+	commitTransactionalOffset(ctx, t, client, "txn-committed", group, topic, 4, true)
+	offsets := kadm.Offsets{}
+	offsets.AddOffset(topic, 0, 5, -1)
+	_, err = kadm.NewClient(client).CommitOffsets(ctx, group, offsets)
+	require.NoError(t, err)
+
+	streamBuilder := service.NewStreamBuilder()
+	require.NoError(t, streamBuilder.SetYAML(fmt.Sprintf(`
+input:
+  redpanda_migrator_offsets:
+    seed_brokers: [ %s ]
+    topics: [ %s ]
+    payload_format: json
+`, source.brokerAddr, topic)))
+	require.NoError(t, streamBuilder.SetLoggerYAML(`level: INFO`))
+
+	type commit struct {
+		Offset        int64
+		Transactional any
+	}
+	var mu sync.Mutex
+	var commits []commit
+	require.NoError(t, streamBuilder.AddConsumerFunc(func(_ context.Context, m *service.Message) error {
+		b, err := m.AsBytes()
+		if err != nil {
+			return err
+		}
+		var doc struct {
+			Group  string `json:"group"`
+			Offset *int64 `json:"offset"`
+		}
+		if err := json.Unmarshal(b, &doc); err != nil {
+			return err
+		}
+		if doc.Group != group || doc.Offset == nil {
+			return nil
+		}
+		transactional, _ := m.MetaGetMut("kafka_offset_transactional")
+		mu.Lock()
+		commits = append(commits, commit{Offset: *doc.Offset, Transactional: transactional})
+		mu.Unlock()
+		return nil
+	}))
+
+	stream, err := streamBuilder.Build()
+	require.NoError(t, err)
+	license.InjectTestService(stream.Resources())
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- stream.Run(context.Background())
+	}()
+	t.Cleanup(func() {
+		require.NoError(t, stream.StopWithin(3*time.Second))
+		require.NoError(t, <-runErr)
+	})
+
+	// The commits are read in the order they were written, so the aborted commit would have been read before the last one.
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(commits) > 0 && commits[len(commits)-1].Offset == 5
+	}, 30*time.Second, 100*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []commit{
+		{Offset: 4, Transactional: true},
+		{Offset: 5, Transactional: false},
+	}, commits)
+}
+
 func TestRedpandaMigratorTopicConfigAndACLsIntegration(t *testing.T) {
 	integration.CheckSkip(t)
 	t.Parallel()
@@ -1244,3 +1403,237 @@ output:
 	// Ensure that the ACL was updated correctly
 	checkTopic(t, destination.brokerAddr, dummyTopic, dummyRetentionTime, dummyPrincipal, dummyACLOperation)
 }
+
+func TestRedpandaMigratorTransactionsIntegration(t *testing.T) {
+	integration.CheckSkip(t)
+	t.Parallel()
+
+	pool, err := dockertest.NewPool("")
+	require.NoError(t, err)
+	pool.MaxWait = time.Minute
+
+	source, err := startRedpanda(t, pool, true, true)
+	require.NoError(t, err)
+	destination, err := startRedpanda(t, pool, true, true)
+	require.NoError(t, err)
+
+	okTopic := "txn_ok"
+	failTopic := "txn_fail"
+
+	client, err := kgo.NewClient(kgo.SeedBrokers(source.brokerAddr))
+	require.NoError(t, err)
+	defer client.Close()
+
+	// The record in the middle of the failing batch exceeds the max_message_bytes of the output, so the batch fails
+	// after the records before it were produced.
+	require.NoError(t, client.ProduceSync(context.Background(),
+		&kgo.Record{Topic: failTopic, Partition: 0, Value: []byte("foo")},
+		&kgo.Record{Topic: failTopic, Partition: 0, Value: make([]byte, 2048)},
+		&kgo.Record{Topic: failTopic, Partition: 0, Value: []byte("bar")},
+		&kgo.Record{Topic: okTopic, Partition: 0, Value: []byte("baz")},
+		&kgo.Record{Topic: okTopic, Partition: 0, Value: []byte("qux")},
+	).FirstErr())
+
+	streamBuilder := service.NewStreamBuilder()
+	require.NoError(t, streamBuilder.SetYAML(fmt.Sprintf(`
+input:
+  redpanda_migrator:
+    seed_brokers: [ %s ]
+    topics: [ %s, %s ]
+    consumer_group: migrator_cg
+    start_from_oldest: true
+
+output:
+  redpanda_migrator:
+    seed_brokers: [ %s ]
+    topic: ${! @kafka_topic }
+    key: ${! @kafka_key }
+    partition: ${! @kafka_partition }
+    partitioner: manual
+    timestamp_ms: ${! @kafka_timestamp_ms }
+    translate_schema_ids: false
+    replication_factor_override: true
+    replication_factor: -1
+    max_message_bytes: 1KB
+    transaction: true
+    max_in_flight: 1
+`, source.brokerAddr, okTopic, failTopic, destination.brokerAddr)))
+	require.NoError(t, streamBuilder.SetLoggerYAML(`level: INFO`))
+
+	stream, err := streamBuilder.Build()
+	require.NoError(t, err)
+
+	license.InjectTestService(stream.Resources())
+
+	closeChan := make(chan struct{})
+	go func() {
+		err := stream.Run(context.Background())
+		require.NoError(t, err)
+
+		close(closeChan)
+	}()
+	t.Cleanup(func() {
+		require.NoError(t, stream.StopWithin(3*time.Second))
+
+		<-closeChan
+	})
+
+	readValues := func(topic string, isolationLevel kgo.IsolationLevel, wait time.Duration) (values []string) {
+		cl, err := kgo.NewClient(
+			kgo.SeedBrokers(destination.brokerAddr),
+			kgo.ConsumeTopics(topic),
+			kgo.FetchIsolationLevel(isolationLevel),
+		)
+		require.NoError(t, err)
+		defer cl.Close()
+
+		ctx, done := context.WithTimeout(context.Background(), wait)
+		defer done()
+
+		for ctx.Err() == nil {
+			cl.PollFetches(ctx).EachRecord(func(r *kgo.Record) {
+				values = append(values, string(r.Value))
+			})
+		}
+		return
+	}
+
+	// The batch without oversized records is committed.
+	assert.Eventually(t, func() bool {
+		return slices.Equal([]string{"baz", "qux"}, readValues(okTopic, kgo.ReadCommitted(), time.Second))
+	}, 30*time.Second, time.Second)
+
+	// The records of the failing batch were written to the destination topic, but their transactions were aborted.
+	assert.Eventually(t, func() bool {
+		return slices.Contains(readValues(failTopic, kgo.ReadUncommitted(), time.Second), "foo")
+	}, 30*time.Second, time.Second)
+	assert.Empty(t, readValues(failTopic, kgo.ReadCommitted(), 5*time.Second))
+}
+
+func TestRedpandaMigratorCompactedTopicIntegration(t *testing.T) {
+	integration.CheckSkip(t)
+	t.Parallel()
+
+	pool, err := dockertest.NewPool("")
+	require.NoError(t, err)
+	pool.MaxWait = time.Minute
+
+	source, err := startRedpanda(t, pool, true, true)
+	require.NoError(t, err)
+	destination, err := startRedpanda(t, pool, true, true)
+	require.NoError(t, err)
+
+	topic := "compacted"
+
+	client, err := kgo.NewClient(kgo.SeedBrokers(source.brokerAddr))
+	require.NoError(t, err)
+	defer client.Close()
+
+	cleanupPolicy := "compact"
+	_, err = kadm.NewClient(client).CreateTopic(context.Background(), 2, -1, map[string]*string{"cleanup.policy": &cleanupPolicy}, topic)
+	require.NoError(t, err)
+
+	// Each key is updated repeatedly and some of them are deleted with tombstones, which are records without a value.
+	compact := func(state map[string]string, r *kgo.Record) {
+		key := fmt.Sprintf("%d/%s", r.Partition, r.Key)
+		if r.Value == nil {
+			delete(state, key)
+		} else {
+			state[key] = string(r.Value)
+		}
+	}
+	expected := map[string]string{}
+	var records []*kgo.Record
+	for i := range 200 {
+		r := &kgo.Record{Topic: topic, Partition: int32(i % 2), Key: []byte("key" + strconv.Itoa(i%10))}
+		if i%7 != 3 {
+			r.Value = []byte("value" + strconv.Itoa(i))
+		}
+		compact(expected, r)
+		records = append(records, r)
+	}
+	require.NoError(t, client.ProduceSync(context.Background(), records...).FirstErr())
+
+	streamBuilder := service.NewStreamBuilder()
+	require.NoError(t, streamBuilder.SetYAML(fmt.Sprintf(`
+input:
+  redpanda_migrator:
+    seed_brokers: [ %s ]
+    topics: [ %s ]
+    consumer_group: migrator_cg
+    start_from_oldest: true
+
+output:
+  redpanda_migrator:
+    seed_brokers: [ %s ]
+    topic: ${! @kafka_topic }
+    key: ${! @kafka_key }
+    partition: ${! @kafka_partition }
+    partitioner: manual
+    timestamp_ms: ${! @kafka_timestamp_ms }
+    translate_schema_ids: false
+    replication_factor_override: true
+    replication_factor: -1
+    ordering: partition
+    max_in_flight: 8
+`, source.brokerAddr, topic, destination.brokerAddr)))
+	require.NoError(t, streamBuilder.SetLoggerYAML(`level: INFO`))
+
+	stream, err := streamBuilder.Build()
+	require.NoError(t, err)
+
+	license.InjectTestService(stream.Resources())
+
+	closeChan := make(chan struct{})
+	go func() {
+		err := stream.Run(context.Background())
+		require.NoError(t, err)
+
+		close(closeChan)
+	}()
+	t.Cleanup(func() {
+		require.NoError(t, stream.StopWithin(3*time.Second))
+
+		<-closeChan
+	})
+
+	// The destination topic compacts to the same state as the source topic, including the deletes of the tombstones.
+	assert.Eventually(t, func() bool {
+		cl, err := kgo.NewClient(
+			kgo.SeedBrokers(destination.brokerAddr),
+			kgo.ConsumeTopics(topic),
+			kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+		)
+		require.NoError(t, err)
+		defer cl.Close()
+
+		ctx, done := context.WithTimeout(context.Background(), 2*time.Second)
+		defer done()
+
+		state := map[string]string{}
+		var count int
+		for ctx.Err() == nil {
+			cl.PollFetches(ctx).EachRecord(func(r *kgo.Record) {
+				compact(state, r)
+				count++
+			})
+		}
+		return count >= len(records) && maps.Equal(expected, state)
+	}, 30*time.Second, time.Second)
+
+	// The cleanup policy of the source topic is copied to the destination topic.
+	destClient, err := kgo.NewClient(kgo.SeedBrokers(destination.brokerAddr))
+	require.NoError(t, err)
+	defer destClient.Close()
+	configs, err := kadm.NewClient(destClient).DescribeTopicConfigs(context.Background(), topic)
+	require.NoError(t, err)
+	rc, err := configs.On(topic, nil)
+	require.NoError(t, err)
+	var policy string
+	for _, c := range rc.Configs {
+		if c.Key == "cleanup.policy" {
+			policy = c.MaybeValue()
+		}
+	}
+	assert.Equal(t, "compact", policy)
+}
@@ -0,0 +1,92 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/kafka"
+)
+
+const fetchControlPathPrefix = "/redpanda_migrator/fetch/"
+
+type fetchControlResponse struct {
+	PausedTopics     []string           `json:"paused_topics"`
+	PausedPartitions map[string][]int32 `json:"paused_partitions"`
+}
+
+// fetchControlHandler returns a handler which lists the topics and partitions whose fetching is paused on GET requests
+// and pauses or resumes the topics or partitions listed in the query parameters on POST requests.
+func fetchControlHandler(ctrl *kafka.FranzFetchControl) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			if err := applyFetchControl(ctrl, r); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var resp fetchControlResponse
+		resp.PausedTopics, resp.PausedPartitions = ctrl.Paused()
+		if resp.PausedTopics == nil {
+			resp.PausedTopics = []string{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func applyFetchControl(ctrl *kafka.FranzFetchControl, r *http.Request) error {
+	query := r.URL.Query()
+	topics := query["topic"]
+	if len(topics) == 0 {
+		return errors.New("at least one topic must be specified")
+	}
+
+	var partitions []int32
+	for _, v := range query["partition"] {
+		partition, err := strconv.ParseInt(v, 10, 32)
+		if err != nil || partition < 0 {
+			return fmt.Errorf("invalid partition %q, expected a non-negative integer", v)
+		}
+		partitions = append(partitions, int32(partition))
+	}
+	if len(partitions) > 0 && len(topics) != 1 {
+		return errors.New("partitions can only be specified for a single topic")
+	}
+
+	switch action := query.Get("action"); action {
+	case "pause":
+		if len(partitions) > 0 {
+			ctrl.PausePartitions(topics[0], partitions...)
+		} else {
+			ctrl.PauseTopics(topics...)
+		}
+	case "resume":
+		if len(partitions) > 0 {
+			ctrl.ResumePartitions(topics[0], partitions...)
+		} else {
+			ctrl.ResumeTopics(topics...)
+		}
+	default:
+		return fmt.Errorf("invalid action %q, expected either pause or resume", action)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/kafka"
+)
+
+func TestFetchControlHandler(t *testing.T) {
+	ctrl := kafka.NewFranzFetchControl(service.MockResources().Metrics())
+	handler := fetchControlHandler(ctrl)
+
+	do := func(method, query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(method, fetchControlPathPrefix+"foo"+query, nil))
+		return rec
+	}
+	paused := func(rec *httptest.ResponseRecorder) fetchControlResponse {
+		t.Helper()
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var resp fetchControlResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return resp
+	}
+
+	assert.Equal(t, fetchControlResponse{PausedTopics: []string{}, PausedPartitions: map[string][]int32{}}, paused(do(http.MethodGet, "")))
+
+	assert.Equal(t, fetchControlResponse{
+		PausedTopics:     []string{"a", "b"},
+		PausedPartitions: map[string][]int32{},
+	}, paused(do(http.MethodPost, "?action=pause&topic=b&topic=a")))
+
+	paused(do(http.MethodPost, "?action=pause&topic=c&partition=3&partition=0"))
+	assert.Equal(t, fetchControlResponse{
+		PausedTopics:     []string{"b"},
+		PausedPartitions: map[string][]int32{"c": {0, 3}},
+	}, paused(do(http.MethodPost, "?action=resume&topic=a")))
+
+	assert.True(t, ctrl.IsPaused("b", 1))
+	assert.True(t, ctrl.IsPaused("c", 3))
+	assert.False(t, ctrl.IsPaused("a", 0))
+	assert.False(t, ctrl.IsPaused("c", 1))
+
+	for _, query := range []string{
+		"?action=pause",
+		"?action=stop&topic=a",
+		"?action=pause&topic=a&partition=x",
+		"?action=pause&topic=a&partition=-1",
+		"?action=pause&topic=a&topic=b&partition=0",
+	} {
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, query).Code, query)
+	}
+	assert.Equal(t, http.StatusMethodNotAllowed, do(http.MethodDelete, "").Code)
+}
@@ -0,0 +1,394 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/kafka"
+)
+
+const (
+	migrationStatusPath = "/redpanda_migrator/status"
+
+	// The source cluster watermarks are cached for this long, so that polling the status endpoint frequently doesn't
+	// result in a request to the source cluster for every poll.
+	migrationStatusWatermarksTTL = 5 * time.Second
+)
+
+var errMigrationStatusUnavailable = errors.New("the watermarks of the source cluster have not been fetched yet")
+
+type migrationStatusKey struct{}
+
+// migrationPartitionStatus is the migration status of a single partition of a source topic.
+type migrationPartitionStatus struct {
+	Partition           int32 `json:"partition"`
+	SourceHighWatermark int64 `json:"source_high_watermark"`
+	// LastMigratedOffset is -1 until a record of the partition was migrated.
+	LastMigratedOffset int64 `json:"last_migrated_offset"`
+	Lag                int64 `json:"lag"`
+}
+
+// migrationGroupStatus is the status of the last offset commit of a consumer group for a source topic.
+type migrationGroupStatus struct {
+	Synced     bool      `json:"synced"`
+	LastCommit time.Time `json:"last_commit"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// migrationTopicStatus is the migration status of a source topic.
+type migrationTopicStatus struct {
+	Lag          int64                           `json:"lag"`
+	CaughtUp     bool                            `json:"caught_up"`
+	GroupsSynced bool                            `json:"groups_synced"`
+	Partitions   []migrationPartitionStatus      `json:"partitions"`
+	Groups       map[string]migrationGroupStatus `json:"groups"`
+}
+
+// migrationStatusResponse is the body returned by the status endpoint.
+type migrationStatusResponse struct {
+	RefreshedAt  time.Time                       `json:"refreshed_at"`
+	RefreshError string                          `json:"refresh_error,omitempty"`
+	Topics       map[string]migrationTopicStatus `json:"topics"`
+}
+
+type partitionWatermarks struct {
+	start, end int64
+}
+
+type topicWatermarks map[string]map[int32]partitionWatermarks
+
+// migrationStatus tracks the progress of the migration of each source topic, which is served as JSON by an HTTP
+// endpoint so that orchestration tooling can cut over topics individually once they caught up. A single instance is
+// shared by all the migrator components of a stream.
+type migrationStatus struct {
+	ttl             time.Duration
+	fetchWatermarks func(ctx context.Context, topics []string) (topicWatermarks, error)
+
+	mu             sync.Mutex
+	inputResources []string
+	migrated       map[string]map[int32]int64
+	groups         map[string]map[string]migrationGroupStatus
+
+	// Serialises refreshes, so that concurrent requests share the result of a single refresh.
+	refreshMu   sync.Mutex
+	watermarks  topicWatermarks
+	refreshedAt time.Time
+	attemptedAt time.Time
+	refreshErr  error
+}
+
+func newMigrationStatus(mgr *service.Resources) *migrationStatus {
+	s := &migrationStatus{
+		ttl:      migrationStatusWatermarksTTL,
+		migrated: map[string]map[int32]int64{},
+		groups:   map[string]map[string]migrationGroupStatus{},
+	}
+	s.fetchWatermarks = func(ctx context.Context, topics []string) (topicWatermarks, error) {
+		return s.fetchSourceWatermarks(ctx, mgr, topics)
+	}
+	return s
+}
+
+// migrationStatusFor returns the migration status of the stream, the status endpoint is registered the first time it's
+// called.
+func migrationStatusFor(mgr *service.Resources) *migrationStatus {
+	s := newMigrationStatus(mgr)
+	if actual, loaded := mgr.GetOrSetGeneric(migrationStatusKey{}, s); loaded {
+		return actual.(*migrationStatus)
+	}
+
+	if !registerEndpoint(mgr, migrationStatusPath, "Returns the migration status of each topic migrated by the redpanda_migrator components as JSON.", s.handleStatus) {
+		mgr.Logger().Warnf("Unable to register the %s endpoint, the HTTP server of the stream isn't accessible", migrationStatusPath)
+	}
+	return s
+}
+
+type endpointRegistrar interface {
+	RegisterEndpoint(path, desc string, h http.HandlerFunc)
+}
+
+// registerEndpoint registers an HTTP endpoint with the HTTP server of the stream, which is only accessible through the
+// unwrapped resources. It returns false when the endpoint can't be registered.
+func registerEndpoint(mgr *service.Resources, path, desc string, h http.HandlerFunc) bool {
+	// The result of the Unwrap method of the unwrapper is a type which is internal to benthos, so the method can't be
+	// part of an interface that's asserted here and is called through reflection instead, the value it returns is
+	// then asserted to be an endpointRegistrar.
+	unwrap := reflect.ValueOf(mgr.XUnwrapper()).MethodByName("Unwrap")
+	if !unwrap.IsValid() || unwrap.Type().NumIn() != 0 || unwrap.Type().NumOut() != 1 {
+		return false
+	}
+	reg, ok := unwrap.Call(nil)[0].Interface().(endpointRegistrar)
+	if !ok {
+		return false
+	}
+	reg.RegisterEndpoint(path, desc, h)
+	return true
+}
+
+// addInputResource adds a redpanda_migrator input whose client is used to fetch the watermarks of the source topics.
+func (s *migrationStatus) addInputResource(label string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !slices.Contains(s.inputResources, label) {
+		s.inputResources = append(s.inputResources, label)
+	}
+}
+
+// recordMigrated advances the last migrated offsets of the source partitions of the messages in a batch which was
+// written successfully.
+func (s *migrationStatus) recordMigrated(batch service.MessageBatch) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, msg := range batch {
+		topic, ok := msg.MetaGet("kafka_topic")
+		if !ok {
+			continue
+		}
+		p, _ := msg.MetaGetMut("kafka_partition")
+		o, _ := msg.MetaGetMut("kafka_offset")
+		partition, okP := p.(int)
+		offset, okO := o.(int)
+		if !okP || !okO {
+			continue
+		}
+
+		partitions, exists := s.migrated[topic]
+		if !exists {
+			partitions = map[int32]int64{}
+			s.migrated[topic] = partitions
+		}
+		if last, exists := partitions[int32(partition)]; !exists || int64(offset) > last {
+			partitions[int32(partition)] = int64(offset)
+		}
+	}
+}
+
+// recordGroupCommit records the result of committing the offsets of a consumer group for a source topic.
+func (s *migrationStatus) recordGroupCommit(topic, group string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	groups, exists := s.groups[topic]
+	if !exists {
+		groups = map[string]migrationGroupStatus{}
+		s.groups[topic] = groups
+	}
+	status := migrationGroupStatus{Synced: err == nil, LastCommit: time.Now()}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	groups[group] = status
+}
+
+func (s *migrationStatus) fetchSourceWatermarks(ctx context.Context, mgr *service.Resources, topics []string) (topicWatermarks, error) {
+	s.mu.Lock()
+	inputResources := slices.Clone(s.inputResources)
+	s.mu.Unlock()
+
+	if len(inputResources) == 0 {
+		return nil, errors.New("no redpanda_migrator output is configured")
+	}
+
+	watermarks := topicWatermarks{}
+	for _, label := range inputResources {
+		if err := kafka.FranzSharedClientUse(label, mgr, func(details *kafka.FranzSharedClientInfo) error {
+			var inputTopics []string
+			for _, topic := range details.Client.GetConsumeTopics() {
+				if !isExcludedTopic(label, topic, mgr) {
+					inputTopics = append(inputTopics, topic)
+				}
+			}
+			for _, topic := range topics {
+				if !slices.Contains(inputTopics, topic) {
+					inputTopics = append(inputTopics, topic)
+				}
+			}
+			if len(inputTopics) == 0 {
+				return nil
+			}
+
+			// The shared client is owned by the input, so the admin client must not be closed.
+			adm := kadm.NewClient(details.Client)
+			startOffsets, err := adm.ListStartOffsets(ctx, inputTopics...)
+			if err != nil {
+				return fmt.Errorf("failed to list start offsets: %s", err)
+			}
+			topicPartitions := make(map[string][]int32, len(inputTopics))
+			for _, topic := range inputTopics {
+				topicPartitions[topic] = nil
+			}
+			// The watermarks of the partitions whose end offset can't be listed are left out.
+			endOffsets, err := details.EndOffsets(ctx, topicPartitions)
+			var partialErr *kafka.PartitionOffsetsError
+			if err != nil && !errors.As(err, &partialErr) {
+				return fmt.Errorf("failed to list end offsets: %s", err)
+			}
+			for topic, offsets := range endOffsets {
+				partitions, exists := watermarks[topic]
+				if !exists {
+					partitions = map[int32]partitionWatermarks{}
+					watermarks[topic] = partitions
+				}
+				for partition, end := range offsets {
+					wm := partitionWatermarks{end: end}
+					if start, ok := startOffsets.Lookup(topic, partition); ok && start.Err == nil {
+						wm.start = start.Offset
+					}
+					partitions[partition] = wm
+				}
+			}
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("input %q: %w", label, err)
+		}
+	}
+	return watermarks, nil
+}
+
+// refresh fetches the watermarks of the source topics when the cached ones are older than the TTL. Failed attempts are
+// also only retried after the TTL.
+func (s *migrationStatus) refresh(ctx context.Context) {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	if time.Since(s.attemptedAt) < s.ttl {
+		return
+	}
+	s.attemptedAt = time.Now()
+
+	s.mu.Lock()
+	topics := make([]string, 0, len(s.migrated))
+	for topic := range s.migrated {
+		topics = append(topics, topic)
+	}
+	s.mu.Unlock()
+	sort.Strings(topics)
+
+	watermarks, err := s.fetchWatermarks(ctx, topics)
+	if err != nil {
+		s.refreshErr = err
+		return
+	}
+	s.watermarks = watermarks
+	s.refreshedAt = s.attemptedAt
+	s.refreshErr = nil
+}
+
+// status returns the migration status of each source topic, a topic is caught up when the sum of the lag of its
+// partitions is at most maxLag.
+func (s *migrationStatus) status(ctx context.Context, maxLag int64) (*migrationStatusResponse, error) {
+	s.refresh(ctx)
+
+	s.refreshMu.Lock()
+	watermarks, refreshedAt, refreshErr := s.watermarks, s.refreshedAt, s.refreshErr
+	s.refreshMu.Unlock()
+	if refreshedAt.IsZero() {
+		if refreshErr != nil {
+			return nil, fmt.Errorf("%w: %s", errMigrationStatusUnavailable, refreshErr)
+		}
+		return nil, errMigrationStatusUnavailable
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resp := &migrationStatusResponse{
+		RefreshedAt: refreshedAt,
+		Topics:      map[string]migrationTopicStatus{},
+	}
+	if refreshErr != nil {
+		resp.RefreshError = refreshErr.Error()
+	}
+	for topic, partitions := range watermarks {
+		ts := migrationTopicStatus{
+			GroupsSynced: true,
+			Partitions:   make([]migrationPartitionStatus, 0, len(partitions)),
+			Groups:       map[string]migrationGroupStatus{},
+		}
+		for partition, wm := range partitions {
+			ps := migrationPartitionStatus{
+				Partition:           partition,
+				SourceHighWatermark: wm.end,
+				LastMigratedOffset:  -1,
+			}
+			next := wm.start
+			if last, exists := s.migrated[topic][partition]; exists {
+				ps.LastMigratedOffset = last
+				next = max(next, last+1)
+			}
+			// The migrated offsets can be ahead of the cached watermarks.
+			ps.Lag = max(0, wm.end-next)
+			ts.Lag += ps.Lag
+			ts.Partitions = append(ts.Partitions, ps)
+		}
+		sort.Slice(ts.Partitions, func(i, j int) bool {
+			return ts.Partitions[i].Partition < ts.Partitions[j].Partition
+		})
+		for group, gs := range s.groups[topic] {
+			ts.Groups[group] = gs
+			ts.GroupsSynced = ts.GroupsSynced && gs.Synced
+		}
+		ts.CaughtUp = ts.Lag <= maxLag
+		resp.Topics[topic] = ts
+	}
+	return resp, nil
+}
+
+func (s *migrationStatus) handleStatus(w http.ResponseWriter, r *http.Request) {
+	var maxLag int64
+	if v := r.URL.Query().Get("max_lag"); v != "" {
+		var err error
+		if maxLag, err = strconv.ParseInt(v, 10, 64); err != nil || maxLag < 0 {
+			http.Error(w, fmt.Sprintf("invalid max_lag %q, expected a non-negative integer", v), http.StatusBadRequest)
+			return
+		}
+	}
+
+	resp, err := s.status(r.Context(), maxLag)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+//------------------------------------------------------------------------------
+
+// migrationStatusOutput records the source offsets of the batches written successfully by the wrapped output.
+type migrationStatusOutput struct {
+	service.BatchOutput
+	status *migrationStatus
+}
+
+func (o *migrationStatusOutput) WriteBatch(ctx context.Context, batch service.MessageBatch) error {
+	if err := o.BatchOutput.WriteBatch(ctx, batch); err != nil {
+		return err
+	}
+	o.status.recordMigrated(batch)
+	return nil
+}
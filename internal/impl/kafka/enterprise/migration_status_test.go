@@ -0,0 +1,173 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func migratedMessage(topic string, partition, offset int) *service.Message {
+	msg := service.NewMessage(nil)
+	msg.MetaSetMut("kafka_topic", topic)
+	msg.MetaSetMut("kafka_partition", partition)
+	msg.MetaSetMut("kafka_offset", offset)
+	return msg
+}
+
+func TestMigrationStatus(t *testing.T) {
+	s := newMigrationStatus(service.MockResources())
+	s.ttl = time.Hour
+
+	var fetches int
+	var fetchErr error
+	s.fetchWatermarks = func(_ context.Context, topics []string) (topicWatermarks, error) {
+		fetches++
+		if fetchErr != nil {
+			return nil, fetchErr
+		}
+		return topicWatermarks{
+			"foo": {0: {start: 0, end: 10}, 1: {start: 5, end: 8}},
+			"bar": {0: {start: 0, end: 3}},
+		}, nil
+	}
+
+	fetchErr = errors.New("nope")
+	_, err := s.status(context.Background(), 0)
+	require.ErrorIs(t, err, errMigrationStatusUnavailable)
+	assert.ErrorContains(t, err, "nope")
+
+	// Failed refreshes are only retried after the TTL.
+	_, err = s.status(context.Background(), 0)
+	require.ErrorIs(t, err, errMigrationStatusUnavailable)
+	assert.Equal(t, 1, fetches)
+
+	fetchErr = nil
+	s.attemptedAt = time.Time{}
+
+	s.recordMigrated(service.MessageBatch{
+		migratedMessage("foo", 0, 7),
+		migratedMessage("foo", 0, 3),
+		migratedMessage("bar", 0, 2),
+		service.NewMessage(nil),
+	})
+	s.recordGroupCommit("foo", "a", nil)
+	s.recordGroupCommit("foo", "b", errors.New("not yet replicated"))
+	s.recordGroupCommit("bar", "a", nil)
+
+	resp, err := s.status(context.Background(), 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, fetches)
+	assert.Empty(t, resp.RefreshError)
+
+	foo := resp.Topics["foo"]
+	assert.Equal(t, []migrationPartitionStatus{
+		{Partition: 0, SourceHighWatermark: 10, LastMigratedOffset: 7, Lag: 2},
+		{Partition: 1, SourceHighWatermark: 8, LastMigratedOffset: -1, Lag: 3},
+	}, foo.Partitions)
+	assert.Equal(t, int64(5), foo.Lag)
+	assert.False(t, foo.CaughtUp)
+	assert.False(t, foo.GroupsSynced)
+	assert.True(t, foo.Groups["a"].Synced)
+	assert.Equal(t, "not yet replicated", foo.Groups["b"].Error)
+
+	bar := resp.Topics["bar"]
+	assert.Equal(t, int64(0), bar.Lag)
+	assert.True(t, bar.CaughtUp)
+	assert.True(t, bar.GroupsSynced)
+
+	resp, err = s.status(context.Background(), 5)
+	require.NoError(t, err)
+	assert.True(t, resp.Topics["foo"].CaughtUp)
+
+	// Migrated offsets are served without refreshing the cached watermarks.
+	s.recordMigrated(service.MessageBatch{migratedMessage("foo", 1, 12)})
+	resp, err = s.status(context.Background(), 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, fetches)
+	assert.Equal(t, migrationPartitionStatus{Partition: 1, SourceHighWatermark: 8, LastMigratedOffset: 12, Lag: 0}, resp.Topics["foo"].Partitions[1])
+
+	// The last watermarks are kept when a refresh fails.
+	fetchErr = errors.New("broker unavailable")
+	s.attemptedAt = time.Time{}
+	resp, err = s.status(context.Background(), 0)
+	require.NoError(t, err)
+	assert.Equal(t, "broker unavailable", resp.RefreshError)
+	assert.Len(t, resp.Topics, 2)
+}
+
+func TestMigrationStatusHandler(t *testing.T) {
+	s := newMigrationStatus(service.MockResources())
+	var ready bool
+	s.fetchWatermarks = func(context.Context, []string) (topicWatermarks, error) {
+		if !ready {
+			return nil, errors.New("no redpanda_migrator output is configured")
+		}
+		return topicWatermarks{"foo": {0: {end: 4}}}, nil
+	}
+
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.handleStatus(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	rec := get(migrationStatusPath)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	ready = true
+	s.attemptedAt = time.Time{}
+	s.recordMigrated(service.MessageBatch{migratedMessage("foo", 0, 1)})
+
+	rec = get(migrationStatusPath + "?max_lag=foo")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = get(migrationStatusPath + "?max_lag=2")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var resp map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, map[string]any{
+		"lag":           float64(2),
+		"caught_up":     true,
+		"groups_synced": true,
+		"partitions": []any{
+			map[string]any{
+				"partition":             float64(0),
+				"source_high_watermark": float64(4),
+				"last_migrated_offset":  float64(1),
+				"lag":                   float64(2),
+			},
+		},
+		"groups": map[string]any{},
+	}, resp["topics"].(map[string]any)["foo"])
+}
+
+func TestMigrationStatusFor(t *testing.T) {
+	res := service.MockResources()
+	s := migrationStatusFor(res)
+	assert.Same(t, s, migrationStatusFor(res))
+	assert.NotSame(t, s, migrationStatusFor(service.MockResources()))
+
+	s.addInputResource("foo")
+	s.addInputResource("foo")
+	assert.Equal(t, []string{"foo"}, s.inputResources)
+
+	assert.True(t, registerEndpoint(res, "/foo", "Foo.", func(http.ResponseWriter, *http.Request) {}))
+}
@@ -0,0 +1,251 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Jeffail/shutdown"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/kafka"
+)
+
+// aclSyncer periodically updates the ACLs of the migrated topics in the output cluster to match the ACLs of the topics
+// in the input cluster.
+type aclSyncer struct {
+	interval      time.Duration
+	deleteRemoved bool
+
+	startOnce sync.Once
+	shutSig   *shutdown.Signaller
+
+	added     *service.MetricCounter
+	removed   *service.MetricCounter
+	unchanged *service.MetricCounter
+}
+
+func newACLSyncer(interval time.Duration, deleteRemoved bool, metrics *service.Metrics) *aclSyncer {
+	return &aclSyncer{
+		interval:      interval,
+		deleteRemoved: deleteRemoved,
+		shutSig:       shutdown.NewSignaller(),
+		added:         metrics.NewCounter("redpanda_migrator_acls_added"),
+		removed:       metrics.NewCounter("redpanda_migrator_acls_removed"),
+		unchanged:     metrics.NewCounter("redpanda_migrator_acls_unchanged"),
+	}
+}
+
+// start runs syncFn every interval in the background until stop is called. Subsequent calls and calls after stop do
+// nothing.
+func (s *aclSyncer) start(syncFn func(ctx context.Context) aclSyncResult, log *service.Logger) {
+	if s == nil {
+		return
+	}
+
+	s.startOnce.Do(func() {
+		go func() {
+			defer s.shutSig.TriggerHasStopped()
+
+			ctx, done := s.shutSig.SoftStopCtx(context.Background())
+			defer done()
+
+			// A cycle which takes longer than the interval causes ticks to be dropped, so cycles never overlap and
+			// start at most once per interval.
+			ticker := time.NewTicker(s.interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					return
+				}
+
+				res := syncFn(ctx)
+				if ctx.Err() != nil {
+					return
+				}
+
+				s.added.Incr(int64(res.added))
+				s.removed.Incr(int64(res.removed))
+				s.unchanged.Incr(int64(res.unchanged))
+				log.Infof(
+					"Synced ACLs of %d topics: %d added, %d removed, %d unchanged, %d topics failed",
+					res.topics, res.added, res.removed, res.unchanged, res.failedTopics,
+				)
+			}
+		}()
+	})
+}
+
+// stop stops the background loop and waits for it to exit.
+func (s *aclSyncer) stop(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+
+	// The loop is never started once the syncer is stopped.
+	s.startOnce.Do(s.shutSig.TriggerHasStopped)
+	s.shutSig.TriggerSoftStop()
+
+	select {
+	case <-s.shutSig.HasStoppedChan():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// aclSyncResult counts the ACLs which were changed by a sync cycle.
+type aclSyncResult struct {
+	topics       int
+	failedTopics int
+	added        int
+	removed      int
+	unchanged    int
+	// The ACLs which were created, which are only set for the result of a single topic.
+	created []topicACL
+}
+
+// syncACLs updates the ACLs of all the topics which were migrated so far. Failing to sync a topic is logged and doesn't
+// prevent the other topics from being synced, they are all synced again in the next cycle.
+func (w *redpandaMigratorWriter) syncACLs(ctx context.Context) aclSyncResult {
+	var res aclSyncResult
+
+	w.clientMut.Lock()
+	outputClient := w.client
+	w.clientMut.Unlock()
+	if outputClient == nil {
+		w.mgr.Logger().Debug("Skipping ACL sync because the output is not connected")
+		return res
+	}
+
+	var topics []string
+	w.topicCache.Range(func(key, _ any) bool {
+		topics = append(topics, key.(string))
+		return true
+	})
+	slices.Sort(topics)
+
+	for _, topic := range topics {
+		if ctx.Err() != nil {
+			break
+		}
+		if isExcludedTopic(w.inputResource, topic, w.mgr) {
+			continue
+		}
+
+		destTopic := w.topicPrefix + topic
+		res.topics++
+		syncTopic := func(inputClient *kgo.Client) error {
+			topicRes, err := syncTopicACLs(ctx, topic, destTopic, w.principalMapper, w.aclSyncer.deleteRemoved, inputClient, outputClient)
+			res.added += topicRes.added
+			res.removed += topicRes.removed
+			res.unchanged += topicRes.unchanged
+			for _, acl := range topicRes.created {
+				w.events.aclCreated(destTopic, acl)
+			}
+			return err
+		}
+		var err error
+		if w.adminOpts != nil {
+			err = w.adminClientUse(syncTopic)
+		} else {
+			// The shared client is accessed for each topic, so that the input isn't blocked from reconnecting for a
+			// whole cycle.
+			err = kafka.FranzSharedClientUse(w.inputResource, w.mgr, func(details *kafka.FranzSharedClientInfo) error {
+				return syncTopic(details.Client)
+			})
+		}
+		if errors.Is(err, kafka.ErrClientClosing) {
+			// The input is closing, so the remaining topics are synced once the pipeline restarts.
+			w.mgr.Logger().Debugf("Input %q is closing, stopping the ACL sync", w.inputResource)
+			break
+		}
+		if err != nil {
+			res.failedTopics++
+			w.mgr.Logger().Warnf("Failed to sync ACLs for topic %q: %s", destTopic, err)
+		}
+	}
+
+	return res
+}
+
+// syncTopicACLs creates the ACLs of topic from the input cluster which are missing from destTopic in the output cluster
+// and, when deleteRemoved is set, deletes the ACLs of destTopic which no longer exist for topic.
+func syncTopicACLs(ctx context.Context, topic, destTopic string, principalMapper *aclPrincipalMapper, deleteRemoved bool, inputClient, outputClient *kgo.Client) (res aclSyncResult, err error) {
+	sourceACLs, err := describeTopicACLs(ctx, inputClient, topic)
+	if err != nil {
+		return res, err
+	}
+
+	destACLs, err := describeTopicACLs(ctx, outputClient, destTopic)
+	if err != nil {
+		return res, err
+	}
+
+	add, remove, unchanged := diffTopicACLs(destinationTopicACLs(sourceACLs, topic, principalMapper), destACLs, deleteRemoved)
+	res.unchanged = unchanged
+
+	outputAdminClient := kadm.NewClient(outputClient)
+	for _, acl := range add {
+		if _, err := outputAdminClient.CreateACLs(ctx, acl.builder(destTopic)); err != nil {
+			return res, fmt.Errorf("failed to create ACLs for topic %q: %w", destTopic, err)
+		}
+		res.added++
+		res.created = append(res.created, acl)
+	}
+
+	for _, acl := range remove {
+		results, err := outputAdminClient.DeleteACLs(ctx, acl.builder(destTopic))
+		if err != nil {
+			return res, fmt.Errorf("failed to delete ACLs for topic %q: %w", destTopic, err)
+		}
+		for _, r := range results {
+			if r.Err != nil {
+				return res, fmt.Errorf("failed to delete ACLs for topic %q: %w", destTopic, r.Err)
+			}
+		}
+		res.removed++
+	}
+
+	return res, nil
+}
+
+// diffTopicACLs returns the desired ACLs which don't exist yet and, when deleteRemoved is set, the existing ACLs which
+// are not desired, along with the number of desired ACLs which already exist. Existing ACLs which are never created by
+// the migrator, such as ALLOW WRITE ACLs, are never removed.
+func diffTopicACLs(desired, existing []topicACL, deleteRemoved bool) (add, remove []topicACL, unchanged int) {
+	for _, acl := range desired {
+		if slices.Contains(existing, acl) {
+			unchanged++
+		} else {
+			add = append(add, acl)
+		}
+	}
+
+	if deleteRemoved {
+		for _, acl := range existing {
+			if isMigratedTopicACL(acl) && !slices.Contains(desired, acl) {
+				remove = append(remove, acl)
+			}
+		}
+	}
+
+	return add, remove, unchanged
+}
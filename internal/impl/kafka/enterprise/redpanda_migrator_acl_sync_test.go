@@ -0,0 +1,259 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/kafka"
+)
+
+func TestDestinationTopicACLs(t *testing.T) {
+	mapping, err := bloblang.Parse(`root = if this == "User:skip" { deleted() } else { this }`)
+	require.NoError(t, err)
+	mapper := &aclPrincipalMapper{mapping: mapping, logger: service.MockResources().Logger()}
+
+	acls := destinationTopicACLs([]topicACL{
+		{principal: "User:foo", host: "*", operation: kmsg.ACLOperationWrite, permission: kmsg.ACLPermissionTypeAllow},
+		{principal: "User:foo", host: "*", operation: kmsg.ACLOperationAll, permission: kmsg.ACLPermissionTypeAllow},
+		{principal: "User:foo", host: "*", operation: kmsg.ACLOperationRead, permission: kmsg.ACLPermissionTypeAllow},
+		{principal: "User:bar", host: "10.0.0.1", operation: kmsg.ACLOperationDescribe, permission: kmsg.ACLPermissionTypeDeny},
+		{principal: "User:skip", host: "*", operation: kmsg.ACLOperationRead, permission: kmsg.ACLPermissionTypeAllow},
+	}, "foo", mapper)
+
+	assert.Equal(t, []topicACL{
+		{principal: "User:foo", host: "*", operation: kmsg.ACLOperationRead, permission: kmsg.ACLPermissionTypeAllow},
+		{principal: "User:bar", host: "10.0.0.1", operation: kmsg.ACLOperationDescribe, permission: kmsg.ACLPermissionTypeDeny},
+	}, acls)
+}
+
+func TestDiffTopicACLs(t *testing.T) {
+	read := topicACL{principal: "User:foo", host: "*", operation: kmsg.ACLOperationRead, permission: kmsg.ACLPermissionTypeAllow}
+	describe := topicACL{principal: "User:foo", host: "*", operation: kmsg.ACLOperationDescribe, permission: kmsg.ACLPermissionTypeAllow}
+	deny := topicACL{principal: "User:bar", host: "*", operation: kmsg.ACLOperationRead, permission: kmsg.ACLPermissionTypeDeny}
+	write := topicACL{principal: "User:foo", host: "*", operation: kmsg.ACLOperationWrite, permission: kmsg.ACLPermissionTypeAllow}
+	all := topicACL{principal: "User:baz", host: "*", operation: kmsg.ACLOperationAll, permission: kmsg.ACLPermissionTypeAllow}
+
+	tests := []struct {
+		name              string
+		desired           []topicACL
+		existing          []topicACL
+		deleteRemoved     bool
+		expectedAdd       []topicACL
+		expectedRemove    []topicACL
+		expectedUnchanged int
+	}{
+		{
+			name:              "in sync",
+			desired:           []topicACL{read, deny},
+			existing:          []topicACL{deny, read},
+			expectedUnchanged: 2,
+		},
+		{
+			name:              "added",
+			desired:           []topicACL{read, describe},
+			existing:          []topicACL{read},
+			expectedAdd:       []topicACL{describe},
+			expectedUnchanged: 1,
+		},
+		{
+			name:              "removed without deletion",
+			desired:           []topicACL{read},
+			existing:          []topicACL{read, deny},
+			expectedUnchanged: 1,
+		},
+		{
+			name:              "removed with deletion",
+			desired:           []topicACL{read},
+			existing:          []topicACL{read, deny},
+			deleteRemoved:     true,
+			expectedRemove:    []topicACL{deny},
+			expectedUnchanged: 1,
+		},
+		{
+			name:           "write and all are never removed",
+			desired:        []topicACL{describe},
+			existing:       []topicACL{write, all, read},
+			deleteRemoved:  true,
+			expectedAdd:    []topicACL{describe},
+			expectedRemove: []topicACL{read},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			add, remove, unchanged := diffTopicACLs(test.desired, test.existing, test.deleteRemoved)
+			assert.Equal(t, test.expectedAdd, add)
+			assert.Equal(t, test.expectedRemove, remove)
+			assert.Equal(t, test.expectedUnchanged, unchanged)
+		})
+	}
+}
+
+func TestACLSyncerStartStop(t *testing.T) {
+	var nilSyncer *aclSyncer
+	nilSyncer.start(nil, nil)
+	require.NoError(t, nilSyncer.stop(context.Background()))
+
+	var cycles atomic.Int64
+	syncer := newACLSyncer(time.Millisecond, false, service.MockResources().Metrics())
+	syncer.start(func(context.Context) aclSyncResult {
+		cycles.Add(1)
+		return aclSyncResult{topics: 1, unchanged: 1}
+	}, service.MockResources().Logger())
+
+	assert.Eventually(t, func() bool { return cycles.Load() >= 2 }, time.Second, time.Millisecond)
+	require.NoError(t, syncer.stop(context.Background()))
+
+	stopped := cycles.Load()
+	syncer.start(func(context.Context) aclSyncResult {
+		cycles.Add(1)
+		return aclSyncResult{}
+	}, service.MockResources().Logger())
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, stopped, cycles.Load())
+
+	// A syncer which is stopped before it is started never runs.
+	syncer = newACLSyncer(time.Millisecond, false, service.MockResources().Metrics())
+	require.NoError(t, syncer.stop(context.Background()))
+	syncer.start(func(context.Context) aclSyncResult {
+		cycles.Add(1)
+		return aclSyncResult{}
+	}, service.MockResources().Logger())
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, stopped, cycles.Load())
+}
+
+func TestRedpandaMigratorOutputACLSyncLinting(t *testing.T) {
+	configTests := []struct {
+		name        string
+		config      string
+		errContains string
+	}{
+		{
+			name: "acl sync",
+			config: `
+redpanda_migrator:
+  seed_brokers: [ localhost:9092 ]
+  topic: foo
+  acl_sync_interval: 5m
+  delete_removed_acls: true
+`,
+		},
+		{
+			name: "delete removed acls without sync",
+			config: `
+redpanda_migrator:
+  seed_brokers: [ localhost:9092 ]
+  topic: foo
+  delete_removed_acls: true
+`,
+			errContains: "acl_sync_interval must be set when delete_removed_acls is enabled",
+		},
+		{
+			name: "acl sync with acl migration disabled",
+			config: `
+redpanda_migrator:
+  seed_brokers: [ localhost:9092 ]
+  topic: foo
+  acl_sync_interval: 5m
+  acl_migration: disabled
+`,
+			errContains: "acl_sync_interval can't be set when acl_migration is disabled",
+		},
+		{
+			name: "required acl migration with admin connection",
+			config: `
+redpanda_migrator:
+  seed_brokers: [ localhost:9092 ]
+  topic: foo
+  acl_migration: required
+  admin:
+    seed_brokers: [ localhost:9093 ]
+    sasl:
+      - mechanism: SCRAM-SHA-256
+        username: admin
+        password: admin
+`,
+		},
+	}
+
+	env := service.NewEnvironment()
+	for _, test := range configTests {
+		t.Run(test.name, func(t *testing.T) {
+			strm := env.NewStreamBuilder()
+			err := strm.AddOutputYAML(test.config)
+			if test.errContains == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.errContains)
+			}
+		})
+	}
+}
+
+func TestRedpandaMigratorOutputACLMigrationProbe(t *testing.T) {
+	newWriter := func(aclMigration string) *redpandaMigratorWriter {
+		return &redpandaMigratorWriter{
+			aclMigration:  aclMigration,
+			inputResource: "missing",
+			mgr:           service.MockResources(),
+		}
+	}
+
+	w := newWriter(aclMigrationDisabled)
+	require.NoError(t, w.probeACLMigration(context.Background()))
+	assert.True(t, w.aclsProbed)
+	assert.False(t, w.aclsEnabled)
+
+	// The input isn't connected yet, so the probe is repeated later.
+	w = newWriter(aclMigrationEnabled)
+	require.NoError(t, w.probeACLMigration(context.Background()))
+	assert.False(t, w.aclsProbed)
+	assert.False(t, w.aclsEnabled)
+
+	w = newWriter(aclMigrationRequired)
+	require.ErrorContains(t, w.probeACLMigration(context.Background()), "failed to describe the ACLs of the source cluster")
+	assert.False(t, w.aclsProbed)
+}
+
+func TestRedpandaMigratorOutputMigratesACLsAfterLateProbe(t *testing.T) {
+	res := service.MockResources()
+	w := &redpandaMigratorWriter{
+		inputResource: "input",
+		mgr:           res,
+		aclsProbed:    true,
+		aclsEnabled:   true,
+		aclSyncer:     newACLSyncer(time.Hour, false, res.Metrics()),
+	}
+	t.Cleanup(func() { require.NoError(t, w.aclSyncer.stop(context.Background())) })
+
+	// The input isn't connected yet, so the ACLs are migrated again later.
+	w.migrateTopicACLs(context.Background(), nil)
+	assert.False(t, w.aclsMigrated)
+
+	client, err := kgo.NewClient(kgo.SeedBrokers("localhost:1"))
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+	require.NoError(t, kafka.FranzSharedClientSet("input", t, &kafka.FranzSharedClientInfo{Client: client}, res))
+
+	w.migrateTopicACLs(context.Background(), nil)
+	assert.True(t, w.aclsMigrated)
+}
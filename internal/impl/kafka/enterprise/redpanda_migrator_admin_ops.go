@@ -0,0 +1,102 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const (
+	adminOpCreateTopic = "create_topic"
+	adminOpCreateACLs  = "create_acls"
+	adminOpDeleteTopic = "delete_topic"
+)
+
+// adminOpLimiter limits the number of admin requests which the migrator output sends to the destination cluster
+// concurrently across all of its in-flight batches, so that its controller isn't overwhelmed when records of many new
+// topics are written at once. It also reports the count and latency of the requests by operation.
+type adminOpLimiter struct {
+	sem      chan struct{}
+	requests *service.MetricCounter
+	latency  *service.MetricTimer
+}
+
+func newAdminOpLimiter(maxConcurrent int, mgr *service.Resources) *adminOpLimiter {
+	return &adminOpLimiter{
+		sem:      make(chan struct{}, maxConcurrent),
+		requests: mgr.Metrics().NewCounter("redpanda_migrator_admin_requests", "operation", "result"),
+		latency:  mgr.Metrics().NewTimer("redpanda_migrator_admin_request_latency_ns", "operation"),
+	}
+}
+
+// do runs op once a slot is available. It returns the error of the context when it's cancelled before then.
+func (l *adminOpLimiter) do(ctx context.Context, operation string, op func() error) error {
+	select {
+	case l.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-l.sem }()
+
+	start := time.Now()
+	err := op()
+	l.latency.Timing(time.Since(start).Nanoseconds(), operation)
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	l.requests.Incr(1, operation, result)
+	return err
+}
+
+// topicCreation is the creation of a destination topic which is in progress.
+type topicCreation struct {
+	done chan struct{}
+	err  error
+}
+
+// topicCreations deduplicates the creation of topics across the in-flight batches of the migrator output, so that
+// batches which need the same topic wait for a single creation to complete, without waiting for unrelated topics.
+type topicCreations struct {
+	mu       sync.Mutex
+	inFlight map[string]*topicCreation
+}
+
+// ensure runs create for topic unless a creation of the same topic is already in progress, in which case it waits for
+// it to complete and returns its error.
+func (c *topicCreations) ensure(ctx context.Context, topic string, create func() error) error {
+	c.mu.Lock()
+	if tc, exists := c.inFlight[topic]; exists {
+		c.mu.Unlock()
+		select {
+		case <-tc.done:
+			return tc.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if c.inFlight == nil {
+		c.inFlight = map[string]*topicCreation{}
+	}
+	tc := &topicCreation{done: make(chan struct{})}
+	c.inFlight[topic] = tc
+	c.mu.Unlock()
+
+	tc.err = create()
+
+	c.mu.Lock()
+	delete(c.inFlight, topic)
+	c.mu.Unlock()
+	close(tc.done)
+	return tc.err
+}
@@ -0,0 +1,154 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminOpLimiter(t *testing.T) {
+	l := newAdminOpLimiter(2, service.MockResources())
+
+	var running, maxRunning atomic.Int32
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, l.do(context.Background(), adminOpCreateTopic, func() error {
+				n := running.Add(1)
+				for {
+					m := maxRunning.Load()
+					if n <= m || maxRunning.CompareAndSwap(m, n) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				running.Add(-1)
+				return nil
+			}))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), maxRunning.Load())
+
+	errNope := errors.New("nope")
+	require.ErrorIs(t, l.do(context.Background(), adminOpCreateACLs, func() error { return errNope }), errNope)
+
+	// Waiting for a slot stops when the context is cancelled.
+	release := make(chan struct{})
+	for range 2 {
+		go func() {
+			_ = l.do(context.Background(), adminOpCreateTopic, func() error {
+				<-release
+				return nil
+			})
+		}()
+	}
+	require.Eventually(t, func() bool { return len(l.sem) == 2 }, time.Second, time.Millisecond)
+
+	ctx, done := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer done()
+	var called bool
+	err := l.do(ctx, adminOpCreateTopic, func() error {
+		called = true
+		return nil
+	})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.False(t, called)
+	close(release)
+}
+
+func TestTopicCreations(t *testing.T) {
+	var c topicCreations
+
+	// Concurrent creations of the same topic wait for the first one.
+	started, finish := make(chan struct{}), make(chan struct{})
+	var calls atomic.Int32
+	errNope := errors.New("nope")
+	create := func() error {
+		if calls.Add(1) == 1 {
+			close(started)
+		}
+		<-finish
+		return errNope
+	}
+
+	errs := make(chan error, 2)
+	go func() { errs <- c.ensure(context.Background(), "foo", create) }()
+	<-started
+	go func() { errs <- c.ensure(context.Background(), "foo", create) }()
+
+	// Other topics don't wait for it.
+	require.NoError(t, c.ensure(context.Background(), "bar", func() error { return nil }))
+
+	// Waiting stops when the context is cancelled.
+	ctx, done := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer done()
+	require.ErrorIs(t, c.ensure(ctx, "foo", create), context.DeadlineExceeded)
+
+	close(finish)
+	require.ErrorIs(t, <-errs, errNope)
+	require.ErrorIs(t, <-errs, errNope)
+	assert.Equal(t, int32(1), calls.Load())
+
+	// The topic is created again once the previous creation completed.
+	require.NoError(t, c.ensure(context.Background(), "foo", func() error { return nil }))
+}
+
+func TestRedpandaMigratorOutputMaxConcurrentAdminOpsLinting(t *testing.T) {
+	configTests := []struct {
+		name        string
+		config      string
+		errContains string
+	}{
+		{
+			name: "max concurrent admin ops set",
+			config: `
+redpanda_migrator:
+  seed_brokers: [ localhost:9092 ]
+  topic: ${! @kafka_topic }
+  max_concurrent_admin_ops: 10
+`,
+		},
+		{
+			name: "max concurrent admin ops below one",
+			config: `
+redpanda_migrator:
+  seed_brokers: [ localhost:9092 ]
+  topic: ${! @kafka_topic }
+  max_concurrent_admin_ops: 0
+`,
+			errContains: "max_concurrent_admin_ops must be at least 1",
+		},
+	}
+
+	env := service.NewEnvironment()
+	for _, test := range configTests {
+		t.Run(test.name, func(t *testing.T) {
+			strm := env.NewStreamBuilder()
+			err := strm.AddOutputYAML(test.config)
+			if test.errContains == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.errContains)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedpandaMigratorBundleConfigErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		output      string
+		errContains string
+	}{
+		{
+			name: "unknown source field",
+			input: `
+redpanda_migrator_bundle:
+  source:
+    seed_brokers: [ localhost:9092 ]
+    brokers: [ localhost:9092 ]
+  topics: [ foo ]
+  consumer_group: migrator
+`,
+			errContains: "unknown fields brokers in source",
+		},
+		{
+			name: "source field also set in redpanda_migrator",
+			input: `
+redpanda_migrator_bundle:
+  source:
+    seed_brokers: [ localhost:9092 ]
+  topics: [ foo ]
+  redpanda_migrator:
+    seed_brokers: [ localhost:9093 ]
+    topics: [ bar ]
+    consumer_group: migrator
+`,
+			errContains: "fields seed_brokers, topics must be set either in the redpanda_migrator field or at the top level of the bundle, but not both",
+		},
+		{
+			name: "missing source seed brokers",
+			input: `
+redpanda_migrator_bundle:
+  topics: [ foo ]
+  consumer_group: migrator
+`,
+			errContains: "the seed_brokers of the source cluster must be set",
+		},
+		{
+			name: "partial source schema registry",
+			input: `
+redpanda_migrator_bundle:
+  source:
+    seed_brokers: [ localhost:9092 ]
+    schema_registry:
+      basic_auth:
+        enabled: true
+  topics: [ foo ]
+  consumer_group: migrator
+`,
+			errContains: "the url of the source schema registry must be set",
+		},
+		{
+			name: "destination field also set in redpanda_migrator",
+			output: `
+redpanda_migrator_bundle:
+  destination:
+    seed_brokers: [ localhost:9092 ]
+  redpanda_migrator:
+    seed_brokers: [ localhost:9093 ]
+`,
+			errContains: "fields seed_brokers must be set either in destination or in redpanda_migrator, but not both",
+		},
+		{
+			name: "missing destination",
+			output: `
+redpanda_migrator_bundle:
+  migrate_offsets: false
+`,
+			errContains: "the redpanda_migrator output must be configured",
+		},
+		{
+			name: "destination schema registry field also set in schema_registry",
+			output: `
+redpanda_migrator_bundle:
+  destination:
+    seed_brokers: [ localhost:9092 ]
+    schema_registry:
+      url: http://localhost:8081
+  schema_registry:
+    url: http://localhost:8082
+`,
+			errContains: "fields url must be set either in destination.schema_registry or in schema_registry, but not both",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			strm := service.NewStreamBuilder()
+			input, output := test.input, test.output
+			if input == "" {
+				input = `generate: { mapping: 'root = ""' }`
+			}
+			if output == "" {
+				output = `drop: {}`
+			}
+			require.NoError(t, strm.AddInputYAML(input))
+			require.NoError(t, strm.AddOutputYAML(output))
+
+			stream, err := strm.Build()
+			require.NoError(t, err)
+
+			// The bundles are expanded when the stream components are initialised
+			ctx, done := context.WithTimeout(context.Background(), 10*time.Second)
+			defer done()
+			err = stream.Run(ctx)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.errContains)
+		})
+	}
+}
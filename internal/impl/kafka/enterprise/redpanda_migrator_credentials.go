@@ -0,0 +1,251 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/kafka"
+)
+
+const (
+	rmoFieldCredentialOverrides      = "credential_overrides"
+	rmoFieldCredentialOverrideName   = "name"
+	rmoFieldCredentialOverrideTopics = "topics"
+
+	// The credential label of the records which are produced with the default connection.
+	defaultCredentialName = "default"
+)
+
+// credentialOverridesLint rejects topic patterns of different credentials which overlap, since routing would be
+// ambiguous.
+const credentialOverridesLint = `
+let patterns = this.` + rmoFieldCredentialOverrides + `.or([]).map_each(o -> o.` + rmoFieldCredentialOverrideTopics + `.or([]).map_each(t -> {"name": o.` + rmoFieldCredentialOverrideName + `.or(""), "topic": t, "exact": !t.has_suffix("*"), "prefix": t.trim_suffix("*")})).flatten()
+root = $patterns.enumerated().map_each(a -> $patterns.slice(a.index + 1).filter(b -> b.name != a.value.name && (
+  (a.value.exact && b.exact && a.value.prefix == b.prefix) ||
+  (!b.exact && a.value.prefix.has_prefix(b.prefix)) ||
+  (!a.value.exact && b.prefix.has_prefix(a.value.prefix))
+)).map_each(b -> "topic pattern %q of credential %q overlaps with topic pattern %q of credential %q".format(a.value.topic, a.value.name, b.topic, b.name))).flatten()
+`
+
+func credentialOverridesField() *service.ConfigField {
+	return service.NewObjectListField(rmoFieldCredentialOverrides,
+		service.NewStringField(rmoFieldCredentialOverrideName).
+			Description("The name of the credential, which identifies it in logs and metrics."),
+		service.NewStringListField(rmoFieldCredentialOverrideTopics).
+			Description("The destination topics which are written with the credential. Each pattern is either a topic name or a topic prefix followed by `*`, such as `team-a.*`. Patterns are matched after `topic_prefix` is applied."),
+		kafka.SASLFields(),
+	).
+		Description("SASL credentials which are used instead of the default connection to write to the destination topics which match their patterns, for clusters where topics can only be written by the principals of the teams which own them. A separate client is created for each credential once it's first needed, and the topics and ACLs are also created with it. Topics which don't match any pattern are written with the default connection. Patterns of different credentials must not overlap and credentials can't be used together with `transaction`. The records written with each credential are reported by the `redpanda_migrator_credential_records` metric, labelled by the name of the credential or `" + defaultCredentialName + "`.").
+		Example([]any{
+			map[string]any{
+				rmoFieldCredentialOverrideName:   "team-a",
+				rmoFieldCredentialOverrideTopics: []any{"team-a.*"},
+				"sasl": []any{
+					map[string]any{"mechanism": "SCRAM-SHA-512", "username": "team-a", "password": "${TEAM_A_PASSWORD}"},
+				},
+			},
+		}).
+		Optional().
+		Advanced()
+}
+
+// topicPattern matches either a topic name or a topic prefix.
+type topicPattern struct {
+	prefix string
+	exact  bool
+}
+
+func parseTopicPattern(s string) topicPattern {
+	if prefix, ok := strings.CutSuffix(s, "*"); ok {
+		return topicPattern{prefix: prefix}
+	}
+	return topicPattern{prefix: s, exact: true}
+}
+
+func (p topicPattern) matches(topic string) bool {
+	if p.exact {
+		return topic == p.prefix
+	}
+	return strings.HasPrefix(topic, p.prefix)
+}
+
+// overlaps returns whether some topic matches both patterns.
+func (p topicPattern) overlaps(o topicPattern) bool {
+	switch {
+	case p.exact && o.exact:
+		return p.prefix == o.prefix
+	case p.exact:
+		return strings.HasPrefix(p.prefix, o.prefix)
+	case o.exact:
+		return strings.HasPrefix(o.prefix, p.prefix)
+	}
+	return strings.HasPrefix(p.prefix, o.prefix) || strings.HasPrefix(o.prefix, p.prefix)
+}
+
+func (p topicPattern) String() string {
+	if p.exact {
+		return p.prefix
+	}
+	return p.prefix + "*"
+}
+
+// topicCredential is a SASL credential which writes to the destination topics matching its patterns.
+type topicCredential struct {
+	name     string
+	patterns []topicPattern
+	sasl     []sasl.Mechanism
+}
+
+// topicCredentialsFromParsed returns the credentials listed in the credential_overrides field.
+func topicCredentialsFromParsed(conf *service.ParsedConfig) ([]*topicCredential, error) {
+	if !conf.Contains(rmoFieldCredentialOverrides) {
+		return nil, nil
+	}
+	confs, err := conf.FieldObjectList(rmoFieldCredentialOverrides)
+	if err != nil {
+		return nil, err
+	}
+
+	creds := make([]*topicCredential, 0, len(confs))
+	for i, c := range confs {
+		cred := &topicCredential{}
+		if cred.name, err = c.FieldString(rmoFieldCredentialOverrideName); err != nil {
+			return nil, err
+		}
+		if cred.name == "" || cred.name == defaultCredentialName {
+			return nil, fmt.Errorf("%s %d: the name must not be empty or %q", rmoFieldCredentialOverrides, i, defaultCredentialName)
+		}
+		for _, other := range creds {
+			if other.name == cred.name {
+				return nil, fmt.Errorf("%s %d: duplicate credential name %q", rmoFieldCredentialOverrides, i, cred.name)
+			}
+		}
+
+		var topics []string
+		if topics, err = c.FieldStringList(rmoFieldCredentialOverrideTopics); err != nil {
+			return nil, err
+		}
+		if len(topics) == 0 {
+			return nil, fmt.Errorf("%s %d: at least one topic pattern must be listed", rmoFieldCredentialOverrides, i)
+		}
+		for _, t := range topics {
+			cred.patterns = append(cred.patterns, parseTopicPattern(t))
+		}
+
+		if cred.sasl, err = kafka.SASLMechanismsFromConfig(c); err != nil {
+			return nil, err
+		}
+		creds = append(creds, cred)
+	}
+
+	// Routing would be ambiguous if a topic matched the patterns of multiple credentials.
+	for i, a := range creds {
+		for _, b := range creds[i+1:] {
+			for _, pa := range a.patterns {
+				for _, pb := range b.patterns {
+					if pa.overlaps(pb) {
+						return nil, fmt.Errorf("topic pattern %q of credential %q overlaps with topic pattern %q of credential %q", pa, a.name, pb, b.name)
+					}
+				}
+			}
+		}
+	}
+	return creds, nil
+}
+
+// credentialRouter selects the client which writes to each destination topic, creating a client for each credential
+// once it's first needed.
+type credentialRouter struct {
+	credentials []*topicCredential
+	// clientOpts returns the options of a client authenticated with the given SASL mechanisms.
+	clientOpts func(mechanisms []sasl.Mechanism) []kgo.Opt
+	records    *service.MetricCounter
+
+	mu      sync.Mutex
+	clients map[string]*kgo.Client
+}
+
+func newCredentialRouter(credentials []*topicCredential, clientOpts func([]sasl.Mechanism) []kgo.Opt, mgr *service.Resources) *credentialRouter {
+	return &credentialRouter{
+		credentials: credentials,
+		clientOpts:  clientOpts,
+		records:     mgr.Metrics().NewCounter("redpanda_migrator_credential_records", "credential"),
+		clients:     map[string]*kgo.Client{},
+	}
+}
+
+// credentialFor returns the credential whose patterns match topic or nil if none do.
+func (r *credentialRouter) credentialFor(topic string) *topicCredential {
+	for _, cred := range r.credentials {
+		for _, p := range cred.patterns {
+			if p.matches(topic) {
+				return cred
+			}
+		}
+	}
+	return nil
+}
+
+// client returns the client of the credential which writes to topic, or nil when topic is written with the default
+// connection.
+func (r *credentialRouter) client(topic string) (*kgo.Client, error) {
+	cred := r.credentialFor(topic)
+	if cred == nil {
+		return nil, nil
+	}
+	return r.credentialClient(cred)
+}
+
+func (r *credentialRouter) credentialClient(cred *topicCredential) (*kgo.Client, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if client, exists := r.clients[cred.name]; exists {
+		return client, nil
+	}
+	client, err := kgo.NewClient(r.clientOpts(cred.sasl)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client for credential %q: %w", cred.name, err)
+	}
+	r.clients[cred.name] = client
+	return client, nil
+}
+
+// route returns the client of the credential which writes the record, or nil for the default connection, and counts
+// the record.
+func (r *credentialRouter) route(record *kgo.Record) (*kgo.Client, error) {
+	cred := r.credentialFor(record.Topic)
+	if cred == nil {
+		r.records.Incr(1, defaultCredentialName)
+		return nil, nil
+	}
+	client, err := r.credentialClient(cred)
+	if err != nil {
+		return nil, err
+	}
+	r.records.Incr(1, cred.name)
+	return client, nil
+}
+
+// close closes the clients of all credentials, which are created again when they're next needed.
+func (r *credentialRouter) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, client := range r.clients {
+		client.Close()
+		delete(r.clients, name)
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+)
+
+func TestTopicPatternOverlaps(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		overlaps bool
+	}{
+		{a: "foo", b: "foo", overlaps: true},
+		{a: "foo", b: "bar", overlaps: false},
+		{a: "foo", b: "fo*", overlaps: true},
+		{a: "foo", b: "foo*", overlaps: true},
+		{a: "foo", b: "foob*", overlaps: false},
+		{a: "team-a.*", b: "team-a.orders*", overlaps: true},
+		{a: "team-a.*", b: "team-b.*", overlaps: false},
+		{a: "*", b: "anything", overlaps: true},
+	}
+	for _, test := range tests {
+		a, b := parseTopicPattern(test.a), parseTopicPattern(test.b)
+		assert.Equal(t, test.overlaps, a.overlaps(b), "%s %s", test.a, test.b)
+		assert.Equal(t, test.overlaps, b.overlaps(a), "%s %s", test.b, test.a)
+		assert.Equal(t, test.a, a.String())
+	}
+
+	assert.True(t, parseTopicPattern("team-a.*").matches("team-a.orders"))
+	assert.False(t, parseTopicPattern("team-a.*").matches("team-b.orders"))
+	assert.True(t, parseTopicPattern("orders").matches("orders"))
+	assert.False(t, parseTopicPattern("orders").matches("orders-dlq"))
+}
+
+func TestTopicCredentialsFromParsed(t *testing.T) {
+	parse := func(yaml string) ([]*topicCredential, error) {
+		conf, err := redpandaMigratorOutputConfig().ParseYAML(yaml, nil)
+		require.NoError(t, err)
+		return topicCredentialsFromParsed(conf)
+	}
+
+	creds, err := parse(`
+seed_brokers: [ localhost:9092 ]
+topic: ${! @kafka_topic }
+`)
+	require.NoError(t, err)
+	assert.Empty(t, creds)
+
+	creds, err = parse(`
+seed_brokers: [ localhost:9092 ]
+topic: ${! @kafka_topic }
+credential_overrides:
+  - name: team-a
+    topics: [ "team-a.*", shared-orders ]
+    sasl:
+      - mechanism: SCRAM-SHA-512
+        username: team-a
+        password: foo
+  - name: team-b
+    topics: [ "team-b.*" ]
+    sasl:
+      - mechanism: PLAIN
+        username: team-b
+        password: bar
+`)
+	require.NoError(t, err)
+	require.Len(t, creds, 2)
+	assert.Equal(t, "team-a", creds[0].name)
+	assert.Len(t, creds[0].patterns, 2)
+	assert.Len(t, creds[0].sasl, 1)
+	assert.Equal(t, "team-b", creds[1].name)
+
+	_, err = parse(`
+seed_brokers: [ localhost:9092 ]
+topic: ${! @kafka_topic }
+credential_overrides:
+  - name: team-a
+    topics: [ "team-*" ]
+  - name: team-b
+    topics: [ "team-b.*" ]
+`)
+	require.ErrorContains(t, err, `topic pattern "team-*" of credential "team-a" overlaps with topic pattern "team-b.*" of credential "team-b"`)
+
+	_, err = parse(`
+seed_brokers: [ localhost:9092 ]
+topic: ${! @kafka_topic }
+credential_overrides:
+  - name: team-a
+    topics: [ "team-a.*" ]
+  - name: team-a
+    topics: [ "team-b.*" ]
+`)
+	require.ErrorContains(t, err, `duplicate credential name "team-a"`)
+
+	_, err = parse(`
+seed_brokers: [ localhost:9092 ]
+topic: ${! @kafka_topic }
+credential_overrides:
+  - name: default
+    topics: [ "team-a.*" ]
+`)
+	require.ErrorContains(t, err, "must not be empty")
+}
+
+func TestCredentialRouter(t *testing.T) {
+	creds := []*topicCredential{
+		{name: "team-a", patterns: []topicPattern{parseTopicPattern("team-a.*")}},
+		{name: "team-b", patterns: []topicPattern{parseTopicPattern("team-b.orders")}},
+	}
+	var created []int
+	r := newCredentialRouter(creds, func(mechanisms []sasl.Mechanism) []kgo.Opt {
+		created = append(created, len(mechanisms))
+		return []kgo.Opt{kgo.SeedBrokers("localhost:0")}
+	}, service.MockResources())
+	t.Cleanup(r.close)
+
+	client, err := r.route(&kgo.Record{Topic: "unmatched"})
+	require.NoError(t, err)
+	assert.Nil(t, client, "unmatched topics use the default client")
+
+	clientA, err := r.route(&kgo.Record{Topic: "team-a.orders"})
+	require.NoError(t, err)
+	require.NotNil(t, clientA)
+	again, err := r.client("team-a.payments")
+	require.NoError(t, err)
+	assert.Same(t, clientA, again, "clients are created once per credential")
+
+	clientB, err := r.client("team-b.orders")
+	require.NoError(t, err)
+	require.NotNil(t, clientB)
+	assert.NotSame(t, clientA, clientB)
+	assert.Len(t, created, 2)
+
+	// Clients are created again after being closed.
+	r.close()
+	reopened, err := r.client("team-a.orders")
+	require.NoError(t, err)
+	assert.NotSame(t, clientA, reopened)
+	assert.Len(t, created, 3)
+}
+
+func TestRedpandaMigratorOutputCredentialOverridesLinting(t *testing.T) {
+	configTests := []struct {
+		name        string
+		config      string
+		errContains string
+	}{
+		{
+			name: "disjoint patterns",
+			config: `
+redpanda_migrator:
+  seed_brokers: [ localhost:9092 ]
+  topic: ${! @kafka_topic }
+  credential_overrides:
+    - name: team-a
+      topics: [ "team-a.*", "shared" ]
+    - name: team-b
+      topics: [ "team-b.*" ]
+`,
+		},
+		{
+			name: "overlapping patterns of the same credential",
+			config: `
+redpanda_migrator:
+  seed_brokers: [ localhost:9092 ]
+  topic: ${! @kafka_topic }
+  credential_overrides:
+    - name: team-a
+      topics: [ "team-a.*", "team-a.orders" ]
+`,
+		},
+		{
+			name: "overlapping patterns of different credentials",
+			config: `
+redpanda_migrator:
+  seed_brokers: [ localhost:9092 ]
+  topic: ${! @kafka_topic }
+  credential_overrides:
+    - name: team-a
+      topics: [ "team-a.*" ]
+    - name: team-b
+      topics: [ "team-a.orders" ]
+`,
+			errContains: `topic pattern "team-a.*" of credential "team-a" overlaps with topic pattern "team-a.orders" of credential "team-b"`,
+		},
+		{
+			name: "credential overrides with transactions",
+			config: `
+redpanda_migrator:
+  seed_brokers: [ localhost:9092 ]
+  topic: ${! @kafka_topic }
+  transaction: true
+  credential_overrides:
+    - name: team-a
+      topics: [ "team-a.*" ]
+`,
+			errContains: "credential_overrides can't be used together with transaction",
+		},
+	}
+
+	env := service.NewEnvironment()
+	for _, test := range configTests {
+		t.Run(test.name, func(t *testing.T) {
+			strm := env.NewStreamBuilder()
+			err := strm.AddOutputYAML(test.config)
+			if test.errContains == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.errContains)
+			}
+		})
+	}
+}
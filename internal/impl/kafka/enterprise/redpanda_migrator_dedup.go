@@ -0,0 +1,321 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/asyncroutine"
+)
+
+// dedupFlushInterval is the interval at which the watermarks of the written records are stored in the dedup cache.
+const dedupFlushInterval = time.Second
+
+// dedupPartition is the dedup state of a source partition.
+type dedupPartition struct {
+	// The watermark loaded from the cache, or -1 when the cache doesn't have one.
+	loaded int64
+	// The highest source offset written successfully.
+	written int64
+	// The lowest source offsets of the batches which are being written or which failed and weren't retried
+	// successfully yet, which the watermark must not move past.
+	pending map[int64]struct{}
+	// The last watermark stored in the cache.
+	stored int64
+}
+
+// watermark returns the highest source offset up to which all the records of the partition were written.
+func (p *dedupPartition) watermark() int64 {
+	w := p.written
+	for offset := range p.pending {
+		w = min(w, offset-1)
+	}
+	return max(w, p.loaded)
+}
+
+// dedupWatermarks stores the highest source offset written to the destination cluster of each source topic partition
+// in a cache resource, so that records which were already written before a restart are skipped instead of being
+// written again.
+type dedupWatermarks struct {
+	mgr   *service.Resources
+	cache string
+
+	mu         sync.Mutex
+	partitions map[string]map[int32]*dedupPartition
+
+	// flushMu serializes flushes, so that an older watermark never replaces a newer one in the cache.
+	flushMu   sync.Mutex
+	flushLoop *asyncroutine.Periodic
+}
+
+func newDedupWatermarks(mgr *service.Resources, cache string) *dedupWatermarks {
+	d := &dedupWatermarks{
+		mgr:        mgr,
+		cache:      cache,
+		partitions: map[string]map[int32]*dedupPartition{},
+	}
+	d.flushLoop = asyncroutine.NewPeriodicWithContext(dedupFlushInterval, func(ctx context.Context) {
+		if err := d.flush(ctx); err != nil {
+			d.mgr.Logger().Warnf("Failed to store dedup watermarks: %s", err)
+		}
+	})
+	return d
+}
+
+func dedupKey(topic string, partition int32) string {
+	return topic + "_" + strconv.Itoa(int(partition))
+}
+
+// sourceOffset returns the source topic, partition and offset of a message, which are false for messages without the
+// metadata of the redpanda_migrator input.
+func sourceOffset(msg *service.Message) (string, int32, int64, bool) {
+	topic, ok := msg.MetaGet("kafka_topic")
+	if !ok {
+		return "", 0, 0, false
+	}
+	p, _ := msg.MetaGetMut("kafka_partition")
+	o, _ := msg.MetaGetMut("kafka_offset")
+	partition, okP := p.(int)
+	offset, okO := o.(int)
+	if !okP || !okO {
+		return "", 0, 0, false
+	}
+	return topic, int32(partition), int64(offset), true
+}
+
+// load reads the watermarks of the partitions of the batch which weren't seen yet from the cache.
+func (d *dedupWatermarks) load(ctx context.Context, batch service.MessageBatch) error {
+	missing := map[string]map[int32]struct{}{}
+	d.mu.Lock()
+	for _, msg := range batch {
+		topic, partition, _, ok := sourceOffset(msg)
+		if !ok {
+			continue
+		}
+		if _, exists := d.partitions[topic][partition]; exists {
+			continue
+		}
+		if missing[topic] == nil {
+			missing[topic] = map[int32]struct{}{}
+		}
+		missing[topic][partition] = struct{}{}
+	}
+	d.mu.Unlock()
+	if len(missing) == 0 {
+		return nil
+	}
+
+	loaded := map[string]map[int32]int64{}
+	var cacheErr error
+	if err := d.mgr.AccessCache(ctx, d.cache, func(cache service.Cache) {
+		for topic, partitions := range missing {
+			loaded[topic] = map[int32]int64{}
+			for partition := range partitions {
+				var b []byte
+				if b, cacheErr = cache.Get(ctx, dedupKey(topic, partition)); errors.Is(cacheErr, service.ErrKeyNotFound) {
+					cacheErr = nil
+					loaded[topic][partition] = -1
+					continue
+				} else if cacheErr != nil {
+					return
+				}
+
+				var offset int64
+				if offset, cacheErr = strconv.ParseInt(string(b), 10, 64); cacheErr != nil {
+					cacheErr = fmt.Errorf("invalid watermark for partition %d of topic %q: %s", partition, topic, cacheErr)
+					return
+				}
+				loaded[topic][partition] = offset
+			}
+		}
+	}); err != nil {
+		return fmt.Errorf("failed to access dedup cache: %s", err)
+	}
+	if cacheErr != nil {
+		return fmt.Errorf("failed to read dedup watermark: %s", cacheErr)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for topic, partitions := range loaded {
+		if d.partitions[topic] == nil {
+			d.partitions[topic] = map[int32]*dedupPartition{}
+		}
+		for partition, offset := range partitions {
+			// Another batch of the same partition may have loaded it concurrently.
+			if _, exists := d.partitions[topic][partition]; !exists {
+				d.partitions[topic][partition] = &dedupPartition{loaded: offset, written: offset, pending: map[int64]struct{}{}, stored: offset}
+			}
+		}
+	}
+	return nil
+}
+
+// filter replaces the records whose source offset isn't above the watermark of their partition with nil, so that they
+// are not written again, and tracks the remaining records of the batch until it's written successfully.
+func (d *dedupWatermarks) filter(ctx context.Context, batch service.MessageBatch, records []*kgo.Record) error {
+	if err := d.load(ctx, batch); err != nil {
+		return err
+	}
+
+	type skippedRecords struct {
+		count     int
+		watermark int64
+	}
+	skipped := map[string]map[int32]*skippedRecords{}
+	lowest := map[*dedupPartition]int64{}
+
+	d.mu.Lock()
+	watermarks := map[*dedupPartition]int64{}
+	for i, msg := range batch {
+		topic, partition, offset, ok := sourceOffset(msg)
+		if !ok || i >= len(records) || records[i] == nil {
+			continue
+		}
+		p := d.partitions[topic][partition]
+		watermark, exists := watermarks[p]
+		if !exists {
+			watermark = p.watermark()
+			watermarks[p] = watermark
+		}
+		if offset <= watermark {
+			records[i] = nil
+			if skipped[topic] == nil {
+				skipped[topic] = map[int32]*skippedRecords{}
+			}
+			if skipped[topic][partition] == nil {
+				skipped[topic][partition] = &skippedRecords{watermark: watermark}
+			}
+			skipped[topic][partition].count++
+			continue
+		}
+		if l, exists := lowest[p]; !exists || offset < l {
+			lowest[p] = offset
+		}
+	}
+	for p, offset := range lowest {
+		p.pending[offset] = struct{}{}
+	}
+	d.mu.Unlock()
+
+	for topic, partitions := range skipped {
+		for partition, s := range partitions {
+			d.mgr.Logger().Debugf(
+				"Skipped %d records of partition %d of topic %q which were already written up to source offset %d",
+				s.count, partition, topic, s.watermark,
+			)
+		}
+	}
+	return nil
+}
+
+// written advances the watermarks of the partitions of a batch which was written successfully. The watermarks are
+// stored in the cache in the background.
+func (d *dedupWatermarks) written(batch service.MessageBatch) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, msg := range batch {
+		topic, partition, offset, ok := sourceOffset(msg)
+		if !ok {
+			continue
+		}
+		p, exists := d.partitions[topic][partition]
+		if !exists {
+			continue
+		}
+		delete(p.pending, offset)
+		p.written = max(p.written, offset)
+	}
+}
+
+// flush stores the watermarks which advanced since they were last stored in the cache.
+func (d *dedupWatermarks) flush(ctx context.Context) error {
+	d.flushMu.Lock()
+	defer d.flushMu.Unlock()
+
+	type partitionWatermark struct {
+		topic     string
+		partition int32
+		offset    int64
+	}
+	var toStore []partitionWatermark
+	d.mu.Lock()
+	for topic, partitions := range d.partitions {
+		for partition, p := range partitions {
+			if w := p.watermark(); w > p.stored {
+				toStore = append(toStore, partitionWatermark{topic: topic, partition: partition, offset: w})
+			}
+		}
+	}
+	d.mu.Unlock()
+	if len(toStore) == 0 {
+		return nil
+	}
+
+	stored := make([]partitionWatermark, 0, len(toStore))
+	var errs []error
+	if err := d.mgr.AccessCache(ctx, d.cache, func(cache service.Cache) {
+		for _, w := range toStore {
+			if err := cache.Set(ctx, dedupKey(w.topic, w.partition), []byte(strconv.FormatInt(w.offset, 10)), nil); err != nil {
+				errs = append(errs, fmt.Errorf("failed to store dedup watermark for partition %d of topic %q: %s", w.partition, w.topic, err))
+				continue
+			}
+			stored = append(stored, w)
+		}
+	}); err != nil {
+		return fmt.Errorf("failed to access dedup cache: %s", err)
+	}
+
+	d.mu.Lock()
+	for _, w := range stored {
+		p := d.partitions[w.topic][w.partition]
+		p.stored = max(p.stored, w.offset)
+	}
+	d.mu.Unlock()
+	return errors.Join(errs...)
+}
+
+// dedupOutput advances the dedup watermarks of the batches written successfully by the wrapped output and stores them
+// in the cache in the background, so that writing to the cache doesn't delay the batches.
+type dedupOutput struct {
+	service.BatchOutput
+	dedup *dedupWatermarks
+}
+
+func newDedupOutput(output service.BatchOutput, dedup *dedupWatermarks) *dedupOutput {
+	dedup.flushLoop.Start()
+	return &dedupOutput{BatchOutput: output, dedup: dedup}
+}
+
+func (o *dedupOutput) WriteBatch(ctx context.Context, batch service.MessageBatch) error {
+	if err := o.BatchOutput.WriteBatch(ctx, batch); err != nil {
+		return err
+	}
+	o.dedup.written(batch)
+	return nil
+}
+
+func (o *dedupOutput) Close(ctx context.Context) error {
+	o.dedup.flushLoop.Stop()
+	flushErr := o.dedup.flush(ctx)
+	if flushErr != nil {
+		flushErr = fmt.Errorf("failed to store dedup watermarks: %w", flushErr)
+	}
+	return errors.Join(flushErr, o.BatchOutput.Close(ctx))
+}
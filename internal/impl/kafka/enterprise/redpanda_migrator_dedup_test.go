@@ -0,0 +1,199 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func newDedupBatch(topic string, partition int, offsets ...int) (service.MessageBatch, []*kgo.Record) {
+	var batch service.MessageBatch
+	var records []*kgo.Record
+	for _, offset := range offsets {
+		msg := service.NewMessage([]byte("foo"))
+		msg.MetaSetMut("kafka_topic", topic)
+		msg.MetaSetMut("kafka_partition", partition)
+		msg.MetaSetMut("kafka_offset", offset)
+		batch = append(batch, msg)
+		records = append(records, &kgo.Record{Topic: topic, Value: []byte("foo")})
+	}
+	return batch, records
+}
+
+func writtenRecords(records []*kgo.Record) int {
+	var n int
+	for _, r := range records {
+		if r != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func TestDedupWatermarks(t *testing.T) {
+	ctx := context.Background()
+	res := service.MockResources(service.MockResourcesOptAddCache("dedup"))
+	d := newDedupWatermarks(res, "dedup")
+
+	cacheValue := func(key string) string {
+		t.Helper()
+		var v []byte
+		require.NoError(t, res.AccessCache(ctx, "dedup", func(c service.Cache) {
+			var err error
+			if v, err = c.Get(ctx, key); errors.Is(err, service.ErrKeyNotFound) {
+				err = nil
+			}
+			require.NoError(t, err)
+		}))
+		return string(v)
+	}
+	require.NoError(t, res.AccessCache(ctx, "dedup", func(c service.Cache) {
+		require.NoError(t, c.Set(ctx, "foo_0", []byte("5"), nil))
+	}))
+
+	// The records which were written before the restart are skipped.
+	batch, records := newDedupBatch("foo", 0, 3, 4, 5, 6, 7)
+	require.NoError(t, d.filter(ctx, batch, records))
+	assert.Equal(t, 2, writtenRecords(records))
+	assert.NotNil(t, records[3])
+	assert.NotNil(t, records[4])
+	d.written(batch)
+
+	other, otherRecords := newDedupBatch("foo", 1, 0, 1)
+	require.NoError(t, d.filter(ctx, other, otherRecords))
+	assert.Equal(t, 2, writtenRecords(otherRecords))
+
+	// The watermarks are only stored when flushed.
+	assert.Equal(t, "5", cacheValue("foo_0"))
+	require.NoError(t, d.flush(ctx))
+	assert.Equal(t, "7", cacheValue("foo_0"))
+	assert.Equal(t, "", cacheValue("foo_1"), "batches which weren't written aren't stored")
+
+	// The watermark doesn't move past a batch which failed until it's retried successfully.
+	failed, failedRecords := newDedupBatch("foo", 0, 8, 9)
+	require.NoError(t, d.filter(ctx, failed, failedRecords))
+	later, laterRecords := newDedupBatch("foo", 0, 10, 11)
+	require.NoError(t, d.filter(ctx, later, laterRecords))
+	d.written(later)
+	require.NoError(t, d.flush(ctx))
+	assert.Equal(t, "7", cacheValue("foo_0"))
+
+	failed, failedRecords = newDedupBatch("foo", 0, 8, 9)
+	require.NoError(t, d.filter(ctx, failed, failedRecords))
+	assert.Equal(t, 2, writtenRecords(failedRecords))
+	d.written(failed)
+	require.NoError(t, d.flush(ctx))
+	assert.Equal(t, "11", cacheValue("foo_0"))
+
+	// Records which are delivered again after they were written are skipped.
+	later, laterRecords = newDedupBatch("foo", 0, 10, 11, 12)
+	require.NoError(t, d.filter(ctx, later, laterRecords))
+	assert.Equal(t, 1, writtenRecords(laterRecords))
+	assert.NotNil(t, laterRecords[2])
+
+	// Messages without source offsets are always written.
+	noOffset := service.MessageBatch{service.NewMessage([]byte("foo"))}
+	noOffsetRecords := []*kgo.Record{{Topic: "foo"}}
+	require.NoError(t, d.filter(ctx, noOffset, noOffsetRecords))
+	assert.NotNil(t, noOffsetRecords[0])
+}
+
+func TestDedupWatermarksErrors(t *testing.T) {
+	ctx := context.Background()
+	res := service.MockResources(service.MockResourcesOptAddCache("dedup"))
+	require.NoError(t, res.AccessCache(ctx, "dedup", func(c service.Cache) {
+		require.NoError(t, c.Set(ctx, "foo_0", []byte("nope"), nil))
+	}))
+
+	batch, records := newDedupBatch("foo", 0, 1)
+	err := newDedupWatermarks(res, "dedup").filter(ctx, batch, records)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid watermark for partition 0 of topic "foo"`)
+
+	err = newDedupWatermarks(res, "missing").filter(ctx, batch, records)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to access dedup cache")
+}
+
+func TestDedupOutput(t *testing.T) {
+	ctx := context.Background()
+	res := service.MockResources(service.MockResourcesOptAddCache("dedup"))
+	d := newDedupWatermarks(res, "dedup")
+
+	var writeErr error
+	output := newDedupOutput(&mockBatchOutput{writeFn: func(service.MessageBatch) error { return writeErr }}, d)
+
+	batch, records := newDedupBatch("foo", 0, 0, 1)
+	require.NoError(t, d.filter(ctx, batch, records))
+	writeErr = errors.New("nope")
+	require.Error(t, output.WriteBatch(ctx, batch))
+
+	second, secondRecords := newDedupBatch("foo", 0, 2)
+	require.NoError(t, d.filter(ctx, second, secondRecords))
+	writeErr = nil
+	require.NoError(t, output.WriteBatch(ctx, second))
+
+	// Closing the output stores the watermarks, which don't move past the batch which failed.
+	require.NoError(t, output.Close(ctx))
+	require.NoError(t, res.AccessCache(ctx, "dedup", func(c service.Cache) {
+		_, err := c.Get(ctx, "foo_0")
+		require.ErrorIs(t, err, service.ErrKeyNotFound)
+	}))
+}
+
+func TestRedpandaMigratorOutputDedupLinting(t *testing.T) {
+	configTests := []struct {
+		name        string
+		config      string
+		errContains string
+	}{
+		{
+			name: "dedup cache with manual partitioner",
+			config: `
+redpanda_migrator:
+  seed_brokers: [ localhost:9092 ]
+  topic: ${! @kafka_topic }
+  partitioner: manual
+  partition: ${! @kafka_partition }
+  dedup_cache: dedup
+`,
+		},
+		{
+			name: "dedup cache without manual partitioner",
+			config: `
+redpanda_migrator:
+  seed_brokers: [ localhost:9092 ]
+  topic: ${! @kafka_topic }
+  dedup_cache: dedup
+`,
+			errContains: "partitioner must be manual when dedup_cache is set",
+		},
+	}
+
+	env := service.NewEnvironment()
+	for _, test := range configTests {
+		t.Run(test.name, func(t *testing.T) {
+			strm := env.NewStreamBuilder()
+			err := strm.AddOutputYAML(test.config)
+			if test.errContains == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.errContains)
+			}
+		})
+	}
+}
@@ -0,0 +1,363 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const (
+	rmeiFieldBufferSize = "buffer_size"
+)
+
+const (
+	migrationEventTopicCreated     = "topic_created"
+	migrationEventACLCreated       = "acl_created"
+	migrationEventSchemaRegistered = "schema_registered"
+	migrationEventOffsetsCommitted = "offsets_committed"
+)
+
+func redpandaMigratorEventsInputConfig() *service.ConfigSpec {
+	return service.NewConfigSpec().
+		Beta().
+		Categories("Services").
+		Version("4.50.0").
+		Summary(`Emits an event for every change which the migrator components of the stream make to the destination cluster.`).
+		Description(`
+This input provides an audit trail of the migration without having to parse logs. The ` + "`redpanda_migrator`" + `,
+` + "`redpanda_migrator_offsets`" + ` and ` + "`schema_registry`" + ` outputs of the same stream publish an event whenever they
+create a topic or an ACL, register a schema or commit a consumer group offset in the destination cluster, and this input
+emits each event as a JSON message:
+
+` + "```json" + `
+{"type":"topic_created","timestamp":"2025-03-01T12:00:00Z","label":"redpanda_migrator_output","topic":"foo","partitions":3,"replication_factor":3}
+{"type":"acl_created","timestamp":"2025-03-01T12:00:00Z","label":"redpanda_migrator_output","topic":"foo","principal":"User:bar","host":"*","operation":"READ","permission":"ALLOW"}
+{"type":"schema_registered","timestamp":"2025-03-01T12:00:01Z","label":"schema_registry_output","subject":"foo-value","version":2,"source_id":7,"destination_id":1}
+{"type":"offsets_committed","timestamp":"2025-03-01T12:00:02Z","label":"redpanda_migrator_offsets_output","group":"baz","topic":"foo","partition":0,"offset":42}
+` + "```" + `
+
+The ` + "`label`" + ` is the label of the component which published the event. Events are only emitted for the components of
+the same stream. The input subscribes to the events when it's created, so that the events which are published while
+the stream starts are emitted as well, whereas the events which are published after the input is closed are not.
+
+Publishing an event never blocks the migration. When more than ` + "`buffer_size`" + ` events are waiting to be emitted, the
+oldest event is dropped and the ` + "`redpanda_migrator_events_dropped`" + ` metric is incremented.
+`).
+		Fields(
+			service.NewIntField(rmeiFieldBufferSize).
+				Description("The maximum number of events which are buffered until they are emitted, after which the oldest events are dropped.").
+				Default(1000).
+				LintRule(`root = if this < 1 { ["buffer_size must be at least 1"] }`).
+				Advanced(),
+		)
+}
+
+func init() {
+	err := service.RegisterBatchInput("redpanda_migrator_events", redpandaMigratorEventsInputConfig(),
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.BatchInput, error) {
+			return newRedpandaMigratorEventsInputFromConfig(conf, mgr)
+		})
+	if err != nil {
+		panic(err)
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// migrationEventHeader holds the fields which are common to all migration events.
+type migrationEventHeader struct {
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Label     string    `json:"label"`
+}
+
+type topicCreatedEvent struct {
+	migrationEventHeader
+	Topic             string `json:"topic"`
+	Partitions        int32  `json:"partitions"`
+	ReplicationFactor int16  `json:"replication_factor"`
+}
+
+type aclCreatedEvent struct {
+	migrationEventHeader
+	Topic      string `json:"topic"`
+	Principal  string `json:"principal"`
+	Host       string `json:"host"`
+	Operation  string `json:"operation"`
+	Permission string `json:"permission"`
+}
+
+type schemaRegisteredEvent struct {
+	migrationEventHeader
+	Subject       string `json:"subject"`
+	Version       int    `json:"version"`
+	SourceID      int    `json:"source_id"`
+	DestinationID int    `json:"destination_id"`
+}
+
+type offsetsCommittedEvent struct {
+	migrationEventHeader
+	Group     string `json:"group"`
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+type migrationEventBusKey struct{}
+
+// migrationEventBus delivers the events published by the migrator components of a stream to the subscribed
+// redpanda_migrator_events inputs. A single instance is shared by all the components of a stream.
+type migrationEventBus struct {
+	mu          sync.Mutex
+	subscribers map[*migrationEventSubscription]struct{}
+	now         func() time.Time
+}
+
+func newMigrationEventBus() *migrationEventBus {
+	return &migrationEventBus{
+		subscribers: map[*migrationEventSubscription]struct{}{},
+		now:         time.Now,
+	}
+}
+
+func migrationEventBusFor(mgr *service.Resources) *migrationEventBus {
+	actual, _ := mgr.GetOrSetGeneric(migrationEventBusKey{}, newMigrationEventBus())
+	return actual.(*migrationEventBus)
+}
+
+// subscribe returns a subscription which buffers up to size events, the oldest events are dropped when it's full.
+func (b *migrationEventBus) subscribe(size int, dropped *service.MetricCounter) *migrationEventSubscription {
+	s := &migrationEventSubscription{
+		size:    size,
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		dropped: dropped,
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[s] = struct{}{}
+	return s
+}
+
+func (b *migrationEventBus) unsubscribe(s *migrationEventSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, exists := b.subscribers[s]; exists {
+		delete(b.subscribers, s)
+		close(s.done)
+	}
+}
+
+// publish delivers an event to all the subscribers. The event is only serialised when there is at least one.
+func (b *migrationEventBus) publish(event any) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.subscribers) == 0 {
+		return
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	for s := range b.subscribers {
+		s.push(data)
+	}
+}
+
+// migrationEventSubscription buffers the events of a subscriber until they are taken.
+type migrationEventSubscription struct {
+	mu     sync.Mutex
+	events [][]byte
+	size   int
+
+	notify  chan struct{}
+	done    chan struct{}
+	dropped *service.MetricCounter
+}
+
+func (s *migrationEventSubscription) push(event []byte) {
+	s.mu.Lock()
+	if len(s.events) >= s.size {
+		s.events = s.events[1:]
+		s.dropped.Incr(1)
+	}
+	s.events = append(s.events, event)
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// take waits for events and returns all the buffered ones. It returns service.ErrNotConnected once the subscription
+// was cancelled.
+func (s *migrationEventSubscription) take(ctx context.Context) ([][]byte, error) {
+	for {
+		s.mu.Lock()
+		events := s.events
+		s.events = nil
+		s.mu.Unlock()
+		if len(events) > 0 {
+			return events, nil
+		}
+
+		select {
+		case <-s.notify:
+		case <-s.done:
+			return nil, service.ErrNotConnected
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// migrationEventPublisher publishes the events of a migrator component.
+type migrationEventPublisher struct {
+	bus   *migrationEventBus
+	label string
+}
+
+// migrationEventsFor returns the publisher of a migrator component, which publishes its events to the bus of the
+// stream.
+func migrationEventsFor(mgr *service.Resources) *migrationEventPublisher {
+	return &migrationEventPublisher{bus: migrationEventBusFor(mgr), label: mgr.Label()}
+}
+
+func (p *migrationEventPublisher) header(eventType string) migrationEventHeader {
+	return migrationEventHeader{Type: eventType, Timestamp: p.bus.now(), Label: p.label}
+}
+
+func (p *migrationEventPublisher) topicCreated(topic string, partitions int32, replicationFactor int16) {
+	if p == nil {
+		return
+	}
+	p.bus.publish(topicCreatedEvent{
+		migrationEventHeader: p.header(migrationEventTopicCreated),
+		Topic:                topic,
+		Partitions:           partitions,
+		ReplicationFactor:    replicationFactor,
+	})
+}
+
+func (p *migrationEventPublisher) aclCreated(topic string, acl topicACL) {
+	if p == nil {
+		return
+	}
+	p.bus.publish(aclCreatedEvent{
+		migrationEventHeader: p.header(migrationEventACLCreated),
+		Topic:                topic,
+		Principal:            acl.principal,
+		Host:                 acl.host,
+		Operation:            acl.operation.String(),
+		Permission:           acl.permission.String(),
+	})
+}
+
+func (p *migrationEventPublisher) schemaRegistered(subject string, version, sourceID, destinationID int) {
+	if p == nil {
+		return
+	}
+	p.bus.publish(schemaRegisteredEvent{
+		migrationEventHeader: p.header(migrationEventSchemaRegistered),
+		Subject:              subject,
+		Version:              version,
+		SourceID:             sourceID,
+		DestinationID:        destinationID,
+	})
+}
+
+func (p *migrationEventPublisher) offsetsCommitted(group, topic string, partition int32, offset int64) {
+	if p == nil {
+		return
+	}
+	p.bus.publish(offsetsCommittedEvent{
+		migrationEventHeader: p.header(migrationEventOffsetsCommitted),
+		Group:                group,
+		Topic:                topic,
+		Partition:            partition,
+		Offset:               offset,
+	})
+}
+
+//------------------------------------------------------------------------------
+
+type redpandaMigratorEventsInput struct {
+	bus        *migrationEventBus
+	bufferSize int
+	dropped    *service.MetricCounter
+
+	mut sync.Mutex
+	sub *migrationEventSubscription
+}
+
+func newRedpandaMigratorEventsInputFromConfig(conf *service.ParsedConfig, mgr *service.Resources) (*redpandaMigratorEventsInput, error) {
+	i := redpandaMigratorEventsInput{
+		bus:     migrationEventBusFor(mgr),
+		dropped: mgr.Metrics().NewCounter("redpanda_migrator_events_dropped"),
+	}
+
+	var err error
+	if i.bufferSize, err = conf.FieldInt(rmeiFieldBufferSize); err != nil {
+		return nil, err
+	}
+	if i.bufferSize < 1 {
+		return nil, fmt.Errorf("%s must be at least 1, got %d", rmeiFieldBufferSize, i.bufferSize)
+	}
+
+	// The outputs of the stream may publish events before the input connects, for example when they connect first.
+	i.sub = i.bus.subscribe(i.bufferSize, i.dropped)
+	return &i, nil
+}
+
+func (i *redpandaMigratorEventsInput) Connect(context.Context) error {
+	i.mut.Lock()
+	defer i.mut.Unlock()
+
+	if i.sub == nil {
+		return service.ErrEndOfInput
+	}
+	return nil
+}
+
+func (i *redpandaMigratorEventsInput) ReadBatch(ctx context.Context) (service.MessageBatch, service.AckFunc, error) {
+	i.mut.Lock()
+	sub := i.sub
+	i.mut.Unlock()
+	if sub == nil {
+		return nil, nil, service.ErrNotConnected
+	}
+
+	events, err := sub.take(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	batch := make(service.MessageBatch, 0, len(events))
+	for _, event := range events {
+		batch = append(batch, service.NewMessage(event))
+	}
+	return batch, func(context.Context, error) error { return nil }, nil
+}
+
+func (i *redpandaMigratorEventsInput) Close(context.Context) error {
+	i.mut.Lock()
+	defer i.mut.Unlock()
+
+	if i.sub != nil {
+		i.bus.unsubscribe(i.sub)
+		i.sub = nil
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+func newTestEventsInput(t *testing.T, mgr *service.Resources, yaml string) *redpandaMigratorEventsInput {
+	t.Helper()
+	conf, err := redpandaMigratorEventsInputConfig().ParseYAML(yaml, nil)
+	require.NoError(t, err)
+	i, err := newRedpandaMigratorEventsInputFromConfig(conf, mgr)
+	require.NoError(t, err)
+	return i
+}
+
+func readEvents(t *testing.T, i *redpandaMigratorEventsInput) []string {
+	t.Helper()
+	ctx, done := context.WithTimeout(context.Background(), time.Second)
+	defer done()
+	batch, ack, err := i.ReadBatch(ctx)
+	require.NoError(t, err)
+	require.NoError(t, ack(ctx, nil))
+	var events []string
+	for _, msg := range batch {
+		b, err := msg.AsBytes()
+		require.NoError(t, err)
+		events = append(events, string(b))
+	}
+	return events
+}
+
+func TestRedpandaMigratorEventsInput(t *testing.T) {
+	ctx := context.Background()
+	mgr := service.MockResources()
+	bus := migrationEventBusFor(mgr)
+	bus.now = func() time.Time { return time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC) }
+	events := &migrationEventPublisher{bus: bus, label: "foo"}
+
+	// Events published before the input was created are not emitted, but the ones published before it connected are.
+	events.topicCreated("dropped", 1, 1)
+	i := newTestEventsInput(t, mgr, ``)
+	events.topicCreated("foo", 3, 2)
+	require.NoError(t, i.Connect(ctx))
+
+	events.aclCreated("foo", topicACL{principal: "User:bar", host: "*", operation: kmsg.ACLOperationRead, permission: kmsg.ACLPermissionTypeAllow})
+	events.schemaRegistered("foo-value", 2, 7, 1)
+	events.offsetsCommitted("baz", "foo", 0, 42)
+	assert.Equal(t, []string{
+		`{"type":"topic_created","timestamp":"2025-03-01T12:00:00Z","label":"foo","topic":"foo","partitions":3,"replication_factor":2}`,
+		`{"type":"acl_created","timestamp":"2025-03-01T12:00:00Z","label":"foo","topic":"foo","principal":"User:bar","host":"*","operation":"READ","permission":"ALLOW"}`,
+		`{"type":"schema_registered","timestamp":"2025-03-01T12:00:00Z","label":"foo","subject":"foo-value","version":2,"source_id":7,"destination_id":1}`,
+		`{"type":"offsets_committed","timestamp":"2025-03-01T12:00:00Z","label":"foo","group":"baz","topic":"foo","partition":0,"offset":42}`,
+	}, readEvents(t, i))
+
+	// Reading waits for the next event.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		events.offsetsCommitted("baz", "foo", 0, 43)
+	}()
+	assert.Len(t, readEvents(t, i), 1)
+
+	// Closing the input unblocks reads and unsubscribes it.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		assert.NoError(t, i.Close(ctx))
+	}()
+	_, _, err := i.ReadBatch(ctx)
+	require.ErrorIs(t, err, service.ErrNotConnected)
+	bus.mu.Lock()
+	assert.Empty(t, bus.subscribers)
+	bus.mu.Unlock()
+	require.ErrorIs(t, i.Connect(ctx), service.ErrEndOfInput)
+
+	// A nil publisher does nothing.
+	var nilEvents *migrationEventPublisher
+	nilEvents.topicCreated("foo", 1, 1)
+}
+
+func TestRedpandaMigratorEventsDropOldest(t *testing.T) {
+	ctx := context.Background()
+	mgr := service.MockResources()
+	events := migrationEventsFor(mgr)
+
+	i := newTestEventsInput(t, mgr, `buffer_size: 2`)
+	require.NoError(t, i.Connect(ctx))
+	defer i.Close(ctx)
+
+	// Publishing never blocks when the subscriber is slow.
+	for offset := range int64(5) {
+		events.offsetsCommitted("baz", "foo", 0, offset)
+	}
+	read := readEvents(t, i)
+	require.Len(t, read, 2)
+	assert.Contains(t, read[0], `"offset":3`)
+	assert.Contains(t, read[1], `"offset":4`)
+}
+
+func TestRedpandaMigratorEventsPerStream(t *testing.T) {
+	ctx := context.Background()
+	mgrA, mgrB := service.MockResources(), service.MockResources()
+
+	a := newTestEventsInput(t, mgrA, ``)
+	require.NoError(t, a.Connect(ctx))
+	defer a.Close(ctx)
+	b := newTestEventsInput(t, mgrB, ``)
+	require.NoError(t, b.Connect(ctx))
+	defer b.Close(ctx)
+
+	migrationEventsFor(mgrA).topicCreated("foo", 1, 1)
+	migrationEventsFor(mgrB).topicCreated("bar", 1, 1)
+
+	read := readEvents(t, a)
+	require.Len(t, read, 1)
+	assert.Contains(t, read[0], `"topic":"foo"`)
+	read = readEvents(t, b)
+	require.Len(t, read, 1)
+	assert.Contains(t, read[0], `"topic":"bar"`)
+}
@@ -10,7 +10,9 @@ package enterprise
 
 import (
 	"context"
+	"fmt"
 	"slices"
+	"sync"
 
 	"github.com/twmb/franz-go/pkg/kgo"
 
@@ -21,6 +23,16 @@ import (
 )
 
 const (
+	rmiFieldExcludeTopics      = "exclude_topics"
+	rmiFieldMarkMigrationPhase = "mark_migration_phase"
+	rmiFieldConsumerGroup      = "consumer_group"
+	rmiFieldETASmoothingWindow = "eta_smoothing_window"
+	rmiFieldIsolationLevel     = "isolation_level"
+	rmiFieldMaxTransactionWait = "max_transaction_wait"
+
+	// Defined in kafka.FranzConnectionFields
+	rmiFieldMetadataMaxAge = "metadata_max_age"
+
 	// Deprecated fields
 	rmiFieldMultiHeader               = "multi_header"
 	rmiFieldBatchSize                 = "batch_size"
@@ -29,6 +41,9 @@ const (
 	rmiFieldReplicationFactor         = "replication_factor"
 
 	rmiResourceDefaultLabel = "redpanda_migrator_input"
+
+	rmiIsolationLevelReadCommitted   = "read_committed"
+	rmiIsolationLevelReadUncommitted = "read_uncommitted"
 )
 
 func redpandaMigratorInputConfig() *service.ConfigSpec {
@@ -46,10 +61,116 @@ When a consumer group is specified this input consumes one or more topics where
 
 It provides the same delivery guarantees and ordering semantics as the ` + "`redpanda`" + ` input.
 
+Topics listed in ` + "`exclude_topics`" + ` are never migrated, even when they match the ` + "`topics`" + ` field. Records
+consumed from excluded topics are dropped and the ` + "`redpanda_migrator`" + ` output never creates excluded topics or
+their ACLs.
+
+== Pausing topics
+
+Fetching of individual topics or partitions can be paused at runtime, for example while the destination cluster is
+falling behind, without stopping the pipeline. The ` + "`/redpanda_migrator/fetch/<label>`" + ` endpoint of the HTTP
+server, where ` + "`<label>`" + ` is the label of the input or ` + "`" + rmiResourceDefaultLabel + "`" + ` when it has none, lists
+the paused topics and partitions on ` + "`GET`" + ` requests. ` + "`POST`" + ` requests pause or resume the topics listed in
+the ` + "`topic`" + ` query parameters, depending on whether the ` + "`action`" + ` query parameter is ` + "`pause`" + ` or
+` + "`resume`" + `. When ` + "`partition`" + ` query parameters are also specified then only those partitions of a single topic are
+paused or resumed, for example ` + "`POST /redpanda_migrator/fetch/redpanda_migrator_input?action=pause&topic=foo&partition=0`" + `.
+Records fetched before a topic is paused are still delivered, and fetching continues from the next record once it's
+resumed. Pauses are kept across reconnects but not across restarts.
+
+== Transactions
+
+Records of transactional producers are consumed with the ` + "`" + rmiIsolationLevelReadCommitted + "`" + ` isolation level by default,
+so that the records of aborted transactions aren't migrated, where consumers of the destination topics would observe
+them as regular records. The control records which mark the end of transactions are never migrated either. Set
+` + "`" + rmiFieldIsolationLevel + "`" + ` to ` + "`" + rmiIsolationLevelReadUncommitted + "`" + ` to migrate all records, including the
+records of open and aborted transactions.
+
+With the ` + "`" + rmiIsolationLevelReadCommitted + "`" + ` isolation level, the records of a partition are only consumed up to its last
+stable offset, which is the offset of the first record of the oldest open transaction. A hanging transaction in the
+source cluster therefore stalls the migration of the partition until it's committed, aborted or timed out by the
+broker. The ` + "`redpanda_migrator_last_stable_offset_lag`" + ` metric reports how far the last stable offset of each
+partition is behind its high watermark and a warning is logged when the last stable offset of a partition doesn't
+advance for longer than ` + "`" + rmiFieldMaxTransactionWait + "`" + `. Since fetches leave out the partitions without new
+records, the offsets of the consumed partitions are also listed at least every 10 seconds.
+
+== Migration phases
+
+When ` + "`" + rmiFieldMarkMigrationPhase + "`" + ` is ` + "`true`" + `, the high watermarks of the consumed partitions are captured when the
+input starts, before it consumes any records. The records below them are the snapshot of the topics and have the
+` + "`" + migrationPhaseMetaKey + "`" + ` metadata field set to ` + "`" + migrationPhaseSnapshot + "`" + `, while the records produced
+afterwards have it set to ` + "`" + migrationPhaseLive + "`" + `. The watermarks are not refreshed when the input reconnects, and
+partitions which are created later, partitions which are consumed from their end and partitions whose consumer group
+offset already reached the watermark start in the live phase. Once the last snapshot record of a partition is consumed
+a log message is emitted, or once the first live record is consumed when the last snapshot records are transaction
+markers or were compacted away, and the ` + "`redpanda_migrator_snapshot_partitions_remaining`" + ` metric is decreased. A
+restart captures new watermarks, which begins a new snapshot from the committed offsets.
+
+When the partitions are balanced across multiple inputs with the same consumer group, each input tracks the snapshot of
+all partitions, so the ` + "`" + migrationPhaseMetaKey + "`" + ` metadata field should be used instead of the metric to
+determine when the snapshot is complete.
+
+== Topic priorities
+
+Topics can be migrated in priority order by listing tiers of topics in ` + "`" + rmiFieldTopicPriorities + "`" + `, from the highest
+priority to the lowest, so that the topics of a tier are migrated before the topics of the following tiers start. At
+first only the topics of the first tier are fetched. The high watermarks of the consumed partitions, or their last
+stable offsets with the ` + "`" + rmiIsolationLevelReadCommitted + "`" + ` isolation level, are captured once the input connects, and once the fetch
+positions of all partitions of a tier which are consumed by the input reached them, the topics of the following tier are
+fetched as well. The fetch positions include transaction markers and aborted records, which aren't consumed. Tiers
+without records below their watermarks are skipped and topics which don't match any tier are fetched once all tiers
+completed. Topics which are created after the input started are placed in the tier they match,
+so they're only fetched once it's reached, and their records don't hold back the following tiers.
+
+When the partitions are balanced across multiple inputs with the same consumer group, each input advances through the
+tiers once the partitions which are assigned to it completed them. The tiers are tracked from the start when the input
+restarts. Topics which are held back by their tier aren't listed as paused by the ` + "`" + fetchControlPathPrefix + "<label>`" + `
+endpoint and stay held when they're resumed through it.
+
+== Start offsets
+
+Source topics whose older segments were offloaded to tiered storage are slow and expensive to read from their start,
+since the records have to be fetched from object storage. The ` + "`" + rmiFieldStartOffsets + "`" + ` field lists policies for
+the offsets from which the partitions of matching topics are consumed, so that only the tail of the topics is migrated
+while their history is backfilled separately. The first policy which matches a topic wins and topics which don't match
+any policy are consumed according to ` + "`start_from_oldest`" + `. With ` + "`" + startOffsetPolicyLocalEarliest + "`" + ` the
+partitions are consumed from the earliest offset which is still stored on the local disks of the brokers. Policies
+only apply to partitions without a committed consumer group offset or an explicit offset, and the chosen start offset
+of each partition is logged. Records of topics whose policy isn't ` + "`" + startOffsetPolicyEarliest + "`" + ` have the
+` + "`" + startOffsetPolicyMetaKey + "`" + ` metadata field set to the policy, so that downstream reconciliation knows that their
+history was skipped intentionally.
+
 == Metrics
 
 Emits a ` + "`input_redpanda_migrator_lag`" + ` metric with ` + "`topic`" + ` and ` + "`partition`" + ` labels for each consumed topic.
 
+Emits a ` + "`redpanda_migrator_snapshot_partitions_remaining`" + ` metric with the number of partitions which are still in
+the snapshot phase when ` + "`" + rmiFieldMarkMigrationPhase + "`" + ` is ` + "`true`" + `.
+
+Emits the following metrics with ` + "`topic`" + ` and ` + "`partition`" + ` labels to track the progress of each consumed partition
+towards the high watermark which is captured when its first record is consumed, so that they report how far a backfill
+is from completion:
+
+- ` + "`migrator_partition_progress_ratio`" + `: The share of the records between the first consumed offset and the captured high watermark which were consumed, from 0 to 1.
+- ` + "`migrator_partition_records_remaining`" + `: The number of records below the captured high watermark which remain to be consumed.
+- ` + "`migrator_partition_eta_seconds`" + `: The estimated number of seconds until the captured high watermark is reached, based on a consume rate which is exponentially weighted over the ` + "`" + rmiFieldETASmoothingWindow + "`" + `. It's ` + "`-1`" + ` until the rate is known.
+
+Partitions which reached their captured high watermark report a ratio of ` + "`1`" + ` and an ETA of ` + "`0`" + ` while they continue
+to be consumed. The metrics of partitions which are revoked by a rebalance are reset to ` + "`0`" + ` and the high watermark is
+captured again when they are assigned back.
+
+Emits a ` + "`redpanda_migrator_last_stable_offset_lag`" + ` metric with ` + "`topic`" + ` and ` + "`partition`" + ` labels with the
+number of records between the last stable offset and the high watermark of each consumed partition when the
+` + "`" + rmiIsolationLevelReadCommitted + "`" + ` isolation level is used.
+
+Emits a ` + "`redpanda_migrator_active_topic_tier`" + ` metric with the index of the tier of ` + "`" + rmiFieldTopicPriorities + "`" + `
+whose topics are fetched along with the topics of the tiers before it, starting from ` + "`0`" + `, when tiers are configured.
+It's equal to the number of tiers once all of them completed.
+
+Emits a ` + "`redpanda_fetch_paused`" + ` metric with a ` + "`topic`" + ` label, which is ` + "`1`" + ` while the topic or any of its partitions are paused and ` + "`0`" + ` otherwise.
+
+When a ` + "`redpanda_migrator`" + ` output mirrors topic deletions, the topics of the source cluster are listed every
+` + "`" + rmiFieldMetadataMaxAge + "`" + ` and the consumed topics which are missing from two consecutive listings are deleted by the output.
+
 == Metadata
 
 This input adds the following metadata fields to each message:
@@ -63,8 +184,13 @@ This input adds the following metadata fields to each message:
 - kafka_timestamp_ms
 - kafka_timestamp_unix
 - kafka_tombstone_message
+- migration_phase (only when ` + "`" + rmiFieldMarkMigrationPhase + "`" + ` is ` + "`true`" + `)
+- ` + startOffsetPolicyMetaKey + ` (only for topics whose ` + "`" + rmiFieldStartOffsets + "`" + ` policy isn't ` + "`" + startOffsetPolicyEarliest + "`" + `)
 - All record headers
 ` + "```" + `
+
+Tombstones, which are records without a value, are emitted as messages with an empty body and the
+` + "`kafka_tombstone_message`" + ` metadata field set to ` + "`true`" + `, so that deletes are migrated to compacted topics.
 `).
 		Fields(redpandaMigratorInputConfigFields()...).
 		LintRule(`
@@ -80,7 +206,8 @@ root = if $has_topic_partitions {
     "a consumer group is mandatory when not using explicit topic partitions"
   }
 }
-`)
+`).
+		LintRule(excludeTopicsLintRule)
 }
 
 func redpandaMigratorInputConfigFields() []*service.ConfigField {
@@ -89,6 +216,25 @@ func redpandaMigratorInputConfigFields() []*service.ConfigField {
 		kafka.FranzConsumerFields(),
 		kafka.FranzReaderOrderedConfigFields(),
 		[]*service.ConfigField{
+			excludeTopicsField(),
+			topicPrioritiesField(),
+			startOffsetsField(),
+			service.NewBoolField(rmiFieldMarkMigrationPhase).
+				Description("Capture the high watermarks of the consumed partitions when the input starts and set the `" + migrationPhaseMetaKey + "` metadata field of each record to `" + migrationPhaseSnapshot + "` when it's below them or `" + migrationPhaseLive + "` otherwise.").
+				Default(false).
+				Advanced(),
+			service.NewDurationField(rmiFieldETASmoothingWindow).
+				Description("The window over which the consume rate of each partition is exponentially weighted to estimate the time remaining until it reaches its captured high watermark, which is reported by the `migrator_partition_eta_seconds` metric. Longer windows make the estimate steadier but slower to reflect changes of the consume rate.").
+				Default("1m").
+				Advanced(),
+			service.NewStringEnumField(rmiFieldIsolationLevel, rmiIsolationLevelReadCommitted, rmiIsolationLevelReadUncommitted).
+				Description("The isolation level with which records are consumed. With `" + rmiIsolationLevelReadCommitted + "` the records of aborted transactions are skipped and records are only consumed once their transaction is committed, while `" + rmiIsolationLevelReadUncommitted + "` consumes all records.").
+				Default(rmiIsolationLevelReadCommitted).
+				Advanced(),
+			service.NewDurationField(rmiFieldMaxTransactionWait).
+				Description("The duration after which a warning is logged when the last stable offset of a partition doesn't advance, which means that an open transaction in the source cluster blocks the migration of the partition. Only used with the `" + rmiIsolationLevelReadCommitted + "` isolation level. Set to `0s` to disable the warning.").
+				Default("5m").
+				Advanced(),
 			service.NewAutoRetryNacksToggleField(),
 
 			// Deprecated fields
@@ -128,35 +274,155 @@ func init() {
 				return nil, err
 			}
 
-			tmpOpts, err := kafka.FranzConnectionOptsFromConfig(conf, mgr.Logger())
+			connOpts, err := kafka.FranzConnectionOptsFromConfig(conf, mgr.Logger())
 			if err != nil {
 				return nil, err
 			}
-			clientOpts := append([]kgo.Opt{}, tmpOpts...)
+			clientOpts := append([]kgo.Opt{}, connOpts...)
+
+			tmpOpts := connOpts
 
 			if tmpOpts, err = kafka.FranzConsumerOptsFromConfig(conf); err != nil {
 				return nil, err
 			}
 			clientOpts = append(clientOpts, tmpOpts...)
 
+			isolationLevel, err := conf.FieldString(rmiFieldIsolationLevel)
+			if err != nil {
+				return nil, err
+			}
+			if isolationLevel == rmiIsolationLevelReadCommitted {
+				clientOpts = append(clientOpts, kgo.FetchIsolationLevel(kgo.ReadCommitted()))
+			}
+
+			tiers, err := topicTiersFromParsed(conf)
+			if err != nil {
+				return nil, err
+			}
+			if tiers != nil {
+				// The transaction markers are fetched so that the fetch position of a partition reaches its snapshot
+				// watermark even when the last records of the snapshot are transaction markers or were aborted.
+				clientOpts = append(clientOpts, kgo.KeepControlRecords())
+			}
+
 			clientLabel := mgr.Label()
 			if clientLabel == "" {
 				clientLabel = rmiResourceDefaultLabel
 			}
+			registerResourceLabel(resourceLabelKindMigratorInput, clientLabel, mgr)
+
+			excludedTopics, err := excludedTopicsFromParsed(conf)
+			if err != nil {
+				return nil, err
+			}
+			// The output uses the excluded topics of the input it references to avoid creating them.
+			mgr.SetGeneric(excludedTopicsKey(clientLabel), excludedTopics)
+
+			startOffsetRules, err := startOffsetRulesFromParsed(conf)
+			if err != nil {
+				return nil, err
+			}
+			var starts *startOffsets
+			if startOffsetRules != nil {
+				details, err := kafka.FranzConsumerDetailsFromConfig(conf)
+				if err != nil {
+					return nil, err
+				}
+				starts = newStartOffsets(startOffsetRules, details.TopicPartitions, connOpts, isolationLevel == rmiIsolationLevelReadCommitted, mgr)
+				if conf.Contains(rmiFieldConsumerGroup) {
+					// Partitions assigned to the consumer group member start from the offsets of their policies when the
+					// group didn't commit an offset for them.
+					clientOpts = append(clientOpts, kgo.WithHooks(starts), kgo.AdjustFetchOffsetsFn(starts.adjustAssigned))
+				}
+			}
 
 			rdr, err := kafka.NewFranzReaderOrderedFromConfig(conf, mgr,
 				func() ([]kgo.Opt, error) {
+					if starts != nil {
+						return append(slices.Clone(clientOpts), starts.consumeOpts()...), nil
+					}
 					return clientOpts, nil
 				})
 			if err != nil {
 				return nil, err
 			}
 
-			return service.AutoRetryNacksBatchedToggled(conf, &redpandaMigratorInput{
+			rdr.FetchControl = kafka.NewFranzFetchControl(mgr.Metrics())
+			if path := fetchControlPathPrefix + clientLabel; !registerEndpoint(mgr, path, "Lists, pauses and resumes the topics and partitions fetched by a redpanda_migrator input.", fetchControlHandler(rdr.FetchControl)) {
+				mgr.Logger().Warnf("Unable to register the %s endpoint, the HTTP server of the stream isn't accessible", path)
+			}
+
+			input := &redpandaMigratorInput{
 				FranzReaderOrdered: rdr,
 				clientLabel:        clientLabel,
+				excludedTopics:     excludedTopics,
+				startOffsets:       starts,
+				connOpts:           connOpts,
 				mgr:                mgr,
-			})
+			}
+
+			etaWindow, err := conf.FieldDuration(rmiFieldETASmoothingWindow)
+			if err != nil {
+				return nil, err
+			}
+			if etaWindow <= 0 {
+				return nil, fmt.Errorf("%s must be greater than zero", rmiFieldETASmoothingWindow)
+			}
+			input.progress = newMigrationProgress(etaWindow, excludedTopics, mgr)
+			rdr.OnPartitionsRemoved = input.onPartitionsRemoved
+
+			if isolationLevel == rmiIsolationLevelReadCommitted {
+				maxTransactionWait, err := conf.FieldDuration(rmiFieldMaxTransactionWait)
+				if err != nil {
+					return nil, err
+				}
+				input.transactions = newTransactionWaits(maxTransactionWait, conf.Contains(rmiFieldConsumerGroup), mgr)
+			}
+
+			markPhase, err := conf.FieldBool(rmiFieldMarkMigrationPhase)
+			if err != nil {
+				return nil, err
+			}
+			if markPhase || tiers != nil {
+				details, err := kafka.FranzConsumerDetailsFromConfig(conf)
+				if err != nil {
+					return nil, err
+				}
+				if input.consumed, err = newConsumedPartitions(details, excludedTopics); err != nil {
+					return nil, err
+				}
+				if conf.Contains(rmiFieldConsumerGroup) {
+					if input.consumerGroup, err = conf.FieldString(rmiFieldConsumerGroup); err != nil {
+						return nil, err
+					}
+				}
+			}
+			if markPhase {
+				input.phases = newMigrationPhases(mgr)
+			}
+			if tiers != nil {
+				input.priorities = newTopicPriorities(tiers, excludedTopics, input.consumed, input.consumerGroup, isolationLevel == rmiIsolationLevelReadCommitted, rdr.FetchControl, mgr)
+			}
+			rdr.OnPartitionsAssigned = input.onPartitionsAssigned
+			rdr.OnPartitionFetched = input.onPartitionFetched
+
+			metadataMaxAge, err := conf.FieldDuration(rmiFieldMetadataMaxAge)
+			if err != nil {
+				return nil, err
+			}
+			consumed := input.consumed
+			if consumed == nil {
+				details, err := kafka.FranzConsumerDetailsFromConfig(conf)
+				if err != nil {
+					return nil, err
+				}
+				if consumed, err = newConsumedPartitions(details, excludedTopics); err != nil {
+					return nil, err
+				}
+			}
+			input.deletedTopics = newDeletedTopicDetector(metadataMaxAge, clientLabel, consumed, mgr)
+
+			return service.AutoRetryNacksBatchedToggled(conf, input)
 		})
 	if err != nil {
 		panic(err)
@@ -168,25 +434,132 @@ func init() {
 type redpandaMigratorInput struct {
 	*kafka.FranzReaderOrdered
 
-	clientLabel string
+	clientLabel    string
+	excludedTopics *topicMatcher
+	connOpts       []kgo.Opt
+
+	// The start offsets are only chosen when start_offsets is set.
+	startOffsets *startOffsets
+
+	// The migration phases are only tracked when mark_migration_phase is set.
+	phases        *migrationPhases
+	consumed      *consumedPartitions
+	consumerGroup string
+
+	// The topic tiers are only scheduled when topic_priorities is set.
+	priorities *topicPriorities
+
+	progress *migrationProgress
+
+	// The open transactions are only tracked with the read_committed isolation level.
+	transactions *transactionWaits
+
+	// The deleted topics are only detected when a redpanda_migrator output mirrors them.
+	deletedTopics *deletedTopicDetector
+
+	// The client which is stored for sharing, so that it's only released once.
+	sharedMut    sync.Mutex
+	sharedClient *kgo.Client
 
 	mgr *service.Resources
 }
 
 func (rmi *redpandaMigratorInput) Connect(ctx context.Context) error {
+	// The watermarks are captured before the reader connects, so that they don't include records produced after
+	// consuming started.
+	if rmi.phases != nil {
+		if err := rmi.phases.capture(ctx, rmi.connOpts, rmi.consumed, rmi.consumerGroup); err != nil {
+			return err
+		}
+	}
+	// The topics of the tiers which aren't active are held before they can be fetched.
+	if rmi.priorities != nil {
+		rmi.priorities.hold()
+	}
+
+	// The start offsets of the explicitly listed partitions are chosen before the client which consumes them is created.
+	if rmi.startOffsets != nil {
+		if err := rmi.startOffsets.capture(ctx); err != nil {
+			return err
+		}
+	}
+
 	if err := rmi.FranzReaderOrdered.Connect(ctx); err != nil {
 		return err
 	}
+	// The snapshot watermarks of the tiers are captured with the client of the reader, which connects again without
+	// replacing it when capturing them fails.
+	if rmi.priorities != nil {
+		if err := rmi.priorities.capture(ctx, rmi.FranzReaderOrdered.Client); err != nil {
+			return err
+		}
+	}
+	if rmi.transactions != nil {
+		rmi.transactions.start(rmi.FranzReaderOrdered.Client)
+	}
+	rmi.progress.useClient(&kafka.FranzSharedClientInfo{Client: rmi.FranzReaderOrdered.Client})
+
+	rmi.sharedMut.Lock()
+	defer rmi.sharedMut.Unlock()
 
-	if err := kafka.FranzSharedClientSet(rmi.clientLabel, &kafka.FranzSharedClientInfo{
-		Client: rmi.FranzReaderOrdered.Client,
+	// The client of a previous connection must not be shared after it's replaced.
+	rmi.releaseSharedClient()
+	if err := kafka.FranzSharedClientSet(rmi.clientLabel, rmi, &kafka.FranzSharedClientInfo{
+		Client:       rmi.FranzReaderOrdered.Client,
+		FetchControl: rmi.FranzReaderOrdered.FetchControl,
 	}, rmi.mgr); err != nil {
 		rmi.mgr.Logger().Warnf("Failed to store client connection for sharing: %s", err)
+	} else {
+		rmi.sharedClient = rmi.FranzReaderOrdered.Client
 	}
+	// The deleted topics are detected with the shared client.
+	rmi.deletedTopics.start()
 
 	return nil
 }
 
+// onPartitionsAssigned starts tracking the partitions which were assigned to the consumer group member.
+func (rmi *redpandaMigratorInput) onPartitionsAssigned(topicPartitions map[string][]int32) {
+	if rmi.transactions != nil {
+		rmi.transactions.assign(topicPartitions)
+	}
+	if rmi.priorities != nil {
+		rmi.priorities.assign(topicPartitions)
+	}
+}
+
+// onPartitionFetched tracks the offsets of the partitions which were fetched.
+func (rmi *redpandaMigratorInput) onPartitionFetched(topic string, partition int32, position, highWatermark, lastStableOffset int64) {
+	if rmi.transactions != nil {
+		rmi.transactions.observe(topic, partition, highWatermark, lastStableOffset)
+	}
+	if rmi.priorities != nil {
+		rmi.priorities.fetched(topic, partition, position)
+	}
+}
+
+// onPartitionsRemoved stops tracking the partitions which were revoked from or lost by the consumer group member.
+func (rmi *redpandaMigratorInput) onPartitionsRemoved(topicPartitions map[string][]int32) {
+	rmi.progress.remove(topicPartitions)
+	if rmi.transactions != nil {
+		rmi.transactions.remove(topicPartitions)
+	}
+	if rmi.priorities != nil {
+		rmi.priorities.remove(topicPartitions)
+	}
+}
+
+// releaseSharedClient releases the client stored for sharing, if any, and requires sharedMut to be held.
+func (rmi *redpandaMigratorInput) releaseSharedClient() {
+	if rmi.sharedClient == nil {
+		return
+	}
+	if _, err := kafka.FranzSharedClientPop(rmi.clientLabel, rmi, rmi.mgr); err != nil {
+		rmi.mgr.Logger().Debugf("Failed to release shared client connection: %s", err)
+	}
+	rmi.sharedClient = nil
+}
+
 func (rmi *redpandaMigratorInput) ReadBatch(ctx context.Context) (service.MessageBatch, service.AckFunc, error) {
 	for {
 		batch, ack, err := rmi.FranzReaderOrdered.ReadBatch(ctx)
@@ -194,14 +567,25 @@ func (rmi *redpandaMigratorInput) ReadBatch(ctx context.Context) (service.Messag
 			return batch, ack, err
 		}
 
-		batch = slices.DeleteFunc(batch, func(msg *service.Message) bool {
-			b, err := msg.AsBytes()
+		// The phases are marked before any records are dropped, so that the snapshot of a partition is completed even
+		// when its last record is dropped.
+		if rmi.phases != nil {
+			rmi.phases.mark(batch)
+		}
+		rmi.progress.update(ctx, batch)
+		if rmi.startOffsets != nil {
+			rmi.startOffsets.mark(batch)
+		}
 
-			if b == nil {
-				rmi.mgr.Logger().Debugf("Skipping tombstone message")
+		batch = slices.DeleteFunc(batch, func(msg *service.Message) bool {
+			if topic, _ := msg.MetaGet("kafka_topic"); rmi.excludedTopics.matches(topic) {
+				rmi.mgr.Logger().Tracef("Skipping message from excluded topic %q", topic)
 				return true
 			}
 
+			// Tombstones are migrated as well, so that compacted topics converge to the same state in the destination
+			// cluster.
+			_, err := msg.AsBytes()
 			return err != nil
 		})
 
@@ -215,7 +599,77 @@ func (rmi *redpandaMigratorInput) ReadBatch(ctx context.Context) (service.Messag
 }
 
 func (rmi *redpandaMigratorInput) Close(ctx context.Context) error {
-	_, _ = kafka.FranzSharedClientPop(rmi.clientLabel, rmi.mgr)
+	rmi.deletedTopics.stop()
+
+	rmi.sharedMut.Lock()
+	rmi.releaseSharedClient()
+	rmi.sharedMut.Unlock()
 
+	if rmi.transactions != nil {
+		rmi.transactions.stop()
+	}
+	if rmi.startOffsets != nil {
+		rmi.startOffsets.close()
+	}
 	return rmi.FranzReaderOrdered.Close(ctx)
 }
+
+//------------------------------------------------------------------------------
+
+// excludeTopicsLintRule rejects topics which are listed in both the topics and exclude_topics fields.
+const excludeTopicsLintRule = `
+let topics = this.topics.or([])
+let excluded = if this.exclude_topics.type() == "array" { this.exclude_topics } else { [] }
+let both = $excluded.filter(t -> $topics.contains(t))
+root = if $both.length() > 0 {
+  "topics %v are listed in both topics and exclude_topics".format($both.join(", "))
+}
+`
+
+func excludeTopicsField() *service.ConfigField {
+	return service.NewStringListField(rmiFieldExcludeTopics).
+		Description("A list of topics which should not be migrated, even if they match the `topics` field. When `regexp_topics` is `true` they are interpreted as regular expression patterns. Multiple comma separated topics can be listed in a single element.").
+		Example([]string{"_connect-configs", "_connect-offsets"}).
+		Example([]string{"^_connect-.*", ".*\\.DLQ$", ".*-changelog$"}).
+		Default([]string{}).
+		Advanced()
+}
+
+// excludedTopicsFromParsed returns a matcher for the topics listed in the exclude_topics field or nil if none are
+// listed.
+func excludedTopicsFromParsed(conf *service.ParsedConfig) (*topicMatcher, error) {
+	topicList, err := conf.FieldStringList(rmiFieldExcludeTopics)
+	if err != nil {
+		return nil, err
+	}
+	topics, _, err := kafka.ParseTopics(topicList, -1, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(topics) == 0 {
+		return nil, nil
+	}
+
+	regexpTopics, err := conf.FieldBool(rmoiFieldRegexpTopics)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := newTopicMatcher(topics, regexpTopics)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", rmiFieldExcludeTopics, err)
+	}
+	return m, nil
+}
+
+// excludedTopicsKey is the key under which a redpanda_migrator input stores its excluded topics in the resources.
+type excludedTopicsKey string
+
+// isExcludedTopic returns true if the redpanda_migrator input with the given label excludes the topic.
+func isExcludedTopic(inputLabel, topic string, res *service.Resources) bool {
+	m, ok := res.GetGeneric(excludedTopicsKey(inputLabel))
+	if !ok {
+		return false
+	}
+	return m.(*topicMatcher).matches(topic)
+}
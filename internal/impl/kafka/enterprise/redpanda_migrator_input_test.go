@@ -0,0 +1,104 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedpandaMigratorInputExcludeTopicsLinting(t *testing.T) {
+	configTests := []struct {
+		name        string
+		config      string
+		errContains string
+	}{
+		{
+			name: "no exclusions",
+			config: `
+redpanda_migrator:
+  seed_brokers: [ localhost:9092 ]
+  consumer_group: migrator
+  topics: [ foo ]
+`,
+		},
+		{
+			name: "regexp exclusions",
+			config: `
+redpanda_migrator:
+  seed_brokers: [ localhost:9092 ]
+  consumer_group: migrator
+  topics: [ '.*' ]
+  regexp_topics: true
+  exclude_topics: [ '^_connect-.*', '.*\.DLQ$' ]
+`,
+		},
+		{
+			name: "topic listed in both",
+			config: `
+redpanda_migrator:
+  seed_brokers: [ localhost:9092 ]
+  consumer_group: migrator
+  topics: [ foo, bar, baz ]
+  exclude_topics: [ bar, qux, baz ]
+`,
+			errContains: "topics bar, baz are listed in both topics and exclude_topics",
+		},
+		{
+			name: "offsets topic listed in both",
+			config: `
+redpanda_migrator_offsets:
+  seed_brokers: [ localhost:9092 ]
+  topics: [ foo ]
+  exclude_topics: [ foo ]
+`,
+			errContains: "topics foo are listed in both topics and exclude_topics",
+		},
+	}
+
+	env := service.NewEnvironment()
+	for _, test := range configTests {
+		t.Run(test.name, func(t *testing.T) {
+			strm := env.NewStreamBuilder()
+			err := strm.AddInputYAML(test.config)
+			if test.errContains == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.errContains)
+			}
+		})
+	}
+}
+
+func TestRedpandaMigratorExcludedTopics(t *testing.T) {
+	res := service.MockResources()
+	assert.False(t, isExcludedTopic("foo", "_connect-offsets", res))
+
+	conf, err := redpandaMigratorInputConfig().ParseYAML(`
+seed_brokers: [ localhost:9092 ]
+consumer_group: migrator
+topics: [ '.*' ]
+regexp_topics: true
+exclude_topics: [ '^_connect-.*,.*\.DLQ$' ]
+`, nil)
+	require.NoError(t, err)
+
+	excluded, err := excludedTopicsFromParsed(conf)
+	require.NoError(t, err)
+	res.SetGeneric(excludedTopicsKey("foo"), excluded)
+
+	assert.True(t, isExcludedTopic("foo", "_connect-offsets", res))
+	assert.True(t, isExcludedTopic("foo", "orders.DLQ", res))
+	assert.False(t, isExcludedTopic("foo", "orders", res))
+	assert.False(t, isExcludedTopic("bar", "orders.DLQ", res))
+}
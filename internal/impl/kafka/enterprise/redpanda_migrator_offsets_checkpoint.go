@@ -0,0 +1,186 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/Jeffail/checkpoint"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/kafka"
+)
+
+const consumerOffsetsTopic = "__consumer_offsets"
+
+// offsetsCheckpointer stores the offset of the last acknowledged record of each `__consumer_offsets` partition in a
+// cache resource, so that the redpanda_migrator_offsets input can resume from it after a restart.
+type offsetsCheckpointer struct {
+	mgr       *service.Resources
+	cache     string
+	keyPrefix string
+
+	mu         sync.Mutex
+	partitions map[int32]*partitionCheckpoint
+}
+
+type partitionCheckpoint struct {
+	tracker *checkpoint.Uncapped[int64]
+	stored  int64
+}
+
+func newOffsetsCheckpointer(mgr *service.Resources, cache, keyPrefix string) *offsetsCheckpointer {
+	return &offsetsCheckpointer{
+		mgr:        mgr,
+		cache:      cache,
+		keyPrefix:  keyPrefix,
+		partitions: map[int32]*partitionCheckpoint{},
+	}
+}
+
+func (c *offsetsCheckpointer) key(partition int32) string {
+	return c.keyPrefix + "_" + strconv.Itoa(int(partition))
+}
+
+// startOffsets returns the offsets from which each partition of `__consumer_offsets` should be consumed, which is
+// right after the checkpoint of the partition or the start of the partition if it doesn't have a checkpoint yet.
+func (c *offsetsCheckpointer) startOffsets(ctx context.Context, clientOpts []kgo.Opt) (map[int32]kgo.Offset, error) {
+	client, err := kgo.NewClient(clientOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka client: %s", err)
+	}
+	defer client.Close()
+
+	endOffsets, err := (&kafka.FranzSharedClientInfo{Client: client}).EndOffsets(ctx, map[string][]int32{consumerOffsetsTopic: nil})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the partitions of topic %q: %s", consumerOffsetsTopic, err)
+	}
+	if len(endOffsets[consumerOffsetsTopic]) == 0 {
+		return nil, fmt.Errorf("failed to list the partitions of topic %q: topic doesn't exist", consumerOffsetsTopic)
+	}
+
+	offsets := map[int32]kgo.Offset{}
+	var cacheErr error
+	if err := c.mgr.AccessCache(ctx, c.cache, func(cache service.Cache) {
+		for partition := range endOffsets[consumerOffsetsTopic] {
+			offsets[partition] = kgo.NewOffset().AtStart()
+
+			var b []byte
+			if b, cacheErr = cache.Get(ctx, c.key(partition)); errors.Is(cacheErr, service.ErrKeyNotFound) {
+				cacheErr = nil
+				continue
+			} else if cacheErr != nil {
+				return
+			}
+
+			var offset int64
+			if offset, cacheErr = strconv.ParseInt(string(b), 10, 64); cacheErr != nil {
+				cacheErr = fmt.Errorf("invalid checkpoint for partition %d: %s", partition, cacheErr)
+				return
+			}
+			offsets[partition] = kgo.NewOffset().At(offset + 1)
+		}
+	}); err != nil {
+		return nil, fmt.Errorf("failed to access checkpoint cache: %s", err)
+	}
+	if cacheErr != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %s", cacheErr)
+	}
+
+	return offsets, nil
+}
+
+// track returns an ack function which advances the checkpoints of the partitions of the messages in the batch once
+// they and all preceding messages of the same partitions have been acknowledged successfully.
+func (c *offsetsCheckpointer) track(batch service.MessageBatch, ack service.AckFunc) service.AckFunc {
+	if c == nil {
+		return ack
+	}
+
+	type partitionBatch struct {
+		highest int64
+		count   int64
+	}
+	batches := map[int32]*partitionBatch{}
+	for _, msg := range batch {
+		p, _ := msg.MetaGetMut("kafka_partition")
+		o, _ := msg.MetaGetMut("kafka_offset")
+		partition, okP := p.(int)
+		offset, okO := o.(int)
+		if !okP || !okO {
+			continue
+		}
+		pb, exists := batches[int32(partition)]
+		if !exists {
+			pb = &partitionBatch{highest: -1}
+			batches[int32(partition)] = pb
+		}
+		pb.highest = max(pb.highest, int64(offset))
+		pb.count++
+	}
+
+	c.mu.Lock()
+	releaseFns := make(map[int32]func() *int64, len(batches))
+	for partition, pb := range batches {
+		pc, exists := c.partitions[partition]
+		if !exists {
+			pc = &partitionCheckpoint{tracker: checkpoint.NewUncapped[int64](), stored: -1}
+			c.partitions[partition] = pc
+		}
+		releaseFns[partition] = pc.tracker.Track(pb.highest, pb.count)
+	}
+	c.mu.Unlock()
+
+	return func(ctx context.Context, err error) error {
+		if ackErr := ack(ctx, err); ackErr != nil {
+			return ackErr
+		}
+		// Nacked messages are never released, so that the checkpoint doesn't move past them.
+		if err != nil {
+			return nil
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		var errs []error
+		for partition, release := range releaseFns {
+			highest := release()
+			pc := c.partitions[partition]
+			if highest == nil || *highest <= pc.stored {
+				continue
+			}
+			if storeErr := c.store(ctx, partition, *highest); storeErr != nil {
+				errs = append(errs, storeErr)
+				continue
+			}
+			pc.stored = *highest
+		}
+		return errors.Join(errs...)
+	}
+}
+
+func (c *offsetsCheckpointer) store(ctx context.Context, partition int32, offset int64) error {
+	var setErr error
+	if err := c.mgr.AccessCache(ctx, c.cache, func(cache service.Cache) {
+		setErr = cache.Set(ctx, c.key(partition), []byte(strconv.FormatInt(offset, 10)), nil)
+	}); err != nil {
+		return fmt.Errorf("failed to access checkpoint cache: %s", err)
+	}
+	if setErr != nil {
+		return fmt.Errorf("failed to store checkpoint for partition %d: %s", partition, setErr)
+	}
+	return nil
+}
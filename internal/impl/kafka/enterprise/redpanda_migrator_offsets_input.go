@@ -10,12 +10,15 @@ package enterprise
 
 import (
 	"context"
+	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"regexp"
 	"slices"
+	"sync"
+	"time"
 
-	"github.com/twmb/franz-go/pkg/kadm"
 	"github.com/twmb/franz-go/pkg/kgo"
 	"github.com/twmb/franz-go/pkg/kmsg"
 
@@ -29,6 +32,39 @@ const (
 	rmoiFieldTopics       = "topics"
 	rmoiFieldRegexpTopics = "regexp_topics"
 	rmoiFieldRackID       = "rack_id"
+
+	// Batching fields
+	rmoiFieldBatchByGroup     = "batch_by_group"
+	rmoiFieldGroupBatchCount  = "group_batch_count"
+	rmoiFieldGroupBatchPeriod = "group_batch_period"
+
+	// Checkpoint fields
+	rmoiFieldCheckpointCache = "checkpoint_cache"
+	rmoiFieldCheckpointKey   = "checkpoint_key"
+	rmoiFieldStartFrom       = "start_from"
+
+	// Payload fields
+	rmoiFieldPayloadFormat = "payload_format"
+	rmoiFieldMode          = "mode"
+
+	// Partition fields
+	rmoiFieldPartitions          = "partitions"
+	rmoiFieldPartitionSplit      = "partition_split"
+	rmoiFieldPartitionSplitCount = "count"
+	rmoiFieldPartitionSplitIndex = "index"
+	rmoiFieldParallelism         = "parallelism"
+)
+
+const (
+	rmoiStartFromCheckpoint = "checkpoint"
+	rmoiStartFromBeginning  = "beginning"
+
+	rmoiPayloadFormatRaw  = "raw"
+	rmoiPayloadFormatJSON = "json"
+
+	rmoiModeDecode      = "decode"
+	rmoiModePassthrough = "passthrough"
+	rmoiModeBoth        = "both"
 )
 
 func redpandaMigratorOffsetsInputConfig() *service.ConfigSpec {
@@ -57,10 +93,119 @@ This input adds the following metadata fields to each message:
 - kafka_offset_partition
 - kafka_offset_commit_timestamp
 - kafka_offset_metadata
+- kafka_offset_leader_epoch
 - kafka_is_high_watermark
+- kafka_offset_transactional
+- kafka_offset_decoded
 ` + "```" + `
+
+When the offsets of a consumer group are deleted, the ` + "`__consumer_offsets`" + ` topic contains tombstone records for
+them. These are emitted as messages with an empty body and the ` + "`kafka_tombstone_message`" + ` metadata field set to
+` + "`true`" + `. The ` + "`kafka_offset_commit_timestamp`" + `, ` + "`kafka_offset_metadata`" + `,
+` + "`kafka_offset_leader_epoch`" + ` and ` + "`kafka_is_high_watermark`" + ` metadata fields are not set for these messages.
+
+The ` + "`kafka_offset_leader_epoch`" + ` metadata field is set to ` + "`-1`" + ` for offsets which were committed without a
+leader epoch, including all offsets stored in the value formats which predate leader epochs.
+
+== Transactions
+
+Applications which consume, transform and produce records transactionally commit their offsets within their
+transactions, for example with ` + "`sendOffsetsToTransaction`" + `. The ` + "`__consumer_offsets`" + ` topic is consumed
+with the ` + "`read_committed`" + ` isolation level, so the offsets which were committed within aborted transactions are
+never emitted, and the offsets of open transactions are only emitted once their transactions are committed. The
+transaction markers of the topic are skipped. The ` + "`kafka_offset_transactional`" + ` metadata field is set to
+` + "`true`" + ` for the offsets which were committed within a transaction and to ` + "`false`" + ` for the other offsets. It
+isn't set in the ` + "`passthrough`" + ` mode.
+
+== Modes
+
+By default, this input only emits the offset commits of the configured topics and skips all the other records of the
+` + "`__consumer_offsets`" + ` topic, such as group metadata records. When ` + "`mode`" + ` is set to ` + "`passthrough`" + `, every
+record is emitted as it is, with only the metadata fields which are added to all Kafka records, which is useful for
+archiving the whole topic. When ` + "`mode`" + ` is set to ` + "`both`" + `, every record is emitted as well, but the offset
+commits of the configured topics are decoded like in the default mode. The ` + "`kafka_offset_decoded`" + ` metadata field is
+only set in this mode, to ` + "`true`" + ` for the messages which were decoded and to ` + "`false`" + ` for all the other messages,
+whose payload is the raw record value regardless of ` + "`payload_format`" + `. Records with unknown key versions never
+cause errors in either mode.
+
+== Batching by group
+
+Committing the offsets of a consumer group out of order can move its committed offset backwards. When
+` + "`batch_by_group`" + ` is enabled, each batch emitted by this input contains the offsets of exactly one consumer group
+in the order in which they were read, so that different groups can be processed in parallel while the offsets of a
+single group are processed in sequence, for example by routing on the ` + "`kafka_offset_group`" + ` metadata field.
+A batch is emitted once it reaches ` + "`group_batch_count`" + ` messages or once ` + "`group_batch_period`" + ` has
+elapsed since its first message was read. Partial batches are also emitted before the input stops reading due to an
+error or shutdown, and any batches which are still pending when the input closes are not acknowledged, so their
+offsets are consumed again on restart.
+
+== Checkpointing
+
+By default, this input reads the ` + "`__consumer_offsets`" + ` topic from the beginning every time it starts. Its progress can
+be persisted so that restarts resume where the previous run left off, either by setting a ` + "`consumer_group`" + `, in
+which case the offsets of the ` + "`__consumer_offsets`" + ` topic are committed on the source cluster, or by setting a
+` + "`checkpoint_cache`" + `, in which case the offset of the last processed record of each ` + "`__consumer_offsets`" + `
+partition is stored in a cache resource. In both cases progress only advances once the messages have been
+acknowledged, and a cache checkpoint never moves past a message which was rejected. Set ` + "`start_from`" + ` to
+` + "`beginning`" + ` in order to ignore the cache checkpoint and read the whole topic again.
+
+== Payload format
+
+By default, the payload of each message is the raw ` + "`__consumer_offsets`" + ` record value. When ` + "`payload_format`" + ` is
+set to ` + "`json`" + `, the payload is replaced with a JSON document describing the offset commit, which is useful for
+archiving or inspecting migrated offsets. The metadata fields are set in both cases:
+
+` + "```json" + `
+{
+  "group": "foo",
+  "topic": "bar",
+  "partition": 3,
+  "offset": 42,
+  "leader_epoch": 7,
+  "commit_timestamp": 1741000000000,
+  "metadata": "",
+  "deleted": false
+}
+` + "```" + `
+
+The ` + "`leader_epoch`" + ` field is ` + "`-1`" + ` for offsets committed without a leader epoch and the ` + "`commit_timestamp`" + `
+field is the time at which the offset was committed in milliseconds since the Unix epoch. For tombstones, the
+` + "`deleted`" + ` field is ` + "`true`" + ` and only the ` + "`group`" + `, ` + "`topic`" + ` and ` + "`partition`" + ` fields are set.
+
+== Partitions and parallelism
+
+By default, this input reads all partitions of the ` + "`__consumer_offsets`" + ` topic with a single reader. Clusters with
+many consumer groups can spread the work across multiple inputs, either by listing the partitions read by each of them
+in ` + "`partitions`" + ` or by setting ` + "`partition_split`" + `, in which case each input reads the partitions whose number
+modulo ` + "`partition_split.count`" + ` equals its ` + "`partition_split.index`" + `. Within a single input, ` + "`parallelism`" + `
+sets the number of readers which the selected partitions are distributed across. Each partition is read by exactly one
+reader, so the offset commits of a consumer group, which are all written to the same partition, are always emitted in
+order, while the batches of different readers are emitted in the order in which they are ready.
+
+The ` + "`kafka_partition`" + ` metadata field contains the ` + "`__consumer_offsets`" + ` partition of each message and the
+` + "`redpanda_lag`" + ` metric is reported for each of these partitions. The ` + "`redpanda_migrator_offsets_decoded`" + `
+counter tracks the number of offset commits decoded from each ` + "`__consumer_offsets`" + ` partition. None of these
+fields can be combined with a ` + "`consumer_group`" + `, since the partitions of a consumer group are assigned by the
+cluster.
 `).
-		Fields(redpandaMigratorOffsetsInputConfigFields()...)
+		Fields(redpandaMigratorOffsetsInputConfigFields()...).
+		LintRule(excludeTopicsLintRule + `
+root = if this.consumer_group.or("") != "" && this.checkpoint_cache.or("") != "" {
+  "only one of consumer_group and checkpoint_cache can be set"
+} else if this.consumer_group.or("") != "" && this.start_from.or("checkpoint") == "beginning" {
+  "start_from cannot be set to beginning when a consumer_group is set, since the committed offsets of the group take precedence"
+}
+root = if this.partitions.or([]).length() > 0 && this.partition_split != null {
+  "only one of partitions and partition_split can be set"
+} else if this.partition_split != null && (this.partition_split.index < 0 || this.partition_split.index >= this.partition_split.count) {
+  "partition_split.index must be between 0 and partition_split.count - 1"
+} else if this.consumer_group.or("") != "" && (this.partitions.or([]).length() > 0 || this.partition_split != null || this.parallelism.or(1) > 1) {
+  "partitions, partition_split and parallelism cannot be set when a consumer_group is set"
+}
+root = if this.mode.or("decode") == "passthrough" && this.payload_format.or("raw") == "json" {
+  "payload_format cannot be json when mode is passthrough, since records are not decoded"
+}
+`)
 }
 
 func redpandaMigratorOffsetsInputConfigFields() []*service.ConfigField {
@@ -77,10 +222,68 @@ A list of topics to consume from. Multiple comma separated topics can be listed
 			service.NewBoolField(rmoiFieldRegexpTopics).
 				Description("Whether listed topics should be interpreted as regular expression patterns for matching multiple topics.").
 				Default(false),
+			excludeTopicsField(),
 			service.NewStringField(rmoiFieldRackID).
 				Description("A rack specifies where the client is physically located and changes fetch requests to consume from the closest replica as opposed to the leader replica.").
 				Default("").
 				Advanced(),
+			service.NewBoolField(rmoiFieldBatchByGroup).
+				Description("Emit batches which contain the offsets of a single consumer group in the order in which they were read.").
+				Default(false).
+				Advanced(),
+			service.NewIntField(rmoiFieldGroupBatchCount).
+				Description("The maximum number of messages in a batch when `" + rmoiFieldBatchByGroup + "` is enabled. Set to `0` to disable count based flushing.").
+				Default(100).
+				LintRule(`root = if this < 0 { ["` + rmoiFieldGroupBatchCount + ` must not be negative"] }`).
+				Advanced(),
+			service.NewDurationField(rmoiFieldGroupBatchPeriod).
+				Description("The maximum amount of time a batch is held back waiting for more messages of the same group when `" + rmoiFieldBatchByGroup + "` is enabled.").
+				Default("1s").
+				Advanced(),
+			service.NewStringField(rmoiFieldCheckpointCache).
+				Description("A https://docs.redpanda.com/redpanda-connect/components/caches/about[cache resource^] used to store the offset of the last processed record of each `__consumer_offsets` partition, so that this input resumes from it after a restart instead of reading the topic from the beginning.").
+				Optional(),
+			service.NewStringField(rmoiFieldCheckpointKey).
+				Description("The prefix of the cache keys under which the checkpoints are stored, which is followed by the partition number. It must be unique for each input sharing the same `" + rmoiFieldCheckpointCache + "`.").
+				Default("redpanda_migrator_offsets").
+				Advanced(),
+			service.NewStringEnumField(rmoiFieldStartFrom, rmoiStartFromCheckpoint, rmoiStartFromBeginning).
+				Description("Whether to resume from the checkpoints stored in the `" + rmoiFieldCheckpointCache + "` or to read the `__consumer_offsets` topic from the beginning. Checkpoints are stored in both cases.").
+				Default(rmoiStartFromCheckpoint).
+				Advanced(),
+			service.NewStringEnumField(rmoiFieldPayloadFormat, rmoiPayloadFormatRaw, rmoiPayloadFormatJSON).
+				Description("The format of the message payloads. `raw` emits the `__consumer_offsets` record values as they are and `json` emits a JSON document describing each offset commit.").
+				Default(rmoiPayloadFormatRaw).
+				Advanced(),
+			service.NewStringAnnotatedEnumField(rmoiFieldMode, map[string]string{
+				rmoiModeDecode:      "Emit the decoded offset commits of the configured topics and skip all the other records.",
+				rmoiModePassthrough: "Emit every record of the `__consumer_offsets` topic as it is, without decoding it.",
+				rmoiModeBoth:        "Emit every record of the `__consumer_offsets` topic and decode the offset commits of the configured topics, setting the `kafka_offset_decoded` metadata field to indicate whether each message was decoded.",
+			}).
+				Description("Which records of the `__consumer_offsets` topic are emitted and whether they are decoded.").
+				Default(rmoiModeDecode).
+				Advanced(),
+			service.NewStringListField(rmoiFieldPartitions).
+				Description("The partitions of the `__consumer_offsets` topic to read, either as single partitions or as inclusive ranges such as `0-24`. All partitions are read when it's not set.").
+				Example([]string{"0-24"}).
+				Example([]string{"0", "3", "10-12"}).
+				Optional().
+				Advanced(),
+			service.NewObjectField(rmoiFieldPartitionSplit,
+				service.NewIntField(rmoiFieldPartitionSplitCount).
+					Description("The number of inputs which the partitions are split across.").
+					LintRule(`root = if this < 1 { ["`+rmoiFieldPartitionSplitCount+` must be at least 1"] }`),
+				service.NewIntField(rmoiFieldPartitionSplitIndex).
+					Description("The index of this input, starting from `0`. It reads the partitions whose number modulo `"+rmoiFieldPartitionSplitCount+"` equals it."),
+			).
+				Description("Read a subset of the `__consumer_offsets` partitions so that they can be split across multiple inputs without listing them explicitly.").
+				Optional().
+				Advanced(),
+			service.NewIntField(rmoiFieldParallelism).
+				Description("The number of readers which the selected `__consumer_offsets` partitions are distributed across. Each partition is read by a single reader, so the offsets of a consumer group are always emitted in order.").
+				Default(1).
+				LintRule(`root = if this < 1 { ["` + rmoiFieldParallelism + ` must be at least 1"] }`).
+				Advanced(),
 		},
 		kafka.FranzReaderOrderedConfigFields(),
 		[]*service.ConfigField{
@@ -133,13 +336,85 @@ func init() {
 				}
 			}
 
-			i.FranzReaderOrdered, err = kafka.NewFranzReaderOrderedFromConfig(conf, mgr, func() ([]kgo.Opt, error) {
-				// Consume messages from the `__consumer_offsets` topic and configure `start_from_oldest: true`
-				return append(clientOpts, kgo.ConsumeTopics("__consumer_offsets"), kgo.ConsumeResetOffset(kgo.NewOffset().AtStart())), nil
-			})
+			if i.excludedTopics, err = excludedTopicsFromParsed(conf); err != nil {
+				return nil, err
+			}
+
+			if batchByGroup, err := conf.FieldBool(rmoiFieldBatchByGroup); err != nil {
+				return nil, err
+			} else if batchByGroup {
+				count, err := conf.FieldInt(rmoiFieldGroupBatchCount)
+				if err != nil {
+					return nil, err
+				}
+				period, err := conf.FieldDuration(rmoiFieldGroupBatchPeriod)
+				if err != nil {
+					return nil, err
+				}
+				i.groupBatcher = newOffsetGroupBatcher(count, period)
+			}
+
+			if conf.Contains(rmoiFieldCheckpointCache) {
+				cache, err := conf.FieldString(rmoiFieldCheckpointCache)
+				if err != nil {
+					return nil, err
+				}
+				if !mgr.HasCache(cache) {
+					return nil, fmt.Errorf("cache resource %q not found", cache)
+				}
+				key, err := conf.FieldString(rmoiFieldCheckpointKey)
+				if err != nil {
+					return nil, err
+				}
+				i.checkpointer = newOffsetsCheckpointer(mgr, cache, key)
+
+				if i.startFrom, err = conf.FieldString(rmoiFieldStartFrom); err != nil {
+					return nil, err
+				}
+			}
+
+			if payloadFormat, err := conf.FieldString(rmoiFieldPayloadFormat); err != nil {
+				return nil, err
+			} else {
+				i.jsonPayload = payloadFormat == rmoiPayloadFormatJSON
+			}
+
+			if i.mode, err = conf.FieldString(rmoiFieldMode); err != nil {
+				return nil, err
+			}
+			if i.mode == rmoiModePassthrough && i.jsonPayload {
+				return nil, fmt.Errorf("%s cannot be %s when %s is %s", rmoiFieldPayloadFormat, rmoiPayloadFormatJSON, rmoiFieldMode, rmoiModePassthrough)
+			}
+
+			if i.partitionSelector, err = offsetsPartitionSelectorFromParsed(conf); err != nil {
+				return nil, err
+			}
+
+			parallelism, err := conf.FieldInt(rmoiFieldParallelism)
 			if err != nil {
 				return nil, err
 			}
+			if parallelism < 1 {
+				return nil, fmt.Errorf("%s must be at least 1", rmoiFieldParallelism)
+			}
+			if parallelism > 1 {
+				i.readerPool = newOffsetsReaderPool(parallelism)
+			}
+
+			for idx := range parallelism {
+				reader, err := kafka.NewFranzReaderOrderedFromConfig(conf, mgr, func() ([]kgo.Opt, error) {
+					return i.readerClientOpts(idx), nil
+				})
+				if err != nil {
+					return nil, err
+				}
+				if i.mode != rmoiModePassthrough {
+					reader.OnRecord = markTransactionalRecord
+				}
+				i.readers = append(i.readers, reader)
+			}
+
+			i.decodedCommits = mgr.Metrics().NewCounter("redpanda_migrator_offsets_decoded", "partition")
 
 			return service.AutoRetryNacksBatchedToggled(conf, &i)
 		})
@@ -151,16 +426,31 @@ func init() {
 //------------------------------------------------------------------------------
 
 type redpandaMigratorOffsetsInput struct {
-	*kafka.FranzReaderOrdered
-
-	topicPatterns []*regexp.Regexp
-	topics        []string
-	clientOpts    []kgo.Opt
+	readers    []*kafka.FranzReaderOrdered
+	readerPool *offsetsReaderPool
+	// The `__consumer_offsets` partitions consumed by each reader along with their start offsets. The readers consume
+	// the whole topic when it's nil.
+	readerOffsets     []map[int32]kgo.Offset
+	partitionSelector *offsetsPartitionSelector
+
+	topicPatterns  []*regexp.Regexp
+	topics         []string
+	excludedTopics *topicMatcher
+	clientOpts     []kgo.Opt
+	groupBatcher   *offsetGroupBatcher
+	checkpointer   *offsetsCheckpointer
+	startFrom      string
+	jsonPayload    bool
+	mode           string
+	decodedCommits *service.MetricCounter
 
 	mgr *service.Resources
 }
 
 func (rmoi *redpandaMigratorOffsetsInput) matchesTopic(topic string) bool {
+	if rmoi.excludedTopics.matches(topic) {
+		return false
+	}
 	if len(rmoi.topicPatterns) > 0 {
 		return slices.ContainsFunc(rmoi.topicPatterns, func(tp *regexp.Regexp) bool {
 			return tp.MatchString(topic)
@@ -171,7 +461,9 @@ func (rmoi *redpandaMigratorOffsetsInput) matchesTopic(topic string) bool {
 	})
 }
 
-func (rmoi *redpandaMigratorOffsetsInput) getKeyAndOffset(msg *service.Message) (key kmsg.OffsetCommitKey, offset kmsg.OffsetCommitValue, ok bool) {
+// getKeyAndOffset decodes offset commit records from the `__consumer_offsets` topic. When isTombstone is true, the
+// offset commit for the returned key has been deleted and offset is empty.
+func (rmoi *redpandaMigratorOffsetsInput) getKeyAndOffset(msg *service.Message) (key kmsg.OffsetCommitKey, offset kmsg.OffsetCommitValue, isTombstone bool, ok bool) {
 	var recordKey []byte
 	if k, exists := msg.MetaGetMut("kafka_key"); !exists {
 		return
@@ -179,9 +471,19 @@ func (rmoi *redpandaMigratorOffsetsInput) getKeyAndOffset(msg *service.Message)
 		recordKey = k.([]byte)
 	}
 
-	// Check the version to ensure that we process only offset commit keys
+	// Check the version to ensure that we process only offset commit keys. Keys with version 2 belong to group metadata
+	// records, which we skip.
+	if len(recordKey) < 2 {
+		rmoi.mgr.Logger().Debugf("Failed to decode record key: invalid length %d", len(recordKey))
+		return
+	}
+	if version := int16(binary.BigEndian.Uint16(recordKey)); version != 0 && version != 1 {
+		rmoi.mgr.Logger().Tracef("Skipping record with key version %d", version)
+		return
+	}
+
 	key = kmsg.NewOffsetCommitKey()
-	if err := key.ReadFrom(recordKey); err != nil || (key.Version != 0 && key.Version != 1) {
+	if err := key.ReadFrom(recordKey); err != nil {
 		rmoi.mgr.Logger().Debugf("Failed to decode record key: %s", err)
 		return
 	}
@@ -198,45 +500,92 @@ func (rmoi *redpandaMigratorOffsetsInput) getKeyAndOffset(msg *service.Message)
 		return
 	}
 
+	// Tombstones are written when the offsets of a consumer group are deleted.
+	if len(recordValue) == 0 {
+		return key, offset, true, true
+	}
+
 	offset = kmsg.NewOffsetCommitValue()
 	if err := offset.ReadFrom(recordValue); err != nil {
 		rmoi.mgr.Logger().Debugf("Failed to decode offset commit value: %s", err)
 		return
 	}
 
-	return key, offset, true
+	return key, offset, false, true
+}
+
+// markTransactionalRecord sets the `kafka_offset_transactional` metadata field of a message to whether its record was
+// written within a transaction, which is only known before the record is converted into a message.
+func markTransactionalRecord(record *kgo.Record, msg *service.Message) {
+	msg.MetaSetMut("kafka_offset_transactional", record.Attrs.IsTransactional())
+}
+
+// offsetCommitLeaderEpoch returns the leader epoch of an offset commit or -1 if the value version predates leader epochs.
+func offsetCommitLeaderEpoch(offset kmsg.OffsetCommitValue) int32 {
+	if offset.Version < 3 {
+		return -1
+	}
+	return offset.LeaderEpoch
+}
+
+// offsetCommitDocument is the payload of the messages emitted when `payload_format` is `json`.
+type offsetCommitDocument struct {
+	Group           string  `json:"group"`
+	Topic           string  `json:"topic"`
+	Partition       int32   `json:"partition"`
+	Offset          *int64  `json:"offset,omitempty"`
+	LeaderEpoch     *int32  `json:"leader_epoch,omitempty"`
+	CommitTimestamp *int64  `json:"commit_timestamp,omitempty"`
+	Metadata        *string `json:"metadata,omitempty"`
+	Deleted         bool    `json:"deleted"`
+}
+
+func offsetCommitJSON(key kmsg.OffsetCommitKey, offset kmsg.OffsetCommitValue, isTombstone bool) []byte {
+	doc := offsetCommitDocument{
+		Group:     key.Group,
+		Topic:     key.Topic,
+		Partition: key.Partition,
+		Deleted:   isTombstone,
+	}
+	if !isTombstone {
+		leaderEpoch := offsetCommitLeaderEpoch(offset)
+		doc.Offset = &offset.Offset
+		doc.LeaderEpoch = &leaderEpoch
+		doc.CommitTimestamp = &offset.CommitTimestamp
+		doc.Metadata = &offset.Metadata
+	}
+	// Marshalling can't fail since the document only contains strings and numbers.
+	b, _ := json.Marshal(doc)
+	return b
 }
 
-func (rmoi *redpandaMigratorOffsetsInput) getTimestampForCommittedOffset(ctx context.Context, topic string, partition int32, offset int64) (timestamp int64, isHighWatermark bool, err error) {
-	client, err := kgo.NewClient(rmoi.clientOpts...)
+// fetchCommittedOffsetTimestamp returns the timestamp of the record at a committed offset of a source topic partition.
+// When the offset is the high watermark, the timestamp of the last record is returned and isHighWatermark is true.
+func fetchCommittedOffsetTimestamp(ctx context.Context, clientOpts []kgo.Opt, topic string, partition int32, offset int64) (timestamp int64, isHighWatermark bool, err error) {
+	client, err := kgo.NewClient(clientOpts...)
 	if err != nil {
 		return 0, false, fmt.Errorf("failed to create Kafka client: %s", err)
 	}
 	defer client.Close()
 
-	// The default kadm client timeout is 15s. Do we need to make this configurable?
-	offsets, err := kadm.NewClient(client).ListEndOffsets(ctx, topic)
+	offsets, err := (&kafka.FranzSharedClientInfo{Client: client}).EndOffsets(ctx, map[string][]int32{topic: {partition}})
 	if err != nil {
 		return 0, false, fmt.Errorf("failed to read the high watermark for topic %q and partition %q: %s", topic, partition, err)
 	}
-
-	highWatermark, ok := offsets.Lookup(topic, partition)
-	if !ok {
-		return 0, false, fmt.Errorf("failed to find the high watermark for topic %q and partition %q: %s", topic, partition, err)
-	}
+	highWatermark := offsets[topic][partition]
 
 	// If the high watermark on the topic matches the offset we received via `__consumer_offsets`, then we must read the
 	// last record from the topic because the high watermark does not have a corresponding record yet.
 	var recordOffset kgo.Offset
-	if highWatermark.Offset == offset {
+	if highWatermark == offset {
 		// The default offset begins at the end.
 		recordOffset = kgo.NewOffset().Relative(-1)
-	} else if highWatermark.Offset > offset {
+	} else if highWatermark > offset {
 		recordOffset = kgo.NewOffset().At(offset)
 	} else {
 		return 0, false, fmt.Errorf(
 			"the newest committed offset %d for topic %q partition %q should never be smaller than the received offset %d",
-			highWatermark.Offset, topic, partition, offset,
+			highWatermark, topic, partition, offset,
 		)
 	}
 
@@ -262,48 +611,222 @@ func (rmoi *redpandaMigratorOffsetsInput) getTimestampForCommittedOffset(ctx con
 
 	rec := it.Next()
 
-	return rec.Timestamp.UnixMilli(), highWatermark.Offset == offset, nil
+	return rec.Timestamp.UnixMilli(), highWatermark == offset, nil
 }
 
 func (rmoi *redpandaMigratorOffsetsInput) ReadBatch(ctx context.Context) (service.MessageBatch, service.AckFunc, error) {
+	if rmoi.groupBatcher != nil {
+		return rmoi.readBatchByGroup(ctx)
+	}
+
+	return rmoi.readNext(ctx, ctx)
+}
+
+func (rmoi *redpandaMigratorOffsetsInput) readBatchByGroup(ctx context.Context) (service.MessageBatch, service.AckFunc, error) {
 	for {
-		batch, ack, err := rmoi.FranzReaderOrdered.ReadBatch(ctx)
-		if err != nil {
-			return batch, ack, err
+		if batch, ack := rmoi.groupBatcher.flushReady(time.Now()); batch != nil {
+			return batch, ack, nil
 		}
 
-		// Skip records where `getKeyAndOffset()` returns false. This logic is similar to `slices.DeleteFunc()`, but we
-		// need to return errors if we can't connect to the Kafka cluster to read data.
-		i := 0
-		for _, msg := range batch {
-			key, offset, ok := rmoi.getKeyAndOffset(msg)
-			if !ok {
+		// Only wait for new records until the oldest pending batch is due.
+		readCtx, done := ctx, func() {}
+		if deadline, ok := rmoi.groupBatcher.nextDeadline(); ok {
+			readCtx, done = context.WithDeadline(ctx, deadline)
+		}
+		batch, ack, err := rmoi.readNext(ctx, readCtx)
+		done()
+		if err != nil {
+			if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
 				continue
 			}
-			batch[i] = msg
-			i++
+			// Emit the pending batches before surfacing the error.
+			if batch, ack := rmoi.groupBatcher.flushOldest(); batch != nil {
+				return batch, ack, nil
+			}
+			return nil, nil, err
+		}
 
-			ts, isHWMCommit, err := rmoi.getTimestampForCommittedOffset(ctx, key.Topic, key.Partition, offset.Offset)
-			if err != nil {
-				return nil, nil, err
+		rmoi.groupBatcher.add(batch, ack)
+	}
+}
+
+// decodeOffsets adds the decoded offset commit fields to the metadata of the messages which are offset commits for the
+// configured topics. The other records are removed from the batch in the decode mode and kept in the both mode, and
+// the batch is returned as it is in the passthrough mode.
+func (rmoi *redpandaMigratorOffsetsInput) decodeOffsets(ctx context.Context, batch service.MessageBatch) (service.MessageBatch, error) {
+	if rmoi.mode == rmoiModePassthrough {
+		return batch, nil
+	}
+
+	// Skip records where `getKeyAndOffset()` returns false. This logic is similar to `slices.DeleteFunc()`, but we
+	// need to return errors if we can't connect to the Kafka cluster to read data.
+	i := 0
+	for _, msg := range batch {
+		key, offset, isTombstone, ok := rmoi.getKeyAndOffset(msg)
+		if !ok {
+			if rmoi.mode == rmoiModeBoth {
+				msg.MetaSetMut("kafka_offset_decoded", false)
+				batch[i] = msg
+				i++
 			}
+			continue
+		}
+		batch[i] = msg
+		i++
 
-			msg.MetaSetMut("kafka_offset_topic", key.Topic)
-			msg.MetaSetMut("kafka_offset_group", key.Group)
-			msg.MetaSetMut("kafka_offset_partition", key.Partition)
-			msg.MetaSetMut("kafka_offset_commit_timestamp", ts)
-			msg.MetaSetMut("kafka_offset_metadata", offset.Metadata)
-			msg.MetaSetMut("kafka_is_high_watermark", isHWMCommit)
+		if rmoi.mode == rmoiModeBoth {
+			msg.MetaSetMut("kafka_offset_decoded", true)
 		}
 
-		// Delete the records that we skipped
-		batch = slices.Delete(batch, i, len(batch))
+		if partition, ok := msg.MetaGetMut("kafka_partition"); ok {
+			rmoi.decodedCommits.Incr(1, fmt.Sprint(partition))
+		}
 
-		if len(batch) == 0 {
-			_ = ack(ctx, nil) // TODO: Log this error?
+		msg.MetaSetMut("kafka_offset_topic", key.Topic)
+		msg.MetaSetMut("kafka_offset_group", key.Group)
+		msg.MetaSetMut("kafka_offset_partition", key.Partition)
+
+		if isTombstone {
+			if rmoi.jsonPayload {
+				msg.SetBytes(offsetCommitJSON(key, offset, true))
+			} else {
+				msg.SetBytes(nil)
+			}
+			msg.MetaSetMut("kafka_tombstone_message", true)
 			continue
 		}
 
-		return batch, ack, nil
+		ts, isHWMCommit, err := fetchCommittedOffsetTimestamp(ctx, rmoi.clientOpts, key.Topic, key.Partition, offset.Offset)
+		if err != nil {
+			return nil, err
+		}
+
+		msg.MetaSetMut("kafka_offset_commit_timestamp", ts)
+		msg.MetaSetMut("kafka_offset_metadata", offset.Metadata)
+		msg.MetaSetMut("kafka_offset_leader_epoch", offsetCommitLeaderEpoch(offset))
+		msg.MetaSetMut("kafka_is_high_watermark", isHWMCommit)
+		if rmoi.jsonPayload {
+			msg.SetBytes(offsetCommitJSON(key, offset, false))
+		}
+	}
+
+	// Delete the records that we skipped
+	return slices.Delete(batch, i, len(batch)), nil
+}
+
+//------------------------------------------------------------------------------
+
+// offsetGroupBatcher splits the batches read from `__consumer_offsets` into batches which contain the messages of a
+// single consumer group in the order in which they were read.
+type offsetGroupBatcher struct {
+	count  int
+	period time.Duration
+
+	pending []*offsetGroupBatch // Ordered by the time their first message was read
+}
+
+type offsetGroupBatch struct {
+	group   string
+	created time.Time
+	msgs    service.MessageBatch
+	sources []*sharedAck
+}
+
+func newOffsetGroupBatcher(count int, period time.Duration) *offsetGroupBatcher {
+	return &offsetGroupBatcher{
+		count:  count,
+		period: period,
+	}
+}
+
+// add distributes the messages of a decoded batch across the pending group batches. The batch is acknowledged once all
+// of the group batches containing its messages have been acknowledged.
+func (b *offsetGroupBatcher) add(batch service.MessageBatch, ack service.AckFunc) {
+	source := &sharedAck{ack: ack}
+	now := time.Now()
+	for _, msg := range batch {
+		group, _ := msg.MetaGetMut("kafka_offset_group")
+		groupStr, _ := group.(string)
+
+		var gb *offsetGroupBatch
+		for _, p := range b.pending {
+			// Don't append to a full batch so that batches never exceed the count.
+			if p.group == groupStr && (b.count <= 0 || len(p.msgs) < b.count) {
+				gb = p
+			}
+		}
+		if gb == nil {
+			gb = &offsetGroupBatch{group: groupStr, created: now}
+			b.pending = append(b.pending, gb)
+		}
+		if !slices.Contains(gb.sources, source) {
+			gb.sources = append(gb.sources, source)
+			source.pending++
+		}
+		gb.msgs = append(gb.msgs, msg)
+	}
+}
+
+// flushReady returns the first pending batch which is either full or has been pending for the configured period.
+func (b *offsetGroupBatcher) flushReady(now time.Time) (service.MessageBatch, service.AckFunc) {
+	idx := slices.IndexFunc(b.pending, func(gb *offsetGroupBatch) bool {
+		return (b.count > 0 && len(gb.msgs) >= b.count) || !now.Before(gb.created.Add(b.period))
+	})
+	if idx < 0 {
+		return nil, nil
+	}
+	return b.remove(idx)
+}
+
+// flushOldest returns the oldest pending batch regardless of its size and age.
+func (b *offsetGroupBatcher) flushOldest() (service.MessageBatch, service.AckFunc) {
+	if len(b.pending) == 0 {
+		return nil, nil
+	}
+	return b.remove(0)
+}
+
+// nextDeadline returns the time at which the oldest pending batch must be flushed.
+func (b *offsetGroupBatcher) nextDeadline() (time.Time, bool) {
+	if len(b.pending) == 0 {
+		return time.Time{}, false
+	}
+	return b.pending[0].created.Add(b.period), true
+}
+
+func (b *offsetGroupBatcher) remove(idx int) (service.MessageBatch, service.AckFunc) {
+	gb := b.pending[idx]
+	b.pending = slices.Delete(b.pending, idx, idx+1)
+	return gb.msgs, func(ctx context.Context, err error) error {
+		var errs []error
+		for _, s := range gb.sources {
+			if ackErr := s.done(ctx, err); ackErr != nil {
+				errs = append(errs, ackErr)
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// sharedAck acknowledges a batch once all of the batches which its messages were split into have been acknowledged.
+type sharedAck struct {
+	mu      sync.Mutex
+	pending int
+	err     error
+	ack     service.AckFunc
+}
+
+func (s *sharedAck) done(ctx context.Context, err error) error {
+	s.mu.Lock()
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+	s.pending--
+	remaining, res := s.pending, s.err
+	s.mu.Unlock()
+
+	if remaining > 0 {
+		return nil
 	}
+	return s.ack(ctx, res)
 }
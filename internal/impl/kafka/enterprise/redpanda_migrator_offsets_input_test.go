@@ -0,0 +1,504 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+func TestRedpandaMigratorOffsetsInputGetKeyAndOffset(t *testing.T) {
+	excludedTopics, err := newTopicMatcher([]string{`.*\.DLQ$`}, true)
+	require.NoError(t, err)
+	rmoi := redpandaMigratorOffsetsInput{
+		topicPatterns:  []*regexp.Regexp{regexp.MustCompile("^foo")},
+		excludedTopics: excludedTopics,
+		mgr:            service.MockResources(),
+	}
+
+	offsetCommitKey := func(topic string) []byte {
+		key := kmsg.NewOffsetCommitKey()
+		key.Version = 1
+		key.Group = "foobar"
+		key.Topic = topic
+		key.Partition = 3
+		return key.AppendTo(nil)
+	}
+
+	offsetCommitValue := kmsg.NewOffsetCommitValue()
+	offsetCommitValue.Version = 3
+	offsetCommitValue.Offset = 42
+	offsetCommitValue.Metadata = "meta"
+
+	groupMetadataKey := kmsg.NewGroupMetadataKey()
+	groupMetadataKey.Version = 2
+	groupMetadataKey.Group = "foobar"
+
+	groupMetadataValue := kmsg.NewGroupMetadataValue()
+	groupMetadataValue.Version = 3
+	groupMetadataValue.ProtocolType = "consumer"
+
+	tests := []struct {
+		name        string
+		key         []byte
+		value       []byte
+		ok          bool
+		isTombstone bool
+	}{
+		{
+			name:  "offset commit",
+			key:   offsetCommitKey("foo"),
+			value: offsetCommitValue.AppendTo(nil),
+			ok:    true,
+		},
+		{
+			name:        "offset commit tombstone",
+			key:         offsetCommitKey("foo"),
+			ok:          true,
+			isTombstone: true,
+		},
+		{
+			name:  "offset commit for another topic",
+			key:   offsetCommitKey("bar"),
+			value: offsetCommitValue.AppendTo(nil),
+		},
+		{
+			name:  "offset commit for an excluded topic",
+			key:   offsetCommitKey("foo.DLQ"),
+			value: offsetCommitValue.AppendTo(nil),
+		},
+		{
+			name:  "group metadata",
+			key:   groupMetadataKey.AppendTo(nil),
+			value: groupMetadataValue.AppendTo(nil),
+		},
+		{
+			name: "group metadata tombstone",
+			key:  groupMetadataKey.AppendTo(nil),
+		},
+		{
+			name:  "invalid key",
+			key:   []byte{0},
+			value: offsetCommitValue.AppendTo(nil),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg := service.NewMessage(test.value)
+			msg.MetaSetMut("kafka_key", test.key)
+
+			key, offset, isTombstone, ok := rmoi.getKeyAndOffset(msg)
+			require.Equal(t, test.ok, ok)
+			if !ok {
+				return
+			}
+
+			assert.Equal(t, test.isTombstone, isTombstone)
+			assert.Equal(t, "foobar", key.Group)
+			assert.Equal(t, "foo", key.Topic)
+			assert.Equal(t, int32(3), key.Partition)
+			if !isTombstone {
+				assert.Equal(t, int64(42), offset.Offset)
+				assert.Equal(t, "meta", offset.Metadata)
+			}
+		})
+	}
+}
+
+func TestRedpandaMigratorOffsetsInputLeaderEpoch(t *testing.T) {
+	rmoi := redpandaMigratorOffsetsInput{
+		topics: []string{"foo"},
+		mgr:    service.MockResources(),
+	}
+
+	key := kmsg.NewOffsetCommitKey()
+	key.Version = 1
+	key.Group = "foobar"
+	key.Topic = "foo"
+	key.Partition = 3
+
+	tests := []struct {
+		version       int16
+		expectedEpoch int32
+	}{
+		{version: 0, expectedEpoch: -1},
+		{version: 1, expectedEpoch: -1},
+		{version: 2, expectedEpoch: -1},
+		{version: 3, expectedEpoch: 7},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("version %d", test.version), func(t *testing.T) {
+			value := kmsg.NewOffsetCommitValue()
+			value.Version = test.version
+			value.Offset = 42
+			value.LeaderEpoch = 7
+			value.Metadata = "meta"
+			value.CommitTimestamp = 1000
+			value.ExpireTimestamp = 2000
+
+			msg := service.NewMessage(value.AppendTo(nil))
+			msg.MetaSetMut("kafka_key", key.AppendTo(nil))
+
+			_, offset, isTombstone, ok := rmoi.getKeyAndOffset(msg)
+			require.True(t, ok)
+			require.False(t, isTombstone)
+			assert.Equal(t, test.version, offset.Version)
+			assert.Equal(t, int64(42), offset.Offset)
+			assert.Equal(t, "meta", offset.Metadata)
+			assert.Equal(t, test.expectedEpoch, offsetCommitLeaderEpoch(offset))
+		})
+	}
+}
+
+func TestMarkTransactionalRecord(t *testing.T) {
+	msg := service.NewMessage(nil)
+	markTransactionalRecord(kgo.StringRecord("foo"), msg)
+	v, ok := msg.MetaGetMut("kafka_offset_transactional")
+	require.True(t, ok)
+	assert.Equal(t, false, v)
+}
+
+func TestOffsetGroupBatcher(t *testing.T) {
+	msg := func(group, content string) *service.Message {
+		m := service.NewMessage([]byte(content))
+		m.MetaSetMut("kafka_offset_group", group)
+		return m
+	}
+	contents := func(t *testing.T, batch service.MessageBatch) []string {
+		var res []string
+		for _, m := range batch {
+			b, err := m.AsBytes()
+			require.NoError(t, err)
+			res = append(res, string(b))
+		}
+		return res
+	}
+
+	var acked []error
+	ackFn := func(_ context.Context, err error) error {
+		acked = append(acked, err)
+		return nil
+	}
+
+	b := newOffsetGroupBatcher(2, time.Minute)
+	_, ok := b.nextDeadline()
+	require.False(t, ok)
+
+	b.add(service.MessageBatch{msg("a", "a1"), msg("b", "b1"), msg("a", "a2"), msg("a", "a3")}, ackFn)
+	b.add(service.MessageBatch{msg("b", "b2")}, ackFn)
+
+	deadline, ok := b.nextDeadline()
+	require.True(t, ok)
+
+	// Full batches are flushed first, in the order they were created.
+	batch, ackA1 := b.flushReady(time.Now())
+	assert.Equal(t, []string{"a1", "a2"}, contents(t, batch))
+	batch, ackB := b.flushReady(time.Now())
+	assert.Equal(t, []string{"b1", "b2"}, contents(t, batch))
+	batch, _ = b.flushReady(time.Now())
+	assert.Nil(t, batch)
+
+	// Partial batches are flushed once their period has elapsed.
+	batch, ackA3 := b.flushReady(deadline)
+	assert.Equal(t, []string{"a3"}, contents(t, batch))
+	_, ok = b.nextDeadline()
+	assert.False(t, ok)
+
+	// The source batches are acknowledged once all the batches containing their messages are acknowledged.
+	require.NoError(t, ackB(context.Background(), nil))
+	assert.Equal(t, []error{nil}, acked)
+	errNack := errors.New("nack")
+	require.NoError(t, ackA1(context.Background(), errNack))
+	assert.Equal(t, []error{nil}, acked)
+	require.NoError(t, ackA3(context.Background(), nil))
+	assert.Equal(t, []error{nil, errNack}, acked)
+
+	// Pending batches can be flushed early.
+	b.add(service.MessageBatch{msg("c", "c1")}, ackFn)
+	batch, _ = b.flushOldest()
+	assert.Equal(t, []string{"c1"}, contents(t, batch))
+	batch, _ = b.flushOldest()
+	assert.Nil(t, batch)
+}
+
+func TestOffsetsCheckpointerTrack(t *testing.T) {
+	res := service.MockResources(service.MockResourcesOptAddCache("checkpoints"))
+	c := newOffsetsCheckpointer(res, "checkpoints", "rmoi")
+
+	msg := func(partition, offset int) *service.Message {
+		m := service.NewMessage(nil)
+		m.MetaSetMut("kafka_partition", partition)
+		m.MetaSetMut("kafka_offset", offset)
+		return m
+	}
+	checkpointOf := func(partition int32) string {
+		var b []byte
+		var getErr error
+		require.NoError(t, res.AccessCache(context.Background(), "checkpoints", func(cache service.Cache) {
+			b, getErr = cache.Get(context.Background(), c.key(partition))
+		}))
+		if errors.Is(getErr, service.ErrKeyNotFound) {
+			return ""
+		}
+		require.NoError(t, getErr)
+		return string(b)
+	}
+
+	var acked int
+	ackFn := func(context.Context, error) error {
+		acked++
+		return nil
+	}
+
+	ack1 := c.track(service.MessageBatch{msg(0, 10), msg(0, 11), msg(1, 5)}, ackFn)
+	ack2 := c.track(service.MessageBatch{msg(0, 12)}, ackFn)
+	ack3 := c.track(service.MessageBatch{msg(1, 6)}, ackFn)
+
+	// The checkpoint doesn't advance past messages which haven't been acknowledged yet.
+	require.NoError(t, ack2(context.Background(), nil))
+	assert.Equal(t, "", checkpointOf(0))
+
+	require.NoError(t, ack1(context.Background(), nil))
+	assert.Equal(t, "12", checkpointOf(0))
+	assert.Equal(t, "5", checkpointOf(1))
+
+	// Rejected messages are never checkpointed.
+	require.NoError(t, ack3(context.Background(), errors.New("nack")))
+	assert.Equal(t, "5", checkpointOf(1))
+	assert.Equal(t, 3, acked)
+
+	// A nil checkpointer doesn't wrap the ack function.
+	var nilCheckpointer *offsetsCheckpointer
+	require.NoError(t, nilCheckpointer.track(service.MessageBatch{msg(0, 13)}, ackFn)(context.Background(), nil))
+	assert.Equal(t, 4, acked)
+}
+
+func TestRedpandaMigratorOffsetsInputCheckpointLinting(t *testing.T) {
+	configTests := []struct {
+		name        string
+		config      string
+		errContains string
+	}{
+		{
+			name: "checkpoint cache",
+			config: `
+redpanda_migrator_offsets:
+  seed_brokers: [ localhost:9092 ]
+  topics: [ foo ]
+  checkpoint_cache: checkpoints
+  start_from: beginning
+`,
+		},
+		{
+			name: "consumer group and checkpoint cache",
+			config: `
+redpanda_migrator_offsets:
+  seed_brokers: [ localhost:9092 ]
+  topics: [ foo ]
+  consumer_group: migrator
+  checkpoint_cache: checkpoints
+`,
+			errContains: "only one of consumer_group and checkpoint_cache can be set",
+		},
+		{
+			name: "consumer group and start from beginning",
+			config: `
+redpanda_migrator_offsets:
+  seed_brokers: [ localhost:9092 ]
+  topics: [ foo ]
+  consumer_group: migrator
+  start_from: beginning
+`,
+			errContains: "start_from cannot be set to beginning when a consumer_group is set",
+		},
+		{
+			name: "passthrough mode",
+			config: `
+redpanda_migrator_offsets:
+  seed_brokers: [ localhost:9092 ]
+  topics: [ foo ]
+  mode: passthrough
+`,
+		},
+		{
+			name: "passthrough mode with json payload",
+			config: `
+redpanda_migrator_offsets:
+  seed_brokers: [ localhost:9092 ]
+  topics: [ foo ]
+  mode: passthrough
+  payload_format: json
+`,
+			errContains: "payload_format cannot be json when mode is passthrough",
+		},
+	}
+
+	env := service.NewEnvironment()
+	for _, test := range configTests {
+		t.Run(test.name, func(t *testing.T) {
+			strm := env.NewStreamBuilder()
+			err := strm.AddInputYAML(test.config)
+			if test.errContains == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.errContains)
+			}
+		})
+	}
+}
+
+func TestRedpandaMigratorOffsetsInputJSONPayload(t *testing.T) {
+	key := kmsg.NewOffsetCommitKey()
+	key.Version = 1
+	key.Group = "foobar"
+	key.Topic = "foo"
+	key.Partition = 3
+
+	offsetV1 := kmsg.NewOffsetCommitValue()
+	offsetV1.Version = 1
+	offsetV1.Offset = 42
+	offsetV1.Metadata = "meta"
+	offsetV1.CommitTimestamp = 1741000000000
+
+	offsetV3 := kmsg.NewOffsetCommitValue()
+	offsetV3.Version = 3
+	offsetV3.Offset = 1337
+	offsetV3.LeaderEpoch = 7
+	offsetV3.CommitTimestamp = 1741000001000
+
+	docs := [][]byte{
+		offsetCommitJSON(key, offsetV1, false),
+		offsetCommitJSON(key, offsetV3, false),
+		offsetCommitJSON(key, kmsg.OffsetCommitValue{}, true),
+	}
+
+	expected, err := os.ReadFile("testdata/redpanda_migrator_offsets_json.golden")
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(bytes.Join(docs, []byte("\n")))+"\n")
+}
+
+func TestRedpandaMigratorOffsetsInputModes(t *testing.T) {
+	offsetCommitKey := func(topic string) []byte {
+		key := kmsg.NewOffsetCommitKey()
+		key.Version = 1
+		key.Group = "foobar"
+		key.Topic = topic
+		key.Partition = 3
+		return key.AppendTo(nil)
+	}
+
+	groupMetadataKey := kmsg.NewGroupMetadataKey()
+	groupMetadataKey.Version = 2
+	groupMetadataKey.Group = "foobar"
+
+	groupMetadataValue := kmsg.NewGroupMetadataValue()
+	groupMetadataValue.Version = 3
+	groupMetadataValue.ProtocolType = "consumer"
+
+	type record struct {
+		name  string
+		key   []byte
+		value []byte
+	}
+	records := []record{
+		{name: "offset commit tombstone", key: offsetCommitKey("foo")},
+		{name: "group metadata", key: groupMetadataKey.AppendTo(nil), value: groupMetadataValue.AppendTo(nil)},
+		{name: "group metadata tombstone", key: groupMetadataKey.AppendTo(nil)},
+		// The key of a transaction marker is its version followed by its type.
+		{name: "transaction marker", key: []byte{0, 0, 0, 1}, value: []byte{0, 0, 0, 0, 0, 0}},
+		{name: "unknown key version", key: []byte{0, 42, 0, 3, 'f', 'o', 'o'}, value: []byte("bar")},
+		{name: "offset commit for another topic", key: offsetCommitKey("bar")},
+	}
+
+	newBatch := func() service.MessageBatch {
+		var batch service.MessageBatch
+		for _, r := range records {
+			msg := service.NewMessage(r.value)
+			msg.MetaSetMut("record", r.name)
+			msg.MetaSetMut("kafka_key", r.key)
+			msg.MetaSetMut("kafka_tombstone_message", r.value == nil)
+			batch = append(batch, msg)
+		}
+		return batch
+	}
+
+	tests := []struct {
+		mode            string
+		expectedRecords []string
+		expectedDecoded []any
+	}{
+		{
+			mode:            rmoiModeDecode,
+			expectedRecords: []string{"offset commit tombstone"},
+			expectedDecoded: []any{nil},
+		},
+		{
+			mode:            rmoiModePassthrough,
+			expectedRecords: []string{"offset commit tombstone", "group metadata", "group metadata tombstone", "transaction marker", "unknown key version", "offset commit for another topic"},
+			expectedDecoded: []any{nil, nil, nil, nil, nil, nil},
+		},
+		{
+			mode:            rmoiModeBoth,
+			expectedRecords: []string{"offset commit tombstone", "group metadata", "group metadata tombstone", "transaction marker", "unknown key version", "offset commit for another topic"},
+			expectedDecoded: []any{true, false, false, false, false, false},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.mode, func(t *testing.T) {
+			rmoi := redpandaMigratorOffsetsInput{
+				topics:         []string{"foo"},
+				mode:           test.mode,
+				decodedCommits: service.MockResources().Metrics().NewCounter("decoded", "partition"),
+				mgr:            service.MockResources(),
+			}
+
+			batch, err := rmoi.decodeOffsets(context.Background(), newBatch())
+			require.NoError(t, err)
+			require.Len(t, batch, len(test.expectedRecords))
+
+			for i, msg := range batch {
+				name, _ := msg.MetaGet("record")
+				assert.Equal(t, test.expectedRecords[i], name)
+
+				var decoded any
+				if v, ok := msg.MetaGetMut("kafka_offset_decoded"); ok {
+					decoded = v
+				}
+				assert.Equal(t, test.expectedDecoded[i], decoded, name)
+
+				// Only decoded messages have the offset commit metadata fields and other messages are left untouched.
+				group, hasGroup := msg.MetaGetMut("kafka_offset_group")
+				if decoded == true || test.mode == rmoiModeDecode {
+					assert.Equal(t, "foobar", group)
+					continue
+				}
+				assert.False(t, hasGroup, name)
+				b, err := msg.AsBytes()
+				require.NoError(t, err)
+				assert.Equal(t, records[i].value, b, name)
+			}
+		})
+	}
+}
@@ -10,6 +10,8 @@ package enterprise
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"slices"
 	"strconv"
@@ -18,8 +20,10 @@ import (
 
 	"github.com/cenkalti/backoff/v4"
 	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
 	"github.com/twmb/franz-go/pkg/kgo"
 
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
 	"github.com/redpanda-data/benthos/v4/public/service"
 
 	"github.com/redpanda-data/connect/v4/internal/impl/kafka"
@@ -33,21 +37,166 @@ const (
 	rmooFieldOffsetPartition       = "offset_partition"
 	rmooFieldOffsetCommitTimestamp = "offset_commit_timestamp"
 	rmooFieldOffsetMetadata        = "offset_metadata"
+	rmooFieldOffsetLeaderEpoch     = "offset_leader_epoch"
+	rmooFieldResetLeaderEpoch      = "reset_leader_epoch"
 	rmooFieldIsHighWatermark       = "is_high_watermark"
+	rmooFieldIsTombstone           = "is_tombstone"
+	rmooFieldTopicPrefix           = "topic_prefix"
+	rmooFieldGroupMapping          = "group_mapping"
+	rmooFieldGroupRenames          = "group_renames"
+	rmooFieldAllowRewind           = "allow_rewind"
+	rmooFieldDryRun                = "dry_run"
+	rmooFieldAuditTopic            = "audit_topic"
+	rmooFieldInputResource         = "input_resource"
+	rmooFieldOnPartitionMismatch   = "on_partition_mismatch"
+	rmooFieldCommitInterval        = "commit_interval"
+	rmooFieldMaxOffsetsPerCommit   = "max_offsets_per_commit"
 
 	// Deprecated fields
 	rmooFieldKafkaKey    = "kafka_key"
 	rmooFieldMaxInFlight = "max_in_flight"
 )
 
+// Metadata keys of the commit result which is added to each message before it's acknowledged.
+const (
+	offsetCommitResultMetaKey    = "offset_commit_result"
+	offsetCommitGroupMetaKey     = "offset_commit_group"
+	offsetCommitTopicMetaKey     = "offset_commit_topic"
+	offsetCommitPartitionMetaKey = "offset_commit_partition"
+	offsetCommitOffsetMetaKey    = "offset_commit_offset"
+	offsetCommitCurrentMetaKey   = "offset_commit_current_offset"
+	offsetCommitTimestampMetaKey = "offset_commit_timestamp"
+)
+
+// Values of the offset_commit_result metadata.
+const (
+	offsetCommitResultCommitted           = "committed"
+	offsetCommitResultDeleted             = "deleted"
+	offsetCommitResultDryRun              = "dry_run"
+	offsetCommitResultSkippedGroupMapping = "skipped_group_mapping"
+	offsetCommitResultSkippedRewind       = "skipped_rewind"
+	offsetCommitResultSkippedMissingGroup = "skipped_missing_group"
+	offsetCommitResultSkippedMissingTopic = "skipped_missing_topic"
+	offsetCommitResultSkippedMismatch     = "skipped_partition_mismatch"
+)
+
+// Values of the on_partition_mismatch field.
+const (
+	partitionMismatchFail               = "fail"
+	partitionMismatchTimestampTranslate = "timestamp_translate"
+	partitionMismatchSkip               = "skip"
+)
+
+// partitionCountsCacheTTL is how long the partition counts of a topic are cached, so that partitions which are added to
+// either topic are eventually noticed.
+const partitionCountsCacheTTL = time.Minute
+
+const (
+	// offsetCommitAuditRecordVersion is the version of the schema of the audit records.
+	offsetCommitAuditRecordVersion = 1
+	// offsetCommitAuditProduceTimeout bounds the time an offset update waits for its audit record to be produced.
+	offsetCommitAuditProduceTimeout = 10 * time.Second
+)
+
 func redpandaMigratorOffsetsOutputConfig() *service.ConfigSpec {
 	return service.NewConfigSpec().
 		Beta().
 		Categories("Services").
 		Version("4.37.0").
 		Summary("Redpanda Migrator consumer group offsets output using the https://github.com/twmb/franz-go[Franz Kafka client library^].").
-		Description("This output can be used in combination with the `kafka_franz` input that is configured to read the `__consumer_offsets` topic.").
-		Fields(redpandaMigratorOffsetsOutputConfigFields()...)
+		Description(`This output can be used in combination with the ` + "`kafka_franz`" + ` input that is configured to read the ` + "`__consumer_offsets`" + ` topic.
+
+Consumer groups can be renamed in the destination cluster with either the ` + "`group_mapping`" + ` or the ` + "`group_renames`" + ` field.
+Offsets are skipped when the mapping deletes the group or returns an empty string, as well as when ` + "`group_renames`" + `
+maps the group to an empty string.
+
+Committed offsets are never moved backwards: before committing an offset, the offset which is currently committed by the
+destination group for the same topic partition is fetched and the new offset is skipped when it's lower, for example
+because consumers have already started to consume from the destination cluster during a phased cutover. This can be
+disabled with the ` + "`allow_rewind`" + ` field.
+
+When ` + "`dry_run`" + ` is enabled, the offsets are translated against the destination cluster without being committed or
+deleted, so that the offset translation can be validated safely.
+
+== Partition count mismatches
+
+Offsets are committed to the destination partition with the same number as the source partition, which is meaningless
+when the destination topic doesn't have as many partitions as the source topic, for example because it already existed.
+When ` + "`input_resource`" + ` is set, the partition counts of both topics are compared and cached for a minute, and the
+offsets of topics whose partition counts differ are handled according to the ` + "`on_partition_mismatch`" + ` field:
+
+- ` + "`fail`" + `: The offset update fails with an error which describes the mismatch.
+- ` + "`timestamp_translate`" + `: The offset of the first record at or after the timestamp of the source commit is committed
+for every destination partition, or its high watermark when it has no such record, without a leader epoch. Since the
+commits of all the source partitions apply to every destination partition, committed offsets which don't move forward are
+skipped like any other rewind unless ` + "`allow_rewind`" + ` is enabled. The result of each destination partition is
+audited and the metadata of the message describes the last one. The offsets of all the destination partitions are listed
+with a single request per source commit, and a tombstone only deletes the offsets of the destination partition with the
+same number as the source partition.
+- ` + "`skip`" + `: The offset update is skipped with a warning.
+
+== Commit coalescing
+
+Offsets are accumulated for up to ` + "`commit_interval`" + ` or until ` + "`max_offsets_per_commit`" + ` offsets were
+read, after which the offsets of each destination group are committed with a single request. Only the last offset of
+each topic partition is committed, the offsets which precede it are coalesced into that request. A message is only
+acknowledged once the commit which contains its offset succeeded, and the accumulated offsets are committed when the
+output is closed. Offsets are never committed out of order: the deletion of the offsets of a group first commits the
+offsets of that group which were accumulated before it.
+
+== Commit results
+
+Before a message is acknowledged, the result of its offset update is added to its metadata:
+
+- ` + "`offset_commit_result`" + `: One of ` + "`committed`" + `, ` + "`deleted`" + `, ` + "`dry_run`" + `, ` + "`skipped_group_mapping`" + `, ` + "`skipped_rewind`" + `, ` + "`skipped_missing_group`" + `, ` + "`skipped_missing_topic`" + ` or ` + "`skipped_partition_mismatch`" + `. The missing group and topic results are set when a deleted offset doesn't exist in the destination cluster.
+- ` + "`offset_commit_group`" + `, ` + "`offset_commit_topic`" + ` and ` + "`offset_commit_partition`" + `: The destination consumer group, topic and partition. These are not set when the offset is skipped by the group mapping.
+- ` + "`offset_commit_offset`" + `: The translated destination offset, which is not set for deleted offsets.
+- ` + "`offset_commit_current_offset`" + `: The offset which was committed by the destination group before the update, when it was fetched and exists.
+- ` + "`offset_commit_timestamp`" + `: The time of the update as a unix timestamp in milliseconds.
+
+When ` + "`audit_topic`" + ` is set, a JSON audit record of each offset update which isn't a dry run or skipped by the group
+mapping is produced to that topic in the destination cluster, keyed by the destination group. The record has the
+following schema, which is versioned and to which fields are only ever added:
+
+[source,json]
+----
+{
+  "version": 1,
+  "result": "committed",
+  "source_group": "prod-orders-service",
+  "source_topic": "orders",
+  "group": "orders-service",
+  "topic": "orders",
+  "partition": 0,
+  "offset": 1042,
+  "previous_offset": 1000,
+  "source_commit_timestamp": 1700000000000,
+  "timestamp": 1700000000123
+}
+----
+
+The ` + "`offset`" + ` is -1 for deleted offsets and the ` + "`previous_offset`" + ` is -1 when no offset was committed by the
+destination group or when it wasn't fetched because ` + "`allow_rewind`" + ` is enabled. Failing to produce an audit record is
+logged and counted by the ` + "`redpanda_migrator_offsets_audit_failures`" + ` metric without failing the offset update.
+
+== Metrics
+
+This output emits the following metrics:
+
+- ` + "`redpanda_migrator_offsets_committed`" + `: A counter of the offsets committed or deleted in the destination cluster, labelled by ` + "`source_group`" + ` and ` + "`destination_group`" + `.
+- ` + "`redpanda_migrator_offsets_skipped`" + `: A counter of the offsets skipped by the group mapping, labelled by ` + "`source_group`" + `.
+- ` + "`redpanda_migrator_offsets_rewinds_skipped`" + `: A counter of the offsets skipped because they are lower than the offsets committed in the destination cluster, labelled by ` + "`source_group`" + ` and ` + "`destination_group`" + `.
+- ` + "`redpanda_migrator_offsets_dry_run`" + `: A counter of the offsets which would have been committed or deleted when ` + "`dry_run`" + ` is enabled, labelled by ` + "`source_group`" + ` and ` + "`destination_group`" + `.
+- ` + "`redpanda_migrator_offsets_audit_failures`" + `: A counter of the audit records which failed to be produced to the ` + "`audit_topic`" + `.
+- ` + "`redpanda_migrator_offsets_partition_mismatches_skipped`" + `: A counter of the offsets skipped because the partition counts of their source and destination topics differ, labelled by ` + "`source_group`" + ` and ` + "`destination_group`" + `.
+- ` + "`redpanda_migrator_offsets_commit_requests`" + `: A counter of the commit requests sent to the destination cluster, labelled by ` + "`destination_group`" + `.
+- ` + "`redpanda_migrator_offsets_coalesced`" + `: A counter of the offsets which were superseded by a later offset of the same topic partition within a commit, labelled by ` + "`destination_group`" + `.
+- ` + "`redpanda_migrator_offsets_commit_latency_ns`" + `: A timer of the commit requests, labelled by ` + "`destination_group`" + `.
+`).
+		Fields(redpandaMigratorOffsetsOutputConfigFields()...).
+		LintRule(`root = if this.exists("` + rmooFieldGroupMapping + `") && this.` + rmooFieldGroupRenames + `.or({}).length() > 0 {
+  ["only one of ` + rmooFieldGroupMapping + ` and ` + rmooFieldGroupRenames + ` can be set"]
+}`)
 }
 
 // redpandaMigratorOffsetsOutputConfigFields returns the full suite of config fields for a redpanda_migrator_offsets output using the
@@ -66,8 +215,63 @@ func redpandaMigratorOffsetsOutputConfigFields() []*service.ConfigField {
 				Description("Kafka offset commit timestamp.").Default("${! @kafka_offset_commit_timestamp }"),
 			service.NewInterpolatedStringField(rmooFieldOffsetMetadata).
 				Description("Kafka offset metadata value.").Default(`${! @kafka_offset_metadata }`),
+			service.NewInterpolatedStringField(rmooFieldOffsetLeaderEpoch).
+				Description("The leader epoch to commit the offset with. An empty value or `-1` commits the offset without a leader epoch.").Default(`${! @kafka_offset_leader_epoch | -1 }`).Advanced(),
+			service.NewBoolField(rmooFieldResetLeaderEpoch).
+				Description("Commit all offsets without a leader epoch, regardless of the value of `offset_leader_epoch`. This should be enabled when the leader epochs of the source cluster are meaningless in the destination cluster, which causes consumers to fail the leader epoch validation of their committed offsets.").
+				Default(false).
+				Advanced(),
 			service.NewInterpolatedStringField(rmooFieldIsHighWatermark).
 				Description("Indicates if the update represents the high watermark of the Kafka topic partition.").Default(`${! @kafka_is_high_watermark }`),
+			service.NewInterpolatedStringField(rmooFieldIsTombstone).
+				Description("Indicates if the committed offset for the Kafka topic partition was deleted from the consumer group, in which case it is also deleted from the destination cluster.").Default(`${! @kafka_tombstone_message | false }`).Advanced(),
+			service.NewStringField(rmooFieldTopicPrefix).
+				Description("A prefix to prepend to the offset topic before committing offsets in the destination cluster. This should match the `topic_prefix` of the `redpanda_migrator` output which writes the topic data.").
+				Example("clusterA.").
+				Default("").
+				Advanced(),
+			service.NewBloblangField(rmooFieldGroupMapping).
+				Description("An optional xref:guides:bloblang/about.adoc[Bloblang mapping] which receives an object with the `group` and `topic` of each offset, as read from the source cluster, and returns the name of the consumer group to use in the destination cluster. Offsets are skipped when the mapping deletes the group or returns an empty string.").
+				Example(`root = this.group.trim_prefix("prod-")`).
+				Example(`root = if this.topic.has_prefix("_") { deleted() } else { this.group }`).
+				Optional().
+				Advanced(),
+			service.NewStringMapField(rmooFieldGroupRenames).
+				Description("A map of source consumer group names to the names to use in the destination cluster. Groups which are not listed keep their name and offsets of groups which are mapped to an empty string are skipped. This is a shorthand for simple `group_mapping` cases and cannot be combined with it.").
+				Example(map[string]any{"prod-orders-service": "orders-service", "prod-legacy-service": ""}).
+				Default(map[string]any{}).
+				Advanced(),
+			service.NewBoolField(rmooFieldAllowRewind).
+				Description("Commit offsets which are lower than the offsets currently committed by the consumer group in the destination cluster. By default, such offsets are skipped so that the committed offsets of groups which already consume from the destination cluster never move backwards.").
+				Default(false).
+				Advanced(),
+			service.NewBoolField(rmooFieldDryRun).
+				Description("Translate the offsets against the destination cluster without committing or deleting them. The offsets which would be committed are logged and counted by the `redpanda_migrator_offsets_dry_run` metric.").
+				Default(false).
+				Advanced(),
+			service.NewStringField(rmooFieldAuditTopic).
+				Description("An optional destination topic to which a JSON audit record of each offset update is produced with the client of the output. Failures are logged and counted without failing the offset update. See the commit results section for the schema of the records.").
+				Example("__redpanda_migrator_offsets_audit").
+				Default("").
+				Advanced(),
+			service.NewStringField(rmooFieldInputResource).
+				Description("The label of the `redpanda_migrator` input whose client is used to fetch the partition counts of the source topics, which are compared with the partition counts of the destination topics. Partition counts aren't compared when it's empty.").
+				Example("redpanda_migrator_input").
+				Default("").
+				Advanced(),
+			service.NewStringEnumField(rmooFieldOnPartitionMismatch, partitionMismatchFail, partitionMismatchTimestampTranslate, partitionMismatchSkip).
+				Description("How offsets are handled when the source and destination topics have different partition counts, which requires `input_resource` to be set. See the partition count mismatches section for details.").
+				Default(partitionMismatchFail).
+				Advanced(),
+			service.NewDurationField(rmooFieldCommitInterval).
+				Description("The maximum amount of time offsets are accumulated before the offsets of each destination group are committed with a single request. Set to `0s` in order to commit the offset of each message on its own.").
+				Default("1s").
+				Advanced(),
+			service.NewIntField(rmooFieldMaxOffsetsPerCommit).
+				Description("The maximum number of offsets which are accumulated before they are committed, regardless of `" + rmooFieldCommitInterval + "`.").
+				Default(100).
+				LintRule(`root = if this < 1 { ["` + rmooFieldMaxOffsetsPerCommit + ` must be at least 1"] }`).
+				Advanced(),
 
 			// Deprecated fields
 			service.NewInterpolatedStringField(rmooFieldKafkaKey).
@@ -82,9 +286,10 @@ func redpandaMigratorOffsetsOutputConfigFields() []*service.ConfigField {
 }
 
 func init() {
-	err := service.RegisterOutput("redpanda_migrator_offsets", redpandaMigratorOffsetsOutputConfig(),
+	err := service.RegisterBatchOutput("redpanda_migrator_offsets", redpandaMigratorOffsetsOutputConfig(),
 		func(conf *service.ParsedConfig, mgr *service.Resources) (
-			output service.Output,
+			output service.BatchOutput,
+			batchPolicy service.BatchPolicy,
 			maxInFlight int,
 			err error,
 		) {
@@ -92,8 +297,14 @@ func init() {
 				return
 			}
 
+			// Batches are committed one at a time, so that the offsets of a topic partition are never committed out
+			// of order.
 			maxInFlight = 1
 
+			if batchPolicy, err = offsetsCommitBatchPolicyFromParsed(conf); err != nil {
+				return
+			}
+
 			output, err = newRedpandaMigratorOffsetsWriterFromConfig(conf, mgr)
 			return
 		})
@@ -102,8 +313,39 @@ func init() {
 	}
 }
 
+// offsetsCommitBatchPolicyFromParsed returns the batch policy which accumulates the offsets that are committed
+// together.
+func offsetsCommitBatchPolicyFromParsed(conf *service.ParsedConfig) (service.BatchPolicy, error) {
+	interval, err := conf.FieldDuration(rmooFieldCommitInterval)
+	if err != nil {
+		return service.BatchPolicy{}, err
+	}
+	maxOffsets, err := conf.FieldInt(rmooFieldMaxOffsetsPerCommit)
+	if err != nil {
+		return service.BatchPolicy{}, err
+	}
+	if maxOffsets < 1 {
+		return service.BatchPolicy{}, fmt.Errorf("%s must be at least 1", rmooFieldMaxOffsetsPerCommit)
+	}
+	if interval <= 0 {
+		return service.BatchPolicy{Count: 1}, nil
+	}
+	return service.BatchPolicy{Count: maxOffsets, Period: interval.String()}, nil
+}
+
 //------------------------------------------------------------------------------
 
+// offsetsAdminClient is the subset of the kadm.Client API which is used to migrate consumer group offsets.
+type offsetsAdminClient interface {
+	ListTopics(ctx context.Context, topics ...string) (kadm.TopicDetails, error)
+	ListOffsetsAfterMilli(ctx context.Context, millisecond int64, topics ...string) (kadm.ListedOffsets, error)
+	ListEndOffsets(ctx context.Context, topics ...string) (kadm.ListedOffsets, error)
+	FetchOffsets(ctx context.Context, group string) (kadm.OffsetResponses, error)
+	CommitOffsets(ctx context.Context, group string, os kadm.Offsets) (kadm.OffsetResponses, error)
+	DeleteOffsets(ctx context.Context, group string, s kadm.TopicsSet) (kadm.DeleteOffsetsResponses, error)
+	Close()
+}
+
 // redpandaMigratorOffsetsWriter implements a Redpanda Migrator offsets writer using the franz-go library.
 type redpandaMigratorOffsetsWriter struct {
 	clientOpts            []kgo.Opt
@@ -112,11 +354,41 @@ type redpandaMigratorOffsetsWriter struct {
 	offsetPartition       *service.InterpolatedString
 	offsetCommitTimestamp *service.InterpolatedString
 	offsetMetadata        *service.InterpolatedString
+	offsetLeaderEpoch     *service.InterpolatedString
+	resetLeaderEpoch      bool
 	isHighWatermark       *service.InterpolatedString
+	isTombstone           *service.InterpolatedString
+	topicPrefix           string
+	groupMapper           *consumerGroupMapper
+	allowRewind           bool
+	dryRun                bool
+	auditTopic            string
+	onPartitionMismatch   string
 	backoffCtor           func() backoff.BackOff
 
+	// sourcePartitionCount returns the partition count of a source topic, it's nil when partition counts aren't
+	// compared. The partition counts of both topics are cached by source topic.
+	sourcePartitionCount func(ctx context.Context, topic string) (int, error)
+	partitionCounts      map[string]topicPartitionCounts
+
+	committedOffsets *service.MetricCounter
+	skippedOffsets   *service.MetricCounter
+	skippedRewinds   *service.MetricCounter
+	dryRunOffsets    *service.MetricCounter
+	auditFailures    *service.MetricCounter
+	skippedMismatch  *service.MetricCounter
+	commitRequests   *service.MetricCounter
+	coalescedOffsets *service.MetricCounter
+	commitLatency    *service.MetricTimer
+	status           *migrationStatus
+	events           *migrationEventPublisher
+
 	connMut sync.Mutex
-	client  *kadm.Client
+	client  offsetsAdminClient
+	produce func(ctx context.Context, record *kgo.Record) error
+	// offsetsForTimestamp lists the offsets of the first records of the given destination topic partitions at or
+	// after a timestamp, or their high watermarks when they have no such record.
+	offsetsForTimestamp func(ctx context.Context, topicPartitions map[string][]int32, ts time.Time) (map[string]map[int32]int64, error)
 
 	mgr *service.Resources
 }
@@ -124,7 +396,19 @@ type redpandaMigratorOffsetsWriter struct {
 // newRedpandaMigratorOffsetsWriterFromConfig attempts to instantiate a redpandaMigratorOffsetsWriter from a parsed config.
 func newRedpandaMigratorOffsetsWriterFromConfig(conf *service.ParsedConfig, mgr *service.Resources) (*redpandaMigratorOffsetsWriter, error) {
 	w := redpandaMigratorOffsetsWriter{
-		mgr: mgr,
+		committedOffsets: mgr.Metrics().NewCounter("redpanda_migrator_offsets_committed", "source_group", "destination_group"),
+		skippedOffsets:   mgr.Metrics().NewCounter("redpanda_migrator_offsets_skipped", "source_group"),
+		skippedRewinds:   mgr.Metrics().NewCounter("redpanda_migrator_offsets_rewinds_skipped", "source_group", "destination_group"),
+		dryRunOffsets:    mgr.Metrics().NewCounter("redpanda_migrator_offsets_dry_run", "source_group", "destination_group"),
+		auditFailures:    mgr.Metrics().NewCounter("redpanda_migrator_offsets_audit_failures"),
+		skippedMismatch:  mgr.Metrics().NewCounter("redpanda_migrator_offsets_partition_mismatches_skipped", "source_group", "destination_group"),
+		commitRequests:   mgr.Metrics().NewCounter("redpanda_migrator_offsets_commit_requests", "destination_group"),
+		coalescedOffsets: mgr.Metrics().NewCounter("redpanda_migrator_offsets_coalesced", "destination_group"),
+		commitLatency:    mgr.Metrics().NewTimer("redpanda_migrator_offsets_commit_latency_ns", "destination_group"),
+		partitionCounts:  map[string]topicPartitionCounts{},
+		status:           migrationStatusFor(mgr),
+		events:           migrationEventsFor(mgr),
+		mgr:              mgr,
 	}
 
 	clientDetails, err := kafka.FranzConnectionDetailsFromConfig(conf, mgr.Logger())
@@ -152,10 +436,75 @@ func newRedpandaMigratorOffsetsWriterFromConfig(conf *service.ParsedConfig, mgr
 		return nil, err
 	}
 
+	if w.offsetLeaderEpoch, err = conf.FieldInterpolatedString(rmooFieldOffsetLeaderEpoch); err != nil {
+		return nil, err
+	}
+
+	if w.resetLeaderEpoch, err = conf.FieldBool(rmooFieldResetLeaderEpoch); err != nil {
+		return nil, err
+	}
+
 	if w.isHighWatermark, err = conf.FieldInterpolatedString(rmooFieldIsHighWatermark); err != nil {
 		return nil, err
 	}
 
+	if w.isTombstone, err = conf.FieldInterpolatedString(rmooFieldIsTombstone); err != nil {
+		return nil, err
+	}
+
+	if w.topicPrefix, err = conf.FieldString(rmooFieldTopicPrefix); err != nil {
+		return nil, err
+	}
+
+	if conf.Contains(rmooFieldGroupMapping) {
+		w.groupMapper = &consumerGroupMapper{}
+		if w.groupMapper.mapping, err = conf.FieldBloblang(rmooFieldGroupMapping); err != nil {
+			return nil, err
+		}
+	}
+
+	var renames map[string]string
+	if renames, err = conf.FieldStringMap(rmooFieldGroupRenames); err != nil {
+		return nil, err
+	}
+	if len(renames) > 0 {
+		if w.groupMapper != nil {
+			return nil, fmt.Errorf("only one of %s and %s can be set", rmooFieldGroupMapping, rmooFieldGroupRenames)
+		}
+		w.groupMapper = &consumerGroupMapper{renames: renames}
+	}
+
+	if w.allowRewind, err = conf.FieldBool(rmooFieldAllowRewind); err != nil {
+		return nil, err
+	}
+
+	if w.dryRun, err = conf.FieldBool(rmooFieldDryRun); err != nil {
+		return nil, err
+	}
+
+	if w.auditTopic, err = conf.FieldString(rmooFieldAuditTopic); err != nil {
+		return nil, err
+	}
+
+	var inputResource string
+	if inputResource, err = conf.FieldString(rmooFieldInputResource); err != nil {
+		return nil, err
+	}
+	if w.onPartitionMismatch, err = conf.FieldString(rmooFieldOnPartitionMismatch); err != nil {
+		return nil, err
+	}
+	if inputResource != "" {
+		w.sourcePartitionCount = func(ctx context.Context, topic string) (count int, err error) {
+			err = kafka.FranzSharedClientUse(inputResource, mgr, func(details *kafka.FranzSharedClientInfo) error {
+				count, err = topicPartitionCount(ctx, kadm.NewClient(details.Client), topic)
+				return err
+			})
+			return
+		}
+	} else if w.onPartitionMismatch != partitionMismatchFail {
+		return nil, fmt.Errorf("%s requires %s to be set", rmooFieldOnPartitionMismatch, rmooFieldInputResource)
+	}
+
 	var clientOpts []kgo.Opt
 	if clientOpts, err = kafka.FranzProducerLimitsOptsFromConfig(conf); err != nil {
 		return nil, err
@@ -204,12 +553,21 @@ func (w *redpandaMigratorOffsetsWriter) Connect(ctx context.Context) error {
 
 	// The default kadm client timeout is 15s. Do we need to make this configurable?
 	w.client = kadm.NewClient(client)
+	w.offsetsForTimestamp = func(ctx context.Context, topicPartitions map[string][]int32, ts time.Time) (map[string]map[int32]int64, error) {
+		return kafka.OffsetsForTimestamp(ctx, client, topicPartitions, ts)
+	}
+	if w.auditTopic != "" {
+		w.produce = func(ctx context.Context, record *kgo.Record) error {
+			return client.ProduceSync(ctx, record).FirstErr()
+		}
+	}
 
 	return nil
 }
 
-// Write attempts to write a message to the output cluster.
-func (w *redpandaMigratorOffsetsWriter) Write(ctx context.Context, msg *service.Message) error {
+// WriteBatch translates the offsets of a batch of messages and commits the offsets of each destination group with a
+// single request. Messages whose offsets failed to be committed are rejected.
+func (w *redpandaMigratorOffsetsWriter) WriteBatch(ctx context.Context, batch service.MessageBatch) error {
 	w.connMut.Lock()
 	defer w.connMut.Unlock()
 
@@ -217,17 +575,70 @@ func (w *redpandaMigratorOffsetsWriter) Write(ctx context.Context, msg *service.
 		return service.ErrNotConnected
 	}
 
-	var topic string
-	var err error
-	if topic, err = w.offsetTopic.TryString(msg); err != nil {
+	var batchErr *service.BatchError
+	commits := &offsetCommitBatch{
+		failed: func(index int, err error) {
+			if batchErr == nil {
+				batchErr = service.NewBatchError(batch, err)
+			}
+			batchErr.Failed(index, err)
+		},
+	}
+	for i, msg := range batch {
+		if err := w.write(ctx, commits, i, msg); err != nil {
+			commits.failed(i, err)
+		}
+	}
+	for _, g := range commits.groups {
+		w.commitGroupOffsets(ctx, commits, g)
+	}
+
+	if batchErr != nil {
+		return batchErr
+	}
+	return nil
+}
+
+// write translates the offset of a message, which is added to the commits of its destination group unless it's
+// skipped, deleted or a dry run.
+func (w *redpandaMigratorOffsetsWriter) write(ctx context.Context, commits *offsetCommitBatch, index int, msg *service.Message) (err error) {
+	var sourceTopic string
+	if sourceTopic, err = w.offsetTopic.TryString(msg); err != nil {
 		return fmt.Errorf("failed to extract offset topic: %s", err)
 	}
+	topic := w.topicPrefix + sourceTopic
 
-	var group string
-	if group, err = w.offsetGroup.TryString(msg); err != nil {
+	var sourceGroup string
+	if sourceGroup, err = w.offsetGroup.TryString(msg); err != nil {
 		return fmt.Errorf("failed to extract offset group: %s", err)
 	}
 
+	var group string
+	if group, err = w.groupMapper.mapGroup(sourceGroup, sourceTopic); err != nil {
+		return fmt.Errorf("failed to map offset group %q for topic %q: %w", sourceGroup, sourceTopic, err)
+	}
+	if group == "" {
+		w.mgr.Logger().Debugf("Skipping offsets of source group %q for topic %q: group mapping returned an empty result", sourceGroup, sourceTopic)
+		w.skippedOffsets.Incr(1, sourceGroup)
+		w.reportResult(ctx, msg, offsetCommitResult{
+			result:        offsetCommitResultSkippedGroupMapping,
+			sourceGroup:   sourceGroup,
+			sourceTopic:   sourceTopic,
+			offset:        -1,
+			currentOffset: -1,
+		})
+		return nil
+	}
+	// The status of offsets which are added to the commits of the group is recorded once they are committed.
+	var queued bool
+	if !w.dryRun {
+		defer func() {
+			if !queued || err != nil {
+				w.status.recordGroupCommit(sourceTopic, sourceGroup, err)
+			}
+		}()
+	}
+
 	var partition int32
 	if p, err := w.offsetPartition.TryString(msg); err != nil {
 		return fmt.Errorf("failed to extract offset partition: %s", err)
@@ -239,6 +650,67 @@ func (w *redpandaMigratorOffsetsWriter) Write(ctx context.Context, msg *service.
 		partition = int32(i)
 	}
 
+	res := offsetCommitResult{
+		sourceGroup:   sourceGroup,
+		sourceTopic:   sourceTopic,
+		group:         group,
+		topic:         topic,
+		partition:     partition,
+		offset:        -1,
+		currentOffset: -1,
+	}
+
+	// The offsets of a source partition can't be committed to the destination partition with the same number when the
+	// partition counts of the topics differ.
+	var partitions []int32
+	if w.sourcePartitionCount != nil {
+		counts, err := w.fetchPartitionCounts(ctx, sourceTopic, topic)
+		if err != nil {
+			return fmt.Errorf("failed to compare the partition counts of topic %q: %w", sourceTopic, err)
+		}
+		if counts.source != counts.destination {
+			switch w.onPartitionMismatch {
+			case partitionMismatchSkip:
+				w.mgr.Logger().Warnf("Skipping offsets of source group %q for topic %q and partition %d: the topic has %d partitions in the source cluster but topic %q has %d in the destination cluster", sourceGroup, sourceTopic, partition, counts.source, topic, counts.destination)
+				w.skippedMismatch.Incr(1, sourceGroup, group)
+				res.result = offsetCommitResultSkippedMismatch
+				w.reportResult(ctx, msg, res)
+				return nil
+			case partitionMismatchTimestampTranslate:
+				partitions = make([]int32, counts.destination)
+				for i := range partitions {
+					partitions[i] = int32(i)
+				}
+			default:
+				return fmt.Errorf("topic %q has %d partitions in the source cluster but topic %q has %d in the destination cluster, the offsets of source group %q can't be copied by partition unless %s is set to %s or %s", sourceTopic, counts.source, topic, counts.destination, sourceGroup, rmooFieldOnPartitionMismatch, partitionMismatchTimestampTranslate, partitionMismatchSkip)
+			}
+		}
+	}
+
+	if data, err := w.isTombstone.TryString(msg); err != nil {
+		return fmt.Errorf("failed to extract is_tombstone: %w", err)
+	} else if isTombstone, err := strconv.ParseBool(data); err != nil {
+		return fmt.Errorf("failed to parse is_tombstone: %w", err)
+	} else if isTombstone {
+		if w.dryRun {
+			w.mgr.Logger().Infof("Dry run: would delete offsets of source group %q as destination group %q for topic %q and partition %d", sourceGroup, group, topic, partition)
+			w.dryRunOffsets.Incr(1, sourceGroup, group)
+			res.result = offsetCommitResultDryRun
+			w.reportResult(ctx, msg, res)
+			return nil
+		}
+		// The offsets of the group which were accumulated before the deletion are committed first.
+		if g := commits.take(group); g != nil {
+			w.commitGroupOffsets(ctx, commits, g)
+		}
+		if res.result, err = w.deleteConsumerOffset(ctx, group, topic, []int32{partition}); err != nil {
+			return fmt.Errorf("failed to delete offsets of source group %q as destination group %q: %w", sourceGroup, group, err)
+		}
+		w.committedOffsets.Incr(1, sourceGroup, group)
+		w.reportResult(ctx, msg, res)
+		return nil
+	}
+
 	var offsetCommitTimestamp int64
 	if t, err := w.offsetCommitTimestamp.TryString(msg); err != nil {
 		return fmt.Errorf("failed to extract offset commit timestamp: %s", err)
@@ -248,6 +720,7 @@ func (w *redpandaMigratorOffsetsWriter) Write(ctx context.Context, msg *service.
 			return fmt.Errorf("failed to parse offset partition: %s", err)
 		}
 	}
+	res.sourceCommitTimestamp = offsetCommitTimestamp
 
 	var offsetMetadata string
 	if w.offsetMetadata != nil {
@@ -256,6 +729,19 @@ func (w *redpandaMigratorOffsetsWriter) Write(ctx context.Context, msg *service.
 		}
 	}
 
+	leaderEpoch := int32(-1)
+	if !w.resetLeaderEpoch {
+		if data, err := w.offsetLeaderEpoch.TryString(msg); err != nil {
+			return fmt.Errorf("failed to extract offset leader epoch: %w", err)
+		} else if data != "" {
+			i, err := strconv.ParseInt(data, 10, 32)
+			if err != nil {
+				return fmt.Errorf("failed to parse offset leader epoch: %w", err)
+			}
+			leaderEpoch = int32(i)
+		}
+	}
+
 	isHighWatermark := false
 	if w.isHighWatermark != nil {
 		data, err := w.isHighWatermark.TryString(msg)
@@ -268,71 +754,529 @@ func (w *redpandaMigratorOffsetsWriter) Write(ctx context.Context, msg *service.
 		}
 	}
 
-	updateConsumerOffsets := func() error {
-		// ListOffsetsAfterMilli returns the topic's high watermark if the supplied timestamp is greater than the
-		// timestamps of all the records in the topic. It also sets the timestamp of the returned offset to -1 in this case.
-		listedOffsets, err := w.client.ListOffsetsAfterMilli(ctx, offsetCommitTimestamp, topic)
+	if partitions == nil {
+		queued, err = w.commitOffset(ctx, commits, index, msg, res, leaderEpoch, offsetMetadata, func() (int64, error) {
+			return translateCommittedOffset(ctx, w.client, topic, partition, offsetCommitTimestamp, isHighWatermark)
+		})
+		return err
+	}
+
+	// The offsets of all the destination partitions are listed at once. Unlike with translateCommittedOffset, a
+	// partition without a record at or after the timestamp isn't an error, since the source records may be in any
+	// partition, so it's committed at its high watermark.
+	offsets, listErr := w.offsetsForTimestamp(ctx, map[string][]int32{topic: partitions}, time.UnixMilli(offsetCommitTimestamp))
+	var partialErr *kafka.PartitionOffsetsError
+	if listErr != nil && !errors.As(listErr, &partialErr) {
+		return fmt.Errorf("failed to list offsets for topic %q and timestamp %d: %w", topic, offsetCommitTimestamp, listErr)
+	}
+	// The leader epoch of the source partition doesn't apply to the other partitions. The message is rejected when the
+	// offset of any partition can't be translated, so the offsets of its other partitions aren't committed either.
+	for _, p := range partitions {
+		res.partition = p
+		added, err := w.commitOffset(ctx, commits, index, msg, res, -1, offsetMetadata, func() (int64, error) {
+			offset, ok := offsets[topic][p]
+			if !ok && partialErr != nil {
+				return 0, fmt.Errorf("failed to list the offset of topic %q partition %d for timestamp %d: %w", topic, p, offsetCommitTimestamp, partialErr)
+			} else if !ok {
+				return 0, fmt.Errorf("failed to read the offset of topic %q partition %d for timestamp %d: lookup failed", topic, p, offsetCommitTimestamp)
+			}
+			return offset, nil
+		})
 		if err != nil {
-			return fmt.Errorf("failed to list offsets for topic %q and timestamp %d: %s", topic, offsetCommitTimestamp, err)
+			commits.drop(index)
+			return err
 		}
+		queued = queued || added
+	}
+	return nil
+}
 
-		w.mgr.Logger().Tracef("Listed offsets for topic %q and timestamp %d: %+v", topic, offsetCommitTimestamp, listedOffsets)
-
-		if err := listedOffsets.Error(); err != nil {
-			return fmt.Errorf("failed to read offsets for topic %q and timestamp %d: %s", topic, offsetCommitTimestamp, err)
+// commitOffset adds the offset of the destination topic partition of res which is returned by translate to the
+// commits of its group and returns true, unless it's lower than the offset committed by the destination group or than
+// the offset which precedes it in the commits, in which case its result is reported.
+func (w *redpandaMigratorOffsetsWriter) commitOffset(ctx context.Context, commits *offsetCommitBatch, index int, msg *service.Message, res offsetCommitResult, leaderEpoch int32, offsetMetadata string, translate func() (int64, error)) (bool, error) {
+	sourceGroup, group, topic, partition := res.sourceGroup, res.group, res.topic, res.partition
+	offsetCommitTimestamp := res.sourceCommitTimestamp
+
+	// The translated offset and the offset currently committed in the destination cluster, which is -1 when there's
+	// none or when it isn't fetched because rewinds are allowed.
+	var offset, currentOffset int64
+	updateConsumerOffsets := func() (err error) {
+		if offset, err = translate(); err != nil {
+			return err
 		}
 
-		offset, ok := listedOffsets.Lookup(topic, partition)
-		if !ok {
-			// This should never happen, but we check just in case.
-			return fmt.Errorf("record for timestamp %d not yet replicated to the destination topic %q partition %d: lookup failed", offsetCommitTimestamp, topic, partition)
-		}
-
-		if !isHighWatermark && offset.Timestamp == -1 {
-			// This can happen if we received an offset update, but the record which was read from the source cluster to
-			// trigger it has not been replicated to the destination cluster yet. In this case, we raise an error so the
-			// operation is retried.
-			return fmt.Errorf("record for timestamp %d not yet replicated to the destination topic %q partition %d", offsetCommitTimestamp, topic, partition)
-		}
-
-		// This is an optimisation to try and avoid unnecessary duplicates in the common case when the received offset
-		// update points to the high watermark of the source topic. In this special case, we check if the matching
-		// offset in the destination topic (returned by `ListOffsetsAfterMilli`) also points to the high watermark
-		// (indicated by having timestamp == -1). If it does, then we fetch the current high watermark of the
-		// destination topic and set the destination consumer offset to that value.
-		// Note: Even for compacted topics, the last record of the topic cannot be compacted, so it's safe to assume its
-		// offset will be one less than the high watermark.
-		if isHighWatermark && offset.Timestamp != -1 {
-			offsets, err := w.client.ListEndOffsets(ctx, topic)
-			if err != nil {
-				return fmt.Errorf("failed to list the high watermark for topic %q and partition %q (timestamp %d): %s", topic, partition, offsetCommitTimestamp, err)
-			}
+		w.mgr.Logger().Tracef("Translated offset of topic %q partition %d for timestamp %d to %d", topic, partition, offsetCommitTimestamp, offset)
 
-			highWatermark, ok := offsets.Lookup(topic, partition)
-			if !ok {
-				return fmt.Errorf("failed to read the high watermark for topic %q and partition %q (timestamp %d): %s", topic, partition, offsetCommitTimestamp, err)
+		currentOffset = -1
+		if !w.allowRewind {
+			if currentOffset, err = fetchCommittedOffset(ctx, w.client, group, topic, partition); err != nil {
+				return err
 			}
-			if highWatermark.Offset == offset.Offset+1 {
-				offset.Offset = highWatermark.Offset
+			// The accumulated offset is committed before this one.
+			if pending, ok := commits.pendingOffset(group, topic, partition); ok && pending > currentOffset {
+				currentOffset = pending
 			}
 		}
+		return nil
+	}
 
-		var offsets kadm.Offsets
-		offsets.Add(kadm.Offset{
-			Topic:       offset.Topic,
-			Partition:   offset.Partition,
-			At:          offset.Offset,
-			LeaderEpoch: offset.LeaderEpoch,
+	backOff := w.backoffCtor()
+	for {
+		// TODO: Maybe use `dispatch.TriggerSignal()` to consume new messages while `updateConsumerOffsets()` is running
+		// if this proves to be too slow.
+		err := updateConsumerOffsets()
+		if err == nil {
+			break
+		}
+
+		w.mgr.Logger().Debugf("Failed to translate offsets of source group %q as destination group %q: %s", sourceGroup, group, err)
+
+		wait := backOff.NextBackOff()
+		if wait == backoff.Stop {
+			return false, fmt.Errorf("failed to update consumer offsets of source group %q as destination group %q for topic %q and partition %d (timestamp %d): %s", sourceGroup, group, topic, partition, offsetCommitTimestamp, err)
+		}
+
+		time.Sleep(wait)
+	}
+
+	res.offset, res.currentOffset = offset, currentOffset
+
+	if offset < currentOffset {
+		w.mgr.Logger().Warnf("Skipping offset %d of source group %q as destination group %q for topic %q and partition %d (timestamp %d): it is lower than the committed offset %d", offset, sourceGroup, group, topic, partition, offsetCommitTimestamp, currentOffset)
+		w.skippedRewinds.Incr(1, sourceGroup, group)
+		res.result = offsetCommitResultSkippedRewind
+		w.reportResult(ctx, msg, res)
+		return false, nil
+	}
+
+	if w.dryRun {
+		w.mgr.Logger().Infof("Dry run: would commit offset %d of source group %q as destination group %q for topic %q and partition %d (timestamp %d)", offset, sourceGroup, group, topic, partition, offsetCommitTimestamp)
+		w.dryRunOffsets.Incr(1, sourceGroup, group)
+		res.result = offsetCommitResultDryRun
+		w.reportResult(ctx, msg, res)
+		return false, nil
+	}
+
+	commits.add(&pendingOffsetCommit{
+		index: index,
+		msg:   msg,
+		res:   res,
+		offset: kadm.Offset{
+			Topic:       topic,
+			Partition:   partition,
+			At:          offset,
+			LeaderEpoch: leaderEpoch,
 			Metadata:    offsetMetadata,
+		},
+	})
+	return true, nil
+}
+
+// commitGroupOffsets commits the last accumulated offset of each topic partition of a destination group with a single
+// request and reports the results of the offsets once it succeeded, or rejects their messages when it failed.
+func (w *redpandaMigratorOffsetsWriter) commitGroupOffsets(ctx context.Context, commits *offsetCommitBatch, g *groupOffsetCommits) {
+	commit := func() error {
+		w.commitRequests.Incr(1, g.group)
+		start := time.Now()
+		offsetResponses, err := w.client.CommitOffsets(ctx, g.group, g.latest)
+		w.commitLatency.Timing(time.Since(start).Nanoseconds(), g.group)
+		if err != nil {
+			return fmt.Errorf("failed to commit consumer offsets for topics %v: %s", g.latest.TopicsSet().Topics(), err)
+		}
+		if err := offsetResponses.Error(); err != nil {
+			return fmt.Errorf("committed consumer offsets returned an error for topics %v: %s", g.latest.TopicsSet().Topics(), err)
+		}
+		return nil
+	}
+
+	var err error
+	backOff := w.backoffCtor()
+	for {
+		if err = commit(); err == nil {
+			break
+		}
+
+		w.mgr.Logger().Debugf("Failed to commit offsets of destination group %q: %s", g.group, err)
+
+		wait := backOff.NextBackOff()
+		if wait == backoff.Stop {
+			break
+		}
+
+		time.Sleep(wait)
+	}
+
+	if err != nil {
+		for _, p := range g.pending {
+			res := p.res
+			pErr := fmt.Errorf("failed to update consumer offsets of source group %q as destination group %q for topic %q and partition %d (timestamp %d): %s", res.sourceGroup, res.group, res.topic, res.partition, res.sourceCommitTimestamp, err)
+			w.status.recordGroupCommit(res.sourceTopic, res.sourceGroup, pErr)
+			commits.failed(p.index, pErr)
+		}
+		return
+	}
+
+	var committed int
+	g.latest.Each(func(o kadm.Offset) {
+		committed++
+		w.events.offsetsCommitted(g.group, o.Topic, o.Partition, o.At)
+	})
+	if coalesced := len(g.pending) - committed; coalesced > 0 {
+		w.coalescedOffsets.Incr(int64(coalesced), g.group)
+	}
+	for _, p := range g.pending {
+		res := p.res
+		w.mgr.Logger().Tracef("Committed offsets of source group %q as destination group %q for topic %q and partition %d (timestamp %d)", res.sourceGroup, res.group, res.topic, res.partition, res.sourceCommitTimestamp)
+		w.committedOffsets.Incr(1, res.sourceGroup, res.group)
+		w.status.recordGroupCommit(res.sourceTopic, res.sourceGroup, nil)
+		res.result = offsetCommitResultCommitted
+		w.reportResult(ctx, p.msg, res)
+	}
+}
+
+// pendingOffsetCommit is a translated offset of a message which waits for the commit of its destination group.
+type pendingOffsetCommit struct {
+	index  int
+	msg    *service.Message
+	res    offsetCommitResult
+	offset kadm.Offset
+}
+
+// groupOffsetCommits holds the translated offsets of a destination group which are committed with a single request.
+type groupOffsetCommits struct {
+	group   string
+	pending []*pendingOffsetCommit
+	// The last offset of each topic partition, which is the only one that is committed.
+	latest kadm.Offsets
+}
+
+// offsetCommitBatch accumulates the translated offsets of a batch of messages by destination group, in the order in
+// which the groups were first seen.
+type offsetCommitBatch struct {
+	groups []*groupOffsetCommits
+	// failed rejects the message at the given index of the batch.
+	failed func(index int, err error)
+}
+
+func (b *offsetCommitBatch) add(p *pendingOffsetCommit) {
+	var g *groupOffsetCommits
+	for _, existing := range b.groups {
+		if existing.group == p.res.group {
+			g = existing
+			break
+		}
+	}
+	if g == nil {
+		g = &groupOffsetCommits{group: p.res.group}
+		b.groups = append(b.groups, g)
+	}
+	g.pending = append(g.pending, p)
+	g.latest.Add(p.offset)
+}
+
+// drop removes the accumulated offsets of the message at the given index of the batch.
+func (b *offsetCommitBatch) drop(index int) {
+	b.groups = slices.DeleteFunc(b.groups, func(g *groupOffsetCommits) bool {
+		pending := slices.DeleteFunc(g.pending, func(p *pendingOffsetCommit) bool {
+			return p.index == index
+		})
+		if len(pending) == len(g.pending) {
+			return false
+		}
+		// The last offset of each topic partition is accumulated again from the remaining ones.
+		g.pending, g.latest = nil, nil
+		for _, p := range pending {
+			g.pending = append(g.pending, p)
+			g.latest.Add(p.offset)
+		}
+		return len(g.pending) == 0
+	})
+}
+
+// take removes the accumulated offsets of a destination group and returns them, or nil if there are none.
+func (b *offsetCommitBatch) take(group string) *groupOffsetCommits {
+	for i, g := range b.groups {
+		if g.group == group {
+			b.groups = slices.Delete(b.groups, i, i+1)
+			return g
+		}
+	}
+	return nil
+}
+
+// pendingOffset returns the last accumulated offset of a topic partition of a destination group.
+func (b *offsetCommitBatch) pendingOffset(group, topic string, partition int32) (int64, bool) {
+	for _, g := range b.groups {
+		if g.group == group {
+			o, ok := g.latest.Lookup(topic, partition)
+			return o.At, ok
+		}
+	}
+	return 0, false
+}
+
+// offsetCommitResult describes the outcome of the offset update of a message. The offsets are -1 when they don't
+// apply.
+type offsetCommitResult struct {
+	result                string
+	sourceGroup           string
+	sourceTopic           string
+	group                 string
+	topic                 string
+	partition             int32
+	offset                int64
+	currentOffset         int64
+	sourceCommitTimestamp int64
+}
+
+// offsetCommitAuditRecord is the JSON audit record produced to the audit topic for each offset update. Fields may be
+// added to it, but existing fields must never be renamed or removed without bumping the version.
+type offsetCommitAuditRecord struct {
+	Version               int    `json:"version"`
+	Result                string `json:"result"`
+	SourceGroup           string `json:"source_group"`
+	SourceTopic           string `json:"source_topic"`
+	Group                 string `json:"group"`
+	Topic                 string `json:"topic"`
+	Partition             int32  `json:"partition"`
+	Offset                int64  `json:"offset"`
+	PreviousOffset        int64  `json:"previous_offset"`
+	SourceCommitTimestamp int64  `json:"source_commit_timestamp"`
+	Timestamp             int64  `json:"timestamp"`
+}
+
+// reportResult adds the commit result to the metadata of the message and produces its audit record when the audit
+// topic is set. Failing to produce the audit record is logged and counted, but never fails the offset update.
+func (w *redpandaMigratorOffsetsWriter) reportResult(ctx context.Context, msg *service.Message, res offsetCommitResult) {
+	now := time.Now()
+
+	msg.MetaSetMut(offsetCommitResultMetaKey, res.result)
+	msg.MetaSetMut(offsetCommitTimestampMetaKey, now.UnixMilli())
+	if res.result == offsetCommitResultSkippedGroupMapping {
+		return
+	}
+	msg.MetaSetMut(offsetCommitGroupMetaKey, res.group)
+	msg.MetaSetMut(offsetCommitTopicMetaKey, res.topic)
+	msg.MetaSetMut(offsetCommitPartitionMetaKey, int64(res.partition))
+	if res.offset >= 0 {
+		msg.MetaSetMut(offsetCommitOffsetMetaKey, res.offset)
+	}
+	if res.currentOffset >= 0 {
+		msg.MetaSetMut(offsetCommitCurrentMetaKey, res.currentOffset)
+	}
+
+	if w.produce == nil || res.result == offsetCommitResultDryRun {
+		return
+	}
+
+	value, err := json.Marshal(offsetCommitAuditRecord{
+		Version:               offsetCommitAuditRecordVersion,
+		Result:                res.result,
+		SourceGroup:           res.sourceGroup,
+		SourceTopic:           res.sourceTopic,
+		Group:                 res.group,
+		Topic:                 res.topic,
+		Partition:             res.partition,
+		Offset:                res.offset,
+		PreviousOffset:        res.currentOffset,
+		SourceCommitTimestamp: res.sourceCommitTimestamp,
+		Timestamp:             now.UnixMilli(),
+	})
+	if err == nil {
+		produceCtx, cancel := context.WithTimeout(ctx, offsetCommitAuditProduceTimeout)
+		err = w.produce(produceCtx, &kgo.Record{
+			Topic: w.auditTopic,
+			Key:   []byte(res.group),
+			Value: value,
 		})
+		cancel()
+	}
+	if err != nil {
+		w.mgr.Logger().Errorf("Failed to produce audit record of the offset update of destination group %q for topic %q and partition %d to topic %q: %s", res.group, res.topic, res.partition, w.auditTopic, err)
+		w.auditFailures.Incr(1)
+	}
+}
+
+// translateCommittedOffset returns the offset of a destination topic partition which corresponds to an offset committed
+// in the source cluster, given the timestamp of the record at the committed offset and whether the committed offset is
+// the high watermark of the source topic partition.
+func translateCommittedOffset(ctx context.Context, client offsetsAdminClient, topic string, partition int32, offsetCommitTimestamp int64, isHighWatermark bool) (int64, error) {
+	// ListOffsetsAfterMilli returns the topic's high watermark if the supplied timestamp is greater than the
+	// timestamps of all the records in the topic. It also sets the timestamp of the returned offset to -1 in this case.
+	listedOffsets, err := client.ListOffsetsAfterMilli(ctx, offsetCommitTimestamp, topic)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list offsets for topic %q and timestamp %d: %s", topic, offsetCommitTimestamp, err)
+	}
 
-		offsetResponses, err := w.client.CommitOffsets(ctx, group, offsets)
+	if err := listedOffsets.Error(); err != nil {
+		return 0, fmt.Errorf("failed to read offsets for topic %q and timestamp %d: %s", topic, offsetCommitTimestamp, err)
+	}
+
+	offset, ok := listedOffsets.Lookup(topic, partition)
+	if !ok {
+		// This should never happen, but we check just in case.
+		return 0, fmt.Errorf("record for timestamp %d not yet replicated to the destination topic %q partition %d: lookup failed", offsetCommitTimestamp, topic, partition)
+	}
+
+	if !isHighWatermark && offset.Timestamp == -1 {
+		// This can happen if we received an offset update, but the record which was read from the source cluster to
+		// trigger it has not been replicated to the destination cluster yet. In this case, we raise an error so the
+		// operation is retried.
+		return 0, fmt.Errorf("record for timestamp %d not yet replicated to the destination topic %q partition %d", offsetCommitTimestamp, topic, partition)
+	}
+
+	// This is an optimisation to try and avoid unnecessary duplicates in the common case when the received offset
+	// update points to the high watermark of the source topic. In this special case, we check if the matching
+	// offset in the destination topic (returned by `ListOffsetsAfterMilli`) also points to the high watermark
+	// (indicated by having timestamp == -1). If it does, then we fetch the current high watermark of the
+	// destination topic and set the destination consumer offset to that value.
+	// Note: Even for compacted topics, the last record of the topic cannot be compacted, so it's safe to assume its
+	// offset will be one less than the high watermark.
+	if isHighWatermark && offset.Timestamp != -1 {
+		offsets, err := client.ListEndOffsets(ctx, topic)
 		if err != nil {
-			return fmt.Errorf("failed to commit consumer offsets for topic %q and partition %q (timestamp %d): %s", topic, partition, offsetCommitTimestamp, err)
+			return 0, fmt.Errorf("failed to list the high watermark for topic %q and partition %q (timestamp %d): %s", topic, partition, offsetCommitTimestamp, err)
 		}
 
-		if err := offsetResponses.Error(); err != nil {
-			return fmt.Errorf("committed consumer offsets returned an error for topic %q and partition %q (timestamp %d): %s", topic, partition, offsetCommitTimestamp, err)
+		highWatermark, ok := offsets.Lookup(topic, partition)
+		if !ok {
+			return 0, fmt.Errorf("failed to read the high watermark for topic %q and partition %q (timestamp %d): %s", topic, partition, offsetCommitTimestamp, err)
+		}
+		if highWatermark.Offset == offset.Offset+1 {
+			offset.Offset = highWatermark.Offset
+		}
+	}
+
+	return offset.Offset, nil
+}
+
+// topicPartitionCounts holds the partition counts of a source topic and of its destination topic.
+type topicPartitionCounts struct {
+	source      int
+	destination int
+	fetchedAt   time.Time
+}
+
+// fetchPartitionCounts returns the partition counts of a source topic and of its destination topic, which are cached
+// for partitionCountsCacheTTL.
+func (w *redpandaMigratorOffsetsWriter) fetchPartitionCounts(ctx context.Context, sourceTopic, topic string) (topicPartitionCounts, error) {
+	if counts, ok := w.partitionCounts[sourceTopic]; ok && time.Since(counts.fetchedAt) < partitionCountsCacheTTL {
+		return counts, nil
+	}
+
+	counts := topicPartitionCounts{fetchedAt: time.Now()}
+	var err error
+	if counts.source, err = w.sourcePartitionCount(ctx, sourceTopic); err != nil {
+		return counts, fmt.Errorf("source cluster: %w", err)
+	}
+	if counts.destination, err = topicPartitionCount(ctx, w.client, topic); err != nil {
+		return counts, fmt.Errorf("destination cluster: %w", err)
+	}
+	w.partitionCounts[sourceTopic] = counts
+	return counts, nil
+}
+
+// topicPartitionCount returns the number of partitions of a topic.
+func topicPartitionCount(ctx context.Context, client offsetsAdminClient, topic string) (int, error) {
+	topics, err := client.ListTopics(ctx, topic)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch topic %q: %w", topic, err)
+	}
+	if !topics.Has(topic) {
+		return 0, fmt.Errorf("topic %q doesn't exist", topic)
+	}
+	if err := topics[topic].Err; err != nil {
+		return 0, fmt.Errorf("failed to fetch topic %q: %w", topic, err)
+	}
+	return len(topics[topic].Partitions), nil
+}
+
+// fetchCommittedOffset returns the offset which is committed by a consumer group for the given topic partition, or -1
+// if there's none.
+func fetchCommittedOffset(ctx context.Context, client offsetsAdminClient, group, topic string, partition int32) (int64, error) {
+	responses, err := client.FetchOffsets(ctx, group)
+	if errors.Is(err, kerr.GroupIDNotFound) {
+		return -1, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch the committed offsets of group %q: %s", group, err)
+	}
+
+	res, ok := responses.Lookup(topic, partition)
+	if !ok || errors.Is(res.Err, kerr.UnknownTopicOrPartition) {
+		return -1, nil
+	}
+	if res.Err != nil {
+		return 0, fmt.Errorf("failed to fetch the committed offset of group %q for topic %q and partition %d: %s", group, topic, partition, res.Err)
+	}
+	return res.At, nil
+}
+
+// consumerGroupMapper rewrites the names of the consumer groups whose offsets are migrated to the output cluster. A nil
+// mapper leaves them unchanged.
+type consumerGroupMapper struct {
+	renames map[string]string
+	mapping *bloblang.Executor
+}
+
+// mapGroup returns the output cluster name of the given consumer group. An empty result is returned when the offsets
+// of the group should be skipped.
+func (m *consumerGroupMapper) mapGroup(group, topic string) (string, error) {
+	if m == nil {
+		return group, nil
+	}
+
+	if m.mapping == nil {
+		if renamed, exists := m.renames[group]; exists {
+			return renamed, nil
+		}
+		return group, nil
+	}
+
+	res, err := m.mapping.Query(map[string]any{
+		"group": group,
+		"topic": topic,
+	})
+	if err != nil {
+		if errors.Is(err, bloblang.ErrRootDeleted) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to execute group mapping: %s", err)
+	}
+
+	mapped, ok := res.(string)
+	if !ok {
+		return "", fmt.Errorf("group mapping returned a %T instead of a string", res)
+	}
+	return mapped, nil
+}
+
+// deleteConsumerOffset removes the committed offsets of a consumer group for the given topic partitions and returns
+// the commit result, which tells whether there was anything to delete.
+func (w *redpandaMigratorOffsetsWriter) deleteConsumerOffset(ctx context.Context, group, topic string, partitions []int32) (string, error) {
+	var result string
+	deleteOffset := func() error {
+		result = offsetCommitResultDeleted
+
+		var ts kadm.TopicsSet
+		ts.Add(topic, partitions...)
+		responses, err := w.client.DeleteOffsets(ctx, group, ts)
+		if errors.Is(err, kerr.GroupIDNotFound) {
+			// There's nothing to delete.
+			result = offsetCommitResultSkippedMissingGroup
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete consumer offsets for topic %q and partitions %v: %s", topic, partitions, err)
+		}
+
+		if err := responses.Error(); err != nil {
+			if errors.Is(err, kerr.UnknownTopicOrPartition) {
+				result = offsetCommitResultSkippedMissingTopic
+				return nil
+			}
+			return fmt.Errorf("deleted consumer offsets returned an error for topic %q and partitions %v: %s", topic, partitions, err)
 		}
 
 		return nil
@@ -340,24 +1284,20 @@ func (w *redpandaMigratorOffsetsWriter) Write(ctx context.Context, msg *service.
 
 	backOff := w.backoffCtor()
 	for {
-		// TODO: Maybe use `dispatch.TriggerSignal()` to consume new messages while `updateConsumerOffsets()` is running
-		// if this proves to be too slow.
-		err := updateConsumerOffsets()
+		err := deleteOffset()
 		if err == nil {
-			break
+			return result, nil
 		}
 
 		w.mgr.Logger().Debug(err.Error())
 
 		wait := backOff.NextBackOff()
 		if wait == backoff.Stop {
-			return fmt.Errorf("failed to update consumer offsets for topic %q and partition %d (timestamp %d): %s", topic, partition, offsetCommitTimestamp, err)
+			return "", err
 		}
 
 		time.Sleep(wait)
 	}
-
-	return nil
 }
 
 // Close underlying connections.
@@ -371,6 +1311,7 @@ func (w *redpandaMigratorOffsetsWriter) Close(ctx context.Context) error {
 
 	w.client.Close()
 	w.client = nil
+	w.produce = nil
 
 	return nil
 }
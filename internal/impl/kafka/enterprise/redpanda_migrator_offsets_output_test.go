@@ -0,0 +1,941 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/kafka"
+)
+
+func TestConsumerGroupMapper(t *testing.T) {
+	var nilMapper *consumerGroupMapper
+	group, err := nilMapper.mapGroup("prod-orders-service", "orders")
+	require.NoError(t, err)
+	assert.Equal(t, "prod-orders-service", group)
+
+	renames := &consumerGroupMapper{renames: map[string]string{
+		"prod-orders-service": "orders-service",
+		"prod-legacy-service": "",
+	}}
+	for _, test := range []struct {
+		group    string
+		expected string
+	}{
+		{group: "prod-orders-service", expected: "orders-service"},
+		{group: "prod-legacy-service", expected: ""},
+		{group: "billing-service", expected: "billing-service"},
+	} {
+		group, err := renames.mapGroup(test.group, "orders")
+		require.NoError(t, err)
+		assert.Equal(t, test.expected, group, test.group)
+	}
+
+	tests := []struct {
+		name        string
+		mapping     string
+		group       string
+		topic       string
+		expected    string
+		errContains string
+	}{
+		{
+			name:     "trim prefix",
+			mapping:  `root = this.group.trim_prefix("prod-")`,
+			group:    "prod-orders-service",
+			topic:    "orders",
+			expected: "orders-service",
+		},
+		{
+			name:     "uses topic",
+			mapping:  `root = this.topic + "-" + this.group`,
+			group:    "foo",
+			topic:    "bar",
+			expected: "bar-foo",
+		},
+		{
+			name:     "deleted",
+			mapping:  `root = if this.topic.has_prefix("_") { deleted() } else { this.group }`,
+			group:    "foo",
+			topic:    "_internal",
+			expected: "",
+		},
+		{
+			name:     "empty string",
+			mapping:  `root = ""`,
+			group:    "foo",
+			topic:    "bar",
+			expected: "",
+		},
+		{
+			name:        "not a string",
+			mapping:     `root = 5`,
+			group:       "foo",
+			topic:       "bar",
+			errContains: "group mapping returned a int64 instead of a string",
+		},
+		{
+			name:        "mapping error",
+			mapping:     `root = this.nope.uppercase()`,
+			group:       "foo",
+			topic:       "bar",
+			errContains: "failed to execute group mapping",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mapping, err := bloblang.Parse(test.mapping)
+			require.NoError(t, err)
+
+			mapper := &consumerGroupMapper{mapping: mapping}
+			group, err := mapper.mapGroup(test.group, test.topic)
+			if test.errContains != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.errContains)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, group)
+		})
+	}
+}
+
+func TestRedpandaMigratorOffsetsOutputGroupMappingLinting(t *testing.T) {
+	configTests := []struct {
+		name        string
+		config      string
+		errContains string
+	}{
+		{
+			name: "group mapping",
+			config: `
+redpanda_migrator_offsets:
+  seed_brokers: [ localhost:9092 ]
+  group_mapping: 'root = this.group.trim_prefix("prod-")'
+`,
+		},
+		{
+			name: "group renames",
+			config: `
+redpanda_migrator_offsets:
+  seed_brokers: [ localhost:9092 ]
+  group_renames:
+    prod-orders-service: orders-service
+`,
+		},
+		{
+			name: "group mapping and group renames",
+			config: `
+redpanda_migrator_offsets:
+  seed_brokers: [ localhost:9092 ]
+  group_mapping: 'root = this.group'
+  group_renames:
+    prod-orders-service: orders-service
+`,
+			errContains: "only one of group_mapping and group_renames can be set",
+		},
+	}
+
+	env := service.NewEnvironment()
+	for _, test := range configTests {
+		t.Run(test.name, func(t *testing.T) {
+			strm := env.NewStreamBuilder()
+			err := strm.AddOutputYAML(test.config)
+			if test.errContains == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.errContains)
+			}
+		})
+	}
+}
+
+// stubOffsetsAdminClient serves the offsets of a single topic partition and records the committed offsets.
+type stubOffsetsAdminClient struct {
+	partitionCounts map[string]int
+	listedOffset    kadm.ListedOffset
+	committedOffset *kadm.OffsetResponse
+	fetchErr        error
+	deleteErr       error
+	deleteResponses kadm.DeleteOffsetsResponses
+	commitErr       error
+
+	commits        []kadm.Offset
+	commitRequests int
+	deletes        []kadm.TopicsSet
+}
+
+func (c *stubOffsetsAdminClient) ListTopics(_ context.Context, topics ...string) (kadm.TopicDetails, error) {
+	details := kadm.TopicDetails{}
+	for _, topic := range topics {
+		count, ok := c.partitionCounts[topic]
+		if !ok {
+			continue
+		}
+		detail := kadm.TopicDetail{Topic: topic, Partitions: kadm.PartitionDetails{}}
+		for p := range int32(count) {
+			detail.Partitions[p] = kadm.PartitionDetail{Topic: topic, Partition: p}
+		}
+		details[topic] = detail
+	}
+	return details, nil
+}
+
+func (c *stubOffsetsAdminClient) ListOffsetsAfterMilli(_ context.Context, _ int64, _ ...string) (kadm.ListedOffsets, error) {
+	return kadm.ListedOffsets{c.listedOffset.Topic: {c.listedOffset.Partition: c.listedOffset}}, nil
+}
+
+func (c *stubOffsetsAdminClient) ListEndOffsets(_ context.Context, _ ...string) (kadm.ListedOffsets, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *stubOffsetsAdminClient) FetchOffsets(_ context.Context, _ string) (kadm.OffsetResponses, error) {
+	if c.fetchErr != nil {
+		return nil, c.fetchErr
+	}
+	responses := kadm.OffsetResponses{}
+	if c.committedOffset != nil {
+		responses[c.committedOffset.Topic] = map[int32]kadm.OffsetResponse{c.committedOffset.Partition: *c.committedOffset}
+	}
+	return responses, nil
+}
+
+func (c *stubOffsetsAdminClient) CommitOffsets(_ context.Context, _ string, os kadm.Offsets) (kadm.OffsetResponses, error) {
+	c.commitRequests++
+	if c.commitErr != nil {
+		return nil, c.commitErr
+	}
+	responses := kadm.OffsetResponses{}
+	for _, o := range os.Sorted() {
+		c.commits = append(c.commits, o)
+		responses.Add(kadm.OffsetResponse{Offset: o})
+	}
+	return responses, nil
+}
+
+func (c *stubOffsetsAdminClient) DeleteOffsets(_ context.Context, _ string, s kadm.TopicsSet) (kadm.DeleteOffsetsResponses, error) {
+	c.deletes = append(c.deletes, s)
+	return c.deleteResponses, c.deleteErr
+}
+
+func (*stubOffsetsAdminClient) Close() {}
+
+func TestRedpandaMigratorOffsetsOutputRewindProtection(t *testing.T) {
+	tests := []struct {
+		name            string
+		config          string
+		committedOffset *kadm.OffsetResponse
+		fetchErr        error
+		tombstone       bool
+		expectedCommits []int64
+		expectedDeletes int
+		expectedResult  string
+		errContains     string
+	}{
+		{
+			name:            "no committed offset",
+			expectedCommits: []int64{10},
+			expectedResult:  "committed",
+		},
+		{
+			name:            "group not found",
+			fetchErr:        kerr.GroupIDNotFound,
+			expectedCommits: []int64{10},
+			expectedResult:  "committed",
+		},
+		{
+			name:            "committed offset is lower",
+			committedOffset: &kadm.OffsetResponse{Offset: kadm.Offset{Topic: "foo", Partition: 1, At: 5}},
+			expectedCommits: []int64{10},
+			expectedResult:  "committed",
+		},
+		{
+			name:            "committed offset is equal",
+			committedOffset: &kadm.OffsetResponse{Offset: kadm.Offset{Topic: "foo", Partition: 1, At: 10}},
+			expectedCommits: []int64{10},
+			expectedResult:  "committed",
+		},
+		{
+			name:            "committed offset is higher",
+			committedOffset: &kadm.OffsetResponse{Offset: kadm.Offset{Topic: "foo", Partition: 1, At: 20}},
+			expectedResult:  "skipped_rewind",
+		},
+		{
+			name:            "committed offset of another partition is higher",
+			committedOffset: &kadm.OffsetResponse{Offset: kadm.Offset{Topic: "foo", Partition: 2, At: 20}},
+			expectedCommits: []int64{10},
+			expectedResult:  "committed",
+		},
+		{
+			name:            "allow rewind",
+			config:          "allow_rewind: true",
+			committedOffset: &kadm.OffsetResponse{Offset: kadm.Offset{Topic: "foo", Partition: 1, At: 20}},
+			fetchErr:        errors.New("offsets must not be fetched"),
+			expectedCommits: []int64{10},
+			expectedResult:  "committed",
+		},
+		{
+			name:        "fetch error",
+			fetchErr:    errors.New("coordinator not available"),
+			errContains: "coordinator not available",
+		},
+		{
+			name:            "dry run",
+			config:          "dry_run: true",
+			committedOffset: &kadm.OffsetResponse{Offset: kadm.Offset{Topic: "foo", Partition: 1, At: 5}},
+			expectedResult:  "dry_run",
+		},
+		{
+			name:            "dry run tombstone",
+			config:          "dry_run: true",
+			tombstone:       true,
+			expectedDeletes: 0,
+			expectedResult:  "dry_run",
+		},
+		{
+			name:            "tombstone",
+			tombstone:       true,
+			expectedDeletes: 1,
+			expectedResult:  "deleted",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spec := redpandaMigratorOffsetsOutputConfig()
+			conf, err := spec.ParseYAML(`
+seed_brokers: [ localhost:9092 ]
+max_retries: 1
+backoff:
+  initial_interval: 1ms
+`+test.config, nil)
+			require.NoError(t, err)
+
+			w, err := newRedpandaMigratorOffsetsWriterFromConfig(conf, service.MockResources())
+			require.NoError(t, err)
+
+			client := &stubOffsetsAdminClient{
+				listedOffset:    kadm.ListedOffset{Topic: "foo", Partition: 1, Offset: 10, Timestamp: 1000},
+				committedOffset: test.committedOffset,
+				fetchErr:        test.fetchErr,
+			}
+			w.client = client
+
+			msg := service.NewMessage(nil)
+			msg.MetaSetMut("kafka_offset_topic", "foo")
+			msg.MetaSetMut("kafka_offset_group", "bar")
+			msg.MetaSetMut("kafka_offset_partition", "1")
+			msg.MetaSetMut("kafka_offset_commit_timestamp", "1000")
+			msg.MetaSetMut("kafka_offset_metadata", "")
+			msg.MetaSetMut("kafka_is_high_watermark", "false")
+			msg.MetaSetMut("kafka_tombstone_message", strconv.FormatBool(test.tombstone))
+
+			err = w.WriteBatch(context.Background(), service.MessageBatch{msg})
+			if test.errContains != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.errContains)
+				return
+			}
+			require.NoError(t, err)
+
+			var commits []int64
+			for _, o := range client.commits {
+				assert.Equal(t, "foo", o.Topic)
+				assert.Equal(t, int32(1), o.Partition)
+				commits = append(commits, o.At)
+			}
+			assert.Equal(t, test.expectedCommits, commits)
+			assert.Len(t, client.deletes, test.expectedDeletes)
+
+			result, _ := msg.MetaGetMut("offset_commit_result")
+			assert.Equal(t, test.expectedResult, result)
+		})
+	}
+}
+
+func TestRedpandaMigratorOffsetsOutputCommitResults(t *testing.T) {
+	tests := []struct {
+		name            string
+		config          string
+		committedOffset *kadm.OffsetResponse
+		deleteErr       error
+		deleteResponses kadm.DeleteOffsetsResponses
+		tombstone       bool
+		produceErr      error
+		expectedMeta    map[string]any
+		expectedRecord  *offsetCommitAuditRecord
+	}{
+		{
+			name:            "committed",
+			committedOffset: &kadm.OffsetResponse{Offset: kadm.Offset{Topic: "foo", Partition: 1, At: 5}},
+			expectedMeta: map[string]any{
+				"offset_commit_result":         "committed",
+				"offset_commit_group":          "bar",
+				"offset_commit_topic":          "foo",
+				"offset_commit_partition":      int64(1),
+				"offset_commit_offset":         int64(10),
+				"offset_commit_current_offset": int64(5),
+			},
+			expectedRecord: &offsetCommitAuditRecord{
+				Version: 1, Result: "committed", SourceGroup: "bar", SourceTopic: "foo", Group: "bar", Topic: "foo",
+				Partition: 1, Offset: 10, PreviousOffset: 5, SourceCommitTimestamp: 1000,
+			},
+		},
+		{
+			name:            "skipped rewind",
+			committedOffset: &kadm.OffsetResponse{Offset: kadm.Offset{Topic: "foo", Partition: 1, At: 20}},
+			expectedMeta: map[string]any{
+				"offset_commit_result":         "skipped_rewind",
+				"offset_commit_offset":         int64(10),
+				"offset_commit_current_offset": int64(20),
+			},
+			expectedRecord: &offsetCommitAuditRecord{
+				Version: 1, Result: "skipped_rewind", SourceGroup: "bar", SourceTopic: "foo", Group: "bar", Topic: "foo",
+				Partition: 1, Offset: 10, PreviousOffset: 20, SourceCommitTimestamp: 1000,
+			},
+		},
+		{
+			name:            "deleted offset of missing topic",
+			tombstone:       true,
+			deleteResponses: kadm.DeleteOffsetsResponses{"foo": {1: kerr.UnknownTopicOrPartition}},
+			expectedMeta: map[string]any{
+				"offset_commit_result": "skipped_missing_topic",
+			},
+			expectedRecord: &offsetCommitAuditRecord{
+				Version: 1, Result: "skipped_missing_topic", SourceGroup: "bar", SourceTopic: "foo", Group: "bar", Topic: "foo",
+				Partition: 1, Offset: -1, PreviousOffset: -1,
+			},
+		},
+		{
+			name:      "deleted offset of missing group",
+			tombstone: true,
+			deleteErr: kerr.GroupIDNotFound,
+			expectedMeta: map[string]any{
+				"offset_commit_result": "skipped_missing_group",
+			},
+			expectedRecord: &offsetCommitAuditRecord{
+				Version: 1, Result: "skipped_missing_group", SourceGroup: "bar", SourceTopic: "foo", Group: "bar", Topic: "foo",
+				Partition: 1, Offset: -1, PreviousOffset: -1,
+			},
+		},
+		{
+			name:   "skipped by group mapping",
+			config: "group_renames: { bar: \"\" }",
+			expectedMeta: map[string]any{
+				"offset_commit_result": "skipped_group_mapping",
+			},
+		},
+		{
+			name:   "dry run is not audited",
+			config: "dry_run: true",
+			expectedMeta: map[string]any{
+				"offset_commit_result": "dry_run",
+				"offset_commit_offset": int64(10),
+			},
+		},
+		{
+			name:       "audit failure does not fail the commit",
+			produceErr: errors.New("topic authorization failed"),
+			expectedMeta: map[string]any{
+				"offset_commit_result": "committed",
+			},
+			expectedRecord: &offsetCommitAuditRecord{
+				Version: 1, Result: "committed", SourceGroup: "bar", SourceTopic: "foo", Group: "bar", Topic: "foo",
+				Partition: 1, Offset: 10, PreviousOffset: -1, SourceCommitTimestamp: 1000,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spec := redpandaMigratorOffsetsOutputConfig()
+			conf, err := spec.ParseYAML(`
+seed_brokers: [ localhost:9092 ]
+audit_topic: audit
+max_retries: 1
+backoff:
+  initial_interval: 1ms
+`+test.config, nil)
+			require.NoError(t, err)
+
+			w, err := newRedpandaMigratorOffsetsWriterFromConfig(conf, service.MockResources())
+			require.NoError(t, err)
+
+			w.client = &stubOffsetsAdminClient{
+				listedOffset:    kadm.ListedOffset{Topic: "foo", Partition: 1, Offset: 10, Timestamp: 1000},
+				committedOffset: test.committedOffset,
+				deleteErr:       test.deleteErr,
+				deleteResponses: test.deleteResponses,
+			}
+			var records []*kgo.Record
+			w.produce = func(_ context.Context, record *kgo.Record) error {
+				records = append(records, record)
+				return test.produceErr
+			}
+
+			msg := service.NewMessage(nil)
+			msg.MetaSetMut("kafka_offset_topic", "foo")
+			msg.MetaSetMut("kafka_offset_group", "bar")
+			msg.MetaSetMut("kafka_offset_partition", "1")
+			msg.MetaSetMut("kafka_offset_commit_timestamp", "1000")
+			msg.MetaSetMut("kafka_offset_metadata", "")
+			msg.MetaSetMut("kafka_is_high_watermark", "false")
+			msg.MetaSetMut("kafka_tombstone_message", strconv.FormatBool(test.tombstone))
+
+			require.NoError(t, w.WriteBatch(context.Background(), service.MessageBatch{msg}))
+
+			for k, v := range test.expectedMeta {
+				actual, ok := msg.MetaGetMut(k)
+				require.True(t, ok, k)
+				assert.Equal(t, v, actual, k)
+			}
+			_, ok := msg.MetaGetMut("offset_commit_timestamp")
+			assert.True(t, ok)
+
+			if test.expectedRecord == nil {
+				assert.Empty(t, records)
+				return
+			}
+			require.Len(t, records, 1)
+			assert.Equal(t, "audit", records[0].Topic)
+			assert.Equal(t, "bar", string(records[0].Key))
+
+			var record offsetCommitAuditRecord
+			require.NoError(t, json.Unmarshal(records[0].Value, &record))
+			assert.NotZero(t, record.Timestamp)
+			record.Timestamp = 0
+			assert.Equal(t, *test.expectedRecord, record)
+		})
+	}
+}
+
+// timestampedOffsetsAdminClient serves the offsets of a topic whose partitions hold records with the given timestamps.
+type timestampedOffsetsAdminClient struct {
+	stubOffsetsAdminClient
+	topic      string
+	timestamps [][]int64
+
+	timestampRequests int
+}
+
+func (c *timestampedOffsetsAdminClient) ListOffsetsAfterMilli(_ context.Context, millis int64, _ ...string) (kadm.ListedOffsets, error) {
+	listed := kadm.ListedOffsets{c.topic: {}}
+	for p, timestamps := range c.timestamps {
+		offset := kadm.ListedOffset{Topic: c.topic, Partition: int32(p), Offset: int64(len(timestamps)), Timestamp: -1}
+		if i, _ := slices.BinarySearch(timestamps, millis); i < len(timestamps) {
+			offset.Offset, offset.Timestamp = int64(i), timestamps[i]
+		}
+		listed[c.topic][int32(p)] = offset
+	}
+	return listed, nil
+}
+
+// offsetsForTimestamp serves the offsets of the partitions like kafka.OffsetsForTimestamp.
+func (c *timestampedOffsetsAdminClient) offsetsForTimestamp(_ context.Context, topicPartitions map[string][]int32, ts time.Time) (map[string]map[int32]int64, error) {
+	c.timestampRequests++
+	offsets := map[string]map[int32]int64{}
+	for topic, partitions := range topicPartitions {
+		if topic != c.topic {
+			continue
+		}
+		offsets[topic] = map[int32]int64{}
+		for _, p := range partitions {
+			timestamps := c.timestamps[p]
+			i, _ := slices.BinarySearch(timestamps, ts.UnixMilli())
+			offsets[topic][p] = int64(i)
+		}
+	}
+	return offsets, nil
+}
+
+// FetchOffsets serves the offsets which were committed last.
+func (c *timestampedOffsetsAdminClient) FetchOffsets(_ context.Context, _ string) (kadm.OffsetResponses, error) {
+	responses := kadm.OffsetResponses{}
+	for _, o := range c.commits {
+		responses.Add(kadm.OffsetResponse{Offset: o})
+	}
+	return responses, nil
+}
+
+func TestRedpandaMigratorOffsetsOutputPartitionMismatch(t *testing.T) {
+	// The destination topic has 6 partitions, the records of the 3 source partitions were spread across them.
+	timestamps := [][]int64{
+		{1000, 2000, 3000, 4000},
+		{1500, 2500, 3500},
+		{1200, 1800},
+		{},
+		{3000, 3100, 3200, 3300, 3400},
+		{500, 4500},
+	}
+	commit := func(partition int, timestamp int64, tombstone bool) *service.Message {
+		msg := service.NewMessage(nil)
+		msg.MetaSetMut("kafka_offset_topic", "foo")
+		msg.MetaSetMut("kafka_offset_group", "bar")
+		msg.MetaSetMut("kafka_offset_partition", strconv.Itoa(partition))
+		msg.MetaSetMut("kafka_offset_commit_timestamp", strconv.FormatInt(timestamp, 10))
+		msg.MetaSetMut("kafka_offset_metadata", "")
+		msg.MetaSetMut("kafka_offset_leader_epoch", "7")
+		msg.MetaSetMut("kafka_is_high_watermark", "false")
+		msg.MetaSetMut("kafka_tombstone_message", strconv.FormatBool(tombstone))
+		return msg
+	}
+
+	type commitAt struct {
+		partition int32
+		offset    int64
+	}
+	tests := []struct {
+		name              string
+		config            string
+		sourcePartitions  int
+		messages          []*service.Message
+		expectedCommits   []commitAt
+		expectedDeletes   []int32
+		expectedResult    string
+		expectedErr       string
+		expectedSourceReq int
+		expectedListReq   int
+	}{
+		{
+			name:             "fail by default",
+			sourcePartitions: 3,
+			messages:         []*service.Message{commit(1, 2500, false)},
+			expectedErr:      `topic "foo" has 3 partitions in the source cluster but topic "foo" has 6 in the destination cluster`,
+		},
+		{
+			name:             "skip",
+			config:           "on_partition_mismatch: skip",
+			sourcePartitions: 3,
+			messages:         []*service.Message{commit(1, 2500, false)},
+			expectedResult:   "skipped_partition_mismatch",
+		},
+		{
+			name:             "timestamp translate",
+			config:           "on_partition_mismatch: timestamp_translate",
+			sourcePartitions: 3,
+			messages:         []*service.Message{commit(0, 1000, false), commit(2, 2500, false), commit(1, 1800, false)},
+			// The offsets only move forward, so the commit of source partition 1 at 1800 skips the destination
+			// partitions which were moved past it by the commit of source partition 2 at 2500.
+			expectedCommits: []commitAt{
+				{0, 0}, {1, 0}, {2, 0}, {3, 0}, {4, 0}, {5, 1},
+				{0, 2}, {1, 1}, {2, 2}, {3, 0}, {4, 0}, {5, 1},
+				{1, 1}, {3, 0}, {4, 0}, {5, 1},
+			},
+			expectedResult:    "committed",
+			expectedSourceReq: 1,
+			expectedListReq:   3,
+		},
+		{
+			name:             "timestamp translate with rewinds",
+			config:           "on_partition_mismatch: timestamp_translate\nallow_rewind: true",
+			sourcePartitions: 3,
+			messages:         []*service.Message{commit(2, 2500, false), commit(1, 1800, false)},
+			expectedCommits: []commitAt{
+				{0, 2}, {1, 1}, {2, 2}, {3, 0}, {4, 0}, {5, 1},
+				{0, 1}, {1, 1}, {2, 1}, {3, 0}, {4, 0}, {5, 1},
+			},
+			expectedResult:    "committed",
+			expectedSourceReq: 1,
+			expectedListReq:   2,
+		},
+		{
+			name:             "timestamp translate tombstone",
+			config:           "on_partition_mismatch: timestamp_translate",
+			sourcePartitions: 3,
+			messages:         []*service.Message{commit(1, 0, true)},
+			expectedDeletes:  []int32{1},
+			expectedResult:   "deleted",
+		},
+		{
+			name:             "same partition count",
+			sourcePartitions: 6,
+			messages:         []*service.Message{commit(1, 2500, false)},
+			expectedCommits:  []commitAt{{1, 1}},
+			expectedResult:   "committed",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spec := redpandaMigratorOffsetsOutputConfig()
+			conf, err := spec.ParseYAML(`
+seed_brokers: [ localhost:9092 ]
+input_resource: redpanda_migrator_input
+max_retries: 1
+backoff:
+  initial_interval: 1ms
+`+test.config, nil)
+			require.NoError(t, err)
+
+			w, err := newRedpandaMigratorOffsetsWriterFromConfig(conf, service.MockResources())
+			require.NoError(t, err)
+
+			var sourceRequests int
+			w.sourcePartitionCount = func(_ context.Context, topic string) (int, error) {
+				assert.Equal(t, "foo", topic)
+				sourceRequests++
+				return test.sourcePartitions, nil
+			}
+			client := &timestampedOffsetsAdminClient{
+				stubOffsetsAdminClient: stubOffsetsAdminClient{partitionCounts: map[string]int{"foo": len(timestamps)}},
+				topic:                  "foo",
+				timestamps:             timestamps,
+			}
+			w.client = client
+			w.offsetsForTimestamp = client.offsetsForTimestamp
+
+			for _, msg := range test.messages {
+				err = w.WriteBatch(context.Background(), service.MessageBatch{msg})
+				if test.expectedErr != "" {
+					require.ErrorContains(t, err, test.expectedErr)
+					assert.Empty(t, client.commits)
+					return
+				}
+				require.NoError(t, err)
+				result, _ := msg.MetaGetMut("offset_commit_result")
+				assert.Equal(t, test.expectedResult, result)
+			}
+
+			var commits []commitAt
+			for _, o := range client.commits {
+				assert.Equal(t, "foo", o.Topic)
+				if test.sourcePartitions != len(timestamps) {
+					assert.Equal(t, int32(-1), o.LeaderEpoch)
+				}
+				commits = append(commits, commitAt{o.Partition, o.At})
+			}
+			assert.Equal(t, test.expectedCommits, commits)
+
+			var deletes []int32
+			for _, ts := range client.deletes {
+				deletes = append(deletes, ts.Sorted()[0].Partitions...)
+			}
+			assert.Equal(t, test.expectedDeletes, deletes)
+
+			if test.expectedSourceReq > 0 {
+				assert.Equal(t, test.expectedSourceReq, sourceRequests)
+			}
+			assert.Equal(t, test.expectedListReq, client.timestampRequests)
+		})
+	}
+
+	t.Run("timestamp translate failure", func(t *testing.T) {
+		conf, err := redpandaMigratorOffsetsOutputConfig().ParseYAML(`
+seed_brokers: [ localhost:9092 ]
+input_resource: redpanda_migrator_input
+on_partition_mismatch: timestamp_translate
+max_retries: 1
+backoff:
+  initial_interval: 1ms
+`, nil)
+		require.NoError(t, err)
+		w, err := newRedpandaMigratorOffsetsWriterFromConfig(conf, service.MockResources())
+		require.NoError(t, err)
+		w.sourcePartitionCount = func(context.Context, string) (int, error) { return 3, nil }
+		client := &timestampedOffsetsAdminClient{
+			stubOffsetsAdminClient: stubOffsetsAdminClient{partitionCounts: map[string]int{"foo": len(timestamps)}},
+			topic:                  "foo",
+			timestamps:             timestamps,
+		}
+		w.client = client
+		// The offset of the last destination partition can't be listed for the second message.
+		w.offsetsForTimestamp = func(ctx context.Context, topicPartitions map[string][]int32, ts time.Time) (map[string]map[int32]int64, error) {
+			offsets, err := client.offsetsForTimestamp(ctx, topicPartitions, ts)
+			if err != nil || client.timestampRequests == 1 {
+				return offsets, err
+			}
+			delete(offsets["foo"], 5)
+			return offsets, &kafka.PartitionOffsetsError{Failed: []kafka.PartitionOffsetError{
+				{Topic: "foo", Partition: 5, Err: errors.New("not leader")},
+			}}
+		}
+
+		batch := service.MessageBatch{commit(0, 1000, false), commit(2, 2500, false)}
+		err = w.WriteBatch(context.Background(), batch)
+		var batchErr *service.BatchError
+		require.ErrorAs(t, err, &batchErr)
+		assert.Equal(t, 1, batchErr.IndexedErrors())
+
+		// None of the offsets of the rejected message are committed, even those of the partitions before the one that
+		// failed.
+		var commits []commitAt
+		for _, o := range client.commits {
+			commits = append(commits, commitAt{o.Partition, o.At})
+		}
+		assert.Equal(t, []commitAt{{0, 0}, {1, 0}, {2, 0}, {3, 0}, {4, 0}, {5, 1}}, commits)
+		result, _ := batch[0].MetaGetMut("offset_commit_result")
+		assert.Equal(t, "committed", result)
+		_, ok := batch[1].MetaGetMut("offset_commit_result")
+		assert.False(t, ok)
+	})
+
+	// Partition mismatches can only be handled when the partition counts are compared.
+	conf, err := redpandaMigratorOffsetsOutputConfig().ParseYAML(`
+seed_brokers: [ localhost:9092 ]
+on_partition_mismatch: skip
+`, nil)
+	require.NoError(t, err)
+	_, err = newRedpandaMigratorOffsetsWriterFromConfig(conf, service.MockResources())
+	require.ErrorContains(t, err, "on_partition_mismatch requires input_resource to be set")
+}
+
+func TestRedpandaMigratorOffsetsOutputCommitCoalescing(t *testing.T) {
+	timestamps := [][]int64{
+		{1000, 2000, 3000},
+		{1500, 2500},
+	}
+	commit := func(group string, partition int, timestamp int64, tombstone bool) *service.Message {
+		msg := service.NewMessage(nil)
+		msg.MetaSetMut("kafka_offset_topic", "foo")
+		msg.MetaSetMut("kafka_offset_group", group)
+		msg.MetaSetMut("kafka_offset_partition", strconv.Itoa(partition))
+		msg.MetaSetMut("kafka_offset_commit_timestamp", strconv.FormatInt(timestamp, 10))
+		msg.MetaSetMut("kafka_offset_metadata", "")
+		msg.MetaSetMut("kafka_is_high_watermark", "false")
+		msg.MetaSetMut("kafka_tombstone_message", strconv.FormatBool(tombstone))
+		return msg
+	}
+	newWriter := func(t *testing.T, commitErr error) (*redpandaMigratorOffsetsWriter, *timestampedOffsetsAdminClient) {
+		conf, err := redpandaMigratorOffsetsOutputConfig().ParseYAML(`
+seed_brokers: [ localhost:9092 ]
+max_retries: 1
+backoff:
+  initial_interval: 1ms
+`, nil)
+		require.NoError(t, err)
+		w, err := newRedpandaMigratorOffsetsWriterFromConfig(conf, service.MockResources())
+		require.NoError(t, err)
+		client := &timestampedOffsetsAdminClient{
+			stubOffsetsAdminClient: stubOffsetsAdminClient{commitErr: commitErr},
+			topic:                  "foo",
+			timestamps:             timestamps,
+		}
+		w.client = client
+		return w, client
+	}
+
+	t.Run("one commit per group", func(t *testing.T) {
+		w, client := newWriter(t, nil)
+		batch := service.MessageBatch{
+			commit("bar", 0, 1000, false),
+			commit("bar", 0, 3000, false),
+			commit("baz", 0, 1000, false),
+			commit("bar", 1, 2500, false),
+			// Lower than the offset which precedes it in the batch.
+			commit("bar", 0, 2000, false),
+		}
+		require.NoError(t, w.WriteBatch(context.Background(), batch))
+
+		assert.Equal(t, 2, client.commitRequests)
+		var commits []string
+		for _, o := range client.commits {
+			commits = append(commits, fmt.Sprintf("%d:%d", o.Partition, o.At))
+		}
+		assert.Equal(t, []string{"0:2", "1:1", "0:0"}, commits)
+
+		for i, expected := range []string{"committed", "committed", "committed", "committed", "skipped_rewind"} {
+			result, _ := batch[i].MetaGetMut("offset_commit_result")
+			assert.Equal(t, expected, result, i)
+		}
+		offset, _ := batch[0].MetaGetMut("offset_commit_offset")
+		assert.Equal(t, int64(0), offset)
+		current, _ := batch[4].MetaGetMut("offset_commit_current_offset")
+		assert.Equal(t, int64(2), current)
+	})
+
+	t.Run("offsets are committed before deletions", func(t *testing.T) {
+		w, client := newWriter(t, nil)
+		batch := service.MessageBatch{
+			commit("bar", 0, 1000, false),
+			commit("bar", 0, 0, true),
+			commit("bar", 1, 1500, false),
+		}
+		require.NoError(t, w.WriteBatch(context.Background(), batch))
+		assert.Equal(t, 2, client.commitRequests)
+		assert.Len(t, client.deletes, 1)
+	})
+
+	t.Run("failed commits reject their messages", func(t *testing.T) {
+		w, client := newWriter(t, errors.New("coordinator not available"))
+		batch := service.MessageBatch{
+			commit("bar", 0, 1000, false),
+			commit("bar", 1, 1500, false),
+		}
+		err := w.WriteBatch(context.Background(), batch)
+		require.ErrorContains(t, err, "coordinator not available")
+
+		var batchErr *service.BatchError
+		require.ErrorAs(t, err, &batchErr)
+		assert.Equal(t, 2, batchErr.IndexedErrors())
+		// The commit is retried once.
+		assert.Equal(t, 2, client.commitRequests)
+		_, ok := batch[0].MetaGetMut("offset_commit_result")
+		assert.False(t, ok)
+	})
+}
+
+func TestRedpandaMigratorOffsetsOutputCommitBatchPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      string
+		expected    service.BatchPolicy
+		errContains string
+	}{
+		{
+			name:     "defaults",
+			expected: service.BatchPolicy{Count: 100, Period: "1s"},
+		},
+		{
+			name:     "custom",
+			config:   "commit_interval: 5s\nmax_offsets_per_commit: 1000",
+			expected: service.BatchPolicy{Count: 1000, Period: "5s"},
+		},
+		{
+			name:     "coalescing disabled",
+			config:   "commit_interval: 0s",
+			expected: service.BatchPolicy{Count: 1},
+		},
+		{
+			name:        "max offsets below one",
+			config:      "max_offsets_per_commit: 0",
+			errContains: "max_offsets_per_commit must be at least 1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conf, err := redpandaMigratorOffsetsOutputConfig().ParseYAML("seed_brokers: [ localhost:9092 ]\n"+test.config, nil)
+			require.NoError(t, err)
+			policy, err := offsetsCommitBatchPolicyFromParsed(conf)
+			if test.errContains != "" {
+				require.ErrorContains(t, err, test.errContains)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, policy)
+		})
+	}
+}
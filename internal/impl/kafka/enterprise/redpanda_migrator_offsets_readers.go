@@ -0,0 +1,323 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Jeffail/shutdown"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/kafka"
+)
+
+// offsetsPartitionSelector selects the partitions of the `__consumer_offsets` topic which are read by an input, so that
+// multiple inputs can each read a disjoint subset of them.
+type offsetsPartitionSelector struct {
+	// The partitions which are read, all partitions are read when it's empty.
+	partitions []int32
+	// When splitCount is set, only the partitions whose number modulo splitCount equals splitIndex are read.
+	splitCount int
+	splitIndex int
+}
+
+func offsetsPartitionSelectorFromParsed(conf *service.ParsedConfig) (*offsetsPartitionSelector, error) {
+	var s offsetsPartitionSelector
+	exprs, _ := conf.FieldStringList(rmoiFieldPartitions)
+	for _, expr := range exprs {
+		partitions, err := kafka.ParsePartitions(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", rmoiFieldPartitions, err)
+		}
+		s.partitions = append(s.partitions, partitions...)
+	}
+	if len(exprs) > 0 && len(s.partitions) == 0 {
+		return nil, fmt.Errorf("at least one partition must be specified in %s", rmoiFieldPartitions)
+	}
+
+	if conf.Contains(rmoiFieldPartitionSplit, rmoiFieldPartitionSplitCount) {
+		var err error
+		if s.splitCount, err = conf.FieldInt(rmoiFieldPartitionSplit, rmoiFieldPartitionSplitCount); err != nil {
+			return nil, err
+		}
+		if s.splitIndex, err = conf.FieldInt(rmoiFieldPartitionSplit, rmoiFieldPartitionSplitIndex); err != nil {
+			return nil, err
+		}
+		if s.splitCount < 1 || s.splitIndex < 0 || s.splitIndex >= s.splitCount {
+			return nil, fmt.Errorf("%s.%s must be between 0 and %s.%s - 1", rmoiFieldPartitionSplit, rmoiFieldPartitionSplitIndex, rmoiFieldPartitionSplit, rmoiFieldPartitionSplitCount)
+		}
+	}
+
+	if len(s.partitions) > 0 && s.splitCount > 0 {
+		return nil, fmt.Errorf("only one of %s and %s can be set", rmoiFieldPartitions, rmoiFieldPartitionSplit)
+	}
+	if len(s.partitions) == 0 && s.splitCount == 0 {
+		return nil, nil
+	}
+	return &s, nil
+}
+
+// selects returns true if the partition is read by this input. A nil selector selects all partitions.
+func (s *offsetsPartitionSelector) selects(partition int32) bool {
+	switch {
+	case s == nil:
+		return true
+	case s.splitCount > 0:
+		return int(partition)%s.splitCount == s.splitIndex
+	default:
+		return slices.Contains(s.partitions, partition)
+	}
+}
+
+// assignOffsetsPartitions distributes the selected partitions with their start offsets across the given number of
+// readers, so that each partition is read by exactly one reader and the readers get a similar number of partitions.
+func assignOffsetsPartitions(offsets map[int32]kgo.Offset, selector *offsetsPartitionSelector, readers int) ([]map[int32]kgo.Offset, error) {
+	var partitions []int32
+	for partition := range offsets {
+		if selector.selects(partition) {
+			partitions = append(partitions, partition)
+		}
+	}
+	if len(partitions) == 0 {
+		return nil, fmt.Errorf("none of the partitions of topic %q are selected", consumerOffsetsTopic)
+	}
+	slices.Sort(partitions)
+
+	assigned := make([]map[int32]kgo.Offset, readers)
+	for i := range assigned {
+		assigned[i] = map[int32]kgo.Offset{}
+	}
+	for i, partition := range partitions {
+		assigned[i%readers][partition] = offsets[partition]
+	}
+	return assigned, nil
+}
+
+// listConsumerOffsetsPartitions returns the start of each partition of `__consumer_offsets`.
+func listConsumerOffsetsPartitions(ctx context.Context, clientOpts []kgo.Opt) (map[int32]kgo.Offset, error) {
+	client, err := kgo.NewClient(clientOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka client: %s", err)
+	}
+	defer client.Close()
+
+	startOffsets, err := kadm.NewClient(client).ListStartOffsets(ctx, consumerOffsetsTopic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the partitions of topic %q: %s", consumerOffsetsTopic, err)
+	}
+	if err := startOffsets.Error(); err != nil {
+		return nil, fmt.Errorf("failed to list the partitions of topic %q: %s", consumerOffsetsTopic, err)
+	}
+
+	offsets := map[int32]kgo.Offset{}
+	startOffsets.Each(func(o kadm.ListedOffset) {
+		offsets[o.Partition] = kgo.NewOffset().AtStart()
+	})
+	return offsets, nil
+}
+
+//------------------------------------------------------------------------------
+
+type offsetsReadResult struct {
+	batch service.MessageBatch
+	ack   service.AckFunc
+	err   error
+}
+
+// offsetsReaderPool runs a goroutine for each of the readers of a redpanda_migrator_offsets input, which reads and
+// decodes the batches of its partitions in order and sends them to a shared channel.
+type offsetsReaderPool struct {
+	results chan offsetsReadResult
+	running []atomic.Bool
+	wg      sync.WaitGroup
+	shutSig *shutdown.Signaller
+}
+
+func newOffsetsReaderPool(readers int) *offsetsReaderPool {
+	return &offsetsReaderPool{
+		results: make(chan offsetsReadResult),
+		running: make([]atomic.Bool, readers),
+		shutSig: shutdown.NewSignaller(),
+	}
+}
+
+// start starts the goroutine of the reader at idx unless it's already running. The goroutine stops once the reader
+// disconnects, so that it's started again once the input reconnects.
+func (p *offsetsReaderPool) start(idx int, read func(ctx context.Context) (service.MessageBatch, service.AckFunc, error)) {
+	if p.shutSig.IsSoftStopSignalled() || !p.running[idx].CompareAndSwap(false, true) {
+		return
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		ctx, done := p.shutSig.SoftStopCtx(context.Background())
+		defer done()
+
+		for {
+			batch, ack, err := read(ctx)
+			if ctx.Err() != nil {
+				p.running[idx].Store(false)
+				return
+			}
+			disconnected := errors.Is(err, service.ErrNotConnected)
+			if disconnected {
+				// The input reconnects once it receives the error, so the reader must be startable again before it's
+				// sent.
+				p.running[idx].Store(false)
+			}
+			select {
+			case p.results <- offsetsReadResult{batch, ack, err}:
+			case <-ctx.Done():
+				p.running[idx].Store(false)
+				return
+			}
+			if disconnected {
+				return
+			}
+		}
+	}()
+}
+
+// read returns the next batch read by any of the readers.
+func (p *offsetsReaderPool) read(ctx context.Context) (service.MessageBatch, service.AckFunc, error) {
+	select {
+	case res := <-p.results:
+		return res.batch, res.ack, res.err
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+}
+
+// stop stops all goroutines and waits for them to exit.
+func (p *offsetsReaderPool) stop(ctx context.Context) error {
+	p.shutSig.TriggerSoftStop()
+
+	stopped := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//------------------------------------------------------------------------------
+
+func (rmoi *redpandaMigratorOffsetsInput) Connect(ctx context.Context) error {
+	var offsets map[int32]kgo.Offset
+	if rmoi.checkpointer != nil && rmoi.startFrom == rmoiStartFromCheckpoint {
+		var err error
+		if offsets, err = rmoi.checkpointer.startOffsets(ctx, rmoi.clientOpts); err != nil {
+			return err
+		}
+	} else if rmoi.partitionSelector != nil || len(rmoi.readers) > 1 {
+		var err error
+		if offsets, err = listConsumerOffsetsPartitions(ctx, rmoi.clientOpts); err != nil {
+			return err
+		}
+	}
+
+	if offsets != nil {
+		assigned, err := assignOffsetsPartitions(offsets, rmoi.partitionSelector, len(rmoi.readers))
+		if err != nil {
+			return err
+		}
+		rmoi.readerOffsets = assigned
+	}
+
+	for idx, reader := range rmoi.readers {
+		if err := reader.Connect(ctx); err != nil {
+			return err
+		}
+		if rmoi.readerPool != nil {
+			rmoi.readerPool.start(idx, func(ctx context.Context) (service.MessageBatch, service.AckFunc, error) {
+				return rmoi.readDecoded(ctx, ctx, reader)
+			})
+		}
+	}
+	return nil
+}
+
+// readerClientOpts returns the client options of the reader at idx, which consumes the partitions assigned to it or
+// the whole `__consumer_offsets` topic when partitions aren't assigned.
+func (rmoi *redpandaMigratorOffsetsInput) readerClientOpts(idx int) []kgo.Opt {
+	// Consume messages from the `__consumer_offsets` topic and configure `start_from_oldest: true`. The offsets which
+	// are committed within aborted transactions are skipped by reading committed records only.
+	opts := append(slices.Clone(rmoi.clientOpts),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+		kgo.FetchIsolationLevel(kgo.ReadCommitted()),
+	)
+	if rmoi.readerOffsets != nil {
+		return append(opts, kgo.ConsumePartitions(map[string]map[int32]kgo.Offset{consumerOffsetsTopic: rmoi.readerOffsets[idx]}))
+	}
+	return append(opts, kgo.ConsumeTopics(consumerOffsetsTopic))
+}
+
+// readDecoded reads the next batch from reader which contains at least one message to emit after decoding it, which are
+// only the offset commits of the configured topics in the decode mode. The batch is read with readCtx and decoded with ctx.
+func (rmoi *redpandaMigratorOffsetsInput) readDecoded(ctx, readCtx context.Context, reader *kafka.FranzReaderOrdered) (service.MessageBatch, service.AckFunc, error) {
+	for {
+		batch, ack, err := reader.ReadBatch(readCtx)
+		if err != nil {
+			return nil, nil, err
+		}
+		ack = rmoi.checkpointer.track(batch, ack)
+
+		if batch, err = rmoi.decodeOffsets(ctx, batch); err != nil {
+			// The reader doesn't deliver the batch again, so it must be acknowledged to release its records from the
+			// checkpoint, which would otherwise never advance again.
+			_ = ack(ctx, nil)
+			return nil, nil, err
+		}
+
+		if len(batch) == 0 {
+			_ = ack(ctx, nil) // TODO: Log this error?
+			continue
+		}
+
+		return batch, ack, nil
+	}
+}
+
+// readNext returns the next decoded batch of any of the readers.
+func (rmoi *redpandaMigratorOffsetsInput) readNext(ctx, readCtx context.Context) (service.MessageBatch, service.AckFunc, error) {
+	if rmoi.readerPool != nil {
+		return rmoi.readerPool.read(readCtx)
+	}
+	return rmoi.readDecoded(ctx, readCtx, rmoi.readers[0])
+}
+
+func (rmoi *redpandaMigratorOffsetsInput) Close(ctx context.Context) error {
+	var errs []error
+	if rmoi.readerPool != nil {
+		if err := rmoi.readerPool.stop(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, reader := range rmoi.readers {
+		if err := reader.Close(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,303 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestOffsetsPartitionSelectorFromParsed(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      string
+		expected    *offsetsPartitionSelector
+		errContains string
+	}{
+		{
+			name:   "no selection",
+			config: `topics: [ foo ]`,
+		},
+		{
+			name: "partitions",
+			config: `
+topics: [ foo ]
+partitions: [ "0", "3-5" ]
+`,
+			expected: &offsetsPartitionSelector{partitions: []int32{0, 3, 4, 5}},
+		},
+		{
+			name: "partition split",
+			config: `
+topics: [ foo ]
+partition_split:
+  count: 4
+  index: 3
+`,
+			expected: &offsetsPartitionSelector{splitCount: 4, splitIndex: 3},
+		},
+		{
+			name: "invalid partitions",
+			config: `
+topics: [ foo ]
+partitions: [ "a-3" ]
+`,
+			errContains: "invalid partitions",
+		},
+		{
+			name: "partition split index out of range",
+			config: `
+topics: [ foo ]
+partition_split:
+  count: 4
+  index: 4
+`,
+			errContains: "partition_split.index must be between 0 and partition_split.count - 1",
+		},
+	}
+
+	spec := redpandaMigratorOffsetsInputConfig()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conf, err := spec.ParseYAML(test.config, nil)
+			require.NoError(t, err)
+
+			selector, err := offsetsPartitionSelectorFromParsed(conf)
+			if test.errContains != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.errContains)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, selector)
+		})
+	}
+}
+
+func TestAssignOffsetsPartitions(t *testing.T) {
+	offsets := map[int32]kgo.Offset{}
+	for p := range int32(10) {
+		offsets[p] = kgo.NewOffset().At(int64(p) * 100)
+	}
+
+	tests := []struct {
+		name     string
+		selector *offsetsPartitionSelector
+		readers  int
+		expected [][]int32
+	}{
+		{
+			name:     "all partitions single reader",
+			readers:  1,
+			expected: [][]int32{{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		},
+		{
+			name:     "all partitions multiple readers",
+			readers:  3,
+			expected: [][]int32{{0, 3, 6, 9}, {1, 4, 7}, {2, 5, 8}},
+		},
+		{
+			name:     "explicit partitions",
+			selector: &offsetsPartitionSelector{partitions: []int32{2, 7, 8, 42}},
+			readers:  2,
+			expected: [][]int32{{2, 8}, {7}},
+		},
+		{
+			name:     "partition split",
+			selector: &offsetsPartitionSelector{splitCount: 3, splitIndex: 1},
+			readers:  2,
+			expected: [][]int32{{1, 7}, {4}},
+		},
+		{
+			name:     "more readers than partitions",
+			selector: &offsetsPartitionSelector{partitions: []int32{5}},
+			readers:  2,
+			expected: [][]int32{{5}, {}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assigned, err := assignOffsetsPartitions(offsets, test.selector, test.readers)
+			require.NoError(t, err)
+			require.Len(t, assigned, test.readers)
+
+			for i, partitions := range test.expected {
+				require.Len(t, assigned[i], len(partitions))
+				for _, p := range partitions {
+					assert.Equal(t, offsets[p], assigned[i][p])
+				}
+			}
+		})
+	}
+
+	_, err := assignOffsetsPartitions(offsets, &offsetsPartitionSelector{partitions: []int32{42}}, 1)
+	require.ErrorContains(t, err, "none of the partitions")
+}
+
+func TestOffsetsReaderPool(t *testing.T) {
+	pool := newOffsetsReaderPool(2)
+
+	var reads [2]atomic.Int64
+	read := func(idx int) func(ctx context.Context) (service.MessageBatch, service.AckFunc, error) {
+		return func(ctx context.Context) (service.MessageBatch, service.AckFunc, error) {
+			if reads[idx].Add(1) > 3 {
+				return nil, nil, service.ErrNotConnected
+			}
+			return service.MessageBatch{service.NewMessage([]byte{byte(idx)})}, nil, nil
+		}
+	}
+	pool.start(0, read(0))
+	pool.start(1, read(1))
+	// Starting a running reader is a no-op.
+	pool.start(1, read(1))
+
+	var received [2]int
+	var disconnected int
+	for disconnected < 2 {
+		batch, _, err := pool.read(context.Background())
+		if errors.Is(err, service.ErrNotConnected) {
+			disconnected++
+			continue
+		}
+		require.NoError(t, err)
+		b, err := batch[0].AsBytes()
+		require.NoError(t, err)
+		received[b[0]]++
+	}
+	assert.Equal(t, [2]int{3, 3}, received)
+
+	// Disconnected readers are started again.
+	reads[0].Store(0)
+	pool.start(0, read(0))
+	batch, _, err := pool.read(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, batch, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, pool.stop(ctx))
+
+	_, _, err = pool.read(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestOffsetsReaderClientOpts(t *testing.T) {
+	rmoi := redpandaMigratorOffsetsInput{
+		clientOpts:    []kgo.Opt{kgo.SeedBrokers("localhost:9092")},
+		readerOffsets: []map[int32]kgo.Offset{{0: kgo.NewOffset().At(5)}, {1: kgo.NewOffset().AtStart()}},
+	}
+
+	client, err := kgo.NewClient(rmoi.readerClientOpts(1)...)
+	require.NoError(t, err)
+	defer client.Close()
+
+	// Offsets committed within aborted transactions are never read.
+	assert.Equal(t, int8(1), client.OptValue(kgo.FetchIsolationLevel), "read_committed")
+	assert.Equal(t, map[string]map[int32]kgo.Offset{consumerOffsetsTopic: {1: kgo.NewOffset().AtStart()}}, client.OptValue(kgo.ConsumePartitions))
+	assert.Len(t, rmoi.clientOpts, 1, "the shared client options are not modified")
+}
+
+func TestRedpandaMigratorOffsetsInputPartitionLinting(t *testing.T) {
+	configTests := []struct {
+		name        string
+		config      string
+		errContains string
+	}{
+		{
+			name: "partitions and parallelism",
+			config: `
+redpanda_migrator_offsets:
+  seed_brokers: [ localhost:9092 ]
+  topics: [ foo ]
+  partitions: [ 0-24 ]
+  parallelism: 4
+`,
+		},
+		{
+			name: "partition split",
+			config: `
+redpanda_migrator_offsets:
+  seed_brokers: [ localhost:9092 ]
+  topics: [ foo ]
+  partition_split:
+    count: 2
+    index: 1
+`,
+		},
+		{
+			name: "partitions and partition split",
+			config: `
+redpanda_migrator_offsets:
+  seed_brokers: [ localhost:9092 ]
+  topics: [ foo ]
+  partitions: [ 0-24 ]
+  partition_split:
+    count: 2
+    index: 1
+`,
+			errContains: "only one of partitions and partition_split can be set",
+		},
+		{
+			name: "partition split index out of range",
+			config: `
+redpanda_migrator_offsets:
+  seed_brokers: [ localhost:9092 ]
+  topics: [ foo ]
+  partition_split:
+    count: 2
+    index: 2
+`,
+			errContains: "partition_split.index must be between 0 and partition_split.count - 1",
+		},
+		{
+			name: "parallelism with consumer group",
+			config: `
+redpanda_migrator_offsets:
+  seed_brokers: [ localhost:9092 ]
+  topics: [ foo ]
+  consumer_group: migrator
+  parallelism: 2
+`,
+			errContains: "partitions, partition_split and parallelism cannot be set when a consumer_group is set",
+		},
+		{
+			name: "invalid parallelism",
+			config: `
+redpanda_migrator_offsets:
+  seed_brokers: [ localhost:9092 ]
+  topics: [ foo ]
+  parallelism: 0
+`,
+			errContains: "parallelism must be at least 1",
+		},
+	}
+
+	env := service.NewEnvironment()
+	for _, test := range configTests {
+		t.Run(test.name, func(t *testing.T) {
+			strm := env.NewStreamBuilder()
+			err := strm.AddInputYAML(test.config)
+			if test.errContains == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.errContains)
+			}
+		})
+	}
+}
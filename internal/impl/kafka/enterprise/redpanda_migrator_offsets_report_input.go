@@ -0,0 +1,584 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/kafka"
+)
+
+const (
+	rmoriFieldDestination    = "destination"
+	rmoriFieldGroups         = "groups"
+	rmoriFieldRequestTimeout = "request_timeout"
+)
+
+const (
+	rmoriDiscrepancyMissingGroup      = "missing_group"
+	rmoriDiscrepancyMissingPartition  = "missing_partition"
+	rmoriDiscrepancyOffsetBehind      = "offset_behind"
+	rmoriDiscrepancyTranslationFailed = "translation_failed"
+)
+
+func redpandaMigratorOffsetsReportInputConfig() *service.ConfigSpec {
+	return service.NewConfigSpec().
+		Beta().
+		Categories("Services").
+		Version("4.50.0").
+		Summary(`Compares the consumer group offsets of a source and a destination cluster once and emits a report of the offsets which have not been migrated.`).
+		Description(`
+This input checks the completeness of a consumer group offsets migration which was performed by the ` + "`redpanda_migrator_offsets`" + `
+input and output. It lists the consumer groups of the source cluster and their committed offsets for the matching topics,
+translates each committed offset to the offset of the destination topic partition in the same way as the
+` + "`redpanda_migrator_offsets`" + ` output and compares it with the offset committed by the destination consumer group.
+
+Once the comparison is complete, this input emits a single batch and then shuts down. The batch contains one JSON message
+for each discrepancy, followed by a summary message:
+
+` + "```json" + `
+{"type":"offset_behind","source_group":"foo","destination_group":"foo","topic":"bar","destination_topic":"bar","partition":3,"source_offset":42,"expected_offset":40,"destination_offset":38}
+{"type":"summary","source_groups":1,"destination_groups":1,"partitions":12,"skipped_partitions":0,"missing_groups":0,"missing_partitions":0,"offsets_behind":1,"translation_failures":0,"complete":false}
+` + "```" + `
+
+The ` + "`type`" + ` of a discrepancy is one of:
+
+- ` + "`missing_group`" + `: The destination consumer group has no committed offsets. The partitions of the group are not
+  reported individually.
+- ` + "`missing_partition`" + `: The destination consumer group has no committed offset for the partition.
+- ` + "`offset_behind`" + `: The offset committed by the destination consumer group is lower than the translated offset.
+- ` + "`translation_failed`" + `: The committed offset could not be translated, usually because the record at the committed
+  offset has not been replicated to the destination cluster yet. The ` + "`error`" + ` field describes the failure.
+
+The ` + "`topics`" + `, ` + "`regexp_topics`" + ` and ` + "`exclude_topics`" + ` fields should match those of the
+` + "`redpanda_migrator_offsets`" + ` input and the ` + "`topic_prefix`" + `, ` + "`group_mapping`" + ` and ` + "`group_renames`" + `
+fields should match those of the ` + "`redpanda_migrator_offsets`" + ` output, so that the report covers exactly the offsets
+which were migrated. Partitions whose group is skipped by the group mapping are counted in the summary, but are not
+compared.
+`).
+		Fields(redpandaMigratorOffsetsReportInputConfigFields()...).
+		LintRule(excludeTopicsLintRule + `
+root = if this.exists("` + rmooFieldGroupMapping + `") && this.` + rmooFieldGroupRenames + `.or({}).length() > 0 {
+  "only one of ` + rmooFieldGroupMapping + ` and ` + rmooFieldGroupRenames + ` can be set"
+}
+`)
+}
+
+func redpandaMigratorOffsetsReportInputConfigFields() []*service.ConfigField {
+	return slices.Concat(
+		kafka.FranzConnectionFields(),
+		[]*service.ConfigField{
+			service.NewObjectField(rmoriFieldDestination, kafka.FranzConnectionFields()...).
+				Description("The connection details of the destination cluster."),
+			service.NewStringListField(rmoiFieldTopics).
+				Description(`
+A list of topics whose committed offsets are compared. Multiple comma separated topics can be listed in a single element.`).
+				Example([]string{"foo", "bar"}).
+				Example([]string{"things.*"}).
+				Example([]string{"foo,bar"}).
+				LintRule(`if this.length() == 0 { ["at least one topic must be specified"] }`),
+			service.NewBoolField(rmoiFieldRegexpTopics).
+				Description("Whether listed topics should be interpreted as regular expression patterns for matching multiple topics.").
+				Default(false),
+			excludeTopicsField(),
+			service.NewStringListField(rmoriFieldGroups).
+				Description("A list of regular expression patterns which restrict the source consumer groups that are compared. All consumer groups are compared when it's empty.").
+				Example([]string{"^orders-.*"}).
+				Default([]string{}),
+			service.NewStringField(rmooFieldTopicPrefix).
+				Description("The prefix which was prepended to the topics in the destination cluster. This should match the `topic_prefix` of the `redpanda_migrator_offsets` output.").
+				Example("clusterA.").
+				Default("").
+				Advanced(),
+			service.NewBloblangField(rmooFieldGroupMapping).
+				Description("The xref:guides:bloblang/about.adoc[Bloblang mapping] which was used for renaming consumer groups in the destination cluster. This should match the `group_mapping` of the `redpanda_migrator_offsets` output.").
+				Example(`root = this.group.trim_prefix("prod-")`).
+				Optional().
+				Advanced(),
+			service.NewStringMapField(rmooFieldGroupRenames).
+				Description("The map of source consumer group names to the names which were used in the destination cluster. This should match the `group_renames` of the `redpanda_migrator_offsets` output.").
+				Example(map[string]any{"prod-orders-service": "orders-service"}).
+				Default(map[string]any{}).
+				Advanced(),
+			service.NewDurationField(rmoriFieldRequestTimeout).
+				Description("The maximum amount of time to wait for each request to either cluster.").
+				Default("15s").
+				Advanced(),
+		},
+	)
+}
+
+func init() {
+	err := service.RegisterBatchInput("redpanda_migrator_offsets_report", redpandaMigratorOffsetsReportInputConfig(),
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.BatchInput, error) {
+			return newRedpandaMigratorOffsetsReportInputFromConfig(conf, mgr)
+		})
+	if err != nil {
+		panic(err)
+	}
+}
+
+//------------------------------------------------------------------------------
+
+type redpandaMigratorOffsetsReportInput struct {
+	sourceOpts      []kgo.Opt
+	destinationOpts []kgo.Opt
+	topics          *topicMatcher
+	excludedTopics  *topicMatcher
+	groupPatterns   []*regexp.Regexp
+	topicPrefix     string
+	groupMapper     *consumerGroupMapper
+	requestTimeout  time.Duration
+
+	mut         sync.Mutex
+	source      *kgo.Client
+	destination *kgo.Client
+	done        bool
+
+	log *service.Logger
+}
+
+func newRedpandaMigratorOffsetsReportInputFromConfig(conf *service.ParsedConfig, mgr *service.Resources) (*redpandaMigratorOffsetsReportInput, error) {
+	i := redpandaMigratorOffsetsReportInput{
+		log: mgr.Logger(),
+	}
+
+	var err error
+	if i.sourceOpts, err = kafka.FranzConnectionOptsFromConfig(conf, mgr.Logger()); err != nil {
+		return nil, err
+	}
+	if i.destinationOpts, err = kafka.FranzConnectionOptsFromConfig(conf.Namespace(rmoriFieldDestination), mgr.Logger()); err != nil {
+		return nil, err
+	}
+
+	topicList, err := conf.FieldStringList(rmoiFieldTopics)
+	if err != nil {
+		return nil, err
+	}
+	topics, _, err := kafka.ParseTopics(topicList, -1, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(topics) == 0 {
+		return nil, errors.New("at least one topic must be specified")
+	}
+	regexpTopics, err := conf.FieldBool(rmoiFieldRegexpTopics)
+	if err != nil {
+		return nil, err
+	}
+	if i.topics, err = newTopicMatcher(topics, regexpTopics); err != nil {
+		return nil, err
+	}
+	if i.excludedTopics, err = excludedTopicsFromParsed(conf); err != nil {
+		return nil, err
+	}
+
+	groups, err := conf.FieldStringList(rmoriFieldGroups)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		gp, err := regexp.Compile(group)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile group regex %q: %s", group, err)
+		}
+		i.groupPatterns = append(i.groupPatterns, gp)
+	}
+
+	if i.topicPrefix, err = conf.FieldString(rmooFieldTopicPrefix); err != nil {
+		return nil, err
+	}
+
+	if conf.Contains(rmooFieldGroupMapping) {
+		i.groupMapper = &consumerGroupMapper{}
+		if i.groupMapper.mapping, err = conf.FieldBloblang(rmooFieldGroupMapping); err != nil {
+			return nil, err
+		}
+	}
+	renames, err := conf.FieldStringMap(rmooFieldGroupRenames)
+	if err != nil {
+		return nil, err
+	}
+	if len(renames) > 0 {
+		if i.groupMapper != nil {
+			return nil, fmt.Errorf("only one of %s and %s can be set", rmooFieldGroupMapping, rmooFieldGroupRenames)
+		}
+		i.groupMapper = &consumerGroupMapper{renames: renames}
+	}
+
+	if i.requestTimeout, err = conf.FieldDuration(rmoriFieldRequestTimeout); err != nil {
+		return nil, err
+	}
+
+	return &i, nil
+}
+
+func (i *redpandaMigratorOffsetsReportInput) Connect(ctx context.Context) error {
+	i.mut.Lock()
+	defer i.mut.Unlock()
+
+	if i.done {
+		return service.ErrEndOfInput
+	}
+	if i.source != nil {
+		return nil
+	}
+
+	source, err := i.connectClient(ctx, i.sourceOpts)
+	if err != nil {
+		return fmt.Errorf("failed to connect to the source cluster: %s", err)
+	}
+	destination, err := i.connectClient(ctx, i.destinationOpts)
+	if err != nil {
+		source.Close()
+		return fmt.Errorf("failed to connect to the destination cluster: %s", err)
+	}
+
+	i.source, i.destination = source, destination
+	return nil
+}
+
+func (i *redpandaMigratorOffsetsReportInput) connectClient(ctx context.Context, opts []kgo.Opt) (*kgo.Client, error) {
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, done := context.WithTimeout(ctx, i.requestTimeout)
+	defer done()
+
+	if err := client.Ping(ctx); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+func (i *redpandaMigratorOffsetsReportInput) ReadBatch(ctx context.Context) (service.MessageBatch, service.AckFunc, error) {
+	i.mut.Lock()
+	defer i.mut.Unlock()
+
+	if i.done {
+		return nil, nil, service.ErrEndOfInput
+	}
+	if i.source == nil {
+		return nil, nil, service.ErrNotConnected
+	}
+
+	discrepancies, summary, err := i.report(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	batch := make(service.MessageBatch, 0, len(discrepancies)+1)
+	for _, d := range discrepancies {
+		data, err := json.Marshal(d)
+		if err != nil {
+			return nil, nil, err
+		}
+		batch = append(batch, service.NewMessage(data))
+	}
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return nil, nil, err
+	}
+	batch = append(batch, service.NewMessage(data))
+
+	i.log.Infof(
+		"Compared the offsets of %d partitions: %d missing groups, %d missing partitions, %d offsets behind and %d translation failures",
+		summary.Partitions, summary.MissingGroups, summary.MissingPartitions, summary.OffsetsBehind, summary.TranslationFailures,
+	)
+
+	i.done = true
+	return batch, func(context.Context, error) error { return nil }, nil
+}
+
+func (i *redpandaMigratorOffsetsReportInput) Close(context.Context) error {
+	i.mut.Lock()
+	defer i.mut.Unlock()
+
+	if i.source != nil {
+		i.source.Close()
+		i.source = nil
+	}
+	if i.destination != nil {
+		i.destination.Close()
+		i.destination = nil
+	}
+	return nil
+}
+
+// report compares the committed offsets of the source and destination consumer groups.
+func (i *redpandaMigratorOffsetsReportInput) report(ctx context.Context) ([]offsetsDiscrepancy, offsetsReportSummary, error) {
+	sourceAdm := kadm.NewClient(i.source)
+	destinationAdm := kadm.NewClient(i.destination)
+
+	listCtx, done := context.WithTimeout(ctx, i.requestTimeout)
+	listed, err := sourceAdm.ListGroups(listCtx)
+	done()
+	if err != nil {
+		return nil, offsetsReportSummary{}, fmt.Errorf("failed to list the source consumer groups: %s", err)
+	}
+
+	var groups []string
+	for _, group := range listed.Groups() {
+		if len(i.groupPatterns) == 0 || slices.ContainsFunc(i.groupPatterns, func(gp *regexp.Regexp) bool {
+			return gp.MatchString(group)
+		}) {
+			groups = append(groups, group)
+		}
+	}
+
+	source, err := i.fetchGroupOffsets(ctx, sourceAdm, groups)
+	if err != nil {
+		return nil, offsetsReportSummary{}, fmt.Errorf("failed to fetch the source consumer group offsets: %s", err)
+	}
+	for group, offsets := range source {
+		offsets.DeleteFunc(func(o kadm.Offset) bool {
+			return !i.matchesTopic(o.Topic)
+		})
+		source[group] = offsets
+	}
+
+	commits, skipped, err := expectedGroupCommits(source, i.groupMapper, i.topicPrefix)
+	if err != nil {
+		return nil, offsetsReportSummary{}, err
+	}
+
+	destinationGroups := map[string]struct{}{}
+	for _, c := range commits {
+		destinationGroups[c.destinationGroup] = struct{}{}
+	}
+	destination, err := i.fetchGroupOffsets(ctx, destinationAdm, slices.Sorted(maps.Keys(destinationGroups)))
+	if err != nil {
+		return nil, offsetsReportSummary{}, fmt.Errorf("failed to fetch the destination consumer group offsets: %s", err)
+	}
+
+	// Several groups usually commit the same offsets of a topic partition, so the translations are cached.
+	type translationKey struct {
+		topic     string
+		partition int32
+		offset    int64
+	}
+	type translation struct {
+		offset int64
+		err    error
+	}
+	translations := map[translationKey]translation{}
+	translate := func(topic string, partition int32, offset int64) (int64, error) {
+		key := translationKey{topic: topic, partition: partition, offset: offset}
+		if t, exists := translations[key]; exists {
+			return t.offset, t.err
+		}
+		var t translation
+		t.offset, t.err = i.translateOffset(ctx, destinationAdm, topic, partition, offset)
+		translations[key] = t
+		return t.offset, t.err
+	}
+
+	discrepancies, summary := compareGroupCommits(commits, destination, translate)
+	summary.SourceGroups = len(source)
+	summary.SkippedPartitions = skipped
+	return discrepancies, summary, nil
+}
+
+func (i *redpandaMigratorOffsetsReportInput) matchesTopic(topic string) bool {
+	return i.topics.matches(topic) && !i.excludedTopics.matches(topic)
+}
+
+// fetchGroupOffsets returns the committed offsets of the given consumer groups. Groups without committed offsets are
+// included with empty offsets.
+func (i *redpandaMigratorOffsetsReportInput) fetchGroupOffsets(ctx context.Context, adm *kadm.Client, groups []string) (map[string]kadm.Offsets, error) {
+	ctx, done := context.WithTimeout(ctx, i.requestTimeout)
+	defer done()
+
+	resps := adm.FetchManyOffsets(ctx, groups...)
+	if err := resps.Error(); err != nil {
+		return nil, err
+	}
+
+	offsets := make(map[string]kadm.Offsets, len(groups))
+	for _, group := range groups {
+		offsets[group] = resps[group].Fetched.Offsets()
+	}
+	return offsets, nil
+}
+
+// translateOffset returns the destination offset which corresponds to an offset committed in the source cluster.
+func (i *redpandaMigratorOffsetsReportInput) translateOffset(ctx context.Context, destinationAdm *kadm.Client, topic string, partition int32, offset int64) (int64, error) {
+	// Consumers which committed the start of an empty partition have nothing to translate.
+	if offset == 0 {
+		return 0, nil
+	}
+
+	ctx, done := context.WithTimeout(ctx, i.requestTimeout)
+	defer done()
+
+	timestamp, isHighWatermark, err := fetchCommittedOffsetTimestamp(ctx, i.sourceOpts, topic, partition, offset)
+	if err != nil {
+		return 0, err
+	}
+	return translateCommittedOffset(ctx, destinationAdm, i.topicPrefix+topic, partition, timestamp, isHighWatermark)
+}
+
+//------------------------------------------------------------------------------
+
+// groupCommit is an offset committed by a source consumer group along with the destination group and topic which it's
+// expected to be migrated to.
+type groupCommit struct {
+	sourceGroup      string
+	destinationGroup string
+	topic            string
+	destinationTopic string
+	partition        int32
+	offset           int64
+}
+
+// offsetsDiscrepancy is the payload of the messages which report offsets that have not been migrated.
+type offsetsDiscrepancy struct {
+	Type              string `json:"type"`
+	SourceGroup       string `json:"source_group"`
+	DestinationGroup  string `json:"destination_group"`
+	Topic             string `json:"topic,omitempty"`
+	DestinationTopic  string `json:"destination_topic,omitempty"`
+	Partition         *int32 `json:"partition,omitempty"`
+	SourceOffset      *int64 `json:"source_offset,omitempty"`
+	ExpectedOffset    *int64 `json:"expected_offset,omitempty"`
+	DestinationOffset *int64 `json:"destination_offset,omitempty"`
+	Error             string `json:"error,omitempty"`
+}
+
+// offsetsReportSummary is the payload of the last message of a report.
+type offsetsReportSummary struct {
+	Type                string `json:"type"`
+	SourceGroups        int    `json:"source_groups"`
+	DestinationGroups   int    `json:"destination_groups"`
+	Partitions          int    `json:"partitions"`
+	SkippedPartitions   int    `json:"skipped_partitions"`
+	MissingGroups       int    `json:"missing_groups"`
+	MissingPartitions   int    `json:"missing_partitions"`
+	OffsetsBehind       int    `json:"offsets_behind"`
+	TranslationFailures int    `json:"translation_failures"`
+	Complete            bool   `json:"complete"`
+}
+
+// expectedGroupCommits maps the offsets committed by the source consumer groups to the destination groups and topics,
+// sorted by group, topic and partition. It also returns the number of partitions which are skipped by the group mapping.
+func expectedGroupCommits(source map[string]kadm.Offsets, mapper *consumerGroupMapper, topicPrefix string) (commits []groupCommit, skipped int, err error) {
+	for _, group := range slices.Sorted(maps.Keys(source)) {
+		for _, o := range source[group].Sorted() {
+			if o.At < 0 {
+				continue
+			}
+			destinationGroup, err := mapper.mapGroup(group, o.Topic)
+			if err != nil {
+				return nil, 0, fmt.Errorf("failed to map offset group %q for topic %q: %w", group, o.Topic, err)
+			}
+			if destinationGroup == "" {
+				skipped++
+				continue
+			}
+			commits = append(commits, groupCommit{
+				sourceGroup:      group,
+				destinationGroup: destinationGroup,
+				topic:            o.Topic,
+				destinationTopic: topicPrefix + o.Topic,
+				partition:        o.Partition,
+				offset:           o.At,
+			})
+		}
+	}
+	return commits, skipped, nil
+}
+
+// compareGroupCommits compares the expected commits with the offsets committed by the destination consumer groups and
+// returns the discrepancies along with a summary. The translate function returns the destination offset which
+// corresponds to an offset committed in the source cluster and it's only called for partitions which have an offset
+// committed in the destination cluster.
+func compareGroupCommits(
+	commits []groupCommit,
+	destination map[string]kadm.Offsets,
+	translate func(topic string, partition int32, offset int64) (int64, error),
+) ([]offsetsDiscrepancy, offsetsReportSummary) {
+	summary := offsetsReportSummary{Type: "summary"}
+	var discrepancies []offsetsDiscrepancy
+
+	destinationGroups := map[string]struct{}{}
+	missingGroups := map[[2]string]struct{}{}
+	for _, c := range commits {
+		summary.Partitions++
+		destinationGroups[c.destinationGroup] = struct{}{}
+
+		if len(destination[c.destinationGroup]) == 0 {
+			key := [2]string{c.sourceGroup, c.destinationGroup}
+			if _, exists := missingGroups[key]; !exists {
+				missingGroups[key] = struct{}{}
+				discrepancies = append(discrepancies, offsetsDiscrepancy{
+					Type:             rmoriDiscrepancyMissingGroup,
+					SourceGroup:      c.sourceGroup,
+					DestinationGroup: c.destinationGroup,
+				})
+			}
+			continue
+		}
+
+		partition, sourceOffset := c.partition, c.offset
+		d := offsetsDiscrepancy{
+			SourceGroup:      c.sourceGroup,
+			DestinationGroup: c.destinationGroup,
+			Topic:            c.topic,
+			DestinationTopic: c.destinationTopic,
+			Partition:        &partition,
+			SourceOffset:     &sourceOffset,
+		}
+
+		committed, exists := destination[c.destinationGroup].Lookup(c.destinationTopic, c.partition)
+		if !exists || committed.At < 0 {
+			d.Type = rmoriDiscrepancyMissingPartition
+			discrepancies = append(discrepancies, d)
+			summary.MissingPartitions++
+			continue
+		}
+		destinationOffset := committed.At
+		d.DestinationOffset = &destinationOffset
+
+		expectedOffset, err := translate(c.topic, c.partition, c.offset)
+		if err != nil {
+			d.Type = rmoriDiscrepancyTranslationFailed
+			d.Error = err.Error()
+			discrepancies = append(discrepancies, d)
+			summary.TranslationFailures++
+			continue
+		}
+		if destinationOffset < expectedOffset {
+			d.Type = rmoriDiscrepancyOffsetBehind
+			d.ExpectedOffset = &expectedOffset
+			discrepancies = append(discrepancies, d)
+			summary.OffsetsBehind++
+		}
+	}
+
+	summary.DestinationGroups = len(destinationGroups)
+	summary.MissingGroups = len(missingGroups)
+	summary.Complete = len(discrepancies) == 0
+	return discrepancies, summary
+}
@@ -0,0 +1,196 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kadm"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+func testOffsets(offsets ...kadm.Offset) kadm.Offsets {
+	os := kadm.Offsets{}
+	for _, o := range offsets {
+		os.Add(o)
+	}
+	return os
+}
+
+func TestExpectedGroupCommits(t *testing.T) {
+	source := map[string]kadm.Offsets{
+		"prod-orders": testOffsets(
+			kadm.Offset{Topic: "orders", Partition: 1, At: 10},
+			kadm.Offset{Topic: "orders", Partition: 0, At: 5},
+			kadm.Offset{Topic: "payments", Partition: 0, At: -1},
+		),
+		"prod-legacy": testOffsets(
+			kadm.Offset{Topic: "orders", Partition: 0, At: 3},
+		),
+		"billing": testOffsets(
+			kadm.Offset{Topic: "invoices", Partition: 2, At: 7},
+		),
+	}
+	mapper := &consumerGroupMapper{renames: map[string]string{
+		"prod-orders": "orders",
+		"prod-legacy": "",
+	}}
+
+	commits, skipped, err := expectedGroupCommits(source, mapper, "clusterA.")
+	require.NoError(t, err)
+	assert.Equal(t, 1, skipped)
+	assert.Equal(t, []groupCommit{
+		{sourceGroup: "billing", destinationGroup: "billing", topic: "invoices", destinationTopic: "clusterA.invoices", partition: 2, offset: 7},
+		{sourceGroup: "prod-orders", destinationGroup: "orders", topic: "orders", destinationTopic: "clusterA.orders", partition: 0, offset: 5},
+		{sourceGroup: "prod-orders", destinationGroup: "orders", topic: "orders", destinationTopic: "clusterA.orders", partition: 1, offset: 10},
+	}, commits)
+}
+
+func TestCompareGroupCommits(t *testing.T) {
+	commits := []groupCommit{
+		{sourceGroup: "foo", destinationGroup: "foo", topic: "a", destinationTopic: "a", partition: 0, offset: 10},
+		{sourceGroup: "foo", destinationGroup: "foo", topic: "a", destinationTopic: "a", partition: 1, offset: 20},
+		{sourceGroup: "foo", destinationGroup: "foo", topic: "a", destinationTopic: "a", partition: 2, offset: 30},
+		{sourceGroup: "foo", destinationGroup: "foo", topic: "a", destinationTopic: "a", partition: 3, offset: 40},
+		{sourceGroup: "bar", destinationGroup: "baz", topic: "a", destinationTopic: "a", partition: 0, offset: 10},
+		{sourceGroup: "bar", destinationGroup: "baz", topic: "a", destinationTopic: "a", partition: 1, offset: 20},
+	}
+	destination := map[string]kadm.Offsets{
+		"foo": testOffsets(
+			kadm.Offset{Topic: "a", Partition: 0, At: 9},
+			kadm.Offset{Topic: "a", Partition: 1, At: 17},
+			kadm.Offset{Topic: "a", Partition: 3, At: 40},
+		),
+		"baz": {},
+	}
+
+	var translated []int32
+	translate := func(topic string, partition int32, offset int64) (int64, error) {
+		translated = append(translated, partition)
+		if partition == 3 {
+			return 0, errors.New("record not yet replicated")
+		}
+		return offset - 1, nil
+	}
+
+	discrepancies, summary := compareGroupCommits(commits, destination, translate)
+	assert.Equal(t, []int32{0, 1, 3}, translated)
+
+	var types []string
+	for _, d := range discrepancies {
+		types = append(types, d.Type)
+	}
+	assert.Equal(t, []string{
+		rmoriDiscrepancyOffsetBehind,
+		rmoriDiscrepancyMissingPartition,
+		rmoriDiscrepancyTranslationFailed,
+		rmoriDiscrepancyMissingGroup,
+	}, types)
+
+	data, err := json.Marshal(discrepancies[0])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+  "type": "offset_behind",
+  "source_group": "foo",
+  "destination_group": "foo",
+  "topic": "a",
+  "destination_topic": "a",
+  "partition": 1,
+  "source_offset": 20,
+  "expected_offset": 19,
+  "destination_offset": 17
+}`, string(data))
+
+	data, err = json.Marshal(discrepancies[3])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"missing_group","source_group":"bar","destination_group":"baz"}`, string(data))
+
+	assert.Equal(t, "record not yet replicated", discrepancies[2].Error)
+	assert.Equal(t, offsetsReportSummary{
+		Type:                "summary",
+		DestinationGroups:   2,
+		Partitions:          6,
+		MissingGroups:       1,
+		MissingPartitions:   1,
+		OffsetsBehind:       1,
+		TranslationFailures: 1,
+	}, summary)
+
+	_, summary = compareGroupCommits(commits[:1], map[string]kadm.Offsets{
+		"foo": testOffsets(kadm.Offset{Topic: "a", Partition: 0, At: 12}),
+	}, translate)
+	assert.True(t, summary.Complete)
+}
+
+func TestRedpandaMigratorOffsetsReportInputLinting(t *testing.T) {
+	configTests := []struct {
+		name        string
+		config      string
+		errContains string
+	}{
+		{
+			name: "valid",
+			config: `
+redpanda_migrator_offsets_report:
+  seed_brokers: [ localhost:9092 ]
+  destination:
+    seed_brokers: [ localhost:9093 ]
+  topics: [ foo ]
+  groups: [ "^orders-" ]
+  group_renames:
+    orders-service: orders
+`,
+		},
+		{
+			name: "group mapping and renames",
+			config: `
+redpanda_migrator_offsets_report:
+  seed_brokers: [ localhost:9092 ]
+  destination:
+    seed_brokers: [ localhost:9093 ]
+  topics: [ foo ]
+  group_mapping: root = this.group
+  group_renames:
+    orders-service: orders
+`,
+			errContains: "only one of group_mapping and group_renames can be set",
+		},
+		{
+			name: "excluded topic",
+			config: `
+redpanda_migrator_offsets_report:
+  seed_brokers: [ localhost:9092 ]
+  destination:
+    seed_brokers: [ localhost:9093 ]
+  topics: [ foo ]
+  exclude_topics: [ foo ]
+`,
+			errContains: "topics foo are listed in both topics and exclude_topics",
+		},
+	}
+
+	env := service.NewEnvironment()
+	for _, test := range configTests {
+		t.Run(test.name, func(t *testing.T) {
+			strm := env.NewStreamBuilder()
+			err := strm.AddInputYAML(test.config)
+			if test.errContains == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.errContains)
+			}
+		})
+	}
+}
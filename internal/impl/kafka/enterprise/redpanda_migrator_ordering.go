@@ -0,0 +1,161 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const (
+	rmoOrderingNone      = "none"
+	rmoOrderingPartition = "partition"
+)
+
+// orderedPartition serialises the writes of the batches of a single destination partition.
+type orderedPartition struct {
+	// sem is a mutex which can be acquired with a context.
+	sem chan struct{}
+
+	// failedOffset is the smallest source offset of a batch which failed to be written and wasn't retried successfully
+	// yet, or -1.
+	failedOffset int64
+}
+
+// partitionOrderingOutput guarantees that the records of each destination partition are written in the order in which
+// they were consumed when multiple batches are in flight.
+//
+// The batches of a partition are written one at a time by the wrapped output and, once a batch fails, the batches which
+// were consumed after it are rejected until it's retried successfully, so that a retried batch is never written after
+// the batches which follow it. Batches of different partitions are still written concurrently.
+type partitionOrderingOutput struct {
+	service.BatchOutput
+
+	// The interpolations of the destination topic and partition of each message.
+	topic     *service.InterpolatedString
+	partition *service.InterpolatedString
+
+	mu         sync.Mutex
+	partitions map[string]*orderedPartition
+}
+
+func newPartitionOrderingOutput(output service.BatchOutput, topic, partition *service.InterpolatedString) *partitionOrderingOutput {
+	return &partitionOrderingOutput{
+		BatchOutput: output,
+		topic:       topic,
+		partition:   partition,
+		partitions:  map[string]*orderedPartition{},
+	}
+}
+
+// orderedPartitionOf returns the state of a destination partition, which is created when it's first written to.
+func (o *partitionOrderingOutput) orderedPartitionOf(key string) *orderedPartition {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	p, exists := o.partitions[key]
+	if !exists {
+		p = &orderedPartition{sem: make(chan struct{}, 1), failedOffset: -1}
+		o.partitions[key] = p
+	}
+	return p
+}
+
+// batchPartitions returns the smallest source offset of the records of a batch for each of their destination
+// partitions, which is -1 for partitions whose records don't have a source offset. Messages whose destination can't be
+// resolved are skipped, since the wrapped output fails to write them anyway.
+func (o *partitionOrderingOutput) batchPartitions(batch service.MessageBatch) map[string]int64 {
+	topicExec := batch.InterpolationExecutor(o.topic)
+	var partitionExec *service.MessageBatchInterpolationExecutor
+	if o.partition != nil {
+		partitionExec = batch.InterpolationExecutor(o.partition)
+	}
+
+	partitions := map[string]int64{}
+	for i, msg := range batch {
+		topic, err := topicExec.TryString(i)
+		if err != nil {
+			continue
+		}
+		var partition string
+		if partitionExec != nil {
+			if partition, err = partitionExec.TryString(i); err != nil {
+				continue
+			}
+		}
+		key := topic + "/" + partition
+
+		offset := int64(-1)
+		if v, ok := msg.MetaGetMut("kafka_offset"); ok {
+			if n, ok := v.(int); ok {
+				offset = int64(n)
+			}
+		}
+
+		if current, exists := partitions[key]; !exists || (offset >= 0 && (current < 0 || offset < current)) {
+			partitions[key] = offset
+		}
+	}
+	return partitions
+}
+
+func (o *partitionOrderingOutput) WriteBatch(ctx context.Context, batch service.MessageBatch) error {
+	offsets := o.batchPartitions(batch)
+
+	// The partitions are always acquired in the same order, so that batches with records for multiple partitions can't
+	// deadlock.
+	keys := make([]string, 0, len(offsets))
+	for key := range offsets {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	acquired := make([]*orderedPartition, 0, len(keys))
+	defer func() {
+		for _, p := range acquired {
+			<-p.sem
+		}
+	}()
+	for _, key := range keys {
+		p := o.orderedPartitionOf(key)
+		select {
+		case p.sem <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		acquired = append(acquired, p)
+	}
+
+	for i, p := range acquired {
+		if offset := offsets[keys[i]]; p.failedOffset >= 0 && offset > p.failedOffset {
+			return fmt.Errorf("holding back batch from offset %d of partition %q until the failed batch from offset %d is written", offset, keys[i], p.failedOffset)
+		}
+	}
+
+	if err := o.BatchOutput.WriteBatch(ctx, batch); err != nil {
+		for i, p := range acquired {
+			if offset := offsets[keys[i]]; offset >= 0 && (p.failedOffset < 0 || offset < p.failedOffset) {
+				p.failedOffset = offset
+			}
+		}
+		return err
+	}
+
+	// Batches which passed the check above start at or before the failed offset, so the failed records were retried.
+	for i, p := range acquired {
+		if offsets[keys[i]] >= 0 {
+			p.failedOffset = -1
+		}
+	}
+	return nil
+}
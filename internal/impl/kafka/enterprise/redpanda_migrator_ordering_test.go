@@ -0,0 +1,290 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redpanda-data/connect/v4/internal/dispatch"
+)
+
+type compactedRecord struct {
+	key       string
+	value     string
+	tombstone bool
+}
+
+// compact returns the state of a compacted topic partition, which is the last value of each key that wasn't deleted.
+func compact(records []compactedRecord) map[string]string {
+	state := map[string]string{}
+	for _, r := range records {
+		if r.tombstone {
+			delete(state, r.key)
+		} else {
+			state[r.key] = r.value
+		}
+	}
+	return state
+}
+
+// flakyBatchOutput signals the dispatch of each batch it receives and fails the first attempt of some of them after
+// writing half of their records, like a produce request which partially fails.
+type flakyBatchOutput struct {
+	mu       sync.Mutex
+	written  map[int][]compactedRecord
+	attempts map[string]int
+	fail     func(firstOffset int) bool
+}
+
+func (o *flakyBatchOutput) Connect(context.Context) error { return nil }
+
+func (o *flakyBatchOutput) Close(context.Context) error { return nil }
+
+func (o *flakyBatchOutput) WriteBatch(_ context.Context, batch service.MessageBatch) error {
+	for _, msg := range batch {
+		dispatch.TriggerSignal(msg.Context())
+	}
+
+	partitionV, _ := batch[0].MetaGetMut("kafka_partition")
+	offsetV, _ := batch[0].MetaGetMut("kafka_offset")
+	partition, firstOffset := partitionV.(int), offsetV.(int)
+
+	// Give later batches a chance to overtake this one.
+	time.Sleep(time.Millisecond)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	id := fmt.Sprintf("%d/%d", partition, firstOffset)
+	o.attempts[id]++
+	toWrite := batch
+	if o.attempts[id] == 1 && o.fail(firstOffset) {
+		toWrite = batch[:len(batch)/2]
+	}
+	for _, msg := range toWrite {
+		key, _ := msg.MetaGet("kafka_key")
+		value, err := msg.AsBytes()
+		if err != nil {
+			return err
+		}
+		o.written[partition] = append(o.written[partition], compactedRecord{key: key, value: string(value), tombstone: isTombstone(msg)})
+	}
+	if len(toWrite) < len(batch) {
+		return errors.New("partially written")
+	}
+	return nil
+}
+
+type mockBatchOutput struct {
+	writeFn func(batch service.MessageBatch) error
+}
+
+func (o *mockBatchOutput) Connect(context.Context) error { return nil }
+
+func (o *mockBatchOutput) Close(context.Context) error { return nil }
+
+func (o *mockBatchOutput) WriteBatch(_ context.Context, batch service.MessageBatch) error {
+	return o.writeFn(batch)
+}
+
+func TestPartitionOrderingOutputCompactedTopic(t *testing.T) {
+	const (
+		partitions = 3
+		records    = 60
+		batchSize  = 4
+	)
+
+	// A compacted topic fixture, which updates a few keys repeatedly and deletes them with tombstones.
+	source := map[int][]compactedRecord{}
+	var batches [partitions][]service.MessageBatch
+	for partition := range partitions {
+		for offset := range records {
+			r := compactedRecord{key: "key" + strconv.Itoa(offset%5), value: fmt.Sprintf("value%d-%d", partition, offset)}
+			if offset%7 == 3 {
+				r = compactedRecord{key: r.key, tombstone: true}
+			}
+			source[partition] = append(source[partition], r)
+
+			var msg *service.Message
+			if r.tombstone {
+				msg = service.NewMessage(nil)
+			} else {
+				msg = service.NewMessage([]byte(r.value))
+			}
+			msg.MetaSetMut("kafka_topic", "compacted")
+			msg.MetaSetMut("kafka_partition", partition)
+			msg.MetaSetMut("kafka_offset", offset)
+			msg.MetaSetMut("kafka_key", r.key)
+			msg.MetaSetMut("kafka_tombstone_message", r.tombstone)
+
+			if offset%batchSize == 0 {
+				batches[partition] = append(batches[partition], nil)
+			}
+			batches[partition][len(batches[partition])-1] = append(batches[partition][len(batches[partition])-1], msg)
+		}
+	}
+
+	inner := &flakyBatchOutput{
+		written:  map[int][]compactedRecord{},
+		attempts: map[string]int{},
+		fail:     func(firstOffset int) bool { return (firstOffset/batchSize)%3 == 1 },
+	}
+	topic, err := service.NewInterpolatedString("${! @kafka_topic }")
+	require.NoError(t, err)
+	partition, err := service.NewInterpolatedString("${! @kafka_partition }")
+	require.NoError(t, err)
+	output := newPartitionOrderingOutput(inner, topic, partition)
+
+	// Like the ordered reader of the input, the next batch of a partition is only handed to the output once the
+	// records of the previous batch were dispatched, and failed batches are retried until they succeed, so that
+	// multiple batches of the same partition are in flight.
+	var wg sync.WaitGroup
+	for p := range partitions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, batch := range batches[p] {
+				dispatched := make(chan struct{})
+				var once sync.Once
+				for i, msg := range batch {
+					batch[i] = msg.WithContext(dispatch.CtxOnTriggerSignal(msg.Context(), func() {
+						once.Do(func() { close(dispatched) })
+					}))
+				}
+
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for output.WriteBatch(context.Background(), batch) != nil {
+						time.Sleep(time.Millisecond)
+					}
+				}()
+				<-dispatched
+			}
+		}()
+	}
+	wg.Wait()
+
+	for p := range partitions {
+		written := inner.written[p]
+		assert.Equal(t, compact(source[p]), compact(written), "partition %d", p)
+
+		var tombstones int
+		for _, r := range written {
+			if r.tombstone {
+				assert.Empty(t, r.value)
+				tombstones++
+			}
+		}
+		assert.Positive(t, tombstones, "partition %d", p)
+	}
+}
+
+func TestPartitionOrderingOutputHoldsBackBatches(t *testing.T) {
+	newBatch := func(partition int, offsets ...int) service.MessageBatch {
+		var batch service.MessageBatch
+		for _, offset := range offsets {
+			msg := service.NewMessage([]byte("foo"))
+			msg.MetaSetMut("kafka_topic", "foo")
+			msg.MetaSetMut("kafka_partition", partition)
+			msg.MetaSetMut("kafka_offset", offset)
+			batch = append(batch, msg)
+		}
+		return batch
+	}
+
+	var failNext bool
+	var written []string
+	inner := &mockBatchOutput{writeFn: func(batch service.MessageBatch) error {
+		if failNext {
+			failNext = false
+			return errors.New("nope")
+		}
+		for _, msg := range batch {
+			partition, _ := msg.MetaGet("kafka_partition")
+			offset, _ := msg.MetaGet("kafka_offset")
+			written = append(written, partition+"@"+offset)
+		}
+		return nil
+	}}
+	topic, err := service.NewInterpolatedString("${! @kafka_topic }")
+	require.NoError(t, err)
+	partition, err := service.NewInterpolatedString("${! @kafka_partition }")
+	require.NoError(t, err)
+	output := newPartitionOrderingOutput(inner, topic, partition)
+
+	ctx := context.Background()
+	require.NoError(t, output.WriteBatch(ctx, newBatch(0, 0, 1)))
+
+	failNext = true
+	require.ErrorContains(t, output.WriteBatch(ctx, newBatch(0, 2, 3)), "nope")
+
+	// Later batches of the partition are held back until the failed batch is written, while other partitions aren't.
+	require.ErrorContains(t, output.WriteBatch(ctx, newBatch(0, 4, 5)), "until the failed batch from offset 2 is written")
+	require.NoError(t, output.WriteBatch(ctx, newBatch(1, 0)))
+
+	require.NoError(t, output.WriteBatch(ctx, newBatch(0, 2, 3)))
+	require.NoError(t, output.WriteBatch(ctx, newBatch(0, 4, 5)))
+
+	assert.Equal(t, []string{"0@0", "0@1", "1@0", "0@2", "0@3", "0@4", "0@5"}, written)
+}
+
+func TestRedpandaMigratorOutputOrderingLinting(t *testing.T) {
+	configTests := []struct {
+		name        string
+		config      string
+		errContains string
+	}{
+		{
+			name: "partition ordering with manual partitioner",
+			config: `
+redpanda_migrator:
+  seed_brokers: [ localhost:9092 ]
+  topic: ${! @kafka_topic }
+  partitioner: manual
+  partition: ${! @kafka_partition }
+  ordering: partition
+`,
+		},
+		{
+			name: "partition ordering without manual partitioner",
+			config: `
+redpanda_migrator:
+  seed_brokers: [ localhost:9092 ]
+  topic: ${! @kafka_topic }
+  ordering: partition
+`,
+			errContains: "partitioner must be manual when ordering is partition",
+		},
+	}
+
+	env := service.NewEnvironment()
+	for _, test := range configTests {
+		t.Run(test.name, func(t *testing.T) {
+			strm := env.NewStreamBuilder()
+			err := strm.AddOutputYAML(test.config)
+			if test.errContains == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.errContains)
+			}
+		})
+	}
+}
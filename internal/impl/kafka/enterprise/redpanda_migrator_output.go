@@ -10,16 +10,27 @@ package enterprise
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"regexp"
 	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/cenkalti/backoff/v4"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
 	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+	"github.com/twmb/franz-go/pkg/sasl"
 	franz_sr "github.com/twmb/franz-go/pkg/sr"
 
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
 	"github.com/redpanda-data/benthos/v4/public/service"
 
-	"github.com/redpanda-data/connect/v4/internal/impl/confluent/sr"
 	"github.com/redpanda-data/connect/v4/internal/impl/kafka"
 	"github.com/redpanda-data/connect/v4/internal/license"
 )
@@ -32,10 +43,58 @@ const (
 	rmoFieldRepFactor                    = "replication_factor"
 	rmoFieldTranslateSchemaIDs           = "translate_schema_ids"
 	rmoFieldSchemaRegistryOutputResource = "schema_registry_output_resource"
+	rmoFieldSchemaTranslationTopics      = "schema_translation_topics"
+	rmoFieldSchemaTranslationRegexp      = "schema_translation_regexp_topics"
+	rmoFieldProvenanceHeaders            = "provenance_headers"
+	rmoFieldTopicPrefix                  = "topic_prefix"
+	rmoFieldSkipPreflightChecks          = "skip_preflight_checks"
+	rmoFieldPrincipalMapping             = "principal_mapping"
+	rmoFieldPreserveTimestampType        = "preserve_timestamp_type"
+	rmoFieldTopicCreateBackoff           = "topic_create_backoff"
+	rmoFieldTransaction                  = "transaction"
+	rmoFieldTransactionalIDPrefix        = "transactional_id_prefix"
+	rmoFieldACLSyncInterval              = "acl_sync_interval"
+	rmoFieldDeleteRemovedACLs            = "delete_removed_acls"
+	rmoFieldACLMigration                 = "acl_migration"
+	rmoFieldAdmin                        = "admin"
+	rmoFieldValueMapping                 = "value_mapping"
+	rmoFieldOnOversizedRecord            = "on_oversized_record"
+	rmoFieldTranslationReportTopic       = "translation_report_topic"
+	rmoFieldOrdering                     = "ordering"
+	rmoFieldReconcileTopicConfigs        = "reconcile_topic_configs"
+	rmoFieldReconcileInterval            = "reconcile_interval"
+	rmoFieldTieredStorageRead            = "tiered_storage_read"
+	rmoFieldTieredStorageWrite           = "tiered_storage_write"
+	rmoFieldDedupCache                   = "dedup_cache"
+	rmoFieldMaxConcurrentAdminOps        = "max_concurrent_admin_ops"
+	rmoFieldThrottleWarnThreshold        = "throttle_warn_threshold"
+	rmoFieldMirrorDeletions              = "mirror_deletions"
+	rmoFieldMirrorDeletionsDryRun        = "mirror_deletions_dry_run"
+	rmoFieldCreatedTopicsCache           = "created_topics_cache"
+
+	// Defined in kafka.FranzProducerFields
+	rmoFieldIdempotentWrite = "idempotent_write"
+
+	// Provenance headers fields
+	rmoFieldProvenanceHeadersEnabled      = "enabled"
+	rmoFieldProvenanceHeadersPartitionKey = "partition_key"
+	rmoFieldProvenanceHeadersOffsetKey    = "offset_key"
+	rmoFieldProvenanceHeadersTimestampKey = "timestamp_key"
+	rmoFieldProvenanceHeadersClusterIDKey = "cluster_id_key"
 
 	// Deprecated
 	rmoFieldRackID = "rack_id"
 
+	// Values of the acl_migration field
+	aclMigrationEnabled  = "enabled"
+	aclMigrationDisabled = "disabled"
+	aclMigrationRequired = "required"
+
+	// Values of the reconcile_topic_configs field
+	topicReconcileOff     = "off"
+	topicReconcileWarn    = "warn"
+	topicReconcileEnforce = "enforce"
+
 	rmoResourceDefaultLabel = "redpanda_migrator_output"
 )
 
@@ -60,9 +119,187 @@ ACL migration adheres to the following principles:
 - `+"`ALLOW WRITE`"+` ACLs for topics are not migrated
 - `+"`ALLOW ALL`"+` ACLs for topics are downgraded to `+"`ALLOW READ`"+`
 - Only topic ACLs are migrated, group ACLs are not migrated
+- When `+"`principal_mapping`"+` is set, the principal of each ACL is rewritten by the mapping and ACLs for which the
+mapping fails or returns an empty result are skipped
+
+By default, the ACLs of each topic are only copied once, when the topic is first migrated. When `+"`acl_sync_interval`"+`
+is set, the ACLs of all migrated topics are compared with the source cluster at that interval and the ACLs which were
+added to the source topics are created in the destination cluster, following the same principles. When
+`+"`delete_removed_acls`"+` is also set to `+"`true`"+`, the ACLs of the destination topics which no longer exist in the
+source cluster are deleted, except for `+"`ALLOW WRITE`"+` and `+"`ALLOW ALL`"+` ACLs, which are never created by the
+migrator. Failing to sync the ACLs of a topic is logged and retried in the next cycle. A summary is logged after every
+cycle and the `+"`redpanda_migrator_acls_added`"+`, `+"`redpanda_migrator_acls_removed`"+` and
+`+"`redpanda_migrator_acls_unchanged`"+` counters record the number of ACLs in each state.
+
+Before migrating any ACLs, the output checks that the ACLs of the source cluster can be described when it connects. By
+default, ACL migration is disabled with a single error log when the check fails because the principal isn't authorized,
+while the topics and records are still migrated. When `+"`acl_migration`"+` is set to `+"`required`"+`, the output fails to
+connect instead, and when it's set to `+"`disabled`"+`, ACLs are neither described nor migrated. The ACLs of the source
+cluster are read with the client of `+"`input_resource`"+` unless the `+"`admin`"+` field is set, so that the principal which
+consumes the records doesn't need to be allowed to describe ACLs.
+
+When `+"`provenance_headers.enabled`"+` is set to `+"`true`"+`, headers which record the source cluster ID, partition and
+offset of each message along with the migration timestamp are appended to the records written to the destination
+cluster. Existing headers with the same keys are left intact and the message values are not modified.
+
+When `+"`value_mapping`"+` is set, the value of each record is replaced with the result of the mapping right before it
+is produced, after its schema ID was translated. This can be used for redacting fields of specific topics. The mapping
+receives the record value along with the metadata of the message, such as `+"`kafka_topic`"+` and `+"`kafka_key`"+`.
+When the value starts with the 5 byte header of the Confluent wire format and its schema ID was resolved in the schema
+registry while translating schema IDs, the mapping receives the value without the header, the schema ID is added to the
+`+"`schema_id`"+` metadata field and the header is prepended to the result of the mapping, so that the schema ID
+translation is preserved. Other values, such as plain payloads which happen to start with a zero byte, are passed to the
+mapping unchanged. Records which the mapping deletes are not produced and are counted by the
+`+"`redpanda_migrator_deleted_records`"+` metric, the order of the remaining records is preserved. When the mapping
+fails, the batch fails and is retried.
+
+Before a record is produced, its size, which includes its key, value, headers and the record batch overhead, is checked
+against the smallest of the `+"`max.message.bytes`"+` config of its destination topic and the `+"`message.max.bytes`"+`
+config of the destination cluster, which are fetched once per topic and cached until the output reconnects. When
+`+"`on_oversized_record`"+` is set to `+"`fail`"+`, oversized records fail the batch with an error which contains the
+destination topic, the source partition and offset of the record, its size and the limits. When it's set to
+`+"`drop`"+`, they are skipped with a warning and when it's set to `+"`truncate_headers`"+`, their largest headers are
+removed until they fit, which fails the batch if they are still too large without headers. Oversized records are counted
+by the `+"`redpanda_migrator_oversized_records`"+` metric, which is labelled with the destination topic and the
+`+"`on_oversized_record`"+` action. The limits can't be checked if the
+principal isn't allowed to describe the configs of the destination topics, in which case the records are produced
+without validation.
+
+When `+"`translate_schema_ids`"+` is enabled, the `+"`schema_id_source`"+` and `+"`schema_id_destination`"+` metadata
+fields of each message in the Confluent wire format are set to its source schema ID and the schema ID it's written with,
+which is the source schema ID for topics excluded by `+"`schema_translation_topics`"+`. The destination schema ID is not
+set when the translation fails, in which case the record is written with its source schema ID. The metadata fields are
+set before the records are built, so they're added to the record headers when the `+"`metadata`"+` field includes them.
+The `+"`redpanda_migrator_schema_id_records`"+` counter, labelled by a `+"`result`"+` of `+"`translated`"+`,
+`+"`failed`"+` or `+"`passthrough`"+`, counts these records. When `+"`translation_report_topic`"+` is set, a JSON report
+of each schema ID mapping is produced to that topic when it's first established by the output.
+
+When `+"`topic_prefix`"+` is set, it is prepended to the names of all the topics created in the destination cluster, the
+topics which messages are written to and the topics of their ACLs. The same value should be set in the
+`+"`topic_prefix`"+` field of the `+"`redpanda_migrator_offsets`"+` output so that consumer group offsets are committed
+on the prefixed topics.
+
+Records read by the `+"`redpanda_migrator`"+` input are decompressed by the consumer, so the output always re-batches
+them and compresses the produced batches according to its own `+"`compression`"+` and batching fields, regardless of
+how the source batches were compressed. The keys, headers, timestamps and order of the records within each partition
+are preserved. Compressing with `+"`zstd`"+` or `+"`gzip`"+` reduces the bandwidth used for writing to the destination
+cluster at the cost of additional CPU usage, whereas `+"`lz4`"+` and `+"`snappy`"+` are cheaper to compute but compress
+less. The `+"`redpanda_migrator_produced_uncompressed_bytes`"+` and `+"`redpanda_migrator_produced_compressed_bytes`"+`
+counters, labelled by topic, record the size of the produced batches before and after compression.
+
+Before accepting any messages, the output checks that the destination cluster supports the APIs required for creating
+topics, ACLs and reading topic configs, that the authenticated principal is allowed to create topics and ACLs and, when
+`+"`translate_schema_ids`"+` is enabled, that the schema registry output resource is reachable. The output fails to
+connect with an error listing every unmet requirement. These checks can be disabled via `+"`skip_preflight_checks`"+`.
+
+Creating topics and ACLs is retried with the backoff configured in `+"`topic_create_backoff`"+` when the destination
+cluster returns transient errors, such as `+"`NOT_CONTROLLER`"+` or `+"`COORDINATOR_LOAD_IN_PROGRESS`"+` while its brokers
+are restarting. Permanent errors, such as `+"`TOPIC_AUTHORIZATION_FAILED`"+` or `+"`INVALID_REPLICATION_FACTOR`"+`, fail
+the batch immediately. Once the backoff gives up, the batch fails and is retried like any other failed write.
+
+The timestamps of records read from source topics with `+"`message.timestamp.type`"+` set to `+"`LogAppendTime`"+` are the
+times at which the source cluster appended them to its log. By default, the destination topics are created with
+`+"`CreateTime`"+` timestamps and the source timestamps are carried through as the record timestamps, either via the
+`+"`timestamp_ms`"+` field or, when it isn't set, from the `+"`kafka_timestamp_ms`"+` metadata of each message. When
+`+"`preserve_timestamp_type`"+` is set to `+"`true`"+`, the destination topics are created with `+"`LogAppendTime`"+`
+timestamps instead, so the destination cluster overwrites the timestamps of the records when writing them and a warning is
+logged once for each such topic.
+
+== Migration status
+
+The progress of the migration of each source topic is served as JSON by the `+"`GET /redpanda_migrator/status`"+`
+endpoint of the HTTP server, so that producers can be cut over topic by topic. For each partition, it reports the high
+watermark in the source cluster, the last source offset written successfully to the destination cluster and the lag
+between them. Topics are reported as `+"`caught_up`"+` when the sum of the lag of their partitions is at most the
+`+"`max_lag`"+` query parameter, which defaults to `+"`0`"+`, and `+"`groups_synced`"+` is set when the last offset
+commit of every consumer group of the topic by the `+"`redpanda_migrator_offsets`"+` output succeeded. The source
+watermarks are cached for 5 seconds, so the endpoint can be polled frequently, and it returns a 503 status code until
+they were fetched successfully for the first time.
+
+== Delivery guarantees
+
+By default, records are produced with the idempotent producer, so that retried produce requests don't duplicate records
+in the destination cluster after broker restarts or network errors. When `+"`idempotent_write`"+` is enabled, the output
+fails to connect unless the destination cluster supports idempotent writes and the principal is allowed to perform them.
+
+When `+"`transaction`"+` is set to `+"`true`"+`, each batch is produced within a transaction, which is only committed
+once the topics and ACLs of the batch were created, its schema IDs were translated and all its records were written
+successfully. When any of these steps fail, the transaction is aborted and the batch is retried, so consumers which read
+the destination topics with the `+"`read_committed`"+` isolation level never observe partial batches. Any transaction
+left open by a previous connection is aborted when the output connects and when it's closed. The transactional ID of the
+producer is the `+"`transactional_id_prefix`"+` followed by the label of the output, so it must be unique across all
+the migrators writing to the same destination cluster.
+
+Transactions are serialised per producer, so only a single batch is produced at a time when `+"`transaction`"+` is
+enabled, regardless of `+"`max_in_flight`"+`. Larger batches should be used instead in order to increase throughput.
+
+When `+"`max_in_flight`"+` is greater than 1, a batch which fails and is retried may be written after the batches of the
+same partition which were consumed after it. When `+"`ordering`"+` is set to `+"`partition`"+` and the `+"`partitioner`"+`
+is `+"`manual`"+`, the batches of each destination partition are written one at a time in the order in which they were
+consumed and the batches which follow a failed batch are failed as well until it's retried successfully, while the
+batches of different partitions are still written concurrently. This is required for migrating topics with the
+`+"`compact`"+` cleanup policy, whose compacted state depends on the order of the records of each key.
+
+When the destination cluster doesn't support transactions, records which were written before the pipeline crashed or
+was restarted can be skipped instead of being written again by setting `+"`dedup_cache`"+` to the label of a cache
+resource. The highest source offset written to the destination cluster of each source topic partition is stored in the
+cache under the key `+"`<topic>_<partition>`"+`, and records whose `+"`kafka_offset`"+` metadata isn't above the stored
+offset of their partition are skipped. The offsets are only advanced past batches which were acknowledged by the
+destination cluster and they are stored in the background every second and when the output is closed, so a restart may
+still write again the records of the last second. Since the source offsets of each destination partition must be
+monotonic, the `+"`partitioner`"+` must be `+"`manual`"+`, and each migrator writing to a different destination cluster
+must use a separate cache.
+
+== Topic deletions
+
+Topics which are deleted from the source cluster during a long running migration remain in the destination cluster by
+default. When `+"`"+rmoFieldMirrorDeletions+"`"+` is set to `+"`true`"+`, the destination topics of deleted source topics are
+deleted as well, but only when they were created by the migrator. Topics which already existed in the destination
+cluster are never deleted. The topics which the output creates are stored in the cache resource set in
+`+"`"+rmoFieldCreatedTopicsCache+"`"+`, so that they're still known to be created by the migrator after a restart, and topics
+which were created before the cache was set are never deleted either.
+
+The `+"`redpanda_migrator`"+` input of `+"`input_resource`"+` lists the topics of the source cluster every
+`+"`metadata_max_age`"+` and a topic which it consumes is considered deleted once it's missing from two consecutive
+listings and the source cluster then reports it as unknown when it's described, so that a topic which is briefly
+missing or which the input is no longer authorized to describe isn't deleted. Every deletion is logged as a warning and counted by
+the `+"`redpanda_migrator_topic_deletions`"+` metric, which is labelled with the destination topic and an `+"`action`"+` of
+`+"`deleted`"+` or `+"`dry_run`"+`. Deletions which fail are retried after the next listing.
+
+When `+"`"+rmoFieldMirrorDeletionsDryRun+"`"+` is set to `+"`true`"+`, the deletions are only logged and counted without
+deleting any topics, which can be used to verify which topics would be deleted before enabling `+"`"+rmoFieldMirrorDeletions+"`"+`.
+
+== Tombstones
+
+Tombstones, which are records without a value, are written to the destination cluster as tombstones, so that the keys
+they delete are also removed when the destination topics are compacted. Their schema IDs aren't translated and the
+`+"`value_mapping`"+` isn't applied to them. Messages which have the `+"`kafka_tombstone_message`"+` metadata field set
+to `+"`true`"+` are written as tombstones even when their body was replaced with an empty one by a processor.
 `).
 		Fields(redpandaMigratorOutputConfigFields()...).
-		LintRule(kafka.FranzWriterConfigLints()).
+		LintRule(credentialOverridesLint+kafka.FranzWriterConfigLints()+`
+root = if this.`+rmoFieldTransaction+`.or(false) && !this.`+rmoFieldIdempotentWrite+`.or(true) {
+  "`+rmoFieldIdempotentWrite+` must be enabled when `+rmoFieldTransaction+` is enabled"
+}
+root = if this.`+rmoFieldDeleteRemovedACLs+`.or(false) && this.`+rmoFieldACLSyncInterval+`.or("") == "" {
+  "`+rmoFieldACLSyncInterval+` must be set when `+rmoFieldDeleteRemovedACLs+` is enabled"
+}
+root = if this.`+rmoFieldACLMigration+`.or("`+aclMigrationEnabled+`") == "`+aclMigrationDisabled+`" && this.`+rmoFieldACLSyncInterval+`.or("") != "" {
+  "`+rmoFieldACLSyncInterval+` can't be set when `+rmoFieldACLMigration+` is `+aclMigrationDisabled+`"
+}
+root = if this.`+rmoFieldOrdering+`.or("`+rmoOrderingNone+`") == "`+rmoOrderingPartition+`" && this.partitioner.or("") != "manual" {
+  "partitioner must be manual when `+rmoFieldOrdering+` is `+rmoOrderingPartition+`"
+}
+root = if this.`+rmoFieldDedupCache+`.or("") != "" && this.partitioner.or("") != "manual" {
+  "partitioner must be manual when `+rmoFieldDedupCache+` is set"
+}
+root = if this.`+rmoFieldTransaction+`.or(false) && this.`+rmoFieldCredentialOverrides+`.or([]).length() > 0 {
+  "`+rmoFieldCredentialOverrides+` can't be used together with `+rmoFieldTransaction+`"
+}
+root = if (this.`+rmoFieldMirrorDeletions+`.or(false) || this.`+rmoFieldMirrorDeletionsDryRun+`.or(false)) && this.`+rmoFieldCreatedTopicsCache+`.or("") == "" {
+  "`+rmoFieldCreatedTopicsCache+` must be set when `+rmoFieldMirrorDeletions+` or `+rmoFieldMirrorDeletionsDryRun+` is enabled"
+}
+`).
 		Example("Transfer data", "Writes messages to the configured broker and creates topics and topic ACLs if they don't exist. It also ensures that the message order is preserved.", `
 output:
   redpanda_migrator:
@@ -71,6 +308,7 @@ output:
     key: ${! metadata("kafka_key") }
     partitioner: manual
     partition: ${! metadata("kafka_partition").or(throw("missing kafka_partition metadata")) }
+    # Carries the source timestamps through, including those of topics which use LogAppendTime timestamps.
     timestamp_ms: ${! metadata("kafka_timestamp_ms").or(timestamp_unix_milli()) }
     input_resource: redpanda_migrator_input
     max_in_flight: 1
@@ -86,8 +324,9 @@ func redpandaMigratorOutputConfigFields() []*service.ConfigField {
 				Description("The maximum number of batches to be sending in parallel at any given time.").
 				Default(256),
 			service.NewStringField(rmoFieldInputResource).
-				Description("The label of the redpanda_migrator input from which to read the configurations for topics and ACLs which need to be created.").
+				Description("The label of the redpanda_migrator input from which to read the configurations for topics and ACLs which need to be created. The output fails to connect if the input doesn't exist.").
 				Default(rmiResourceDefaultLabel).
+				LintRule(`root = if this == "" { ["` + rmoFieldInputResource + ` must not be empty"] }`).
 				Advanced(),
 			service.NewBoolField(rmoFieldRepFactorOverride).
 				Description("Use the specified replication factor when creating topics.").
@@ -99,9 +338,156 @@ func redpandaMigratorOutputConfigFields() []*service.ConfigField {
 				Advanced(),
 			service.NewBoolField(rmoFieldTranslateSchemaIDs).Description("Translate schema IDs.").Default(true).Advanced(),
 			service.NewStringField(rmoFieldSchemaRegistryOutputResource).
-				Description("The label of the schema_registry output to use for fetching schema IDs.").
+				Description("The label of the schema_registry output to use for fetching schema IDs. The output fails to connect if `translate_schema_ids` is set to `true` and the schema_registry output doesn't exist.").
 				Default(sroResourceDefaultLabel).
 				Advanced(),
+			service.NewStringListField(rmoFieldSchemaTranslationTopics).
+				Description("Restrict schema ID translation to the listed topics. Messages from all other topics are written without modification. When empty, schema IDs are translated for all topics. Messages which are not in the Confluent wire format are always written without modification.").
+				Example([]string{"foo", "bar"}).
+				Default([]string{}).
+				Advanced(),
+			service.NewBoolField(rmoFieldSchemaTranslationRegexp).
+				Description("Whether listed schema translation topics should be interpreted as regular expression patterns for matching multiple topics.").
+				Default(false).
+				Advanced(),
+			service.NewObjectField(rmoFieldProvenanceHeaders,
+				service.NewBoolField(rmoFieldProvenanceHeadersEnabled).
+					Description("Append headers to each record which describe where it was migrated from.").
+					Default(false),
+				service.NewStringField(rmoFieldProvenanceHeadersPartitionKey).
+					Description("The header key which stores the partition of the source record. Set to an empty string to omit it.").
+					Default("rp_migrator_src_partition"),
+				service.NewStringField(rmoFieldProvenanceHeadersOffsetKey).
+					Description("The header key which stores the offset of the source record. Set to an empty string to omit it.").
+					Default("rp_migrator_src_offset"),
+				service.NewStringField(rmoFieldProvenanceHeadersTimestampKey).
+					Description("The header key which stores the migration timestamp in Unix milliseconds. Set to an empty string to omit it.").
+					Default("rp_migrator_ts"),
+				service.NewStringField(rmoFieldProvenanceHeadersClusterIDKey).
+					Description("The header key which stores the ID of the source cluster. Set to an empty string to omit it.").
+					Default("rp_migrator_src_cluster_id"),
+			).
+				Description("Configure headers which record the provenance of migrated records. The source partition and offset are read from the `kafka_partition` and `kafka_offset` metadata fields set by the `redpanda_migrator` input.").
+				Advanced(),
+			service.NewStringField(rmoFieldTopicPrefix).
+				Description("A prefix to prepend to the names of the topics in the destination cluster. This can be used to namespace topics when consolidating multiple source clusters into a single destination cluster.").
+				Example("clusterA.").
+				Default("").
+				Advanced(),
+			service.NewBoolField(rmoFieldSkipPreflightChecks).
+				Description("Skip the checks which verify that the destination cluster and schema registry are compatible with the migrator before accepting any messages.").
+				Default(false).
+				Advanced(),
+			service.NewBloblangField(rmoFieldPrincipalMapping).
+				Description("An optional xref:guides:bloblang/about.adoc[Bloblang mapping] which receives the principal of each migrated ACL as a string, such as `User:alice`, and returns the principal to use in the destination cluster. The result must start with a principal type such as `User:` or `Group:`. ACLs are skipped when the mapping deletes the principal or returns an empty string. When the mapping fails or returns an invalid principal, a warning is logged and only the affected ACL is skipped.").
+				Example(`root = this.re_replace_all("^User:CN=([^,]+),.*$", "User:$1")`).
+				Example(`root = if this.has_prefix("User:svc-") { deleted() } else { this }`).
+				Optional().
+				Advanced(),
+			service.NewBloblangField(rmoFieldValueMapping).
+				Description("An optional xref:guides:bloblang/about.adoc[Bloblang mapping] which is applied to the value of each record after schema ID translation and before it is produced. The result replaces the record value and records are dropped when the mapping deletes them. Values in the Confluent wire format whose schema ID was resolved in the schema registry are passed to the mapping without their 5 byte header, which is prepended to the result.").
+				Example(`root = if @kafka_topic == "customers" { this.without("email", "phone") } else { this }`).
+				Example(`root = if @kafka_topic == "audit" && this.internal.or(false) { deleted() } else { this }`).
+				Optional().
+				Advanced(),
+			service.NewStringField(rmoFieldTranslationReportTopic).
+				Description("An optional destination topic to which a JSON report is produced the first time each source schema ID is translated, which contains the source and destination schema IDs, the subjects and versions of the schema, the topic of the first record and the time the mapping was established. Reports are produced in the background with a separate client and failures are logged and retried without affecting the records written by the output. Only used when `translate_schema_ids` is `true`.").
+				Optional().
+				Advanced(),
+			service.NewStringEnumField(rmoFieldOnOversizedRecord, rmoOnOversizedRecordFail, rmoOnOversizedRecordDrop, rmoOnOversizedRecordTruncateHeaders).
+				Description("How to handle records which exceed the max message size of their destination topic. `fail` fails the batch, `drop` skips the record with a warning and `truncate_headers` removes the largest headers of the record until it fits.").
+				Default(rmoOnOversizedRecordFail).
+				Advanced(),
+			service.NewStringEnumField(rmoFieldOrdering, rmoOrderingNone, rmoOrderingPartition).
+				Description("The ordering guarantee of the records written to each destination partition. `none` writes up to `max_in_flight` batches concurrently, so a failed batch which is retried may be written after the batches which were consumed after it. `partition` writes the batches of each destination partition one at a time and holds back the batches which follow a failed batch until it's retried successfully, so that the records of each partition are written in the order in which they were consumed. Requires the `partitioner` to be `manual`.").
+				Default(rmoOrderingNone).
+				Advanced(),
+			service.NewStringField(rmoFieldDedupCache).
+				Description("The label of a cache resource in which the highest source offset written of each source topic partition is stored, so that records which were already written before a restart are skipped. Requires the `partitioner` to be `manual`.").
+				Optional().
+				Advanced(),
+			service.NewStringAnnotatedEnumField(rmoFieldReconcileTopicConfigs, map[string]string{
+				topicReconcileOff:     "The configs of the destination topics are only set when they are created.",
+				topicReconcileWarn:    "Configs of the destination topics which differ from the source topics are logged and reported by the `redpanda_migrator_topic_config_drift` metric.",
+				topicReconcileEnforce: "Configs of the destination topics which differ from the source topics are logged and altered to match the source topics.",
+			}).
+				Description("Whether the configs of the migrated topics are compared with the source cluster every `reconcile_interval`, so that configs which were changed in either cluster after a topic was created are detected. Only the configs which are copied or set when creating topics are compared. Partition counts which increased in the source cluster are always logged and reported by the `redpanda_migrator_topic_partition_drift` metric, since they can't be fixed safely.").
+				Default(topicReconcileOff).
+				Advanced(),
+			service.NewDurationField(rmoFieldReconcileInterval).
+				Description("The interval at which topic configs are reconciled when `reconcile_topic_configs` isn't `off`. It must be at least `1s`. The interval is doubled after each cycle which fails to reconcile some topics, up to 10 times the configured interval.").
+				Default("5m").
+				Advanced(),
+			service.NewBackOffField(rmoFieldTopicCreateBackoff, false, &backoff.ExponentialBackOff{
+				InitialInterval: 500 * time.Millisecond,
+				MaxInterval:     10 * time.Second,
+				MaxElapsedTime:  time.Minute,
+			}).
+				Description("The backoff for retrying the creation of topics and ACLs when the destination cluster returns transient errors.").
+				Advanced(),
+			service.NewIntField(rmoFieldMaxConcurrentAdminOps).
+				Description("The maximum number of requests to create topics and ACLs which are sent to the destination cluster concurrently across all the in-flight batches, so that its controller isn't overwhelmed when records of many new topics are written at once. The records of a topic are only written once it was created, but the records of other topics, including those of the same batch, don't wait for it. The requests are reported by the `redpanda_migrator_admin_requests` and `redpanda_migrator_admin_request_latency_ns` metrics.").
+				Default(5).
+				LintRule(`root = if this < 1 { ["` + rmoFieldMaxConcurrentAdminOps + ` must be at least 1"] }`).
+				Advanced(),
+			service.NewDurationField(rmoFieldThrottleWarnThreshold).
+				Description("The time for which a broker of the destination cluster must throttle the producer within a minute, because it exceeds its client quotas, before a warning is logged. The warning is only logged the first time. Throttling is always reported by the `kafka_broker_throttle_ns` metric, labelled by broker, and the percentage of the producer buffer which is used by the `kafka_producer_buffer_utilization` metric. Set to `0s` to disable the warning.").
+				Default("10s").
+				Advanced(),
+			service.NewBoolField(rmoFieldMirrorDeletions).
+				Description("Delete the destination topics of the source topics which are deleted, but only when they were created by the migrator. Requires `" + rmoFieldCreatedTopicsCache + "` to be set.").
+				Default(false).
+				Advanced(),
+			service.NewBoolField(rmoFieldMirrorDeletionsDryRun).
+				Description("Only log and count the destination topics which would be deleted because their source topic was deleted, without deleting them. Requires `" + rmoFieldCreatedTopicsCache + "` to be set.").
+				Default(false).
+				Advanced(),
+			service.NewStringField(rmoFieldCreatedTopicsCache).
+				Description("The label of a cache resource in which the destination topics created by the output are stored, so that only those are deleted when `" + rmoFieldMirrorDeletions + "` is enabled, including after a restart.").
+				Optional().
+				Advanced(),
+			credentialOverridesField(),
+			service.NewBoolField(rmoFieldTieredStorageRead).
+				Description("Set the `redpanda.remote.read` config of the created topics, which allows consumers to read data that was uploaded to tiered storage. When unset, the config is left to the defaults of the destination cluster.").
+				Optional().
+				Advanced(),
+			service.NewBoolField(rmoFieldTieredStorageWrite).
+				Description("Set the `redpanda.remote.write` config of the created topics, which uploads their data to tiered storage. When unset, the config is left to the defaults of the destination cluster.").
+				Optional().
+				Advanced(),
+			service.NewBoolField(rmoFieldPreserveTimestampType).
+				Description("Create destination topics with `LogAppendTime` timestamps when the source topics use them, in which case the destination cluster overwrites the timestamps of the migrated records. By default, such topics are created with `CreateTime` timestamps and the source timestamps are carried through.").
+				Default(false).
+				Advanced(),
+			service.NewBoolField(rmoFieldTransaction).
+				Description("Produce each batch within a transaction which is only committed once the whole batch was written successfully, so that consumers with the `read_committed` isolation level never observe partial batches. Only a single batch is produced at a time when enabled. Requires `idempotent_write` to be enabled.").
+				Default(false).
+				Advanced(),
+			service.NewStringField(rmoFieldTransactionalIDPrefix).
+				Description("The prefix of the transactional ID used when `transaction` is enabled, which is followed by the label of the output.").
+				Default("redpanda_migrator_").
+				Advanced(),
+			service.NewDurationField(rmoFieldACLSyncInterval).
+				Description("The interval at which the ACLs of the migrated topics are synced with the source cluster, so that ACLs which are added after a topic was migrated are also created in the destination cluster. It must be at least `1s`. The ACLs are only copied once per topic when unset.").
+				Example("5m").
+				Optional().
+				Advanced(),
+			service.NewBoolField(rmoFieldDeleteRemovedACLs).
+				Description("Delete the ACLs of the destination topics which no longer exist in the source cluster when syncing ACLs. Requires `acl_sync_interval` to be set.").
+				Default(false).
+				Advanced(),
+			service.NewStringAnnotatedEnumField(rmoFieldACLMigration, map[string]string{
+				aclMigrationEnabled:  "ACLs are migrated if the ACLs of the source cluster can be described when the output connects, otherwise an error is logged once and ACLs are not migrated.",
+				aclMigrationDisabled: "ACLs are neither described nor migrated.",
+				aclMigrationRequired: "The output fails to connect if the ACLs of the source cluster can't be described.",
+			}).
+				Description("Whether the ACLs of the migrated topics are migrated.").
+				Default(aclMigrationEnabled).
+				Advanced(),
+			service.NewObjectField(rmoFieldAdmin, kafka.FranzConnectionFields()...).
+				Description("The connection details of the source cluster used to describe its ACLs instead of the client of `input_resource`, so that the principal of the input doesn't need to be allowed to describe ACLs.").
+				Optional().
+				Advanced(),
 
 			// Deprecated
 			service.NewStringField(rmoFieldRackID).Deprecated(),
@@ -127,192 +513,1322 @@ func init() {
 				return
 			}
 
-			var inputResource string
-			if inputResource, err = conf.FieldString(rmoFieldInputResource); err != nil {
+			var w *redpandaMigratorWriter
+			if w, err = newRedpandaMigratorWriterFromConfig(conf, mgr); err != nil {
 				return
 			}
 
-			var replicationFactorOverride bool
-			if replicationFactorOverride, err = conf.FieldBool(rmoFieldRepFactorOverride); err != nil {
-				return
+			hooks := kafka.NewFranzWriterHooks(w.accessClient).
+				WithYieldClientFn(w.yieldClient).
+				WithBatchHookFn(w.onBatch).
+				WithWriteHookFn(w.onWrite).
+				WithTopicHookFn(w.onTopic)
+			if w.transactional {
+				hooks = hooks.WithTransactions()
+			}
+			if w.credentials != nil {
+				hooks = hooks.WithRecordClientFn(func(_ context.Context, record *kgo.Record) (*kgo.Client, error) {
+					return w.credentials.route(record)
+				})
 			}
 
-			var replicationFactor int
-			if replicationFactor, err = conf.FieldInt(rmoFieldRepFactor); err != nil {
+			var fw *kafka.FranzWriter
+			if fw, err = kafka.NewFranzWriterFromConfig(conf, hooks); err != nil {
 				return
 			}
+			w.topic = fw.Topic
+			output = fw
+			if w.dedup != nil {
+				output = newDedupOutput(output, w.dedup)
+			}
 
-			var translateSchemaIDs bool
-			if translateSchemaIDs, err = conf.FieldBool(rmoFieldTranslateSchemaIDs); err != nil {
+			var ordering string
+			if ordering, err = conf.FieldString(rmoFieldOrdering); err != nil {
 				return
 			}
+			if ordering == rmoOrderingPartition {
+				output = newPartitionOrderingOutput(output, fw.Topic, fw.Partition)
+			}
+
+			status := migrationStatusFor(mgr)
+			status.addInputResource(w.inputResource)
+			output = &migrationStatusOutput{BatchOutput: output, status: status}
+			return
+		})
+	if err != nil {
+		panic(err)
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// redpandaMigratorWriter holds the state shared by the hooks of a redpanda_migrator output.
+type redpandaMigratorWriter struct {
+	inputResource                string
+	replicationFactorOverride    bool
+	replicationFactor            int
+	translateSchemaIDs           bool
+	schemaRegistryOutputResource srResourceKey
+	schemaTranslationTopics      *topicMatcher
+	provenanceHeaders            *provenanceHeaderKeys
+	topicPrefix                  string
+	skipPreflightChecks          bool
+	principalMapper              *aclPrincipalMapper
+	preserveTimestampType        bool
+	topicConfigOverrides         map[string]*string
+	topicCreateBackoff           *backoff.ExponentialBackOff
+	idempotentWrite              bool
+	transactional                bool
+	aclSyncer                    *aclSyncer
+	topicReconciler              *topicConfigReconciler
+	aclMigration                 string
+	adminOpts                    []kgo.Opt
+	valueMapping                 *bloblang.Executor
+	onOversizedRecord            string
+	translationReporter          *schemaTranslationReporter
+	events                       *migrationEventPublisher
+	dedup                        *dedupWatermarks
+	createdTopics                *createdTopics
+	mirrorDeletionsDryRun        bool
+	// The topic of the writer, which is interpolated to resolve the schema IDs before the records are built.
+	topic *service.InterpolatedString
+
+	clientOpts  []kgo.Opt
+	connDetails *kafka.FranzConnectionDetails
+
+	clientMut        sync.Mutex
+	client           *kgo.Client
+	resourcesChecked bool
+	preflightChecked bool
+	// Whether the ACLs of the source cluster were probed and whether they are migrated.
+	aclsProbed  bool
+	aclsEnabled bool
+	// Whether the ACLs of the topics created so far were migrated and the ACL syncer started, which is done after the
+	// topics are created when the probe failed with a retryable error until then.
+	aclsMigrated bool
+
+	// The client used to describe the ACLs of the source cluster when the admin field is set.
+	adminMut    sync.Mutex
+	adminClient *kgo.Client
+
+	// Stores the source to destination SchemaID mapping.
+	schemaIDCache sync.Map
+	// Stores the destination SchemaIDs which were resolved in the schema registry, the header of values is only
+	// stripped for the value mapping when they have one of these IDs.
+	resolvedSchemaIDs sync.Map
+	topicCache        sync.Map
+	timestampTypes    sync.Map
+	// Stores the excluded topics for which records were dropped, so that this is only logged once per topic.
+	droppedExcludedTopics sync.Map
+	// Stores the cachedRecordSizeLimit of each destination topic.
+	recordSizeLimits sync.Map
+	runOnce          sync.Once
+	sourceClusterID  string
+
+	adminOps        *adminOpLimiter
+	topicCreations  topicCreations
+	throttleMetrics *producerThrottleMetrics
+	credentials     *credentialRouter
+
+	missingSchemaIDs *service.MetricCounter
+	deletedRecords   *service.MetricCounter
+	oversizedRecords *service.MetricCounter
+	schemaIDRecords  *service.MetricCounter
+
+	topicDeletionsMetric *service.MetricCounter
+
+	mgr *service.Resources
+}
+
+func newRedpandaMigratorWriterFromConfig(conf *service.ParsedConfig, mgr *service.Resources) (*redpandaMigratorWriter, error) {
+	w := redpandaMigratorWriter{
+		missingSchemaIDs: mgr.Metrics().NewCounter("redpanda_migrator_records_without_schema_id", "topic"),
+		deletedRecords:   mgr.Metrics().NewCounter("redpanda_migrator_deleted_records", "topic"),
+		oversizedRecords: mgr.Metrics().NewCounter("redpanda_migrator_oversized_records", "topic", "action"),
+		schemaIDRecords:  mgr.Metrics().NewCounter("redpanda_migrator_schema_id_records", "result"),
+		events:           migrationEventsFor(mgr),
+		mgr:              mgr,
+
+		topicDeletionsMetric: mgr.Metrics().NewCounter("redpanda_migrator_topic_deletions", "topic", "action"),
+	}
+
+	var err error
+	if w.inputResource, err = conf.FieldString(rmoFieldInputResource); err != nil {
+		return nil, err
+	}
+	if w.inputResource == "" {
+		// The lint isn't applied to configs which are built without parsing YAML, and an empty label would otherwise
+		// subscribe to the deletions of an input which doesn't exist.
+		return nil, fmt.Errorf("%s must not be empty", rmoFieldInputResource)
+	}
+
+	if w.replicationFactorOverride, err = conf.FieldBool(rmoFieldRepFactorOverride); err != nil {
+		return nil, err
+	}
+
+	if w.replicationFactor, err = conf.FieldInt(rmoFieldRepFactor); err != nil {
+		return nil, err
+	}
+
+	if w.translateSchemaIDs, err = conf.FieldBool(rmoFieldTranslateSchemaIDs); err != nil {
+		return nil, err
+	}
+
+	if w.translateSchemaIDs {
+		var res string
+		if res, err = conf.FieldString(rmoFieldSchemaRegistryOutputResource); err != nil {
+			return nil, err
+		}
+		w.schemaRegistryOutputResource = srResourceKey(res)
+
+		var topics []string
+		if topics, err = conf.FieldStringList(rmoFieldSchemaTranslationTopics); err != nil {
+			return nil, err
+		}
+		var regexpTopics bool
+		if regexpTopics, err = conf.FieldBool(rmoFieldSchemaTranslationRegexp); err != nil {
+			return nil, err
+		}
+		if len(topics) > 0 {
+			if w.schemaTranslationTopics, err = newTopicMatcher(topics, regexpTopics); err != nil {
+				return nil, fmt.Errorf("invalid %s: %s", rmoFieldSchemaTranslationTopics, err)
+			}
+		}
+	}
+
+	if w.provenanceHeaders, err = provenanceHeaderKeysFromParsed(conf.Namespace(rmoFieldProvenanceHeaders)); err != nil {
+		return nil, err
+	}
+
+	if w.topicPrefix, err = conf.FieldString(rmoFieldTopicPrefix); err != nil {
+		return nil, err
+	}
+
+	if w.skipPreflightChecks, err = conf.FieldBool(rmoFieldSkipPreflightChecks); err != nil {
+		return nil, err
+	}
+
+	if conf.Contains(rmoFieldPrincipalMapping) {
+		w.principalMapper = &aclPrincipalMapper{logger: mgr.Logger()}
+		if w.principalMapper.mapping, err = conf.FieldBloblang(rmoFieldPrincipalMapping); err != nil {
+			return nil, err
+		}
+	}
+
+	if conf.Contains(rmoFieldValueMapping) {
+		if w.valueMapping, err = conf.FieldBloblang(rmoFieldValueMapping); err != nil {
+			return nil, err
+		}
+	}
+
+	if w.onOversizedRecord, err = conf.FieldString(rmoFieldOnOversizedRecord); err != nil {
+		return nil, err
+	}
+
+	if w.preserveTimestampType, err = conf.FieldBool(rmoFieldPreserveTimestampType); err != nil {
+		return nil, err
+	}
+
+	w.topicConfigOverrides = map[string]*string{}
+	for field, config := range map[string]string{
+		rmoFieldTieredStorageRead:  "redpanda.remote.read",
+		rmoFieldTieredStorageWrite: "redpanda.remote.write",
+	} {
+		if !conf.Contains(field) {
+			continue
+		}
+		enabled, err := conf.FieldBool(field)
+		if err != nil {
+			return nil, err
+		}
+		w.topicConfigOverrides[config] = kadm.StringPtr(strconv.FormatBool(enabled))
+	}
+
+	if w.topicCreateBackoff, err = conf.FieldBackOff(rmoFieldTopicCreateBackoff); err != nil {
+		return nil, err
+	}
+
+	var maxAdminOps int
+	if maxAdminOps, err = conf.FieldInt(rmoFieldMaxConcurrentAdminOps); err != nil {
+		return nil, err
+	}
+	if maxAdminOps < 1 {
+		return nil, fmt.Errorf("%s must be at least 1, got %d", rmoFieldMaxConcurrentAdminOps, maxAdminOps)
+	}
+	w.adminOps = newAdminOpLimiter(maxAdminOps, mgr)
+
+	var throttleWarnThreshold time.Duration
+	if throttleWarnThreshold, err = conf.FieldDuration(rmoFieldThrottleWarnThreshold); err != nil {
+		return nil, err
+	}
+	w.throttleMetrics = newProducerThrottleMetrics(throttleWarnThreshold, mgr)
+
+	if w.idempotentWrite, err = conf.FieldBool(rmoFieldIdempotentWrite); err != nil {
+		return nil, err
+	}
+
+	if w.transactional, err = conf.FieldBool(rmoFieldTransaction); err != nil {
+		return nil, err
+	}
+
+	if conf.Contains(rmoFieldDedupCache) {
+		var cache string
+		if cache, err = conf.FieldString(rmoFieldDedupCache); err != nil {
+			return nil, err
+		}
+		var partitioner string
+		if conf.Contains("partitioner") {
+			if partitioner, err = conf.FieldString("partitioner"); err != nil {
+				return nil, err
+			}
+		}
+		if partitioner != "manual" {
+			return nil, fmt.Errorf("partitioner must be manual when %s is set", rmoFieldDedupCache)
+		}
+		w.dedup = newDedupWatermarks(mgr, cache)
+	}
+
+	if conf.Contains(rmoFieldCreatedTopicsCache) {
+		var cache string
+		if cache, err = conf.FieldString(rmoFieldCreatedTopicsCache); err != nil {
+			return nil, err
+		}
+		w.createdTopics = &createdTopics{cache: cache, mgr: mgr}
+	}
+	var mirrorDeletions bool
+	if mirrorDeletions, err = conf.FieldBool(rmoFieldMirrorDeletions); err != nil {
+		return nil, err
+	}
+	if w.mirrorDeletionsDryRun, err = conf.FieldBool(rmoFieldMirrorDeletionsDryRun); err != nil {
+		return nil, err
+	}
+	if mirrorDeletions || w.mirrorDeletionsDryRun {
+		if w.createdTopics == nil {
+			return nil, fmt.Errorf("%s must be set when %s or %s is enabled", rmoFieldCreatedTopicsCache, rmoFieldMirrorDeletions, rmoFieldMirrorDeletionsDryRun)
+		}
+		// The input detects the deleted topics once an output subscribed to them.
+		topicDeletionsFor(w.inputResource, mgr).subscribe(w.mirrorTopicDeletion)
+	}
+
+	if w.transactional {
+		if !w.idempotentWrite {
+			return nil, fmt.Errorf("%s must be enabled when %s is enabled", rmoFieldIdempotentWrite, rmoFieldTransaction)
+		}
+
+		var prefix string
+		if prefix, err = conf.FieldString(rmoFieldTransactionalIDPrefix); err != nil {
+			return nil, err
+		}
+		label := mgr.Label()
+		if label == "" {
+			label = rmoResourceDefaultLabel
+		}
+		w.clientOpts = append(w.clientOpts, kgo.TransactionalID(prefix+label))
+	}
+
+	var deleteRemovedACLs bool
+	if deleteRemovedACLs, err = conf.FieldBool(rmoFieldDeleteRemovedACLs); err != nil {
+		return nil, err
+	}
+
+	if conf.Contains(rmoFieldACLSyncInterval) {
+		var interval time.Duration
+		if interval, err = conf.FieldDuration(rmoFieldACLSyncInterval); err != nil {
+			return nil, err
+		}
+		if interval < time.Second {
+			return nil, fmt.Errorf("%s must be at least 1s, got %s", rmoFieldACLSyncInterval, interval)
+		}
+		w.aclSyncer = newACLSyncer(interval, deleteRemovedACLs, mgr.Metrics())
+	} else if deleteRemovedACLs {
+		return nil, fmt.Errorf("%s must be set when %s is enabled", rmoFieldACLSyncInterval, rmoFieldDeleteRemovedACLs)
+	}
+
+	if w.aclMigration, err = conf.FieldString(rmoFieldACLMigration); err != nil {
+		return nil, err
+	}
+	if w.aclMigration == aclMigrationDisabled && w.aclSyncer != nil {
+		return nil, fmt.Errorf("%s can't be set when %s is %s", rmoFieldACLSyncInterval, rmoFieldACLMigration, aclMigrationDisabled)
+	}
+
+	var reconcileMode string
+	if reconcileMode, err = conf.FieldString(rmoFieldReconcileTopicConfigs); err != nil {
+		return nil, err
+	}
+	if reconcileMode != topicReconcileOff {
+		var interval time.Duration
+		if interval, err = conf.FieldDuration(rmoFieldReconcileInterval); err != nil {
+			return nil, err
+		}
+		if interval < time.Second {
+			return nil, fmt.Errorf("%s must be at least 1s, got %s", rmoFieldReconcileInterval, interval)
+		}
+		w.topicReconciler = newTopicConfigReconciler(interval, reconcileMode == topicReconcileEnforce, mgr.Metrics())
+	}
+
+	if conf.Contains(rmoFieldAdmin) {
+		if w.adminOpts, err = kafka.FranzConnectionOptsFromConfig(conf.Namespace(rmoFieldAdmin), mgr.Logger()); err != nil {
+			return nil, err
+		}
+	}
+
+	if w.connDetails, err = kafka.FranzConnectionDetailsFromConfig(conf, mgr.Logger()); err != nil {
+		return nil, err
+	}
+
+	if w.translateSchemaIDs && conf.Contains(rmoFieldTranslationReportTopic) {
+		var topic string
+		if topic, err = conf.FieldString(rmoFieldTranslationReportTopic); err != nil {
+			return nil, err
+		}
+		if topic != "" {
+			w.translationReporter = newSchemaTranslationReporter(topic, w.produceTranslationReports, mgr.Logger())
+		}
+	}
+	var producerOpts []kgo.Opt
+	if producerOpts, err = kafka.FranzProducerOptsFromConfig(conf); err != nil {
+		return nil, err
+	}
+
+	producerOpts = append(producerOpts, kgo.AllowAutoTopicCreation()) // TODO: Configure this?
+
+	producerOpts = append(producerOpts, kgo.WithHooks(&produceCompressionMetrics{
+		uncompressedBytes: mgr.Metrics().NewCounter("redpanda_migrator_produced_uncompressed_bytes", "topic"),
+		compressedBytes:   mgr.Metrics().NewCounter("redpanda_migrator_produced_compressed_bytes", "topic"),
+	}, w.throttleMetrics))
+
+	w.clientOpts = append(w.clientOpts, w.connDetails.FranzOpts()...)
+	w.clientOpts = append(w.clientOpts, producerOpts...)
+
+	var credentials []*topicCredential
+	if credentials, err = topicCredentialsFromParsed(conf); err != nil {
+		return nil, err
+	}
+	if len(credentials) > 0 {
+		if w.transactional {
+			return nil, fmt.Errorf("%s can't be used together with %s", rmoFieldCredentialOverrides, rmoFieldTransaction)
+		}
+		w.credentials = newCredentialRouter(credentials, func(mechanisms []sasl.Mechanism) []kgo.Opt {
+			details := *w.connDetails
+			details.SASL = mechanisms
+			return append(details.FranzOpts(), producerOpts...)
+		}, mgr)
+	}
+
+	return &w, nil
+}
+
+func (w *redpandaMigratorWriter) accessClient(ctx context.Context, fn kafka.FranzSharedClientUseFn) error {
+	w.clientMut.Lock()
+	defer w.clientMut.Unlock()
+
+	if !w.resourcesChecked {
+		if err := w.checkResources(); err != nil {
+			return err
+		}
+		w.resourcesChecked = true
+	}
+
+	if w.client == nil {
+		var err error
+		if w.client, err = kgo.NewClient(w.clientOpts...); err != nil {
+			return err
+		}
+		w.throttleMetrics.setClient(w.client)
+	}
+
+	if !w.skipPreflightChecks && !w.preflightChecked {
+		if err := w.preflightChecks(ctx, w.client); err != nil {
+			w.client.Close()
+			w.client = nil
+			return fmt.Errorf("preflight checks failed: %w", err)
+		}
+		w.preflightChecked = true
+	}
+
+	if !w.aclsProbed {
+		if err := w.probeACLMigration(ctx); err != nil {
+			return err
+		}
+	}
+
+	return fn(&kafka.FranzSharedClientInfo{Client: w.client, ConnDetails: w.connDetails})
+}
+
+// probeACLMigration checks whether the ACLs of the source cluster can be described before any ACLs are migrated, so
+// that a principal which isn't authorized to describe ACLs is reported once instead of for every topic. ACL migration
+// is disabled when the probe fails with a non-retryable error unless acl_migration is required, in which case an error
+// is returned. The probe is repeated on the next call after retryable errors, such as the input not being connected yet,
+// and the ACLs of the topics created until it succeeds are migrated by migrateTopicACLs.
+func (w *redpandaMigratorWriter) probeACLMigration(ctx context.Context) error {
+	if w.aclMigration == aclMigrationDisabled {
+		w.aclsProbed = true
+		return nil
+	}
+
+	var count int
+	var probed bool
+	probe := func(client *kgo.Client) (err error) {
+		probed = true
+		count, err = probeSourceACLs(ctx, client)
+		return err
+	}
+	var err error
+	if w.adminOpts != nil {
+		err = w.adminClientUse(probe)
+	} else {
+		err = kafka.FranzSharedClientUse(w.inputResource, w.mgr, func(details *kafka.FranzSharedClientInfo) error {
+			return probe(details.Client)
+		})
+	}
+
+	if err == nil {
+		w.mgr.Logger().Infof("Migrating ACLs, found %d topic ACLs in the source cluster", count)
+		w.aclsProbed = true
+		w.aclsEnabled = true
+		return nil
+	}
+
+	// The probe doesn't run when the client isn't available yet, such as when the input isn't connected.
+	if !probed || isRetryableBrokerError(err) {
+		if w.aclMigration == aclMigrationRequired {
+			return fmt.Errorf("failed to describe the ACLs of the source cluster: %w", err)
+		}
+		w.mgr.Logger().Debugf("Failed to describe the ACLs of the source cluster, retrying later: %s", err)
+		return nil
+	}
+
+	if w.aclMigration == aclMigrationRequired {
+		return fmt.Errorf("failed to describe the ACLs of the source cluster and %s is %s: %w", rmoFieldACLMigration, aclMigrationRequired, err)
+	}
+	w.mgr.Logger().Errorf("Disabling ACL migration because the ACLs of the source cluster can't be described: %s. Set the %s field to a principal which is allowed to describe ACLs, or set %s to %s to silence this error", err, rmoFieldAdmin, rmoFieldACLMigration, aclMigrationDisabled)
+	w.aclsProbed = true
+	return nil
+}
+
+// probeSourceACLs describes the literal topic ACLs of the cluster and returns their number.
+func probeSourceACLs(ctx context.Context, client *kgo.Client) (int, error) {
+	builder := kadm.NewACLs().Topics().
+		ResourcePatternType(kadm.ACLPatternLiteral).Operations().Allow().Deny().AllowHosts().DenyHosts()
+	results, err := kadm.NewClient(client).DescribeACLs(ctx, builder)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	for _, res := range results {
+		if res.Err != nil {
+			return 0, res.Err
+		}
+		count += len(res.Described)
+	}
+	return count, nil
+}
+
+// adminClientUse calls fn with the client created from the admin field, which is created on first use.
+func (w *redpandaMigratorWriter) adminClientUse(fn func(client *kgo.Client) error) error {
+	w.adminMut.Lock()
+	defer w.adminMut.Unlock()
+
+	if w.adminClient == nil {
+		var err error
+		if w.adminClient, err = kgo.NewClient(w.adminOpts...); err != nil {
+			return fmt.Errorf("failed to create %s client: %w", rmoFieldAdmin, err)
+		}
+	}
+	return fn(w.adminClient)
+}
+
+// checkResources ensures that the resources referenced by label exist. It's called when connecting instead of in the
+// constructor, because the referenced components might be constructed after this output, such as the schema_registry
+// output of the redpanda_migrator_bundle output.
+func (w *redpandaMigratorWriter) checkResources() error {
+	if err := checkResourceLabel(resourceLabelKindMigratorInput, w.inputResource, w.mgr); err != nil {
+		return fmt.Errorf("invalid %s: %s", rmoFieldInputResource, err)
+	}
+
+	if w.dedup != nil && !w.mgr.HasCache(w.dedup.cache) {
+		return fmt.Errorf("invalid %s: cache resource %q not found", rmoFieldDedupCache, w.dedup.cache)
+	}
 
-			var schemaRegistryOutputResource srResourceKey
-			if translateSchemaIDs {
-				var res string
-				if res, err = conf.FieldString(rmoFieldSchemaRegistryOutputResource); err != nil {
-					return
+	if w.createdTopics != nil && !w.mgr.HasCache(w.createdTopics.cache) {
+		return fmt.Errorf("invalid %s: cache resource %q not found", rmoFieldCreatedTopicsCache, w.createdTopics.cache)
+	}
+
+	if w.translateSchemaIDs {
+		if err := checkResourceLabel(resourceLabelKindSchemaRegistryOutput, string(w.schemaRegistryOutputResource), w.mgr); err != nil {
+			return fmt.Errorf("invalid %s: %s", rmoFieldSchemaRegistryOutputResource, err)
+		}
+	}
+
+	return nil
+}
+
+// preflightChecks verifies that the destination cluster and schema registry support all the operations required by the
+// migrator and returns the errors for every unmet requirement.
+func (w *redpandaMigratorWriter) preflightChecks(ctx context.Context, client *kgo.Client) error {
+	var errs []error
+
+	adm := kadm.NewClient(client)
+	if versions, err := adm.ApiVersions(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to fetch broker API versions: %s", err))
+	} else {
+		for _, v := range versions.Sorted() {
+			if v.Err != nil {
+				errs = append(errs, fmt.Errorf("failed to fetch API versions of broker %d: %s", v.NodeID, v.Err))
+				continue
+			}
+			errs = append(errs, checkBrokerAPIVersions(v.NodeID, v.KeyMaxVersion, w.requiredBrokerAPIVersions())...)
+		}
+	}
+
+	if ops, err := fetchClusterAuthorizedOperations(ctx, client); err != nil {
+		errs = append(errs, fmt.Errorf("failed to describe cluster: %s", err))
+	} else {
+		errs = append(errs, checkClusterAuthorizedOperations(ops)...)
+	}
+
+	if w.idempotentWrite {
+		if err := checkIdempotentWrites(ctx, client); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if w.translateSchemaIDs {
+		if res, ok := w.mgr.GetGeneric(w.schemaRegistryOutputResource); !ok {
+			errs = append(errs, fmt.Errorf("schema_registry output resource %q not found", w.schemaRegistryOutputResource))
+		} else if _, err := res.(*schemaRegistryOutput).client.GetMode(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("schema_registry output resource %q is not reachable: %s", w.schemaRegistryOutputResource, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+type brokerAPIVersion struct {
+	key        int16
+	minVersion int16
+	name       string
+}
+
+// Minimum API versions required by the migrator and the operations they're used for.
+var requiredBrokerAPIVersions = []brokerAPIVersion{
+	{key: kmsg.CreateTopics.Int16(), minVersion: 5, name: "CreateTopics"},
+	{key: kmsg.CreateACLs.Int16(), minVersion: 0, name: "CreateACLs"},
+	{key: kmsg.DescribeConfigs.Int16(), minVersion: 0, name: "DescribeConfigs"},
+}
+
+// Minimum API versions required for idempotent and transactional writes respectively.
+var (
+	idempotentBrokerAPIVersions = []brokerAPIVersion{
+		{key: kmsg.InitProducerID.Int16(), minVersion: 0, name: "InitProducerID"},
+	}
+	transactionalBrokerAPIVersions = []brokerAPIVersion{
+		{key: kmsg.AddPartitionsToTxn.Int16(), minVersion: 0, name: "AddPartitionsToTxn"},
+		{key: kmsg.EndTxn.Int16(), minVersion: 0, name: "EndTxn"},
+	}
+)
+
+// requiredBrokerAPIVersions returns the minimum API versions required by the configured delivery guarantees.
+func (w *redpandaMigratorWriter) requiredBrokerAPIVersions() []brokerAPIVersion {
+	apis := requiredBrokerAPIVersions
+	if w.idempotentWrite {
+		apis = slices.Concat(apis, idempotentBrokerAPIVersions)
+	}
+	if w.transactional {
+		apis = slices.Concat(apis, transactionalBrokerAPIVersions)
+	}
+	return apis
+}
+
+// checkBrokerAPIVersions checks the maximum API versions supported by a broker, as returned by keyMaxVersion, against
+// the required APIs.
+func checkBrokerAPIVersions(nodeID int32, keyMaxVersion func(key int16) (int16, bool), apis []brokerAPIVersion) []error {
+	var errs []error
+	for _, api := range apis {
+		if maxVersion, ok := keyMaxVersion(api.key); !ok {
+			errs = append(errs, fmt.Errorf("broker %d does not support %s requests", nodeID, api.name))
+		} else if maxVersion < api.minVersion {
+			errs = append(errs, fmt.Errorf("broker %d supports %s requests up to v%d, but v%d or later is required", nodeID, api.name, maxVersion, api.minVersion))
+		}
+	}
+	return errs
+}
+
+// fetchClusterAuthorizedOperations returns the bitfield of operations the principal is allowed to perform on the
+// cluster. Brokers which don't support DescribeCluster requests are queried via metadata requests instead.
+func fetchClusterAuthorizedOperations(ctx context.Context, client *kgo.Client) (int32, error) {
+	req := kmsg.NewPtrDescribeClusterRequest()
+	req.IncludeClusterAuthorizedOperations = true
+	resp, err := req.RequestWith(ctx, client)
+	if err == nil {
+		if err := kerr.ErrorForCode(resp.ErrorCode); err != nil {
+			return 0, err
+		}
+		return resp.ClusterAuthorizedOperations, nil
+	}
+
+	metaReq := kmsg.NewPtrMetadataRequest()
+	metaReq.Topics = []kmsg.MetadataRequestTopic{}
+	metaReq.IncludeClusterAuthorizedOperations = true
+	metaResp, metaErr := metaReq.RequestWith(ctx, client)
+	if metaErr != nil {
+		return 0, errors.Join(err, metaErr)
+	}
+	return metaResp.AuthorizedOperations, nil
+}
+
+// checkIdempotentWrites requests a producer ID from the destination cluster in order to verify that it supports
+// idempotent writes and that the principal is allowed to perform them.
+func checkIdempotentWrites(ctx context.Context, client *kgo.Client) error {
+	req := kmsg.NewPtrInitProducerIDRequest()
+	req.ProducerID = -1
+	req.ProducerEpoch = -1
+	resp, err := req.RequestWith(ctx, client)
+	if err == nil {
+		err = kerr.ErrorForCode(resp.ErrorCode)
+	}
+	if err != nil {
+		return fmt.Errorf("destination cluster does not support idempotent writes: %s", err)
+	}
+	return nil
+}
+
+// Cluster operations required by the migrator for creating topics and ACLs.
+var requiredClusterOperations = []kmsg.ACLOperation{kmsg.ACLOperationCreate, kmsg.ACLOperationAlter}
+
+// checkClusterAuthorizedOperations checks the bitfield of operations the principal is allowed to perform on the
+// cluster. See KIP-430 for details.
+func checkClusterAuthorizedOperations(ops int32) []error {
+	if ops == math.MinInt32 {
+		// The broker didn't return the authorized operations, so there's nothing to check.
+		return nil
+	}
+
+	var errs []error
+	for _, op := range requiredClusterOperations {
+		if ops&(1<<int32(op)) == 0 {
+			errs = append(errs, fmt.Errorf("principal is not authorized to perform %s operations on the cluster", op))
+		}
+	}
+	return errs
+}
+
+func (w *redpandaMigratorWriter) yieldClient(ctx context.Context) error {
+	// The ACL sync and topic reconcile loops use the client, so they're stopped first.
+	if err := w.aclSyncer.stop(ctx); err != nil {
+		return err
+	}
+	if err := w.topicReconciler.stop(ctx); err != nil {
+		return err
+	}
+	// The pending reports are produced once the output writes again.
+	if err := w.translationReporter.stop(ctx); err != nil {
+		return err
+	}
+
+	w.clientMut.Lock()
+	defer w.clientMut.Unlock()
+
+	if w.client == nil {
+		return nil
+	}
+
+	var err error
+	if w.transactional {
+		err = kafka.FranzAbortTransaction(ctx, w.client)
+	}
+
+	w.client.Close()
+	w.client = nil
+	if w.credentials != nil {
+		w.credentials.close()
+	}
+	// The limits may have changed by the time the output reconnects.
+	w.recordSizeLimits.Clear()
+
+	w.adminMut.Lock()
+	if w.adminClient != nil {
+		w.adminClient.Close()
+		w.adminClient = nil
+	}
+	w.adminMut.Unlock()
+	return err
+}
+
+// onBatch resolves the schema IDs of the messages before the records of the batch are built, so that the schema ID
+// metadata is written as record headers when the metadata filter includes it.
+func (w *redpandaMigratorWriter) onBatch(ctx context.Context, _ *kgo.Client, batch service.MessageBatch) error {
+	if !w.translateSchemaIDs {
+		return nil
+	}
+	res, ok := w.mgr.GetGeneric(w.schemaRegistryOutputResource)
+	if !ok {
+		// The missing resource is logged by onWrite.
+		return nil
+	}
+	w.translationReporter.start()
+	w.resolveSchemaIDs(ctx, batch, res.(*schemaRegistryOutput).GetDestinationSchemaMapping)
+	return nil
+}
+
+func (w *redpandaMigratorWriter) onWrite(ctx context.Context, client *kgo.Client, batch service.MessageBatch, records []*kgo.Record) error {
+	// Try to create all topics which the input `redpanda_migrator` resource is configured to read from when we receive
+	// the first message.
+	w.runOnce.Do(func() {
+		err := kafka.FranzSharedClientUse(w.inputResource, w.mgr, func(details *kafka.FranzSharedClientInfo) error {
+			inputClient := details.Client
+			outputClient := client
+			topics := inputClient.GetConsumeTopics()
+
+			for _, topic := range topics {
+				if isExcludedTopic(w.inputResource, topic, w.mgr) {
+					w.mgr.Logger().Debugf("Skipping excluded topic %q", topic)
+					continue
 				}
-				schemaRegistryOutputResource = srResourceKey(res)
+
+				destTopic := w.topicPrefix + topic
+				var created bool
+				if err := w.createTopic(ctx, topic, destTopic, inputClient, outputClient); err != nil {
+					if err == errTopicAlreadyExists {
+						w.mgr.Logger().Debugf("Topic %q already exists", destTopic)
+					} else {
+						// This may be a topic which doesn't have any messages in it, so if we failed to create it now, we
+						// log an error and continue. If it does contain messages, we'll attempt to create it again
+						// anyway when receiving a message from it.
+						w.mgr.Logger().Errorf("Failed to create topic %q and ACLs: %s", destTopic, err)
+					}
+				} else {
+					created = true
+					w.mgr.Logger().Infof("Created topic %q", destTopic)
+				}
+
+				if w.aclsEnabled {
+					if err := w.createACLs(ctx, topic, destTopic, inputClient, outputClient); err != nil {
+						w.mgr.Logger().Errorf("Failed to create ACLs for topic %q: %s", destTopic, err)
+					}
+				}
+
+				// The topic cache records whether the destination topic was created by the output, which is the only
+				// case in which it's deleted along with the source topic.
+				w.topicCache.Store(topic, created)
 			}
 
-			var tmpOpts, clientOpts []kgo.Opt
+			if w.aclsEnabled {
+				w.aclSyncer.start(w.syncACLs, w.mgr.Logger())
+				w.aclsMigrated = true
+			}
+			w.topicReconciler.start(w.reconcileTopics, w.mgr.Logger())
 
-			var connDetails *kafka.FranzConnectionDetails
-			if connDetails, err = kafka.FranzConnectionDetailsFromConfig(conf, mgr.Logger()); err != nil {
-				return
+			if w.provenanceHeaders != nil && w.provenanceHeaders.clusterID != "" {
+				clusterID, err := fetchClusterID(ctx, inputClient)
+				if err != nil {
+					w.mgr.Logger().Warnf("Failed to fetch the source cluster ID: %s", err)
+				}
+				w.sourceClusterID = clusterID
 			}
-			clientOpts = append(clientOpts, connDetails.FranzOpts()...)
 
-			if tmpOpts, err = kafka.FranzProducerOptsFromConfig(conf); err != nil {
-				return
+			return nil
+		})
+		if errors.Is(err, kafka.ErrClientClosing) {
+			w.mgr.Logger().Debugf("Input %q is closing, skipping the creation of its topics", w.inputResource)
+		} else if err != nil {
+			w.mgr.Logger().Errorf("Failed to fetch topics from input %q: %s", w.inputResource, err)
+		}
+	})
+
+	if w.aclsEnabled && !w.aclsMigrated {
+		w.migrateTopicACLs(ctx, client)
+	}
+
+	// Records of excluded topics must never be produced, since the destination topic would be created automatically.
+	w.dropExcludedRecords(records)
+
+	// Records which were already written are skipped before any other step, so that topics aren't created for them and
+	// their schema IDs aren't translated.
+	if w.dedup != nil {
+		if err := w.dedup.filter(ctx, batch, records); err != nil {
+			return err
+		}
+	}
+
+	markTombstones(batch, records)
+
+	if w.provenanceHeaders != nil {
+		w.provenanceHeaders.apply(batch, records, w.sourceClusterID, time.Now())
+	}
+
+	if w.translateSchemaIDs {
+		if _, ok := w.mgr.GetGeneric(w.schemaRegistryOutputResource); !ok {
+			w.mgr.Logger().Warnf("schema_registry output resource %q not found; skipping schema ID translation", w.schemaRegistryOutputResource)
+			return nil
+		}
+		w.translateRecordSchemaIDs(batch, records)
+	}
+
+	if err := kafka.FranzSharedClientUse(w.inputResource, w.mgr, func(details *kafka.FranzSharedClientInfo) error {
+		// The timestamp type is looked up once for each topic of the batch, which also logs the warning for topics whose
+		// timestamps are overwritten by the destination cluster.
+		logAppendTime := map[string]bool{}
+		for _, record := range records {
+			if record == nil {
+				continue
 			}
-			clientOpts = append(clientOpts, tmpOpts...)
-
-			clientOpts = append(clientOpts, kgo.AllowAutoTopicCreation()) // TODO: Configure this?
-
-			var client *kgo.Client
-			var clientMut sync.Mutex
-			// Stores the source to destination SchemaID mapping.
-			var schemaIDCache sync.Map
-			var topicCache sync.Map
-			var runOnce sync.Once
-			output, err = kafka.NewFranzWriterFromConfig(
-				conf,
-				kafka.NewFranzWriterHooks(
-					func(ctx context.Context, fn kafka.FranzSharedClientUseFn) error {
-						clientMut.Lock()
-						defer clientMut.Unlock()
-
-						if client == nil {
-							var err error
-							if client, err = kgo.NewClient(clientOpts...); err != nil {
-								return err
-							}
-						}
-
-						return fn(&kafka.FranzSharedClientInfo{Client: client, ConnDetails: connDetails})
-					}).WithYieldClientFn(
-					func(context.Context) error {
-						clientMut.Lock()
-						defer clientMut.Unlock()
-
-						if client == nil {
-							return nil
-						}
-
-						client.Close()
-						client = nil
-						return nil
-					}).WithWriteHookFn(
-					func(ctx context.Context, client *kgo.Client, records []*kgo.Record) error {
-						// Try to create all topics which the input `redpanda_migrator` resource is configured to read
-						// from when we receive the first message.
-						runOnce.Do(func() {
-							err := kafka.FranzSharedClientUse(inputResource, mgr, func(details *kafka.FranzSharedClientInfo) error {
-								inputClient := details.Client
-								outputClient := client
-								topics := inputClient.GetConsumeTopics()
-
-								for _, topic := range topics {
-									if err := createTopic(ctx, topic, replicationFactorOverride, replicationFactor, inputClient, outputClient); err != nil {
-										if err == errTopicAlreadyExists {
-											topicCache.Store(topic, struct{}{})
-											mgr.Logger().Debugf("Topic %q already exists", topic)
-										} else {
-											// This may be a topic which doesn't have any messages in it, so if we
-											// failed to create it now, we log an error and continue. If it does contain
-											// messages, we'll attempt to create it again anyway when receiving a
-											// message from it.
-											mgr.Logger().Errorf("Failed to create topic %q and ACLs: %s", topic, err)
-										}
-									} else {
-										mgr.Logger().Infof("Created topic %q", topic)
-									}
-
-									if err := createACLs(ctx, topic, inputClient, outputClient); err != nil {
-										mgr.Logger().Errorf("Failed to create ACLs for topic %q: %s", topic, err)
-									}
-
-									topicCache.Store(topic, struct{}{})
-								}
-
-								return nil
-							})
-							if err != nil {
-								mgr.Logger().Errorf("Failed to fetch topics from input %q: %s", inputResource, err)
-							}
-						})
-
-						if translateSchemaIDs {
-							if res, ok := mgr.GetGeneric(schemaRegistryOutputResource); ok {
-								srOutput := res.(*schemaRegistryOutput)
-
-								var ch franz_sr.ConfluentHeader
-								for recordIdx, record := range records {
-									schemaID, _, err := ch.DecodeID(record.Value)
-									if err != nil {
-										mgr.Logger().Warnf("Failed to extract schema ID from message index %d on topic %q: %s", recordIdx, record.Topic, err)
-										continue
-									}
-
-									var destSchemaID int
-									if cachedID, ok := schemaIDCache.Load(schemaID); !ok {
-										destSchemaID, err = srOutput.GetDestinationSchemaID(ctx, schemaID)
-										if err != nil {
-											mgr.Logger().Warnf("Failed to fetch destination schema ID from message index %d on topic %q: %s", recordIdx, record.Topic, err)
-											continue
-										}
-										schemaIDCache.Store(schemaID, destSchemaID)
-									} else {
-										destSchemaID = cachedID.(int)
-									}
-
-									err = sr.UpdateID(record.Value, destSchemaID)
-									if err != nil {
-										mgr.Logger().Warnf("Failed to update schema ID in message index %d on topic %s: %q", recordIdx, record.Topic, err)
-										continue
-									}
-								}
-							} else {
-								mgr.Logger().Warnf("schema_registry output resource %q not found; skipping schema ID translation", schemaRegistryOutputResource)
-								return nil
-							}
-
-						}
-
-						// The current record may be coming from a topic which was created later during runtime, so we
-						// need to try and create it if we haven't done so already.
-						if err := kafka.FranzSharedClientUse(inputResource, mgr, func(details *kafka.FranzSharedClientInfo) error {
-							for _, record := range records {
-								if _, ok := topicCache.Load(record.Topic); !ok {
-									if err := createTopic(ctx, record.Topic, replicationFactorOverride, replicationFactor, details.Client, client); err != nil {
-										if err == errTopicAlreadyExists {
-											mgr.Logger().Debugf("Topic %q already exists", record.Topic)
-										} else {
-											return fmt.Errorf("failed to create topic %q and ACLs: %s", record.Topic, err)
-										}
-									} else {
-										mgr.Logger().Infof("Created topic %q", record.Topic)
-									}
-
-									if err := createACLs(ctx, record.Topic, details.Client, client); err != nil {
-										mgr.Logger().Errorf("Failed to create ACLs for topic %q: %s", record.Topic, err)
-									}
-
-									topicCache.Store(record.Topic, struct{}{})
-								}
-							}
-							return nil
-						}); err != nil {
-							mgr.Logger().With("error", err, "resource", inputResource).Warn("Failed to access shared client for given resource identifier")
-						}
-
-						return nil
-					}))
-			return
+			if _, ok := logAppendTime[record.Topic]; !ok {
+				logAppendTime[record.Topic] = w.sourceTimestampType(ctx, details.Client, record.Topic) == timestampTypeLogAppendTime
+			}
+		}
+		if !w.preserveTimestampType {
+			carrySourceTimestamps(batch, records, func(topic string) bool {
+				return logAppendTime[topic]
+			})
+		}
+		return nil
+	}); err != nil {
+		// The input is closing during shutdown, so the batch is rejected and written again once the pipeline restarts.
+		if errors.Is(err, kafka.ErrClientClosing) {
+			w.mgr.Logger().With("resource", w.inputResource).Debug("Shared client is closing, rejecting batch")
+			return err
+		}
+		w.mgr.Logger().With("error", err, "resource", w.inputResource).Warn("Failed to access shared client for given resource identifier")
+	}
+
+	if w.valueMapping != nil {
+		if err := w.applyValueMapping(batch, records); err != nil {
+			return err
+		}
+	}
+
+	if w.topicPrefix != "" {
+		for _, record := range records {
+			if record != nil {
+				record.Topic = w.topicPrefix + record.Topic
+			}
+		}
+	}
+	return nil
+}
+
+// onTopic creates the destination topic of the records of a topic of the batch unless it exists already, and then
+// validates their sizes. The records of each topic are produced as soon as it exists, so that topics which are slow to
+// create don't hold back the records of other topics, and failing to create a topic fails the batch, so that it's
+// retried.
+func (w *redpandaMigratorWriter) onTopic(ctx context.Context, client *kgo.Client, destTopic string, batch service.MessageBatch, records []*kgo.Record) error {
+	// The topic cache is keyed by the source topic names.
+	topic := strings.TrimPrefix(destTopic, w.topicPrefix)
+	if _, ok := w.topicCache.Load(topic); !ok {
+		// The current record may be coming from a topic which was created later during runtime, so we need to try and
+		// create it if we haven't done so already.
+		var createErr error
+		if err := kafka.FranzSharedClientUse(w.inputResource, w.mgr, func(details *kafka.FranzSharedClientInfo) error {
+			createErr = w.topicCreations.ensure(ctx, topic, func() error {
+				return w.createMissingTopic(ctx, topic, details.Client, client)
+			})
+			return nil
+		}); err != nil {
+			if errors.Is(err, kafka.ErrClientClosing) {
+				w.mgr.Logger().With("resource", w.inputResource).Debug("Shared client is closing, rejecting batch")
+				return err
+			}
+			w.mgr.Logger().With("error", err, "resource", w.inputResource).Warn("Failed to access shared client for given resource identifier")
+		}
+		if createErr != nil {
+			return createErr
+		}
+	}
+
+	return w.validateRecordSizes(batch, records, func(destTopic string) (recordSizeLimit, bool) {
+		destClient, err := w.destinationClient(destTopic, client)
+		if err != nil {
+			w.mgr.Logger().Warnf("Skipping record size validation for topic %q: %s", destTopic, err)
+			return recordSizeLimit{}, false
+		}
+		return w.recordSizeLimit(ctx, destClient, destTopic)
+	})
+}
+
+// createMissingTopic creates the destination topic of topic and its ACLs. The topic is added to the topic cache unless
+// it failed to be created.
+func (w *redpandaMigratorWriter) createMissingTopic(ctx context.Context, topic string, inputClient, outputClient *kgo.Client) error {
+	// The topic may have been created by another batch while this one was waiting.
+	if _, ok := w.topicCache.Load(topic); ok {
+		return nil
+	}
+
+	destTopic := w.topicPrefix + topic
+	var created bool
+	if err := w.createTopic(ctx, topic, destTopic, inputClient, outputClient); err != nil {
+		if err != errTopicAlreadyExists {
+			return fmt.Errorf("failed to create topic %q and ACLs: %w", destTopic, err)
+		}
+		w.mgr.Logger().Debugf("Topic %q already exists", destTopic)
+	} else {
+		created = true
+		w.mgr.Logger().Infof("Created topic %q", destTopic)
+	}
+
+	if w.aclsEnabled {
+		if err := w.createACLs(ctx, topic, destTopic, inputClient, outputClient); err != nil {
+			w.mgr.Logger().Errorf("Failed to create ACLs for topic %q: %s", destTopic, err)
+		}
+	}
+
+	w.topicCache.Store(topic, created)
+	return nil
+}
+
+// isTombstone returns whether a message was read from a tombstone record, which doesn't have a value.
+func isTombstone(msg *service.Message) bool {
+	switch v, _ := msg.MetaGetMut("kafka_tombstone_message"); v := v.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// markTombstones sets the value of the records of tombstone messages to nil, so that they are produced as tombstones
+// even when processors replaced the nil body of the message with an empty one.
+func markTombstones(batch service.MessageBatch, records []*kgo.Record) {
+	for recordIdx, record := range records {
+		if record != nil && recordIdx < len(batch) && isTombstone(batch[recordIdx]) {
+			record.Value = nil
+		}
+	}
+}
+
+// applyValueMapping replaces the value of each record with the result of the value mapping. Records which the mapping
+// deletes are replaced with nil, so that they are not produced. Tombstones are produced as is, since they don't have a
+// value to map.
+func (w *redpandaMigratorWriter) applyValueMapping(batch service.MessageBatch, records []*kgo.Record) error {
+	var ch franz_sr.ConfluentHeader
+	for recordIdx, record := range records {
+		if record == nil || record.Value == nil {
+			continue
+		}
+		msg := batch[recordIdx].Copy()
+
+		// Plain values may start with the same magic byte as the Confluent wire format, so the header is only stripped
+		// when the schema ID is known to the schema registry.
+		var header []byte
+		if schemaID, body, err := ch.DecodeID(record.Value); err == nil && w.isResolvedSchemaID(schemaID) {
+			header = record.Value[:len(record.Value)-len(body)]
+			msg.SetBytes(body)
+			msg.MetaSetMut("schema_id", schemaID)
+		} else {
+			msg.SetBytes(record.Value)
+		}
+
+		res, err := msg.BloblangQuery(w.valueMapping)
+		if err != nil {
+			return fmt.Errorf("failed to apply %s to message index %d on topic %q: %w", rmoFieldValueMapping, recordIdx, record.Topic, err)
+		}
+		if res == nil {
+			w.deletedRecords.Incr(1, record.Topic)
+			records[recordIdx] = nil
+			continue
+		}
+
+		value, err := res.AsBytes()
+		if err != nil {
+			return fmt.Errorf("failed to read the result of %s for message index %d on topic %q: %w", rmoFieldValueMapping, recordIdx, record.Topic, err)
+		}
+		if header != nil {
+			value = slices.Concat(header, value)
+		}
+		record.Value = value
+	}
+	return nil
+}
+
+// isResolvedSchemaID returns true when the destination schema ID was resolved in the schema registry.
+func (w *redpandaMigratorWriter) isResolvedSchemaID(id int) bool {
+	_, ok := w.resolvedSchemaIDs.Load(id)
+	return ok
+}
+
+// dropExcludedRecords replaces the records of topics which are excluded by the input with nil, so that they are not
+// produced.
+func (w *redpandaMigratorWriter) dropExcludedRecords(records []*kgo.Record) {
+	for i, record := range records {
+		if record == nil || !isExcludedTopic(w.inputResource, record.Topic, w.mgr) {
+			continue
+		}
+		if _, logged := w.droppedExcludedTopics.LoadOrStore(record.Topic, struct{}{}); !logged {
+			w.mgr.Logger().Warnf("Dropping records of topic %q because the topic is excluded by input %q", record.Topic, w.inputResource)
+		}
+		records[i] = nil
+	}
+}
+
+// createTopic creates destTopic from topic and retries transient errors with the configured backoff.
+func (w *redpandaMigratorWriter) createTopic(ctx context.Context, topic, destTopic string, inputClient, outputClient *kgo.Client) error {
+	outputClient, err := w.destinationClient(destTopic, outputClient)
+	if err != nil {
+		return err
+	}
+	return w.retryBrokerOperation(ctx, fmt.Sprintf("create topic %q", destTopic), func() error {
+		return w.adminOps.do(ctx, adminOpCreateTopic, func() error {
+			resp, err := createTopic(ctx, topic, destTopic, w.replicationFactorOverride, w.replicationFactor, w.preserveTimestampType, w.topicConfigOverrides, inputClient, outputClient)
+			if err != nil {
+				return err
+			}
+			w.recordCreatedTopic(ctx, destTopic)
+			w.events.topicCreated(destTopic, resp.NumPartitions, resp.ReplicationFactor)
+			return nil
 		})
+	})
+}
+
+// migrateTopicACLs creates the ACLs of the topics which were created before ACL migration was enabled and starts the
+// ACL syncer. This happens when probing the ACLs of the source cluster failed with a retryable error, such as the input
+// not being connected yet, until after the first batch was written.
+func (w *redpandaMigratorWriter) migrateTopicACLs(ctx context.Context, outputClient *kgo.Client) {
+	var topics []string
+	w.topicCache.Range(func(key, _ any) bool {
+		topics = append(topics, key.(string))
+		return true
+	})
+	slices.Sort(topics)
+
+	err := kafka.FranzSharedClientUse(w.inputResource, w.mgr, func(details *kafka.FranzSharedClientInfo) error {
+		for _, topic := range topics {
+			destTopic := w.topicPrefix + topic
+			if err := w.createACLs(ctx, topic, destTopic, details.Client, outputClient); err != nil {
+				w.mgr.Logger().Errorf("Failed to create ACLs for topic %q: %s", destTopic, err)
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		panic(err)
+		// The ACLs are migrated again with the next batch.
+		w.mgr.Logger().Debugf("Failed to migrate the ACLs of the created topics, retrying later: %s", err)
+		return
+	}
+	w.aclSyncer.start(w.syncACLs, w.mgr.Logger())
+	w.aclsMigrated = true
+}
+
+// createACLs copies the ACLs of topic to destTopic and retries transient errors with the configured backoff. The ACLs
+// are described with the admin client instead of inputClient when the admin field is set.
+func (w *redpandaMigratorWriter) createACLs(ctx context.Context, topic, destTopic string, inputClient, outputClient *kgo.Client) error {
+	outputClient, err := w.destinationClient(destTopic, outputClient)
+	if err != nil {
+		return err
+	}
+	return w.retryBrokerOperation(ctx, fmt.Sprintf("create ACLs for topic %q", destTopic), func() error {
+		create := func(sourceClient *kgo.Client) error {
+			created, err := createACLs(ctx, topic, destTopic, w.principalMapper, sourceClient, outputClient)
+			for _, acl := range created {
+				w.events.aclCreated(destTopic, acl)
+			}
+			return err
+		}
+		return w.adminOps.do(ctx, adminOpCreateACLs, func() error {
+			if w.adminOpts == nil {
+				return create(inputClient)
+			}
+			return w.adminClientUse(create)
+		})
+	})
+}
+
+// destinationClient returns the client of the credential which writes to destTopic, or the default client when none
+// of the credential_overrides match it.
+func (w *redpandaMigratorWriter) destinationClient(destTopic string, defaultClient *kgo.Client) (*kgo.Client, error) {
+	if w.credentials == nil {
+		return defaultClient, nil
+	}
+	client, err := w.credentials.client(destTopic)
+	if err != nil || client == nil {
+		return defaultClient, err
+	}
+	return client, nil
+}
+
+func (w *redpandaMigratorWriter) retryBrokerOperation(ctx context.Context, name string, op func() error) error {
+	// Each operation gets its own copy of the backoff, since they can run concurrently.
+	b := *w.topicCreateBackoff
+	b.Reset()
+	return retryBrokerOperation(ctx, &b, op, func(err error, wait time.Duration) {
+		w.mgr.Logger().Warnf("Failed to %s, retrying in %s: %s", name, wait, err)
+	})
+}
+
+// sourceTimestampType returns the timestamp type of topic in the source cluster, which is cached per topic. An empty
+// string is returned when it can't be fetched, in which case it's fetched again for the next record of the topic.
+func (w *redpandaMigratorWriter) sourceTimestampType(ctx context.Context, inputClient *kgo.Client, topic string) string {
+	if v, ok := w.timestampTypes.Load(topic); ok {
+		return v.(string)
+	}
+
+	tsType, err := fetchTimestampType(ctx, inputClient, topic)
+	if err != nil {
+		w.mgr.Logger().Warnf("Failed to fetch the timestamp type of topic %q from the source cluster: %s", topic, err)
+		return ""
+	}
+
+	if _, loaded := w.timestampTypes.LoadOrStore(topic, tsType); !loaded && w.preserveTimestampType && tsType == timestampTypeLogAppendTime {
+		w.mgr.Logger().Warnf("Source topic %q uses LogAppendTime timestamps, the timestamps of its records will differ in topic %q of the destination cluster", topic, w.topicPrefix+topic)
+	}
+	return tsType
+}
+
+// carrySourceTimestamps sets the timestamps of records from source topics which use LogAppendTime timestamps to the
+// time they were appended to the source log, which is stored in the kafka_timestamp_ms metadata. Records with a
+// timestamp set via the timestamp_ms field are left unchanged. The records must be in the same order as the messages of
+// the batch they were created from.
+func carrySourceTimestamps(batch service.MessageBatch, records []*kgo.Record, isLogAppendTime func(topic string) bool) {
+	for i, record := range records {
+		if i >= len(batch) {
+			break
+		}
+		if record == nil || !record.Timestamp.IsZero() || !isLogAppendTime(record.Topic) {
+			continue
+		}
+
+		v, ok := batch[i].MetaGetMut("kafka_timestamp_ms")
+		if !ok {
+			continue
+		}
+		if ts, ok := v.(int64); ok {
+			record.Timestamp = time.UnixMilli(ts)
+		}
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// produceCompressionMetrics is a franz-go hook which counts the bytes of every produced batch before and after
+// compression, so that users can verify that the configured compression is applied.
+type produceCompressionMetrics struct {
+	uncompressedBytes *service.MetricCounter
+	compressedBytes   *service.MetricCounter
+}
+
+var _ kgo.HookProduceBatchWritten = (*produceCompressionMetrics)(nil)
+
+func (m *produceCompressionMetrics) OnProduceBatchWritten(_ kgo.BrokerMetadata, topic string, _ int32, metrics kgo.ProduceBatchMetrics) {
+	m.uncompressedBytes.Incr(int64(metrics.UncompressedBytes), topic)
+	m.compressedBytes.Incr(int64(metrics.CompressedBytes), topic)
+}
+
+//------------------------------------------------------------------------------
+
+// topicMatcher checks whether topics match a list of names or regular expressions. The result is cached for each topic
+// since it's checked for every record.
+type topicMatcher struct {
+	topics   []string
+	patterns []*regexp.Regexp
+	cache    sync.Map
+}
+
+func newTopicMatcher(topics []string, regexpTopics bool) (*topicMatcher, error) {
+	m := topicMatcher{topics: topics}
+	if regexpTopics {
+		m.patterns = make([]*regexp.Regexp, 0, len(topics))
+		for _, topic := range topics {
+			tp, err := regexp.Compile(topic)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compile topic regex %q: %s", topic, err)
+			}
+			m.patterns = append(m.patterns, tp)
+		}
+	}
+	return &m, nil
+}
+
+func (m *topicMatcher) matches(topic string) bool {
+	if m == nil {
+		return false
+	}
+	if v, ok := m.cache.Load(topic); ok {
+		return v.(bool)
+	}
+
+	var match bool
+	if m.patterns != nil {
+		match = slices.ContainsFunc(m.patterns, func(tp *regexp.Regexp) bool {
+			return tp.MatchString(topic)
+		})
+	} else {
+		match = slices.Contains(m.topics, topic)
+	}
+	m.cache.Store(topic, match)
+	return match
+}
+
+//------------------------------------------------------------------------------
+
+// provenanceHeaderKeys contains the header keys used for recording where a migrated record came from. Empty keys are
+// omitted.
+type provenanceHeaderKeys struct {
+	partition string
+	offset    string
+	timestamp string
+	clusterID string
+}
+
+// provenanceHeaderKeysFromParsed returns nil when provenance headers are disabled.
+func provenanceHeaderKeysFromParsed(conf *service.ParsedConfig) (*provenanceHeaderKeys, error) {
+	enabled, err := conf.FieldBool(rmoFieldProvenanceHeadersEnabled)
+	if err != nil || !enabled {
+		return nil, err
+	}
+
+	var k provenanceHeaderKeys
+	if k.partition, err = conf.FieldString(rmoFieldProvenanceHeadersPartitionKey); err != nil {
+		return nil, err
+	}
+	if k.offset, err = conf.FieldString(rmoFieldProvenanceHeadersOffsetKey); err != nil {
+		return nil, err
+	}
+	if k.timestamp, err = conf.FieldString(rmoFieldProvenanceHeadersTimestampKey); err != nil {
+		return nil, err
+	}
+	if k.clusterID, err = conf.FieldString(rmoFieldProvenanceHeadersClusterIDKey); err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// apply appends the provenance headers to the records, which must be in the same order as the messages of the batch
+// they were created from. Only the record headers are modified.
+func (k *provenanceHeaderKeys) apply(batch service.MessageBatch, records []*kgo.Record, clusterID string, now time.Time) {
+	ts := []byte(strconv.FormatInt(now.UnixMilli(), 10))
+	for i, record := range records {
+		if i >= len(batch) {
+			break
+		}
+		if record == nil {
+			continue
+		}
+		msg := batch[i]
+
+		if k.clusterID != "" && clusterID != "" {
+			record.Headers = append(record.Headers, kgo.RecordHeader{Key: k.clusterID, Value: []byte(clusterID)})
+		}
+		if k.partition != "" {
+			if v, ok := msg.MetaGet("kafka_partition"); ok {
+				record.Headers = append(record.Headers, kgo.RecordHeader{Key: k.partition, Value: []byte(v)})
+			}
+		}
+		if k.offset != "" {
+			if v, ok := msg.MetaGet("kafka_offset"); ok {
+				record.Headers = append(record.Headers, kgo.RecordHeader{Key: k.offset, Value: []byte(v)})
+			}
+		}
+		if k.timestamp != "" {
+			record.Headers = append(record.Headers, kgo.RecordHeader{Key: k.timestamp, Value: ts})
+		}
+	}
+}
+
+func fetchClusterID(ctx context.Context, client *kgo.Client) (string, error) {
+	metadata, err := kadm.NewClient(client).BrokerMetadata(ctx)
+	if err != nil {
+		return "", err
 	}
+	return metadata.Cluster, nil
 }
@@ -0,0 +1,589 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/kafka"
+)
+
+func TestRedpandaMigratorOutputProvenanceHeaders(t *testing.T) {
+	spec := service.NewConfigSpec().Fields(redpandaMigratorOutputConfigFields()...)
+
+	conf, err := spec.ParseYAML(`
+seed_brokers: [ localhost:9092 ]
+topic: foo
+provenance_headers:
+  enabled: true
+  cluster_id_key: ""
+`, nil)
+	require.NoError(t, err)
+
+	keys, err := provenanceHeaderKeysFromParsed(conf.Namespace(rmoFieldProvenanceHeaders))
+	require.NoError(t, err)
+	require.NotNil(t, keys)
+
+	msg := service.NewMessage([]byte("\x00\x00\x00\x00\x01foo"))
+	msg.MetaSetMut("kafka_partition", "3")
+	msg.MetaSetMut("kafka_offset", "42")
+	noMeta := service.NewMessage([]byte("bar"))
+
+	records := []*kgo.Record{
+		{Value: []byte("\x00\x00\x00\x00\x01foo"), Headers: []kgo.RecordHeader{{Key: "rp_migrator_src_offset", Value: []byte("existing")}}},
+		{Value: []byte("bar")},
+	}
+
+	keys.apply(service.MessageBatch{msg, noMeta}, records, "cluster-id", time.UnixMilli(1000))
+
+	assert.Equal(t, []byte("\x00\x00\x00\x00\x01foo"), records[0].Value)
+	assert.Equal(t, []kgo.RecordHeader{
+		{Key: "rp_migrator_src_offset", Value: []byte("existing")},
+		{Key: "rp_migrator_src_partition", Value: []byte("3")},
+		{Key: "rp_migrator_src_offset", Value: []byte("42")},
+		{Key: "rp_migrator_ts", Value: []byte("1000")},
+	}, records[0].Headers)
+	assert.Equal(t, []kgo.RecordHeader{
+		{Key: "rp_migrator_ts", Value: []byte("1000")},
+	}, records[1].Headers)
+
+	conf, err = spec.ParseYAML(`
+seed_brokers: [ localhost:9092 ]
+topic: foo
+`, nil)
+	require.NoError(t, err)
+
+	keys, err = provenanceHeaderKeysFromParsed(conf.Namespace(rmoFieldProvenanceHeaders))
+	require.NoError(t, err)
+	assert.Nil(t, keys)
+}
+
+func TestRedpandaMigratorOutputCarrySourceTimestamps(t *testing.T) {
+	newMsg := func(ts int64) *service.Message {
+		msg := service.NewMessage([]byte("foo"))
+		msg.MetaSetMut("kafka_timestamp_ms", ts)
+		return msg
+	}
+	batch := service.MessageBatch{newMsg(1000), newMsg(2000), newMsg(3000), service.NewMessage([]byte("bar"))}
+	records := []*kgo.Record{
+		{Topic: "log_append_time"},
+		{Topic: "create_time"},
+		{Topic: "log_append_time", Timestamp: time.UnixMilli(5000)},
+		{Topic: "log_append_time"},
+	}
+
+	carrySourceTimestamps(batch, records, func(topic string) bool {
+		return topic == "log_append_time"
+	})
+
+	assert.Equal(t, time.UnixMilli(1000), records[0].Timestamp)
+	assert.True(t, records[1].Timestamp.IsZero(), "records from CreateTime topics are unchanged")
+	assert.Equal(t, time.UnixMilli(5000), records[2].Timestamp, "timestamps set via timestamp_ms are unchanged")
+	assert.True(t, records[3].Timestamp.IsZero(), "records without a source timestamp are unchanged")
+}
+
+func TestRedpandaMigratorOutputTieredStorage(t *testing.T) {
+	spec := service.NewConfigSpec().Fields(redpandaMigratorOutputConfigFields()...)
+
+	tests := []struct {
+		name     string
+		config   string
+		expected map[string]*string
+	}{
+		{
+			name:     "unset",
+			expected: map[string]*string{},
+		},
+		{
+			name:   "read and write",
+			config: "tiered_storage_read: true\ntiered_storage_write: false\n",
+			expected: map[string]*string{
+				"redpanda.remote.read":  kadm.StringPtr("true"),
+				"redpanda.remote.write": kadm.StringPtr("false"),
+			},
+		},
+		{
+			name:     "write only",
+			config:   "tiered_storage_write: true\n",
+			expected: map[string]*string{"redpanda.remote.write": kadm.StringPtr("true")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conf, err := spec.ParseYAML(`
+seed_brokers: [ localhost:9092 ]
+topic: foo
+`+test.config, nil)
+			require.NoError(t, err)
+
+			w, err := newRedpandaMigratorWriterFromConfig(conf, service.MockResources())
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, w.topicConfigOverrides)
+		})
+	}
+}
+
+func TestRedpandaMigratorOutputEmptyInputResource(t *testing.T) {
+	conf, err := service.NewConfigSpec().Fields(redpandaMigratorOutputConfigFields()...).ParseYAML(`
+seed_brokers: [ localhost:9092 ]
+topic: foo
+input_resource: ""
+mirror_deletions: true
+created_topics_cache: created
+`, nil)
+	require.NoError(t, err)
+
+	_, err = newRedpandaMigratorWriterFromConfig(conf, service.MockResources())
+	require.ErrorContains(t, err, "input_resource must not be empty")
+}
+
+func TestRedpandaMigratorOutputValueMapping(t *testing.T) {
+	mapping, err := bloblang.Parse(`
+root = match {
+  @kafka_topic == "drop" => deleted()
+  @kafka_topic == "fail" => throw("nope")
+  @schema_id != null => this.without("email").merge({"schema_id": @schema_id})
+  _ => content().uppercase()
+}
+`)
+	require.NoError(t, err)
+	w := &redpandaMigratorWriter{
+		valueMapping:   mapping,
+		deletedRecords: service.MockResources().Metrics().NewCounter("redpanda_migrator_deleted_records", "topic"),
+	}
+	w.resolvedSchemaIDs.Store(9, struct{}{})
+
+	newMsg := func(topic, value string) *service.Message {
+		msg := service.NewMessage([]byte(value))
+		msg.MetaSetMut("kafka_topic", topic)
+		return msg
+	}
+	batch := service.MessageBatch{
+		newMsg("plain", "foo"),
+		newMsg("drop", "bar"),
+		newMsg("framed", "\x00\x00\x00\x00\x07{\"email\":\"a@b.c\",\"name\":\"baz\"}"),
+		newMsg("plain", ""),
+		newMsg("plain", "\x00\x00\x00\x00\x05foo"),
+	}
+	records := []*kgo.Record{
+		{Topic: "plain", Value: []byte("foo")},
+		{Topic: "drop", Value: []byte("bar")},
+		// The schema ID was already translated from 7 to 9.
+		{Topic: "framed", Value: []byte("\x00\x00\x00\x00\x09{\"email\":\"a@b.c\",\"name\":\"baz\"}")},
+		// Tombstones are not mapped.
+		{Topic: "plain", Value: nil},
+		// Plain values which start with an unknown schema ID keep their first bytes.
+		{Topic: "plain", Value: []byte("\x00\x00\x00\x00\x05foo")},
+	}
+
+	require.NoError(t, w.applyValueMapping(batch, records))
+	assert.Equal(t, []byte("FOO"), records[0].Value)
+	assert.Nil(t, records[1])
+	assert.Equal(t, []byte("\x00\x00\x00\x00\x09{\"name\":\"baz\",\"schema_id\":9}"), records[2].Value)
+	require.NotNil(t, records[3])
+	assert.Nil(t, records[3].Value)
+	assert.Equal(t, []byte("\x00\x00\x00\x00\x05FOO"), records[4].Value)
+	value, err := batch[2].AsBytes()
+	require.NoError(t, err)
+	assert.Equal(t, "\x00\x00\x00\x00\x07{\"email\":\"a@b.c\",\"name\":\"baz\"}", string(value), "messages are unchanged")
+
+	err = w.applyValueMapping(
+		service.MessageBatch{newMsg("fail", "foo")},
+		[]*kgo.Record{{Topic: "fail", Value: []byte("foo")}},
+	)
+	require.ErrorContains(t, err, "nope")
+}
+
+func TestMarkTombstones(t *testing.T) {
+	newMsg := func(value string, tombstone any) *service.Message {
+		msg := service.NewMessage([]byte(value))
+		if tombstone != nil {
+			msg.MetaSetMut("kafka_tombstone_message", tombstone)
+		}
+		return msg
+	}
+	batch := service.MessageBatch{
+		newMsg("foo", false),
+		newMsg("", true),
+		newMsg("", "true"),
+		newMsg("", nil),
+		newMsg("", true),
+	}
+	records := []*kgo.Record{
+		{Value: []byte("foo")},
+		{Value: []byte{}},
+		{Value: []byte{}},
+		{Value: []byte{}},
+		nil,
+	}
+
+	markTombstones(batch, records)
+	assert.Equal(t, []byte("foo"), records[0].Value)
+	assert.Nil(t, records[1].Value)
+	assert.Nil(t, records[2].Value)
+	assert.Equal(t, []byte{}, records[3].Value, "empty values are not tombstones")
+	assert.Nil(t, records[4])
+}
+
+func TestTopicMatcher(t *testing.T) {
+	m, err := newTopicMatcher([]string{"foo", "bar"}, false)
+	require.NoError(t, err)
+	assert.True(t, m.matches("foo"))
+	assert.True(t, m.matches("bar"))
+	assert.False(t, m.matches("foobar"))
+	assert.False(t, m.matches("foobar"))
+
+	m, err = newTopicMatcher([]string{"^foo.*", "baz$"}, true)
+	require.NoError(t, err)
+	assert.True(t, m.matches("foo"))
+	assert.True(t, m.matches("foobar"))
+	assert.True(t, m.matches("foobaz"))
+	assert.True(t, m.matches("barbaz"))
+	assert.False(t, m.matches("bar"))
+
+	_, err = newTopicMatcher([]string{"("}, true)
+	require.Error(t, err)
+}
+
+func TestCheckBrokerAPIVersions(t *testing.T) {
+	keyMaxVersion := func(versions map[kmsg.Key]int16) func(int16) (int16, bool) {
+		return func(key int16) (int16, bool) {
+			v, ok := versions[kmsg.Key(key)]
+			return v, ok
+		}
+	}
+
+	errs := checkBrokerAPIVersions(1, keyMaxVersion(map[kmsg.Key]int16{
+		kmsg.CreateTopics:    7,
+		kmsg.CreateACLs:      3,
+		kmsg.DescribeConfigs: 4,
+	}), requiredBrokerAPIVersions)
+	assert.Empty(t, errs)
+
+	errs = checkBrokerAPIVersions(1, keyMaxVersion(map[kmsg.Key]int16{
+		kmsg.CreateTopics: 4,
+	}), requiredBrokerAPIVersions)
+	require.Len(t, errs, 3)
+	assert.EqualError(t, errs[0], "broker 1 supports CreateTopics requests up to v4, but v5 or later is required")
+	assert.EqualError(t, errs[1], "broker 1 does not support CreateACLs requests")
+	assert.EqualError(t, errs[2], "broker 1 does not support DescribeConfigs requests")
+}
+
+func TestCheckClusterAuthorizedOperations(t *testing.T) {
+	assert.Empty(t, checkClusterAuthorizedOperations(math.MinInt32))
+	assert.Empty(t, checkClusterAuthorizedOperations(1<<int32(kmsg.ACLOperationCreate)|1<<int32(kmsg.ACLOperationAlter)))
+
+	errs := checkClusterAuthorizedOperations(1 << int32(kmsg.ACLOperationDescribe))
+	require.Len(t, errs, 2)
+	assert.EqualError(t, errs[0], "principal is not authorized to perform CREATE operations on the cluster")
+	assert.EqualError(t, errs[1], "principal is not authorized to perform ALTER operations on the cluster")
+}
+
+// testMetricsExporter records the value of every counter and gauge and the timings of every timer keyed by their name
+// and their topic or broker label, the labels which are added for the component are ignored.
+type testMetricsExporter struct {
+	mu       sync.Mutex
+	counters map[string]int64
+	gauges   map[string]int64
+	timings  map[string][]int64
+}
+
+// testMetricKey returns the key of a metric, which is its name followed by the value of its topic or broker label.
+func testMetricKey(name string, labelKeys, labelValues []string) string {
+	for _, label := range []string{"topic", "broker"} {
+		if i := slices.Index(labelKeys, label); i >= 0 {
+			name += "," + labelValues[i]
+		}
+	}
+	return name
+}
+
+type testCounter struct {
+	e   *testMetricsExporter
+	key string
+}
+
+func (c testCounter) Incr(count int64) {
+	c.e.mu.Lock()
+	c.e.counters[c.key] += count
+	c.e.mu.Unlock()
+}
+
+type testTimer struct {
+	e   *testMetricsExporter
+	key string
+}
+
+func (c testTimer) Timing(delta int64) {
+	c.e.mu.Lock()
+	c.e.timings[c.key] = append(c.e.timings[c.key], delta)
+	c.e.mu.Unlock()
+}
+
+type testGauge struct {
+	e   *testMetricsExporter
+	key string
+}
+
+func (c testGauge) Set(value int64) {
+	c.e.mu.Lock()
+	c.e.gauges[c.key] = value
+	c.e.mu.Unlock()
+}
+
+func (e *testMetricsExporter) NewCounterCtor(name string, labelKeys ...string) service.MetricsExporterCounterCtor {
+	return func(labelValues ...string) service.MetricsExporterCounter {
+		return testCounter{e: e, key: testMetricKey(name, labelKeys, labelValues)}
+	}
+}
+
+func (e *testMetricsExporter) NewTimerCtor(name string, labelKeys ...string) service.MetricsExporterTimerCtor {
+	return func(labelValues ...string) service.MetricsExporterTimer {
+		return testTimer{e: e, key: testMetricKey(name, labelKeys, labelValues)}
+	}
+}
+
+func (e *testMetricsExporter) NewGaugeCtor(name string, labelKeys ...string) service.MetricsExporterGaugeCtor {
+	return func(labelValues ...string) service.MetricsExporterGauge {
+		return testGauge{e: e, key: testMetricKey(name, labelKeys, labelValues)}
+	}
+}
+
+func (*testMetricsExporter) Close(context.Context) error { return nil }
+
+func (e *testMetricsExporter) counter(key string) int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.counters[key]
+}
+
+func (e *testMetricsExporter) gauge(key string) (int64, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	v, ok := e.gauges[key]
+	return v, ok
+}
+
+func (e *testMetricsExporter) timing(key string) []int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.timings[key]
+}
+
+// newTestMetricsResources returns resources which record their metrics with the returned exporter.
+func newTestMetricsResources(t *testing.T) (*service.Resources, *testMetricsExporter) {
+	t.Helper()
+
+	exporter := &testMetricsExporter{counters: map[string]int64{}, gauges: map[string]int64{}, timings: map[string][]int64{}}
+	var res *service.Resources
+
+	env := service.NewEnvironment()
+	require.NoError(t, env.RegisterMetricsExporter("test_metrics", service.NewConfigSpec(),
+		func(*service.ParsedConfig, *service.Logger) (service.MetricsExporter, error) {
+			return exporter, nil
+		}))
+	require.NoError(t, env.RegisterCache("test_resources", service.NewConfigSpec(),
+		func(_ *service.ParsedConfig, mgr *service.Resources) (service.Cache, error) {
+			res = mgr
+			return nil, nil
+		}))
+
+	builder := env.NewStreamBuilder()
+	require.NoError(t, builder.SetLoggerYAML(`level: none`))
+	require.NoError(t, builder.SetMetricsYAML(`test_metrics: {}`))
+	require.NoError(t, builder.AddCacheYAML(`
+label: foo
+test_resources: {}
+`))
+	_, err := builder.AddProducerFunc()
+	require.NoError(t, err)
+	require.NoError(t, builder.AddOutputYAML(`drop: {}`))
+	_, err = builder.Build()
+	require.NoError(t, err)
+	require.NotNil(t, res)
+	return res, exporter
+}
+
+func TestRedpandaMigratorOutputDropsExcludedTopics(t *testing.T) {
+	res := service.MockResources()
+	excluded, err := newTopicMatcher([]string{"foo-dlq"}, false)
+	require.NoError(t, err)
+	res.SetGeneric(excludedTopicsKey("input"), excluded)
+
+	// The broker is unreachable, so any attempt to create a topic fails the write.
+	client, err := kgo.NewClient(kgo.SeedBrokers("localhost:1"))
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+	require.NoError(t, kafka.FranzSharedClientSet("input", t, &kafka.FranzSharedClientInfo{Client: client}, res))
+
+	w := &redpandaMigratorWriter{
+		inputResource: "input",
+		topicPrefix:   "dest.",
+		mgr:           res,
+		topicCreateBackoff: &backoff.ExponentialBackOff{
+			InitialInterval: time.Millisecond,
+			MaxInterval:     time.Millisecond,
+			Multiplier:      1,
+			Clock:           backoff.SystemClock,
+		},
+		adminOps: newAdminOpLimiter(1, res),
+	}
+	w.runOnce.Do(func() {})
+	w.topicCache.Store("foo", true)
+	w.timestampTypes.Store("foo", timestampTypeCreateTime)
+	w.recordSizeLimits.Store("dest.foo", cachedRecordSizeLimit{})
+
+	batch := service.MessageBatch{service.NewMessage([]byte("a")), service.NewMessage([]byte("b"))}
+	records := []*kgo.Record{
+		{Topic: "foo-dlq", Value: []byte("a")},
+		{Topic: "foo", Value: []byte("b")},
+	}
+
+	ctx, done := context.WithTimeout(context.Background(), time.Second)
+	defer done()
+	require.NoError(t, w.onWrite(ctx, client, batch, records))
+
+	// The record of the excluded topic isn't produced and its topic isn't created.
+	assert.Nil(t, records[0])
+	_, ok := w.topicCache.Load("foo-dlq")
+	assert.False(t, ok)
+
+	require.NotNil(t, records[1])
+	assert.Equal(t, "dest.foo", records[1].Topic)
+
+	// The topic hook looks up the destination topic by its source name, which exists already.
+	require.NoError(t, w.onTopic(ctx, client, "dest.foo", batch, []*kgo.Record{nil, records[1]}))
+
+	// Topics which are missing are created before their records are produced.
+	err = w.onTopic(ctx, client, "dest.bar", batch, []*kgo.Record{{Topic: "dest.bar", Value: []byte("a")}, nil})
+	require.Error(t, err)
+	_, ok = w.topicCache.Load("bar")
+	assert.False(t, ok)
+}
+
+func TestProduceCompressionMetrics(t *testing.T) {
+	res, exporter := newTestMetricsResources(t)
+	m := &produceCompressionMetrics{
+		uncompressedBytes: res.Metrics().NewCounter("redpanda_migrator_produced_uncompressed_bytes", "topic"),
+		compressedBytes:   res.Metrics().NewCounter("redpanda_migrator_produced_compressed_bytes", "topic"),
+	}
+
+	broker := kgo.BrokerMetadata{NodeID: 1, Host: "localhost", Port: 9092}
+	m.OnProduceBatchWritten(broker, "foo", 0, kgo.ProduceBatchMetrics{NumRecords: 10, UncompressedBytes: 1000, CompressedBytes: 200, CompressionType: 4})
+	m.OnProduceBatchWritten(broker, "foo", 1, kgo.ProduceBatchMetrics{NumRecords: 5, UncompressedBytes: 500, CompressedBytes: 100, CompressionType: 4})
+	// Batches which aren't compressed have the same size before and after compression.
+	m.OnProduceBatchWritten(broker, "bar", 0, kgo.ProduceBatchMetrics{NumRecords: 1, UncompressedBytes: 64, CompressedBytes: 64})
+
+	assert.Equal(t, int64(1500), exporter.counter("redpanda_migrator_produced_uncompressed_bytes,foo"))
+	assert.Equal(t, int64(300), exporter.counter("redpanda_migrator_produced_compressed_bytes,foo"))
+	assert.Equal(t, int64(64), exporter.counter("redpanda_migrator_produced_uncompressed_bytes,bar"))
+	assert.Equal(t, int64(64), exporter.counter("redpanda_migrator_produced_compressed_bytes,bar"))
+}
+
+func TestRedpandaMigratorOutputTransactionLinting(t *testing.T) {
+	configTests := []struct {
+		name        string
+		config      string
+		errContains string
+	}{
+		{
+			name: "transaction",
+			config: `
+redpanda_migrator:
+  seed_brokers: [ localhost:9092 ]
+  topic: foo
+  transaction: true
+`,
+		},
+		{
+			name: "transaction without idempotent writes",
+			config: `
+redpanda_migrator:
+  seed_brokers: [ localhost:9092 ]
+  topic: foo
+  transaction: true
+  idempotent_write: false
+`,
+			errContains: "idempotent_write must be enabled when transaction is enabled",
+		},
+		{
+			name: "no transaction without idempotent writes",
+			config: `
+redpanda_migrator:
+  seed_brokers: [ localhost:9092 ]
+  topic: foo
+  idempotent_write: false
+`,
+		},
+		{
+			name: "transaction with manual partitioner",
+			config: `
+redpanda_migrator:
+  seed_brokers: [ localhost:9092 ]
+  topic: foo
+  transaction: true
+  partitioner: manual
+`,
+			errContains: "a partition must be specified when the partitioner is set to manual",
+		},
+	}
+
+	env := service.NewEnvironment()
+	for _, test := range configTests {
+		t.Run(test.name, func(t *testing.T) {
+			strm := env.NewStreamBuilder()
+			err := strm.AddOutputYAML(test.config)
+			if test.errContains == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.errContains)
+			}
+		})
+	}
+}
+
+func TestRedpandaMigratorOutputRequiredBrokerAPIVersions(t *testing.T) {
+	names := func(apis []brokerAPIVersion) (res []string) {
+		for _, api := range apis {
+			res = append(res, api.name)
+		}
+		return
+	}
+
+	w := redpandaMigratorWriter{}
+	assert.Equal(t, []string{"CreateTopics", "CreateACLs", "DescribeConfigs"}, names(w.requiredBrokerAPIVersions()))
+
+	w.idempotentWrite = true
+	assert.Equal(t, []string{"CreateTopics", "CreateACLs", "DescribeConfigs", "InitProducerID"}, names(w.requiredBrokerAPIVersions()))
+
+	w.transactional = true
+	assert.Equal(t, []string{"CreateTopics", "CreateACLs", "DescribeConfigs", "InitProducerID", "AddPartitionsToTxn", "EndTxn"}, names(w.requiredBrokerAPIVersions()))
+
+	errs := checkBrokerAPIVersions(2, func(key int16) (int16, bool) {
+		return 5, key != kmsg.EndTxn.Int16()
+	}, w.requiredBrokerAPIVersions())
+	require.Len(t, errs, 1)
+	assert.EqualError(t, errs[0], "broker 2 does not support EndTxn requests")
+}
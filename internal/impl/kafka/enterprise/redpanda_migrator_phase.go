@@ -0,0 +1,269 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/kafka"
+)
+
+const (
+	migrationPhaseMetaKey  = "migration_phase"
+	migrationPhaseSnapshot = "snapshot"
+	migrationPhaseLive     = "live"
+)
+
+// consumedPartitions checks whether a partition is consumed by a redpanda_migrator input.
+type consumedPartitions struct {
+	details  *kafka.FranzConsumerDetails
+	topics   *topicMatcher
+	excluded *topicMatcher
+}
+
+func newConsumedPartitions(details *kafka.FranzConsumerDetails, excluded *topicMatcher) (*consumedPartitions, error) {
+	topics, err := newTopicMatcher(details.Topics, details.RegexPattern)
+	if err != nil {
+		return nil, err
+	}
+	return &consumedPartitions{details: details, topics: topics, excluded: excluded}, nil
+}
+
+// listedTopics returns the topics whose offsets are listed, which are all topics when they're regular expressions.
+func (c *consumedPartitions) listedTopics() []string {
+	if c.details.RegexPattern {
+		return nil
+	}
+	topics := slices.Clone(c.details.Topics)
+	for topic := range c.details.TopicPartitions {
+		if !slices.Contains(topics, topic) {
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
+func (c *consumedPartitions) consumes(topic string, partition int32) bool {
+	if c.excluded.matches(topic) {
+		return false
+	}
+	if partitions, ok := c.details.TopicPartitions[topic]; ok {
+		_, ok = partitions[partition]
+		return ok
+	}
+	return c.topics.matches(topic)
+}
+
+// consumesTopic returns true if any partition of topic is consumed.
+func (c *consumedPartitions) consumesTopic(topic string) bool {
+	if c.excluded.matches(topic) {
+		return false
+	}
+	if _, ok := c.details.TopicPartitions[topic]; ok {
+		return true
+	}
+	return c.topics.matches(topic)
+}
+
+// startOffset returns the offset from which the input starts consuming a partition when it doesn't have a committed
+// offset, which is -1 for the end of the partition and -2 for its start.
+func (c *consumedPartitions) startOffset(topic string, partition int32) int64 {
+	if offset, ok := c.details.TopicPartitions[topic][partition]; ok {
+		return offset.EpochOffset().Offset
+	}
+	return c.details.InitialOffset.EpochOffset().Offset
+}
+
+// fetchSnapshotWatermarks returns the high watermarks of the consumed partitions which still have records below them
+// that the input will consume, which are the records of the snapshot. With lastStable the last stable offsets are
+// returned instead, which are the watermarks of the records consumed with the read_committed isolation level.
+// Partitions which are consumed from their end or whose consumer group already committed their watermark have no
+// snapshot and are left out.
+func fetchSnapshotWatermarks(ctx context.Context, client *kafka.FranzSharedClientInfo, consumed *consumedPartitions, consumerGroup string, lastStable bool) (map[string]map[int32]int64, error) {
+	adm := kadm.NewClient(client.Client)
+	topics := consumed.listedTopics()
+	startOffsets, err := adm.ListStartOffsets(ctx, topics...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list start offsets: %s", err)
+	}
+	topicPartitions := make(map[string][]int32, len(topics))
+	for _, topic := range topics {
+		topicPartitions[topic] = nil
+	}
+	// Partitions whose end offset can't be listed are left out like the ones without a snapshot.
+	listOffsets := client.EndOffsets
+	if lastStable {
+		listOffsets = client.LastStableOffsets
+	}
+	endOffsets, err := listOffsets(ctx, topicPartitions)
+	var partialErr *kafka.PartitionOffsetsError
+	if err != nil && !errors.As(err, &partialErr) {
+		return nil, fmt.Errorf("failed to list end offsets: %s", err)
+	}
+	var committed kadm.OffsetResponses
+	if consumerGroup != "" {
+		if committed, err = adm.FetchOffsets(ctx, consumerGroup); err != nil {
+			return nil, fmt.Errorf("failed to fetch the offsets of consumer group %q: %s", consumerGroup, err)
+		}
+	}
+
+	watermarks := map[string]map[int32]int64{}
+	for topic, offsets := range endOffsets {
+		for partition, end := range offsets {
+			if !consumed.consumes(topic, partition) {
+				continue
+			}
+
+			var from int64
+			if c, ok := committed.Lookup(topic, partition); ok && c.Err == nil && c.At >= 0 {
+				from = c.At
+			} else if start := consumed.startOffset(topic, partition); start == -1 {
+				from = end
+			} else if start >= 0 {
+				from = start
+			}
+			if s, ok := startOffsets.Lookup(topic, partition); ok && s.Err == nil {
+				from = max(from, s.Offset)
+			}
+			if from >= end {
+				continue
+			}
+
+			partitions, exists := watermarks[topic]
+			if !exists {
+				partitions = map[int32]int64{}
+				watermarks[topic] = partitions
+			}
+			partitions[partition] = end
+		}
+	}
+	return watermarks, nil
+}
+
+// migrationPhases tracks whether the records consumed from each partition belong to the snapshot, which are the records
+// below the high watermarks captured when the input starts, or were produced afterwards and are live.
+type migrationPhases struct {
+	mu sync.Mutex
+	// The high watermarks of the partitions which are still in the snapshot phase, which are removed once their last
+	// snapshot record is consumed. Partitions which are not listed are live.
+	snapshot map[string]map[int32]int64
+	captured bool
+
+	remaining *service.MetricGauge
+	log       *service.Logger
+}
+
+func newMigrationPhases(mgr *service.Resources) *migrationPhases {
+	return &migrationPhases{
+		remaining: mgr.Metrics().NewGauge("redpanda_migrator_snapshot_partitions_remaining"),
+		log:       mgr.Logger(),
+	}
+}
+
+// captureSnapshotWatermarks fetches the high watermarks of the snapshot of the consumed partitions with a client
+// created from clientOpts.
+func captureSnapshotWatermarks(ctx context.Context, clientOpts []kgo.Opt, consumed *consumedPartitions, consumerGroup string) (map[string]map[int32]int64, error) {
+	client, err := kgo.NewClient(clientOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka client: %s", err)
+	}
+	defer client.Close()
+
+	watermarks, err := fetchSnapshotWatermarks(ctx, &kafka.FranzSharedClientInfo{Client: client}, consumed, consumerGroup, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture snapshot watermarks: %s", err)
+	}
+	return watermarks, nil
+}
+
+// capture fetches the snapshot watermarks with a client created from clientOpts, unless they were already captured.
+// They're only captured once, so that reconnecting doesn't extend the snapshot.
+func (p *migrationPhases) capture(ctx context.Context, clientOpts []kgo.Opt, consumed *consumedPartitions, consumerGroup string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.captured {
+		return nil
+	}
+
+	watermarks, err := captureSnapshotWatermarks(ctx, clientOpts, consumed, consumerGroup)
+	if err != nil {
+		return err
+	}
+	p.startLocked(watermarks)
+	return nil
+}
+
+func (p *migrationPhases) startLocked(watermarks map[string]map[int32]int64) {
+	p.snapshot = watermarks
+	p.captured = true
+
+	remaining := p.remainingLocked()
+	p.remaining.Set(int64(remaining))
+	p.log.Infof("Captured the snapshot watermarks of %d partitions", remaining)
+}
+
+func (p *migrationPhases) remainingLocked() int {
+	var remaining int
+	for _, partitions := range p.snapshot {
+		remaining += len(partitions)
+	}
+	return remaining
+}
+
+// mark sets the migration phase metadata of each message of a batch and completes the snapshot of the partitions whose
+// last snapshot record was consumed.
+func (p *migrationPhases) mark(batch service.MessageBatch) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, msg := range batch {
+		phase := migrationPhaseLive
+
+		topic, _ := msg.MetaGet("kafka_topic")
+		pv, _ := msg.MetaGetMut("kafka_partition")
+		ov, _ := msg.MetaGetMut("kafka_offset")
+		partition, okP := pv.(int)
+		offset, okO := ov.(int)
+		if watermark, ok := p.snapshot[topic][int32(partition)]; ok && okP && okO {
+			if int64(offset) < watermark {
+				phase = migrationPhaseSnapshot
+			}
+			// Records can be missing at the end of the snapshot, for example when they are transaction markers, so a
+			// live record also completes it.
+			if int64(offset) >= watermark-1 {
+				p.completeLocked(topic, int32(partition), watermark)
+			}
+		}
+
+		msg.MetaSetMut(migrationPhaseMetaKey, phase)
+	}
+}
+
+func (p *migrationPhases) completeLocked(topic string, partition int32, watermark int64) {
+	delete(p.snapshot[topic], partition)
+	if len(p.snapshot[topic]) == 0 {
+		delete(p.snapshot, topic)
+	}
+
+	remaining := p.remainingLocked()
+	p.remaining.Set(int64(remaining))
+	p.log.Infof("Partition %d of topic %q completed its snapshot up to offset %d, its following records are live", partition, topic, watermark)
+	if remaining == 0 {
+		p.log.Infof("All partitions completed their snapshot")
+	}
+}
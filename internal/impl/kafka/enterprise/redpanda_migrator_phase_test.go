@@ -0,0 +1,121 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/kafka"
+)
+
+func TestConsumedPartitions(t *testing.T) {
+	excluded, err := newTopicMatcher([]string{"foo-dlq"}, false)
+	require.NoError(t, err)
+
+	consumed, err := newConsumedPartitions(&kafka.FranzConsumerDetails{
+		Topics: []string{"foo"},
+		TopicPartitions: map[string]map[int32]kgo.Offset{
+			"bar": {1: kgo.NewOffset().At(10)},
+		},
+		InitialOffset: kgo.NewOffset().AtStart(),
+	}, excluded)
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{"foo", "bar"}, consumed.listedTopics())
+	assert.True(t, consumed.consumes("foo", 3))
+	assert.True(t, consumed.consumes("bar", 1))
+	assert.False(t, consumed.consumes("bar", 0))
+	assert.False(t, consumed.consumes("baz", 0))
+	assert.Equal(t, int64(-2), consumed.startOffset("foo", 3))
+	assert.Equal(t, int64(10), consumed.startOffset("bar", 1))
+
+	consumed, err = newConsumedPartitions(&kafka.FranzConsumerDetails{
+		Topics:        []string{"foo.*"},
+		RegexPattern:  true,
+		InitialOffset: kgo.NewOffset().AtEnd(),
+	}, excluded)
+	require.NoError(t, err)
+
+	assert.Nil(t, consumed.listedTopics())
+	assert.True(t, consumed.consumes("foo-events", 0))
+	assert.False(t, consumed.consumes("foo-dlq", 0))
+	assert.Equal(t, int64(-1), consumed.startOffset("foo-events", 0))
+}
+
+func TestMigrationPhasesMark(t *testing.T) {
+	newMsg := func(topic string, partition, offset int) *service.Message {
+		msg := service.NewMessage([]byte("foo"))
+		msg.MetaSetMut("kafka_topic", topic)
+		msg.MetaSetMut("kafka_partition", partition)
+		msg.MetaSetMut("kafka_offset", offset)
+		return msg
+	}
+	phaseOf := func(msg *service.Message) string {
+		phase, _ := msg.MetaGet(migrationPhaseMetaKey)
+		return phase
+	}
+
+	p := newMigrationPhases(service.MockResources())
+	p.startLocked(map[string]map[int32]int64{
+		"foo": {0: 3, 1: 5},
+		"bar": {0: 2},
+	})
+	assert.Equal(t, 3, p.remainingLocked())
+
+	batch := service.MessageBatch{
+		newMsg("foo", 0, 1),
+		newMsg("foo", 0, 2),
+		newMsg("foo", 0, 3),
+		newMsg("foo", 1, 3),
+		// Partitions without a captured watermark are live.
+		newMsg("foo", 2, 0),
+		newMsg("baz", 0, 0),
+	}
+	p.mark(batch)
+
+	assert.Equal(t, []string{
+		migrationPhaseSnapshot,
+		migrationPhaseSnapshot,
+		migrationPhaseLive,
+		migrationPhaseSnapshot,
+		migrationPhaseLive,
+		migrationPhaseLive,
+	}, []string{phaseOf(batch[0]), phaseOf(batch[1]), phaseOf(batch[2]), phaseOf(batch[3]), phaseOf(batch[4]), phaseOf(batch[5])})
+	assert.Equal(t, 2, p.remainingLocked())
+
+	// A live record completes the snapshot when its last records are missing.
+	batch = service.MessageBatch{newMsg("foo", 1, 6), newMsg("bar", 0, 1)}
+	p.mark(batch)
+	assert.Equal(t, migrationPhaseLive, phaseOf(batch[0]))
+	assert.Equal(t, migrationPhaseSnapshot, phaseOf(batch[1]))
+	assert.Equal(t, 0, p.remainingLocked())
+
+	// Records consumed again after a rebalance are live once the snapshot is complete.
+	batch = service.MessageBatch{newMsg("bar", 0, 0)}
+	p.mark(batch)
+	assert.Equal(t, migrationPhaseLive, phaseOf(batch[0]))
+}
+
+func TestRedpandaMigratorInputMarkMigrationPhase(t *testing.T) {
+	conf, err := redpandaMigratorInputConfig().ParseYAML(`
+seed_brokers: [ localhost:9092 ]
+topics: [ foo ]
+consumer_group: migrator
+`, nil)
+	require.NoError(t, err)
+
+	markPhase, err := conf.FieldBool(rmiFieldMarkMigrationPhase)
+	require.NoError(t, err)
+	assert.False(t, markPhase, "migration phases are not marked by default")
+}
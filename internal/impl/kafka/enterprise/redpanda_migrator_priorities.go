@@ -0,0 +1,320 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/kafka"
+)
+
+const rmiFieldTopicPriorities = "topic_priorities"
+
+func topicPrioritiesField() *service.ConfigField {
+	return service.NewStringListField(rmiFieldTopicPriorities).
+		Description("An ordered list of topic tiers, from the highest priority to the lowest. The topics of a tier are only consumed once all the partitions of the higher tiers which are consumed by the input completed their snapshot, while topics which don't match any tier are consumed last. When `regexp_topics` is `true` they are interpreted as regular expression patterns. Multiple comma separated topics can be listed in a single element, which places them in the same tier.").
+		Example([]string{"orders,payments", "inventory"}).
+		Example([]string{"^orders-.*", "^audit-.*"}).
+		Default([]string{}).
+		Advanced()
+}
+
+// topicTiersFromParsed returns a matcher for each tier listed in the topic_priorities field or nil if none are listed.
+func topicTiersFromParsed(conf *service.ParsedConfig) ([]*topicMatcher, error) {
+	tierList, err := conf.FieldStringList(rmiFieldTopicPriorities)
+	if err != nil {
+		return nil, err
+	}
+	if len(tierList) == 0 {
+		return nil, nil
+	}
+
+	regexpTopics, err := conf.FieldBool(rmoiFieldRegexpTopics)
+	if err != nil {
+		return nil, err
+	}
+
+	tiers := make([]*topicMatcher, 0, len(tierList))
+	for _, tier := range tierList {
+		topics, _, err := kafka.ParseTopics([]string{tier}, -1, false)
+		if err != nil {
+			return nil, err
+		}
+		m, err := newTopicMatcher(topics, regexpTopics)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", rmiFieldTopicPriorities, err)
+		}
+		tiers = append(tiers, m)
+	}
+	return tiers, nil
+}
+
+// topicPriorities holds back fetching the topics of lower priority tiers until all the partitions of the higher tiers
+// which are consumed by the input completed their snapshot. The tier of the topics which don't match any of the
+// configured tiers follows the last one, so they're consumed last.
+//
+// A partition completes its snapshot once its fetch position reaches its snapshot watermark, which is its last stable
+// offset with the read_committed isolation level. The fetch position includes the transaction markers and the aborted
+// records, which are never consumed, so the input fetches the transaction markers.
+type topicPriorities struct {
+	tiers         []*topicMatcher
+	excluded      *topicMatcher
+	consumed      *consumedPartitions
+	consumerGroup string
+	readCommitted bool
+	ctrl          *kafka.FranzFetchControl
+
+	mu sync.Mutex
+	// The tier whose topics are consumed along with the topics of the higher tiers.
+	active   int
+	captured bool
+	// The snapshot watermarks of the partitions which didn't complete their snapshot yet.
+	snapshot map[string]map[int32]int64
+	// The fetch positions of the partitions which were fetched before the snapshot watermarks were captured.
+	positions map[string]map[int32]int64
+	// The partitions which are assigned to the consumer group member, which is nil when the input doesn't consume with
+	// a consumer group, in which case all partitions in the snapshot are consumed by it.
+	assigned map[string]map[int32]struct{}
+	// Whether partitions were assigned to the consumer group member, which may happen before the watermarks are
+	// captured.
+	joined bool
+	// The tier of each topic which is known to the input, the topics of the tiers below the active one are held.
+	topics map[string]int
+
+	activeGauge *service.MetricGauge
+	log         *service.Logger
+}
+
+func newTopicPriorities(
+	tiers []*topicMatcher,
+	excluded *topicMatcher,
+	consumed *consumedPartitions,
+	consumerGroup string,
+	readCommitted bool,
+	ctrl *kafka.FranzFetchControl,
+	mgr *service.Resources,
+) *topicPriorities {
+	p := &topicPriorities{
+		tiers:         tiers,
+		excluded:      excluded,
+		consumed:      consumed,
+		consumerGroup: consumerGroup,
+		readCommitted: readCommitted,
+		ctrl:          ctrl,
+		positions:     map[string]map[int32]int64{},
+		topics:        map[string]int{},
+		activeGauge:   mgr.Metrics().NewGauge("redpanda_migrator_active_topic_tier"),
+		log:           mgr.Logger(),
+	}
+	if consumerGroup != "" {
+		p.assigned = map[string]map[int32]struct{}{}
+	}
+	return p
+}
+
+// tierOf returns the index of the first tier which matches the topic, or the number of tiers when none do.
+func (p *topicPriorities) tierOf(topic string) int {
+	for i, tier := range p.tiers {
+		if tier.matches(topic) {
+			return i
+		}
+	}
+	return len(p.tiers)
+}
+
+// hold holds the listed topics of the tiers below the first one before the input starts fetching them, unless the
+// snapshot watermarks were already captured.
+func (p *topicPriorities) hold() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.captured {
+		p.observeLocked(p.consumed.listedTopics())
+	}
+}
+
+// capture fetches the snapshot watermarks with the client of the input, unless they were already captured. They're
+// only captured once, so that reconnecting doesn't extend the snapshot.
+func (p *topicPriorities) capture(ctx context.Context, client *kgo.Client) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.captured {
+		return nil
+	}
+
+	watermarks, err := fetchSnapshotWatermarks(ctx, &kafka.FranzSharedClientInfo{Client: client}, p.consumed, p.consumerGroup, p.readCommitted)
+	if err != nil {
+		return fmt.Errorf("failed to capture snapshot watermarks: %s", err)
+	}
+	p.startLocked(watermarks)
+	return nil
+}
+
+func (p *topicPriorities) startLocked(watermarks map[string]map[int32]int64) {
+	p.snapshot = watermarks
+	p.captured = true
+	p.activeGauge.Set(0)
+
+	// The partitions which were fetched before the watermarks were captured may have completed their snapshot already.
+	for topic, positions := range p.positions {
+		for partition, position := range positions {
+			p.completeLocked(topic, partition, position)
+		}
+	}
+	p.positions = nil
+
+	topics := make([]string, 0, len(watermarks))
+	for topic := range watermarks {
+		topics = append(topics, topic)
+	}
+	p.observeLocked(topics)
+	// The partitions consumed by a consumer group member are only known once they're assigned.
+	if p.assigned == nil || p.joined {
+		p.advanceLocked()
+	}
+}
+
+// observeLocked records the tiers of the topics which weren't known yet and holds them when their tier isn't active.
+func (p *topicPriorities) observeLocked(topics []string) {
+	var hold []string
+	for _, topic := range topics {
+		if _, exists := p.topics[topic]; exists || p.excluded.matches(topic) {
+			continue
+		}
+		tier := p.tierOf(topic)
+		p.topics[topic] = tier
+		if tier > p.active {
+			hold = append(hold, topic)
+		}
+	}
+	if len(hold) > 0 {
+		p.log.Debugf("Holding back topics %v until the topics of higher priority tiers completed their snapshot", hold)
+		p.ctrl.HoldTopics(hold...)
+	}
+}
+
+// assign records the partitions which were assigned to the consumer group member, whose topics are held when they
+// were created after the input started and their tier isn't active yet.
+func (p *topicPriorities) assign(topicPartitions map[string][]int32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	topics := make([]string, 0, len(topicPartitions))
+	for topic, partitions := range topicPartitions {
+		topics = append(topics, topic)
+		if p.assigned[topic] == nil {
+			p.assigned[topic] = map[int32]struct{}{}
+		}
+		for _, partition := range partitions {
+			p.assigned[topic][partition] = struct{}{}
+		}
+	}
+	p.joined = true
+	p.observeLocked(topics)
+	if p.captured {
+		p.advanceLocked()
+	}
+}
+
+// remove stops waiting for partitions which were revoked from the consumer group member to complete their snapshot.
+// The tier isn't advanced until the next assignment, which follows the revocation.
+func (p *topicPriorities) remove(topicPartitions map[string][]int32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for topic, partitions := range topicPartitions {
+		for _, partition := range partitions {
+			delete(p.assigned[topic], partition)
+		}
+		if len(p.assigned[topic]) == 0 {
+			delete(p.assigned, topic)
+		}
+	}
+}
+
+// fetched completes the snapshot of a partition once its fetch position reaches its snapshot watermark and activates
+// the following tiers once all partitions of the active one completed their snapshot.
+func (p *topicPriorities) fetched(topic string, partition int32, position int64) {
+	if position < 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.captured {
+		if p.positions[topic] == nil {
+			p.positions[topic] = map[int32]int64{}
+		}
+		p.positions[topic][partition] = max(p.positions[topic][partition], position)
+		return
+	}
+	if p.completeLocked(topic, partition, position) {
+		p.advanceLocked()
+	}
+}
+
+// completeLocked completes the snapshot of a partition when the position reaches its snapshot watermark.
+func (p *topicPriorities) completeLocked(topic string, partition int32, position int64) bool {
+	watermark, ok := p.snapshot[topic][partition]
+	if !ok || position < watermark {
+		return false
+	}
+	delete(p.snapshot[topic], partition)
+	if len(p.snapshot[topic]) == 0 {
+		delete(p.snapshot, topic)
+	}
+	return true
+}
+
+// advanceLocked activates the following tiers for as long as the partitions of the active tier which are consumed by
+// the input completed their snapshot, and releases their topics.
+func (p *topicPriorities) advanceLocked() {
+	from := p.active
+	for p.active < len(p.tiers) && p.tierCompletedLocked(p.active) {
+		p.active++
+		p.log.Infof("Topic tier %d completed its snapshot, consuming the topics of tier %d", p.active-1, p.active)
+	}
+	if p.active == from {
+		return
+	}
+	p.activeGauge.Set(int64(p.active))
+
+	var release []string
+	for topic, tier := range p.topics {
+		if tier > from && tier <= p.active {
+			release = append(release, topic)
+		}
+	}
+	if len(release) > 0 {
+		p.ctrl.ReleaseTopics(release...)
+	}
+}
+
+func (p *topicPriorities) tierCompletedLocked(tier int) bool {
+	for topic, partitions := range p.snapshot {
+		if p.tierOf(topic) != tier {
+			continue
+		}
+		if p.assigned == nil {
+			return false
+		}
+		for partition := range partitions {
+			if _, ok := p.assigned[topic][partition]; ok {
+				return false
+			}
+		}
+	}
+	return true
+}
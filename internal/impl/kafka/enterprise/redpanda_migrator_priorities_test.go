@@ -0,0 +1,176 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/kafka"
+)
+
+func newTestTopicPriorities(t *testing.T, yaml string, consumerGroup bool) (*topicPriorities, *kafka.FranzFetchControl) {
+	t.Helper()
+	conf, err := redpandaMigratorInputConfig().ParseYAML(yaml, nil)
+	require.NoError(t, err)
+	tiers, err := topicTiersFromParsed(conf)
+	require.NoError(t, err)
+	excluded, err := excludedTopicsFromParsed(conf)
+	require.NoError(t, err)
+	details, err := kafka.FranzConsumerDetailsFromConfig(conf)
+	require.NoError(t, err)
+	consumed, err := newConsumedPartitions(details, excluded)
+	require.NoError(t, err)
+
+	var group string
+	if consumerGroup {
+		group = "migrator"
+	}
+	mgr := service.MockResources()
+	ctrl := kafka.NewFranzFetchControl(mgr.Metrics())
+	return newTopicPriorities(tiers, excluded, consumed, group, true, ctrl, mgr), ctrl
+}
+
+func TestTopicPriorities(t *testing.T) {
+	p, ctrl := newTestTopicPriorities(t, `
+seed_brokers: [ localhost:9092 ]
+topics: [ orders, payments, inventory, audit, empty ]
+topic_priorities: [ "orders,payments", empty, inventory ]
+`, false)
+
+	client, err := kgo.NewClient(kgo.SeedBrokers("localhost:0"))
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+	ctrl.SetClient(client)
+
+	// The topics of the following tiers are held before they're fetched.
+	p.hold()
+	assert.ElementsMatch(t, []string{"empty", "inventory", "audit"}, client.PauseFetchTopics())
+
+	// Partitions which are fetched before the watermarks are captured can complete their snapshot.
+	p.fetched("payments", 0, 2)
+	p.startLocked(map[string]map[int32]int64{
+		"orders":    {0: 3, 1: 5},
+		"payments":  {0: 2},
+		"inventory": {0: 10},
+		"audit":     {0: 10},
+	})
+	assert.Equal(t, 0, p.active)
+	assert.ElementsMatch(t, []string{"empty", "inventory", "audit"}, client.PauseFetchTopics())
+
+	// The tier is only completed once the fetch positions of all its partitions reached their watermark.
+	p.fetched("orders", 0, 3)
+	p.fetched("orders", 1, -1)
+	assert.Equal(t, 0, p.active)
+	assert.True(t, ctrl.IsPaused("inventory", 0))
+
+	// The fetch position includes transaction markers, which aren't consumed, and tiers without a snapshot are
+	// skipped.
+	p.fetched("orders", 1, 5)
+	assert.Equal(t, 2, p.active)
+	assert.ElementsMatch(t, []string{"audit"}, client.PauseFetchTopics())
+
+	// Topics which don't match any tier are fetched once all tiers completed.
+	p.fetched("inventory", 0, 13)
+	assert.Equal(t, 3, p.active)
+	assert.Empty(t, client.PauseFetchTopics())
+}
+
+func TestTopicPrioritiesConsumerGroup(t *testing.T) {
+	p, ctrl := newTestTopicPriorities(t, `
+seed_brokers: [ localhost:9092 ]
+topics: [ "^orders-.*", "^audit-.*" ]
+regexp_topics: true
+consumer_group: migrator
+exclude_topics: [ "^orders-dlq$" ]
+topic_priorities: [ "^orders-.*" ]
+`, true)
+
+	p.startLocked(map[string]map[int32]int64{
+		"orders-eu": {0: 3, 1: 5},
+		"audit-eu":  {0: 10},
+	})
+	// The tier isn't advanced before the partitions of the member are assigned.
+	assert.Equal(t, 0, p.active)
+	assert.True(t, ctrl.IsPaused("audit-eu", 0))
+	assert.False(t, ctrl.IsPaused("orders-eu", 0))
+
+	// Partitions of the tier which are assigned to other members don't hold back the tier.
+	p.assign(map[string][]int32{"orders-eu": {0}, "audit-eu": {0}})
+	assert.Equal(t, 0, p.active)
+	p.fetched("orders-eu", 0, 3)
+	assert.Equal(t, 1, p.active)
+	assert.False(t, ctrl.IsPaused("audit-eu", 0))
+
+	// The partitions can be assigned before the watermarks are captured, in which case the tier is advanced once
+	// they're captured.
+	p, ctrl = newTestTopicPriorities(t, `
+seed_brokers: [ localhost:9092 ]
+topics: [ "^orders-.*", "^audit-.*" ]
+regexp_topics: true
+consumer_group: migrator
+topic_priorities: [ "^orders-.*" ]
+`, true)
+	p.hold()
+	p.assign(map[string][]int32{"orders-eu": {0}, "audit-eu": {0}})
+	assert.Equal(t, 0, p.active)
+	assert.True(t, ctrl.IsPaused("audit-eu", 0))
+	p.startLocked(map[string]map[int32]int64{"orders-eu": {1: 5}, "audit-eu": {0: 10}})
+	assert.Equal(t, 1, p.active)
+	assert.False(t, ctrl.IsPaused("audit-eu", 0))
+
+	// Topics created after the input started are placed in their tier.
+	p, ctrl = newTestTopicPriorities(t, `
+seed_brokers: [ localhost:9092 ]
+topics: [ "^orders-.*", "^audit-.*" ]
+regexp_topics: true
+consumer_group: migrator
+exclude_topics: [ "^orders-dlq$" ]
+topic_priorities: [ "^orders-.*" ]
+`, true)
+	p.startLocked(map[string]map[int32]int64{"orders-eu": {0: 3}})
+	p.assign(map[string][]int32{"orders-eu": {0}})
+	p.assign(map[string][]int32{"audit-us": {0}, "orders-us": {0}, "orders-dlq": {0}})
+	assert.True(t, ctrl.IsPaused("audit-us", 0))
+	assert.False(t, ctrl.IsPaused("orders-us", 0))
+	assert.False(t, ctrl.IsPaused("orders-dlq", 0), "excluded topics aren't held")
+
+	// Revoked partitions don't hold back the tier.
+	p.remove(map[string][]int32{"orders-eu": {0}})
+	p.assign(map[string][]int32{})
+	assert.Equal(t, 1, p.active)
+	assert.False(t, ctrl.IsPaused("audit-us", 0))
+}
+
+func TestRedpandaMigratorInputTopicPriorities(t *testing.T) {
+	conf, err := redpandaMigratorInputConfig().ParseYAML(`
+seed_brokers: [ localhost:9092 ]
+topics: [ foo ]
+consumer_group: migrator
+`, nil)
+	require.NoError(t, err)
+	tiers, err := topicTiersFromParsed(conf)
+	require.NoError(t, err)
+	assert.Nil(t, tiers, "topics aren't prioritised by default")
+
+	conf, err = redpandaMigratorInputConfig().ParseYAML(`
+seed_brokers: [ localhost:9092 ]
+topics: [ "foo.*" ]
+regexp_topics: true
+consumer_group: migrator
+topic_priorities: [ "foo(" ]
+`, nil)
+	require.NoError(t, err)
+	_, err = topicTiersFromParsed(conf)
+	require.ErrorContains(t, err, "invalid topic_priorities")
+}
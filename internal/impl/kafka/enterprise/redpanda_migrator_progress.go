@@ -0,0 +1,270 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/kafka"
+)
+
+// partitionProgress is the consume progress of a single partition towards the high watermark which was captured when
+// its first record was consumed.
+type partitionProgress struct {
+	start     int64
+	next      int64
+	watermark int64
+
+	// The exponentially weighted consume rate in records per second, which is zero until the second update.
+	rate       float64
+	lastUpdate time.Time
+}
+
+// ratio returns the share of the records between the start offset and the watermark which were consumed.
+func (p *partitionProgress) ratio() float64 {
+	if p.next >= p.watermark || p.watermark <= p.start {
+		return 1
+	}
+	return float64(p.next-p.start) / float64(p.watermark-p.start)
+}
+
+func (p *partitionProgress) remaining() int64 {
+	return max(p.watermark-p.next, 0)
+}
+
+// eta returns the estimated number of seconds until the watermark is reached, or -1 while the consume rate is unknown.
+func (p *partitionProgress) eta() float64 {
+	remaining := p.remaining()
+	if remaining == 0 {
+		return 0
+	}
+	if p.rate <= 0 {
+		return -1
+	}
+	return float64(remaining) / p.rate
+}
+
+// progressListInterval is the minimum interval between requests for the high watermark of a partition which isn't
+// tracked yet, so that partitions whose watermark can't be listed don't issue a request for every batch.
+const progressListInterval = 10 * time.Second
+
+// migrationProgress tracks how far the partitions consumed by a redpanda_migrator input are from the high watermarks
+// captured when they were first consumed and estimates when they will be reached.
+type migrationProgress struct {
+	mu         sync.Mutex
+	partitions map[string]map[int32]*partitionProgress
+	window     time.Duration
+	excluded   *topicMatcher
+	now        func() time.Time
+
+	// listEndOffsets lists the high watermarks of the given partitions.
+	listEndOffsets func(ctx context.Context, topicPartitions map[string][]int32) (map[string]map[int32]int64, error)
+	// When the watermarks of the partitions which aren't tracked yet were last requested.
+	listedAt map[string]map[int32]time.Time
+
+	ratioGauge     *service.MetricGauge
+	remainingGauge *service.MetricGauge
+	etaGauge       *service.MetricGauge
+	log            *service.Logger
+}
+
+func newMigrationProgress(window time.Duration, excluded *topicMatcher, mgr *service.Resources) *migrationProgress {
+	return &migrationProgress{
+		partitions:     map[string]map[int32]*partitionProgress{},
+		listedAt:       map[string]map[int32]time.Time{},
+		window:         window,
+		excluded:       excluded,
+		now:            time.Now,
+		ratioGauge:     mgr.Metrics().NewGauge("migrator_partition_progress_ratio", "topic", "partition"),
+		remainingGauge: mgr.Metrics().NewGauge("migrator_partition_records_remaining", "topic", "partition"),
+		etaGauge:       mgr.Metrics().NewGauge("migrator_partition_eta_seconds", "topic", "partition"),
+		log:            mgr.Logger(),
+	}
+}
+
+// useClient lists the high watermarks with the client of the input, which is replaced when the input reconnects.
+func (p *migrationProgress) useClient(client *kafka.FranzSharedClientInfo) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.listEndOffsets = client.EndOffsets
+}
+
+// update advances the progress of the partitions of the records in a batch. The watermarks of partitions which are
+// consumed for the first time are captured before, and the progress of partitions whose watermarks can't be listed is
+// only tracked once they are captured by a later batch, which requests them again after progressListInterval.
+func (p *migrationProgress) update(ctx context.Context, batch service.MessageBatch) {
+	type consumed struct {
+		count int64
+		first int64
+		next  int64
+	}
+	now := p.now()
+	byPartition := map[string]map[int32]*consumed{}
+	for _, msg := range batch {
+		topic, _ := msg.MetaGet("kafka_topic")
+		if p.excluded.matches(topic) {
+			continue
+		}
+		pv, _ := msg.MetaGetMut("kafka_partition")
+		ov, _ := msg.MetaGetMut("kafka_offset")
+		partition, okP := pv.(int)
+		offset, okO := ov.(int)
+		if !okP || !okO {
+			continue
+		}
+
+		partitions, exists := byPartition[topic]
+		if !exists {
+			partitions = map[int32]*consumed{}
+			byPartition[topic] = partitions
+		}
+		c, exists := partitions[int32(partition)]
+		if !exists {
+			c = &consumed{first: int64(offset), next: int64(offset)}
+			partitions[int32(partition)] = c
+		}
+		c.count++
+		c.first = min(c.first, int64(offset))
+		c.next = max(c.next, int64(offset)+1)
+	}
+	if len(byPartition) == 0 {
+		return
+	}
+
+	// The watermarks are listed without holding the lock, so that rebalances aren't blocked by the request.
+	p.mu.Lock()
+	newPartitions := map[string][]int32{}
+	for topic, partitions := range byPartition {
+		for partition := range partitions {
+			if _, exists := p.partitions[topic][partition]; exists {
+				continue
+			}
+			if listedAt, exists := p.listedAt[topic][partition]; exists && now.Sub(listedAt) < progressListInterval {
+				continue
+			}
+			newPartitions[topic] = append(newPartitions[topic], partition)
+			if p.listedAt[topic] == nil {
+				p.listedAt[topic] = map[int32]time.Time{}
+			}
+			p.listedAt[topic][partition] = now
+		}
+	}
+	listEndOffsets := p.listEndOffsets
+	p.mu.Unlock()
+
+	var watermarks map[string]map[int32]int64
+	if len(newPartitions) > 0 && listEndOffsets != nil {
+		var err error
+		if watermarks, err = listEndOffsets(ctx, newPartitions); err != nil {
+			p.log.Debugf("Failed to capture the high watermarks of partitions %v for tracking their progress: %s", newPartitions, err)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for topic, partitions := range byPartition {
+		for partition, c := range partitions {
+			progress, exists := p.partitions[topic][partition]
+			if !exists {
+				watermark, ok := watermarks[topic][partition]
+				if !ok {
+					continue
+				}
+				// The first record of the batch is the start offset, so it's counted as consumed below.
+				progress = &partitionProgress{
+					start:      c.first,
+					next:       c.first,
+					watermark:  watermark,
+					lastUpdate: now,
+				}
+				if p.partitions[topic] == nil {
+					p.partitions[topic] = map[int32]*partitionProgress{}
+				}
+				p.partitions[topic][partition] = progress
+				p.forgetListedLocked(topic, partition)
+			}
+			p.advanceLocked(progress, c.count, c.next, now)
+			p.reportLocked(topic, partition, progress)
+		}
+	}
+}
+
+// advanceLocked updates the consume rate of a partition with an exponentially weighted moving average, in which the
+// weight of past rates decays by a factor of e for each smoothing window that elapses.
+func (p *migrationProgress) advanceLocked(progress *partitionProgress, count, next int64, now time.Time) {
+	if elapsed := now.Sub(progress.lastUpdate); elapsed > 0 {
+		rate := float64(count) / elapsed.Seconds()
+		if progress.rate == 0 {
+			progress.rate = rate
+		} else {
+			alpha := 1 - math.Exp(-elapsed.Seconds()/p.window.Seconds())
+			progress.rate += alpha * (rate - progress.rate)
+		}
+		progress.lastUpdate = now
+	}
+	progress.next = max(progress.next, next)
+}
+
+func (p *migrationProgress) reportLocked(topic string, partition int32, progress *partitionProgress) {
+	partitionStr := strconv.Itoa(int(partition))
+	p.ratioGauge.SetFloat64(progress.ratio(), topic, partitionStr)
+	p.remainingGauge.Set(progress.remaining(), topic, partitionStr)
+	p.etaGauge.SetFloat64(progress.eta(), topic, partitionStr)
+}
+
+// remove stops tracking the progress of partitions which are no longer consumed, for example because they were revoked
+// by a rebalance, and zeroes their metrics so that they don't report stale values.
+func (p *migrationProgress) remove(topicPartitions map[string][]int32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for topic, partitions := range topicPartitions {
+		for _, partition := range partitions {
+			p.forgetListedLocked(topic, partition)
+			if _, exists := p.partitions[topic][partition]; !exists {
+				continue
+			}
+			delete(p.partitions[topic], partition)
+
+			partitionStr := strconv.Itoa(int(partition))
+			p.ratioGauge.SetFloat64(0, topic, partitionStr)
+			p.remainingGauge.Set(0, topic, partitionStr)
+			p.etaGauge.SetFloat64(0, topic, partitionStr)
+		}
+		if len(p.partitions[topic]) == 0 {
+			delete(p.partitions, topic)
+		}
+	}
+}
+
+func (p *migrationProgress) forgetListedLocked(topic string, partition int32) {
+	delete(p.listedAt[topic], partition)
+	if len(p.listedAt[topic]) == 0 {
+		delete(p.listedAt, topic)
+	}
+}
+
+// progressOf returns the progress of a partition, if it's tracked.
+func (p *migrationProgress) progressOf(topic string, partition int32) (partitionProgress, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	progress, exists := p.partitions[topic][partition]
+	if !exists {
+		return partitionProgress{}, false
+	}
+	return *progress, true
+}
@@ -0,0 +1,156 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrationProgress(t *testing.T) {
+	newMsg := func(topic string, partition, offset int) *service.Message {
+		msg := service.NewMessage([]byte("foo"))
+		msg.MetaSetMut("kafka_topic", topic)
+		msg.MetaSetMut("kafka_partition", partition)
+		msg.MetaSetMut("kafka_offset", offset)
+		return msg
+	}
+	newBatch := func(topic string, partition, from, to int) service.MessageBatch {
+		var batch service.MessageBatch
+		for offset := from; offset < to; offset++ {
+			batch = append(batch, newMsg(topic, partition, offset))
+		}
+		return batch
+	}
+
+	excluded, err := newTopicMatcher([]string{"baz"}, false)
+	require.NoError(t, err)
+
+	now := time.Unix(1000, 0)
+	p := newMigrationProgress(10*time.Second, excluded, service.MockResources())
+	p.now = func() time.Time { return now }
+
+	var listErr error
+	var listed []map[string][]int32
+	p.listEndOffsets = func(_ context.Context, topicPartitions map[string][]int32) (map[string]map[int32]int64, error) {
+		listed = append(listed, topicPartitions)
+		if listErr != nil {
+			return nil, listErr
+		}
+		return map[string]map[int32]int64{
+			"foo": {0: 1100, 1: 50},
+			"bar": {0: 10},
+			"baz": {0: 10},
+		}, nil
+	}
+
+	ctx := context.Background()
+
+	// The watermark is captured when the first record of a partition is consumed, which is its start offset.
+	p.update(ctx, newBatch("foo", 0, 100, 200))
+	progress, ok := p.progressOf("foo", 0)
+	require.True(t, ok)
+	assert.Equal(t, int64(100), progress.start)
+	assert.Equal(t, int64(1100), progress.watermark)
+	assert.InDelta(t, 0.1, progress.ratio(), 0.0001)
+	assert.Equal(t, int64(900), progress.remaining())
+	assert.Equal(t, float64(-1), progress.eta())
+
+	// The first rate is taken as is.
+	now = now.Add(10 * time.Second)
+	p.update(ctx, newBatch("foo", 0, 200, 300))
+	progress, _ = p.progressOf("foo", 0)
+	assert.InDelta(t, 10, progress.rate, 0.0001)
+	assert.InDelta(t, 0.2, progress.ratio(), 0.0001)
+	assert.Equal(t, int64(800), progress.remaining())
+	assert.InDelta(t, 80, progress.eta(), 0.0001)
+
+	// Following rates are weighted by the time elapsed relative to the smoothing window.
+	now = now.Add(10 * time.Second)
+	p.update(ctx, newBatch("foo", 0, 300, 600))
+	progress, _ = p.progressOf("foo", 0)
+	expectedRate := 10 + (1-1/math.E)*(30-10)
+	assert.InDelta(t, expectedRate, progress.rate, 0.0001)
+	assert.Equal(t, int64(500), progress.remaining())
+	assert.InDelta(t, 500/expectedRate, progress.eta(), 0.0001)
+
+	// The watermark is only listed for the partitions which are consumed for the first time.
+	assert.Equal(t, []map[string][]int32{{"foo": {0}}}, listed)
+
+	// Partitions which are consumed past their watermark report completion while live tailing continues.
+	p.update(ctx, newBatch("foo", 1, 0, 50))
+	now = now.Add(time.Second)
+	p.update(ctx, newBatch("foo", 1, 50, 60))
+	progress, ok = p.progressOf("foo", 1)
+	require.True(t, ok)
+	assert.Equal(t, float64(1), progress.ratio())
+	assert.Equal(t, int64(0), progress.remaining())
+	assert.Equal(t, float64(0), progress.eta())
+
+	// Excluded topics aren't tracked.
+	p.update(ctx, newBatch("baz", 0, 0, 5))
+	_, ok = p.progressOf("baz", 0)
+	assert.False(t, ok)
+
+	// Partitions whose watermark can't be listed are tracked once a later batch captures it, which requests it again
+	// after the list interval.
+	listErr = errors.New("nope")
+	p.update(ctx, newBatch("bar", 0, 0, 2))
+	_, ok = p.progressOf("bar", 0)
+	assert.False(t, ok)
+
+	listErr = nil
+	listed = nil
+	p.update(ctx, newBatch("bar", 0, 2, 3))
+	_, ok = p.progressOf("bar", 0)
+	assert.False(t, ok)
+	assert.Empty(t, listed)
+
+	now = now.Add(progressListInterval)
+	p.update(ctx, newBatch("bar", 0, 3, 4))
+	progress, ok = p.progressOf("bar", 0)
+	require.True(t, ok)
+	assert.Equal(t, int64(3), progress.start)
+	assert.Equal(t, int64(6), progress.remaining())
+	assert.Equal(t, []map[string][]int32{{"bar": {0}}}, listed)
+	assert.Empty(t, p.listedAt)
+
+	// Revoked partitions stop being tracked and capture their watermark again when they are assigned back.
+	p.remove(map[string][]int32{"foo": {0}, "qux": {3}})
+	_, ok = p.progressOf("foo", 0)
+	assert.False(t, ok)
+	_, ok = p.progressOf("foo", 1)
+	assert.True(t, ok)
+
+	p.update(ctx, newBatch("foo", 0, 600, 700))
+	progress, ok = p.progressOf("foo", 0)
+	require.True(t, ok)
+	assert.Equal(t, int64(600), progress.start)
+	assert.Equal(t, float64(0), progress.rate)
+}
+
+func TestRedpandaMigratorInputETASmoothingWindow(t *testing.T) {
+	conf, err := redpandaMigratorInputConfig().ParseYAML(`
+seed_brokers: [ localhost:9092 ]
+topics: [ foo ]
+consumer_group: migrator
+`, nil)
+	require.NoError(t, err)
+
+	window, err := conf.FieldDuration(rmiFieldETASmoothingWindow)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, window)
+}
@@ -0,0 +1,232 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kbin"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const (
+	rmoOnOversizedRecordFail            = "fail"
+	rmoOnOversizedRecordDrop            = "drop"
+	rmoOnOversizedRecordTruncateHeaders = "truncate_headers"
+
+	maxMessageBytesTopicConfig  = "max.message.bytes"
+	messageMaxBytesBrokerConfig = "message.max.bytes"
+
+	// recordBatchOverhead is the size of the header of a record batch, which is included in the size that the broker
+	// checks against the max message size.
+	recordBatchOverhead = 61
+
+	// recordSizeLimitRetryInterval is the time during which the max message size of a topic isn't fetched again after
+	// fetching it failed, so that a failing cluster isn't sent a request for every record.
+	recordSizeLimitRetryInterval = 30 * time.Second
+)
+
+// recordSizeLimit holds the max message sizes of a destination topic, which are 0 when unknown.
+type recordSizeLimit struct {
+	topic  int
+	broker int
+}
+
+// cachedRecordSizeLimit is the recordSizeLimit of a destination topic, or the time after which it's fetched again when
+// fetching it failed.
+type cachedRecordSizeLimit struct {
+	limit   recordSizeLimit
+	retryAt time.Time
+}
+
+// max returns the largest record size accepted by the destination topic or 0 if it's unknown.
+func (l recordSizeLimit) max() int {
+	switch {
+	case l.topic > 0 && l.broker > 0:
+		return min(l.topic, l.broker)
+	case l.topic > 0:
+		return l.topic
+	default:
+		return l.broker
+	}
+}
+
+func (l recordSizeLimit) String() string {
+	format := func(v int) string {
+		if v <= 0 {
+			return "unknown"
+		}
+		return strconv.Itoa(v)
+	}
+	return fmt.Sprintf("%s: %s, %s: %s", maxMessageBytesTopicConfig, format(l.topic), messageMaxBytesBrokerConfig, format(l.broker))
+}
+
+// recordSize returns the size of an uncompressed record batch which only contains record, which is what the broker
+// compares with the max message size. It's computed the same way as the producer does.
+func recordSize(record *kgo.Record) int {
+	l := 1 + // attributes
+		1 + // timestamp delta, which is always 0 for the first record of a batch
+		1 + // offset delta, which is always 0 for the first record of a batch
+		kbin.VarintLen(int32(len(record.Key))) + len(record.Key) +
+		kbin.VarintLen(int32(len(record.Value))) + len(record.Value) +
+		kbin.VarintLen(int32(len(record.Headers)))
+	for _, h := range record.Headers {
+		l += kbin.VarintLen(int32(len(h.Key))) + len(h.Key) +
+			kbin.VarintLen(int32(len(h.Value))) + len(h.Value)
+	}
+	return recordBatchOverhead + kbin.VarintLen(int32(l)) + l
+}
+
+// truncateHeaders removes the largest headers of record until it doesn't exceed maxSize and returns the keys of the
+// removed headers. It returns false if the record still exceeds maxSize once all its headers were removed.
+func truncateHeaders(record *kgo.Record, maxSize int) ([]string, bool) {
+	var removed []string
+	headers := slices.Clone(record.Headers)
+	for len(headers) > 0 && recordSize(record) > maxSize {
+		largest := 0
+		for i, h := range headers {
+			if len(h.Key)+len(h.Value) >= len(headers[largest].Key)+len(headers[largest].Value) {
+				largest = i
+			}
+		}
+		removed = append(removed, headers[largest].Key)
+		headers = slices.Delete(headers, largest, largest+1)
+		record.Headers = headers
+	}
+	return removed, recordSize(record) <= maxSize
+}
+
+// fetchRecordSizeLimit fetches the max message size of topic and the broker-level max message size from the cluster.
+// Failing to fetch the broker-level size isn't an error, since the topic config already defaults to it.
+func fetchRecordSizeLimit(ctx context.Context, client *kgo.Client, topic string) (recordSizeLimit, error) {
+	var limit recordSizeLimit
+
+	adm := kadm.NewClient(client)
+	topicConfigs, err := adm.DescribeTopicConfigs(ctx, topic)
+	if err != nil {
+		return limit, fmt.Errorf("failed to fetch configs for topic %q: %s", topic, err)
+	}
+	rc, err := topicConfigs.On(topic, nil)
+	if err != nil {
+		return limit, fmt.Errorf("failed to fetch configs for topic %q: %s", topic, err)
+	}
+	limit.topic = configIntValue(rc.Configs, maxMessageBytesTopicConfig)
+
+	if brokerConfigs, err := adm.DescribeBrokerConfigs(ctx); err == nil {
+		for _, rc := range brokerConfigs {
+			if rc.Err == nil {
+				limit.broker = configIntValue(rc.Configs, messageMaxBytesBrokerConfig)
+				break
+			}
+		}
+	}
+
+	return limit, nil
+}
+
+func configIntValue(configs []kadm.Config, key string) int {
+	for _, c := range configs {
+		if c.Key != key || c.Value == nil {
+			continue
+		}
+		v, err := strconv.Atoi(*c.Value)
+		if err != nil {
+			return 0
+		}
+		return v
+	}
+	return 0
+}
+
+// recordSizeLimit returns the max message size of destTopic, which is cached per topic until the output reconnects.
+// False is returned when it can't be fetched, in which case it isn't fetched again before recordSizeLimitRetryInterval
+// elapsed.
+func (w *redpandaMigratorWriter) recordSizeLimit(ctx context.Context, client *kgo.Client, destTopic string) (recordSizeLimit, bool) {
+	if v, ok := w.recordSizeLimits.Load(destTopic); ok {
+		cached := v.(cachedRecordSizeLimit)
+		if cached.retryAt.IsZero() {
+			return cached.limit, true
+		}
+		if time.Now().Before(cached.retryAt) {
+			return recordSizeLimit{}, false
+		}
+	}
+
+	limit, err := fetchRecordSizeLimit(ctx, client, destTopic)
+	if err != nil {
+		w.mgr.Logger().Warnf("Skipping record size validation for topic %q for %s: %s", destTopic, recordSizeLimitRetryInterval, err)
+		w.recordSizeLimits.Store(destTopic, cachedRecordSizeLimit{retryAt: time.Now().Add(recordSizeLimitRetryInterval)})
+		return limit, false
+	}
+	w.recordSizeLimits.Store(destTopic, cachedRecordSizeLimit{limit: limit})
+	return limit, true
+}
+
+// validateRecordSizes handles the records which exceed the max message size of their destination topic according to
+// on_oversized_record. Dropped records are replaced with nil, so that they are not produced.
+func (w *redpandaMigratorWriter) validateRecordSizes(batch service.MessageBatch, records []*kgo.Record, limitFn func(destTopic string) (recordSizeLimit, bool)) error {
+	for recordIdx, record := range records {
+		if record == nil {
+			continue
+		}
+		limit, ok := limitFn(record.Topic)
+		if !ok || limit.max() <= 0 {
+			continue
+		}
+		size := recordSize(record)
+		if size <= limit.max() {
+			continue
+		}
+
+		partition, offset := "unknown", "unknown"
+		if recordIdx < len(batch) {
+			if p, ok := batch[recordIdx].MetaGetMut("kafka_partition"); ok {
+				partition = fmt.Sprint(p)
+			}
+			if o, ok := batch[recordIdx].MetaGetMut("kafka_offset"); ok {
+				offset = fmt.Sprint(o)
+			}
+		}
+		w.oversizedRecords.Incr(1, record.Topic, w.onOversizedRecord)
+
+		switch w.onOversizedRecord {
+		case rmoOnOversizedRecordDrop:
+			w.mgr.Logger().Warnf(
+				"Dropping record at message index %d for topic %q (source partition %s, offset %s) of %d bytes which exceeds the max message size (%s)",
+				recordIdx, record.Topic, partition, offset, size, limit,
+			)
+			records[recordIdx] = nil
+		case rmoOnOversizedRecordTruncateHeaders:
+			removed, fits := truncateHeaders(record, limit.max())
+			if !fits {
+				return fmt.Errorf(
+					"record at message index %d for topic %q (source partition %s, offset %s) is %d bytes without headers, which exceeds the max message size (%s)",
+					recordIdx, record.Topic, partition, offset, recordSize(record), limit,
+				)
+			}
+			w.mgr.Logger().Warnf(
+				"Removed headers %q from record at message index %d for topic %q (source partition %s, offset %s) of %d bytes which exceeded the max message size (%s)",
+				removed, recordIdx, record.Topic, partition, offset, size, limit,
+			)
+		default:
+			return fmt.Errorf(
+				"record at message index %d for topic %q (source partition %s, offset %s) is %d bytes, which exceeds the max message size (%s)",
+				recordIdx, record.Topic, partition, offset, size, limit,
+			)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+func TestRecordSize(t *testing.T) {
+	for _, record := range []*kgo.Record{
+		{},
+		{Key: []byte("foo"), Value: []byte("bar")},
+		{Value: []byte(strings.Repeat("x", 300))},
+		{
+			Key:   []byte(strings.Repeat("k", 70)),
+			Value: []byte(strings.Repeat("v", 20000)),
+			Headers: []kgo.RecordHeader{
+				{Key: "traceparent", Value: []byte(strings.Repeat("t", 200))},
+				{Key: "empty"},
+			},
+		},
+	} {
+		rec := kmsg.Record{Key: record.Key, Value: record.Value}
+		for _, h := range record.Headers {
+			rec.Headers = append(rec.Headers, kmsg.Header{Key: h.Key, Value: h.Value})
+		}
+		// The length field prefixes the record, so it's encoded once to compute it.
+		rec.Length = int32(len(rec.AppendTo(nil)) - 1)
+		batch := kmsg.RecordBatch{NumRecords: 1, Records: rec.AppendTo(nil)}
+
+		assert.Equal(t, len(batch.AppendTo(nil)), recordSize(record))
+	}
+}
+
+func TestTruncateHeaders(t *testing.T) {
+	record := &kgo.Record{
+		Value: []byte("foo"),
+		Headers: []kgo.RecordHeader{
+			{Key: "small", Value: []byte("a")},
+			{Key: "trace", Value: []byte(strings.Repeat("t", 1000))},
+			{Key: "baggage", Value: []byte(strings.Repeat("b", 500))},
+		},
+	}
+	withoutTrace := recordSize(&kgo.Record{Value: record.Value, Headers: []kgo.RecordHeader{record.Headers[0], record.Headers[2]}})
+
+	removed, fits := truncateHeaders(record, withoutTrace)
+	assert.True(t, fits)
+	assert.Equal(t, []string{"trace"}, removed)
+	assert.Equal(t, []kgo.RecordHeader{
+		{Key: "small", Value: []byte("a")},
+		{Key: "baggage", Value: []byte(strings.Repeat("b", 500))},
+	}, record.Headers)
+
+	removed, fits = truncateHeaders(record, recordSize(&kgo.Record{Value: record.Value})-1)
+	assert.False(t, fits)
+	assert.Equal(t, []string{"baggage", "small"}, removed)
+	assert.Empty(t, record.Headers)
+}
+
+func TestRedpandaMigratorOutputValidateRecordSizes(t *testing.T) {
+	newBatch := func() (service.MessageBatch, []*kgo.Record) {
+		var batch service.MessageBatch
+		for i := range 3 {
+			msg := service.NewMessage(nil)
+			msg.MetaSetMut("kafka_partition", int32(1))
+			msg.MetaSetMut("kafka_offset", int64(40+i))
+			batch = append(batch, msg)
+		}
+		return batch, []*kgo.Record{
+			{Topic: "small", Value: []byte(strings.Repeat("x", 200))},
+			{Topic: "big", Value: []byte("foo"), Headers: []kgo.RecordHeader{{Key: "trace", Value: []byte(strings.Repeat("t", 200))}}},
+			nil,
+		}
+	}
+	limits := func(destTopic string) (recordSizeLimit, bool) {
+		if destTopic == "big" {
+			return recordSizeLimit{topic: 1000, broker: 100}, true
+		}
+		return recordSizeLimit{}, false
+	}
+
+	tests := []struct {
+		action      string
+		errContains string
+		check       func(t *testing.T, records []*kgo.Record)
+	}{
+		{
+			action:      rmoOnOversizedRecordFail,
+			errContains: `record at message index 1 for topic "big" (source partition 1, offset 41) is 280 bytes, which exceeds the max message size (max.message.bytes: 1000, message.max.bytes: 100)`,
+		},
+		{
+			action: rmoOnOversizedRecordDrop,
+			check: func(t *testing.T, records []*kgo.Record) {
+				assert.NotNil(t, records[0], "records without a known limit are not validated")
+				assert.Nil(t, records[1])
+			},
+		},
+		{
+			action: rmoOnOversizedRecordTruncateHeaders,
+			check: func(t *testing.T, records []*kgo.Record) {
+				require.NotNil(t, records[1])
+				assert.Empty(t, records[1].Headers)
+				assert.Equal(t, []byte("foo"), records[1].Value)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.action, func(t *testing.T) {
+			w := &redpandaMigratorWriter{
+				onOversizedRecord: test.action,
+				oversizedRecords:  service.MockResources().Metrics().NewCounter("redpanda_migrator_oversized_records", "topic", "action"),
+				mgr:               service.MockResources(),
+			}
+
+			batch, records := newBatch()
+			err := w.validateRecordSizes(batch, records, limits)
+			if test.errContains != "" {
+				require.ErrorContains(t, err, test.errContains)
+				return
+			}
+			require.NoError(t, err)
+			test.check(t, records)
+		})
+	}
+
+	w := &redpandaMigratorWriter{onOversizedRecord: rmoOnOversizedRecordTruncateHeaders, mgr: service.MockResources()}
+	batch, records := newBatch()
+	records[1].Value = []byte(strings.Repeat("v", 100))
+	require.ErrorContains(t, w.validateRecordSizes(batch, records, limits), "bytes without headers, which exceeds the max message size")
+}
+
+func TestRedpandaMigratorOutputRecordSizeLimitCachesFailures(t *testing.T) {
+	// The broker is unreachable and the context is cancelled, so fetching the limit fails.
+	client, err := kgo.NewClient(kgo.SeedBrokers("localhost:1"))
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	w := &redpandaMigratorWriter{mgr: service.MockResources()}
+	_, ok := w.recordSizeLimit(ctx, client, "foo")
+	assert.False(t, ok)
+
+	// The failure is cached, so the limit isn't fetched again, which would panic with a nil client.
+	_, ok = w.recordSizeLimit(ctx, nil, "foo")
+	assert.False(t, ok)
+
+	// Once the retry interval elapsed, the limit is fetched again.
+	w.recordSizeLimits.Store("foo", cachedRecordSizeLimit{retryAt: time.Now().Add(-time.Second)})
+	w.recordSizeLimits.Store("bar", cachedRecordSizeLimit{limit: recordSizeLimit{topic: 100}})
+	_, ok = w.recordSizeLimit(ctx, client, "foo")
+	assert.False(t, ok)
+	v, _ := w.recordSizeLimits.Load("foo")
+	assert.True(t, v.(cachedRecordSizeLimit).retryAt.After(time.Now()))
+
+	limit, ok := w.recordSizeLimit(ctx, nil, "bar")
+	assert.True(t, ok)
+	assert.Equal(t, 100, limit.max())
+}
@@ -0,0 +1,346 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Jeffail/shutdown"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/twmb/franz-go/pkg/kgo"
+	franz_sr "github.com/twmb/franz-go/pkg/sr"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/confluent/sr"
+)
+
+const (
+	schemaIDSourceMetaKey      = "schema_id_source"
+	schemaIDDestinationMetaKey = "schema_id_destination"
+
+	schemaIDResultTranslated  = "translated"
+	schemaIDResultFailed      = "failed"
+	schemaIDResultPassthrough = "passthrough"
+)
+
+// resolveSchemaIDs sets the schema_id_source and schema_id_destination metadata fields of each message in the
+// Confluent wire format to its source schema ID and the destination schema ID returned by mappingFn. It's called before
+// the records of the batch are built, so that the metadata is added to their headers when the metadata filter includes
+// it. Failing to resolve a schema ID is logged and the destination schema ID isn't set, in which case the record is
+// written without modification.
+func (w *redpandaMigratorWriter) resolveSchemaIDs(ctx context.Context, batch service.MessageBatch, mappingFn func(ctx context.Context, id int) (schemaIDMapping, error)) {
+	var ch franz_sr.ConfluentHeader
+	var topicExecutor *service.MessageBatchInterpolationExecutor
+	if w.topic != nil {
+		topicExecutor = batch.InterpolationExecutor(w.topic)
+	}
+	for msgIdx, msg := range batch {
+		msg.MetaDelete(schemaIDSourceMetaKey)
+		msg.MetaDelete(schemaIDDestinationMetaKey)
+
+		// Tombstones don't have a value, so they don't have a schema ID either.
+		if isTombstone(msg) {
+			continue
+		}
+		value, err := msg.AsBytes()
+		if err != nil || value == nil {
+			continue
+		}
+
+		var topic string
+		if topicExecutor != nil {
+			if topic, err = topicExecutor.TryString(msgIdx); err != nil {
+				continue
+			}
+		}
+		if isExcludedTopic(w.inputResource, topic, w.mgr) {
+			continue
+		}
+
+		if w.schemaTranslationTopics != nil && !w.schemaTranslationTopics.matches(topic) {
+			if schemaID, _, err := ch.DecodeID(value); err == nil {
+				w.schemaIDRecords.Incr(1, schemaIDResultPassthrough)
+				setSchemaIDMeta(msg, schemaID, schemaID)
+			}
+			continue
+		}
+
+		schemaID, _, err := ch.DecodeID(value)
+		if err != nil {
+			if errors.Is(err, franz_sr.ErrBadHeader) {
+				// Topics may contain a mix of messages with and without schemas, so this is expected.
+				w.missingSchemaIDs.Incr(1, topic)
+				w.mgr.Logger().Debugf("Skipping schema ID translation for message index %d on topic %q: %s", msgIdx, topic, err)
+			} else {
+				w.mgr.Logger().Warnf("Failed to extract schema ID from message index %d on topic %q: %s", msgIdx, topic, err)
+			}
+			continue
+		}
+
+		var destSchemaID int
+		if cachedID, ok := w.schemaIDCache.Load(schemaID); !ok {
+			mapping, err := mappingFn(ctx, schemaID)
+			if err != nil {
+				w.mgr.Logger().Warnf("Failed to fetch destination schema ID from message index %d on topic %q: %s", msgIdx, topic, err)
+				w.schemaIDRecords.Incr(1, schemaIDResultFailed)
+				setSchemaIDMeta(msg, schemaID, -1)
+				continue
+			}
+			destSchemaID = mapping.destinationID
+			// Concurrent batches may establish the same mapping, which is only reported once.
+			if _, loaded := w.schemaIDCache.LoadOrStore(schemaID, destSchemaID); !loaded {
+				w.translationReporter.report(schemaTranslationReport{
+					SourceSchemaID:      schemaID,
+					DestinationSchemaID: destSchemaID,
+					Subjects:            mapping.subjects,
+					SourceTopic:         topic,
+					EstablishedAt:       time.Now().UTC(),
+				})
+			}
+		} else {
+			destSchemaID = cachedID.(int)
+		}
+
+		w.resolvedSchemaIDs.Store(destSchemaID, struct{}{})
+		w.schemaIDRecords.Incr(1, schemaIDResultTranslated)
+		setSchemaIDMeta(msg, schemaID, destSchemaID)
+	}
+}
+
+// translateRecordSchemaIDs replaces the source schema ID of each record with the destination schema ID which
+// resolveSchemaIDs set in the metadata of its message. Records without a destination schema ID are written without
+// modification.
+func (w *redpandaMigratorWriter) translateRecordSchemaIDs(batch service.MessageBatch, records []*kgo.Record) {
+	var ch franz_sr.ConfluentHeader
+	for recordIdx, record := range records {
+		if record == nil || record.Value == nil || recordIdx >= len(batch) {
+			continue
+		}
+		source, _ := batch[recordIdx].MetaGetMut(schemaIDSourceMetaKey)
+		destination, _ := batch[recordIdx].MetaGetMut(schemaIDDestinationMetaKey)
+		sourceID, okSource := source.(int)
+		destinationID, okDestination := destination.(int)
+		if !okSource || !okDestination || sourceID == destinationID {
+			continue
+		}
+		if schemaID, _, err := ch.DecodeID(record.Value); err != nil || schemaID != sourceID {
+			continue
+		}
+
+		// The value of the record shares its memory with the message, which must keep its source schema ID in case
+		// the batch is written again.
+		value := slices.Clone(record.Value)
+		if err := sr.UpdateID(value, destinationID); err != nil {
+			w.mgr.Logger().Warnf("Failed to update schema ID in message index %d on topic %q: %s", recordIdx, record.Topic, err)
+			continue
+		}
+		record.Value = value
+	}
+}
+
+// setSchemaIDMeta sets the schema ID metadata of msg. The destination schema ID is omitted when it's negative, which
+// means that it couldn't be translated.
+func setSchemaIDMeta(msg *service.Message, sourceID, destinationID int) {
+	if msg == nil {
+		return
+	}
+	msg.MetaSetMut(schemaIDSourceMetaKey, sourceID)
+	if destinationID >= 0 {
+		msg.MetaSetMut(schemaIDDestinationMetaKey, destinationID)
+	} else {
+		msg.MetaDelete(schemaIDDestinationMetaKey)
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// schemaTranslationReport is produced to the translation report topic when a schema ID mapping is first established.
+type schemaTranslationReport struct {
+	SourceSchemaID      int                    `json:"source_schema_id"`
+	DestinationSchemaID int                    `json:"destination_schema_id"`
+	Subjects            []schemaSubjectVersion `json:"subjects"`
+	SourceTopic         string                 `json:"source_topic"`
+	EstablishedAt       time.Time              `json:"established_at"`
+}
+
+// schemaTranslationReporter produces the reports of the established schema ID mappings in the background, so that
+// producing them never blocks or fails the writes of the output. Reports which fail to be produced are retried until
+// the reporter is stopped.
+type schemaTranslationReporter struct {
+	topic string
+	// Produces the records and returns the ones which failed.
+	produce func(ctx context.Context, records []*kgo.Record) ([]*kgo.Record, error)
+	backoff backoff.BackOff
+	log     *service.Logger
+
+	mu      sync.Mutex
+	pending []*kgo.Record
+	notify  chan struct{}
+	shutSig *shutdown.Signaller
+}
+
+func newSchemaTranslationReporter(topic string, produce func(ctx context.Context, records []*kgo.Record) ([]*kgo.Record, error), log *service.Logger) *schemaTranslationReporter {
+	return &schemaTranslationReporter{
+		topic:   topic,
+		produce: produce,
+		backoff: &backoff.ExponentialBackOff{
+			InitialInterval:     time.Second,
+			RandomizationFactor: backoff.DefaultRandomizationFactor,
+			Multiplier:          backoff.DefaultMultiplier,
+			MaxInterval:         time.Minute,
+			Clock:               backoff.SystemClock,
+		},
+		log:    log,
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// report queues a report, which is produced once the reporter is started.
+func (r *schemaTranslationReporter) report(report schemaTranslationReport) {
+	if r == nil {
+		return
+	}
+
+	value, err := json.Marshal(report)
+	if err != nil {
+		r.log.Errorf("Failed to encode the schema translation report of source schema ID %d: %s", report.SourceSchemaID, err)
+		return
+	}
+
+	r.mu.Lock()
+	r.pending = append(r.pending, &kgo.Record{
+		Topic: r.topic,
+		Key:   []byte(strconv.Itoa(report.SourceSchemaID)),
+		Value: value,
+	})
+	r.mu.Unlock()
+
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// start runs the background loop unless it's already running. The loop is started again after it was stopped, so that
+// the pending reports are produced once the output reconnects.
+func (r *schemaTranslationReporter) start() {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.shutSig != nil {
+		return
+	}
+	shutSig := shutdown.NewSignaller()
+	r.shutSig = shutSig
+
+	go func() {
+		defer shutSig.TriggerHasStopped()
+
+		ctx, done := shutSig.SoftStopCtx(context.Background())
+		defer done()
+
+		r.backoff.Reset()
+		for {
+			r.mu.Lock()
+			records := r.pending
+			r.pending = nil
+			r.mu.Unlock()
+
+			var retry bool
+			var wait time.Duration
+			if len(records) > 0 {
+				if failed, err := r.produce(ctx, records); err != nil {
+					r.requeue(failed)
+					if ctx.Err() != nil {
+						return
+					}
+					retry, wait = true, r.backoff.NextBackOff()
+					r.log.Warnf("Failed to produce %d schema translation reports to topic %q, retrying in %s: %s", len(failed), r.topic, wait, err)
+				} else {
+					r.backoff.Reset()
+				}
+			}
+
+			if retry {
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+			select {
+			case <-r.notify:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// requeue puts records back in front of the reports which were queued while they were produced, preserving their
+// order.
+func (r *schemaTranslationReporter) requeue(records []*kgo.Record) {
+	r.mu.Lock()
+	r.pending = append(records, r.pending...)
+	r.mu.Unlock()
+}
+
+// stop stops the background loop and waits for it to exit. The pending reports are kept.
+func (r *schemaTranslationReporter) stop(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	shutSig := r.shutSig
+	r.shutSig = nil
+	r.mu.Unlock()
+	if shutSig == nil {
+		return nil
+	}
+
+	shutSig.TriggerSoftStop()
+	select {
+	case <-shutSig.HasStoppedChan():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// produceTranslationReports produces the reports with a dedicated client, since the client of the output may be
+// transactional. The client is created for each attempt, since reports are rare.
+func (w *redpandaMigratorWriter) produceTranslationReports(ctx context.Context, records []*kgo.Record) ([]*kgo.Record, error) {
+	client, err := kgo.NewClient(append(w.connDetails.FranzOpts(), kgo.AllowAutoTopicCreation())...)
+	if err != nil {
+		return records, err
+	}
+	defer client.Close()
+
+	var failed []*kgo.Record
+	var errs []error
+	for _, res := range client.ProduceSync(ctx, records...) {
+		if res.Err != nil {
+			failed = append(failed, res.Record)
+			errs = append(errs, res.Err)
+		}
+	}
+	return failed, errors.Join(errs...)
+}
@@ -0,0 +1,198 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func wireFormatValue(schemaID int, body string) []byte {
+	value := []byte{0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(value[1:], uint32(schemaID))
+	return append(value, body...)
+}
+
+func TestRedpandaMigratorOutputTranslateRecordSchemaIDs(t *testing.T) {
+	translationTopics, err := newTopicMatcher([]string{"foo"}, false)
+	require.NoError(t, err)
+	topic, err := service.NewInterpolatedString(`${! @kafka_topic }`)
+	require.NoError(t, err)
+
+	w := &redpandaMigratorWriter{
+		schemaTranslationTopics: translationTopics,
+		topic:                   topic,
+		missingSchemaIDs:        service.MockResources().Metrics().NewCounter("redpanda_migrator_records_without_schema_id", "topic"),
+		schemaIDRecords:         service.MockResources().Metrics().NewCounter("redpanda_migrator_schema_id_records", "result"),
+		translationReporter:     newSchemaTranslationReporter("reports", nil, service.MockResources().Logger()),
+		mgr:                     service.MockResources(),
+	}
+
+	var lookups int
+	mappingFn := func(_ context.Context, id int) (schemaIDMapping, error) {
+		lookups++
+		if id == 2 {
+			return schemaIDMapping{}, errors.New("schema not found")
+		}
+		return schemaIDMapping{
+			destinationID: id + 100,
+			subjects:      []schemaSubjectVersion{{Subject: "foo-value", Version: 3}},
+		}, nil
+	}
+
+	newMsg := func(topic string, value []byte) *service.Message {
+		msg := service.NewMessage(value)
+		msg.MetaSetMut("kafka_topic", topic)
+		return msg
+	}
+	// The records are built from the messages after their schema IDs were resolved.
+	newBatch := func() service.MessageBatch {
+		tombstone := newMsg("foo", nil)
+		tombstone.MetaSetMut("kafka_tombstone_message", true)
+		stale := newMsg("foo", []byte("stale"))
+		stale.MetaSetMut(schemaIDSourceMetaKey, 5)
+		return service.MessageBatch{
+			newMsg("foo", wireFormatValue(1, "first")),
+			newMsg("foo", wireFormatValue(2, "second")),
+			newMsg("bar", wireFormatValue(3, "third")),
+			newMsg("foo", []byte("plain")),
+			tombstone,
+			stale,
+		}
+	}
+	buildRecords := func(batch service.MessageBatch) []*kgo.Record {
+		records := make([]*kgo.Record, len(batch))
+		for i, msg := range batch {
+			topic, _ := msg.MetaGet("kafka_topic")
+			value, err := msg.AsBytes()
+			require.NoError(t, err)
+			records[i] = &kgo.Record{Topic: topic, Value: value}
+		}
+		markTombstones(batch, records)
+		return records
+	}
+	meta := func(msg *service.Message, key string) any {
+		v, ok := msg.MetaGetMut(key)
+		if !ok {
+			return nil
+		}
+		return v
+	}
+
+	batch := newBatch()
+	w.resolveSchemaIDs(context.Background(), batch, mappingFn)
+	assert.Equal(t, 1, meta(batch[0], schemaIDSourceMetaKey))
+	assert.Equal(t, 101, meta(batch[0], schemaIDDestinationMetaKey))
+	assert.Equal(t, 2, meta(batch[1], schemaIDSourceMetaKey))
+	assert.Nil(t, meta(batch[1], schemaIDDestinationMetaKey))
+	assert.Equal(t, 3, meta(batch[2], schemaIDSourceMetaKey))
+	assert.Equal(t, 3, meta(batch[2], schemaIDDestinationMetaKey))
+	assert.Nil(t, meta(batch[3], schemaIDSourceMetaKey))
+	assert.Nil(t, meta(batch[4], schemaIDSourceMetaKey))
+	assert.Nil(t, meta(batch[5], schemaIDSourceMetaKey), "stale metadata is removed")
+
+	records := buildRecords(batch)
+	w.translateRecordSchemaIDs(batch, records)
+	assert.Equal(t, wireFormatValue(101, "first"), records[0].Value)
+	assert.Equal(t, wireFormatValue(2, "second"), records[1].Value, "records which fail to be translated are written without modification")
+	assert.Equal(t, wireFormatValue(3, "third"), records[2].Value)
+	assert.Equal(t, []byte("plain"), records[3].Value)
+	assert.Nil(t, records[4].Value, "tombstones are written without a value")
+	assert.Equal(t, []byte("stale"), records[5].Value)
+
+	value, err := batch[0].AsBytes()
+	require.NoError(t, err)
+	assert.Equal(t, wireFormatValue(1, "first"), value, "messages keep their source schema ID")
+	assert.True(t, w.isResolvedSchemaID(101))
+	assert.False(t, w.isResolvedSchemaID(3), "passthrough schema IDs aren't resolved")
+
+	// Established mappings are cached and only reported once.
+	batch = newBatch()
+	w.resolveSchemaIDs(context.Background(), batch, mappingFn)
+	records = buildRecords(batch)
+	w.translateRecordSchemaIDs(batch, records)
+	assert.Equal(t, wireFormatValue(101, "first"), records[0].Value)
+	assert.Equal(t, 3, lookups)
+
+	require.Len(t, w.translationReporter.pending, 1)
+	report := w.translationReporter.pending[0]
+	assert.Equal(t, "reports", report.Topic)
+	assert.Equal(t, []byte("1"), report.Key)
+
+	var decoded schemaTranslationReport
+	require.NoError(t, json.Unmarshal(report.Value, &decoded))
+	assert.Equal(t, 1, decoded.SourceSchemaID)
+	assert.Equal(t, 101, decoded.DestinationSchemaID)
+	assert.Equal(t, []schemaSubjectVersion{{Subject: "foo-value", Version: 3}}, decoded.Subjects)
+	assert.Equal(t, "foo", decoded.SourceTopic)
+	assert.False(t, decoded.EstablishedAt.IsZero())
+}
+
+func TestSchemaTranslationReporter(t *testing.T) {
+	var mu sync.Mutex
+	var produced []string
+	var attempts int
+	produce := func(_ context.Context, records []*kgo.Record) ([]*kgo.Record, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 {
+			// The first record is produced and the others fail.
+			produced = append(produced, string(records[0].Key))
+			return records[1:], errors.New("not leader for partition")
+		}
+		for _, r := range records {
+			produced = append(produced, string(r.Key))
+		}
+		return nil, nil
+	}
+
+	r := newSchemaTranslationReporter("reports", produce, service.MockResources().Logger())
+	r.backoff = &backoff.ZeroBackOff{}
+
+	for id := range 3 {
+		r.report(schemaTranslationReport{SourceSchemaID: id})
+	}
+	r.start()
+	// Starting a running reporter is a no-op.
+	r.start()
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(produced) == 3
+	}, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, r.stop(ctx))
+
+	// Reports queued while the reporter is stopped are produced once it's started again.
+	r.report(schemaTranslationReport{SourceSchemaID: 3})
+	r.start()
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(produced) == 4
+	}, time.Second, time.Millisecond)
+	require.NoError(t, r.stop(ctx))
+
+	assert.Equal(t, []string{"0", "1", "2", "3"}, produced)
+}
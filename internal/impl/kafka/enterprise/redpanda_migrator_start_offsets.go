@@ -0,0 +1,387 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/kafka"
+)
+
+const (
+	rmiFieldStartOffsets       = "start_offsets"
+	rmiFieldStartOffsetsTopics = "topics"
+	rmiFieldStartOffsetsPolicy = "policy"
+
+	startOffsetPolicyEarliest        = "earliest"
+	startOffsetPolicyLatest          = "latest"
+	startOffsetPolicyLocalEarliest   = "local_earliest"
+	startOffsetPolicyTimestampPrefix = "timestamp:"
+
+	startOffsetPolicyMetaKey = "migration_start_offset_policy"
+)
+
+// The special timestamps of ListOffsets requests which return the start and end offsets of partitions, and the start
+// offset of the log which is stored on the local disks of the brokers, as opposed to tiered storage.
+const (
+	listOffsetsLatest        int64 = -1
+	listOffsetsEarliest      int64 = -2
+	listOffsetsLocalEarliest int64 = -4
+)
+
+func startOffsetsField() *service.ConfigField {
+	return service.NewObjectListField(rmiFieldStartOffsets,
+		service.NewStringListField(rmiFieldStartOffsetsTopics).
+			Description("The topics which are consumed from the start offset of the policy. When `regexp_topics` is `true` they are interpreted as regular expression patterns. Multiple comma separated topics can be listed in a single element."),
+		service.NewStringField(rmiFieldStartOffsetsPolicy).
+			Description("The offset from which the partitions of the topics are consumed. Either `"+startOffsetPolicyEarliest+"`, `"+startOffsetPolicyLatest+"`, `"+startOffsetPolicyLocalEarliest+"` for the earliest offset which is still stored on the local disks of the brokers, which falls back to `"+startOffsetPolicyEarliest+"` for partitions whose brokers don't support listing it, or `"+startOffsetPolicyTimestampPrefix+"<ts>` for the first offset whose timestamp is at or after `<ts>`, which is either an RFC 3339 timestamp or a Unix timestamp in milliseconds.").
+			Example(startOffsetPolicyLocalEarliest).
+			Example(startOffsetPolicyTimestampPrefix+"2024-01-01T00:00:00Z"),
+	).
+		Description("Policies which override `start_from_oldest` for the partitions of the topics which match them, where the first policy which matches a topic wins. Partitions are only started from the offset of their policy when they don't have a committed offset, or weren't listed with an explicit offset. The chosen start offset of each partition is logged. This is useful for source topics whose older segments were offloaded to tiered storage, which are slow and expensive to read, so that only the tail of the topics is migrated while their history is backfilled separately. Records of topics whose policy isn't `" + startOffsetPolicyEarliest + "` are marked with the `" + startOffsetPolicyMetaKey + "` metadata field.").
+		Example([]any{
+			map[string]any{
+				rmiFieldStartOffsetsTopics: []any{"clickstream"},
+				rmiFieldStartOffsetsPolicy: startOffsetPolicyLocalEarliest,
+			},
+			map[string]any{
+				rmiFieldStartOffsetsTopics: []any{"audit"},
+				rmiFieldStartOffsetsPolicy: startOffsetPolicyTimestampPrefix + "2024-01-01T00:00:00Z",
+			},
+		}).
+		Optional().
+		Advanced()
+}
+
+// startOffsetPolicy determines the offset from which the partitions of a topic are consumed.
+type startOffsetPolicy struct {
+	// The policy as configured, which is used for logging and metadata.
+	name string
+	// The timestamp of the ListOffsets request which returns the start offset.
+	timestamp int64
+}
+
+func parseStartOffsetPolicy(s string) (startOffsetPolicy, error) {
+	switch s {
+	case startOffsetPolicyEarliest:
+		return startOffsetPolicy{name: s, timestamp: listOffsetsEarliest}, nil
+	case startOffsetPolicyLatest:
+		return startOffsetPolicy{name: s, timestamp: listOffsetsLatest}, nil
+	case startOffsetPolicyLocalEarliest:
+		return startOffsetPolicy{name: s, timestamp: listOffsetsLocalEarliest}, nil
+	}
+
+	ts, ok := strings.CutPrefix(s, startOffsetPolicyTimestampPrefix)
+	if !ok {
+		return startOffsetPolicy{}, fmt.Errorf("unknown start offset policy %q, expected %s, %s, %s or %s<ts>", s, startOffsetPolicyEarliest, startOffsetPolicyLatest, startOffsetPolicyLocalEarliest, startOffsetPolicyTimestampPrefix)
+	}
+	if ms, err := strconv.ParseInt(ts, 10, 64); err == nil {
+		if ms < 0 {
+			return startOffsetPolicy{}, fmt.Errorf("start offset policy %q: timestamp must not be negative", s)
+		}
+		return startOffsetPolicy{name: s, timestamp: ms}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return startOffsetPolicy{}, fmt.Errorf("start offset policy %q: timestamp must be an RFC 3339 timestamp or a Unix timestamp in milliseconds: %s", s, err)
+	}
+	return startOffsetPolicy{name: s, timestamp: t.UnixMilli()}, nil
+}
+
+// skipsHistory returns whether records before the start offset of the policy may be skipped.
+func (p startOffsetPolicy) skipsHistory() bool {
+	return p.timestamp != listOffsetsEarliest
+}
+
+type startOffsetRule struct {
+	topics *topicMatcher
+	policy startOffsetPolicy
+}
+
+// startOffsetRulesFromParsed returns the rules listed in the start_offsets field.
+func startOffsetRulesFromParsed(conf *service.ParsedConfig) ([]startOffsetRule, error) {
+	if !conf.Contains(rmiFieldStartOffsets) {
+		return nil, nil
+	}
+	confs, err := conf.FieldObjectList(rmiFieldStartOffsets)
+	if err != nil {
+		return nil, err
+	}
+	if len(confs) == 0 {
+		return nil, nil
+	}
+
+	regexpTopics, err := conf.FieldBool(rmoiFieldRegexpTopics)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make([]startOffsetRule, 0, len(confs))
+	for i, c := range confs {
+		topicList, err := c.FieldStringList(rmiFieldStartOffsetsTopics)
+		if err != nil {
+			return nil, err
+		}
+		topics, _, err := kafka.ParseTopics(topicList, -1, false)
+		if err != nil {
+			return nil, err
+		}
+		if len(topics) == 0 {
+			return nil, fmt.Errorf("%s %d: at least one topic must be listed", rmiFieldStartOffsets, i)
+		}
+		m, err := newTopicMatcher(topics, regexpTopics)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", rmiFieldStartOffsets, err)
+		}
+
+		policyStr, err := c.FieldString(rmiFieldStartOffsetsPolicy)
+		if err != nil {
+			return nil, err
+		}
+		policy, err := parseStartOffsetPolicy(policyStr)
+		if err != nil {
+			return nil, fmt.Errorf("%s %d: %s", rmiFieldStartOffsets, i, err)
+		}
+		rules = append(rules, startOffsetRule{topics: m, policy: policy})
+	}
+	return rules, nil
+}
+
+// listOffsetsFn returns the offsets which ListOffsets requests sent with client return for the timestamp of a policy
+// of the partitions of each topic.
+type listOffsetsFn func(ctx context.Context, client *kgo.Client, timestamp int64, topicPartitions map[string][]int32) (map[string]map[int32]int64, error)
+
+// startOffsets chooses the offsets from which the partitions without a committed or explicit offset are consumed
+// according to the policy of their topic.
+type startOffsets struct {
+	rules []startOffsetRule
+	// The explicitly listed partitions, which are consumed when the input doesn't consume with a consumer group.
+	partitions map[string]map[int32]kgo.Offset
+	clientOpts []kgo.Opt
+	listFn     listOffsetsFn
+	log        *service.Logger
+
+	// The client of the reader, which lists the start offsets of the partitions assigned to the consumer group member.
+	readerClient atomic.Pointer[kgo.Client]
+
+	mu sync.Mutex
+	// The explicitly listed partitions with the start offsets chosen when the input last connected.
+	resolved map[string]map[int32]kgo.Offset
+	// The client which lists the start offsets of the explicitly listed partitions, which are needed before the client of
+	// the reader is created. It's kept until the input closes.
+	captureClient *kgo.Client
+}
+
+func newStartOffsets(rules []startOffsetRule, partitions map[string]map[int32]kgo.Offset, clientOpts []kgo.Opt, readCommitted bool, mgr *service.Resources) *startOffsets {
+	return &startOffsets{
+		rules:      rules,
+		partitions: partitions,
+		clientOpts: clientOpts,
+		listFn: func(ctx context.Context, client *kgo.Client, timestamp int64, topicPartitions map[string][]int32) (map[string]map[int32]int64, error) {
+			info := &kafka.FranzSharedClientInfo{Client: client}
+			switch timestamp {
+			case listOffsetsEarliest:
+				return info.StartOffsets(ctx, topicPartitions)
+			case listOffsetsLocalEarliest:
+				return info.LocalStartOffsets(ctx, topicPartitions)
+			case listOffsetsLatest:
+				if readCommitted {
+					return info.LastStableOffsets(ctx, topicPartitions)
+				}
+				return info.EndOffsets(ctx, topicPartitions)
+			}
+			// Partitions without records at or after the timestamp start from their end, like consumers do when they
+			// reset their offsets by timestamp.
+			return info.OffsetsForTimestamp(ctx, topicPartitions, time.UnixMilli(timestamp))
+		},
+		log: mgr.Logger(),
+	}
+}
+
+// OnNewClient implements kgo.HookNewClient, which keeps the client of the reader for listing the start offsets of the
+// partitions assigned to the consumer group member.
+func (s *startOffsets) OnNewClient(client *kgo.Client) {
+	s.readerClient.Store(client)
+}
+
+// adjustAssigned implements kgo.AdjustFetchOffsetsFn with the client of the reader.
+func (s *startOffsets) adjustAssigned(ctx context.Context, offsets map[string]map[int32]kgo.Offset) (map[string]map[int32]kgo.Offset, error) {
+	return s.adjust(ctx, s.readerClient.Load(), offsets)
+}
+
+// close closes the client which lists the start offsets of the explicitly listed partitions.
+func (s *startOffsets) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.captureClient != nil {
+		s.captureClient.Close()
+		s.captureClient = nil
+	}
+}
+
+// policyFor returns the policy of the first rule which matches the topic, if any.
+func (s *startOffsets) policyFor(topic string) (startOffsetPolicy, bool) {
+	for _, r := range s.rules {
+		if r.topics.matches(topic) {
+			return r.policy, true
+		}
+	}
+	return startOffsetPolicy{}, false
+}
+
+// capture chooses the start offsets of the explicitly listed partitions, which are consumed by the client created next.
+func (s *startOffsets) capture(ctx context.Context) error {
+	if len(s.partitions) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.captureClient == nil {
+		client, err := kgo.NewClient(s.clientOpts...)
+		if err != nil {
+			return fmt.Errorf("failed to create Kafka client: %s", err)
+		}
+		s.captureClient = client
+	}
+	resolved, err := s.adjust(ctx, s.captureClient, s.partitions)
+	if err != nil {
+		return err
+	}
+	s.resolved = resolved
+	return nil
+}
+
+// consumeOpts returns the options which consume the explicitly listed partitions from their chosen start offsets.
+func (s *startOffsets) consumeOpts() []kgo.Opt {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.resolved == nil {
+		return nil
+	}
+	return []kgo.Opt{kgo.ConsumePartitions(s.resolved)}
+}
+
+// adjust returns a copy of offsets where the partitions without a committed or explicit offset, whose topics match a
+// policy, start from the offset of the policy, which is listed with client.
+func (s *startOffsets) adjust(ctx context.Context, client *kgo.Client, offsets map[string]map[int32]kgo.Offset) (map[string]map[int32]kgo.Offset, error) {
+	// The partitions to list for the timestamp of each policy.
+	pending := map[int64]map[string][]int32{}
+	policies := map[string]startOffsetPolicy{}
+	for topic, partitions := range offsets {
+		policy, ok := s.policyFor(topic)
+		if !ok {
+			continue
+		}
+		for partition, offset := range partitions {
+			// Committed and explicit offsets are never negative, the partitions which don't have one start from the
+			// special offsets of the start or end of the partition.
+			if offset.EpochOffset().Offset >= 0 {
+				continue
+			}
+			if pending[policy.timestamp] == nil {
+				pending[policy.timestamp] = map[string][]int32{}
+			}
+			pending[policy.timestamp][topic] = append(pending[policy.timestamp][topic], partition)
+			policies[topic] = policy
+		}
+	}
+	if len(pending) == 0 {
+		return offsets, nil
+	}
+
+	listed := map[string]map[int32]int64{}
+	for timestamp, topicPartitions := range pending {
+		partitionOffsets, err := s.listFn(ctx, client, timestamp, topicPartitions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list start offsets: %w", err)
+		}
+		for topic, partitions := range partitionOffsets {
+			if listed[topic] == nil {
+				listed[topic] = map[int32]int64{}
+			}
+			maps.Copy(listed[topic], partitions)
+		}
+	}
+
+	// Brokers which don't support listing the local start offsets may list them as -1, those partitions start from their
+	// log start offsets rather than skipping all of their records.
+	unsupported := map[string][]int32{}
+	for _, topicPartitions := range pending {
+		for topic, partitions := range topicPartitions {
+			for _, partition := range partitions {
+				offset, ok := listed[topic][partition]
+				if !ok {
+					return nil, fmt.Errorf("failed to list start offsets: partition %d of topic %s is missing", partition, topic)
+				}
+				if offset < 0 {
+					if policies[topic].timestamp != listOffsetsLocalEarliest {
+						return nil, fmt.Errorf("failed to list start offsets: partition %d of topic %s was listed at %d", partition, topic, offset)
+					}
+					unsupported[topic] = append(unsupported[topic], partition)
+				}
+			}
+		}
+	}
+	if len(unsupported) > 0 {
+		s.log.Warnf("The local start offsets of the partitions of topics %v couldn't be listed, they are consumed from their earliest offset instead", slices.Sorted(maps.Keys(unsupported)))
+		starts, err := s.listFn(ctx, client, listOffsetsEarliest, unsupported)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list start offsets: %w", err)
+		}
+		for topic, partitions := range unsupported {
+			for _, partition := range partitions {
+				offset, ok := starts[topic][partition]
+				if !ok {
+					return nil, fmt.Errorf("failed to list start offsets: partition %d of topic %s is missing", partition, topic)
+				}
+				if offset < 0 {
+					return nil, fmt.Errorf("failed to list start offsets: partition %d of topic %s was listed at %d", partition, topic, offset)
+				}
+				listed[topic][partition] = offset
+			}
+		}
+	}
+
+	adjusted := make(map[string]map[int32]kgo.Offset, len(offsets))
+	for topic, partitions := range offsets {
+		adjusted[topic] = maps.Clone(partitions)
+	}
+	for topic, partitions := range listed {
+		for partition, offset := range partitions {
+			if _, ok := adjusted[topic][partition]; !ok {
+				continue
+			}
+			s.log.Infof("Consuming partition %d of topic %s from offset %d according to start offset policy %s", partition, topic, offset, policies[topic].name)
+			adjusted[topic][partition] = kgo.NewOffset().At(offset)
+		}
+	}
+	return adjusted, nil
+}
+
+// mark sets the start offset policy metadata field of the records of topics whose policy may skip their history.
+func (s *startOffsets) mark(batch service.MessageBatch) {
+	for _, msg := range batch {
+		topic, _ := msg.MetaGet("kafka_topic")
+		if policy, ok := s.policyFor(topic); ok && policy.skipsHistory() {
+			msg.MetaSetMut(startOffsetPolicyMetaKey, policy.name)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestParseStartOffsetPolicy(t *testing.T) {
+	tests := []struct {
+		policy      string
+		timestamp   int64
+		errContains string
+	}{
+		{policy: "earliest", timestamp: -2},
+		{policy: "latest", timestamp: -1},
+		{policy: "local_earliest", timestamp: -4},
+		{policy: "timestamp:1704067200000", timestamp: 1704067200000},
+		{policy: "timestamp:2024-01-01T00:00:00Z", timestamp: 1704067200000},
+		{policy: "timestamp:2024-01-01T01:00:00.5+01:00", timestamp: 1704067200500},
+		{policy: "timestamp:-1", errContains: "must not be negative"},
+		{policy: "timestamp:yesterday", errContains: "must be an RFC 3339 timestamp"},
+		{policy: "oldest", errContains: "unknown start offset policy"},
+	}
+	for _, test := range tests {
+		p, err := parseStartOffsetPolicy(test.policy)
+		if test.errContains != "" {
+			require.ErrorContains(t, err, test.errContains, test.policy)
+			continue
+		}
+		require.NoError(t, err, test.policy)
+		assert.Equal(t, test.policy, p.name)
+		assert.Equal(t, test.timestamp, p.timestamp, test.policy)
+	}
+}
+
+func TestStartOffsetRulesFromParsed(t *testing.T) {
+	conf, err := redpandaMigratorInputConfig().ParseYAML(`
+seed_brokers: [ localhost:9092 ]
+topics: [ "^clicks-.*", "^audit$" ]
+regexp_topics: true
+consumer_group: migrator
+start_offsets:
+  - topics: [ "^clicks-eu$" ]
+    policy: earliest
+  - topics: [ "^clicks-.*" ]
+    policy: local_earliest
+  - topics: [ "^audit$" ]
+    policy: timestamp:2024-01-01T00:00:00Z
+`, nil)
+	require.NoError(t, err)
+
+	rules, err := startOffsetRulesFromParsed(conf)
+	require.NoError(t, err)
+	s := newStartOffsets(rules, nil, nil, true, service.MockResources())
+
+	// The first policy which matches a topic wins.
+	p, ok := s.policyFor("clicks-eu")
+	require.True(t, ok)
+	assert.Equal(t, "earliest", p.name)
+	p, ok = s.policyFor("clicks-us")
+	require.True(t, ok)
+	assert.Equal(t, "local_earliest", p.name)
+	p, ok = s.policyFor("audit")
+	require.True(t, ok)
+	assert.Equal(t, "timestamp:2024-01-01T00:00:00Z", p.name)
+	_, ok = s.policyFor("orders")
+	assert.False(t, ok)
+
+	conf, err = redpandaMigratorInputConfig().ParseYAML(`
+seed_brokers: [ localhost:9092 ]
+topics: [ foo ]
+consumer_group: migrator
+start_offsets:
+  - topics: [ foo ]
+    policy: newest
+`, nil)
+	require.NoError(t, err)
+	_, err = startOffsetRulesFromParsed(conf)
+	require.ErrorContains(t, err, `unknown start offset policy "newest"`)
+}
+
+func TestStartOffsetsAdjust(t *testing.T) {
+	local, err := parseStartOffsetPolicy("local_earliest")
+	require.NoError(t, err)
+	ts, err := parseStartOffsetPolicy("timestamp:1000")
+	require.NoError(t, err)
+	clicks, err := newTopicMatcher([]string{"clicks"}, false)
+	require.NoError(t, err)
+	audit, err := newTopicMatcher([]string{"audit"}, false)
+	require.NoError(t, err)
+
+	var requests []map[int64]map[string][]int32
+	s := &startOffsets{
+		rules: []startOffsetRule{{topics: clicks, policy: local}, {topics: audit, policy: ts}},
+		listFn: func(_ context.Context, _ *kgo.Client, timestamp int64, topicPartitions map[string][]int32) (map[string]map[int32]int64, error) {
+			for _, partitions := range topicPartitions {
+				slices.Sort(partitions)
+			}
+			requests = append(requests, map[int64]map[string][]int32{timestamp: topicPartitions})
+			offsets := map[string]map[int32]int64{}
+			for topic, partitions := range topicPartitions {
+				offsets[topic] = map[int32]int64{}
+				for _, partition := range partitions {
+					switch timestamp {
+					case listOffsetsLocalEarliest:
+						offsets[topic][partition] = 500 + int64(partition)
+					default:
+						// Partitions without records after the timestamp are listed at their end.
+						offsets[topic][partition] = 900
+						if partition == 0 {
+							offsets[topic][partition] = 42
+						}
+					}
+				}
+			}
+			return offsets, nil
+		},
+		log: service.MockResources().Logger(),
+	}
+
+	offsets := map[string]map[int32]kgo.Offset{
+		"clicks": {0: kgo.NewOffset().AtStart(), 1: kgo.NewOffset().At(7)},
+		"audit":  {0: kgo.NewOffset().AtEnd(), 1: kgo.NewOffset().AtStart()},
+		"orders": {0: kgo.NewOffset().AtStart()},
+	}
+	adjusted, err := s.adjust(context.Background(), nil, offsets)
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []map[int64]map[string][]int32{
+		{listOffsetsLocalEarliest: {"clicks": {0}}},
+		{1000: {"audit": {0, 1}}},
+	}, requests)
+	assert.Equal(t, int64(500), adjusted["clicks"][0].EpochOffset().Offset)
+	assert.Equal(t, int64(7), adjusted["clicks"][1].EpochOffset().Offset, "committed offsets are kept")
+	assert.Equal(t, int64(42), adjusted["audit"][0].EpochOffset().Offset)
+	assert.Equal(t, int64(900), adjusted["audit"][1].EpochOffset().Offset, "partitions without later records start from their end")
+	assert.Equal(t, int64(-2), adjusted["orders"][0].EpochOffset().Offset, "topics without a policy are unchanged")
+	assert.Equal(t, int64(-2), offsets["clicks"][0].EpochOffset().Offset, "the offsets are copied")
+
+	// Nothing is listed when all partitions have offsets.
+	requests = nil
+	_, err = s.adjust(context.Background(), nil, map[string]map[int32]kgo.Offset{"clicks": {0: kgo.NewOffset().At(1)}})
+	require.NoError(t, err)
+	assert.Empty(t, requests)
+
+	batch := service.MessageBatch{service.NewMessage(nil), service.NewMessage(nil)}
+	batch[0].MetaSetMut("kafka_topic", "clicks")
+	batch[1].MetaSetMut("kafka_topic", "orders")
+	s.mark(batch)
+	v, ok := batch[0].MetaGet(startOffsetPolicyMetaKey)
+	assert.True(t, ok)
+	assert.Equal(t, "local_earliest", v)
+	_, ok = batch[1].MetaGet(startOffsetPolicyMetaKey)
+	assert.False(t, ok)
+}
+
+func TestStartOffsetsCapture(t *testing.T) {
+	latest, err := parseStartOffsetPolicy("latest")
+	require.NoError(t, err)
+	m, err := newTopicMatcher([]string{"foo"}, false)
+	require.NoError(t, err)
+
+	s := &startOffsets{
+		rules:      []startOffsetRule{{topics: m, policy: latest}},
+		partitions: map[string]map[int32]kgo.Offset{"foo": {0: kgo.NewOffset().AtStart()}, "bar": {0: kgo.NewOffset().AtStart()}},
+		listFn: func(context.Context, *kgo.Client, int64, map[string][]int32) (map[string]map[int32]int64, error) {
+			return map[string]map[int32]int64{"foo": {0: 10}}, nil
+		},
+		log: service.MockResources().Logger(),
+	}
+	defer s.close()
+	assert.Empty(t, s.consumeOpts())
+
+	require.NoError(t, s.capture(context.Background()))
+	assert.Len(t, s.consumeOpts(), 1)
+	assert.Equal(t, int64(10), s.resolved["foo"][0].EpochOffset().Offset)
+	assert.Equal(t, int64(-2), s.resolved["bar"][0].EpochOffset().Offset)
+}
+
+func TestStartOffsetsLocalEarliestFallback(t *testing.T) {
+	local, err := parseStartOffsetPolicy("local_earliest")
+	require.NoError(t, err)
+	m, err := newTopicMatcher([]string{"foo"}, false)
+	require.NoError(t, err)
+
+	offsets := map[string]map[int32]kgo.Offset{"foo": {0: kgo.NewOffset().AtStart(), 1: kgo.NewOffset().AtStart()}}
+	var timestamps []int64
+	s := &startOffsets{
+		rules: []startOffsetRule{{topics: m, policy: local}},
+		listFn: func(_ context.Context, _ *kgo.Client, timestamp int64, topicPartitions map[string][]int32) (map[string]map[int32]int64, error) {
+			timestamps = append(timestamps, timestamp)
+			if timestamp == listOffsetsEarliest {
+				// Only the partition whose local start offset couldn't be listed is listed again.
+				require.Equal(t, map[string][]int32{"foo": {1}}, topicPartitions)
+				return map[string]map[int32]int64{"foo": {1: 3}}, nil
+			}
+			// The broker of partition 1 doesn't support listing local start offsets.
+			return map[string]map[int32]int64{"foo": {0: 500, 1: -1}}, nil
+		},
+		log: service.MockResources().Logger(),
+	}
+	adjusted, err := s.adjust(context.Background(), nil, offsets)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{listOffsetsLocalEarliest, listOffsetsEarliest}, timestamps)
+	assert.Equal(t, int64(500), adjusted["foo"][0].EpochOffset().Offset)
+	assert.Equal(t, int64(3), adjusted["foo"][1].EpochOffset().Offset, "partitions fall back to their earliest offset rather than their end")
+
+	// Partitions which are missing from the listed offsets fail rather than keeping their default offset.
+	s.listFn = func(context.Context, *kgo.Client, int64, map[string][]int32) (map[string]map[int32]int64, error) {
+		return map[string]map[int32]int64{"foo": {0: 500}}, nil
+	}
+	_, err = s.adjust(context.Background(), nil, offsets)
+	require.ErrorContains(t, err, "partition 1 of topic foo is missing")
+}
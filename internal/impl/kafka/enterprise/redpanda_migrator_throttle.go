@@ -0,0 +1,150 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+// throttleWindow is the window over which the throttle time imposed by a broker is accumulated to detect sustained
+// throttling.
+const throttleWindow = time.Minute
+
+// brokerThrottleWindow accumulates the throttle time imposed by a broker within the current window.
+type brokerThrottleWindow struct {
+	start time.Time
+	total time.Duration
+}
+
+// producerThrottleMetrics is a franz-go hook which reports the throttling imposed by the brokers of the destination
+// cluster when the client exceeds its quotas, and the utilization of the producer buffer, so that throttling isn't
+// mistaken for network issues. It only observes the client and never changes how records are produced.
+type producerThrottleMetrics struct {
+	throttle    *service.MetricTimer
+	utilization *service.MetricGauge
+	log         *service.Logger
+
+	// The throttle time accumulated within a window above which throttling is considered sustained, zero disables the
+	// warning.
+	warnThreshold time.Duration
+	nowFn         func() time.Time
+
+	mu      sync.Mutex
+	windows map[int32]*brokerThrottleWindow
+	warned  bool
+
+	// The records and bytes in the producer buffer are counted by the hooks themselves, so that the utilization
+	// includes the record of the hook and the producer isn't locked to read its own counters.
+	records atomic.Int64
+	bytes   atomic.Int64
+	limits  atomic.Pointer[producerBufferLimits]
+}
+
+// producerBufferLimits are the limits of the producer buffer of the client.
+type producerBufferLimits struct {
+	maxRecords int64
+	maxBytes   int64
+}
+
+var (
+	_ kgo.HookBrokerThrottle          = (*producerThrottleMetrics)(nil)
+	_ kgo.HookProduceRecordBuffered   = (*producerThrottleMetrics)(nil)
+	_ kgo.HookProduceRecordUnbuffered = (*producerThrottleMetrics)(nil)
+)
+
+func newProducerThrottleMetrics(warnThreshold time.Duration, mgr *service.Resources) *producerThrottleMetrics {
+	return &producerThrottleMetrics{
+		throttle:      mgr.Metrics().NewTimer("kafka_broker_throttle_ns", "broker"),
+		utilization:   mgr.Metrics().NewGauge("kafka_producer_buffer_utilization"),
+		log:           mgr.Logger(),
+		warnThreshold: warnThreshold,
+		nowFn:         time.Now,
+		windows:       map[int32]*brokerThrottleWindow{},
+	}
+}
+
+// setClient sets the client whose producer buffer limits are reported, which is only known once it's created with the
+// hook.
+func (m *producerThrottleMetrics) setClient(client *kgo.Client) {
+	maxRecords, _ := client.OptValue(kgo.MaxBufferedRecords).(int64)
+	maxBytes, _ := client.OptValue(kgo.MaxBufferedBytes).(int64)
+	m.limits.Store(&producerBufferLimits{maxRecords: maxRecords, maxBytes: maxBytes})
+}
+
+func (m *producerThrottleMetrics) OnBrokerThrottle(meta kgo.BrokerMetadata, interval time.Duration, _ bool) {
+	broker := net.JoinHostPort(meta.Host, strconv.Itoa(int(meta.Port)))
+	m.throttle.Timing(interval.Nanoseconds(), broker)
+	if m.warnThreshold <= 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.warned {
+		return
+	}
+	now := m.nowFn()
+	w, exists := m.windows[meta.NodeID]
+	if !exists || now.Sub(w.start) >= throttleWindow {
+		w = &brokerThrottleWindow{start: now}
+		m.windows[meta.NodeID] = w
+	}
+	w.total += interval
+	if w.total > m.warnThreshold {
+		m.warned = true
+		m.log.Warnf("Broker %v throttled the producer for %v within %v, which exceeds the threshold of %v. The destination cluster is likely enforcing client quotas, which slows down the migration", broker, w.total, now.Sub(w.start).Round(time.Millisecond), m.warnThreshold)
+	}
+}
+
+func (m *producerThrottleMetrics) OnProduceRecordBuffered(r *kgo.Record) {
+	m.updateUtilization(m.records.Add(1), m.bytes.Add(bufferedRecordSize(r)))
+}
+
+func (m *producerThrottleMetrics) OnProduceRecordUnbuffered(r *kgo.Record, _ error) {
+	m.updateUtilization(m.records.Add(-1), m.bytes.Add(-bufferedRecordSize(r)))
+}
+
+// bufferedRecordSize returns the size of a record which counts towards the bytes limit of the producer buffer.
+func bufferedRecordSize(r *kgo.Record) int64 {
+	size := len(r.Key) + len(r.Value)
+	for _, h := range r.Headers {
+		size += len(h.Key) + len(h.Value)
+	}
+	return int64(size)
+}
+
+// updateUtilization sets the utilization gauge to the percentage of the producer buffer which is used, which is the
+// highest of the buffered records and bytes relative to their limits.
+func (m *producerThrottleMetrics) updateUtilization(records, bytes int64) {
+	l := m.limits.Load()
+	if l == nil {
+		return
+	}
+	m.utilization.Set(bufferUtilization(records, l.maxRecords, bytes, l.maxBytes))
+}
+
+// bufferUtilization returns the percentage of the producer buffer which is used, limits of zero are unbounded.
+func bufferUtilization(records, maxRecords, bytes, maxBytes int64) int64 {
+	var pct int64
+	if maxRecords > 0 {
+		pct = records * 100 / maxRecords
+	}
+	if maxBytes > 0 {
+		pct = max(pct, bytes*100/maxBytes)
+	}
+	return pct
+}
@@ -0,0 +1,89 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestProducerThrottleMetricsSustainedThrottling(t *testing.T) {
+	m := newProducerThrottleMetrics(time.Second, service.MockResources())
+	now := time.Unix(0, 0)
+	m.nowFn = func() time.Time { return now }
+
+	brokerA := kgo.BrokerMetadata{NodeID: 1, Host: "a", Port: 9092}
+	brokerB := kgo.BrokerMetadata{NodeID: 2, Host: "b", Port: 9092}
+
+	// Throttling is accumulated separately for each broker.
+	m.OnBrokerThrottle(brokerA, 600*time.Millisecond, true)
+	m.OnBrokerThrottle(brokerB, 600*time.Millisecond, true)
+	assert.False(t, m.warned)
+
+	// The throttle time of a previous window doesn't count.
+	now = now.Add(throttleWindow)
+	m.OnBrokerThrottle(brokerA, 600*time.Millisecond, true)
+	assert.False(t, m.warned)
+
+	now = now.Add(time.Second)
+	m.OnBrokerThrottle(brokerA, 600*time.Millisecond, true)
+	assert.True(t, m.warned)
+}
+
+func TestProducerThrottleMetricsDisabledWarning(t *testing.T) {
+	m := newProducerThrottleMetrics(0, service.MockResources())
+	m.OnBrokerThrottle(kgo.BrokerMetadata{NodeID: 1, Host: "a", Port: 9092}, time.Hour, true)
+	assert.False(t, m.warned)
+	assert.Empty(t, m.windows)
+}
+
+func TestProducerThrottleMetricsBufferUtilization(t *testing.T) {
+	assert.Equal(t, int64(0), bufferUtilization(0, 10000, 0, 0))
+	assert.Equal(t, int64(25), bufferUtilization(2500, 10000, 100, 0))
+	assert.Equal(t, int64(50), bufferUtilization(2500, 10000, 500, 1000))
+	assert.Equal(t, int64(100), bufferUtilization(10000, 10000, 0, 1000))
+
+	client, err := kgo.NewClient(kgo.SeedBrokers("localhost:0"), kgo.MaxBufferedRecords(500), kgo.MaxBufferedBytes(1000))
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+
+	res, exporter := newTestMetricsResources(t)
+	m := newProducerThrottleMetrics(time.Second, res)
+	// Records which are buffered before the client is known are counted, but the utilization isn't reported.
+	m.OnProduceRecordBuffered(&kgo.Record{Value: make([]byte, 100)})
+	_, ok := exporter.gauge("kafka_producer_buffer_utilization")
+	assert.False(t, ok)
+
+	m.setClient(client)
+	l := m.limits.Load()
+	require.NotNil(t, l)
+	assert.Equal(t, int64(500), l.maxRecords)
+	assert.Equal(t, int64(1000), l.maxBytes)
+
+	// The utilization includes the record of the hook.
+	m.OnProduceRecordBuffered(&kgo.Record{Key: make([]byte, 100), Value: make([]byte, 200), Headers: []kgo.RecordHeader{{Key: "a", Value: make([]byte, 99)}}})
+	utilization, _ := exporter.gauge("kafka_producer_buffer_utilization")
+	assert.Equal(t, int64(50), utilization)
+	m.OnProduceRecordUnbuffered(&kgo.Record{Value: make([]byte, 100)}, nil)
+	utilization, _ = exporter.gauge("kafka_producer_buffer_utilization")
+	assert.Equal(t, int64(40), utilization)
+}
+
+func TestProducerThrottleMetricsThrottleTime(t *testing.T) {
+	res, exporter := newTestMetricsResources(t)
+	m := newProducerThrottleMetrics(0, res)
+	m.OnBrokerThrottle(kgo.BrokerMetadata{NodeID: 1, Host: "a", Port: 9092}, 250*time.Millisecond, true)
+	// Timers are reported in nanoseconds.
+	assert.Equal(t, []int64{int64(250 * time.Millisecond)}, exporter.timing("kafka_broker_throttle_ns,a:9092"))
+}
@@ -0,0 +1,403 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/asyncroutine"
+	"github.com/redpanda-data/connect/v4/internal/impl/kafka"
+)
+
+// deletedTopicRefreshes is the number of consecutive refreshes in which a topic must be missing from the source cluster
+// before it's considered deleted, so that a topic which is briefly missing from the metadata isn't deleted.
+const deletedTopicRefreshes = 2
+
+// Values of the action label of the redpanda_migrator_topic_deletions metric.
+const (
+	topicDeletionActionDeleted = "deleted"
+	topicDeletionActionDryRun  = "dry_run"
+)
+
+// topicDeletionsKey is the key under which the topic deletions of a redpanda_migrator input are stored in the
+// resources.
+type topicDeletionsKey string
+
+// topicDeletionHandler handles the deletion of a source topic. Topics for which it returns an error are delivered again
+// after the next refresh.
+type topicDeletionHandler func(ctx context.Context, topic string) error
+
+// topicDeletions delivers the source topics which a redpanda_migrator input detected as deleted to the
+// redpanda_migrator outputs which mirror the deletions. It's shared through the resources under the label of the
+// input, since the input and the outputs can be constructed in any order.
+type topicDeletions struct {
+	mu       sync.Mutex
+	handlers []topicDeletionHandler
+}
+
+func topicDeletionsFor(inputLabel string, mgr *service.Resources) *topicDeletions {
+	actual, _ := mgr.GetOrSetGeneric(topicDeletionsKey(inputLabel), &topicDeletions{})
+	return actual.(*topicDeletions)
+}
+
+func (d *topicDeletions) subscribe(fn topicDeletionHandler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handlers = append(d.handlers, fn)
+}
+
+// subscribed returns true when any output mirrors the deletions, otherwise the input doesn't need to detect them.
+func (d *topicDeletions) subscribed() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.handlers) > 0
+}
+
+// publish delivers the deletion of topic to every subscribed output and returns their errors.
+func (d *topicDeletions) publish(ctx context.Context, topic string) error {
+	d.mu.Lock()
+	handlers := slices.Clone(d.handlers)
+	d.mu.Unlock()
+
+	var errs []error
+	for _, fn := range handlers {
+		if err := fn(ctx, topic); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+//------------------------------------------------------------------------------
+
+// deletedTopicDetector lists the topics of the source cluster at every metadata refresh of a redpanda_migrator input and
+// publishes the topics which are consumed by the input, disappeared from the source cluster and which the source
+// cluster reports as unknown.
+type deletedTopicDetector struct {
+	clientLabel string
+	consumed    *consumedPartitions
+	deletions   *topicDeletions
+
+	mu sync.Mutex
+	// The number of consecutive refreshes in which each topic which was consumed by the input was missing.
+	missing map[string]int
+	// The deleted topics which failed to be delivered and are delivered again after the next refresh.
+	pending map[string]struct{}
+
+	// The input may be closed while it connects, so the refresh loop is started and stopped under its own lock.
+	loopMu      sync.Mutex
+	refreshLoop *asyncroutine.Periodic
+
+	mgr *service.Resources
+}
+
+func newDeletedTopicDetector(interval time.Duration, clientLabel string, consumed *consumedPartitions, mgr *service.Resources) *deletedTopicDetector {
+	d := &deletedTopicDetector{
+		clientLabel: clientLabel,
+		consumed:    consumed,
+		deletions:   topicDeletionsFor(clientLabel, mgr),
+		missing:     map[string]int{},
+		pending:     map[string]struct{}{},
+		mgr:         mgr,
+	}
+	d.refreshLoop = asyncroutine.NewPeriodicWithContext(interval, d.refresh)
+	return d
+}
+
+// start detects deleted topics in the background until stop is called.
+func (d *deletedTopicDetector) start() {
+	d.loopMu.Lock()
+	defer d.loopMu.Unlock()
+	d.refreshLoop.Start()
+}
+
+func (d *deletedTopicDetector) stop() {
+	d.loopMu.Lock()
+	defer d.loopMu.Unlock()
+	d.refreshLoop.Stop()
+}
+
+// refresh lists the topics of the source cluster and publishes the deleted topics. Nothing is listed unless an output
+// mirrors the deletions.
+func (d *deletedTopicDetector) refresh(ctx context.Context) {
+	if !d.deletions.subscribed() {
+		return
+	}
+
+	var topics kadm.TopicDetails
+	err := kafka.FranzSharedClientUse(d.clientLabel, d.mgr, func(details *kafka.FranzSharedClientInfo) error {
+		var err error
+		topics, err = kadm.NewClient(details.Client).ListTopics(ctx)
+		return err
+	})
+	if err != nil {
+		// A refresh which failed doesn't count towards the refreshes in which topics are missing.
+		d.mgr.Logger().Debugf("Failed to list the topics of the source cluster for detecting deleted topics: %s", err)
+		return
+	}
+
+	listed := make([]string, 0, len(topics))
+	for topic, detail := range topics {
+		if !errors.Is(detail.Err, kerr.UnknownTopicOrPartition) {
+			listed = append(listed, topic)
+		}
+	}
+	if candidates := d.observe(listed); len(candidates) > 0 {
+		// A topic can be missing from the listed topics for other reasons than being deleted, such as the permission to
+		// describe it being revoked, so it's only deleted once the source cluster reports it as unknown.
+		var described kadm.TopicDetails
+		err := kafka.FranzSharedClientUse(d.clientLabel, d.mgr, func(details *kafka.FranzSharedClientInfo) error {
+			// Metadata requests of kadm don't create the requested topics.
+			md, err := kadm.NewClient(details.Client).Metadata(ctx, candidates...)
+			described = md.Topics
+			return err
+		})
+		if err != nil {
+			d.mgr.Logger().Debugf("Failed to describe the topics missing from the source cluster for detecting deleted topics: %s", err)
+		}
+		deleted := confirmDeletedTopics(candidates, described)
+		d.confirm(candidates, deleted)
+		for _, topic := range deleted {
+			d.mgr.Logger().Infof("Topic %q was deleted from the source cluster", topic)
+		}
+	}
+
+	for _, topic := range d.takePending() {
+		if err := d.deletions.publish(ctx, topic); err != nil {
+			d.mgr.Logger().Errorf("Failed to mirror the deletion of topic %q, retrying after the next refresh: %s", topic, err)
+			d.mu.Lock()
+			d.pending[topic] = struct{}{}
+			d.mu.Unlock()
+		}
+	}
+}
+
+// observe updates the consumed topics with the topics which are currently listed by the source cluster and returns
+// the topics which were missing for deletedTopicRefreshes consecutive refreshes, which are the candidates for being
+// deleted until they're confirmed.
+func (d *deletedTopicDetector) observe(listed []string) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	present := make(map[string]struct{}, len(listed))
+	for _, topic := range listed {
+		present[topic] = struct{}{}
+		if d.consumed.consumesTopic(topic) {
+			// A topic which reappears is no longer missing.
+			d.missing[topic] = 0
+		}
+	}
+
+	var candidates []string
+	for topic, refreshes := range d.missing {
+		if _, ok := present[topic]; ok {
+			continue
+		}
+		if refreshes+1 < deletedTopicRefreshes {
+			d.missing[topic] = refreshes + 1
+			continue
+		}
+		candidates = append(candidates, topic)
+	}
+	slices.Sort(candidates)
+	return candidates
+}
+
+// confirm adds the deleted candidates to the pending deletions and starts over with the candidates which weren't
+// confirmed as deleted.
+func (d *deletedTopicDetector) confirm(candidates, deleted []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, topic := range candidates {
+		if slices.Contains(deleted, topic) {
+			delete(d.missing, topic)
+			d.pending[topic] = struct{}{}
+		} else {
+			d.missing[topic] = 0
+		}
+	}
+}
+
+// confirmDeletedTopics returns the candidates which the source cluster described as unknown. Candidates which failed to
+// be described for any other reason, such as not being authorized, or which weren't described at all, aren't deleted.
+func confirmDeletedTopics(candidates []string, described kadm.TopicDetails) []string {
+	var deleted []string
+	for _, topic := range candidates {
+		if detail, ok := described[topic]; ok && errors.Is(detail.Err, kerr.UnknownTopicOrPartition) {
+			deleted = append(deleted, topic)
+		}
+	}
+	return deleted
+}
+
+func (d *deletedTopicDetector) takePending() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	topics := make([]string, 0, len(d.pending))
+	for topic := range d.pending {
+		topics = append(topics, topic)
+	}
+	clear(d.pending)
+	slices.Sort(topics)
+	return topics
+}
+
+//------------------------------------------------------------------------------
+
+// createdTopics persists the destination topics which were created by a redpanda_migrator output in a cache resource,
+// since only those are deleted when their source topic is deleted. Topics which already existed in the destination
+// cluster are never stored.
+type createdTopics struct {
+	cache string
+	mgr   *service.Resources
+}
+
+func createdTopicKey(destTopic string) string {
+	return "created_topic/" + destTopic
+}
+
+func (c *createdTopics) store(ctx context.Context, destTopic string) error {
+	var cacheErr error
+	if err := c.mgr.AccessCache(ctx, c.cache, func(cache service.Cache) {
+		cacheErr = cache.Set(ctx, createdTopicKey(destTopic), []byte("true"), nil)
+	}); err != nil {
+		return fmt.Errorf("failed to access created topics cache: %s", err)
+	}
+	return cacheErr
+}
+
+func (c *createdTopics) contains(ctx context.Context, destTopic string) (bool, error) {
+	var created bool
+	var cacheErr error
+	if err := c.mgr.AccessCache(ctx, c.cache, func(cache service.Cache) {
+		_, cacheErr = cache.Get(ctx, createdTopicKey(destTopic))
+		if errors.Is(cacheErr, service.ErrKeyNotFound) {
+			cacheErr = nil
+			return
+		}
+		created = cacheErr == nil
+	}); err != nil {
+		return false, fmt.Errorf("failed to access created topics cache: %s", err)
+	}
+	return created, cacheErr
+}
+
+func (c *createdTopics) remove(ctx context.Context, destTopic string) error {
+	var cacheErr error
+	if err := c.mgr.AccessCache(ctx, c.cache, func(cache service.Cache) {
+		cacheErr = cache.Delete(ctx, createdTopicKey(destTopic))
+	}); err != nil {
+		return fmt.Errorf("failed to access created topics cache: %s", err)
+	}
+	if errors.Is(cacheErr, service.ErrKeyNotFound) {
+		return nil
+	}
+	return cacheErr
+}
+
+// recordCreatedTopic stores destTopic in the created topics cache when it's set. Failing to store it is only logged,
+// since the topic is then never deleted, which is the safe outcome.
+func (w *redpandaMigratorWriter) recordCreatedTopic(ctx context.Context, destTopic string) {
+	if w.createdTopics == nil {
+		return
+	}
+	if err := w.createdTopics.store(ctx, destTopic); err != nil {
+		w.mgr.Logger().Errorf("Failed to store topic %q in the created topics cache, it won't be deleted when its source topic is deleted: %s", destTopic, err)
+	}
+}
+
+// topicCreatedByMigrator returns true if the destination topic of topic was created by the output, either since it
+// connected or by a previous run according to the created topics cache.
+func (w *redpandaMigratorWriter) topicCreatedByMigrator(ctx context.Context, topic, destTopic string) (bool, error) {
+	if v, ok := w.topicCache.Load(topic); ok {
+		if created, _ := v.(bool); created {
+			return true, nil
+		}
+	}
+	if w.createdTopics == nil {
+		return false, nil
+	}
+	return w.createdTopics.contains(ctx, destTopic)
+}
+
+// mirrorTopicDeletion deletes the destination topic of a source topic which was deleted, but only when it was created
+// by the migrator. The deletion is only logged when mirror_deletions_dry_run is set.
+func (w *redpandaMigratorWriter) mirrorTopicDeletion(ctx context.Context, topic string) error {
+	if isExcludedTopic(w.inputResource, topic, w.mgr) {
+		return nil
+	}
+
+	destTopic := w.topicPrefix + topic
+	created, err := w.topicCreatedByMigrator(ctx, topic, destTopic)
+	if err != nil {
+		return fmt.Errorf("failed to check whether topic %q was created by the migrator: %w", destTopic, err)
+	}
+	if !created {
+		w.mgr.Logger().Infof("Not deleting topic %q of deleted source topic %q because it wasn't created by the migrator", destTopic, topic)
+		return nil
+	}
+
+	if w.mirrorDeletionsDryRun {
+		w.mgr.Logger().Warnf("Dry run: topic %q would be deleted because source topic %q was deleted", destTopic, topic)
+		w.topicDeletionsMetric.Incr(1, destTopic, topicDeletionActionDryRun)
+		return nil
+	}
+
+	w.clientMut.Lock()
+	outputClient := w.client
+	w.clientMut.Unlock()
+	if outputClient == nil {
+		return fmt.Errorf("failed to delete topic %q: %w", destTopic, service.ErrNotConnected)
+	}
+	if outputClient, err = w.destinationClient(destTopic, outputClient); err != nil {
+		return err
+	}
+
+	if err := w.retryBrokerOperation(ctx, fmt.Sprintf("delete topic %q", destTopic), func() error {
+		return w.adminOps.do(ctx, adminOpDeleteTopic, func() error {
+			return deleteTopic(ctx, destTopic, outputClient)
+		})
+	}); err != nil {
+		return fmt.Errorf("failed to delete topic %q: %w", destTopic, err)
+	}
+	w.mgr.Logger().Warnf("Deleted topic %q because source topic %q was deleted", destTopic, topic)
+	w.topicDeletionsMetric.Incr(1, destTopic, topicDeletionActionDeleted)
+
+	// The topic is created again if the source topic is recreated.
+	w.topicCache.Delete(topic)
+	w.timestampTypes.Delete(topic)
+	w.recordSizeLimits.Delete(destTopic)
+	if w.createdTopics != nil {
+		if err := w.createdTopics.remove(ctx, destTopic); err != nil {
+			w.mgr.Logger().Warnf("Failed to remove deleted topic %q from the created topics cache: %s", destTopic, err)
+		}
+	}
+	return nil
+}
+
+// deleteTopic deletes topic, which succeeds when the topic doesn't exist.
+func deleteTopic(ctx context.Context, topic string, client *kgo.Client) error {
+	if _, err := kadm.NewClient(client).DeleteTopic(ctx, topic); err != nil && !errors.Is(err, kerr.UnknownTopicOrPartition) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/kafka"
+)
+
+func TestDeletedTopicDetectorObserve(t *testing.T) {
+	excluded, err := newTopicMatcher([]string{"foo-dlq"}, false)
+	require.NoError(t, err)
+	consumed, err := newConsumedPartitions(&kafka.FranzConsumerDetails{
+		Topics:       []string{"foo.*"},
+		RegexPattern: true,
+	}, excluded)
+	require.NoError(t, err)
+
+	d := newDeletedTopicDetector(time.Minute, "input", consumed, service.MockResources())
+
+	assert.Empty(t, d.observe([]string{"foo", "foo-events", "foo-dlq", "bar"}))
+
+	// A topic must be missing from two consecutive refreshes, and topics which aren't consumed are ignored.
+	assert.Empty(t, d.observe([]string{"foo"}))
+	assert.Equal(t, []string{"foo-events"}, d.observe([]string{"foo"}))
+	d.confirm([]string{"foo-events"}, []string{"foo-events"})
+	assert.Empty(t, d.observe([]string{"foo"}))
+
+	// A topic which reappears starts over.
+	assert.Empty(t, d.observe(nil))
+	assert.Empty(t, d.observe([]string{"foo"}))
+	assert.Empty(t, d.observe(nil))
+	assert.Equal(t, []string{"foo"}, d.observe(nil))
+
+	// A candidate which isn't confirmed as deleted starts over too.
+	d.confirm([]string{"foo"}, nil)
+	assert.Equal(t, []string{"foo-events"}, d.takePending())
+	assert.Empty(t, d.observe(nil))
+	assert.Equal(t, []string{"foo"}, d.observe(nil))
+	d.confirm([]string{"foo"}, []string{"foo"})
+
+	assert.Equal(t, []string{"foo"}, d.takePending())
+	assert.Empty(t, d.takePending())
+	assert.Empty(t, d.observe(nil))
+}
+
+func TestConfirmDeletedTopics(t *testing.T) {
+	described := kadm.TopicDetails{
+		"deleted":      {Topic: "deleted", Err: kerr.UnknownTopicOrPartition},
+		"unauthorized": {Topic: "unauthorized", Err: kerr.TopicAuthorizationFailed},
+		"failed":       {Topic: "failed", Err: kerr.LeaderNotAvailable},
+		"present":      {Topic: "present"},
+	}
+	candidates := []string{"deleted", "unauthorized", "failed", "present", "undescribed"}
+	assert.Equal(t, []string{"deleted"}, confirmDeletedTopics(candidates, described))
+	assert.Empty(t, confirmDeletedTopics(candidates, nil))
+}
+
+func TestTopicDeletionsPublish(t *testing.T) {
+	res := service.MockResources()
+	deletions := topicDeletionsFor("input", res)
+	assert.False(t, deletions.subscribed())
+
+	var deleted []string
+	topicDeletionsFor("input", res).subscribe(func(_ context.Context, topic string) error {
+		deleted = append(deleted, topic)
+		return nil
+	})
+	topicDeletionsFor("input", res).subscribe(func(context.Context, string) error {
+		return errors.New("nope")
+	})
+	assert.True(t, deletions.subscribed())
+	assert.False(t, topicDeletionsFor("other", res).subscribed())
+
+	require.ErrorContains(t, deletions.publish(context.Background(), "foo"), "nope")
+	assert.Equal(t, []string{"foo"}, deleted)
+}
+
+func TestMirrorTopicDeletion(t *testing.T) {
+	ctx := context.Background()
+	res := service.MockResources(service.MockResourcesOptAddCache("created"))
+
+	excluded, err := newTopicMatcher([]string{"foo-dlq"}, false)
+	require.NoError(t, err)
+	res.SetGeneric(excludedTopicsKey("input"), excluded)
+
+	newWriter := func(dryRun bool) *redpandaMigratorWriter {
+		return &redpandaMigratorWriter{
+			inputResource:         "input",
+			topicPrefix:           "dest.",
+			createdTopics:         &createdTopics{cache: "created", mgr: res},
+			mirrorDeletionsDryRun: dryRun,
+			topicDeletionsMetric:  res.Metrics().NewCounter("redpanda_migrator_topic_deletions", "topic", "action"),
+			mgr:                   res,
+		}
+	}
+
+	// Topics which weren't created by the migrator are never deleted.
+	w := newWriter(false)
+	w.topicCache.Store("foo", false)
+	require.NoError(t, w.mirrorTopicDeletion(ctx, "foo"))
+	require.NoError(t, w.mirrorTopicDeletion(ctx, "bar"))
+
+	// Neither are excluded topics.
+	require.NoError(t, w.createdTopics.store(ctx, "dest.foo-dlq"))
+	require.NoError(t, w.mirrorTopicDeletion(ctx, "foo-dlq"))
+
+	// Topics created by a previous run are known from the cache.
+	require.NoError(t, w.createdTopics.store(ctx, "dest.foo"))
+	created, err := w.topicCreatedByMigrator(ctx, "foo", "dest.foo")
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	// A dry run doesn't need a client and doesn't delete the topic.
+	require.NoError(t, newWriter(true).mirrorTopicDeletion(ctx, "foo"))
+	created, err = w.createdTopics.contains(ctx, "dest.foo")
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	// Topics created since the output connected are known from the topic cache.
+	w.topicCache.Store("baz", true)
+	created, err = w.topicCreatedByMigrator(ctx, "baz", "dest.baz")
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	require.ErrorIs(t, w.mirrorTopicDeletion(ctx, "foo"), service.ErrNotConnected)
+}
+
+func TestCreatedTopics(t *testing.T) {
+	ctx := context.Background()
+	res := service.MockResources(service.MockResourcesOptAddCache("created"))
+	c := &createdTopics{cache: "created", mgr: res}
+
+	created, err := c.contains(ctx, "foo")
+	require.NoError(t, err)
+	assert.False(t, created)
+
+	require.NoError(t, c.store(ctx, "foo"))
+	created, err = c.contains(ctx, "foo")
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	require.NoError(t, c.remove(ctx, "foo"))
+	require.NoError(t, c.remove(ctx, "foo"))
+	created, err = c.contains(ctx, "foo")
+	require.NoError(t, err)
+	assert.False(t, created)
+
+	_, err = (&createdTopics{cache: "missing", mgr: res}).contains(ctx, "foo")
+	require.ErrorContains(t, err, "failed to access created topics cache")
+}
+
+func TestRedpandaMigratorOutputMirrorDeletionsLinting(t *testing.T) {
+	configTests := []struct {
+		name        string
+		config      string
+		errContains string
+	}{
+		{
+			name: "mirror deletions with created topics cache",
+			config: `
+redpanda_migrator:
+  seed_brokers: [ localhost:9092 ]
+  topic: ${! @kafka_topic }
+  mirror_deletions: true
+  created_topics_cache: created
+`,
+		},
+		{
+			name: "mirror deletions without created topics cache",
+			config: `
+redpanda_migrator:
+  seed_brokers: [ localhost:9092 ]
+  topic: ${! @kafka_topic }
+  mirror_deletions: true
+`,
+			errContains: "created_topics_cache must be set when mirror_deletions or mirror_deletions_dry_run is enabled",
+		},
+		{
+			name: "dry run without created topics cache",
+			config: `
+redpanda_migrator:
+  seed_brokers: [ localhost:9092 ]
+  topic: ${! @kafka_topic }
+  mirror_deletions_dry_run: true
+`,
+			errContains: "created_topics_cache must be set when mirror_deletions or mirror_deletions_dry_run is enabled",
+		},
+	}
+
+	env := service.NewEnvironment()
+	for _, test := range configTests {
+		t.Run(test.name, func(t *testing.T) {
+			strm := env.NewStreamBuilder()
+			err := strm.AddOutputYAML(test.config)
+			if test.errContains == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.errContains)
+			}
+		})
+	}
+}
@@ -0,0 +1,334 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Jeffail/shutdown"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/kafka"
+)
+
+// maxReconcileBackoffFactor caps the wait between reconcile cycles which keep failing at this many intervals.
+const maxReconcileBackoffFactor = 10
+
+// topicConfigReconciler periodically compares the configs of the migrated topics in the output cluster with the
+// configs of the topics in the input cluster and, when enforce is set, alters the configs which differ.
+type topicConfigReconciler struct {
+	interval time.Duration
+	enforce  bool
+
+	startOnce sync.Once
+	shutSig   *shutdown.Signaller
+
+	configDrift    *service.MetricGauge
+	partitionDrift *service.MetricGauge
+	altered        *service.MetricCounter
+}
+
+func newTopicConfigReconciler(interval time.Duration, enforce bool, metrics *service.Metrics) *topicConfigReconciler {
+	return &topicConfigReconciler{
+		interval:       interval,
+		enforce:        enforce,
+		shutSig:        shutdown.NewSignaller(),
+		configDrift:    metrics.NewGauge("redpanda_migrator_topic_config_drift", "topic"),
+		partitionDrift: metrics.NewGauge("redpanda_migrator_topic_partition_drift", "topic"),
+		altered:        metrics.NewCounter("redpanda_migrator_topic_configs_altered"),
+	}
+}
+
+// start runs reconcileFn in the background until stop is called, waiting for the interval between cycles and backing
+// off while cycles fail. Subsequent calls and calls after stop do nothing.
+func (r *topicConfigReconciler) start(reconcileFn func(ctx context.Context) topicReconcileResult, log *service.Logger) {
+	if r == nil {
+		return
+	}
+
+	r.startOnce.Do(func() {
+		go func() {
+			defer r.shutSig.TriggerHasStopped()
+
+			ctx, done := r.shutSig.SoftStopCtx(context.Background())
+			defer done()
+
+			wait := r.interval
+			for {
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return
+				}
+
+				res := reconcileFn(ctx)
+				if ctx.Err() != nil {
+					return
+				}
+
+				wait = nextReconcileWait(wait, r.interval, res.failedTopics > 0)
+				log.Infof(
+					"Reconciled configs of %d topics: %d configs drifted, %d altered, %d topics failed",
+					res.topics, res.drifted, res.altered, res.failedTopics,
+				)
+				if res.failedTopics > 0 {
+					log.Warnf("Failed to reconcile the configs of %d topics, reconciling again in %s", res.failedTopics, wait)
+				}
+			}
+		}()
+	})
+}
+
+// nextReconcileWait returns the wait before the next cycle, which is doubled after each failed cycle up to
+// maxReconcileBackoffFactor intervals and reset to the interval after a successful one.
+func nextReconcileWait(wait, interval time.Duration, failed bool) time.Duration {
+	if !failed {
+		return interval
+	}
+	return min(2*wait, maxReconcileBackoffFactor*interval)
+}
+
+// stop stops the background loop and waits for it to exit.
+func (r *topicConfigReconciler) stop(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+
+	// The loop is never started once the reconciler is stopped.
+	r.startOnce.Do(r.shutSig.TriggerHasStopped)
+	r.shutSig.TriggerSoftStop()
+
+	select {
+	case <-r.shutSig.HasStoppedChan():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// topicReconcileResult counts the configs which differed in a reconcile cycle.
+type topicReconcileResult struct {
+	topics       int
+	failedTopics int
+	drifted      int
+	altered      int
+}
+
+// reconcileTopics compares the configs of all the topics which were migrated so far. Failing to reconcile a topic is
+// logged and doesn't prevent the other topics from being reconciled.
+func (w *redpandaMigratorWriter) reconcileTopics(ctx context.Context) topicReconcileResult {
+	var res topicReconcileResult
+
+	w.clientMut.Lock()
+	outputClient := w.client
+	w.clientMut.Unlock()
+	if outputClient == nil {
+		w.mgr.Logger().Debug("Skipping topic config reconciliation because the output is not connected")
+		return res
+	}
+
+	var topics []string
+	w.topicCache.Range(func(key, _ any) bool {
+		topics = append(topics, key.(string))
+		return true
+	})
+	slices.Sort(topics)
+
+	for _, topic := range topics {
+		if ctx.Err() != nil {
+			break
+		}
+		if isExcludedTopic(w.inputResource, topic, w.mgr) {
+			continue
+		}
+
+		destTopic := w.topicPrefix + topic
+		res.topics++
+		var state topicReconcileState
+		// The shared client is accessed for each topic, so that the input isn't blocked from reconnecting for a whole
+		// cycle.
+		err := kafka.FranzSharedClientUse(w.inputResource, w.mgr, func(details *kafka.FranzSharedClientInfo) error {
+			var err error
+			state, err = fetchTopicReconcileState(ctx, topic, destTopic, details.Client, outputClient)
+			return err
+		})
+		if errors.Is(err, kafka.ErrClientClosing) {
+			// The input is closing, so the remaining topics are reconciled once the pipeline restarts.
+			w.mgr.Logger().Debugf("Input %q is closing, stopping the topic config reconciliation", w.inputResource)
+			break
+		}
+		if err != nil {
+			res.failedTopics++
+			w.mgr.Logger().Warnf("Failed to fetch the configs of topic %q: %s", destTopic, err)
+			continue
+		}
+
+		desired := destinationTopicConfigs(state.sourceConfigs, w.preserveTimestampType)
+		maps.Copy(desired, w.topicConfigOverrides)
+		if w.replicationFactorOverride {
+			delete(desired, "replication.factor")
+		}
+		drifts := diffTopicConfigs(desired, state.destConfigs)
+		res.drifted += len(drifts)
+		w.topicReconciler.configDrift.Set(int64(len(drifts)), destTopic)
+
+		partitionDrift := max(state.sourcePartitions-state.destPartitions, 0)
+		w.topicReconciler.partitionDrift.Set(int64(partitionDrift), destTopic)
+		if partitionDrift > 0 {
+			w.mgr.Logger().Warnf(
+				"Topic %q has %d partitions in the source cluster but only %d in the destination cluster, records of the additional partitions can't be written to their source partition until partitions are added to the destination topic",
+				destTopic, state.sourcePartitions, state.destPartitions,
+			)
+		}
+
+		if len(drifts) == 0 {
+			continue
+		}
+		for _, d := range drifts {
+			w.mgr.Logger().Warnf("Config %q of topic %q is %q in the destination cluster but %q in the source cluster", d.key, destTopic, d.destination, d.source)
+		}
+		if !w.topicReconciler.enforce {
+			continue
+		}
+
+		if err := alterTopicConfigs(ctx, destTopic, drifts, outputClient); err != nil {
+			res.failedTopics++
+			w.mgr.Logger().Warnf("Failed to alter the configs of topic %q: %s", destTopic, err)
+			continue
+		}
+		res.altered += len(drifts)
+		w.topicReconciler.altered.Incr(int64(len(drifts)))
+		w.topicReconciler.configDrift.Set(0, destTopic)
+		w.mgr.Logger().Infof("Altered %d configs of topic %q to match the source cluster", len(drifts), destTopic)
+	}
+
+	return res
+}
+
+// topicReconcileState holds the partition counts and configs of a topic in both clusters.
+type topicReconcileState struct {
+	sourcePartitions int
+	destPartitions   int
+	sourceConfigs    []kadm.Config
+	destConfigs      []kadm.Config
+}
+
+// fetchTopicReconcileState fetches the partition counts and configs of topic from the input cluster and of destTopic
+// from the output cluster.
+func fetchTopicReconcileState(ctx context.Context, topic, destTopic string, inputClient, outputClient *kgo.Client) (state topicReconcileState, err error) {
+	if state.sourcePartitions, state.sourceConfigs, err = describeTopic(ctx, kadm.NewClient(inputClient), topic); err != nil {
+		return state, fmt.Errorf("source cluster: %w", err)
+	}
+	if state.destPartitions, state.destConfigs, err = describeTopic(ctx, kadm.NewClient(outputClient), destTopic); err != nil {
+		return state, fmt.Errorf("destination cluster: %w", err)
+	}
+	return state, nil
+}
+
+// describeTopic returns the partition count and configs of topic.
+func describeTopic(ctx context.Context, adminClient *kadm.Client, topic string) (int, []kadm.Config, error) {
+	topics, err := adminClient.ListTopics(ctx, topic)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to fetch topic %q: %w", topic, err)
+	}
+	if !topics.Has(topic) {
+		return 0, nil, fmt.Errorf("topic %q doesn't exist", topic)
+	}
+	if err := topics[topic].Err; err != nil {
+		return 0, nil, fmt.Errorf("failed to fetch topic %q: %w", topic, err)
+	}
+
+	topicConfigs, err := adminClient.DescribeTopicConfigs(ctx, topic)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to fetch configs for topic %q: %w", topic, err)
+	}
+	rc, err := topicConfigs.On(topic, nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to fetch configs for topic %q: %w", topic, err)
+	}
+	if rc.Err != nil {
+		return 0, nil, fmt.Errorf("failed to fetch configs for topic %q: %w", topic, rc.Err)
+	}
+
+	return len(topics[topic].Partitions), rc.Configs, nil
+}
+
+// topicConfigDrift is a config of a destination topic which differs from the desired value.
+type topicConfigDrift struct {
+	key         string
+	source      string
+	destination string
+}
+
+// diffTopicConfigs returns the desired configs which differ from the existing ones, sorted by key. Desired configs
+// without a value, such as sensitive ones, and configs which the destination cluster doesn't support are skipped,
+// since they can't be converged.
+func diffTopicConfigs(desired map[string]*string, existing []kadm.Config) []topicConfigDrift {
+	existingValues := make(map[string]*string, len(existing))
+	for _, c := range existing {
+		existingValues[c.Key] = c.Value
+	}
+
+	var drifts []topicConfigDrift
+	for key, value := range desired {
+		if value == nil {
+			continue
+		}
+		existingValue, ok := existingValues[key]
+		if !ok {
+			continue
+		}
+		if existingValue == nil || *existingValue != *value {
+			drift := topicConfigDrift{key: key, source: *value}
+			if existingValue != nil {
+				drift.destination = *existingValue
+			}
+			drifts = append(drifts, drift)
+		}
+	}
+
+	slices.SortFunc(drifts, func(a, b topicConfigDrift) int {
+		return strings.Compare(a.key, b.key)
+	})
+	return drifts
+}
+
+// alterTopicConfigs sets the drifted configs of destTopic to their source values.
+func alterTopicConfigs(ctx context.Context, destTopic string, drifts []topicConfigDrift, outputClient *kgo.Client) error {
+	alterConfigs := make([]kadm.AlterConfig, 0, len(drifts))
+	for _, d := range drifts {
+		alterConfigs = append(alterConfigs, kadm.AlterConfig{Op: kadm.SetConfig, Name: d.key, Value: kadm.StringPtr(d.source)})
+	}
+
+	resps, err := kadm.NewClient(outputClient).AlterTopicConfigs(ctx, alterConfigs, destTopic)
+	if err != nil {
+		return err
+	}
+	resp, err := resps.On(destTopic, nil)
+	if err != nil {
+		return err
+	}
+	if resp.Err != nil {
+		if resp.ErrMessage != "" {
+			return fmt.Errorf("%w: %s", resp.Err, resp.ErrMessage)
+		}
+		return resp.Err
+	}
+	return nil
+}
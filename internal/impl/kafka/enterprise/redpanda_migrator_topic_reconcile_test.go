@@ -0,0 +1,159 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kadm"
+)
+
+func TestDiffTopicConfigs(t *testing.T) {
+	source := []kadm.Config{
+		{Key: "retention.ms", Value: kadm.StringPtr("604800000")},
+		{Key: "cleanup.policy", Value: kadm.StringPtr("compact")},
+		{Key: "message.timestamp.type", Value: kadm.StringPtr("LogAppendTime")},
+		{Key: "segment.bytes", Value: kadm.StringPtr("1073741824")},
+		{Key: "redpanda.iceberg.mode", Value: kadm.StringPtr("key_value")},
+		{Key: "flush.ms"},
+		{Key: "min.insync.replicas", Value: kadm.StringPtr("2")},
+	}
+	dest := []kadm.Config{
+		{Key: "retention.ms", Value: kadm.StringPtr("86400000")},
+		{Key: "cleanup.policy", Value: kadm.StringPtr("compact")},
+		{Key: "message.timestamp.type", Value: kadm.StringPtr("CreateTime")},
+		{Key: "segment.bytes"},
+		{Key: "flush.ms", Value: kadm.StringPtr("1000")},
+		{Key: "min.insync.replicas", Value: kadm.StringPtr("1")},
+	}
+
+	// Only the copied configs are compared, configs which the destination doesn't support or which don't have a
+	// source value are skipped and LogAppendTime is expected to be converted.
+	assert.Equal(t, []topicConfigDrift{
+		{key: "retention.ms", source: "604800000", destination: "86400000"},
+		{key: "segment.bytes", source: "1073741824"},
+	}, diffTopicConfigs(destinationTopicConfigs(source, false), dest))
+
+	assert.Equal(t, []topicConfigDrift{
+		{key: "message.timestamp.type", source: "LogAppendTime", destination: "CreateTime"},
+		{key: "retention.ms", source: "604800000", destination: "86400000"},
+		{key: "segment.bytes", source: "1073741824"},
+	}, diffTopicConfigs(destinationTopicConfigs(source, true), dest))
+
+	assert.Empty(t, diffTopicConfigs(destinationTopicConfigs(source, true), source))
+}
+
+func TestNextReconcileWait(t *testing.T) {
+	interval := time.Minute
+	wait := interval
+	var waits []time.Duration
+	for range 5 {
+		wait = nextReconcileWait(wait, interval, true)
+		waits = append(waits, wait)
+	}
+	assert.Equal(t, []time.Duration{2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 10 * time.Minute, 10 * time.Minute}, waits)
+	assert.Equal(t, interval, nextReconcileWait(wait, interval, false))
+}
+
+func TestTopicConfigReconcilerStartStop(t *testing.T) {
+	var nilReconciler *topicConfigReconciler
+	nilReconciler.start(nil, nil)
+	require.NoError(t, nilReconciler.stop(context.Background()))
+
+	var cycles atomic.Int64
+	reconciler := newTopicConfigReconciler(time.Millisecond, false, service.MockResources().Metrics())
+	reconciler.start(func(context.Context) topicReconcileResult {
+		cycles.Add(1)
+		return topicReconcileResult{topics: 1}
+	}, service.MockResources().Logger())
+
+	assert.Eventually(t, func() bool { return cycles.Load() >= 2 }, time.Second, time.Millisecond)
+	require.NoError(t, reconciler.stop(context.Background()))
+
+	stopped := cycles.Load()
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, stopped, cycles.Load())
+
+	// A reconciler which keeps failing is stopped without waiting for its backoff.
+	reconciler = newTopicConfigReconciler(time.Millisecond, true, service.MockResources().Metrics())
+	reconciler.start(func(context.Context) topicReconcileResult {
+		cycles.Add(1)
+		return topicReconcileResult{topics: 1, failedTopics: 1}
+	}, service.MockResources().Logger())
+	assert.Eventually(t, func() bool { return cycles.Load() >= stopped+2 }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, reconciler.stop(ctx))
+}
+
+func TestRedpandaMigratorOutputReconcileTopicConfigs(t *testing.T) {
+	spec := service.NewConfigSpec().Fields(redpandaMigratorOutputConfigFields()...)
+
+	tests := []struct {
+		name            string
+		config          string
+		expectedEnforce bool
+		expectedNil     bool
+		errContains     string
+	}{
+		{
+			name:        "off by default",
+			config:      `reconcile_interval: 1ms`,
+			expectedNil: true,
+		},
+		{
+			name:   "warn",
+			config: `reconcile_topic_configs: warn`,
+		},
+		{
+			name:            "enforce",
+			config:          `reconcile_topic_configs: enforce`,
+			expectedEnforce: true,
+		},
+		{
+			name: "interval too short",
+			config: `
+reconcile_topic_configs: warn
+reconcile_interval: 10ms
+`,
+			errContains: "reconcile_interval must be at least 1s, got 10ms",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conf, err := spec.ParseYAML(`
+seed_brokers: [ localhost:9092 ]
+topic: foo
+`+test.config, nil)
+			require.NoError(t, err)
+
+			w, err := newRedpandaMigratorWriterFromConfig(conf, service.MockResources())
+			if test.errContains != "" {
+				require.ErrorContains(t, err, test.errContains)
+				return
+			}
+			require.NoError(t, err)
+			if test.expectedNil {
+				assert.Nil(t, w.topicReconciler)
+				return
+			}
+			require.NotNil(t, w.topicReconciler)
+			assert.Equal(t, 5*time.Minute, w.topicReconciler.interval)
+			assert.Equal(t, test.expectedEnforce, w.topicReconciler.enforce)
+		})
+	}
+}
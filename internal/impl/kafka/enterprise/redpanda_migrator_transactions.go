@@ -0,0 +1,247 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/asyncroutine"
+	"github.com/redpanda-data/connect/v4/internal/impl/kafka"
+)
+
+// maxTransactionWaitCheckInterval caps the interval at which the high watermarks and last stable offsets of the
+// consumed partitions are listed, and at which they are checked for transactions which are open for longer than the
+// max transaction wait.
+const maxTransactionWaitCheckInterval = 10 * time.Second
+
+// openTransaction is a partition whose last stable offset is below its high watermark.
+type openTransaction struct {
+	lastStableOffset int64
+	since            time.Time
+	warned           bool
+}
+
+// transactionWaits tracks how far the last stable offsets of the partitions consumed with the read_committed isolation
+// level are behind their high watermarks and warns when a partition's last stable offset doesn't advance for longer
+// than the max transaction wait, since the records after it aren't consumed until the transaction is committed or
+// aborted.
+//
+// Fetches only report the offsets of the partitions for which records were fetched, which excludes the partitions
+// whose records are all held back by an open transaction, so the offsets of the consumed partitions are also listed
+// periodically.
+type transactionWaits struct {
+	mu      sync.Mutex
+	open    map[string]map[int32]*openTransaction
+	maxWait time.Duration
+	now     func() time.Time
+
+	// The partitions which are assigned to the consumer group member, they are only tracked when consuming with a
+	// consumer group, otherwise all the partitions of the consumed topics are listed.
+	grouped  bool
+	assigned map[string]map[int32]struct{}
+	client   *kgo.Client
+
+	// The input may be closed while it connects, so the check loop is started and stopped under its own lock.
+	loopMu    sync.Mutex
+	checkLoop *asyncroutine.Periodic
+
+	lagGauge *service.MetricGauge
+	log      *service.Logger
+}
+
+func newTransactionWaits(maxWait time.Duration, grouped bool, mgr *service.Resources) *transactionWaits {
+	w := &transactionWaits{
+		open:     map[string]map[int32]*openTransaction{},
+		maxWait:  maxWait,
+		now:      time.Now,
+		grouped:  grouped,
+		assigned: map[string]map[int32]struct{}{},
+		lagGauge: mgr.Metrics().NewGauge("redpanda_migrator_last_stable_offset_lag", "topic", "partition"),
+		log:      mgr.Logger(),
+	}
+	interval := maxTransactionWaitCheckInterval
+	if maxWait > 0 {
+		interval = min(maxWait, interval)
+	}
+	w.checkLoop = asyncroutine.NewPeriodicWithContext(interval, w.refresh)
+	return w
+}
+
+// start lists the offsets of the partitions consumed by the client and checks the open transactions in the background
+// until stop is called.
+func (w *transactionWaits) start(client *kgo.Client) {
+	w.mu.Lock()
+	w.client = client
+	w.mu.Unlock()
+
+	w.loopMu.Lock()
+	defer w.loopMu.Unlock()
+	w.checkLoop.Start()
+}
+
+func (w *transactionWaits) stop() {
+	w.loopMu.Lock()
+	defer w.loopMu.Unlock()
+	w.checkLoop.Stop()
+}
+
+// assign tracks the partitions which are assigned to the consumer group member.
+func (w *transactionWaits) assign(topicPartitions map[string][]int32) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for topic, partitions := range topicPartitions {
+		if w.assigned[topic] == nil {
+			w.assigned[topic] = map[int32]struct{}{}
+		}
+		for _, partition := range partitions {
+			w.assigned[topic][partition] = struct{}{}
+		}
+	}
+}
+
+// consumedLocked returns the partitions whose offsets are listed, where the topics without partitions are listed
+// entirely.
+func (w *transactionWaits) consumedLocked() map[string][]int32 {
+	topicPartitions := map[string][]int32{}
+	if !w.grouped {
+		for _, topic := range w.client.GetConsumeTopics() {
+			topicPartitions[topic] = nil
+		}
+		return topicPartitions
+	}
+	for topic, partitions := range w.assigned {
+		for partition := range partitions {
+			topicPartitions[topic] = append(topicPartitions[topic], partition)
+		}
+	}
+	return topicPartitions
+}
+
+// refresh lists the high watermarks and last stable offsets of the consumed partitions, and then checks the open
+// transactions.
+func (w *transactionWaits) refresh(ctx context.Context) {
+	w.mu.Lock()
+	var topicPartitions map[string][]int32
+	if w.client != nil {
+		topicPartitions = w.consumedLocked()
+	}
+	client := w.client
+	w.mu.Unlock()
+
+	if len(topicPartitions) > 0 {
+		// The offsets of the partitions which can't be listed are left as they are until the next refresh.
+		info := &kafka.FranzSharedClientInfo{Client: client}
+		var partialErr *kafka.PartitionOffsetsError
+		highWatermarks, err := info.EndOffsets(ctx, topicPartitions)
+		if err != nil && !errors.As(err, &partialErr) {
+			w.log.Debugf("Failed to list the high watermarks of the consumed partitions: %s", err)
+			return
+		}
+		lastStableOffsets, err := info.LastStableOffsets(ctx, topicPartitions)
+		if err != nil && !errors.As(err, &partialErr) {
+			w.log.Debugf("Failed to list the last stable offsets of the consumed partitions: %s", err)
+			return
+		}
+		for topic, partitions := range highWatermarks {
+			for partition, highWatermark := range partitions {
+				if lastStableOffset, ok := lastStableOffsets[topic][partition]; ok {
+					w.observe(topic, partition, highWatermark, lastStableOffset)
+				}
+			}
+		}
+	}
+	w.check()
+}
+
+// observe updates the lag of a fetched or listed partition. Brokers which don't report the last stable offset are
+// ignored.
+func (w *transactionWaits) observe(topic string, partition int32, highWatermark, lastStableOffset int64) {
+	if highWatermark < 0 || lastStableOffset < 0 {
+		return
+	}
+
+	lag := max(highWatermark-lastStableOffset, 0)
+	w.lagGauge.Set(lag, topic, strconv.Itoa(int(partition)))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if lag == 0 {
+		w.deleteLocked(topic, partition)
+		return
+	}
+	if w.open[topic] == nil {
+		w.open[topic] = map[int32]*openTransaction{}
+	}
+	// The wait starts over whenever the last stable offset advances, as the transaction which blocked it was committed
+	// or aborted.
+	if tx := w.open[topic][partition]; tx == nil || tx.lastStableOffset != lastStableOffset {
+		w.open[topic][partition] = &openTransaction{lastStableOffset: lastStableOffset, since: w.now()}
+	}
+	w.checkLocked()
+}
+
+// check warns about the transactions which are open for longer than the max transaction wait.
+func (w *transactionWaits) check() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.checkLocked()
+}
+
+func (w *transactionWaits) checkLocked() {
+	if w.maxWait <= 0 {
+		return
+	}
+	now := w.now()
+	for topic, partitions := range w.open {
+		for partition, tx := range partitions {
+			if tx.warned || now.Sub(tx.since) < w.maxWait {
+				continue
+			}
+			tx.warned = true
+			w.log.Warnf(
+				"The last stable offset %d of partition %d of topic %q hasn't advanced for %s, the records after it are not migrated until the open transaction is committed or aborted",
+				tx.lastStableOffset, partition, topic, now.Sub(tx.since).Truncate(time.Second),
+			)
+		}
+	}
+}
+
+// remove resets the lag of partitions which are no longer consumed.
+func (w *transactionWaits) remove(topicPartitions map[string][]int32) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for topic, partitions := range topicPartitions {
+		for _, partition := range partitions {
+			w.lagGauge.Set(0, topic, strconv.Itoa(int(partition)))
+			w.deleteLocked(topic, partition)
+			delete(w.assigned[topic], partition)
+		}
+		if len(w.assigned[topic]) == 0 {
+			delete(w.assigned, topic)
+		}
+	}
+}
+
+func (w *transactionWaits) deleteLocked(topic string, partition int32) {
+	delete(w.open[topic], partition)
+	if len(w.open[topic]) == 0 {
+		delete(w.open, topic)
+	}
+}
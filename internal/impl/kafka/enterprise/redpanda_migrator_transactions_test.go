@@ -0,0 +1,116 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransactionWaits(t *testing.T) {
+	now := time.Unix(1000, 0)
+	w := newTransactionWaits(time.Minute, true, service.MockResources())
+	w.now = func() time.Time { return now }
+
+	warned := func(topic string, partition int32) bool {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		tx, ok := w.open[topic][partition]
+		require.True(t, ok, "partition %d of topic %q has no open transaction", partition, topic)
+		return tx.warned
+	}
+
+	// Partitions whose last stable offset reached the high watermark and brokers which don't report it aren't tracked.
+	w.observe("foo", 0, 100, 100)
+	w.observe("foo", 1, 100, -1)
+	assert.Empty(t, w.open)
+
+	w.observe("foo", 0, 150, 120)
+	w.observe("foo", 1, 150, 140)
+	assert.False(t, warned("foo", 0))
+
+	// The last stable offset of partition 1 advances, so only partition 0 waits for longer than the max wait.
+	now = now.Add(40 * time.Second)
+	w.observe("foo", 1, 160, 145)
+	now = now.Add(30 * time.Second)
+	w.check()
+	assert.True(t, warned("foo", 0))
+	assert.False(t, warned("foo", 1))
+
+	// Once the transaction ends the partition isn't tracked anymore.
+	w.observe("foo", 0, 170, 170)
+	w.mu.Lock()
+	assert.NotContains(t, w.open["foo"], int32(0))
+	w.mu.Unlock()
+
+	// A partition which is blocked again is warned about again.
+	w.observe("foo", 0, 200, 180)
+	now = now.Add(2 * time.Minute)
+	w.observe("bar", 0, 20, 10)
+	assert.True(t, warned("foo", 0))
+	assert.True(t, warned("foo", 1))
+	assert.False(t, warned("bar", 0))
+
+	w.remove(map[string][]int32{"foo": {0, 1}})
+	w.mu.Lock()
+	assert.Equal(t, []string{"bar"}, slices.Collect(maps.Keys(w.open)))
+	w.mu.Unlock()
+}
+
+func TestTransactionWaitsDisabled(t *testing.T) {
+	now := time.Unix(1000, 0)
+	w := newTransactionWaits(0, true, service.MockResources())
+	w.now = func() time.Time { return now }
+
+	// The lag is still tracked when the warning is disabled.
+	w.observe("foo", 0, 150, 120)
+	now = now.Add(time.Hour)
+	w.check()
+	assert.False(t, w.open["foo"][0].warned)
+}
+
+func TestTransactionWaitsAssignedPartitions(t *testing.T) {
+	w := newTransactionWaits(time.Minute, true, service.MockResources())
+
+	// The offsets of the partitions assigned to the consumer group member are listed, even when none of their records
+	// were fetched.
+	w.assign(map[string][]int32{"foo": {0, 1}, "bar": {2}})
+	w.assign(map[string][]int32{"foo": {3}})
+	w.remove(map[string][]int32{"foo": {1}, "bar": {2}})
+
+	w.mu.Lock()
+	consumed := w.consumedLocked()
+	w.mu.Unlock()
+	slices.Sort(consumed["foo"])
+	assert.Equal(t, map[string][]int32{"foo": {0, 3}}, consumed)
+}
+
+func TestRedpandaMigratorInputIsolationLevel(t *testing.T) {
+	conf, err := redpandaMigratorInputConfig().ParseYAML(`
+seed_brokers: [ localhost:9092 ]
+consumer_group: migrator
+topics: [ foo ]
+`, nil)
+	require.NoError(t, err)
+
+	// Aborted transactions aren't migrated by default.
+	isolationLevel, err := conf.FieldString(rmiFieldIsolationLevel)
+	require.NoError(t, err)
+	assert.Equal(t, rmiIsolationLevelReadCommitted, isolationLevel)
+
+	maxWait, err := conf.FieldDuration(rmiFieldMaxTransactionWait)
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, maxWait)
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+// resourceLabelKind identifies the type of component which registered a label.
+type resourceLabelKind string
+
+const (
+	resourceLabelKindMigratorInput        resourceLabelKind = "redpanda_migrator input"
+	resourceLabelKindSchemaRegistryOutput resourceLabelKind = "schema_registry output"
+)
+
+// registerResourceLabel records the label of a component which other components can reference by name, so that the
+// references can be validated before they're used.
+func registerResourceLabel(kind resourceLabelKind, label string, res *service.Resources) {
+	getResourceLabelRegister(res).add(kind, label)
+}
+
+// checkResourceLabel returns an error naming the missing label and the available labels if no component of the given
+// kind has registered the label.
+func checkResourceLabel(kind resourceLabelKind, label string, res *service.Resources) error {
+	labels := getResourceLabelRegister(res).get(kind)
+	if slices.Contains(labels, label) {
+		return nil
+	}
+	if len(labels) == 0 {
+		return fmt.Errorf("%s resource %q not found: no %s components are configured", kind, label, kind)
+	}
+	return fmt.Errorf("%s resource %q not found, available labels: %q", kind, label, labels)
+}
+
+//------------------------------------------------------------------------------
+
+type resourceLabelRegister struct {
+	mut    sync.Mutex
+	labels map[resourceLabelKind][]string
+}
+
+func (r *resourceLabelRegister) add(kind resourceLabelKind, label string) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	if r.labels == nil {
+		r.labels = map[resourceLabelKind][]string{}
+	}
+
+	if !slices.Contains(r.labels[kind], label) {
+		r.labels[kind] = append(r.labels[kind], label)
+	}
+}
+
+func (r *resourceLabelRegister) get(kind resourceLabelKind) []string {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	labels := slices.Clone(r.labels[kind])
+	slices.Sort(labels)
+	return labels
+}
+
+type resourceLabelRegisterKeyType int
+
+var resourceLabelRegisterKey resourceLabelRegisterKeyType
+
+func getResourceLabelRegister(res *service.Resources) *resourceLabelRegister {
+	reg, _ := res.GetOrSetGeneric(resourceLabelRegisterKey, &resourceLabelRegister{})
+	return reg.(*resourceLabelRegister)
+}
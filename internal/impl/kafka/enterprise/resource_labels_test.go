@@ -0,0 +1,41 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckResourceLabel(t *testing.T) {
+	res := service.MockResources()
+
+	err := checkResourceLabel(resourceLabelKindMigratorInput, rmiResourceDefaultLabel, res)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"redpanda_migrator_input" not found`)
+
+	registerResourceLabel(resourceLabelKindMigratorInput, "foo", res)
+	registerResourceLabel(resourceLabelKindMigratorInput, rmiResourceDefaultLabel, res)
+	registerResourceLabel(resourceLabelKindSchemaRegistryOutput, "bar", res)
+
+	require.NoError(t, checkResourceLabel(resourceLabelKindMigratorInput, "foo", res))
+	require.NoError(t, checkResourceLabel(resourceLabelKindMigratorInput, rmiResourceDefaultLabel, res))
+	require.NoError(t, checkResourceLabel(resourceLabelKindSchemaRegistryOutput, "bar", res))
+
+	err = checkResourceLabel(resourceLabelKindMigratorInput, "fooo", res)
+	require.Error(t, err)
+	assert.Equal(t, `redpanda_migrator input resource "fooo" not found, available labels: ["foo" "redpanda_migrator_input"]`, err.Error())
+
+	err = checkResourceLabel(resourceLabelKindSchemaRegistryOutput, "foo", res)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `available labels: ["bar"]`)
+}
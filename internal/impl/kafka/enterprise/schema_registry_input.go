@@ -17,6 +17,7 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
+	"slices"
 	"sort"
 	"sync"
 
@@ -115,6 +116,11 @@ type schemaRegistryInput struct {
 	versions  []int
 	schemas   []franz_sr.SubjectSchema
 	mgr       *service.Resources
+
+	// The subjects matching the filter, which were all read once exhausted is
+	// set.
+	allSubjects []string
+	exhausted   bool
 }
 
 func inputFromParsed(pConf *service.ParsedConfig, mgr *service.Resources) (i *schemaRegistryInput, err error) {
@@ -192,6 +198,9 @@ func (i *schemaRegistryInput) Connect(ctx context.Context) error {
 		}
 	}
 
+	i.allSubjects = slices.Clone(i.subjects)
+	i.exhausted = false
+
 	if i.fetchInOrder {
 		schemas := map[int][]franz_sr.SubjectSchema{}
 		for _, subject := range i.subjects {
@@ -243,6 +252,7 @@ func (i *schemaRegistryInput) Read(ctx context.Context) (*service.Message, servi
 	if !i.fetchInOrder {
 		for {
 			if len(i.subjects) == 0 && len(i.versions) == 0 {
+				i.exhausted = true
 				return nil, nil, service.ErrEndOfInput
 			}
 
@@ -278,6 +288,7 @@ func (i *schemaRegistryInput) Read(ctx context.Context) (*service.Message, servi
 		}
 	} else {
 		if len(i.schemas) == 0 {
+			i.exhausted = true
 			return nil, nil, service.ErrEndOfInput
 		}
 
@@ -304,6 +315,18 @@ func (i *schemaRegistryInput) Read(ctx context.Context) (*service.Message, servi
 	}, nil
 }
 
+// readSubjects returns the subjects matching the filter once every one of their schemas was read, or false while
+// there are schemas left to read.
+func (i *schemaRegistryInput) readSubjects() ([]string, bool) {
+	i.connMut.Lock()
+	defer i.connMut.Unlock()
+
+	if !i.exhausted {
+		return nil, false
+	}
+	return i.allSubjects, true
+}
+
 func (i *schemaRegistryInput) Close(ctx context.Context) error {
 	i.connMut.Lock()
 	defer i.connMut.Unlock()
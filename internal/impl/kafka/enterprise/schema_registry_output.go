@@ -34,6 +34,8 @@ const (
 	sroFieldBackfillDependencies = "backfill_dependencies"
 	sroFieldInputResource        = "input_resource"
 	sroFieldTLS                  = "tls"
+	sroFieldSyncCompatibility    = "sync_compatibility_levels"
+	sroFieldSyncSubjectModes     = "sync_subject_modes"
 
 	sroResourceDefaultLabel = "schema_registry_output"
 )
@@ -74,8 +76,16 @@ func schemaRegistryOutputConfigFields() []*service.ConfigField {
 		service.NewStringField(sroFieldURL).Description("The base URL of the schema registry service."),
 		service.NewInterpolatedStringField(sroFieldSubject).Description("Subject."),
 		service.NewBoolField(sroFieldBackfillDependencies).Description("Backfill schema references and previous versions.").Default(true).Advanced(),
+		service.NewBoolField(sroFieldSyncCompatibility).
+			Description("Set the compatibility level of each subject to the compatibility level of the subject in the source Schema Registry, or its global compatibility level when the subject doesn't have one, when the output is closed after the input resource read every schema. Compatibility levels are only set then, since stricter levels could otherwise reject the schemas which are still being migrated. The subjects are the ones read by the input resource which exist in the destination Schema Registry, including subjects migrated by previous runs.").
+			Default(false).
+			Advanced(),
+		service.NewBoolField(sroFieldSyncSubjectModes).
+			Description("Set the mode of each subject, such as `READONLY`, to the mode of the subject in the source Schema Registry when the output is closed after the input resource read every schema. Modes are only set then, since subjects which are `READONLY` would otherwise reject the schemas which are still being migrated, such as when the output is restarted. Modes are set to the same subjects as `" + sroFieldSyncCompatibility + "`. Subjects which are `READWRITE` in the source Schema Registry are left unchanged.").
+			Default(false).
+			Advanced(),
 		service.NewStringField(sroFieldInputResource).
-			Description("The label of the schema_registry input from which to read source schemas.").
+			Description("The label of the schema_registry input from which to read source schemas, compatibility levels and modes.").
 			Default(sriResourceDefaultLabel).
 			Advanced(),
 		service.NewTLSToggledField(sroFieldTLS),
@@ -107,19 +117,24 @@ func init() {
 type schemaRegistryOutput struct {
 	subject              *service.InterpolatedString
 	backfillDependencies bool
+	syncCompatibility    bool
+	syncSubjectModes     bool
 	inputResource        srResourceKey
 
 	client      *sr.Client
+	input       *schemaRegistryInput
 	inputClient *sr.Client
 	connected   atomic.Bool
 	mgr         *service.Resources
 	// Stores <SchemaID, SchemaVersionID, Subject> as key and destination SchemaID as value.
 	schemaLineageCache sync.Map
+	events             *migrationEventPublisher
 }
 
 func outputFromParsed(pConf *service.ParsedConfig, mgr *service.Resources) (o *schemaRegistryOutput, err error) {
 	o = &schemaRegistryOutput{
-		mgr: mgr,
+		mgr:    mgr,
+		events: migrationEventsFor(mgr),
 	}
 
 	var srURLStr string
@@ -139,7 +154,15 @@ func outputFromParsed(pConf *service.ParsedConfig, mgr *service.Resources) (o *s
 		return
 	}
 
-	if o.backfillDependencies {
+	if o.syncCompatibility, err = pConf.FieldBool(sroFieldSyncCompatibility); err != nil {
+		return
+	}
+
+	if o.syncSubjectModes, err = pConf.FieldBool(sroFieldSyncSubjectModes); err != nil {
+		return
+	}
+
+	if o.usesInputResource() {
 		var res string
 		if res, err = pConf.FieldString(sroFieldInputResource); err != nil {
 			return nil, err
@@ -167,8 +190,10 @@ func outputFromParsed(pConf *service.ParsedConfig, mgr *service.Resources) (o *s
 
 	if label := mgr.Label(); label != "" {
 		mgr.SetGeneric(srResourceKey(mgr.Label()), o)
+		registerResourceLabel(resourceLabelKindSchemaRegistryOutput, label, mgr)
 	} else {
 		mgr.SetGeneric(srResourceKey(sroResourceDefaultLabel), o)
+		registerResourceLabel(resourceLabelKindSchemaRegistryOutput, sroResourceDefaultLabel, mgr)
 	}
 
 	return
@@ -190,9 +215,10 @@ func (o *schemaRegistryOutput) Connect(ctx context.Context) error {
 		return fmt.Errorf("schema registry instance mode must be set to READWRITE or IMPORT instead of %q", mode)
 	}
 
-	if o.backfillDependencies {
+	if o.usesInputResource() {
 		if res, ok := o.mgr.GetGeneric(o.inputResource); ok {
-			o.inputClient = res.(*schemaRegistryInput).client
+			o.input = res.(*schemaRegistryInput)
+			o.inputClient = o.input.client
 		} else {
 			return fmt.Errorf("input resource %q not found", o.inputResource)
 		}
@@ -236,9 +262,108 @@ func (o *schemaRegistryOutput) Write(ctx context.Context, m *service.Message) er
 	return nil
 }
 
-func (o *schemaRegistryOutput) Close(_ context.Context) error {
+func (o *schemaRegistryOutput) Close(ctx context.Context) error {
+	var err error
+	if (o.syncCompatibility || o.syncSubjectModes) && o.connected.Load() {
+		err = o.syncSubjects(ctx)
+	}
+
 	o.connected.Store(false)
 
+	return err
+}
+
+// usesInputResource returns true when the source schemas, compatibility levels or modes are read from the input
+// resource.
+func (o *schemaRegistryOutput) usesInputResource() bool {
+	return o.backfillDependencies || o.syncCompatibility || o.syncSubjectModes
+}
+
+// syncSubjects sets the compatibility level and the mode of each migrated subject to the ones of the subject in the
+// source Schema Registry, once the input resource read every schema. The migrated subjects are the subjects read by
+// the input resource which exist in the destination Schema Registry, so that the subjects migrated before a restart
+// are synced too. Subjects which fail are logged and don't prevent the other subjects from being synced.
+func (o *schemaRegistryOutput) syncSubjects(ctx context.Context) error {
+	read, ok := o.input.readSubjects()
+	if !ok {
+		o.mgr.Logger().Infof("Skipping syncing the compatibility levels and modes of subjects since the input resource %q didn't read every schema", o.inputResource)
+		return nil
+	}
+
+	existing, err := o.client.GetSubjects(ctx, false)
+	if err != nil {
+		return fmt.Errorf("failed to fetch subjects: %s", err)
+	}
+	migrated := make(map[string]struct{}, len(existing))
+	for _, subject := range existing {
+		migrated[subject] = struct{}{}
+	}
+
+	subjects := make([]string, 0, len(read))
+	for _, subject := range read {
+		if _, ok := migrated[subject]; ok {
+			subjects = append(subjects, subject)
+		}
+	}
+	slices.Sort(subjects)
+
+	var failed int
+	for _, subject := range subjects {
+		// The compatibility level is set first, as subjects which aren't READWRITE may reject it.
+		if o.syncCompatibility {
+			if err := o.syncCompatibilityLevel(ctx, subject); err != nil {
+				failed++
+				o.mgr.Logger().Errorf("%s", err)
+				continue
+			}
+		}
+		if o.syncSubjectModes {
+			if err := o.syncMode(ctx, subject); err != nil {
+				failed++
+				o.mgr.Logger().Errorf("%s", err)
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to sync %d subjects", failed)
+	}
+	return nil
+}
+
+// syncCompatibilityLevel sets the compatibility level of subject to the compatibility level of the subject in the
+// source Schema Registry.
+func (o *schemaRegistryOutput) syncCompatibilityLevel(ctx context.Context, subject string) error {
+	level, err := o.inputClient.GetCompatibility(ctx, subject)
+	if err != nil {
+		return fmt.Errorf("failed to get compatibility level for subject %q: %s", subject, err)
+	}
+
+	if err := o.client.SetCompatibility(ctx, subject, level); err != nil {
+		return fmt.Errorf("failed to set compatibility level %s for subject %q: %s", level, subject, err)
+	}
+
+	o.mgr.Logger().Debugf("Compatibility level of subject %q set to %s", subject, level)
+
+	return nil
+}
+
+// syncMode sets the mode of subject to the mode of the subject in the source Schema Registry unless it's READWRITE.
+func (o *schemaRegistryOutput) syncMode(ctx context.Context, subject string) error {
+	mode, err := o.inputClient.GetSubjectMode(ctx, subject)
+	if err != nil {
+		return fmt.Errorf("failed to get mode for subject %q: %s", subject, err)
+	}
+	if mode == franz_sr.ModeReadWrite {
+		return nil
+	}
+
+	if err := o.client.SetSubjectMode(ctx, subject, mode); err != nil {
+		return fmt.Errorf("failed to set mode %s for subject %q: %s", mode, subject, err)
+	}
+
+	o.mgr.Logger().Infof("Mode of subject %q set to %s", subject, mode)
+
 	return nil
 }
 
@@ -247,27 +372,53 @@ func (o *schemaRegistryOutput) Close(_ context.Context) error {
 // GetDestinationSchemaID attempts to fetch the schema ID for the provided source schema ID. It will first migrate it to
 // the destination Schema Registry if it doesn't exist there yet.
 func (o *schemaRegistryOutput) GetDestinationSchemaID(ctx context.Context, id int) (int, error) {
+	mapping, err := o.GetDestinationSchemaMapping(ctx, id)
+	if err != nil {
+		return -1, err
+	}
+	return mapping.destinationID, nil
+}
+
+// schemaSubjectVersion is a version of a subject which a source schema is registered with.
+type schemaSubjectVersion struct {
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+}
+
+// schemaIDMapping maps a source schema ID to the destination schema ID it was migrated to.
+type schemaIDMapping struct {
+	destinationID int
+	// The latest version of each subject of the source schema.
+	subjects []schemaSubjectVersion
+}
+
+// GetDestinationSchemaMapping is like GetDestinationSchemaID, but it also returns the subjects and versions which the
+// schema was migrated with.
+func (o *schemaRegistryOutput) GetDestinationSchemaMapping(ctx context.Context, id int) (schemaIDMapping, error) {
+	mapping := schemaIDMapping{destinationID: -1}
+
 	schema, err := o.inputClient.GetSchemaByID(ctx, id, false)
 	if err != nil {
-		return -1, fmt.Errorf("failed to get schema for ID %d: %s", id, err)
+		return mapping, fmt.Errorf("failed to get schema for ID %d: %s", id, err)
 	}
 
 	schemaSubjects, err := o.inputClient.GetSubjectsBySchemaID(ctx, id, false)
 	if err != nil {
-		return -1, fmt.Errorf("failed to get subjects for schema ID %d: %s", id, err)
+		return mapping, fmt.Errorf("failed to get subjects for schema ID %d: %s", id, err)
 	}
 
 	if len(schemaSubjects) == 0 {
-		return -1, fmt.Errorf("no subjects found for schema ID %d", id)
+		return mapping, fmt.Errorf("no subjects found for schema ID %d", id)
 	}
 
 	// Register the schema with all the subjects it's associated with in the source Schema Registry. Each call should
 	// return the same destination schema ID.
 	var destinationID int
+	subjects := make([]schemaSubjectVersion, 0, len(schemaSubjects))
 	for _, subject := range schemaSubjects {
 		latestVersion, err := o.inputClient.GetLatestSchemaVersionForSchemaIDAndSubject(ctx, id, subject)
 		if err != nil {
-			return -1, fmt.Errorf("failed to get schema for ID %d and subject %q: %s", id, subject, err)
+			return mapping, fmt.Errorf("failed to get schema for ID %d and subject %q: %s", id, subject, err)
 		}
 
 		destinationID, err = o.getOrCreateSchemaID(
@@ -280,11 +431,12 @@ func (o *schemaRegistryOutput) GetDestinationSchemaID(ctx context.Context, id in
 			},
 		)
 		if err != nil {
-			return -1, fmt.Errorf("failed to get destination schema ID for source schema ID %d, subject %q and version %d: %s", id, subject, latestVersion, err)
+			return mapping, fmt.Errorf("failed to get destination schema ID for source schema ID %d, subject %q and version %d: %s", id, subject, latestVersion, err)
 		}
+		subjects = append(subjects, schemaSubjectVersion{Subject: subject, Version: latestVersion})
 	}
 
-	return destinationID, nil
+	return schemaIDMapping{destinationID: destinationID, subjects: subjects}, nil
 }
 
 // schemaLineageCacheKey is used as a lightweight key for the schema ID map cache so we don't store the full schemas in
@@ -381,6 +533,8 @@ func (o *schemaRegistryOutput) createSchema(ctx context.Context, key schemaLinea
 		return -1, fmt.Errorf("failed to create schema for subject %q and version %d: %s", ss.Subject, ss.Version, err)
 	}
 
+	o.events.schemaRegistered(ss.Subject, ss.Version, ss.ID, destinationID)
+
 	// Cache the schema along with the destination ID.
 	o.schemaLineageCache.Store(key, destinationID)
 
@@ -9,11 +9,16 @@
 package enterprise
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -152,3 +157,117 @@ subject: ${! @schema_registry_subject }
 	require.NoError(t, err)
 	assert.Equal(t, 2, destID)
 }
+
+func TestSchemaRegistrySyncCompatibilityAndModes(t *testing.T) {
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var output any
+		switch r.URL.EscapedPath() {
+		case "/mode":
+			output = map[string]string{"mode": "READWRITE"}
+		case "/subjects":
+			output = []string{"foo", "bar"}
+		case "/subjects/foo/versions":
+			output = []int{1, 2}
+		case "/subjects/bar/versions":
+			output = []int{1}
+		case "/subjects/foo/versions/1", "/subjects/foo/versions/2", "/subjects/bar/versions/1":
+			parts := strings.Split(r.URL.EscapedPath(), "/")
+			version, err := strconv.Atoi(parts[4])
+			require.NoError(t, err)
+			output = map[string]any{"subject": parts[2], "version": version, "id": version, "schema": `"string"`}
+		case "/config/foo":
+			assert.Equal(t, "true", r.URL.Query().Get("defaultToGlobal"))
+			output = map[string]string{"compatibilityLevel": "BACKWARD_TRANSITIVE"}
+		case "/config/bar":
+			output = map[string]string{"compatibilityLevel": "NONE"}
+		case "/mode/foo":
+			assert.Equal(t, "true", r.URL.Query().Get("defaultToGlobal"))
+			output = map[string]string{"mode": "READONLY"}
+		case "/mode/bar":
+			output = map[string]string{"mode": "READWRITE"}
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(output))
+	}))
+	t.Cleanup(source.Close)
+
+	var mut sync.Mutex
+	var requests []string
+	dest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var output any
+		path := r.URL.EscapedPath()
+		switch {
+		case path == "/mode" && r.Method == http.MethodGet:
+			output = map[string]string{"mode": "READWRITE"}
+		case path == "/subjects":
+			// Subjects migrated by a previous run are synced too, unlike the ones which weren't read.
+			output = []string{"bar", "baz", "foo"}
+		case r.Method == http.MethodPost:
+			output = map[string]int{"id": 1}
+		case path == "/schemas/ids/1/versions":
+			output = []map[string]any{{"subject": "foo", "version": 1}, {"subject": "bar", "version": 1}}
+		case path == "/subjects/foo/versions/1", path == "/subjects/bar/versions/1":
+			output = map[string]any{"subject": strings.Split(path, "/")[2], "version": 1, "id": 1, "schema": `"string"`}
+		case r.Method == http.MethodPut:
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			mut.Lock()
+			requests = append(requests, fmt.Sprintf("%s %s", path, bytes.TrimSpace(body)))
+			mut.Unlock()
+			output = json.RawMessage(body)
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(output))
+	}))
+	t.Cleanup(dest.Close)
+
+	mgr := service.MockResources()
+	license.InjectTestService(mgr)
+
+	inputConf, err := schemaRegistryInputSpec().ParseYAML(fmt.Sprintf(`
+url: %s
+`, source.URL), nil)
+	require.NoError(t, err)
+	reader, err := inputFromParsed(inputConf, mgr)
+	require.NoError(t, err)
+
+	outputConf, err := schemaRegistryOutputSpec().ParseYAML(fmt.Sprintf(`
+url: %s
+subject: ${! @schema_registry_subject }
+backfill_dependencies: false
+sync_compatibility_levels: true
+sync_subject_modes: true
+`, dest.URL), nil)
+	require.NoError(t, err)
+	writer, err := outputFromParsed(outputConf, mgr)
+	require.NoError(t, err)
+
+	ctx, done := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(done)
+	require.NoError(t, reader.Connect(ctx))
+	require.NoError(t, writer.Connect(ctx))
+
+	for range 3 {
+		msg, _, err := reader.Read(ctx)
+		require.NoError(t, err)
+		require.NoError(t, writer.Write(ctx, msg))
+	}
+
+	// Nothing is synced while the input has schemas left to read, such as when the output is restarted.
+	require.NoError(t, writer.Close(ctx))
+	assert.Empty(t, requests)
+
+	require.NoError(t, writer.Connect(ctx))
+	_, _, err = reader.Read(ctx)
+	require.ErrorIs(t, err, service.ErrEndOfInput)
+	require.NoError(t, writer.Close(ctx))
+	assert.Equal(t, []string{
+		`/config/bar {"compatibility":"NONE"}`,
+		`/config/foo {"compatibility":"BACKWARD_TRANSITIVE"}`,
+		`/mode/foo {"mode":"READONLY"}`,
+	}, requests)
+}
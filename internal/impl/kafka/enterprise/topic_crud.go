@@ -12,32 +12,93 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/cenkalti/backoff/v4"
 	"github.com/twmb/franz-go/pkg/kadm"
 	"github.com/twmb/franz-go/pkg/kerr"
 	"github.com/twmb/franz-go/pkg/kgo"
 	"github.com/twmb/franz-go/pkg/kmsg"
+
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+	"github.com/redpanda-data/benthos/v4/public/service"
 )
 
 var (
 	errTopicAlreadyExists = errors.New("topic already exists")
 )
 
-func createTopic(ctx context.Context, topic string, replicationFactorOverride bool, replicationFactor int, inputClient *kgo.Client, outputClient *kgo.Client) error {
+const (
+	timestampTypeConfig        = "message.timestamp.type"
+	timestampTypeCreateTime    = "CreateTime"
+	timestampTypeLogAppendTime = "LogAppendTime"
+)
+
+// retryBrokerOperation runs op until it succeeds, fails with an error which can't be resolved by retrying it, the
+// backoff gives up or ctx is cancelled. The last error returned by op is returned in the first two cases and notify is
+// called before every retry.
+func retryBrokerOperation(ctx context.Context, b backoff.BackOff, op func() error, notify func(err error, wait time.Duration)) error {
+	return backoff.RetryNotify(func() error {
+		err := op()
+		if err != nil && !isRetryableBrokerError(err) {
+			return backoff.Permanent(err)
+		}
+		return err
+	}, backoff.WithContext(b, ctx), notify)
+}
+
+// isRetryableBrokerError returns true for errors which are expected to be resolved by retrying, such as the errors
+// returned by a cluster while its brokers are restarting or failing to reach a broker. Any other error, such as an
+// authentication or configuration error, isn't retried.
+func isRetryableBrokerError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var kErr *kerr.Error
+	if errors.As(err, &kErr) {
+		return kErr.Retriable
+	}
+	// The broker closing the connection right after it was opened is caused by a TLS or SASL misconfiguration.
+	var firstReadErr *kgo.ErrFirstReadEOF
+	if errors.As(err, &firstReadErr) {
+		return false
+	}
+	// Errors without a Kafka error code are only retried when they're caused by the network, such as failing to
+	// connect to a broker, the connection being closed or a request timing out.
+	var netErr net.Error
+	var sysErr *os.SyscallError
+	return errors.As(err, &netErr) ||
+		errors.As(err, &sysErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// createTopic creates destTopic in the output cluster using the partition count, replication factor and configs of
+// topic from the input cluster. Topics which use LogAppendTime timestamps are created with CreateTime timestamps
+// unless preserveTimestampType is set, so that the timestamps of the source records can be carried through. The
+// configOverrides are set regardless of the configs of the source topic. It returns the response of the output
+// cluster, which holds the partition count and replication factor of the created topic.
+func createTopic(ctx context.Context, topic, destTopic string, replicationFactorOverride bool, replicationFactor int, preserveTimestampType bool, configOverrides map[string]*string, inputClient *kgo.Client, outputClient *kgo.Client) (kadm.CreateTopicResponse, error) {
 	outputAdminClient := kadm.NewClient(outputClient)
 
-	if topics, err := outputAdminClient.ListTopics(ctx, topic); err != nil {
-		return fmt.Errorf("failed to fetch topic %q from output broker: %s", topic, err)
+	if topics, err := outputAdminClient.ListTopics(ctx, destTopic); err != nil {
+		return kadm.CreateTopicResponse{}, fmt.Errorf("failed to fetch topic %q from output broker: %w", destTopic, err)
 	} else {
-		if topics.Has(topic) {
-			return errTopicAlreadyExists
+		if topics.Has(destTopic) {
+			return kadm.CreateTopicResponse{}, errTopicAlreadyExists
 		}
 	}
 
 	inputAdminClient := kadm.NewClient(inputClient)
 	var inputTopic kadm.TopicDetail
 	if topics, err := inputAdminClient.ListTopics(ctx, topic); err != nil {
-		return fmt.Errorf("failed to fetch topic %q from source broker: %s", topic, err)
+		return kadm.CreateTopicResponse{}, fmt.Errorf("failed to fetch topic %q from source broker: %w", topic, err)
 	} else {
 		inputTopic = topics[topic]
 	}
@@ -58,14 +119,30 @@ func createTopic(ctx context.Context, topic string, replicationFactorOverride bo
 
 	topicConfigs, err := inputAdminClient.DescribeTopicConfigs(ctx, topic)
 	if err != nil {
-		return fmt.Errorf("failed to fetch configs for topic %q from source broker: %s", topic, err)
+		return kadm.CreateTopicResponse{}, fmt.Errorf("failed to fetch configs for topic %q from source broker: %w", topic, err)
 	}
 
 	rc, err := topicConfigs.On(topic, nil)
 	if err != nil {
-		return fmt.Errorf("failed to fetch configs for topic %q from source broker: %s", topic, err)
+		return kadm.CreateTopicResponse{}, fmt.Errorf("failed to fetch configs for topic %q from source broker: %w", topic, err)
+	}
+
+	configs := destinationTopicConfigs(rc.Configs, preserveTimestampType)
+	maps.Copy(configs, configOverrides)
+	resp, err := outputAdminClient.CreateTopic(ctx, partitions, rp, configs, destTopic)
+	if err != nil {
+		if !errors.Is(err, kerr.TopicAlreadyExists) {
+			return kadm.CreateTopicResponse{}, fmt.Errorf("failed to create topic %q: %w", destTopic, err)
+		}
+		// The topic was created concurrently.
+		return kadm.CreateTopicResponse{}, errTopicAlreadyExists
 	}
 
+	return resp, nil
+}
+
+// destinationTopicConfigs returns the configs of a source topic which are copied to the destination topic.
+func destinationTopicConfigs(configs []kadm.Config, preserveTimestampType bool) map[string]*string {
 	// Source: https://docs.redpanda.com/current/reference/properties/topic-properties/
 	allowedConfigs := map[string]struct{}{
 		"cleanup.policy":                    {},
@@ -77,7 +154,7 @@ func createTopic(ctx context.Context, topic string, replicationFactorOverride bo
 		"segment.ms":                        {},
 		"segment.bytes":                     {},
 		"compression.type":                  {},
-		"message.timestamp.type":            {},
+		timestampTypeConfig:                 {},
 		"max.message.bytes":                 {},
 		"replication.factor":                {},
 		"write.caching":                     {},
@@ -85,65 +162,198 @@ func createTopic(ctx context.Context, topic string, replicationFactorOverride bo
 	}
 
 	destinationConfigs := make(map[string]*string)
-	for _, c := range rc.Configs {
+	for _, c := range configs {
 		if _, ok := allowedConfigs[c.Key]; ok {
 			destinationConfigs[c.Key] = c.Value
 		}
 	}
 
-	if _, err := outputAdminClient.CreateTopic(ctx, partitions, rp, destinationConfigs, topic); err != nil {
-		if !errors.Is(err, kerr.TopicAlreadyExists) {
-			return fmt.Errorf("failed to create topic %q: %s", topic, err)
+	// The destination would overwrite the timestamps of the migrated records with the time they were appended to its log.
+	if v := destinationConfigs[timestampTypeConfig]; !preserveTimestampType && v != nil && *v == timestampTypeLogAppendTime {
+		destinationConfigs[timestampTypeConfig] = kadm.StringPtr(timestampTypeCreateTime)
+	}
+
+	return destinationConfigs
+}
+
+// fetchTimestampType returns the message.timestamp.type config of topic.
+func fetchTimestampType(ctx context.Context, client *kgo.Client, topic string) (string, error) {
+	topicConfigs, err := kadm.NewClient(client).DescribeTopicConfigs(ctx, topic)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch configs for topic %q: %s", topic, err)
+	}
+
+	rc, err := topicConfigs.On(topic, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch configs for topic %q: %s", topic, err)
+	}
+
+	for _, c := range rc.Configs {
+		if c.Key == timestampTypeConfig && c.Value != nil {
+			return *c.Value, nil
 		}
 	}
+	return timestampTypeCreateTime, nil
+}
 
-	return nil
+// topicACL is an ACL of a single topic with a literal resource pattern.
+type topicACL struct {
+	principal  string
+	host       string
+	operation  kmsg.ACLOperation
+	permission kmsg.ACLPermissionType
 }
 
-func createACLs(ctx context.Context, topic string, inputClient *kgo.Client, outputClient *kgo.Client) error {
-	inputAdminClient := kadm.NewClient(inputClient)
-	outputAdminClient := kadm.NewClient(outputClient)
+// builder returns an ACL builder which creates or deletes the ACL for topic.
+func (a topicACL) builder(topic string) *kadm.ACLBuilder {
+	builder := kadm.NewACLs().Topics(topic).ResourcePatternType(kadm.ACLPatternLiteral).Operations(a.operation)
+	if a.permission == kmsg.ACLPermissionTypeDeny {
+		return builder.Deny(a.principal).DenyHosts(a.host)
+	}
+	return builder.Allow(a.principal).AllowHosts(a.host)
+}
 
-	// Only topic ACLs are migrated, group ACLs are not migrated.
-	// Users are not migrated because we can't read passwords.
+// isMigratedTopicACL returns false for ACLs which are never created by the migrator, since ALLOW WRITE ACLs are not
+// migrated and ALLOW ALL ACLs are downgraded to ALLOW READ.
+func isMigratedTopicACL(acl topicACL) bool {
+	return acl.permission != kmsg.ACLPermissionTypeAllow ||
+		(acl.operation != kmsg.ACLOperationWrite && acl.operation != kmsg.ACLOperationAll)
+}
 
+// describeTopicACLs returns the ACLs of topic with a literal resource pattern.
+func describeTopicACLs(ctx context.Context, client *kgo.Client, topic string) ([]topicACL, error) {
 	builder := kadm.NewACLs().Topics(topic).
 		ResourcePatternType(kadm.ACLPatternLiteral).Operations().Allow().Deny().AllowHosts().DenyHosts()
-	var inputACLResults kadm.DescribeACLsResults
-	var err error
-	if inputACLResults, err = inputAdminClient.DescribeACLs(ctx, builder); err != nil {
-		return fmt.Errorf("failed to fetch ACLs for topic %q: %s", topic, err)
+	results, err := kadm.NewClient(client).DescribeACLs(ctx, builder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch ACLs for topic %q: %w", topic, err)
 	}
 
-	if len(inputACLResults) > 1 {
-		return fmt.Errorf("received unexpected number of ACL results for topic %q: %d", topic, len(inputACLResults))
+	if len(results) != 1 {
+		return nil, fmt.Errorf("received unexpected number of ACL results for topic %q: %d", topic, len(results))
+	}
+	if err := results[0].Err; err != nil {
+		return nil, fmt.Errorf("failed to fetch ACLs for topic %q: %w", topic, err)
 	}
 
-	for _, acl := range inputACLResults[0].Described {
-		builder := kadm.NewACLs()
+	acls := make([]topicACL, 0, len(results[0].Described))
+	for _, acl := range results[0].Described {
+		acls = append(acls, topicACL{
+			principal:  acl.Principal,
+			host:       acl.Host,
+			operation:  acl.Operation,
+			permission: acl.Permission,
+		})
+	}
+	return acls, nil
+}
 
-		if acl.Permission == kmsg.ACLPermissionTypeAllow && acl.Operation == kmsg.ACLOperationWrite {
+// destinationTopicACLs returns the ACLs which are created in the output cluster for the ACLs of topic in the input
+// cluster.
+func destinationTopicACLs(acls []topicACL, topic string, principalMapper *aclPrincipalMapper) []topicACL {
+	var destACLs []topicACL
+	for _, acl := range acls {
+		if acl.permission == kmsg.ACLPermissionTypeAllow && acl.operation == kmsg.ACLOperationWrite {
 			// ALLOW WRITE ACLs for topics are not migrated.
 			continue
 		}
 
-		op := acl.Operation
+		principal, ok := principalMapper.mapPrincipal(acl.principal, topic)
+		if !ok {
+			continue
+		}
+
+		op := acl.operation
 		if op == kmsg.ACLOperationAll {
 			// ALLOW ALL ACLs for topics are downgraded to ALLOW READ.
 			op = kmsg.ACLOperationRead
 		}
-		switch acl.Permission {
-		case kmsg.ACLPermissionTypeAllow:
-			builder = builder.Allow(acl.Principal).AllowHosts(acl.Host).Topics(acl.Name).ResourcePatternType(acl.Pattern).Operations(op)
-		case kmsg.ACLPermissionTypeDeny:
-			builder = builder.Deny(acl.Principal).DenyHosts(acl.Host).Topics(acl.Name).ResourcePatternType(acl.Pattern).Operations(op)
+
+		destACL := topicACL{principal: principal, host: acl.host, operation: op, permission: acl.permission}
+		if !slices.Contains(destACLs, destACL) {
+			destACLs = append(destACLs, destACL)
 		}
+	}
+	return destACLs
+}
 
+// createACLs copies the ACLs of topic from the input cluster to destTopic in the output cluster and returns the ACLs
+// which were created, including those which were created before the ACLs which failed.
+func createACLs(ctx context.Context, topic, destTopic string, principalMapper *aclPrincipalMapper, inputClient *kgo.Client, outputClient *kgo.Client) ([]topicACL, error) {
+	// Only topic ACLs are migrated, group ACLs are not migrated.
+	// Users are not migrated because we can't read passwords.
+	acls, err := describeTopicACLs(ctx, inputClient, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	outputAdminClient := kadm.NewClient(outputClient)
+	var created []topicACL
+	for _, acl := range destinationTopicACLs(acls, topic, principalMapper) {
 		// Attempting to overwrite existing ACLs is idempotent and doesn't seem to raise an error.
-		if _, err := outputAdminClient.CreateACLs(ctx, builder); err != nil {
-			return fmt.Errorf("failed to create ACLs for topic %q: %s", topic, err)
+		if _, err := outputAdminClient.CreateACLs(ctx, acl.builder(destTopic)); err != nil {
+			return created, fmt.Errorf("failed to create ACLs for topic %q: %w", destTopic, err)
+		}
+		created = append(created, acl)
+	}
+
+	return created, nil
+}
+
+// aclPrincipalPrefixes lists the principal types which can be used in Kafka and Redpanda ACLs.
+var aclPrincipalPrefixes = []string{"User:", "Group:", "RedpandaRole:"}
+
+// aclPrincipalMapper rewrites the principals of the ACLs which are migrated to the output cluster. A nil mapper leaves
+// principals unchanged.
+type aclPrincipalMapper struct {
+	mapping *bloblang.Executor
+	logger  *service.Logger
+}
+
+// mapPrincipal returns the output cluster principal for an ACL of the given topic. It returns false when the ACL should
+// be skipped, either because the mapping deleted the principal or because it failed.
+func (m *aclPrincipalMapper) mapPrincipal(principal, topic string) (string, bool) {
+	if m == nil {
+		return principal, true
+	}
+
+	mapped, err := mapACLPrincipal(m.mapping, principal)
+	if err != nil {
+		m.logger.Warnf("Skipping ACL with principal %q for topic %q: %s", principal, topic, err)
+		return "", false
+	}
+	if mapped == "" {
+		m.logger.Debugf("Skipping ACL with principal %q for topic %q: principal mapping returned an empty result", principal, topic)
+		return "", false
+	}
+
+	return mapped, true
+}
+
+// mapACLPrincipal executes the principal mapping and validates its result. An empty result is returned when the
+// mapping deletes the principal or returns an empty string.
+func mapACLPrincipal(mapping *bloblang.Executor, principal string) (string, error) {
+	res, err := mapping.Query(principal)
+	if err != nil {
+		if errors.Is(err, bloblang.ErrRootDeleted) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to execute principal mapping: %s", err)
+	}
+
+	mapped, ok := res.(string)
+	if !ok {
+		return "", fmt.Errorf("principal mapping returned a %T instead of a string", res)
+	}
+	if mapped == "" {
+		return "", nil
+	}
+
+	for _, prefix := range aclPrincipalPrefixes {
+		if strings.HasPrefix(mapped, prefix) && len(mapped) > len(prefix) {
+			return mapped, nil
 		}
 	}
 
-	return nil
+	return "", fmt.Errorf("principal mapping returned %q which does not start with one of %q", mapped, aclPrincipalPrefixes)
 }
@@ -0,0 +1,294 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package enterprise
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+)
+
+func TestMapACLPrincipal(t *testing.T) {
+	tests := []struct {
+		name        string
+		mapping     string
+		principal   string
+		expected    string
+		errContains string
+	}{
+		{
+			name:      "rewrite mTLS principal",
+			mapping:   `root = this.re_replace_all("^User:CN=([^,]+),.*$", "User:$1")`,
+			principal: "User:CN=app1,OU=teams",
+			expected:  "User:app1",
+		},
+		{
+			name:      "group principal",
+			mapping:   `root = this`,
+			principal: "Group:admins",
+			expected:  "Group:admins",
+		},
+		{
+			name:      "deleted",
+			mapping:   `root = deleted()`,
+			principal: "User:foo",
+		},
+		{
+			name:      "empty string",
+			mapping:   `root = ""`,
+			principal: "User:foo",
+		},
+		{
+			name:        "missing prefix",
+			mapping:     `root = this.trim_prefix("User:")`,
+			principal:   "User:foo",
+			errContains: `"foo" which does not start with one of`,
+		},
+		{
+			name:        "prefix without name",
+			mapping:     `root = "User:"`,
+			principal:   "User:foo",
+			errContains: "does not start with one of",
+		},
+		{
+			name:        "not a string",
+			mapping:     `root = 5`,
+			principal:   "User:foo",
+			errContains: "returned a int64 instead of a string",
+		},
+		{
+			name:        "mapping error",
+			mapping:     `root = throw("nope")`,
+			principal:   "User:foo",
+			errContains: "nope",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mapping, err := bloblang.Parse(test.mapping)
+			require.NoError(t, err)
+
+			mapped, err := mapACLPrincipal(mapping, test.principal)
+			if test.errContains != "" {
+				require.ErrorContains(t, err, test.errContains)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, mapped)
+		})
+	}
+}
+
+func TestACLPrincipalMapper(t *testing.T) {
+	var nilMapper *aclPrincipalMapper
+	principal, ok := nilMapper.mapPrincipal("User:foo", "topic")
+	require.True(t, ok)
+	assert.Equal(t, "User:foo", principal)
+
+	mapping, err := bloblang.Parse(`root = if this == "User:bar" { throw("nope") } else { this.uppercase().replace_all("USER:", "User:") }`)
+	require.NoError(t, err)
+	mapper := &aclPrincipalMapper{mapping: mapping, logger: service.MockResources().Logger()}
+
+	principal, ok = mapper.mapPrincipal("User:foo", "topic")
+	require.True(t, ok)
+	assert.Equal(t, "User:FOO", principal)
+
+	_, ok = mapper.mapPrincipal("User:bar", "topic")
+	assert.False(t, ok)
+}
+
+func TestDestinationTopicConfigs(t *testing.T) {
+	sourceConfigs := func(timestampType string) []kadm.Config {
+		return []kadm.Config{
+			{Key: "cleanup.policy", Value: kadm.StringPtr("compact")},
+			{Key: "message.timestamp.type", Value: kadm.StringPtr(timestampType)},
+			{Key: "unsupported.config", Value: kadm.StringPtr("foo")},
+		}
+	}
+
+	tests := []struct {
+		name                  string
+		sourceTimestampType   string
+		preserveTimestampType bool
+		expectedTimestampType string
+	}{
+		{
+			name:                  "create time",
+			sourceTimestampType:   "CreateTime",
+			expectedTimestampType: "CreateTime",
+		},
+		{
+			name:                  "create time preserved",
+			sourceTimestampType:   "CreateTime",
+			preserveTimestampType: true,
+			expectedTimestampType: "CreateTime",
+		},
+		{
+			name:                  "log append time",
+			sourceTimestampType:   "LogAppendTime",
+			expectedTimestampType: "CreateTime",
+		},
+		{
+			name:                  "log append time preserved",
+			sourceTimestampType:   "LogAppendTime",
+			preserveTimestampType: true,
+			expectedTimestampType: "LogAppendTime",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configs := destinationTopicConfigs(sourceConfigs(test.sourceTimestampType), test.preserveTimestampType)
+			assert.Equal(t, map[string]*string{
+				"cleanup.policy":         kadm.StringPtr("compact"),
+				"message.timestamp.type": kadm.StringPtr(test.expectedTimestampType),
+			}, configs)
+		})
+	}
+}
+
+func TestRetryBrokerOperation(t *testing.T) {
+	newBackOff := func(maxElapsed time.Duration) backoff.BackOff {
+		b := backoff.NewExponentialBackOff()
+		b.InitialInterval = time.Millisecond
+		b.MaxInterval = 5 * time.Millisecond
+		b.MaxElapsedTime = maxElapsed
+		return b
+	}
+
+	// scripted returns an operation which returns the given errors in order, wrapped like the errors of createTopic,
+	// and then succeeds.
+	scripted := func(errs ...error) (func() error, *int) {
+		var calls int
+		return func() error {
+			calls++
+			if calls <= len(errs) {
+				return fmt.Errorf("failed to create topic %q: %w", "foo", errs[calls-1])
+			}
+			return nil
+		}, &calls
+	}
+
+	tests := []struct {
+		name          string
+		errs          []error
+		maxElapsed    time.Duration
+		expectedCalls int
+		errContains   string
+	}{
+		{
+			name:          "success",
+			expectedCalls: 1,
+		},
+		{
+			name:          "transient controller errors",
+			errs:          []error{kerr.NotController, kerr.CoordinatorLoadInProgress, kerr.NotController},
+			expectedCalls: 4,
+		},
+		{
+			name:          "connection error",
+			errs:          []error{&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}},
+			expectedCalls: 2,
+		},
+		{
+			name:          "connection closed",
+			errs:          []error{io.EOF, io.ErrUnexpectedEOF},
+			expectedCalls: 3,
+		},
+		{
+			name:          "request timeout",
+			errs:          []error{&net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}},
+			expectedCalls: 2,
+		},
+		{
+			name:          "sasl authentication failed",
+			errs:          []error{errors.New("unable to authenticate with SASL: invalid credentials")},
+			expectedCalls: 1,
+			errContains:   "invalid credentials",
+		},
+		{
+			name:          "deadline exceeded",
+			errs:          []error{context.DeadlineExceeded},
+			expectedCalls: 1,
+			errContains:   context.DeadlineExceeded.Error(),
+		},
+		{
+			name:          "topic authorization failed",
+			errs:          []error{kerr.NotController, kerr.TopicAuthorizationFailed},
+			expectedCalls: 2,
+			errContains:   "TOPIC_AUTHORIZATION_FAILED",
+		},
+		{
+			name:          "invalid replication factor",
+			errs:          []error{kerr.InvalidReplicationFactor},
+			expectedCalls: 1,
+			errContains:   "INVALID_REPLICATION_FACTOR",
+		},
+		{
+			name:          "topic already exists",
+			errs:          []error{errTopicAlreadyExists},
+			expectedCalls: 1,
+			errContains:   errTopicAlreadyExists.Error(),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			op, calls := scripted(test.errs...)
+			var retries int
+			err := retryBrokerOperation(context.Background(), newBackOff(time.Minute), op, func(error, time.Duration) { retries++ })
+			if test.errContains == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, test.errContains)
+			}
+			assert.Equal(t, test.expectedCalls, *calls)
+			assert.Equal(t, test.expectedCalls-1, retries)
+		})
+	}
+
+	t.Run("max elapsed time", func(t *testing.T) {
+		var calls int
+		err := retryBrokerOperation(context.Background(), newBackOff(50*time.Millisecond), func() error {
+			calls++
+			return kerr.NotController
+		}, nil)
+		require.ErrorIs(t, err, kerr.NotController)
+		assert.Greater(t, calls, 1)
+	})
+
+	t.Run("context cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		var calls int
+		err := retryBrokerOperation(ctx, newBackOff(time.Minute), func() error {
+			calls++
+			if calls == 3 {
+				cancel()
+			}
+			return kerr.NotController
+		}, nil)
+		require.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 3, calls)
+	})
+}
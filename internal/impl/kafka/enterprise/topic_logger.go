@@ -313,7 +313,7 @@ func (f *franzTopicLoggerWriter) Connect(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	if err := kafka.FranzSharedClientSet(sharedGlobalRedpandaClientKey, &kafka.FranzSharedClientInfo{
+	if err := kafka.FranzSharedClientSet(sharedGlobalRedpandaClientKey, f, &kafka.FranzSharedClientInfo{
 		Client:      cl,
 		ConnDetails: f.connDetails,
 	}, f.mgr); err != nil {
@@ -359,7 +359,7 @@ func (f *franzTopicLoggerWriter) disconnect() {
 	if f.client == nil {
 		return
 	}
-	_, _ = kafka.FranzSharedClientPop(sharedGlobalRedpandaClientKey, f.mgr)
+	_, _ = kafka.FranzSharedClientPop(sharedGlobalRedpandaClientKey, f, f.mgr)
 	f.client.Close()
 	f.client = nil
 }
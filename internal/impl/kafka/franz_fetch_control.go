@@ -0,0 +1,277 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+// FranzFetchControl pauses and resumes fetching of topics and partitions at
+// runtime, independently of the pausing that readers do in order to bound the
+// size of their buffers. Pauses are applied to the current client and are
+// reapplied to any client which replaces it after a reconnect.
+//
+// Records which were fetched before a topic or partition was paused are still
+// delivered, and fetching resumes from the next record once it's resumed.
+//
+// Topics can also be held, which pauses them independently of PauseTopics, so
+// that a component which schedules the topics that are fetched and a user who
+// pauses topics don't resume each other's pauses.
+type FranzFetchControl struct {
+	pausedGauge *service.MetricGauge
+
+	mut        sync.Mutex
+	client     *kgo.Client
+	topics     map[string]struct{}
+	held       map[string]struct{}
+	partitions map[string]map[int32]struct{}
+}
+
+// NewFranzFetchControl returns a fetch control without any paused topics. The
+// `redpanda_fetch_paused` gauge, which is labelled with the topic, is set to 1
+// while the topic or any of its partitions are paused and to 0 otherwise.
+func NewFranzFetchControl(metrics *service.Metrics) *FranzFetchControl {
+	return &FranzFetchControl{
+		pausedGauge: metrics.NewGauge("redpanda_fetch_paused", "topic"),
+		topics:      map[string]struct{}{},
+		held:        map[string]struct{}{},
+		partitions:  map[string]map[int32]struct{}{},
+	}
+}
+
+// SetClient sets the client whose fetches are controlled and pauses all topics
+// and partitions which are currently paused on it.
+func (c *FranzFetchControl) SetClient(client *kgo.Client) {
+	if c == nil {
+		return
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.client = client
+	if client == nil {
+		return
+	}
+	if len(c.topics) > 0 || len(c.held) > 0 {
+		client.PauseFetchTopics(slices.Concat(slices.Sorted(maps.Keys(c.topics)), slices.Sorted(maps.Keys(c.held)))...)
+	}
+	if len(c.partitions) > 0 {
+		client.PauseFetchPartitions(c.pausedPartitions())
+	}
+}
+
+// PauseTopics pauses fetching all partitions of the topics.
+func (c *FranzFetchControl) PauseTopics(topics ...string) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	for _, topic := range topics {
+		c.topics[topic] = struct{}{}
+	}
+	if c.client != nil {
+		c.client.PauseFetchTopics(topics...)
+	}
+	c.updateGauges(topics...)
+}
+
+// ResumeTopics resumes fetching the topics, partitions which were paused
+// individually and topics which are held remain paused.
+func (c *FranzFetchControl) ResumeTopics(topics ...string) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	var resume []string
+	for _, topic := range topics {
+		delete(c.topics, topic)
+		if _, held := c.held[topic]; !held {
+			resume = append(resume, topic)
+		}
+	}
+	if c.client != nil && len(resume) > 0 {
+		c.client.ResumeFetchTopics(resume...)
+	}
+	c.updateGauges(topics...)
+}
+
+// HoldTopics pauses fetching all partitions of the topics until they are
+// released, regardless of whether they are resumed with ResumeTopics.
+func (c *FranzFetchControl) HoldTopics(topics ...string) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	for _, topic := range topics {
+		c.held[topic] = struct{}{}
+	}
+	if c.client != nil {
+		c.client.PauseFetchTopics(topics...)
+	}
+}
+
+// ReleaseTopics resumes fetching the topics which were held, unless they are
+// paused with PauseTopics.
+func (c *FranzFetchControl) ReleaseTopics(topics ...string) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	var resume []string
+	for _, topic := range topics {
+		delete(c.held, topic)
+		if _, paused := c.topics[topic]; !paused {
+			resume = append(resume, topic)
+		}
+	}
+	if c.client != nil && len(resume) > 0 {
+		c.client.ResumeFetchTopics(resume...)
+	}
+}
+
+// PausePartitions pauses fetching the partitions of a topic.
+func (c *FranzFetchControl) PausePartitions(topic string, partitions ...int32) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	parts, exists := c.partitions[topic]
+	if !exists {
+		parts = map[int32]struct{}{}
+		c.partitions[topic] = parts
+	}
+	for _, partition := range partitions {
+		parts[partition] = struct{}{}
+	}
+	if c.client != nil {
+		c.client.PauseFetchPartitions(map[string][]int32{topic: partitions})
+	}
+	c.updateGauges(topic)
+}
+
+// ResumePartitions resumes fetching the partitions of a topic, unless the whole
+// topic is paused.
+func (c *FranzFetchControl) ResumePartitions(topic string, partitions ...int32) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if parts, exists := c.partitions[topic]; exists {
+		for _, partition := range partitions {
+			delete(parts, partition)
+		}
+		if len(parts) == 0 {
+			delete(c.partitions, topic)
+		}
+	}
+	if c.client != nil {
+		c.client.ResumeFetchPartitions(map[string][]int32{topic: partitions})
+	}
+	c.updateGauges(topic)
+}
+
+// Paused returns the sorted topics which are paused and the sorted partitions
+// which are paused individually, keyed by topic.
+func (c *FranzFetchControl) Paused() (topics []string, partitions map[string][]int32) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	return slices.Sorted(maps.Keys(c.topics)), c.pausedPartitions()
+}
+
+// IsPaused returns true if the partition or its topic are paused or the topic
+// is held.
+func (c *FranzFetchControl) IsPaused(topic string, partition int32) bool {
+	if c == nil {
+		return false
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if _, exists := c.topics[topic]; exists {
+		return true
+	}
+	if _, exists := c.held[topic]; exists {
+		return true
+	}
+	_, exists := c.partitions[topic][partition]
+	return exists
+}
+
+// resumeFetchPartitions resumes fetching the partitions which a reader paused,
+// except for those which are paused by this control, and returns the resumed
+// partitions. The lock is held so that partitions which are paused
+// concurrently aren't resumed.
+func (c *FranzFetchControl) resumeFetchPartitions(client *kgo.Client, topicPartitions map[string][]int32) map[string][]int32 {
+	if c != nil {
+		c.mut.Lock()
+		defer c.mut.Unlock()
+	}
+
+	resume := c.withoutPaused(topicPartitions)
+	if len(resume) > 0 {
+		client.ResumeFetchPartitions(resume)
+	}
+	return resume
+}
+
+// excludePaused returns the partitions which aren't paused by this control.
+func (c *FranzFetchControl) excludePaused(topicPartitions map[string][]int32) map[string][]int32 {
+	if c == nil {
+		return topicPartitions
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	return c.withoutPaused(topicPartitions)
+}
+
+func (c *FranzFetchControl) withoutPaused(topicPartitions map[string][]int32) map[string][]int32 {
+	if c == nil {
+		return topicPartitions
+	}
+
+	filtered := make(map[string][]int32, len(topicPartitions))
+	for topic, parts := range topicPartitions {
+		for _, part := range parts {
+			if _, exists := c.partitions[topic][part]; !exists {
+				filtered[topic] = append(filtered[topic], part)
+			}
+		}
+	}
+	return filtered
+}
+
+func (c *FranzFetchControl) pausedPartitions() map[string][]int32 {
+	partitions := make(map[string][]int32, len(c.partitions))
+	for topic, parts := range c.partitions {
+		partitions[topic] = slices.Sorted(maps.Keys(parts))
+	}
+	return partitions
+}
+
+func (c *FranzFetchControl) updateGauges(topics ...string) {
+	for _, topic := range topics {
+		_, paused := c.topics[topic]
+		if paused || len(c.partitions[topic]) > 0 {
+			c.pausedGauge.Set(1, topic)
+		} else {
+			c.pausedGauge.Set(0, topic)
+		}
+	}
+}
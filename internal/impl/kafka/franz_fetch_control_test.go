@@ -0,0 +1,98 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+func TestFranzFetchControl(t *testing.T) {
+	newClient := func() *kgo.Client {
+		client, err := kgo.NewClient(kgo.SeedBrokers("localhost:0"), kgo.ConsumeTopics("foo", "bar"))
+		require.NoError(t, err)
+		t.Cleanup(client.Close)
+		return client
+	}
+
+	var nilCtrl *FranzFetchControl
+	nilCtrl.SetClient(newClient())
+	assert.False(t, nilCtrl.IsPaused("foo", 0))
+	assert.Equal(t, map[string][]int32{"foo": {0}}, nilCtrl.excludePaused(map[string][]int32{"foo": {0}}))
+
+	ctrl := NewFranzFetchControl(service.MockResources().Metrics())
+	ctrl.PauseTopics("foo")
+	ctrl.PausePartitions("bar", 1, 2)
+
+	client := newClient()
+	ctrl.SetClient(client)
+	assert.Equal(t, []string{"foo"}, client.PauseFetchTopics())
+	assert.ElementsMatch(t, []int32{1, 2}, client.PauseFetchPartitions(nil)["bar"])
+
+	assert.True(t, ctrl.IsPaused("foo", 5))
+	assert.True(t, ctrl.IsPaused("bar", 1))
+	assert.False(t, ctrl.IsPaused("bar", 0))
+
+	// Partitions paused by a reader are resumed, unless they are paused by the control.
+	client.PauseFetchPartitions(map[string][]int32{"bar": {0}})
+	resumed := ctrl.resumeFetchPartitions(client, map[string][]int32{"bar": {0, 1}})
+	assert.Equal(t, map[string][]int32{"bar": {0}}, resumed)
+	assert.ElementsMatch(t, []int32{1, 2}, client.PauseFetchPartitions(nil)["bar"])
+	assert.Equal(t, map[string][]int32{"bar": {0}}, ctrl.excludePaused(map[string][]int32{"bar": {0, 1, 2}}))
+
+	ctrl.ResumeTopics("foo")
+	ctrl.ResumePartitions("bar", 1)
+	assert.Empty(t, client.PauseFetchTopics())
+	assert.Equal(t, []int32{2}, client.PauseFetchPartitions(nil)["bar"])
+
+	topics, partitions := ctrl.Paused()
+	assert.Empty(t, topics)
+	assert.Equal(t, map[string][]int32{"bar": {2}}, partitions)
+
+	ctrl.ResumePartitions("bar", 2)
+	topics, partitions = ctrl.Paused()
+	assert.Empty(t, topics)
+	assert.Empty(t, partitions)
+	assert.False(t, ctrl.IsPaused("bar", 2))
+
+	// Held topics stay paused until they are released, regardless of whether
+	// they are paused and resumed in the meantime.
+	ctrl.HoldTopics("foo")
+	assert.Equal(t, []string{"foo"}, client.PauseFetchTopics())
+	assert.True(t, ctrl.IsPaused("foo", 0))
+	ctrl.PauseTopics("foo")
+	ctrl.ResumeTopics("foo")
+	assert.Equal(t, []string{"foo"}, client.PauseFetchTopics())
+	topics, _ = ctrl.Paused()
+	assert.Empty(t, topics, "held topics aren't listed as paused")
+
+	// Holds are reapplied to a new client.
+	client = newClient()
+	ctrl.SetClient(client)
+	assert.Equal(t, []string{"foo"}, client.PauseFetchTopics())
+
+	// Releasing a topic doesn't resume it while it's paused.
+	ctrl.PauseTopics("foo")
+	ctrl.ReleaseTopics("foo")
+	assert.Equal(t, []string{"foo"}, client.PauseFetchTopics())
+	ctrl.ResumeTopics("foo")
+	assert.Empty(t, client.PauseFetchTopics())
+	assert.False(t, ctrl.IsPaused("foo", 0))
+}
@@ -0,0 +1,350 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+const (
+	// listOffsetsPageSize is the maximum number of partitions listed by a
+	// single request.
+	listOffsetsPageSize = 1000
+	// listOffsetsMaxAttempts is the number of times partitions which fail with
+	// a retriable error, such as when their leader moved, are listed.
+	listOffsetsMaxAttempts = 5
+	// listOffsetsRetryBackoff is the wait before the first retry, which is
+	// doubled for each subsequent one.
+	listOffsetsRetryBackoff = 100 * time.Millisecond
+
+	// The special timestamps for listing the high watermarks, the log start
+	// offsets and the start offsets of the logs which are stored on the local
+	// disks of the brokers, as opposed to tiered storage.
+	listOffsetsLatest        = -1
+	listOffsetsEarliest      = -2
+	listOffsetsLocalEarliest = -4
+
+	// The isolation levels of ListOffsets requests, the latest offset of a
+	// partition listed with read committed is its last stable offset.
+	readUncommitted int8 = 0
+	readCommitted   int8 = 1
+)
+
+// PartitionOffsetsError is returned when the offsets of some partitions can't
+// be listed, along with the offsets of the partitions which were listed.
+type PartitionOffsetsError struct {
+	// The partitions which couldn't be listed, sorted by topic and partition,
+	// along with their errors.
+	Failed []PartitionOffsetError
+}
+
+// PartitionOffsetError is the error of a partition whose offset can't be
+// listed.
+type PartitionOffsetError struct {
+	Topic     string
+	Partition int32
+	Err       error
+}
+
+func (e *PartitionOffsetsError) Error() string {
+	first := e.Failed[0]
+	return fmt.Sprintf("failed to list the offsets of %d partitions, such as partition %d of topic %q: %v", len(e.Failed), first.Partition, first.Topic, first.Err)
+}
+
+// Unwrap returns the errors of the partitions.
+func (e *PartitionOffsetsError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, f := range e.Failed {
+		errs[i] = f.Err
+	}
+	return errs
+}
+
+// EndOffsets returns the high watermarks of the given partitions of each
+// topic. All the partitions of a topic are listed when none are given, in
+// which case topics that don't exist are left out. Partitions which fail with
+// a retriable error, such as when their leader moved, are listed again. When
+// any partition can't be listed a *PartitionOffsetsError is returned along
+// with the offsets of the other partitions, whereas any other error means that
+// no offsets were listed.
+func (i *FranzSharedClientInfo) EndOffsets(ctx context.Context, topicPartitions map[string][]int32) (map[string]map[int32]int64, error) {
+	return listOffsets(ctx, i.Client, topicPartitions, listOffsetsLatest, readUncommitted)
+}
+
+// StartOffsets returns the log start offsets of the given partitions of each
+// topic. Partitions are listed like they are by EndOffsets.
+func (i *FranzSharedClientInfo) StartOffsets(ctx context.Context, topicPartitions map[string][]int32) (map[string]map[int32]int64, error) {
+	return listOffsets(ctx, i.Client, topicPartitions, listOffsetsEarliest, readUncommitted)
+}
+
+// LocalStartOffsets returns the offsets of the first records of the given
+// partitions of each topic which are stored on the local disks of the brokers,
+// which are after the log start offsets when older segments were moved to
+// tiered storage. Brokers which don't support listing them may return -1
+// instead. Partitions are listed like they are by EndOffsets.
+func (i *FranzSharedClientInfo) LocalStartOffsets(ctx context.Context, topicPartitions map[string][]int32) (map[string]map[int32]int64, error) {
+	return listOffsets(ctx, i.Client, topicPartitions, listOffsetsLocalEarliest, readUncommitted)
+}
+
+// LastStableOffsets returns the last stable offsets of the given partitions of
+// each topic, which are the offsets of the first records of transactions
+// which are still open, or the high watermarks of the partitions without any.
+// Partitions are listed like they are by EndOffsets.
+func (i *FranzSharedClientInfo) LastStableOffsets(ctx context.Context, topicPartitions map[string][]int32) (map[string]map[int32]int64, error) {
+	return listOffsets(ctx, i.Client, topicPartitions, listOffsetsLatest, readCommitted)
+}
+
+// OffsetsForTimestamp returns the offsets of the first records with a
+// timestamp at or after ts of the given partitions of each topic, or their
+// high watermarks when they don't have any such record. Partitions are listed
+// like they are by EndOffsets.
+func (i *FranzSharedClientInfo) OffsetsForTimestamp(ctx context.Context, topicPartitions map[string][]int32, ts time.Time) (map[string]map[int32]int64, error) {
+	return offsetsForTimestamp(ctx, i.Client, topicPartitions, ts.UnixMilli())
+}
+
+// OffsetsForTimestamp lists the offsets for a timestamp like the
+// FranzSharedClientInfo method of the same name does, with a client which
+// isn't shared.
+func OffsetsForTimestamp(ctx context.Context, client kmsg.Requestor, topicPartitions map[string][]int32, ts time.Time) (map[string]map[int32]int64, error) {
+	return offsetsForTimestamp(ctx, client, topicPartitions, ts.UnixMilli())
+}
+
+func offsetsForTimestamp(ctx context.Context, client kmsg.Requestor, topicPartitions map[string][]int32, millis int64) (map[string]map[int32]int64, error) {
+	offsets, err := listOffsets(ctx, client, topicPartitions, millis, readUncommitted)
+	var partialErr *PartitionOffsetsError
+	if err != nil && !errors.As(err, &partialErr) {
+		return nil, err
+	}
+
+	// Partitions without a record after the timestamp are listed at -1.
+	latest := map[string][]int32{}
+	for topic, partitions := range offsets {
+		for partition, offset := range partitions {
+			if offset == -1 {
+				latest[topic] = append(latest[topic], partition)
+			}
+		}
+	}
+	if len(latest) == 0 {
+		return offsets, err
+	}
+	endOffsets, endErr := listOffsets(ctx, client, latest, listOffsetsLatest, readUncommitted)
+	var partialEndErr *PartitionOffsetsError
+	if endErr != nil && !errors.As(endErr, &partialEndErr) {
+		return nil, endErr
+	}
+	// Partitions whose high watermark can't be listed are left out.
+	for topic, partitions := range latest {
+		for _, partition := range partitions {
+			if offset, ok := endOffsets[topic][partition]; ok {
+				offsets[topic][partition] = offset
+			} else {
+				delete(offsets[topic], partition)
+			}
+		}
+		if len(offsets[topic]) == 0 {
+			delete(offsets, topic)
+		}
+	}
+	if partialEndErr == nil {
+		return offsets, err
+	}
+	if partialErr != nil {
+		partialEndErr.Failed = append(partialEndErr.Failed, partialErr.Failed...)
+		sortPartitionOffsetErrors(partialEndErr.Failed)
+	}
+	return offsets, partialEndErr
+}
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// listOffsets lists the offsets at the timestamp of the given partitions of
+// each topic with the isolation level in pages of at most listOffsetsPageSize
+// partitions.
+func listOffsets(ctx context.Context, client kmsg.Requestor, topicPartitions map[string][]int32, timestamp int64, isolationLevel int8) (map[string]map[int32]int64, error) {
+	pending, err := resolvePartitions(ctx, client, topicPartitions)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := map[string]map[int32]int64{}
+	var permanent []PartitionOffsetError
+	backoff := listOffsetsRetryBackoff
+	for attempt := 1; ; attempt++ {
+		var retry []failedPartition
+		for page := range slices.Chunk(pending, listOffsetsPageSize) {
+			pageRetry, pageFailed, err := listOffsetsPage(ctx, client, page, timestamp, isolationLevel, offsets)
+			if err != nil {
+				return nil, err
+			}
+			retry = append(retry, pageRetry...)
+			for _, f := range pageFailed {
+				permanent = append(permanent, PartitionOffsetError{Topic: f.topic, Partition: f.partition, Err: f.err})
+			}
+		}
+		if len(retry) == 0 || attempt == listOffsetsMaxAttempts {
+			for _, f := range retry {
+				permanent = append(permanent, PartitionOffsetError{Topic: f.topic, Partition: f.partition, Err: f.err})
+			}
+			if len(permanent) == 0 {
+				return offsets, nil
+			}
+			sortPartitionOffsetErrors(permanent)
+			return offsets, &PartitionOffsetsError{Failed: permanent}
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+		pending = pending[:0]
+		for _, f := range retry {
+			pending = append(pending, f.topicPartition)
+		}
+	}
+}
+
+func sortPartitionOffsetErrors(errs []PartitionOffsetError) {
+	slices.SortFunc(errs, func(a, b PartitionOffsetError) int {
+		return cmp.Or(cmp.Compare(a.Topic, b.Topic), cmp.Compare(a.Partition, b.Partition))
+	})
+}
+
+// resolvePartitions returns the given partitions sorted, along with all the
+// partitions of the topics for which none are given.
+func resolvePartitions(ctx context.Context, client kmsg.Requestor, topicPartitions map[string][]int32) ([]topicPartition, error) {
+	var resolved []topicPartition
+	var allPartitions []string
+	for topic, partitions := range topicPartitions {
+		if len(partitions) == 0 {
+			allPartitions = append(allPartitions, topic)
+			continue
+		}
+		for _, partition := range partitions {
+			resolved = append(resolved, topicPartition{topic: topic, partition: partition})
+		}
+	}
+
+	if len(allPartitions) > 0 {
+		req := kmsg.NewPtrMetadataRequest()
+		for _, topic := range allPartitions {
+			reqTopic := kmsg.NewMetadataRequestTopic()
+			reqTopic.Topic = kmsg.StringPtr(topic)
+			req.Topics = append(req.Topics, reqTopic)
+		}
+		resp, err := req.RequestWith(ctx, client)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch the metadata of topics %v: %w", allPartitions, err)
+		}
+		for _, t := range resp.Topics {
+			if t.Topic == nil {
+				continue
+			}
+			if err := kerr.ErrorForCode(t.ErrorCode); errors.Is(err, kerr.UnknownTopicOrPartition) {
+				continue
+			} else if err != nil {
+				return nil, fmt.Errorf("failed to fetch the metadata of topic %q: %w", *t.Topic, err)
+			}
+			for _, p := range t.Partitions {
+				resolved = append(resolved, topicPartition{topic: *t.Topic, partition: p.Partition})
+			}
+		}
+	}
+
+	slices.SortFunc(resolved, func(a, b topicPartition) int {
+		return cmp.Or(cmp.Compare(a.topic, b.topic), cmp.Compare(a.partition, b.partition))
+	})
+	return slices.Compact(resolved), nil
+}
+
+type failedPartition struct {
+	topicPartition
+	err error
+}
+
+// listOffsetsPage lists the offsets of a page of partitions into offsets and
+// returns the partitions which failed with a retriable error, including the
+// ones which are missing from the response, followed by the partitions which
+// failed with an error that isn't retriable.
+func listOffsetsPage(ctx context.Context, client kmsg.Requestor, page []topicPartition, timestamp int64, isolationLevel int8, offsets map[string]map[int32]int64) (retry, failed []failedPartition, err error) {
+	req := kmsg.NewPtrListOffsetsRequest()
+	req.IsolationLevel = isolationLevel
+	for i, tp := range page {
+		if i == 0 || page[i-1].topic != tp.topic {
+			reqTopic := kmsg.NewListOffsetsRequestTopic()
+			reqTopic.Topic = tp.topic
+			req.Topics = append(req.Topics, reqTopic)
+		}
+		reqPartition := kmsg.NewListOffsetsRequestTopicPartition()
+		reqPartition.Partition = tp.partition
+		reqPartition.Timestamp = timestamp
+		reqTopic := &req.Topics[len(req.Topics)-1]
+		reqTopic.Partitions = append(reqTopic.Partitions, reqPartition)
+	}
+
+	// The client splits the request by partition leader, the response of the
+	// leaders which succeeded is still returned when some of them failed.
+	resp, reqErr := req.RequestWith(ctx, client)
+	if reqErr != nil && ctx.Err() != nil {
+		return nil, nil, ctx.Err()
+	}
+
+	listed := map[topicPartition]struct{}{}
+	if resp != nil {
+		for _, t := range resp.Topics {
+			for _, p := range t.Partitions {
+				tp := topicPartition{topic: t.Topic, partition: p.Partition}
+				listed[tp] = struct{}{}
+				if err := kerr.ErrorForCode(p.ErrorCode); err != nil {
+					if kerr.IsRetriable(err) {
+						retry = append(retry, failedPartition{topicPartition: tp, err: err})
+					} else {
+						failed = append(failed, failedPartition{topicPartition: tp, err: err})
+					}
+					continue
+				}
+				if offsets[t.Topic] == nil {
+					offsets[t.Topic] = map[int32]int64{}
+				}
+				offsets[t.Topic][p.Partition] = p.Offset
+			}
+		}
+	}
+
+	for _, tp := range page {
+		if _, ok := listed[tp]; ok {
+			continue
+		}
+		err := reqErr
+		if err == nil {
+			err = errors.New("missing from the response")
+		}
+		retry = append(retry, failedPartition{topicPartition: tp, err: err})
+	}
+	return retry, failed, nil
+}
@@ -0,0 +1,209 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// scriptedRequestor answers metadata requests from the partition counts of
+// topics and list offsets requests with the script, which returns the offset
+// of a partition at a timestamp or the error code of the partition.
+type scriptedRequestor struct {
+	partitions map[string]int32
+	script     func(attempt int, topic string, partition int32, timestamp int64) (int64, int16)
+
+	listRequests    int
+	isolationLevels []int8
+	attempts        map[topicPartition]int
+}
+
+func (r *scriptedRequestor) Request(_ context.Context, req kmsg.Request) (kmsg.Response, error) {
+	switch req := req.(type) {
+	case *kmsg.MetadataRequest:
+		resp := kmsg.NewPtrMetadataResponse()
+		for _, t := range req.Topics {
+			respTopic := kmsg.NewMetadataResponseTopic()
+			respTopic.Topic = t.Topic
+			count, ok := r.partitions[*t.Topic]
+			if !ok {
+				respTopic.ErrorCode = kerr.UnknownTopicOrPartition.Code
+			}
+			for p := range count {
+				respPartition := kmsg.NewMetadataResponseTopicPartition()
+				respPartition.Partition = p
+				respTopic.Partitions = append(respTopic.Partitions, respPartition)
+			}
+			resp.Topics = append(resp.Topics, respTopic)
+		}
+		return resp, nil
+	case *kmsg.ListOffsetsRequest:
+		r.listRequests++
+		r.isolationLevels = append(r.isolationLevels, req.IsolationLevel)
+		if r.attempts == nil {
+			r.attempts = map[topicPartition]int{}
+		}
+		resp := kmsg.NewPtrListOffsetsResponse()
+		for _, t := range req.Topics {
+			respTopic := kmsg.NewListOffsetsResponseTopic()
+			respTopic.Topic = t.Topic
+			for _, p := range t.Partitions {
+				tp := topicPartition{topic: t.Topic, partition: p.Partition}
+				r.attempts[tp]++
+				respPartition := kmsg.NewListOffsetsResponseTopicPartition()
+				respPartition.Partition = p.Partition
+				respPartition.Offset, respPartition.ErrorCode = r.script(r.attempts[tp], t.Topic, p.Partition, p.Timestamp)
+				if respPartition.Offset == -2 {
+					// Leave the partition out of the response.
+					continue
+				}
+				respTopic.Partitions = append(respTopic.Partitions, respPartition)
+			}
+			resp.Topics = append(resp.Topics, respTopic)
+		}
+		return resp, nil
+	}
+	return nil, errors.New("unexpected request")
+}
+
+func TestListOffsetsIsolationLevel(t *testing.T) {
+	r := &scriptedRequestor{
+		script: func(_ int, _ string, partition int32, _ int64) (int64, int16) {
+			return 100 + int64(partition), 0
+		},
+	}
+	_, err := listOffsets(context.Background(), r, map[string][]int32{"foo": {0}}, listOffsetsLatest, readCommitted)
+	require.NoError(t, err)
+	_, err = listOffsets(context.Background(), r, map[string][]int32{"foo": {0}}, listOffsetsLatest, readUncommitted)
+	require.NoError(t, err)
+	assert.Equal(t, []int8{readCommitted, readUncommitted}, r.isolationLevels)
+}
+
+func TestListOffsetsAllPartitions(t *testing.T) {
+	r := &scriptedRequestor{
+		partitions: map[string]int32{"foo": 3, "bar": 1},
+		script: func(_ int, _ string, partition int32, timestamp int64) (int64, int16) {
+			require.Equal(t, int64(listOffsetsLatest), timestamp)
+			return 100 + int64(partition), 0
+		},
+	}
+
+	offsets, err := listOffsets(context.Background(), r, map[string][]int32{"foo": nil, "bar": {0}, "missing": nil}, listOffsetsLatest, readUncommitted)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]map[int32]int64{
+		"foo": {0: 100, 1: 101, 2: 102},
+		"bar": {0: 100},
+	}, offsets)
+	assert.Equal(t, 1, r.listRequests)
+}
+
+func TestListOffsetsPaging(t *testing.T) {
+	r := &scriptedRequestor{
+		partitions: map[string]int32{"foo": 1500, "bar": 700},
+		script: func(_ int, _ string, partition int32, _ int64) (int64, int16) {
+			return int64(partition), 0
+		},
+	}
+
+	offsets, err := listOffsets(context.Background(), r, map[string][]int32{"foo": nil, "bar": nil}, listOffsetsLatest, readUncommitted)
+	require.NoError(t, err)
+	assert.Len(t, offsets["foo"], 1500)
+	assert.Len(t, offsets["bar"], 700)
+	assert.Equal(t, int64(1499), offsets["foo"][1499])
+	assert.Equal(t, 3, r.listRequests)
+}
+
+func TestListOffsetsRetriesLeaderErrors(t *testing.T) {
+	r := &scriptedRequestor{
+		script: func(attempt int, _ string, partition int32, _ int64) (int64, int16) {
+			switch {
+			case partition == 1 && attempt == 1:
+				return 0, kerr.NotLeaderForPartition.Code
+			case partition == 2 && attempt < 3:
+				return -2, 0
+			}
+			return 10 * int64(partition), 0
+		},
+	}
+
+	offsets, err := listOffsets(context.Background(), r, map[string][]int32{"foo": {0, 1, 2}}, listOffsetsLatest, readUncommitted)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]map[int32]int64{"foo": {0: 0, 1: 10, 2: 20}}, offsets)
+
+	// Only the partitions which failed are listed again.
+	assert.Equal(t, map[topicPartition]int{{"foo", 0}: 1, {"foo", 1}: 2, {"foo", 2}: 3}, r.attempts)
+}
+
+func TestListOffsetsErrors(t *testing.T) {
+	r := &scriptedRequestor{
+		script: func(_ int, _ string, partition int32, _ int64) (int64, int16) {
+			if partition == 1 {
+				return 0, kerr.LeaderNotAvailable.Code
+			}
+			return 0, 0
+		},
+	}
+	// The offsets of the partitions which were listed are returned along with the error of the others.
+	offsets, err := listOffsets(context.Background(), r, map[string][]int32{"foo": {0, 1}}, listOffsetsLatest, readUncommitted)
+	require.ErrorIs(t, err, kerr.LeaderNotAvailable)
+	assert.Contains(t, err.Error(), `partition 1 of topic "foo"`)
+	assert.Equal(t, listOffsetsMaxAttempts, r.attempts[topicPartition{"foo", 1}])
+	var partialErr *PartitionOffsetsError
+	require.ErrorAs(t, err, &partialErr)
+	assert.Equal(t, []PartitionOffsetError{{Topic: "foo", Partition: 1, Err: kerr.LeaderNotAvailable}}, partialErr.Failed)
+	assert.Equal(t, map[string]map[int32]int64{"foo": {0: 0}}, offsets)
+
+	// Partitions which fail with an error that isn't retriable aren't listed again.
+	r = &scriptedRequestor{
+		script: func(_ int, _ string, partition int32, _ int64) (int64, int16) {
+			if partition == 1 {
+				return 0, kerr.TopicAuthorizationFailed.Code
+			}
+			return 5, 0
+		},
+	}
+	offsets, err = listOffsets(context.Background(), r, map[string][]int32{"foo": {0, 1}}, listOffsetsLatest, readUncommitted)
+	require.ErrorIs(t, err, kerr.TopicAuthorizationFailed)
+	require.ErrorAs(t, err, &partialErr)
+	assert.Equal(t, map[string]map[int32]int64{"foo": {0: 5}}, offsets)
+	assert.Equal(t, 1, r.listRequests)
+}
+
+func TestOffsetsForTimestamp(t *testing.T) {
+	r := &scriptedRequestor{
+		script: func(_ int, _ string, partition int32, timestamp int64) (int64, int16) {
+			if timestamp == listOffsetsLatest {
+				return 50, 0
+			}
+			require.Equal(t, int64(1000), timestamp)
+			if partition == 1 {
+				return -1, 0
+			}
+			return 20, 0
+		},
+	}
+
+	// Partitions without a record after the timestamp are listed at their high watermark.
+	offsets, err := offsetsForTimestamp(context.Background(), r, map[string][]int32{"foo": {0, 1}}, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]map[int32]int64{"foo": {0: 20, 1: 50}}, offsets)
+}
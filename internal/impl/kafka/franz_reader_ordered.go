@@ -18,6 +18,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -76,6 +77,34 @@ type FranzReaderOrdered struct {
 	topicLagCache sync.Map
 	Client        *kgo.Client
 
+	// FetchControl optionally pauses and resumes fetching of topics and
+	// partitions at runtime, it must be set before the reader connects.
+	FetchControl *FranzFetchControl
+
+	// OnPartitionsRemoved is optionally called with the topic partitions which
+	// are revoked from or lost by the consumer group member, it must be set
+	// before the reader connects.
+	OnPartitionsRemoved func(topicPartitions map[string][]int32)
+
+	// OnPartitionsAssigned is optionally called with the topic partitions
+	// which are assigned to the consumer group member before they are
+	// fetched, it must be set before the reader connects.
+	OnPartitionsAssigned func(topicPartitions map[string][]int32)
+
+	// OnPartitionFetched is optionally called with the fetch position, the
+	// high watermark and the last stable offset of each partition included in
+	// a fetch, it must be set before the reader connects. The fetch position
+	// is the offset following the last fetched record, including control
+	// records when the client keeps them, or -1 when no records were fetched.
+	// Fetches don't include the partitions for which neither records nor an
+	// error were fetched, so it isn't called for idle partitions.
+	OnPartitionFetched func(topic string, partition int32, position, highWatermark, lastStableOffset int64)
+
+	// OnRecord is optionally called with each fetched record and the message
+	// it was converted into, before the key and value of the record are
+	// discarded, it must be set before the reader connects.
+	OnRecord func(record *kgo.Record, msg *service.Message)
+
 	consumerGroup         string
 	commitPeriod          time.Duration
 	topicLagRefreshPeriod time.Duration
@@ -140,6 +169,9 @@ func (f *FranzReaderOrdered) recordsToBatch(records []*kgo.Record) *batchWithRec
 
 		msg := FranzRecordToMessageV1(r)
 		msg.MetaSetMut("kafka_lag", lag)
+		if f.OnRecord != nil {
+			f.OnRecord(r, msg)
+		}
 
 		batch = append(batch, msg)
 
@@ -382,10 +414,16 @@ func (f *FranzReaderOrdered) Connect(ctx context.Context) error {
 					f.log.Errorf("Commit error on partition revoke: %v", commitErr)
 				}
 				checkpoints.removeTopicPartitions(m)
+				if f.OnPartitionsRemoved != nil {
+					f.OnPartitionsRemoved(m)
+				}
 			}),
 			kgo.OnPartitionsLost(func(_ context.Context, _ *kgo.Client, m map[string][]int32) {
 				// No point trying to commit our offsets, just clean up our topic map
 				checkpoints.removeTopicPartitions(m)
+				if f.OnPartitionsRemoved != nil {
+					f.OnPartitionsRemoved(m)
+				}
 			}),
 			kgo.OnPartitionsAssigned(func(_ context.Context, _ *kgo.Client, m map[string][]int32) {
 				for topic, parts := range m {
@@ -394,6 +432,9 @@ func (f *FranzReaderOrdered) Connect(ctx context.Context) error {
 						checkpoints.addRecords(topic, part, nil, f.cacheLimit)
 					}
 				}
+				if f.OnPartitionsAssigned != nil {
+					f.OnPartitionsAssigned(m)
+				}
 			}),
 			kgo.ConsumerGroup(f.consumerGroup),
 			kgo.AutoCommitMarks(),
@@ -405,6 +446,7 @@ func (f *FranzReaderOrdered) Connect(ctx context.Context) error {
 	if f.Client, err = kgo.NewClient(clientOpts...); err != nil {
 		return err
 	}
+	f.FetchControl.SetClient(f.Client)
 
 	noActivePartitionsBackOff := backoff.NewExponentialBackOff()
 	noActivePartitionsBackOff.InitialInterval = time.Microsecond * 50
@@ -499,11 +541,24 @@ func (f *FranzReaderOrdered) Connect(ctx context.Context) error {
 
 			pauseTopicPartitions := map[string][]int32{}
 			fetches.EachPartition(func(p kgo.FetchTopicPartition) {
-				if len(p.Records) == 0 {
+				if f.OnPartitionFetched != nil && p.Err == nil {
+					position := int64(-1)
+					if len(p.Records) > 0 {
+						position = p.Records[len(p.Records)-1].Offset + 1
+					}
+					f.OnPartitionFetched(p.Topic, p.Partition, position, p.HighWatermark, p.LastStableOffset)
+				}
+
+				// Control records are only fetched when the client keeps them
+				// for tracking the fetch position, they aren't consumed.
+				records := slices.DeleteFunc(p.Records, func(r *kgo.Record) bool {
+					return r.Attrs.IsControl()
+				})
+				if len(records) == 0 {
 					return
 				}
 
-				batch := f.recordsToBatch(p.Records)
+				batch := f.recordsToBatch(records)
 				if len(batch.b) == 0 {
 					return
 				}
@@ -528,11 +583,13 @@ func (f *FranzReaderOrdered) Connect(ctx context.Context) error {
 						}
 					}
 				}
+				// Partitions paused through the fetch control stay paused and
+				// are counted as active, as they aren't stalled on our buffers.
 				if len(resumeTopicPartitions) > 0 {
-					f.Client.ResumeFetchPartitions(resumeTopicPartitions)
+					resumeTopicPartitions = f.FetchControl.resumeFetchPartitions(f.Client, resumeTopicPartitions)
 				}
 
-				if len(f.consumerGroup) == 0 || len(resumeTopicPartitions) > 0 || checkpoints.tallyActivePartitions(pausedPartitionTopics) > 0 {
+				if len(f.consumerGroup) == 0 || len(resumeTopicPartitions) > 0 || checkpoints.tallyActivePartitions(f.FetchControl.excludePaused(pausedPartitionTopics)) > 0 {
 					break noActivePartitions
 				}
 
@@ -16,6 +16,7 @@ package kafka
 
 import (
 	"errors"
+	"fmt"
 	"sync"
 
 	"github.com/redpanda-data/benthos/v4/public/service"
@@ -27,18 +28,37 @@ var (
 	errSharedClientNameNotFound  = errors.New("shared client not found")
 )
 
+// ErrClientClosing is returned by FranzSharedClientUse when the last reference
+// to the shared client has been released, such as when the component which
+// owns it is closing. Callers should treat it as retryable once the owner
+// connects again, which may only happen after a restart, rather than as a
+// failure.
+var ErrClientClosing = errors.New("shared client is closing")
+
 // FranzSharedClientSet attempts to store a shared client with a given
-// identifier in the provided resources pointer.
-func FranzSharedClientSet(name string, client *FranzSharedClientInfo, res *service.Resources) error {
+// identifier in the provided resources pointer on behalf of owner, which is
+// the component that acquires a reference to it. Each owner holds at most one
+// reference, storing the same client under the same identifier for another
+// owner adds a reference to it, which must be released with a call to
+// FranzSharedClientPop by that owner, whereas storing a different client under
+// an identifier that's in use returns an error.
+func FranzSharedClientSet(name string, owner any, client *FranzSharedClientInfo, res *service.Resources) error {
 	reg := getSharedClientRegister(res)
-	return reg.set(name, client)
+	return reg.set(name, owner, client)
 }
 
-// FranzSharedClientPop attempts to remove and return a shared client with a
-// given identifier in the provided resources pointer.
-func FranzSharedClientPop(name string, res *service.Resources) (*FranzSharedClientInfo, error) {
+// FranzSharedClientPop releases the reference of owner to the shared client
+// with a given identifier in the provided resources pointer. The client is
+// only removed and returned once its last reference is released, until then
+// nil is returned so that the caller doesn't close a client which is still in
+// use. Releasing the last reference waits for the calls to
+// FranzSharedClientUse which are in progress, and later calls return
+// ErrClientClosing until a client is stored under the identifier again. An
+// error is returned when owner doesn't hold a reference to a client stored
+// under the identifier, such as when it has already been popped.
+func FranzSharedClientPop(name string, owner any, res *service.Resources) (*FranzSharedClientInfo, error) {
 	reg := getSharedClientRegister(res)
-	return reg.pop(name)
+	return reg.pop(name, owner)
 }
 
 // FranzSharedClientUseFn defines a closure that receives shared client details.
@@ -56,63 +76,84 @@ func FranzSharedClientUse(name string, res *service.Resources, fn FranzSharedCli
 type FranzSharedClientInfo struct {
 	Client      *kgo.Client
 	ConnDetails *FranzConnectionDetails
+	// FetchControl pauses and resumes fetching of the client when it's
+	// consuming, it's nil for clients that don't support it.
+	FetchControl *FranzFetchControl
 }
 
 //------------------------------------------------------------------------------
 
+type franzSharedClient struct {
+	info *FranzSharedClientInfo
+	// The owners which hold a reference to the client.
+	owners map[any]struct{}
+	// The last reference to the client was released, so that it's being
+	// closed by its owner.
+	closing bool
+}
+
 type franzSharedClientRegister struct {
 	mut     sync.RWMutex
-	clients map[string]*FranzSharedClientInfo
+	clients map[string]*franzSharedClient
 }
 
-func (r *franzSharedClientRegister) set(name string, client *FranzSharedClientInfo) error {
+func (r *franzSharedClientRegister) set(name string, owner any, client *FranzSharedClientInfo) error {
 	r.mut.Lock()
 	defer r.mut.Unlock()
 
 	if r.clients == nil {
-		r.clients = map[string]*FranzSharedClientInfo{}
+		r.clients = map[string]*franzSharedClient{}
 	}
 
-	_, exists := r.clients[name]
-	if exists {
-		return errSharedClientNameDuplicate
+	if e, exists := r.clients[name]; exists && !e.closing {
+		if e.info.Client != client.Client {
+			return errSharedClientNameDuplicate
+		}
+		e.owners[owner] = struct{}{}
+		return nil
 	}
 
-	r.clients[name] = client
+	r.clients[name] = &franzSharedClient{info: client, owners: map[any]struct{}{owner: {}}}
 	return nil
 }
 
-func (r *franzSharedClientRegister) pop(name string) (*FranzSharedClientInfo, error) {
+func (r *franzSharedClientRegister) pop(name string, owner any) (*FranzSharedClientInfo, error) {
 	r.mut.Lock()
 	defer r.mut.Unlock()
 
-	if r.clients == nil {
-		return nil, errSharedClientNameNotFound
+	e, exists := r.clients[name]
+	if !exists || e.closing {
+		return nil, fmt.Errorf("%w: %s", errSharedClientNameNotFound, name)
+	}
+	if _, ok := e.owners[owner]; !ok {
+		return nil, fmt.Errorf("%w: %s", errSharedClientNameNotFound, name)
 	}
 
-	e, exists := r.clients[name]
-	if !exists {
-		return nil, errSharedClientNameNotFound
+	delete(e.owners, owner)
+	if len(e.owners) > 0 {
+		return nil, nil
 	}
 
-	delete(r.clients, name)
-	return e, nil
+	// The entry is kept so that later uses can tell a client which is closing
+	// apart from one that was never stored.
+	info := e.info
+	r.clients[name] = &franzSharedClient{closing: true}
+	return info, nil
 }
 
 func (r *franzSharedClientRegister) use(name string, fn func(*FranzSharedClientInfo) error) error {
 	r.mut.RLock()
 	defer r.mut.RUnlock()
 
-	if r.clients == nil {
-		return errSharedClientNameNotFound
-	}
-
 	e, exists := r.clients[name]
 	if !exists {
-		return errSharedClientNameNotFound
+		return fmt.Errorf("%w: %s", errSharedClientNameNotFound, name)
+	}
+	if e.closing {
+		return fmt.Errorf("%w: %s", ErrClientClosing, name)
 	}
 
-	return fn(e)
+	return fn(e.info)
 }
 
 //------------------------------------------------------------------------------
@@ -123,9 +164,7 @@ var franzSharedClientKey franzSharedClientKeyType
 
 func getSharedClientRegister(res *service.Resources) *franzSharedClientRegister {
 	// Note: we avoid allocating `.clients` here because it would be unused in
-	// the majority of calls. The real world impact of this "optimisation"
-	// hasn't been tested, and so it might be worth adding it in favour of
-	// removing the `r.clients == nil` checks above.
+	// the majority of calls, reading from the nil map is safe.
 	reg, _ := res.GetOrSetGeneric(franzSharedClientKey, &franzSharedClientRegister{})
 	return reg.(*franzSharedClientRegister)
 }
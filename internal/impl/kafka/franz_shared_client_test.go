@@ -0,0 +1,125 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func newTestSharedClient(t *testing.T) *FranzSharedClientInfo {
+	t.Helper()
+
+	client, err := kgo.NewClient(kgo.SeedBrokers("localhost:9092"))
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+	return &FranzSharedClientInfo{Client: client}
+}
+
+func TestFranzSharedClientReferenceCounting(t *testing.T) {
+	res := service.MockResources()
+	info := newTestSharedClient(t)
+
+	err := FranzSharedClientUse("foo", res, func(*FranzSharedClientInfo) error { return nil })
+	require.ErrorIs(t, err, errSharedClientNameNotFound)
+	assert.Contains(t, err.Error(), "foo")
+
+	require.NoError(t, FranzSharedClientSet("foo", "a", info, res))
+	require.NoError(t, FranzSharedClientSet("foo", "b", &FranzSharedClientInfo{Client: info.Client}, res))
+	require.ErrorIs(t, FranzSharedClientSet("foo", "c", newTestSharedClient(t), res), errSharedClientNameDuplicate)
+
+	// Each owner holds a single reference, however many times it stores the
+	// client.
+	require.NoError(t, FranzSharedClientSet("foo", "a", info, res))
+
+	// The client remains shared until the last owner pops its reference.
+	popped, err := FranzSharedClientPop("foo", "a", res)
+	require.NoError(t, err)
+	assert.Nil(t, popped)
+	_, err = FranzSharedClientPop("foo", "a", res)
+	require.ErrorIs(t, err, errSharedClientNameNotFound)
+	_, err = FranzSharedClientPop("foo", "c", res)
+	require.ErrorIs(t, err, errSharedClientNameNotFound)
+	require.NoError(t, FranzSharedClientUse("foo", res, func(details *FranzSharedClientInfo) error {
+		assert.Same(t, info, details)
+		return nil
+	}))
+
+	popped, err = FranzSharedClientPop("foo", "b", res)
+	require.NoError(t, err)
+	assert.Same(t, info, popped)
+
+	_, err = FranzSharedClientPop("foo", "b", res)
+	require.ErrorIs(t, err, errSharedClientNameNotFound)
+	// Uses after the last reference was released can tell that the client is
+	// closing.
+	err = FranzSharedClientUse("foo", res, func(*FranzSharedClientInfo) error { return nil })
+	require.ErrorIs(t, err, ErrClientClosing)
+	assert.Contains(t, err.Error(), "foo")
+
+	// A different client can be stored once the previous one was popped.
+	other := newTestSharedClient(t)
+	require.NoError(t, FranzSharedClientSet("foo", "a", other, res))
+	require.NoError(t, FranzSharedClientUse("foo", res, func(details *FranzSharedClientInfo) error {
+		assert.Same(t, other, details)
+		return nil
+	}))
+}
+
+func TestFranzSharedClientConcurrentAccess(t *testing.T) {
+	res := service.MockResources()
+	info := newTestSharedClient(t)
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				require.NoError(t, FranzSharedClientSet("foo", i, info, res))
+				// The client can't be removed by other components while a
+				// reference to it is held.
+				assert.NoError(t, FranzSharedClientUse("foo", res, func(details *FranzSharedClientInfo) error {
+					assert.Same(t, info, details)
+					return nil
+				}))
+				_, err := FranzSharedClientPop("foo", i, res)
+				require.NoError(t, err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				err := FranzSharedClientUse("foo", res, func(details *FranzSharedClientInfo) error {
+					assert.Same(t, info, details)
+					return nil
+				})
+				if err != nil && !errors.Is(err, ErrClientClosing) {
+					assert.ErrorIs(t, err, errSharedClientNameNotFound)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	_, err := FranzSharedClientPop("foo", 0, res)
+	require.ErrorIs(t, err, errSharedClientNameNotFound)
+}
@@ -256,7 +256,11 @@ func FranzWriterConfigLints() string {
 type franzWriterHooks struct {
 	accessClientFn func(context.Context, FranzSharedClientUseFn) error
 	yieldClientFn  func(context.Context) error
-	writeHookFn    func(ctx context.Context, client *kgo.Client, records []*kgo.Record) error
+	batchHookFn    func(ctx context.Context, client *kgo.Client, batch service.MessageBatch) error
+	writeHookFn    func(ctx context.Context, client *kgo.Client, batch service.MessageBatch, records []*kgo.Record) error
+	recordClientFn func(ctx context.Context, record *kgo.Record) (*kgo.Client, error)
+	topicHookFn    func(ctx context.Context, client *kgo.Client, topic string, batch service.MessageBatch, records []*kgo.Record) error
+	transactional  bool
 }
 
 // NewFranzWriterHooks creates a new franzWriterHooks instance with a hook function that's executed to fetch the client.
@@ -270,12 +274,58 @@ func (h franzWriterHooks) WithYieldClientFn(fn func(context.Context) error) fran
 	return h
 }
 
-// WithWriteHookFn adds a hook function that's executed before a message batch is written.
-func (h franzWriterHooks) WithWriteHookFn(fn func(ctx context.Context, client *kgo.Client, records []*kgo.Record) error) franzWriterHooks {
+// WithBatchHookFn adds a hook function that's executed before the records of a message batch are built, so that the
+// metadata it sets on the messages is added to the records as headers when the metadata filter includes it.
+func (h franzWriterHooks) WithBatchHookFn(fn func(ctx context.Context, client *kgo.Client, batch service.MessageBatch) error) franzWriterHooks {
+	h.batchHookFn = fn
+	return h
+}
+
+// WithWriteHookFn adds a hook function that's executed before a message batch is written. The records are provided in
+// the same order as the messages of the batch they were created from. Records which the hook replaces with nil are not
+// produced.
+func (h franzWriterHooks) WithWriteHookFn(fn func(ctx context.Context, client *kgo.Client, batch service.MessageBatch, records []*kgo.Record) error) franzWriterHooks {
 	h.writeHookFn = fn
 	return h
 }
 
+// WithRecordClientFn adds a hook function that's executed for each record after the write hook in order to select the
+// client which produces it. Records for which the hook returns a nil client are produced with the shared client. It
+// can't be combined with transactions, which are bound to a single client.
+func (h franzWriterHooks) WithRecordClientFn(fn func(ctx context.Context, record *kgo.Record) (*kgo.Client, error)) franzWriterHooks {
+	h.recordClientFn = fn
+	return h
+}
+
+// WithTopicHookFn adds a hook function that's executed for each topic of a batch after the write hook, with the records
+// of other topics replaced with nil. The records of a topic are produced as soon as its hook returns, without waiting
+// for the hooks of the other topics, and they are not produced when it fails. Records which the hook replaces with nil
+// are not produced.
+func (h franzWriterHooks) WithTopicHookFn(fn func(ctx context.Context, client *kgo.Client, topic string, batch service.MessageBatch, records []*kgo.Record) error) franzWriterHooks {
+	h.topicHookFn = fn
+	return h
+}
+
+// WithTransactions makes the writer produce each batch within a transaction, which is only committed once all of its
+// records were produced successfully and is aborted otherwise, so that read_committed consumers never observe partial
+// batches. The client must be configured with a transactional ID. Transactions are serialised, so only a single batch is
+// produced at a time regardless of the number of batches in flight.
+func (h franzWriterHooks) WithTransactions() franzWriterHooks {
+	h.transactional = true
+	return h
+}
+
+// FranzAbortTransaction aborts the buffered records and the open transaction of a transactional client, if any.
+func FranzAbortTransaction(ctx context.Context, client *kgo.Client) error {
+	if err := client.AbortBufferedRecords(ctx); err != nil {
+		return fmt.Errorf("failed to abort buffered records: %w", err)
+	}
+	if err := client.EndTransaction(ctx, kgo.TryAbort); err != nil {
+		return fmt.Errorf("failed to abort transaction: %w", err)
+	}
+	return nil
+}
+
 // FranzWriter implements a Kafka writer using the franz-go library.
 type FranzWriter struct {
 	Topic         *service.InterpolatedString
@@ -285,6 +335,14 @@ type FranzWriter struct {
 	IsTimestampMs bool
 	MetaFilter    *service.MetadataFilter
 	hooks         franzWriterHooks
+
+	txnMut sync.Mutex
+
+	// Writes which are in progress, which Close waits for before yielding the
+	// client so that their records are still acknowledged.
+	inFlightMut sync.Mutex
+	inFlight    sync.WaitGroup
+	closing     bool
 }
 
 // NewFranzWriterFromConfig uses a parsed config to extract customisation for writing data to a Kafka broker. A closure
@@ -418,6 +476,11 @@ func (w *FranzWriter) Connect(ctx context.Context) error {
 		if err := details.Client.Ping(ctx); err != nil {
 			return fmt.Errorf("failed to connect to cluster: %s", err)
 		}
+		if w.hooks.transactional {
+			w.txnMut.Lock()
+			defer w.txnMut.Unlock()
+			return FranzAbortTransaction(ctx, details.Client)
+		}
 		return nil
 	})
 }
@@ -427,45 +490,169 @@ func (w *FranzWriter) WriteBatch(ctx context.Context, b service.MessageBatch) er
 	if len(b) == 0 {
 		return nil
 	}
+
+	w.inFlightMut.Lock()
+	if w.closing {
+		w.inFlightMut.Unlock()
+		return service.ErrNotConnected
+	}
+	w.inFlight.Add(1)
+	w.inFlightMut.Unlock()
+	defer w.inFlight.Done()
+
 	return w.hooks.accessClientFn(ctx, func(details *FranzSharedClientInfo) error {
+		if w.hooks.batchHookFn != nil {
+			if err := w.hooks.batchHookFn(ctx, details.Client, b); err != nil {
+				return fmt.Errorf("on batch hook failed: %s", err)
+			}
+		}
+
 		records, err := w.BatchToRecords(ctx, b)
 		if err != nil {
 			return err
 		}
 
 		if w.hooks.writeHookFn != nil {
-			if err := w.hooks.writeHookFn(ctx, details.Client, records); err != nil {
+			if err := w.hooks.writeHookFn(ctx, details.Client, b, records); err != nil {
 				return fmt.Errorf("on write hook failed: %s", err)
 			}
 		}
 
-		var (
-			wg      sync.WaitGroup
-			results = make(kgo.ProduceResults, 0, len(records))
-			promise = func(r *kgo.Record, err error) {
-				results = append(results, kgo.ProduceResult{Record: r, Err: err})
-				wg.Done()
-			}
-		)
+		if w.hooks.transactional {
+			w.txnMut.Lock()
+			defer w.txnMut.Unlock()
+			return w.produceTransaction(ctx, details.Client, b, records)
+		}
+		return w.produce(ctx, details.Client, b, records)
+	})
+}
+
+// produceTransaction produces the records within a transaction which is only committed when all of them were produced
+// successfully.
+func (w *FranzWriter) produceTransaction(ctx context.Context, client *kgo.Client, b service.MessageBatch, records []*kgo.Record) error {
+	if err := client.BeginTransaction(); err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err := w.produce(ctx, client, b, records); err != nil {
+		if abortErr := FranzAbortTransaction(ctx, client); abortErr != nil {
+			return errors.Join(err, abortErr)
+		}
+		return err
+	}
+
+	if err := client.EndTransaction(ctx, kgo.TryCommit); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
 
-		wg.Add(len(records))
+func (w *FranzWriter) produce(ctx context.Context, client *kgo.Client, b service.MessageBatch, records []*kgo.Record) error {
+	var (
+		wg sync.WaitGroup
+		// Promises are only serialised per client, while the records may be produced by multiple clients.
+		resultsMut sync.Mutex
+		results    = make(kgo.ProduceResults, 0, len(records))
+		promise    = func(r *kgo.Record, err error) {
+			resultsMut.Lock()
+			results = append(results, kgo.ProduceResult{Record: r, Err: err})
+			resultsMut.Unlock()
+			wg.Done()
+		}
+	)
+
+	// The clients of the records are selected before producing any of them, so that the batch isn't partially
+	// produced when the selection fails.
+	clients := make([]*kgo.Client, len(records))
+	for i, r := range records {
+		clients[i] = client
+		if r == nil || w.hooks.recordClientFn == nil {
+			continue
+		}
+		rc, err := w.hooks.recordClientFn(ctx, r)
+		if err != nil {
+			return err
+		}
+		if rc != nil {
+			clients[i] = rc
+		}
+	}
+
+	if w.hooks.topicHookFn == nil {
 		for i, r := range records {
-			details.Client.Produce(ctx, r, promise)
+			if r != nil {
+				wg.Add(1)
+				clients[i].Produce(ctx, r, promise)
+			}
 			dispatch.TriggerSignal(b[i].Context())
 		}
 		wg.Wait()
-
-		// TODO: This is very cool and allows us to easily return granular errors,
-		// so we should honor travis by doing it.
 		return results.FirstErr()
-	})
+	}
+
+	// The records of each topic are produced in order once the hook of the topic returns.
+	topicRecords := map[string][]*kgo.Record{}
+	topicIndexes := map[string][]int{}
+	for i, r := range records {
+		if r == nil {
+			dispatch.TriggerSignal(b[i].Context())
+			continue
+		}
+		if topicRecords[r.Topic] == nil {
+			topicRecords[r.Topic] = make([]*kgo.Record, len(records))
+		}
+		topicRecords[r.Topic][i] = r
+		topicIndexes[r.Topic] = append(topicIndexes[r.Topic], i)
+	}
+	for topic, tRecords := range topicRecords {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := w.hooks.topicHookFn(ctx, client, topic, b, tRecords)
+			if err != nil {
+				resultsMut.Lock()
+				results = append(results, kgo.ProduceResult{Err: err})
+				resultsMut.Unlock()
+			}
+			for _, i := range topicIndexes[topic] {
+				if r := tRecords[i]; r != nil && err == nil {
+					wg.Add(1)
+					clients[i].Produce(ctx, r, promise)
+				}
+				dispatch.TriggerSignal(b[i].Context())
+			}
+		}()
+	}
+	wg.Wait()
+
+	// TODO: This is very cool and allows us to easily return granular errors,
+	// so we should honor travis by doing it.
+	return results.FirstErr()
 }
 
-// Close calls into the provided yield client func.
+// Close waits for the writes which are in progress, bounded by the context,
+// and then calls into the provided yield client func. Writes which are
+// attempted once Close was called return service.ErrNotConnected.
 func (w *FranzWriter) Close(ctx context.Context) error {
-	if w.hooks.yieldClientFn != nil {
-		return w.hooks.yieldClientFn(ctx)
+	w.inFlightMut.Lock()
+	w.closing = true
+	w.inFlightMut.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		w.inFlight.Wait()
+		close(done)
+	}()
+
+	var waitErr error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		waitErr = fmt.Errorf("failed to wait for in-flight writes: %w", ctx.Err())
 	}
 
-	return nil
+	if w.hooks.yieldClientFn != nil {
+		return errors.Join(waitErr, w.hooks.yieldClientFn(ctx))
+	}
+	return waitErr
 }
@@ -0,0 +1,304 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+// shutdownTestWriter writes batches through a FranzWriter sharing a client, but the records are consumed by the write
+// hook rather than produced so that no broker is needed.
+type shutdownTestWriter struct {
+	*FranzWriter
+}
+
+func (w shutdownTestWriter) Connect(context.Context) error {
+	return nil
+}
+
+type shutdownTestRecorder struct {
+	started chan struct{}
+	release chan struct{}
+
+	mu      sync.Mutex
+	written map[string]int
+	writing int
+	yielded bool
+	// Writes which were still in progress when the client was yielded.
+	writingAtYield int
+}
+
+func newShutdownTestWriter(t *testing.T, name string, rec *shutdownTestRecorder, res *service.Resources) *FranzWriter {
+	t.Helper()
+
+	conf, err := service.NewConfigSpec().Fields(FranzWriterConfigFields()...).ParseYAML(`topic: foo`, nil)
+	require.NoError(t, err)
+
+	hooks := NewFranzWriterHooks(func(_ context.Context, fn FranzSharedClientUseFn) error {
+		return FranzSharedClientUse(name, res, fn)
+	}).WithYieldClientFn(func(context.Context) error {
+		rec.mu.Lock()
+		rec.yielded = true
+		rec.writingAtYield = rec.writing
+		rec.mu.Unlock()
+
+		info, err := FranzSharedClientPop(name, t, res)
+		if err != nil || info == nil {
+			return err
+		}
+		info.Client.Close()
+		return nil
+	}).WithWriteHookFn(func(_ context.Context, _ *kgo.Client, b service.MessageBatch, records []*kgo.Record) error {
+		rec.mu.Lock()
+		rec.writing++
+		rec.mu.Unlock()
+
+		rec.started <- struct{}{}
+		<-rec.release
+
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		for i, m := range b {
+			id, _ := m.MetaGet("id")
+			rec.written[id]++
+			records[i] = nil
+		}
+		rec.writing--
+		return nil
+	})
+
+	w, err := NewFranzWriterFromConfig(conf, hooks)
+	require.NoError(t, err)
+	return w
+}
+
+func TestFranzWriterCloseWaitsForInFlightWrites(t *testing.T) {
+	res := service.MockResources()
+	info := newTestSharedClient(t)
+	require.NoError(t, FranzSharedClientSet("foo", t, info, res))
+
+	rec := &shutdownTestRecorder{
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+		written: map[string]int{},
+	}
+	w := newShutdownTestWriter(t, "foo", rec, res)
+
+	const batches = 5
+	writeErrs := make(chan error, batches)
+	for i := range batches {
+		go func() {
+			msg := service.NewMessage(nil)
+			msg.MetaSetMut("id", fmt.Sprint(i))
+			writeErrs <- w.WriteBatch(context.Background(), service.MessageBatch{msg})
+		}()
+	}
+	for range batches {
+		<-rec.started
+	}
+
+	closeErr := make(chan error, 1)
+	go func() {
+		closeErr <- w.Close(context.Background())
+	}()
+
+	// Writes attempted once Close was called are rejected, while the client is only yielded once the writes in
+	// progress have completed.
+	require.Eventually(t, func() bool {
+		return errors.Is(w.WriteBatch(context.Background(), service.MessageBatch{service.NewMessage(nil)}), service.ErrNotConnected)
+	}, time.Second, time.Millisecond)
+	rec.mu.Lock()
+	assert.False(t, rec.yielded)
+	rec.mu.Unlock()
+
+	close(rec.release)
+	for range batches {
+		require.NoError(t, <-writeErrs)
+	}
+	require.NoError(t, <-closeErr)
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	assert.True(t, rec.yielded)
+	assert.Zero(t, rec.writingAtYield)
+	assert.Len(t, rec.written, batches)
+
+	err := FranzSharedClientUse("foo", res, func(*FranzSharedClientInfo) error { return nil })
+	require.ErrorIs(t, err, ErrClientClosing)
+}
+
+func TestFranzWriterCloseTimeout(t *testing.T) {
+	res := service.MockResources()
+	require.NoError(t, FranzSharedClientSet("foo", t, newTestSharedClient(t), res))
+
+	rec := &shutdownTestRecorder{
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+		written: map[string]int{},
+	}
+	w := newShutdownTestWriter(t, "foo", rec, res)
+
+	writeErr := make(chan error, 1)
+	go func() {
+		writeErr <- w.WriteBatch(context.Background(), service.MessageBatch{service.NewMessage(nil)})
+	}()
+	<-rec.started
+
+	// The client is still yielded when the writes in progress don't complete in time, although releasing it waits for
+	// the write which is using it.
+	ctx, done := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer done()
+	closeErr := make(chan error, 1)
+	go func() {
+		closeErr <- w.Close(ctx)
+	}()
+
+	require.Eventually(t, func() bool {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		return rec.yielded
+	}, time.Second, time.Millisecond)
+	rec.mu.Lock()
+	assert.Equal(t, 1, rec.writingAtYield)
+	rec.mu.Unlock()
+
+	close(rec.release)
+	require.NoError(t, <-writeErr)
+	require.ErrorIs(t, <-closeErr, context.DeadlineExceeded)
+}
+
+func TestFranzWriterStreamShutdown(t *testing.T) {
+	const (
+		producers = 8
+		batches   = 20
+	)
+
+	rec := &shutdownTestRecorder{
+		started: make(chan struct{}, producers*batches),
+		release: make(chan struct{}),
+		written: map[string]int{},
+	}
+
+	env := service.NewEnvironment()
+	require.NoError(t, env.RegisterBatchOutput("franz_writer_shutdown_test", service.NewConfigSpec(),
+		func(_ *service.ParsedConfig, mgr *service.Resources) (service.BatchOutput, service.BatchPolicy, int, error) {
+			// The shared client is owned by the output here, whereas it's usually owned by an input.
+			client, err := kgo.NewClient(kgo.SeedBrokers("localhost:9092"))
+			if err != nil {
+				return nil, service.BatchPolicy{}, 0, err
+			}
+			if err := FranzSharedClientSet("foo", t, &FranzSharedClientInfo{Client: client}, mgr); err != nil {
+				return nil, service.BatchPolicy{}, 0, err
+			}
+			return shutdownTestWriter{newShutdownTestWriter(t, "foo", rec, mgr)}, service.BatchPolicy{}, producers, nil
+		}))
+
+	builder := env.NewStreamBuilder()
+	require.NoError(t, builder.SetLoggerYAML(`level: none`))
+	produce, err := builder.AddBatchProducerFunc()
+	require.NoError(t, err)
+	require.NoError(t, builder.AddOutputYAML(`franz_writer_shutdown_test: {}`))
+
+	stream, err := builder.Build()
+	require.NoError(t, err)
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- stream.Run(context.Background())
+	}()
+
+	// Batches which are produced once the stream was stopped are abandoned.
+	produceCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var acked atomic.Int64
+	var wg sync.WaitGroup
+	for p := range producers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range batches {
+				msg := service.NewMessage(nil)
+				msg.MetaSetMut("id", fmt.Sprintf("%d-%d", p, b))
+				if err := produce(produceCtx, service.MessageBatch{msg}); err == nil {
+					acked.Add(1)
+				}
+			}
+		}()
+	}
+
+	// Stop the stream while batches are in flight and only let them complete afterwards.
+	<-rec.started
+	stopErr := make(chan error, 1)
+	go func() {
+		stopErr <- stream.StopWithin(10 * time.Second)
+	}()
+	close(rec.release)
+	require.NoError(t, <-stopErr)
+	require.NoError(t, <-runErr)
+	cancel()
+	wg.Wait()
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	assert.True(t, rec.yielded)
+	assert.Zero(t, rec.writingAtYield)
+	assert.NotZero(t, acked.Load())
+	assert.Equal(t, int64(len(rec.written)), acked.Load())
+	for id, n := range rec.written {
+		assert.Equal(t, 1, n, id)
+	}
+}
+
+func TestFranzWriterBatchHookMetadataIsWrittenAsHeaders(t *testing.T) {
+	res := service.MockResources()
+	require.NoError(t, FranzSharedClientSet("foo", t, newTestSharedClient(t), res))
+
+	conf, err := service.NewConfigSpec().Fields(FranzWriterConfigFields()...).ParseYAML(`
+topic: foo
+metadata:
+  include_patterns: [ "^schema_" ]
+`, nil)
+	require.NoError(t, err)
+
+	var headers []kgo.RecordHeader
+	hooks := NewFranzWriterHooks(func(_ context.Context, fn FranzSharedClientUseFn) error {
+		return FranzSharedClientUse("foo", res, fn)
+	}).WithBatchHookFn(func(_ context.Context, _ *kgo.Client, b service.MessageBatch) error {
+		b[0].MetaSetMut("schema_id", 7)
+		return nil
+	}).WithWriteHookFn(func(_ context.Context, _ *kgo.Client, _ service.MessageBatch, records []*kgo.Record) error {
+		headers = records[0].Headers
+		records[0] = nil
+		return nil
+	})
+
+	w, err := NewFranzWriterFromConfig(conf, hooks)
+	require.NoError(t, err)
+	require.NoError(t, w.WriteBatch(context.Background(), service.MessageBatch{service.NewMessage([]byte("foo"))}))
+	assert.Equal(t, []kgo.RecordHeader{{Key: "schema_id", Value: []byte("7")}}, headers)
+}
@@ -21,7 +21,9 @@ import (
 	"strings"
 )
 
-func parsePartitions(expr string) ([]int32, error) {
+// ParsePartitions parses a single partition such as `3` or an inclusive range
+// of partitions such as `0-10`.
+func ParsePartitions(expr string) ([]int32, error) {
 	if expr == "" {
 		return nil, errors.New("empty partition expression")
 	}
@@ -88,7 +90,7 @@ func ParseTopics(sourceTopics []string, defaultOffset int64, allowExplicitOffset
 
 			// Extract a single partition or a range of the form 0-10
 			var parts []int32
-			if parts, err = parsePartitions(splitByColon[1]); err != nil {
+			if parts, err = ParsePartitions(splitByColon[1]); err != nil {
 				return
 			}
 
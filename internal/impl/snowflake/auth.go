@@ -19,6 +19,8 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
+	"sync"
+	"time"
 
 	"github.com/redpanda-data/benthos/v4/public/service"
 	"github.com/youmark/pkcs8"
@@ -45,6 +47,45 @@ func getPrivateKeyFromFile(f fs.FS, path, passphrase string) (*rsa.PrivateKey, e
 	return getPrivateKey(privateKeyBytes, passphrase)
 }
 
+// privateKeyFile loads the private key from a file and tracks the modification time of the file when it was loaded,
+// so that a rotated key is reloaded when the file changes.
+type privateKeyFile struct {
+	fs         fs.FS
+	path       string
+	passphrase string
+
+	mu      sync.Mutex
+	modTime time.Time
+}
+
+// load reads and parses the private key from the file.
+func (f *privateKeyFile) load() (*rsa.PrivateKey, error) {
+	// The file is checked before it's read, so that a file which changes while it's read is loaded again.
+	info, err := fs.Stat(f.fs, f.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key %s: %s", f.path, err)
+	}
+	key, err := getPrivateKeyFromFile(f.fs, f.path, f.passphrase)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	f.modTime = info.ModTime()
+	f.mu.Unlock()
+	return key, nil
+}
+
+// changed returns true if the file was modified since the key was last loaded.
+func (f *privateKeyFile) changed() (bool, error) {
+	info, err := fs.Stat(f.fs, f.path)
+	if err != nil {
+		return false, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return !info.ModTime().Equal(f.modTime), nil
+}
+
 func getPrivateKey(privateKeyBytes []byte, passphrase string) (*rsa.PrivateKey, error) {
 	privateKeyBlock, _ := pem.Decode(privateKeyBytes)
 	if privateKeyBlock == nil {
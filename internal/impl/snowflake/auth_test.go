@@ -11,14 +11,26 @@
 package snowflake
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/golang-jwt/jwt"
+	"github.com/redpanda-data/benthos/v4/public/service"
 	"github.com/stretchr/testify/require"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/snowflake/streaming"
 )
 
 func generatePrivateKey() ([]byte, error) {
@@ -63,3 +75,95 @@ func TestPrivateKeyBase64Encoded(t *testing.T) {
 	_, err = getPrivateKey(k, "")
 	require.NoError(t, err)
 }
+
+// writePrivateKeyFile writes a new PEM encoded key to path with the modification time mtime and returns it.
+func writePrivateKeyFile(t *testing.T, path string, mtime time.Time) *rsa.PrivateKey {
+	t.Helper()
+	k, err := generatePEMEncodedKey()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, k, 0o600))
+	require.NoError(t, os.Chtimes(path, mtime, mtime))
+	key, err := getPrivateKey(k, "")
+	require.NoError(t, err)
+	return key
+}
+
+func TestPrivateKeyFileReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rsa_key.p8")
+	now := time.Now()
+	oldKey := writePrivateKeyFile(t, path, now.Add(-time.Hour))
+
+	keyFile := &privateKeyFile{fs: os.DirFS(dir), path: "rsa_key.p8"}
+	key, err := keyFile.load()
+	require.NoError(t, err)
+	require.True(t, oldKey.Equal(key))
+	keySource := streaming.NewPrivateKeySource(key, keyFile.load)
+
+	changed, err := keyFile.changed()
+	require.NoError(t, err)
+	require.False(t, changed)
+	reloadChangedPrivateKey(keyFile, keySource, service.MockResources().Logger())
+	require.Same(t, key, keySource.Key())
+
+	// A file which can't be loaded keeps the current key until it's fixed.
+	require.NoError(t, os.WriteFile(path, []byte("not a key"), 0o600))
+	reloadChangedPrivateKey(keyFile, keySource, service.MockResources().Logger())
+	require.Same(t, key, keySource.Key())
+
+	newKey := writePrivateKeyFile(t, path, now)
+	changed, err = keyFile.changed()
+	require.NoError(t, err)
+	require.True(t, changed)
+	reloadChangedPrivateKey(keyFile, keySource, service.MockResources().Logger())
+	require.True(t, newKey.Equal(keySource.Key()))
+
+	changed, err = keyFile.changed()
+	require.NoError(t, err)
+	require.False(t, changed)
+}
+
+func TestPrivateKeyFileRotationWithoutRestart(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rsa_key.p8")
+	now := time.Now()
+	oldKey := writePrivateKeyFile(t, path, now.Add(-time.Hour))
+
+	// The auth endpoint only accepts JWTs signed with the key which was last written to the file.
+	var accepted atomic.Pointer[rsa.PublicKey]
+	accepted.Store(&oldKey.PublicKey)
+	var rejected atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := jwt.Parse(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), func(*jwt.Token) (any, error) {
+			return accepted.Load(), nil
+		})
+		if err != nil {
+			rejected.Add(1)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	keyFile := &privateKeyFile{fs: os.DirFS(dir), path: "rsa_key.p8"}
+	key, err := keyFile.load()
+	require.NoError(t, err)
+	client, err := streaming.NewRestClient(streaming.RestOptions{
+		URL:              srv.URL,
+		PrivateKeySource: streaming.NewPrivateKeySource(key, keyFile.load),
+		Logger:           service.MockResources().Logger(),
+	})
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+
+	for i := range 10 {
+		if i == 5 {
+			newKey := writePrivateKeyFile(t, path, now)
+			accepted.Store(&newKey.PublicKey)
+		}
+		_, err := client.RunSQL(context.Background(), streaming.RunSQLRequest{Statement: "SELECT 1"})
+		require.NoError(t, err)
+	}
+	require.Equal(t, int64(1), rejected.Load())
+}
@@ -0,0 +1,231 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+
+package snowflake
+
+import (
+	"fmt"
+
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/snowflake/streaming"
+)
+
+// conversionFields are the fields which control how the values of messages are converted into the types of their
+// columns. They're shared by the snowflake_streaming output and the snowflake_schema_validate processor, so that the
+// processor validates messages exactly like the output converts them.
+func conversionFields() []*service.ConfigField {
+	return []*service.ConfigField{
+		dateFormatsField(),
+		dateIntegerUnitField(),
+		clampTimestampsField(),
+		caseSensitiveColumnsField(),
+		onConversionErrorField(),
+		onConversionErrorByColumnField(),
+		columnTransformsField(),
+		ignoreColumnsField(),
+	}
+}
+
+func dateFormatsField() *service.ConfigField {
+	return service.NewStringListField(ssoFieldDateFormats).
+		Description("A list of https://pkg.go.dev/time#pkg-constants[Go time layouts^] that are tried in order when converting string values into `DATE` columns. If none of the layouts match then the value is parsed as an RFC 3339 timestamp.").
+		Example([]string{"2006-01-02", "02/01/2006"}).
+		Optional().
+		Advanced()
+}
+
+func dateIntegerUnitField() *service.ConfigField {
+	return service.NewStringAnnotatedEnumField(ssoFieldDateIntegerUnit, map[string]string{
+		"epoch_seconds": "Integers are the number of seconds since the Unix epoch.",
+		"epoch_days":    "Integers are the number of days since the Unix epoch.",
+		"yyyymmdd":      "Integers are dates with the form `YYYYMMDD`, for example `20200721`.",
+	}).
+		Description("How integer values are interpreted when converting them into `DATE` columns.").
+		Default("epoch_seconds").
+		Advanced()
+}
+
+func clampTimestampsField() *service.ConfigField {
+	return service.NewBoolField(ssoFieldClampTimestamps).
+		Description("Replace timestamps which are outside of the range supported by their column with the closest supported timestamp instead of rejecting them. The range depends on the scale and physical type of the column and is at most the years 1 to 9999, so sentinel values such as `9999-12-31T23:59:59.999999999Z` may not fit into columns with a high scale. Clamped values are counted by the `snowflake_clamped_timestamps` counter, which is labelled with the table and column.").
+		Default(false).
+		Advanced()
+}
+
+func caseSensitiveColumnsField() *service.ConfigField {
+	return service.NewBoolField(ssoFieldCaseSensitiveColumns).
+		Description("Match message keys to column names exactly as they are returned by the table schema, including quoted mixed-case names such as `\"userId\"`. Otherwise message keys are converted to uppercase like unquoted identifiers in Snowflake, and the output fails to open channels for tables with columns that have the same name when compared case-insensitively. When enabled, columns created by schema evolution preserve the case of the message keys.").
+		Default(false).
+		Advanced()
+}
+
+func onConversionErrorField() *service.ConfigField {
+	return service.NewStringAnnotatedEnumField(ssoFieldOnConversionError, map[string]string{
+		"reject":     "Values that fail conversion result in an error for the whole batch.",
+		"write_null": "Values of nullable columns that fail conversion are written as `NULL` instead, values of columns that are not nullable are still rejected.",
+	}).
+		Description("How values that can't be converted into the type of their column are handled. When values are written as `NULL`, the `" + streaming.ConversionErrorsMetadataKey + "` metadata field of the message is set to an array of objects with the `column`, `value` and `error` of each of them, and the `snowflake_conversion_errors` counter, which is labelled with the table and column, is incremented.").
+		Default("reject").
+		Advanced()
+}
+
+func onConversionErrorByColumnField() *service.ConfigField {
+	return service.NewStringMapField(ssoFieldOnConversionErrorByColumn).
+		Description("Overrides `" + ssoFieldOnConversionError + "` for specific columns. The keys are column names, which are matched the same way as message keys, and the values are either `reject` or `write_null`.").
+		Example(map[string]any{"notes": "write_null", "amount": "reject"}).
+		Optional().
+		Advanced().
+		LintRule(`root = if this.type() == "object" { this.values().filter(v -> !["reject", "write_null"].contains(v)).map_each(v -> "invalid value %q, must be either reject or write_null".format(v)) }`)
+}
+
+func columnTransformsField() *service.ConfigField {
+	return service.NewStringMapField(ssoFieldColumnTransforms).
+		Description("Bloblang mappings that are applied to the values of specific columns before they are converted into the type of their column, such as to mask or hash sensitive data. The keys are column names, which are matched the same way as message keys, and must be columns of the table which are not listed in `" + ssoFieldIgnoreColumns + "`. Each mapping is executed with the raw value of the column as `this` and the metadata of the message, and the result is written instead, deleting the root writes `NULL`. A mapping can't write the string `null`, which is written as `NULL` too. Null and missing values are not transformed. Mappings that fail are handled according to `" + ssoFieldOnConversionError + "`, with the `value` left out of the `" + streaming.ConversionErrorsMetadataKey + "` metadata field. The file statistics only ever include the transformed values.").
+		Example(map[string]any{"email": `root = this.hash("sha256").encode("hex")`, "salary": "root = null"}).
+		Optional().
+		Advanced()
+}
+
+func ignoreColumnsField() *service.ConfigField {
+	return service.NewStringListField(ssoFieldIgnoreColumns).
+		Description("Columns that are excluded from ingestion entirely, such as computed columns. The names are matched the same way as message keys, which are dropped from every message. Identity and default columns are detected from the table and don't need to be listed here, messages may omit them and Snowflake fills in their values, although values for identity columns are rejected.").
+		Example([]string{"full_name"}).
+		Default([]any{}).
+		Advanced()
+}
+
+// conversionOptions are the parsed conversionFields.
+type conversionOptions struct {
+	dateFormats                []string
+	dateIntegerUnit            streaming.DateIntegerUnit
+	clampTimestamps            bool
+	caseSensitiveColumns       bool
+	conversionErrorMode        streaming.ConversionErrorMode
+	columnConversionErrorModes map[string]streaming.ConversionErrorMode
+	columnTransforms           map[string]*bloblang.Executor
+	ignoreColumns              []string
+}
+
+func conversionOptionsFromParsed(conf *service.ParsedConfig) (*conversionOptions, error) {
+	opts := &conversionOptions{}
+	var err error
+	if conf.Contains(ssoFieldDateFormats) {
+		opts.dateFormats, err = conf.FieldStringList(ssoFieldDateFormats)
+		if err != nil {
+			return nil, err
+		}
+	}
+	dateIntegerUnit, err := conf.FieldString(ssoFieldDateIntegerUnit)
+	if err != nil {
+		return nil, err
+	}
+	switch dateIntegerUnit {
+	case "epoch_seconds":
+		opts.dateIntegerUnit = streaming.DateIntegerUnitEpochSeconds
+	case "epoch_days":
+		opts.dateIntegerUnit = streaming.DateIntegerUnitEpochDays
+	case "yyyymmdd":
+		opts.dateIntegerUnit = streaming.DateIntegerUnitYYYYMMDD
+	default:
+		return nil, fmt.Errorf("unknown %s: %q", ssoFieldDateIntegerUnit, dateIntegerUnit)
+	}
+
+	opts.clampTimestamps, err = conf.FieldBool(ssoFieldClampTimestamps)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.caseSensitiveColumns, err = conf.FieldBool(ssoFieldCaseSensitiveColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	onConversionError, err := conf.FieldString(ssoFieldOnConversionError)
+	if err != nil {
+		return nil, err
+	}
+	opts.conversionErrorMode, err = parseConversionErrorMode(onConversionError)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ssoFieldOnConversionError, err)
+	}
+	if conf.Contains(ssoFieldOnConversionErrorByColumn) {
+		byColumn, err := conf.FieldStringMap(ssoFieldOnConversionErrorByColumn)
+		if err != nil {
+			return nil, err
+		}
+		opts.columnConversionErrorModes = make(map[string]streaming.ConversionErrorMode, len(byColumn))
+		for column, value := range byColumn {
+			if opts.columnConversionErrorModes[column], err = parseConversionErrorMode(value); err != nil {
+				return nil, fmt.Errorf("invalid %s for column %q: %w", ssoFieldOnConversionErrorByColumn, column, err)
+			}
+		}
+	}
+
+	if conf.Contains(ssoFieldColumnTransforms) {
+		transformConfs, err := conf.FieldAnyMap(ssoFieldColumnTransforms)
+		if err != nil {
+			return nil, err
+		}
+		opts.columnTransforms = make(map[string]*bloblang.Executor, len(transformConfs))
+		for column, transformConf := range transformConfs {
+			if opts.columnTransforms[column], err = transformConf.FieldBloblang(); err != nil {
+				return nil, fmt.Errorf("invalid %s for column %q: %w", ssoFieldColumnTransforms, column, err)
+			}
+		}
+	}
+
+	opts.ignoreColumns, err = conf.FieldStringList(ssoFieldIgnoreColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	// Whether the transformed columns exist is only known once the table is
+	// fetched, but the ones that can never match a column are rejected here.
+	ignored := make(map[string]struct{}, len(opts.ignoreColumns))
+	for _, column := range opts.ignoreColumns {
+		ignored[streaming.NormalizeColumnName(column, opts.caseSensitiveColumns)] = struct{}{}
+	}
+	for column := range opts.columnTransforms {
+		if column == "" {
+			return nil, fmt.Errorf("invalid %s: column names must not be empty", ssoFieldColumnTransforms)
+		}
+		if _, ok := ignored[streaming.NormalizeColumnName(column, opts.caseSensitiveColumns)]; ok {
+			return nil, fmt.Errorf("invalid %s: column %q is listed in %s", ssoFieldColumnTransforms, column, ssoFieldIgnoreColumns)
+		}
+	}
+	return opts, nil
+}
+
+func parseConversionErrorMode(s string) (streaming.ConversionErrorMode, error) {
+	switch s {
+	case "reject":
+		return streaming.ConversionErrorModeReject, nil
+	case "write_null":
+		return streaming.ConversionErrorModeNull, nil
+	default:
+		return 0, fmt.Errorf("unknown mode %q, must be either reject or write_null", s)
+	}
+}
+
+// channelOptions returns the options of the channels which convert the values like the conversion options.
+func (o *conversionOptions) channelOptions() streaming.ChannelOptions {
+	return streaming.ChannelOptions{
+		BuildOptions: streaming.BuildOptions{
+			DateFormats:     o.dateFormats,
+			DateIntegerUnit: o.dateIntegerUnit,
+			ClampTimestamps: o.clampTimestamps,
+		},
+		CaseSensitiveColumns:       o.caseSensitiveColumns,
+		ConversionErrorMode:        o.conversionErrorMode,
+		ColumnConversionErrorModes: o.columnConversionErrorModes,
+		ColumnTransforms:           o.columnTransforms,
+		IgnoreColumns:              o.ignoreColumns,
+	}
+}
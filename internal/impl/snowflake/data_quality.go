@@ -0,0 +1,161 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package snowflake
+
+import (
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/asyncroutine"
+	"github.com/redpanda-data/connect/v4/internal/impl/snowflake/streaming"
+)
+
+// dataQualityMonitor summarizes the values written to the columns of each table over a window, and reports the summary
+// as a log and metrics at the end of each window. The summaries are gathered by the channels while converting the
+// values, so the monitor only merges them once a batch is committed.
+type dataQualityMonitor struct {
+	logger           *service.Logger
+	rows             *service.MetricGauge
+	nulls            *service.MetricGauge
+	conversionErrors *service.MetricGauge
+	maxLength        *service.MetricGauge
+	loop             *asyncroutine.Periodic
+
+	mu          sync.Mutex
+	windowStart time.Time
+	tables      map[string]*streaming.ColumnSummaries
+
+	// The columns whose gauges were set by the last report, which are zeroed when the following window doesn't have
+	// them so that they don't keep the values of an earlier window.
+	reported          map[dataQualityColumn]struct{}
+	reportedMaxLength map[dataQualityColumn]struct{}
+}
+
+type dataQualityColumn struct {
+	table, column string
+}
+
+func newDataQualityMonitor(interval time.Duration, mgr *service.Resources) *dataQualityMonitor {
+	m := &dataQualityMonitor{
+		logger:           mgr.Logger(),
+		rows:             mgr.Metrics().NewGauge("snowflake_data_quality_rows", "table", "column"),
+		nulls:            mgr.Metrics().NewGauge("snowflake_data_quality_nulls", "table", "column"),
+		conversionErrors: mgr.Metrics().NewGauge("snowflake_data_quality_conversion_errors", "table", "column"),
+		maxLength:        mgr.Metrics().NewGauge("snowflake_data_quality_max_length", "table", "column"),
+		windowStart:      time.Now(),
+		tables:           map[string]*streaming.ColumnSummaries{},
+	}
+	m.loop = asyncroutine.NewPeriodic(interval, m.flush)
+	return m
+}
+
+func (m *dataQualityMonitor) start() {
+	if m != nil {
+		m.loop.Start()
+	}
+}
+
+// record adds the summaries of a committed batch to the current window of table.
+func (m *dataQualityMonitor) record(table string, summaries *streaming.ColumnSummaries) {
+	if m == nil || summaries == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	window, ok := m.tables[table]
+	if !ok {
+		window = &streaming.ColumnSummaries{}
+		m.tables[table] = window
+	}
+	window.Merge(summaries)
+}
+
+// flush reports the summaries of the current window and starts the next one.
+func (m *dataQualityMonitor) flush() {
+	m.mu.Lock()
+	tables, windowStart := m.tables, m.windowStart
+	m.tables, m.windowStart = map[string]*streaming.ColumnSummaries{}, time.Now()
+	m.mu.Unlock()
+
+	columns := make(map[string]map[string]streaming.ColumnSummary, len(tables))
+	for table, summaries := range tables {
+		columns[table] = summaries.Columns()
+	}
+	m.report(time.Since(windowStart).Round(time.Millisecond), columns)
+}
+
+// report sets the gauges of the columns of each table to their summary over the window and logs them.
+func (m *dataQualityMonitor) report(window time.Duration, tables map[string]map[string]streaming.ColumnSummary) {
+	reported := map[dataQualityColumn]struct{}{}
+	reportedMaxLength := map[dataQualityColumn]struct{}{}
+	for _, table := range slices.Sorted(maps.Keys(tables)) {
+		columns := tables[table]
+		summary := make(map[string]any, len(columns))
+		for column, s := range columns {
+			key := dataQualityColumn{table: table, column: column}
+			reported[key] = struct{}{}
+			m.rows.Set(s.Rows, table, column)
+			m.nulls.Set(s.Nulls, table, column)
+			m.conversionErrors.Set(s.ConversionErrors, table, column)
+			c := map[string]any{
+				"rows":                   s.Rows,
+				"nulls":                  s.Nulls,
+				"null_ratio":             ratio(s.Nulls, s.Rows),
+				"conversion_errors":      s.ConversionErrors,
+				"conversion_error_ratio": ratio(s.ConversionErrors, s.Rows),
+			}
+			if s.Min != nil {
+				c["min"], c["max"] = s.Min, s.Max
+			}
+			if s.MaxLength > 0 {
+				reportedMaxLength[key] = struct{}{}
+				m.maxLength.Set(s.MaxLength, table, column)
+				c["max_length"] = s.MaxLength
+			}
+			summary[column] = c
+		}
+		m.logger.With("table", table, "window", window.String(), "columns", summary).Infof("Data quality summary of table %s over the last %s", table, window)
+	}
+
+	for key := range m.reported {
+		if _, ok := reported[key]; !ok {
+			m.rows.Set(0, key.table, key.column)
+			m.nulls.Set(0, key.table, key.column)
+			m.conversionErrors.Set(0, key.table, key.column)
+		}
+	}
+	for key := range m.reportedMaxLength {
+		if _, ok := reportedMaxLength[key]; !ok {
+			m.maxLength.Set(0, key.table, key.column)
+		}
+	}
+	m.reported, m.reportedMaxLength = reported, reportedMaxLength
+}
+
+// close stops the periodic reports and reports the last window.
+func (m *dataQualityMonitor) close() {
+	if m == nil {
+		return
+	}
+	m.loop.Stop()
+	m.flush()
+}
+
+func ratio(n, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package snowflake
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/snowflake/streaming"
+)
+
+func TestDataQualityMonitorWindows(t *testing.T) {
+	m := newDataQualityMonitor(time.Hour, service.MockResources())
+	m.record("FOO", &streaming.ColumnSummaries{})
+	m.record("BAR", nil)
+	require.Len(t, m.tables, 1)
+
+	// Each window starts empty once the previous one was reported.
+	m.flush()
+	require.Empty(t, m.tables)
+
+	m.start()
+	m.record("FOO", &streaming.ColumnSummaries{})
+	m.close()
+	require.Empty(t, m.tables)
+
+	// Outputs without a monitor don't collect anything.
+	var disabled *dataQualityMonitor
+	disabled.start()
+	disabled.record("FOO", &streaming.ColumnSummaries{})
+	disabled.close()
+}
+
+// gaugeExporter records the latest value of every gauge keyed by its name and its table and column labels.
+type gaugeExporter struct {
+	mu     sync.Mutex
+	gauges map[string]int64
+}
+
+type noopMetric struct{}
+
+func (noopMetric) Incr(int64)   {}
+func (noopMetric) Timing(int64) {}
+
+type exportedGauge struct {
+	e   *gaugeExporter
+	key string
+}
+
+func (g exportedGauge) Set(value int64) {
+	g.e.mu.Lock()
+	g.e.gauges[g.key] = value
+	g.e.mu.Unlock()
+}
+
+func (*gaugeExporter) NewCounterCtor(string, ...string) service.MetricsExporterCounterCtor {
+	return func(...string) service.MetricsExporterCounter { return noopMetric{} }
+}
+
+func (*gaugeExporter) NewTimerCtor(string, ...string) service.MetricsExporterTimerCtor {
+	return func(...string) service.MetricsExporterTimer { return noopMetric{} }
+}
+
+func (e *gaugeExporter) NewGaugeCtor(name string, labelKeys ...string) service.MetricsExporterGaugeCtor {
+	return func(labelValues ...string) service.MetricsExporterGauge {
+		key := []string{name}
+		for i, label := range labelKeys {
+			if label == "table" || label == "column" {
+				key = append(key, labelValues[i])
+			}
+		}
+		return exportedGauge{e: e, key: strings.Join(key, ",")}
+	}
+}
+
+func (*gaugeExporter) Close(context.Context) error { return nil }
+
+func (e *gaugeExporter) gauge(key string) (int64, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	v, ok := e.gauges[key]
+	return v, ok
+}
+
+func TestDataQualityMonitorZeroesStaleGauges(t *testing.T) {
+	exporter := &gaugeExporter{gauges: map[string]int64{}}
+	var mgr *service.Resources
+	env := service.NewEnvironment()
+	require.NoError(t, env.RegisterMetricsExporter("gauges", service.NewConfigSpec(),
+		func(*service.ParsedConfig, *service.Logger) (service.MetricsExporter, error) {
+			return exporter, nil
+		}))
+	require.NoError(t, env.RegisterCache("resources", service.NewConfigSpec(),
+		func(_ *service.ParsedConfig, res *service.Resources) (service.Cache, error) {
+			mgr = res
+			return nil, nil
+		}))
+	builder := env.NewStreamBuilder()
+	require.NoError(t, builder.SetLoggerYAML(`level: none`))
+	require.NoError(t, builder.SetMetricsYAML(`gauges: {}`))
+	require.NoError(t, builder.AddCacheYAML(`
+label: foo
+resources: {}
+`))
+	_, err := builder.AddProducerFunc()
+	require.NoError(t, err)
+	require.NoError(t, builder.AddOutputYAML(`drop: {}`))
+	_, err = builder.Build()
+	require.NoError(t, err)
+	require.NotNil(t, mgr)
+
+	m := newDataQualityMonitor(time.Hour, mgr)
+	m.report(time.Minute, map[string]map[string]streaming.ColumnSummary{
+		"FOO": {
+			"A": {Rows: 10, Nulls: 2, ConversionErrors: 1, MaxLength: 8},
+			"B": {Rows: 10, Nulls: 10},
+		},
+		"BAR": {"C": {Rows: 5, Nulls: 1}},
+	})
+	v, ok := exporter.gauge("snowflake_data_quality_rows,FOO,A")
+	require.True(t, ok)
+	require.Equal(t, int64(10), v)
+	v, _ = exporter.gauge("snowflake_data_quality_max_length,FOO,A")
+	require.Equal(t, int64(8), v)
+	_, ok = exporter.gauge("snowflake_data_quality_max_length,FOO,B")
+	require.False(t, ok, "columns without a length don't report one")
+
+	// The table BAR and the column B aren't written during the next window, and the values of A are only nulls, so
+	// their gauges are zeroed rather than keeping the values of the previous window.
+	m.report(time.Minute, map[string]map[string]streaming.ColumnSummary{
+		"FOO": {"A": {Rows: 3, Nulls: 3}},
+	})
+	for key, expected := range map[string]int64{
+		"snowflake_data_quality_rows,FOO,A":              3,
+		"snowflake_data_quality_nulls,FOO,A":             3,
+		"snowflake_data_quality_conversion_errors,FOO,A": 0,
+		"snowflake_data_quality_max_length,FOO,A":        0,
+		"snowflake_data_quality_rows,FOO,B":              0,
+		"snowflake_data_quality_nulls,FOO,B":             0,
+		"snowflake_data_quality_rows,BAR,C":              0,
+		"snowflake_data_quality_nulls,BAR,C":             0,
+	} {
+		v, ok := exporter.gauge(key)
+		require.True(t, ok, key)
+		require.Equal(t, expected, v, key)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+
+package snowflake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/snowflake/streaming"
+)
+
+// declaredColumn is a column declared in the `columns` field, which is used for creating the table and adding columns
+// to it instead of inferring the column types from the data.
+type declaredColumn struct {
+	// The name of the column in the form message keys are matched against it.
+	name string
+	// The quoted name of the column, which is safe to use in SQL statements.
+	sqlName string
+	// The validated Snowflake data type of the column.
+	dataType string
+}
+
+// declaredColumns are keyed by the name the column is matched against.
+type declaredColumns map[string]declaredColumn
+
+func newDeclaredColumns(columns map[string]string, caseSensitive bool) (declaredColumns, error) {
+	declared := make(declaredColumns, len(columns))
+	for rawName, dataType := range columns {
+		if err := validateColumnType(dataType); err != nil {
+			return nil, fmt.Errorf("invalid type for column %q: %w", rawName, err)
+		}
+		name := streaming.NormalizeColumnName(rawName, caseSensitive)
+		if _, exists := declared[name]; exists {
+			return nil, fmt.Errorf("column %q is declared more than once", name)
+		}
+		// The normalized name is the exact name of the column, so it's quoted as is.
+		sqlName := streaming.NewCaseSensitiveMissingColumnError(nil, name, nil).ColumnName()
+		declared[name] = declaredColumn{name: name, sqlName: sqlName, dataType: strings.TrimSpace(dataType)}
+	}
+	return declared, nil
+}
+
+// sorted returns the columns ordered by name, so that the statements which are generated from them are deterministic.
+func (c declaredColumns) sorted() []declaredColumn {
+	columns := make([]declaredColumn, 0, len(c))
+	for _, col := range c {
+		columns = append(columns, col)
+	}
+	slices.SortFunc(columns, func(a, b declaredColumn) int {
+		return strings.Compare(a.name, b.name)
+	})
+	return columns
+}
+
+// missingFrom returns the declared columns which match non-null keys of the batch that the channel doesn't know about.
+func (c declaredColumns) missingFrom(channel *streaming.SnowflakeIngestionChannel, batch service.MessageBatch) []declaredColumn {
+	if len(c) == 0 {
+		return nil
+	}
+	var missing []declaredColumn
+	for _, name := range channel.UnknownColumns(batch) {
+		if col, ok := c[name]; ok {
+			missing = append(missing, col)
+		}
+	}
+	return missing
+}
+
+// addColumnsError returns an error which makes the output add the missing columns and reopen its channels before
+// retrying the batch.
+func addColumnsError(missing []declaredColumn) error {
+	return &schemaMigrationNeededError{
+		runMigration: func(ctx context.Context, evolver *snowpipeSchemaEvolver) error {
+			return evolver.AddDeclaredColumns(ctx, missing)
+		},
+	}
+}
+
+// canCreateTable returns true if the evolver creates the table when writing to a table which doesn't exist.
+func (o *snowpipeSchemaEvolver) canCreateTable() bool {
+	return o.autoCreateTable || o.mode != streaming.SchemaModeIgnoreExtra
+}
+
+// PrepareTable creates the table from the declared columns if it doesn't exist and checks that the role is allowed to
+// add columns to it, so that missing privileges are reported when connecting instead of when the first batch needs them.
+func (o *snowpipeSchemaEvolver) PrepareTable(ctx context.Context) error {
+	if o.autoCreateTable {
+		if err := o.CreateDeclaredTable(ctx); err != nil {
+			return err
+		}
+	}
+	if o.autoAddColumns {
+		if err := o.checkTableOwnership(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateDeclaredTable creates the table with all the declared columns if it doesn't exist.
+func (o *snowpipeSchemaEvolver) CreateDeclaredTable(ctx context.Context) error {
+	columns := []string{}
+	for _, col := range o.declaredColumns.sorted() {
+		columns = append(columns, fmt.Sprintf("%s %s", col.sqlName, col.dataType))
+	}
+	o.logger.Debugf("ensuring table %s exists with columns: %s", o.table, strings.Join(columns, ", "))
+	err := o.RunSQLMigration(
+		ctx,
+		// The column names are quoted and the data types are validated when the config is parsed, see
+		// CreateOutputTable for why this matters.
+		fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS IDENTIFIER(?) (%s) COMMENT = 'table created from declared columns by Redpanda Connect'`,
+			strings.Join(columns, ", "),
+		),
+	)
+	switch {
+	case err == nil:
+		return nil
+	case streaming.IsAlreadyExistsError(err):
+		// Another output created the table concurrently.
+		return nil
+	case streaming.IsInsufficientPrivilegesError(err):
+		return fmt.Errorf(
+			"unable to create table %s, role %s is missing the CREATE TABLE privilege, which can be granted with `GRANT CREATE TABLE ON SCHEMA %s.%s TO ROLE %s`: %w",
+			o.table, o.role, o.db, o.schema, o.role, err,
+		)
+	default:
+		return fmt.Errorf("unable to create table %s: %w", o.table, err)
+	}
+}
+
+// AddDeclaredColumns adds the missing declared columns to the table.
+func (o *snowpipeSchemaEvolver) AddDeclaredColumns(ctx context.Context, missing []declaredColumn) error {
+	for _, col := range missing {
+		o.logger.Infof("identified declared column missing from table - attempting to alter table to add column: %s %s", col.sqlName, col.dataType)
+		err := o.RunSQLMigration(
+			ctx,
+			fmt.Sprintf(`ALTER TABLE IDENTIFIER(?)
+    ADD COLUMN IF NOT EXISTS %s %s
+      COMMENT 'column created from declared columns by Redpanda Connect'`,
+				col.sqlName,
+				col.dataType,
+			),
+		)
+		switch {
+		case err == nil, streaming.IsAlreadyExistsError(err):
+		case streaming.IsInsufficientPrivilegesError(err):
+			return fmt.Errorf("unable to add column %s to table %s: %w", col.sqlName, o.table, o.ownershipError(err))
+		default:
+			return fmt.Errorf("unable to add column %s to table %s: %w", col.sqlName, o.table, err)
+		}
+	}
+	return nil
+}
+
+// checkTableOwnership checks that the role owns the table, which is required for adding columns to it. Tables which
+// don't exist are skipped, because they are either created by this output or opening channels fails anyway.
+func (o *snowpipeSchemaEvolver) checkTableOwnership(ctx context.Context) error {
+	resp, err := o.restClient.RunSQL(ctx, streaming.RunSQLRequest{
+		Statement: `SELECT IS_ROLE_IN_SESSION(TABLE_OWNER) FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?`,
+		Timeout:   30,
+		Database:  o.db,
+		Schema:    o.schema,
+		Role:      o.role,
+		Bindings: map[string]streaming.BindingValue{
+			"1": {Type: "TEXT", Value: o.schema},
+			"2": {Type: "TEXT", Value: streaming.NormalizeColumnName(o.table, false)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to check the owner of table %s: %w", o.table, err)
+	}
+	if len(resp.Data) == 0 || len(resp.Data[0]) == 0 {
+		return nil
+	}
+	if !strings.EqualFold(resp.Data[0][0], "true") {
+		return o.ownershipError(nil)
+	}
+	return nil
+}
+
+func (o *snowpipeSchemaEvolver) ownershipError(err error) error {
+	msg := fmt.Sprintf(
+		"role %s must have the OWNERSHIP privilege on table %s for adding columns to it, which can be granted with `GRANT OWNERSHIP ON TABLE %s.%s.%s TO ROLE %s COPY CURRENT GRANTS`",
+		o.role, o.table, o.db, o.schema, o.table, o.role,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+	return errors.New(msg)
+}
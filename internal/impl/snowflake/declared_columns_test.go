@@ -0,0 +1,41 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+
+package snowflake
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDeclaredColumns(t *testing.T) {
+	columns, err := newDeclaredColumns(map[string]string{
+		"id":         "NUMBER(38, 0)",
+		"created_at": " TIMESTAMP_NTZ ",
+		`"Name"`:     "STRING",
+	}, false)
+	require.NoError(t, err)
+	require.Equal(t, []declaredColumn{
+		{name: "CREATED_AT", sqlName: `"CREATED_AT"`, dataType: "TIMESTAMP_NTZ"},
+		{name: "ID", sqlName: `"ID"`, dataType: "NUMBER(38, 0)"},
+		{name: "Name", sqlName: `"Name"`, dataType: "STRING"},
+	}, columns.sorted())
+
+	columns, err = newDeclaredColumns(map[string]string{"createdAt": "DATE"}, true)
+	require.NoError(t, err)
+	require.Equal(t, []declaredColumn{
+		{name: "createdAt", sqlName: `"createdAt"`, dataType: "DATE"},
+	}, columns.sorted())
+
+	_, err = newDeclaredColumns(map[string]string{"id": "NUMBER; DROP TABLE foo"}, false)
+	require.ErrorContains(t, err, `invalid type for column "id"`)
+
+	_, err = newDeclaredColumns(map[string]string{"id": "NUMBER", "ID": "STRING"}, false)
+	require.ErrorContains(t, err, `column "ID" is declared more than once`)
+}
@@ -17,6 +17,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -212,6 +213,72 @@ snowflake_streaming:
 	}, rows)
 }
 
+func TestIntegrationExactlyOnceReplayAfterCrash(t *testing.T) {
+	integration.CheckSkip(t)
+	batch := func(from, to int) []map[string]any {
+		var rows []map[string]any
+		for token := from; token <= to; token++ {
+			rows = append(rows, map[string]any{"token": token})
+		}
+		return rows
+	}
+	// The batch is committed to the table, but the pipeline fails before it's acknowledged, like it does when the
+	// process crashes between uploading the batch and acknowledging it to the input.
+	crashedProduce, crashedStream := SetupSnowflakeStream(t, `
+label: crashed
+broker:
+  pattern: fan_out_sequential_fail_fast
+  outputs:
+    - snowflake_streaming:
+        account: "$ACCOUNT"
+        user: "$USER"
+        role: $ROLE
+        database: "$DB"
+        schema: $SCHEMA
+        private_key_file: "$PRIVATE_KEY_FILE"
+        table: integration_test_exactly_once_replay
+        init_statement: |
+          DROP TABLE IF EXISTS integration_test_exactly_once_replay;
+        max_in_flight: 1
+        offset_token: "${!this.token}"
+        schema_evolution:
+          enabled: true
+    - reject: crashed before acknowledging the batch
+`)
+	RunStreamInBackground(t, crashedStream)
+	require.Error(t, crashedProduce(batch(1, 10)))
+
+	// After restarting, the input replays the unacknowledged batch together with the following messages. The
+	// unpadded numeric tokens are compared numerically, so only the messages which weren't committed are written.
+	produce, stream := SetupSnowflakeStream(t, `
+label: restarted
+snowflake_streaming:
+  account: "$ACCOUNT"
+  user: "$USER"
+  role: $ROLE
+  database: "$DB"
+  schema: $SCHEMA
+  private_key_file: "$PRIVATE_KEY_FILE"
+  table: integration_test_exactly_once_replay
+  max_in_flight: 1
+  offset_token: "${!this.token}"
+  schema_evolution:
+    enabled: true
+`)
+	RunStreamInBackground(t, stream)
+	require.NoError(t, produce(batch(1, 12)))
+	rows := RunSQLQuery(
+		t,
+		stream,
+		`SELECT token, COUNT(*) FROM integration_test_exactly_once_replay GROUP BY token ORDER BY token`,
+	)
+	expected := [][]string{}
+	for token := 1; token <= 12; token++ {
+		expected = append(expected, []string{strconv.Itoa(token), "1"})
+	}
+	require.Equal(t, expected, rows)
+}
+
 func TestIntegrationNamedChannels(t *testing.T) {
 	integration.CheckSkip(t)
 	produce, stream := SetupSnowflakeStream(t, `
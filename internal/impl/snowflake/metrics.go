@@ -11,6 +11,8 @@
 package snowflake
 
 import (
+	"errors"
+	"sync"
 	"time"
 
 	"github.com/redpanda-data/benthos/v4/public/service"
@@ -26,26 +28,107 @@ type snowpipeMetrics struct {
 	serializeTime    *service.MetricTimer
 	registerTime     *service.MetricTimer
 	commitTime       *service.MetricTimer
+	fileSize         *service.MetricGauge
+	fileRows         *service.MetricGauge
+	fileFlushTime    *service.MetricTimer
+	distinctValues   *service.MetricGauge
+	schemaRefreshes  *service.MetricCounter
+	serverErrors     *service.MetricCounter
+	conversionErrors *service.MetricCounter
+	clampedValues    *service.MetricCounter
+	channelsOpened   *service.MetricCounter
+	channelsClosed   *service.MetricCounter
+	tablesOpened     *service.MetricCounter
+	tablesClosed     *service.MetricCounter
+	channelRows      *service.MetricCounter
+	registerRetries  *service.MetricCounter
+	pendingRegisters *service.MetricGauge
+	mappedMessages   *service.MetricCounter
+	mappedRows       *service.MetricCounter
+
+	pendingMu sync.Mutex
+	pending   map[string]int64
 }
 
 func newSnowpipeMetrics(m *service.Metrics) *snowpipeMetrics {
 	return &snowpipeMetrics{
-		buildTime:        m.NewTimer("snowflake_build_output_latency_ns"),
-		uploadTime:       m.NewTimer("snowflake_upload_latency_ns"),
-		convertTime:      m.NewTimer("snowflake_convert_latency_ns"),
-		serializeTime:    m.NewTimer("snowflake_serialize_latency_ns"),
-		registerTime:     m.NewTimer("snowflake_register_latency_ns"),
-		commitTime:       m.NewTimer("snowflake_commit_latency_ns"),
-		compressedOutput: m.NewCounter("snowflake_compressed_output_size_bytes"),
+		buildTime:        m.NewTimer("snowflake_build_output_latency_ns", "table"),
+		uploadTime:       m.NewTimer("snowflake_upload_latency_ns", "table"),
+		convertTime:      m.NewTimer("snowflake_convert_latency_ns", "table"),
+		serializeTime:    m.NewTimer("snowflake_serialize_latency_ns", "table"),
+		registerTime:     m.NewTimer("snowflake_register_latency_ns", "table"),
+		commitTime:       m.NewTimer("snowflake_commit_latency_ns", "table"),
+		fileSize:         m.NewGauge("snowflake_file_size_bytes", "table"),
+		fileRows:         m.NewGauge("snowflake_file_rows", "table"),
+		fileFlushTime:    m.NewTimer("snowflake_file_flush_latency_ns", "table"),
+		compressedOutput: m.NewCounter("snowflake_compressed_output_size_bytes", "table"),
+		distinctValues:   m.NewGauge("snowflake_column_distinct_values", "table", "column"),
+		schemaRefreshes:  m.NewCounter("snowflake_schema_refresh_column_changes", "table"),
+		serverErrors:     m.NewCounter("snowflake_server_errors", "table", "code"),
+		conversionErrors: m.NewCounter("snowflake_conversion_errors", "table", "column"),
+		clampedValues:    m.NewCounter("snowflake_clamped_timestamps", "table", "column"),
+		channelsOpened:   m.NewCounter("snowflake_channels_opened", "table"),
+		channelsClosed:   m.NewCounter("snowflake_channels_closed", "table"),
+		tablesOpened:     m.NewCounter("snowflake_tables_opened", "table"),
+		tablesClosed:     m.NewCounter("snowflake_tables_closed", "table"),
+		channelRows:      m.NewCounter("snowflake_channel_rows", "table", "channel"),
+		registerRetries:  m.NewCounter("snowflake_register_retries", "table"),
+		pendingRegisters: m.NewGauge("snowflake_pending_registrations", "table"),
+		mappedMessages:   m.NewCounter("snowflake_row_mapping_messages", "table"),
+		mappedRows:       m.NewCounter("snowflake_row_mapping_rows", "table"),
+		pending:          map[string]int64{},
+	}
+}
+
+func (m *snowpipeMetrics) Report(table string, stats streaming.InsertStats, commitTime time.Duration) {
+	m.compressedOutput.Incr(int64(stats.CompressedOutputSize), table)
+	m.uploadTime.Timing(stats.UploadTime.Nanoseconds(), table)
+	m.buildTime.Timing(stats.BuildTime.Nanoseconds(), table)
+	m.convertTime.Timing(stats.ConvertTime.Nanoseconds(), table)
+	m.serializeTime.Timing(stats.SerializeTime.Nanoseconds(), table)
+	m.registerTime.Timing(stats.RegisterTime.Nanoseconds(), table)
+	m.commitTime.Timing(commitTime.Nanoseconds(), table)
+	for _, file := range stats.Files {
+		m.fileSize.Set(int64(file.Size), table)
+		m.fileRows.Set(file.Rows, table)
+		m.fileFlushTime.Timing((file.BuildTime + file.UploadTime + file.RegisterTime).Nanoseconds(), table)
+		m.registerRetries.Incr(int64(file.RegisterRetries), table)
+	}
+	for column, ndv := range stats.ColumnDistinctValues {
+		m.distinctValues.Set(ndv, table, column)
+	}
+	for column, count := range stats.ColumnConversionErrors {
+		m.conversionErrors.Incr(count, table, column)
+	}
+	for column, count := range stats.ColumnClampedValues {
+		m.clampedValues.Incr(count, table, column)
 	}
 }
 
-func (m *snowpipeMetrics) Report(stats streaming.InsertStats, commitTime time.Duration) {
-	m.compressedOutput.Incr(int64(stats.CompressedOutputSize))
-	m.uploadTime.Timing(stats.UploadTime.Nanoseconds())
-	m.buildTime.Timing(stats.BuildTime.Nanoseconds())
-	m.convertTime.Timing(stats.ConvertTime.Nanoseconds())
-	m.serializeTime.Timing(stats.SerializeTime.Nanoseconds())
-	m.registerTime.Timing(stats.RegisterTime.Nanoseconds())
-	m.commitTime.Timing(commitTime.Nanoseconds())
+// PendingRegistration tracks the number of files of the table which are
+// uploaded but not yet registered, as they are queued and registered.
+func (m *snowpipeMetrics) PendingRegistration(table string, delta int) {
+	m.pendingMu.Lock()
+	defer m.pendingMu.Unlock()
+	n := m.pending[table] + int64(delta)
+	if n == 0 {
+		delete(m.pending, table)
+	} else {
+		m.pending[table] = n
+	}
+	m.pendingRegisters.Set(n, table)
+}
+
+// ReportRowMapping counts the messages of a batch that the row mapping was executed on and the rows that resulted.
+func (m *snowpipeMetrics) ReportRowMapping(table string, messages, rows int) {
+	m.mappedMessages.Incr(int64(messages), table)
+	m.mappedRows.Incr(int64(rows), table)
+}
+
+// ReportError counts errors which contain an error code returned by Snowflake.
+func (m *snowpipeMetrics) ReportError(table string, err error) {
+	var sfErr streaming.SnowflakeError
+	if errors.As(err, &sfErr) {
+		m.serverErrors.Incr(1, table, sfErr.SFCode())
+	}
 }
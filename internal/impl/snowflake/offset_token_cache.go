@@ -0,0 +1,83 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package snowflake
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/snowflake/streaming"
+)
+
+// offsetTokenPublisher exposes the offset tokens committed through the channels of a table, so that the input of the
+// pipeline can resume from them. The tokens are logged when a channel is opened and, if a cache resource is
+// configured, stored in it under the name of the table and channel each time they are committed, since channels of
+// different tables, such as those of a dynamic table, may share the same name.
+type offsetTokenPublisher struct {
+	cache  string
+	table  string
+	mgr    *service.Resources
+	logger *service.Logger
+}
+
+func newOffsetTokenPublisher(cache, table string, mgr *service.Resources) *offsetTokenPublisher {
+	return &offsetTokenPublisher{cache: cache, table: table, mgr: mgr, logger: mgr.Logger()}
+}
+
+// checkCache returns an error if the cache resource doesn't exist.
+func (p *offsetTokenPublisher) checkCache() error {
+	if p.cache != "" && !p.mgr.HasCache(p.cache) {
+		return fmt.Errorf("cache resource %q for `%s` not found", p.cache, ssoFieldOffsetTokenCache)
+	}
+	return nil
+}
+
+// opened publishes the offset token which was committed through the channel before it was opened.
+func (p *offsetTokenPublisher) opened(ctx context.Context, channel *streaming.SnowflakeIngestionChannel) {
+	token := channel.LatestOffsetToken()
+	if token == nil {
+		p.logger.Infof("Channel %s of table %s has no committed offset token", channel.Name, p.table)
+		return
+	}
+	p.logger.Infof("Channel %s of table %s resumes from committed offset token %q", channel.Name, p.table, string(*token))
+	p.store(ctx, channel.Name, *token)
+}
+
+// committed publishes the latest offset token which was committed through the channel.
+func (p *offsetTokenPublisher) committed(ctx context.Context, channel *streaming.SnowflakeIngestionChannel) {
+	if token := channel.LatestOffsetToken(); token != nil {
+		p.store(ctx, channel.Name, *token)
+	}
+}
+
+// cacheKey returns the key under which the offset token of a channel of the table is stored.
+func (p *offsetTokenPublisher) cacheKey(channelName string) string {
+	return p.table + "/" + channelName
+}
+
+func (p *offsetTokenPublisher) store(ctx context.Context, channelName string, token streaming.OffsetToken) {
+	if p.cache == "" {
+		return
+	}
+	var setErr error
+	if err := p.mgr.AccessCache(ctx, p.cache, func(c service.Cache) {
+		setErr = c.Set(ctx, p.cacheKey(channelName), []byte(token), nil)
+	}); err != nil {
+		setErr = err
+	}
+	// The offset token of the channel remains the source of truth for skipping duplicates, so failing to store it
+	// doesn't fail the write.
+	if setErr != nil {
+		p.logger.Warnf("Failed to store offset token %q of channel %s in cache %s: %v", string(token), channelName, p.cache, setErr)
+	}
+}
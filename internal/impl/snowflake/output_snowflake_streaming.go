@@ -9,6 +9,7 @@
 package snowflake
 
 import (
+	"cmp"
 	"context"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -16,6 +17,8 @@ import (
 	"errors"
 	"fmt"
 	neturl "net/url"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -23,38 +26,79 @@ import (
 	"github.com/redpanda-data/benthos/v4/public/bloblang"
 	"github.com/redpanda-data/benthos/v4/public/service"
 
+	"github.com/redpanda-data/connect/v4/internal/asyncroutine"
 	"github.com/redpanda-data/connect/v4/internal/impl/snowflake/streaming"
 	"github.com/redpanda-data/connect/v4/internal/license"
 	"github.com/redpanda-data/connect/v4/internal/pool"
 )
 
 const (
-	ssoFieldAccount                             = "account"
-	ssoFieldURL                                 = "url"
-	ssoFieldUser                                = "user"
-	ssoFieldRole                                = "role"
-	ssoFieldDB                                  = "database"
-	ssoFieldSchema                              = "schema"
-	ssoFieldTable                               = "table"
-	ssoFieldKey                                 = "private_key"
-	ssoFieldKeyFile                             = "private_key_file"
-	ssoFieldKeyPass                             = "private_key_pass"
-	ssoFieldInitStatement                       = "init_statement"
-	ssoFieldBatching                            = "batching"
-	ssoFieldChannelPrefix                       = "channel_prefix"
-	ssoFieldChannelName                         = "channel_name"
-	ssoFieldOffsetToken                         = "offset_token"
-	ssoFieldMapping                             = "mapping"
-	ssoFieldBuildOpts                           = "build_options"
-	ssoFieldBuildParallelismLegacy              = "build_parallelism"
-	ssoFieldBuildParallelism                    = "parallelism"
-	ssoFieldBuildChunkSize                      = "chunk_size"
-	ssoFieldSchemaEvolution                     = "schema_evolution"
-	ssoFieldSchemaEvolutionEnabled              = "enabled"
-	ssoFieldSchemaEvolutionIgnoreNulls          = "ignore_nulls"
-	ssoFieldSchemaEvolutionNewColumnTypeMapping = "new_column_type_mapping"
-	ssoFieldSchemaEvolutionProcessors           = "processors"
-	ssoFieldCommitTimeout                       = "commit_timeout"
+	ssoFieldAccount                               = "account"
+	ssoFieldURL                                   = "url"
+	ssoFieldUser                                  = "user"
+	ssoFieldRole                                  = "role"
+	ssoFieldDB                                    = "database"
+	ssoFieldSchema                                = "schema"
+	ssoFieldTable                                 = "table"
+	ssoFieldMaxTables                             = "max_tables"
+	ssoFieldKey                                   = "private_key"
+	ssoFieldKeyFile                               = "private_key_file"
+	ssoFieldKeyPass                               = "private_key_pass"
+	ssoFieldKeyRefreshInterval                    = "private_key_refresh_interval"
+	ssoFieldInitStatement                         = "init_statement"
+	ssoFieldBatching                              = "batching"
+	ssoFieldChannelPrefix                         = "channel_prefix"
+	ssoFieldChannelName                           = "channel_name"
+	ssoFieldOffsetToken                           = "offset_token"
+	ssoFieldOffsetTokenCache                      = "offset_token_cache"
+	ssoFieldMaxOpenChannels                       = "max_open_channels"
+	ssoFieldMapping                               = "mapping"
+	ssoFieldRowMapping                            = "row_mapping"
+	ssoFieldBuildOpts                             = "build_options"
+	ssoFieldBuildParallelismLegacy                = "build_parallelism"
+	ssoFieldBuildParallelism                      = "parallelism"
+	ssoFieldBuildChunkSize                        = "chunk_size"
+	ssoFieldBuildColumnParallelism                = "column_parallelism"
+	ssoFieldDateFormats                           = "date_formats"
+	ssoFieldDateIntegerUnit                       = "date_integer_unit"
+	ssoFieldClampTimestamps                       = "clamp_timestamps"
+	ssoFieldCaseSensitiveColumns                  = "case_sensitive_columns"
+	ssoFieldCollectColumnNDV                      = "collect_column_ndv"
+	ssoFieldStageMetadata                         = "stage_metadata"
+	ssoFieldDataQualityInterval                   = "data_quality_interval"
+	ssoFieldSchemaEvolution                       = "schema_evolution"
+	ssoFieldSchemaEvolutionEnabled                = "enabled"
+	ssoFieldSchemaEvolutionIgnoreNulls            = "ignore_nulls"
+	ssoFieldSchemaEvolutionNewColumnTypeMapping   = "new_column_type_mapping"
+	ssoFieldSchemaEvolutionProcessors             = "processors"
+	ssoFieldCommitTimeout                         = "commit_timeout"
+	ssoFieldSchemaRefreshInterval                 = "schema_refresh_interval"
+	ssoFieldMaxFileSizeBytes                      = "max_file_size_bytes"
+	ssoFieldMaxFileAge                            = "max_file_age"
+	ssoFieldMaxRowsPerFile                        = "max_rows_per_file"
+	ssoFieldMaxPendingRegistrations               = "max_pending_registrations"
+	ssoFieldOnConversionError                     = "on_conversion_error"
+	ssoFieldOnConversionErrorByColumn             = "on_conversion_error_by_column"
+	ssoFieldColumnTransforms                      = "column_transforms"
+	ssoFieldColumnEncodings                       = "column_encodings"
+	ssoFieldColumnEncodingCompression             = "compression"
+	ssoFieldColumnEncodingDictionary              = "dictionary"
+	ssoFieldIgnoreColumns                         = "ignore_columns"
+	ssoFieldSortBy                                = "sort_by"
+	ssoFieldSortNulls                             = "sort_nulls"
+	ssoFieldAutoCreateTable                       = "auto_create_table"
+	ssoFieldAutoAddColumns                        = "auto_add_columns"
+	ssoFieldColumns                               = "columns"
+	ssoFieldSchemaRegistry                        = "schema_registry"
+	ssoFieldSchemaRegistryURL                     = "url"
+	ssoFieldSchemaRegistryTLS                     = "tls"
+	ssoFieldSchemaRegistryColumnNameMapping       = "column_name_mapping"
+	ssoFieldSchemaRegistryCustomColumnNameMapping = "custom_column_name_mapping"
+
+	// Smaller files are inefficient to load into Snowflake.
+	minFileSizeBytes = 1024 * 1024
+	// Flushing more often than this keeps channels busy registering tiny files.
+	minFileAge = time.Second
 
 	defaultSchemaEvolutionNewColumnMapping = `root = match this.value.type() {
   this == "string" => "STRING"
@@ -84,11 +128,15 @@ FLOAT:any numeric type
 BOOLEAN:bool,any numeric type,string parsable according to `+"`strconv.ParseBool`"+`
 TIME,DATE,TIMESTAMP:unix or RFC 3339 with nanoseconds timestamps
 VARIANT,ARRAY,OBJECT:any data type is converted into JSON
-GEOGRAPHY,GEOMETRY: Not supported
+GEOGRAPHY,GEOMETRY:GeoJSON object or string, WKT string
 |===
 
 For TIMESTAMP, TIME and DATE columns, you can parse different string formats using a bloblang `+"`"+ssoFieldMapping+"`"+`.
 
+The geometry of a GeoJSON Feature is written to GEOGRAPHY and GEOMETRY columns without its properties, a Feature without a geometry is written as null and FeatureCollections are rejected.
+
+TIMESTAMP_TZ columns keep the offset of RFC 3339 strings, which must be whole minutes between -14:00 and +14:00. Strings without an offset are interpreted as UTC.
+
 Authentication can be configured using a https://docs.snowflake.com/en/user-guide/key-pair-auth[RSA Key Pair^].
 
 There are https://docs.snowflake.com/en/user-guide/data-load-snowpipe-streaming-overview#limitations[limitations^] of what data types can be loaded into Snowflake using this method.
@@ -96,6 +144,49 @@ There are https://docs.snowflake.com/en/user-guide/data-load-snowpipe-streaming-
 
 It is recommended that each batches results in at least 16MiB of compressed output being written to Snowflake.
 You can monitor the output batch size using the `+"`snowflake_compressed_output_size_bytes`"+` metric.
+The size of the files written to Snowflake can be bounded independently of the batching policy using the
+`+"`"+ssoFieldMaxFileSizeBytes+"`"+` and `+"`"+ssoFieldMaxRowsPerFile+"`"+` fields, in which case batches that exceed them are split into multiple files,
+and `+"`"+ssoFieldMaxFileAge+"`"+` bounds how long messages are buffered before they are written.
+
+Errors returned by Snowflake are counted by the `+"`snowflake_server_errors`"+` metric, labelled by the Snowflake error code.
+Transient errors such as throttling, expired tokens and invalidated channels are retried. Files which Snowflake rejects
+permanently fail the batch without being retried by the output, so they can be routed to a dead letter queue using a
+`+"`fallback`"+` output.
+
+Instead of creating the table up front, `+"`"+ssoFieldAutoCreateTable+"`"+` creates it with the columns declared in `+"`"+ssoFieldColumns+"`"+`
+when the output connects, and `+"`"+ssoFieldAutoAddColumns+"`"+` adds declared columns which are missing from the table once
+messages contain them, after which the channels are reopened so that the new columns are written to. Column types are never
+inferred from the data, unlike `+"`"+ssoFieldSchemaEvolution+"`"+`, which can't be enabled together with these fields. The
+statements use `+"`IF NOT EXISTS`"+`, so multiple outputs can safely write to the same table. Missing privileges are reported
+when connecting, along with the statement which grants them.
+
+The `+"`"+ssoFieldRowMapping+"`"+` field selects the rows that are written for each message, such as the payload of an envelope,
+and writes each element as a separate row when it results in an array of objects. Errors executing it fail the batch like
+values that are rejected by `+"`"+ssoFieldOnConversionError+"`"+`, and the `+"`snowflake_row_mapping_messages`"+` and
+`+"`snowflake_row_mapping_rows`"+` metrics count the messages that are mapped and the rows that are written for them.
+
+Messages which are encoded with Avro or Protobuf schemas in the Confluent wire format can be decoded with the schemas of
+a schema registry by setting `+"`"+ssoFieldSchemaRegistry+"`"+`, which replaces a `+"`schema_registry_decode`"+` processor. The fields of
+the decoded messages are written to the columns that `+"`"+ssoFieldSchemaRegistryColumnNameMapping+"`"+` maps their names to, and
+the ID of the schema is set as the `+"`"+schemaIDMetadataKey+"`"+` metadata field. The values of Avro unions are written as
+their member, so unions with null are written as `+"`NULL`"+`, and the logical types of Avro schemas are converted with
+the precision and scale of the schema: decimals are written as exact numbers and `+"`date`"+`, `+"`time-*`"+` and
+`+"`timestamp-*`"+` values as dates, times and timestamps. When `+"`"+ssoFieldSchemaEvolution+"`"+` adds columns for fields of
+Avro schemas without a `+"`"+ssoFieldSchemaEvolutionNewColumnTypeMapping+"`"+` or `+"`"+ssoFieldSchemaEvolutionProcessors+"`"+`, the
+column types are derived from the schema, such as `+"`NUMBER(10,2)`"+` for decimals or `+"`TIMESTAMP_LTZ(3)`"+` for
+`+"`timestamp-millis`"+`. Messages which can't be decoded are rejected without failing the rest of the batch, so they can
+be handled with a `+"`fallback`"+` or `+"`reject_errored`"+` output.
+
+When `+"`"+ssoFieldStageMetadata+"`"+` is enabled, the following metadata fields are set on each message once its batch is committed.
+When batches are split into multiple files, each message gets the values of the file which contains its row, and when
+a message is mapped to multiple rows by `+"`"+ssoFieldRowMapping+"`"+`, it gets the values of its first row.
+
+- `+"`"+stageBuildMetadataKey+"`"+`: The milliseconds spent converting the rows of the file and building it.
+- `+"`"+stageUploadMetadataKey+"`"+`: The milliseconds spent uploading the file to the stage.
+- `+"`"+stageCommitMetadataKey+"`"+`: The milliseconds spent registering the file with the channel and waiting until the batch was committed.
+- `+"`"+stageFileBytesMetadataKey+"`"+`: The size of the file in bytes.
+- `+"`"+stageFileRowsMetadataKey+"`"+`: The number of rows in the file.
+- `+"`"+stageRowOffsetMetadataKey+"`"+`: The offset of the row of the message within the file.
 `).
 		Fields(
 			service.NewStringField(ssoFieldAccount).
@@ -107,11 +198,30 @@ You can monitor the output batch size using the `+"`snowflake_compressed_output_
 			service.NewStringField(ssoFieldRole).Description("The role for the `user` field. The role must have the https://docs.snowflake.com/en/user-guide/data-load-snowpipe-streaming-overview#required-access-privileges[required privileges^] to call the Snowpipe Streaming APIs. See https://docs.snowflake.com/en/user-guide/admin-user-management#user-roles[Snowflake Documentation^] for more information about roles.").Example("ACCOUNTADMIN"),
 			service.NewStringField(ssoFieldDB).Description("The Snowflake database to ingest data into.").Example("MY_DATABASE"),
 			service.NewStringField(ssoFieldSchema).Description("The Snowflake schema to ingest data into.").Example("PUBLIC"),
-			service.NewInterpolatedStringField(ssoFieldTable).Description("The Snowflake table to ingest data into.").Example("MY_TABLE"),
+			service.NewInterpolatedStringField(ssoFieldTable).
+				Description("The Snowflake table to ingest data into. When this field contains interpolations, it's executed for each message and batches which contain messages for multiple tables are split, so that each table is written separately and concurrently. The state of each table, such as its schema and channels, is created when it's first written to and shares the connection of the output. Messages whose table can't be resolved and messages of tables which fail to be written are rejected without affecting the messages of the other tables.").
+				Example("MY_TABLE").
+				Example(`${! metadata("table_name") }`),
+			service.NewIntField(ssoFieldMaxTables).
+				Description("The maximum number of tables whose state is kept when `"+ssoFieldTable+"` contains interpolations. When a new table is written to while the limit is reached, the state of the least recently used table which isn't being written to is closed, along with its channels, and it's created again the next time the table is written to. The `snowflake_tables_opened` and `snowflake_tables_closed` metrics count the tables whose state is created and closed. Set to `0` to keep the state of all tables.").
+				Default(0).
+				LintRule(`root = if this < 0 { ["`+ssoFieldMaxTables+` must not be negative"] }`).
+				Advanced(),
 			service.NewStringField(ssoFieldKey).Description("The PEM encoded private RSA key to use for authenticating with Snowflake. Either this or `private_key_file` must be specified.").Optional().Secret().LintRule(`root = if !this.re_match("(?s)^-----BEGIN [A-Z ]+-----\\n[0-9A-Za-z+/=\\n]+-----END [A-Z ]+-----\\n?$") && !this.re_match("[0-9A-Za-z+/=]") { ["field private_key must be in PEM format"] }`),
 			service.NewStringField(ssoFieldKeyFile).Description("The file to load the private RSA key from. This should be a `.p8` PEM encoded file. Either this or `private_key` must be specified.").Optional(),
 			service.NewStringField(ssoFieldKeyPass).Description("The RSA key passphrase if the RSA key is encrypted.").Optional().Secret(),
+			service.NewDurationField(ssoFieldKeyRefreshInterval).
+				Description("The interval at which `"+ssoFieldKeyFile+"` is checked for changes, so that a rotated key pair is used without restarting the pipeline. When the file was modified since the key was loaded, it's loaded again and subsequent requests are signed with the new key, while the current key is kept if the file can't be loaded. Regardless of this field, the key file is also loaded again once when Snowflake rejects the JWT of a request before the request fails. Set to `0s` to disable.").
+				Default("0s").
+				Advanced().
+				Example("1m"),
 			service.NewBloblangField(ssoFieldMapping).Description("A bloblang mapping to execute on each message.").Optional(),
+			service.NewBloblangField(ssoFieldRowMapping).
+				Description("A bloblang mapping executed on each message after `"+ssoFieldMapping+"`, which results in the object whose keys are written to the columns of the table, or an array of objects which are each written as a separate row. Messages which are deleted by the mapping are not written, and messages which the mapping fails on are rejected individually while the rest of the batch is written. When unset, each message is written as a single row, which is the same as `root = this`.").
+				Example(`root = this.payload.assign({"event_source": this.metadata.source})`).
+				Example(`root = this.events.map_each(e -> e.assign({"batch_id": this.id}))`).
+				Optional().
+				Advanced(),
 			service.NewStringField(ssoFieldInitStatement).Description(`
 Optional SQL statements to execute immediately upon the first connection. This is a useful way to initialize tables before processing data. Care should be taken to ensure that the statement is idempotent, and therefore would not cause issues when run multiple times after service restarts.
 `).Optional().Example(`
@@ -138,7 +248,116 @@ A series of processors to execute when new columns are added to the table. Speci
 			service.NewObjectField(ssoFieldBuildOpts,
 				service.NewIntField(ssoFieldBuildParallelism).Description("The maximum amount of parallelism to use.").Default(1).LintRule(`root = if this < 1 { ["parallelism must be positive"] }`),
 				service.NewIntField(ssoFieldBuildChunkSize).Description("The number of rows to chunk for parallelization.").Default(50_000).LintRule(`root = if this < 1 { ["chunk_size must be positive"] }`),
+				service.NewIntField(ssoFieldBuildColumnParallelism).Description("The maximum number of columns of each chunk that are converted in parallel, which speeds up building the output for wide tables and for batches that are smaller than `chunk_size`. When greater than 1 the messages of each chunk are also parsed in parallel. Up to `parallelism` times `column_parallelism` goroutines are used and the order of the rows is preserved.").Default(1).LintRule(`root = if this < 1 { ["column_parallelism must be positive"] }`),
 			).Advanced().Description("Options to optimize the time to build output data that is sent to Snowflake. The metric to watch to see if you need to change this is `snowflake_build_output_latency_ns`."),
+			dateFormatsField(),
+			dateIntegerUnitField(),
+			clampTimestampsField(),
+			caseSensitiveColumnsField(),
+			service.NewBoolField(ssoFieldCollectColumnNDV).
+				Description("Estimate the number of distinct values in each column of every file written to Snowflake. The estimates are reported by the `snowflake_column_distinct_values` gauge, which is labelled with the table and column, and are included in debug logs.").
+				Default(false).
+				Advanced(),
+			service.NewDurationField(ssoFieldDataQualityInterval).
+				Description("Summarize the values written to each column of every table over windows of this duration, and report the summary of each window as an info log along with the `snowflake_data_quality_rows`, `snowflake_data_quality_nulls`, `snowflake_data_quality_conversion_errors` and `snowflake_data_quality_max_length` gauges, which are labelled with the table and column and are reset to zero for the columns which aren't written during a window. The summary includes the number of rows, nulls and values that failed conversion, the ratio of nulls and conversion errors, the smallest and largest values and the length of the longest string. The statistics are gathered while the values are converted, so no extra pass over the data is needed. It's disabled by default, in which case no statistics are kept.").
+				Example("60s").
+				Optional().
+				Advanced(),
+			service.NewBoolField(ssoFieldStageMetadata).
+				Description("Set metadata fields with the time spent in each stage of writing the file of each message to Snowflake, along with the size of the file and the offset of the row of the message within it, once the batch is committed. This can be used to attach the timings to tracing spans. It's disabled by default as setting metadata on every message adds overhead, the same timings are always reported by the `snowflake_build_output_latency_ns`, `snowflake_upload_latency_ns`, `snowflake_register_latency_ns` and `snowflake_commit_latency_ns` metrics.").
+				Default(false).
+				Advanced(),
+			service.NewIntField(ssoFieldMaxFileSizeBytes).
+				Description("The maximum size in bytes of a single file written to Snowflake. Batches which result in larger files are split into multiple files, each of which is uploaded and registered separately. The size of each file is reported by the `snowflake_file_size_bytes` metric.").
+				Example(256*1024*1024).
+				Optional().
+				Advanced().
+				LintRule(`root = if this < `+strconv.Itoa(minFileSizeBytes)+` { ["max_file_size_bytes must be at least `+strconv.Itoa(minFileSizeBytes)+`"] }`),
+			service.NewIntField(ssoFieldMaxRowsPerFile).
+				Description("The maximum number of rows in a single file written to Snowflake. Batches with more rows are split into multiple files, each of which is uploaded and registered separately. The number of rows in each file is reported by the `snowflake_file_rows` metric.").
+				Example(1_000_000).
+				Optional().
+				Advanced().
+				LintRule(`root = if this < 1 { ["max_rows_per_file must be positive"] }`),
+			service.NewIntField(ssoFieldMaxPendingRegistrations).
+				Description("The maximum number of files of a batch that are uploaded but not yet registered with Snowflake. Files are registered in the order they were built while the following files are built and uploaded, and building the next file is blocked while this many files are waiting to be registered. Registrations which are throttled or fail on the server side are retried with an exponential backoff, honoring the `Retry-After` header of the response. The number of files waiting to be registered is reported by the `snowflake_pending_registrations` gauge, the retries by the `snowflake_register_retries` counter and the registration latency by the `snowflake_register_latency_ns` metric.").
+				Default(4).
+				Advanced().
+				LintRule(`root = if this < 1 { ["max_pending_registrations must be positive"] }`),
+			service.NewDurationField(ssoFieldMaxFileAge).
+				Description("The maximum duration that messages are buffered before they are written to Snowflake. This bounds the `period` of the `batching` policy, which is set to this value if it's unset or longer. The time to build, upload and register each file is reported by the `snowflake_file_flush_latency_ns` metric.").
+				Example("5s").
+				Optional().
+				Advanced().
+				LintRule(`root = if this.parse_duration() < `+strconv.FormatInt(minFileAge.Nanoseconds(), 10)+` { ["max_file_age must be at least `+minFileAge.String()+`"] }`),
+			onConversionErrorField(),
+			onConversionErrorByColumnField(),
+			columnTransformsField(),
+			service.NewObjectMapField(ssoFieldColumnEncodings,
+				service.NewStringEnumField(ssoFieldColumnEncodingCompression, streaming.CompressionCodecs...).
+					Description("The codec which compresses the values of the column instead of `zstd`. Only the codecs which Snowflake accepts for streaming ingestion can be used.").
+					Optional(),
+				service.NewBoolField(ssoFieldColumnEncodingDictionary).
+					Description("Dictionary encode the values of the column instead of using plain encoding, which makes columns with few distinct values much smaller.").
+					Default(false),
+			).
+				Description("Overrides how the values of specific columns are encoded in the files written to Snowflake. The keys are column names, which are matched the same way as message keys, and must be columns of the table. Columns which aren't listed are compressed with `zstd` and use plain encoding. Disabling compression saves CPU for columns whose values don't compress, such as random IDs and data which is already compressed.").
+				Example(map[string]any{
+					"id":      map[string]any{ssoFieldColumnEncodingCompression: "none"},
+					"payload": map[string]any{ssoFieldColumnEncodingCompression: "none"},
+					"status":  map[string]any{ssoFieldColumnEncodingDictionary: true},
+				}).
+				Optional().
+				Advanced(),
+			service.NewBoolField(ssoFieldAutoCreateTable).
+				Description("Create the table with the columns declared in `"+ssoFieldColumns+"` when the output connects if it doesn't exist. The role must have the `CREATE TABLE` privilege on the schema.").
+				Default(false).
+				Advanced(),
+			service.NewBoolField(ssoFieldAutoAddColumns).
+				Description("Add columns declared in `"+ssoFieldColumns+"` to the table when messages contain non-null keys which match them but the table doesn't have them yet. Message keys which don't match a declared column are ignored. The role must own the table.").
+				Default(false).
+				Advanced(),
+			service.NewStringMapField(ssoFieldColumns).
+				Description("The columns used by `"+ssoFieldAutoCreateTable+"` and `"+ssoFieldAutoAddColumns+"`, as a map of column names to Snowflake data types. The column names are matched the same way as message keys.").
+				Example(map[string]any{"id": "NUMBER", "name": "STRING", "created_at": "TIMESTAMP_NTZ"}).
+				Optional().
+				Advanced(),
+			service.NewObjectField(ssoFieldSchemaRegistry,
+				slices.Concat(
+					[]*service.ConfigField{
+						service.NewURLField(ssoFieldSchemaRegistryURL).Description("The base URL of the schema registry service."),
+						service.NewTLSField(ssoFieldSchemaRegistryTLS),
+						service.NewStringAnnotatedEnumField(ssoFieldSchemaRegistryColumnNameMapping, map[string]string{
+							"none":        "Fields are written to the columns with the same name.",
+							"snake_upper": "Field names are converted to upper snake case, so that `orderId` is written to the `ORDER_ID` column.",
+							"custom":      "Field names are mapped with `" + ssoFieldSchemaRegistryCustomColumnNameMapping + "`.",
+						}).
+							Description("How the names of the top level fields of decoded messages are mapped to column names.").
+							Default("none"),
+						service.NewBloblangField(ssoFieldSchemaRegistryCustomColumnNameMapping).
+							Description("A bloblang mapping that is executed with the name of each top level field as `this` and results in the name of its column, which is used when `" + ssoFieldSchemaRegistryColumnNameMapping + "` is `custom`.").
+							Example(`root = this.re_replace_all("([a-z0-9])([A-Z])", "${1}_${2}").lowercase()`).
+							Optional(),
+					},
+					service.NewHTTPRequestAuthSignerFields(),
+				)...,
+			).
+				Description("Decode messages encoded with Avro or Protobuf schemas in the Confluent wire format with the schemas of a schema registry before they are mapped and written.").
+				Optional().
+				Advanced(),
+			ignoreColumnsField(),
+			service.NewStringListField(ssoFieldSortBy).
+				Description("Columns that the rows of each file are sorted by before they are written, in order of precedence, which improves the pruning of micro-partitions when they match the clustering key of the table. Numbers and timestamps are sorted by value and strings bytewise, rows with the same values keep the order of their messages. The names are matched the same way as message keys and columns which don't exist in the table fail opening the channel. Sorting is bounded by the size of each file, see `"+ssoFieldMaxRowsPerFile+"`.").
+				Example([]string{"EVENT_DATE", "CUSTOMER_ID"}).
+				Default([]any{}).
+				Advanced(),
+			service.NewStringAnnotatedEnumField(ssoFieldSortNulls, map[string]string{
+				"first": "Null values are sorted before other values.",
+				"last":  "Null values are sorted after other values.",
+			}).
+				Description("Where null values of the `"+ssoFieldSortBy+"` columns are sorted.").
+				Default("last").
+				Advanced(),
 			service.NewBatchPolicyField(ssoFieldBatching),
 			service.NewOutputMaxInFlightField().Default(4),
 			service.NewStringField(ssoFieldChannelPrefix).
@@ -157,9 +376,16 @@ NOTE: There is a limit of 10,000 streams per table - if using more than 10k stre
 			service.NewInterpolatedStringField(ssoFieldChannelName).
 				Description(`The channel name to use.
 Duplicate channel names will result in errors and prevent multiple instances of Redpanda Connect from writing at the same time.
-Note that batches are assumed to all contain messages for the same channel, so this interpolation is only executed on the first
-message in each batch. It's recommended to batch at the input level to ensure that batches contain messages for the same channel
-if using an input that is partitioned (such as an Apache Kafka topic).
+This interpolation is executed for each message and batches which contain messages for multiple channels are split, so that
+the messages of each channel are written in order through that channel. The channels of a batch are written one after
+another and the whole batch is retried if any of them fails, so `+"`"+ssoFieldOffsetToken+"`"+` should be set in order to skip the
+messages which were already committed through the other channels. It's still recommended to batch at the input level if
+using an input that is partitioned (such as an Apache Kafka topic), since each channel of a batch is committed separately.
+
+Channels are opened when they are first written to and stay open until the output is closed, unless
+`+"`"+ssoFieldMaxOpenChannels+"`"+` is set. The `+"`snowflake_channels_opened`"+` and `+"`snowflake_channels_closed`"+` metrics count
+the channels which are opened and closed and the `+"`snowflake_channel_rows`"+` metric counts the rows committed through each
+channel.
 
 This option is mutually exclusive with `+"`"+ssoFieldChannelPrefix+"`"+`.
 
@@ -167,32 +393,58 @@ NOTE: There is a limit of 10,000 streams per table - if using more than 10k stre
 				Optional().
 				Advanced().
 				Examples(`partition-${!@kafka_partition}`),
+			service.NewIntField(ssoFieldMaxOpenChannels).
+				Description(`The maximum number of channels which are kept open when `+"`"+ssoFieldChannelName+"`"+` is set. When a new channel is
+opened while the limit is reached, the least recently used channel which isn't being written to is closed. Closing a channel
+doesn't drop it in Snowflake, so its latest committed offset token is fetched again when it's reopened. Set to `+"`0`"+` to keep
+all channels open.`).
+				Default(0).
+				LintRule(`root = if this < 0 { ["`+ssoFieldMaxOpenChannels+` must not be negative"] }`).
+				Advanced(),
 			service.NewInterpolatedStringField(ssoFieldOffsetToken).
 				Description(`The offset token to use for exactly once delivery of data in the pipeline. When data is sent on a channel, each message in a batch's offset token
-is compared to the latest token for a channel. If the offset token is lexicographically less than the latest in the channel, it's assumed the message is a duplicate and
+is compared to the latest token for a channel. If the offset token isn't greater than the latest in the channel, it's assumed the message is a duplicate and
 is dropped. This means it is *very important* to have ordered delivery to the output, any out of order messages to the output will be seen as duplicates and dropped.
 Specifically this means that retried messages could be seen as duplicates if later messages have succeeded in the meantime, so in most circumstances a dead letter queue
 output should be employed for failed messages.
 
-NOTE: It's assumed that messages within a batch are in increasing order by offset token, additionally if you're using a numeric value as an offset token, make sure to pad
-      the value so that it's lexicographically ordered in its string representation, since offset tokens are compared in string form.
+NOTE: It's assumed that messages within a batch are in increasing order by offset token. Offset tokens which consist only of digits, such as `+"`${! @kafka_offset }`"+`, are compared
+      numerically. Any other offset tokens are compared lexicographically, so if they contain a numeric value, make sure to pad the value so that it's lexicographically
+      ordered in its string representation.
 
 For more information about offset tokens, see https://docs.snowflake.com/en/user-guide/data-load-snowpipe-streaming-overview#offset-tokens[^Snowflake Documentation]`).
 				Optional().
 				Advanced().
 				Examples(`offset-${!"%016X".format(@kafka_offset)}`, `postgres-${!@lsn}`),
+			service.NewStringField(ssoFieldOffsetTokenCache).
+				Description(`The label of a cache resource in which the latest offset token committed through each channel is stored, keyed by the fully qualified name of the table and the name of the channel separated by a slash, such as `+"`DB.SCHEMA.TABLE/channel`"+`, so that the input of the pipeline can resume from it after a restart. The token is stored when a channel is opened, which fetches the token committed before the output started, and after each batch written through the channel is committed. The committed token of each channel is also logged when it's opened. Failures to store a token are logged and don't fail the write, since the channel always skips the messages whose offset token was already committed. Requires `+"`"+ssoFieldOffsetToken+"`"+` to be set.`).
+				Optional().
+				Advanced(),
 			service.NewDurationField(ssoFieldCommitTimeout).
 				Description(`The max duration to wait until the data has been asynchronously committed to Snowflake.`).
 				Default("60s").
 				Advanced().
 				Example("10s").
 				Example("10m"),
+			service.NewDurationField(ssoFieldSchemaRefreshInterval).
+				Description("The interval at which the table schema is refetched so that columns which are added to the table while the pipeline is running are written to. When enabled, the schema is also refetched once when a message contains keys which don't match any known column before the keys are ignored or rejected. A refresh which changes the columns is logged and counted by the `snowflake_schema_refresh_column_changes` metric. Set to `0s` to disable.").
+				Default("0s").
+				Advanced().
+				Example("5m"),
 		).
 		LintRule(`root = match {
   this.exists("private_key") && this.exists("private_key_file") => [ "both `+"`private_key`"+` and `+"`private_key_file`"+` can't be set simultaneously" ],
 }`).
 		LintRule(`root = match {
   this.exists("channel_prefix") && this.exists("channel_name") => [ "both `+"`channel_prefix`"+` and `+"`channel_name`"+` can't be set simultaneously" ],
+}`).
+		LintRule(`root = match {
+  (this.`+ssoFieldAutoCreateTable+`.or(false) || this.`+ssoFieldAutoAddColumns+`.or(false)) && this.`+ssoFieldColumns+`.or({}).length() == 0 => [ "`+"`"+ssoFieldColumns+"`"+` must be set when `+"`"+ssoFieldAutoCreateTable+"`"+` or `+"`"+ssoFieldAutoAddColumns+"`"+` is enabled" ],
+  (this.`+ssoFieldAutoCreateTable+`.or(false) || this.`+ssoFieldAutoAddColumns+`.or(false)) && this.`+ssoFieldSchemaEvolution+`.`+ssoFieldSchemaEvolutionEnabled+`.or(false) => [ "`+"`"+ssoFieldAutoCreateTable+"`"+` and `+"`"+ssoFieldAutoAddColumns+"`"+` can't be used together with `+"`"+ssoFieldSchemaEvolution+"`"+`" ],
+  this.`+ssoFieldMaxOpenChannels+`.or(0) > 0 && !this.exists("`+ssoFieldChannelName+`") => [ "`+"`"+ssoFieldMaxOpenChannels+"`"+` can only be set together with `+"`"+ssoFieldChannelName+"`"+`" ],
+  this.exists("`+ssoFieldOffsetTokenCache+`") && !this.exists("`+ssoFieldOffsetToken+`") => [ "`+"`"+ssoFieldOffsetTokenCache+"`"+` can only be set together with `+"`"+ssoFieldOffsetToken+"`"+`" ],
+  this.`+ssoFieldSchemaRegistry+`.`+ssoFieldSchemaRegistryColumnNameMapping+`.or("none") == "custom" && !this.`+ssoFieldSchemaRegistry+`.exists("`+ssoFieldSchemaRegistryCustomColumnNameMapping+`") => [ "`+"`"+ssoFieldSchemaRegistryCustomColumnNameMapping+"`"+` must be set when `+"`"+ssoFieldSchemaRegistryColumnNameMapping+"`"+` is custom" ],
+  this.`+ssoFieldKeyRefreshInterval+`.or("0s").parse_duration() > 0 && !this.exists("`+ssoFieldKeyFile+`") => [ "`+"`"+ssoFieldKeyRefreshInterval+"`"+` can only be set together with `+"`"+ssoFieldKeyFile+"`"+`" ],
 }`).
 		Example(
 			"Exactly once CDC into Snowflake",
@@ -346,6 +598,15 @@ func init() {
 			if batchPolicy, err = conf.FieldBatchPolicy(ssoFieldBatching); err != nil {
 				return
 			}
+			if conf.Contains(ssoFieldMaxFileAge) {
+				var maxFileAge time.Duration
+				if maxFileAge, err = conf.FieldDuration(ssoFieldMaxFileAge); err != nil {
+					return
+				}
+				if batchPolicy, err = boundBatchPeriod(batchPolicy, maxFileAge); err != nil {
+					return
+				}
+			}
 			output, err = newSnowflakeStreamer(conf, mgr)
 			return
 		})
@@ -367,6 +628,8 @@ func newSnowflakeStreamer(
 		keypass = pass
 	}
 	var rsaKey *rsa.PrivateKey
+	var keyFile *privateKeyFile
+	var keySource *streaming.PrivateKeySource
 	if conf.Contains(ssoFieldKey) {
 		key, err := conf.FieldString(ssoFieldKey)
 		if err != nil {
@@ -376,18 +639,28 @@ func newSnowflakeStreamer(
 		if err != nil {
 			return nil, err
 		}
+		keySource = streaming.NewPrivateKeySource(rsaKey, nil)
 	} else if conf.Contains(ssoFieldKeyFile) {
-		keyFile, err := conf.FieldString(ssoFieldKeyFile)
+		path, err := conf.FieldString(ssoFieldKeyFile)
 		if err != nil {
 			return nil, err
 		}
-		rsaKey, err = getPrivateKeyFromFile(mgr.FS(), keyFile, keypass)
+		keyFile = &privateKeyFile{fs: mgr.FS(), path: path, passphrase: keypass}
+		rsaKey, err = keyFile.load()
 		if err != nil {
 			return nil, err
 		}
+		keySource = streaming.NewPrivateKeySource(rsaKey, keyFile.load)
 	} else {
 		return nil, fmt.Errorf("one of `%s` or `%s` is required", ssoFieldKey, ssoFieldKeyFile)
 	}
+	keyRefreshInterval, err := conf.FieldDuration(ssoFieldKeyRefreshInterval)
+	if err != nil {
+		return nil, err
+	}
+	if keyRefreshInterval > 0 && keyFile == nil {
+		return nil, fmt.Errorf("`%s` requires `%s` to be set", ssoFieldKeyRefreshInterval, ssoFieldKeyFile)
+	}
 	account, err := conf.FieldString(ssoFieldAccount)
 	if err != nil {
 		return nil, err
@@ -425,6 +698,13 @@ func newSnowflakeStreamer(
 	if err != nil {
 		return nil, err
 	}
+	maxTables, err := conf.FieldInt(ssoFieldMaxTables)
+	if err != nil {
+		return nil, err
+	}
+	if maxTables < 0 {
+		return nil, fmt.Errorf("`%s` must not be negative", ssoFieldMaxTables)
+	}
 	var mapping *bloblang.Executor
 	if conf.Contains(ssoFieldMapping) {
 		mapping, err = conf.FieldBloblang(ssoFieldMapping)
@@ -432,6 +712,20 @@ func newSnowflakeStreamer(
 			return nil, err
 		}
 	}
+	var rowMapping *bloblang.Executor
+	if conf.Contains(ssoFieldRowMapping) {
+		rowMapping, err = conf.FieldBloblang(ssoFieldRowMapping)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var decoder *schemaRegistryDecoder
+	if conf.Contains(ssoFieldSchemaRegistry) {
+		decoder, err = newSchemaRegistryDecoderFromConfig(conf.Namespace(ssoFieldSchemaRegistry), mgr)
+		if err != nil {
+			return nil, err
+		}
+	}
 	schemaEvolutionMode := streaming.SchemaModeIgnoreExtra
 	var schemaEvolutionProcessors []*service.OwnedProcessor
 	var schemaEvolutionMapping *bloblang.Executor
@@ -474,12 +768,124 @@ func newSnowflakeStreamer(
 	if err != nil {
 		return nil, err
 	}
+	buildOpts.ColumnParallelism, err = conf.FieldInt(ssoFieldBuildOpts, ssoFieldBuildColumnParallelism)
+	if err != nil {
+		return nil, err
+	}
 	if conf.Contains(ssoFieldBuildParallelismLegacy) {
 		buildOpts.Parallelism, err = conf.FieldInt(ssoFieldBuildParallelismLegacy)
 		if err != nil {
 			return nil, err
 		}
 	}
+	if conf.Contains(ssoFieldMaxFileSizeBytes) {
+		buildOpts.MaxFileSizeBytes, err = conf.FieldInt(ssoFieldMaxFileSizeBytes)
+		if err != nil {
+			return nil, err
+		}
+		if buildOpts.MaxFileSizeBytes < minFileSizeBytes {
+			return nil, fmt.Errorf("`%s` must be at least %d, got %d", ssoFieldMaxFileSizeBytes, minFileSizeBytes, buildOpts.MaxFileSizeBytes)
+		}
+	}
+	if conf.Contains(ssoFieldMaxRowsPerFile) {
+		buildOpts.MaxRowsPerFile, err = conf.FieldInt(ssoFieldMaxRowsPerFile)
+		if err != nil {
+			return nil, err
+		}
+		if buildOpts.MaxRowsPerFile < 1 {
+			return nil, fmt.Errorf("`%s` must be positive, got %d", ssoFieldMaxRowsPerFile, buildOpts.MaxRowsPerFile)
+		}
+	}
+	buildOpts.MaxPendingRegistrations, err = conf.FieldInt(ssoFieldMaxPendingRegistrations)
+	if err != nil {
+		return nil, err
+	}
+	if buildOpts.MaxPendingRegistrations < 1 {
+		return nil, fmt.Errorf("`%s` must be positive, got %d", ssoFieldMaxPendingRegistrations, buildOpts.MaxPendingRegistrations)
+	}
+	convOpts, err := conversionOptionsFromParsed(conf)
+	if err != nil {
+		return nil, err
+	}
+	buildOpts.DateFormats = convOpts.dateFormats
+	buildOpts.DateIntegerUnit = convOpts.dateIntegerUnit
+	buildOpts.ClampTimestamps = convOpts.clampTimestamps
+	caseSensitiveColumns := convOpts.caseSensitiveColumns
+	conversionErrorMode := convOpts.conversionErrorMode
+	columnConversionErrorModes := convOpts.columnConversionErrorModes
+	columnTransforms := convOpts.columnTransforms
+	ignoreColumns := convOpts.ignoreColumns
+
+	buildOpts.CollectColumnNDV, err = conf.FieldBool(ssoFieldCollectColumnNDV)
+	if err != nil {
+		return nil, err
+	}
+
+	var columnEncodings map[string]streaming.ColumnEncoding
+	if conf.Contains(ssoFieldColumnEncodings) {
+		encodingConfs, err := conf.FieldObjectMap(ssoFieldColumnEncodings)
+		if err != nil {
+			return nil, err
+		}
+		columnEncodings = make(map[string]streaming.ColumnEncoding, len(encodingConfs))
+		for column, encodingConf := range encodingConfs {
+			var encoding streaming.ColumnEncoding
+			if encodingConf.Contains(ssoFieldColumnEncodingCompression) {
+				codec, err := encodingConf.FieldString(ssoFieldColumnEncodingCompression)
+				if err != nil {
+					return nil, err
+				}
+				if encoding.Compression, err = streaming.ParseCompressionCodec(codec); err != nil {
+					return nil, fmt.Errorf("invalid %s for column %q: %w", ssoFieldColumnEncodings, column, err)
+				}
+			}
+			if encoding.Dictionary, err = encodingConf.FieldBool(ssoFieldColumnEncodingDictionary); err != nil {
+				return nil, err
+			}
+			columnEncodings[column] = encoding
+		}
+	}
+
+	sortColumns, err := conf.FieldStringList(ssoFieldSortBy)
+	if err != nil {
+		return nil, err
+	}
+	sortNulls, err := conf.FieldString(ssoFieldSortNulls)
+	if err != nil {
+		return nil, err
+	}
+
+	autoCreateTable, err := conf.FieldBool(ssoFieldAutoCreateTable)
+	if err != nil {
+		return nil, err
+	}
+	autoAddColumns, err := conf.FieldBool(ssoFieldAutoAddColumns)
+	if err != nil {
+		return nil, err
+	}
+	var columns declaredColumns
+	if autoCreateTable || autoAddColumns {
+		if !conf.Contains(ssoFieldColumns) {
+			return nil, fmt.Errorf("`%s` must be set when `%s` or `%s` is enabled", ssoFieldColumns, ssoFieldAutoCreateTable, ssoFieldAutoAddColumns)
+		}
+		rawColumns, err := conf.FieldStringMap(ssoFieldColumns)
+		if err != nil {
+			return nil, err
+		}
+		if columns, err = newDeclaredColumns(rawColumns, caseSensitiveColumns); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", ssoFieldColumns, err)
+		}
+		if len(columns) == 0 {
+			return nil, fmt.Errorf("`%s` must be set when `%s` or `%s` is enabled", ssoFieldColumns, ssoFieldAutoCreateTable, ssoFieldAutoAddColumns)
+		}
+		if schemaEvolutionMode != streaming.SchemaModeIgnoreExtra {
+			return nil, fmt.Errorf("`%s` and `%s` can't be used together with `%s`", ssoFieldAutoCreateTable, ssoFieldAutoAddColumns, ssoFieldSchemaEvolution)
+		}
+	}
+	var addColumns declaredColumns
+	if autoAddColumns {
+		addColumns = columns
+	}
 
 	var channelPrefix string
 	if conf.Contains(ssoFieldChannelPrefix) {
@@ -501,6 +907,14 @@ func newSnowflakeStreamer(
 		return nil, fmt.Errorf("only one of `%s` or `%s` can be specified", ssoFieldChannelName, ssoFieldChannelPrefix)
 	}
 
+	maxOpenChannels, err := conf.FieldInt(ssoFieldMaxOpenChannels)
+	if err != nil {
+		return nil, err
+	}
+	if maxOpenChannels < 0 {
+		return nil, fmt.Errorf("`%s` must not be negative", ssoFieldMaxOpenChannels)
+	}
+
 	var offsetToken *service.InterpolatedString
 	if conf.Contains(ssoFieldOffsetToken) {
 		offsetToken, err = conf.FieldInterpolatedString(ssoFieldOffsetToken)
@@ -508,6 +922,16 @@ func newSnowflakeStreamer(
 			return nil, err
 		}
 	}
+	var offsetTokenCache string
+	if conf.Contains(ssoFieldOffsetTokenCache) {
+		if offsetToken == nil {
+			return nil, fmt.Errorf("`%s` can only be set together with `%s`", ssoFieldOffsetTokenCache, ssoFieldOffsetToken)
+		}
+		offsetTokenCache, err = conf.FieldString(ssoFieldOffsetTokenCache)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	maxInFlight, err := conf.FieldMaxInFlight()
 	if err != nil {
@@ -518,6 +942,26 @@ func newSnowflakeStreamer(
 	if err != nil {
 		return nil, err
 	}
+	schemaRefreshInterval, err := conf.FieldDuration(ssoFieldSchemaRefreshInterval)
+	if err != nil {
+		return nil, err
+	}
+	stageMetadata, err := conf.FieldBool(ssoFieldStageMetadata)
+	if err != nil {
+		return nil, err
+	}
+	var dataQuality *dataQualityMonitor
+	if conf.Contains(ssoFieldDataQualityInterval) {
+		interval, err := conf.FieldDuration(ssoFieldDataQualityInterval)
+		if err != nil {
+			return nil, err
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("`%s` must be positive", ssoFieldDataQualityInterval)
+		}
+		buildOpts.CollectColumnSummaries = true
+		dataQuality = newDataQualityMonitor(interval, mgr)
+	}
 
 	// Normalize role, db and schema as they are case-sensitive in the API calls.
 	// Maybe we should use the golang SQL driver for SQL statements so we don't have
@@ -551,12 +995,12 @@ func newSnowflakeStreamer(
 		}
 	}
 	restClient, err := streaming.NewRestClient(streaming.RestOptions{
-		Account:    account,
-		URL:        url,
-		User:       user,
-		Version:    mgr.EngineVersion(),
-		PrivateKey: rsaKey,
-		Logger:     mgr.Logger(),
+		Account:          account,
+		URL:              url,
+		User:             user,
+		Version:          mgr.EngineVersion(),
+		PrivateKeySource: keySource,
+		Logger:           mgr.Logger(),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("unable to create rest API client: %w", err)
@@ -564,55 +1008,87 @@ func newSnowflakeStreamer(
 	client, err := streaming.NewSnowflakeServiceClient(
 		context.Background(),
 		streaming.ClientOptions{
-			Account:        account,
-			URL:            url,
-			User:           user,
-			Role:           role,
-			PrivateKey:     rsaKey,
-			Logger:         mgr.Logger(),
-			ConnectVersion: mgr.EngineVersion(),
+			Account:          account,
+			URL:              url,
+			User:             user,
+			Role:             role,
+			PrivateKeySource: keySource,
+			Logger:           mgr.Logger(),
+			ConnectVersion:   mgr.EngineVersion(),
 		})
 	if err != nil {
 		return nil, err
 	}
+	var keyRefreshLoop *asyncroutine.Periodic
+	if keyRefreshInterval > 0 {
+		keyRefreshLoop = asyncroutine.NewPeriodic(keyRefreshInterval, func() {
+			reloadChangedPrivateKey(keyFile, keySource, mgr.Logger())
+		})
+		keyRefreshLoop.Start()
+	}
+	dataQuality.start()
 
 	mgr.SetGeneric(SnowflakeClientResourceForTesting, restClient)
 	makeImpl := func(table string) (*snowpipeSchemaEvolver, service.BatchOutput) {
 		var schemaEvolver *snowpipeSchemaEvolver
-		if schemaEvolutionMode != streaming.SchemaModeIgnoreExtra {
+		if schemaEvolutionMode != streaming.SchemaModeIgnoreExtra || autoCreateTable || autoAddColumns {
 			schemaEvolver = &snowpipeSchemaEvolver{
 				mode:                   schemaEvolutionMode,
+				caseSensitiveColumns:   caseSensitiveColumns,
 				schemaEvolutionMapping: schemaEvolutionMapping,
 				pipeline:               schemaEvolutionProcessors,
+				decoder:                decoder,
 				restClient:             restClient,
 				logger:                 mgr.Logger(),
 				db:                     db,
 				schema:                 schema,
 				table:                  table,
 				role:                   role,
+				declaredColumns:        columns,
+				autoCreateTable:        autoCreateTable,
+				autoAddColumns:         autoAddColumns,
 			}
 		}
+		var tokenPublisher *offsetTokenPublisher
+		if offsetToken != nil {
+			tokenPublisher = newOffsetTokenPublisher(offsetTokenCache, fmt.Sprintf("%s.%s.%s", db, schema, table), mgr)
+		}
 		var impl service.BatchOutput
 		if channelName != nil {
 			indexed := &snowpipeIndexedOutput{
-				channelName:   channelName,
-				client:        client,
-				db:            db,
-				schema:        schema,
-				table:         table,
-				role:          role,
-				logger:        mgr.Logger(),
-				metrics:       newSnowpipeMetrics(mgr.Metrics()),
-				buildOpts:     buildOpts,
-				offsetToken:   offsetToken,
-				schemaMode:    schemaEvolutionMode,
-				commitTimeout: commitTimeout,
+				channelName:                channelName,
+				client:                     client,
+				db:                         db,
+				schema:                     schema,
+				table:                      table,
+				role:                       role,
+				logger:                     mgr.Logger(),
+				metrics:                    newSnowpipeMetrics(mgr.Metrics()),
+				buildOpts:                  buildOpts,
+				offsetToken:                offsetToken,
+				tokenPublisher:             tokenPublisher,
+				schemaMode:                 schemaEvolutionMode,
+				commitTimeout:              commitTimeout,
+				caseSensitiveColumns:       caseSensitiveColumns,
+				conversionErrorMode:        conversionErrorMode,
+				columnConversionErrorModes: columnConversionErrorModes,
+				columnTransforms:           columnTransforms,
+				columnEncodings:            columnEncodings,
+				ignoreColumns:              ignoreColumns,
+				sortColumns:                sortColumns,
+				sortNullsFirst:             sortNulls == "first",
+				addColumns:                 addColumns,
+				stageMetadata:              stageMetadata,
+				dataQuality:                dataQuality,
 			}
-			indexed.channelPool = pool.NewIndexed(func(ctx context.Context, name string) (*streaming.SnowflakeIngestionChannel, error) {
+			indexed.channelPool = pool.NewIndexedLimited(maxOpenChannels, func(ctx context.Context, name string) (*streaming.SnowflakeIngestionChannel, error) {
 				hash := sha256.Sum256([]byte(name))
 				id := binary.BigEndian.Uint16(hash[:])
 				return indexed.openChannel(ctx, name, int16(id))
-			})
+			}, indexed.closeChannel)
+			if schemaRefreshInterval > 0 {
+				indexed.schemaRefresher = newSnowpipeSchemaRefresher(schemaRefreshInterval, indexed.openChannel, mgr.Logger(), indexed.metrics)
+			}
 			impl = indexed
 		} else {
 			if channelPrefix == "" {
@@ -622,23 +1098,38 @@ func newSnowflakeStreamer(
 				channelPrefix = fmt.Sprintf("Redpanda_Connect_%s.%s.%s", db, schema, table)
 			}
 			pooled := &snowpipePooledOutput{
-				channelPrefix: channelPrefix,
-				client:        client,
-				db:            db,
-				schema:        schema,
-				table:         table,
-				role:          role,
-				logger:        mgr.Logger(),
-				metrics:       newSnowpipeMetrics(mgr.Metrics()),
-				buildOpts:     buildOpts,
-				offsetToken:   offsetToken,
-				schemaMode:    schemaEvolutionMode,
-				commitTimeout: commitTimeout,
+				channelPrefix:              channelPrefix,
+				client:                     client,
+				db:                         db,
+				schema:                     schema,
+				table:                      table,
+				role:                       role,
+				logger:                     mgr.Logger(),
+				metrics:                    newSnowpipeMetrics(mgr.Metrics()),
+				buildOpts:                  buildOpts,
+				offsetToken:                offsetToken,
+				tokenPublisher:             tokenPublisher,
+				schemaMode:                 schemaEvolutionMode,
+				commitTimeout:              commitTimeout,
+				caseSensitiveColumns:       caseSensitiveColumns,
+				conversionErrorMode:        conversionErrorMode,
+				columnConversionErrorModes: columnConversionErrorModes,
+				columnTransforms:           columnTransforms,
+				columnEncodings:            columnEncodings,
+				ignoreColumns:              ignoreColumns,
+				sortColumns:                sortColumns,
+				sortNullsFirst:             sortNulls == "first",
+				addColumns:                 addColumns,
+				stageMetadata:              stageMetadata,
+				dataQuality:                dataQuality,
 			}
 			pooled.channelPool = pool.NewCapped(maxInFlight, func(ctx context.Context, id int) (*streaming.SnowflakeIngestionChannel, error) {
 				name := fmt.Sprintf("%s_%d", pooled.channelPrefix, id)
 				return pooled.openChannel(ctx, name, int16(id))
 			})
+			if schemaRefreshInterval > 0 {
+				pooled.schemaRefresher = newSnowpipeSchemaRefresher(schemaRefreshInterval, pooled.openChannel, mgr.Logger(), pooled.metrics)
+			}
 			impl = pooled
 		}
 		return schemaEvolver, impl
@@ -650,37 +1141,52 @@ func newSnowflakeStreamer(
 			initStatementsFn: initStatementsFn,
 			client:           client,
 			restClient:       restClient,
+			keyRefreshLoop:   keyRefreshLoop,
 			mapping:          mapping,
+			rowMapping:       rowMapping,
+			decoder:          decoder,
+			table:            table,
+			metrics:          newSnowpipeMetrics(mgr.Metrics()),
 			logger:           mgr.Logger(),
 			schemaEvolver:    schemaEvolver,
+			stageMetadata:    stageMetadata,
+			dataQuality:      dataQuality,
 
 			impl: impl,
 		}, nil
-	} else {
-		return &dynamicSnowpipeStreamingOutput{
-			table: dynamicTable,
-			byTable: pool.NewIndexed(func(ctx context.Context, table string) (service.BatchOutput, error) {
-				schemaEvolver, impl := makeImpl(table)
-				o := &snowpipeStreamingOutput{
-					initStatementsFn: nil,
-					client:           nil,
-					restClient:       nil,
-					mapping:          mapping,
-					logger:           mgr.Logger(),
-					schemaEvolver:    schemaEvolver,
-
-					impl: impl,
-				}
-				if err := o.Connect(ctx); err != nil {
-					return nil, err
-				}
-				return o, nil
-			}),
-			initStatementsFn: initStatementsFn,
-			client:           client,
-			restClient:       restClient,
-		}, nil
 	}
+	dynamic := &dynamicSnowpipeStreamingOutput{
+		table:            dynamicTable,
+		logger:           mgr.Logger(),
+		metrics:          newSnowpipeMetrics(mgr.Metrics()),
+		initStatementsFn: initStatementsFn,
+		client:           client,
+		restClient:       restClient,
+		keyRefreshLoop:   keyRefreshLoop,
+		decoder:          decoder,
+		stageMetadata:    stageMetadata,
+		dataQuality:      dataQuality,
+	}
+	dynamic.byTable = pool.NewIndexedLimited(maxTables, func(_ context.Context, table string) (*snowpipeTableOutput, error) {
+		schemaEvolver, impl := makeImpl(table)
+		dynamic.metrics.tablesOpened.Incr(1, table)
+		return &snowpipeTableOutput{output: &snowpipeStreamingOutput{
+			initStatementsFn: nil,
+			client:           nil,
+			restClient:       nil,
+			keyRefreshLoop:   nil,
+			mapping:          mapping,
+			rowMapping:       rowMapping,
+			table:            table,
+			metrics:          newSnowpipeMetrics(mgr.Metrics()),
+			logger:           mgr.Logger(),
+			schemaEvolver:    schemaEvolver,
+			stageMetadata:    stageMetadata,
+
+			impl: impl,
+		}}, nil
+	}, dynamic.evictTable)
+	return dynamic, nil
 }
 
 type snowflakeClientForTesting string
@@ -689,13 +1195,40 @@ type snowflakeClientForTesting string
 // which can remove boilerplate from tests to setup a new REST client.
 const SnowflakeClientResourceForTesting snowflakeClientForTesting = "SnowflakeClientResourceForTesting"
 
+// dynamicSnowpipeStreamingOutput writes to the table which the interpolated `table` field resolves to for each message,
+// using a separate snowpipeStreamingOutput for each table which share the clients of the output.
 type dynamicSnowpipeStreamingOutput struct {
 	table   *service.InterpolatedString
-	byTable pool.Indexed[service.BatchOutput]
+	byTable pool.Indexed[*snowpipeTableOutput]
+	logger  *service.Logger
+	metrics *snowpipeMetrics
+	// Tracks the tables which are being closed after they were evicted.
+	evictions sync.WaitGroup
+	// Messages are decoded before their table is resolved, so the outputs of the tables don't decode them again.
+	decoder       *schemaRegistryDecoder
+	stageMetadata bool
 
 	initStatementsFn func(context.Context, *streaming.SnowflakeRestClient) error
 	client           *streaming.SnowflakeServiceClient
 	restClient       *streaming.SnowflakeRestClient
+	keyRefreshLoop   *asyncroutine.Periodic
+	// Only set on the output which owns the monitor, the outputs of each table report to it through their channels.
+	dataQuality *dataQualityMonitor
+}
+
+// snowpipeTableOutput is the output of a single table of a dynamic output. The output is connected when the table is
+// first written to rather than when it's created, so that a table whose schema can't be fetched doesn't hold up the
+// other tables and is retried with its next batch.
+type snowpipeTableOutput struct {
+	output *snowpipeStreamingOutput
+
+	connectMu sync.Mutex
+	connected bool
+
+	// Writes hold a read lock, so that a table is only closed once the writes which acquired it before it was evicted
+	// are done.
+	mu     sync.RWMutex
+	closed bool
 }
 
 func (o *dynamicSnowpipeStreamingOutput) Connect(ctx context.Context) error {
@@ -710,30 +1243,162 @@ func (o *dynamicSnowpipeStreamingOutput) Connect(ctx context.Context) error {
 }
 
 func (o *dynamicSnowpipeStreamingOutput) WriteBatch(ctx context.Context, batch service.MessageBatch) error {
-	executor := batch.InterpolationExecutor(o.table)
-	tableBatches := map[string]service.MessageBatch{}
-	for i, msg := range batch {
-		table, err := executor.TryString(i)
+	var batchErr *service.BatchError
+	batchErrFailed := func(i int, err error) {
+		if batchErr == nil {
+			batchErr = service.NewBatchError(batch, err)
+		}
+		batchErr.Failed(i, err)
+	}
+
+	// The indexes of the messages that are written refer to batch unless they were decoded.
+	written, source := batch, func(i int) int { return i }
+	if o.decoder != nil {
+		var sources []int
+		written, sources = o.decoder.decodeBatch(ctx, batch, batchErrFailed)
+		source = func(i int) int { return sources[i] }
+		defer copyRowConversionErrors(written, sources, batch)
+		if o.stageMetadata {
+			defer copyStageMetadata(written, sources, batch)
+		}
+	}
+
+	tables, indexes := splitBatchByTable(written, o.table, func(i int, err error) {
+		batchErrFailed(source(i), err)
+	})
+
+	// Each table is written through its own channels, so the tables of a batch are written concurrently.
+	errs := make([]error, len(tables))
+	indexers := make([]*service.Indexer, len(tables))
+	var wg sync.WaitGroup
+	for i, table := range tables {
+		tableBatch := make(service.MessageBatch, len(indexes[table]))
+		for j, index := range indexes[table] {
+			tableBatch[j] = written[index]
+		}
+		indexers[i] = tableBatch.Index()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = o.writeTableBatch(ctx, table, tableBatch)
+		}()
+	}
+	wg.Wait()
+
+	for i, table := range tables {
+		if errs[i] == nil {
+			continue
+		}
+		// Only the messages of the table which failed are rejected when its output returns a batch error, such as when
+		// the row mapping fails on some of them.
+		var tableBatchErr *service.BatchError
+		if errors.As(errs[i], &tableBatchErr) && tableBatchErr.IndexedErrors() > 0 {
+			tableBatchErr.WalkMessagesIndexedBy(indexers[i], func(j int, _ *service.Message, err error) bool {
+				if err != nil {
+					batchErrFailed(source(indexes[table][j]), fmt.Errorf("table %s: %w", table, err))
+				}
+				return true
+			})
+			continue
+		}
+		o.logger.Errorf("unable to write to table %s: %v", table, errs[i])
+		for _, index := range indexes[table] {
+			batchErrFailed(source(index), fmt.Errorf("table %s: %w", table, errs[i]))
+		}
+	}
+	if batchErr != nil {
+		return batchErr
+	}
+	return nil
+}
+
+// splitBatchByTable groups the indexes of the messages of a batch by their table, preserving the order of the messages
+// of each table. The tables are returned in the order in which they first appear in the batch. Messages whose table
+// can't be resolved are passed to failed.
+func splitBatchByTable(batch service.MessageBatch, table *service.InterpolatedString, failed func(i int, err error)) ([]string, map[string][]int) {
+	exec := batch.InterpolationExecutor(table)
+	var tables []string
+	indexes := map[string][]int{}
+	for i := range batch {
+		name, err := exec.TryString(i)
+		if err == nil && name == "" {
+			err = errors.New("empty table name")
+		}
 		if err != nil {
-			return fmt.Errorf("unable to interpolate `%s`: %w", ssoFieldTable, err)
+			failed(i, fmt.Errorf("unable to interpolate `%s`: %w", ssoFieldTable, err))
+			continue
+		}
+		if _, ok := indexes[name]; !ok {
+			tables = append(tables, name)
 		}
-		tableBatches[table] = append(tableBatches[table], msg)
+		indexes[name] = append(indexes[name], i)
 	}
-	for table, batch := range tableBatches {
-		output, err := o.byTable.Acquire(ctx, table)
+	return tables, indexes
+}
+
+func (o *dynamicSnowpipeStreamingOutput) writeTableBatch(ctx context.Context, table string, batch service.MessageBatch) error {
+	for {
+		out, err := o.byTable.Acquire(ctx, table)
 		if err != nil {
 			return err
 		}
-		// Immediately release, these are thread safe, so we can let other
-		// threads modify them while we have a reference.
-		o.byTable.Release(table, output)
-		if err := output.WriteBatch(ctx, batch); err != nil {
-			return err
+		// Immediately release, table outputs are thread safe, so other writes of the same table can run concurrently.
+		o.byTable.Release(table, out)
+
+		out.mu.RLock()
+		if out.closed {
+			// The table was evicted after it was acquired, so it's created again.
+			out.mu.RUnlock()
+			continue
 		}
+		err = out.connect(ctx)
+		if err == nil {
+			err = out.output.WriteBatch(ctx, batch)
+		}
+		out.mu.RUnlock()
+		return err
 	}
+}
+
+// connect connects the output of the table unless it's already connected.
+func (t *snowpipeTableOutput) connect(ctx context.Context) error {
+	t.connectMu.Lock()
+	defer t.connectMu.Unlock()
+	if t.connected {
+		return nil
+	}
+	if err := t.output.Connect(ctx); err != nil {
+		return err
+	}
+	t.connected = true
 	return nil
 }
 
+// close closes the output of the table once the writes which are in progress are done.
+func (t *snowpipeTableOutput) close(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	return t.output.Close(ctx)
+}
+
+// evictTable is called when the least recently used table is evicted from the pool. The table is closed in the
+// background, so that the write which caused the eviction isn't blocked by the writes of the evicted table.
+func (o *dynamicSnowpipeStreamingOutput) evictTable(table string, out *snowpipeTableOutput) {
+	o.evictions.Add(1)
+	go func() {
+		defer o.evictions.Done()
+		o.logger.Debugf("closing snowflake streaming output for table %s", table)
+		if err := out.close(context.Background()); err != nil {
+			o.logger.Warnf("unable to close snowflake streaming output for table %s: %v", table, err)
+		}
+		o.metrics.tablesClosed.Incr(1, table)
+	}()
+}
+
 func (o *dynamicSnowpipeStreamingOutput) Close(ctx context.Context) error {
 	for _, key := range o.byTable.Keys() {
 		out, err := o.byTable.Acquire(ctx, key)
@@ -741,11 +1406,17 @@ func (o *dynamicSnowpipeStreamingOutput) Close(ctx context.Context) error {
 			return err
 		}
 		o.byTable.Release(key, out)
-		if err := out.Close(ctx); err != nil {
+		if err := out.close(ctx); err != nil {
 			return err
 		}
+		o.metrics.tablesClosed.Incr(1, key)
 	}
 	o.byTable.Reset()
+	o.evictions.Wait()
+	if o.keyRefreshLoop != nil {
+		o.keyRefreshLoop.Stop()
+	}
+	o.dataQuality.close()
 	o.client.Close()
 	o.restClient.Close()
 	return nil
@@ -755,9 +1426,18 @@ type snowpipeStreamingOutput struct {
 	initStatementsFn func(context.Context, *streaming.SnowflakeRestClient) error
 	client           *streaming.SnowflakeServiceClient
 	restClient       *streaming.SnowflakeRestClient
+	keyRefreshLoop   *asyncroutine.Periodic
 	mapping          *bloblang.Executor
+	rowMapping       *bloblang.Executor
+	decoder          *schemaRegistryDecoder
+	table            string
+	metrics          *snowpipeMetrics
 	logger           *service.Logger
 	schemaEvolver    *snowpipeSchemaEvolver
+	tablePrepared    bool
+	stageMetadata    bool
+	// Only set on the output which owns the monitor, rather than the outputs of each table of a dynamic output.
+	dataQuality *dataQualityMonitor
 
 	mu sync.RWMutex
 
@@ -772,10 +1452,50 @@ func (o *snowpipeStreamingOutput) Connect(ctx context.Context) error {
 		// We've already executed our init statement, we don't need to do that anymore
 		o.initStatementsFn = nil
 	}
+	if o.schemaEvolver != nil && !o.tablePrepared {
+		o.mu.Lock()
+		err := o.schemaEvolver.PrepareTable(ctx)
+		o.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		o.tablePrepared = true
+	}
 	return o.impl.Connect(ctx)
 }
 
 func (o *snowpipeStreamingOutput) WriteBatch(ctx context.Context, batch service.MessageBatch) error {
+	// Messages that can't be decoded or mapped to rows are rejected, while the rest of the batch is written.
+	var batchErr *service.BatchError
+	failed := func(i int, err error) {
+		if batchErr == nil {
+			batchErr = service.NewBatchError(batch, err)
+		}
+		batchErr.Failed(i, err)
+	}
+	written, writtenFailed := batch, failed
+	if o.decoder != nil {
+		var sources []int
+		written, sources = o.decoder.decodeBatch(ctx, batch, failed)
+		writtenFailed = func(i int, err error) {
+			failed(sources[i], err)
+		}
+		defer copyRowConversionErrors(written, sources, batch)
+		if o.stageMetadata {
+			defer copyStageMetadata(written, sources, batch)
+		}
+	}
+	if err := o.writeBatch(ctx, written, writtenFailed); err != nil {
+		return err
+	}
+	if batchErr != nil {
+		return batchErr
+	}
+	return nil
+}
+
+// writeBatch writes the rows of batch, messages which the row mapping fails on are passed to failed and skipped.
+func (o *snowpipeStreamingOutput) writeBatch(ctx context.Context, batch service.MessageBatch, failed func(i int, err error)) error {
 	if len(batch) == 0 {
 		return nil
 	}
@@ -789,8 +1509,24 @@ func (o *snowpipeStreamingOutput) WriteBatch(ctx context.Context, batch service.
 			}
 			mapped[i] = msg
 		}
+		defer copyConversionErrors(mapped, batch)
+		if o.stageMetadata {
+			defer copyStageMetadata(mapped, nil, batch)
+		}
 		batch = mapped
 	}
+	if o.rowMapping != nil {
+		rows, sources := mapRows(batch, o.rowMapping, failed)
+		o.metrics.ReportRowMapping(o.table, len(batch), len(rows))
+		if len(rows) == 0 {
+			return nil
+		}
+		defer copyRowConversionErrors(rows, sources, batch)
+		if o.stageMetadata {
+			defer copyStageMetadata(rows, sources, batch)
+		}
+		batch = rows
+	}
 	var err error
 	// We only migrate one column at a time, so tolerate up to 10 schema
 	// migrations for a single batch before giving up. This protects against
@@ -805,7 +1541,7 @@ func (o *snowpipeStreamingOutput) WriteBatch(ctx context.Context, batch service.
 		if o.schemaEvolver == nil {
 			return err
 		}
-		if streaming.IsTableNotExistsError(err) {
+		if streaming.IsTableNotExistsError(err) && o.schemaEvolver.canCreateTable() {
 			o.mu.Lock()
 			err := o.createTable(ctx, batch)
 			o.mu.Unlock()
@@ -843,7 +1579,14 @@ func (o *snowpipeStreamingOutput) WriteBatch(ctx context.Context, batch service.
 }
 
 func (o *snowpipeStreamingOutput) createTable(ctx context.Context, batch service.MessageBatch) error {
-	if err := o.schemaEvolver.CreateOutputTable(ctx, batch); err != nil {
+	createFn := func(ctx context.Context) error {
+		return o.schemaEvolver.CreateOutputTable(ctx, batch)
+	}
+	if o.schemaEvolver.autoCreateTable {
+		// The table was dropped after the output connected.
+		createFn = o.schemaEvolver.CreateDeclaredTable
+	}
+	if err := createFn(ctx); err != nil {
 		return err
 	}
 	if err := o.impl.Connect(ctx); err != nil {
@@ -872,6 +1615,10 @@ func (o *snowpipeStreamingOutput) Close(ctx context.Context) error {
 	if err := o.impl.Close(ctx); err != nil {
 		return err
 	}
+	if o.keyRefreshLoop != nil {
+		o.keyRefreshLoop.Stop()
+	}
+	o.dataQuality.close()
 	if o.client != nil {
 		o.client.Close()
 	}
@@ -890,24 +1637,55 @@ type snowpipePooledOutput struct {
 
 	channelPrefix, db, schema, table, role string
 	offsetToken                            *service.InterpolatedString
+	tokenPublisher                         *offsetTokenPublisher
 	logger                                 *service.Logger
 	schemaMode                             streaming.SchemaMode
+	caseSensitiveColumns                   bool
+	conversionErrorMode                    streaming.ConversionErrorMode
+	columnConversionErrorModes             map[string]streaming.ConversionErrorMode
+	columnTransforms                       map[string]*bloblang.Executor
+	columnEncodings                        map[string]streaming.ColumnEncoding
+	ignoreColumns                          []string
+	sortColumns                            []string
+	sortNullsFirst                         bool
+	addColumns                             declaredColumns
+	schemaRefresher                        *snowpipeSchemaRefresher
+	stageMetadata                          bool
+	dataQuality                            *dataQualityMonitor
 }
 
 func (o *snowpipePooledOutput) openChannel(ctx context.Context, name string, id int16) (*streaming.SnowflakeIngestionChannel, error) {
 	o.logger.Debugf("opening snowflake streaming channel for table `%s.%s.%s`: %s", o.db, o.schema, o.table, name)
-	return o.client.OpenChannel(ctx, streaming.ChannelOptions{
-		ID:           id,
-		Name:         name,
-		DatabaseName: o.db,
-		SchemaName:   o.schema,
-		TableName:    o.table,
-		BuildOptions: o.buildOpts,
-		SchemaMode:   o.schemaMode,
+	channel, err := o.client.OpenChannel(ctx, streaming.ChannelOptions{
+		ID:                         id,
+		Name:                       name,
+		DatabaseName:               o.db,
+		SchemaName:                 o.schema,
+		TableName:                  o.table,
+		BuildOptions:               o.buildOpts,
+		SchemaMode:                 o.schemaMode,
+		CaseSensitiveColumns:       o.caseSensitiveColumns,
+		ConversionErrorMode:        o.conversionErrorMode,
+		ColumnConversionErrorModes: o.columnConversionErrorModes,
+		ColumnTransforms:           o.columnTransforms,
+		ColumnEncodings:            o.columnEncodings,
+		IgnoreColumns:              o.ignoreColumns,
+		SortColumns:                o.sortColumns,
+		SortNullsFirst:             o.sortNullsFirst,
+		OnPendingRegistration: func(delta int) {
+			o.metrics.PendingRegistration(o.table, delta)
+		},
 	})
+	if err == nil && o.tokenPublisher != nil {
+		o.tokenPublisher.opened(ctx, channel)
+	}
+	return channel, err
 }
 
 func (o *snowpipePooledOutput) Connect(ctx context.Context) error {
+	if o.tokenPublisher != nil {
+		return o.tokenPublisher.checkCache()
+	}
 	return nil
 }
 
@@ -916,9 +1694,16 @@ func (o *snowpipePooledOutput) WriteBatch(ctx context.Context, batch service.Mes
 	if err != nil {
 		return fmt.Errorf("unable to open snowflake streaming channel: %w", err)
 	}
+	if o.schemaRefresher != nil {
+		channel = o.schemaRefresher.MaybeRefresh(ctx, channel, batch)
+	}
+	if missing := o.addColumns.missingFrom(channel, batch); len(missing) > 0 {
+		o.channelPool.Release(channel)
+		return addColumnsError(missing)
+	}
 	var offsets *streaming.OffsetTokenRange
 	if o.offsetToken != nil {
-		batch, offsets, err = preprocessForExactlyOnce(channel, o.offsetToken, batch)
+		batch, offsets, err = preprocessForExactlyOnce(channel.LatestOffsetToken(), o.offsetToken, batch)
 		if err != nil || len(batch) == 0 {
 			o.channelPool.Release(channel)
 			return err
@@ -952,9 +1737,13 @@ func (o *snowpipePooledOutput) WriteBatch(ctx context.Context, batch service.Mes
 		if schemaErr != nil {
 			return schemaErr
 		}
+		o.metrics.ReportError(o.table, err)
 		return wrapInsertError(err)
 	}
 	o.logger.Debugf("done inserting %d rows using channel %s, stats: %+v", len(batch), channel.Name, stats)
+	if stats.ColumnDistinctValues != nil {
+		o.logger.Debugf("estimated distinct values of the columns written using channel %s: %v", channel.Name, stats.ColumnDistinctValues)
+	}
 	commitStart := time.Now()
 	polls, err := channel.WaitUntilCommitted(ctx, o.commitTimeout)
 	if err != nil {
@@ -966,11 +1755,19 @@ func (o *snowpipePooledOutput) WriteBatch(ctx context.Context, batch service.Mes
 			// Keep around the same channel so retry opening later
 			o.channelPool.Release(channel)
 		}
-		return err
+		o.metrics.ReportError(o.table, err)
+		return streaming.ClassifyError(err)
 	}
 	commitDuration := time.Since(commitStart)
 	o.logger.Debugf("batch of %d rows committed using channel %s after %d polls in %s", len(batch), channel.Name, polls, commitDuration)
-	o.metrics.Report(stats, commitDuration)
+	o.metrics.Report(o.table, stats, commitDuration)
+	o.dataQuality.record(o.table, stats.ColumnSummaries)
+	if o.stageMetadata {
+		setStageMetadata(batch, stats, commitDuration)
+	}
+	if o.tokenPublisher != nil {
+		o.tokenPublisher.committed(ctx, channel)
+	}
 	o.channelPool.Release(channel)
 	return nil
 }
@@ -987,41 +1784,117 @@ type snowpipeIndexedOutput struct {
 	buildOpts     streaming.BuildOptions
 	commitTimeout time.Duration
 
-	db, schema, table, role  string
-	offsetToken, channelName *service.InterpolatedString
-	logger                   *service.Logger
-	schemaMode               streaming.SchemaMode
+	db, schema, table, role    string
+	offsetToken, channelName   *service.InterpolatedString
+	tokenPublisher             *offsetTokenPublisher
+	logger                     *service.Logger
+	schemaMode                 streaming.SchemaMode
+	caseSensitiveColumns       bool
+	conversionErrorMode        streaming.ConversionErrorMode
+	columnConversionErrorModes map[string]streaming.ConversionErrorMode
+	columnTransforms           map[string]*bloblang.Executor
+	columnEncodings            map[string]streaming.ColumnEncoding
+	ignoreColumns              []string
+	sortColumns                []string
+	sortNullsFirst             bool
+	addColumns                 declaredColumns
+	schemaRefresher            *snowpipeSchemaRefresher
+	stageMetadata              bool
+	dataQuality                *dataQualityMonitor
 }
 
 func (o *snowpipeIndexedOutput) openChannel(ctx context.Context, name string, id int16) (*streaming.SnowflakeIngestionChannel, error) {
 	o.logger.Debugf("opening snowflake streaming channel for table `%s.%s.%s`: %s", o.db, o.schema, o.table, name)
-	return o.client.OpenChannel(ctx, streaming.ChannelOptions{
-		ID:           id,
-		Name:         name,
-		DatabaseName: o.db,
-		SchemaName:   o.schema,
-		TableName:    o.table,
-		BuildOptions: o.buildOpts,
-		SchemaMode:   o.schemaMode,
+	channel, err := o.client.OpenChannel(ctx, streaming.ChannelOptions{
+		ID:                         id,
+		Name:                       name,
+		DatabaseName:               o.db,
+		SchemaName:                 o.schema,
+		TableName:                  o.table,
+		BuildOptions:               o.buildOpts,
+		SchemaMode:                 o.schemaMode,
+		CaseSensitiveColumns:       o.caseSensitiveColumns,
+		ConversionErrorMode:        o.conversionErrorMode,
+		ColumnConversionErrorModes: o.columnConversionErrorModes,
+		ColumnTransforms:           o.columnTransforms,
+		ColumnEncodings:            o.columnEncodings,
+		IgnoreColumns:              o.ignoreColumns,
+		SortColumns:                o.sortColumns,
+		SortNullsFirst:             o.sortNullsFirst,
+		OnPendingRegistration: func(delta int) {
+			o.metrics.PendingRegistration(o.table, delta)
+		},
 	})
+	if err == nil {
+		o.metrics.channelsOpened.Incr(1, o.table)
+		if o.tokenPublisher != nil {
+			o.tokenPublisher.opened(ctx, channel)
+		}
+	}
+	return channel, err
+}
+
+// closeChannel is called when a channel is evicted from the pool. All the data written through a channel is committed
+// before it's released, so it's only forgotten and not dropped, which would discard its offset token.
+func (o *snowpipeIndexedOutput) closeChannel(name string, _ *streaming.SnowflakeIngestionChannel) {
+	o.logger.Debugf("closing snowflake streaming channel for table `%s.%s.%s`: %s", o.db, o.schema, o.table, name)
+	o.metrics.channelsClosed.Incr(1, o.table)
 }
 
 func (o *snowpipeIndexedOutput) Connect(ctx context.Context) error {
+	if o.tokenPublisher != nil {
+		return o.tokenPublisher.checkCache()
+	}
 	return nil
 }
 
 func (o *snowpipeIndexedOutput) WriteBatch(ctx context.Context, batch service.MessageBatch) error {
-	channelName, err := batch.TryInterpolatedString(0, o.channelName)
+	names, batches, err := splitBatchByChannel(batch, o.channelName)
 	if err != nil {
-		return fmt.Errorf("error executing %s: %w", ssoFieldChannelName, err)
+		return err
 	}
+	for _, name := range names {
+		if err := o.writeChannelBatch(ctx, name, batches[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitBatchByChannel groups the messages of a batch by their channel name, preserving the order of the messages of
+// each channel. The names are returned in the order in which they first appear in the batch.
+func splitBatchByChannel(batch service.MessageBatch, channelName *service.InterpolatedString) ([]string, map[string]service.MessageBatch, error) {
+	exec := batch.InterpolationExecutor(channelName)
+	var names []string
+	batches := map[string]service.MessageBatch{}
+	for i, msg := range batch {
+		name, err := exec.TryString(i)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error executing %s: %w", ssoFieldChannelName, err)
+		}
+		if _, ok := batches[name]; !ok {
+			names = append(names, name)
+		}
+		batches[name] = append(batches[name], msg)
+	}
+	return names, batches, nil
+}
+
+func (o *snowpipeIndexedOutput) writeChannelBatch(ctx context.Context, channelName string, batch service.MessageBatch) error {
 	channel, err := o.channelPool.Acquire(ctx, channelName)
 	if err != nil {
 		return fmt.Errorf("unable to open snowflake streaming channel: %w", err)
 	}
+	if o.schemaRefresher != nil {
+		channel = o.schemaRefresher.MaybeRefresh(ctx, channel, batch)
+	}
+	if missing := o.addColumns.missingFrom(channel, batch); len(missing) > 0 {
+		o.channelPool.Release(channel.Name, channel)
+		return addColumnsError(missing)
+	}
 	var offsets *streaming.OffsetTokenRange
 	if o.offsetToken != nil {
-		batch, offsets, err = preprocessForExactlyOnce(channel, o.offsetToken, batch)
+		batch, offsets, err = preprocessForExactlyOnce(channel.LatestOffsetToken(), o.offsetToken, batch)
 		if err != nil || len(batch) == 0 {
 			o.channelPool.Release(channel.Name, channel)
 			return err
@@ -1055,9 +1928,13 @@ func (o *snowpipeIndexedOutput) WriteBatch(ctx context.Context, batch service.Me
 		if schemaErr != nil {
 			return schemaErr
 		}
+		o.metrics.ReportError(o.table, err)
 		return wrapInsertError(err)
 	}
 	o.logger.Debugf("done inserting %d rows using channel %s, stats: %+v", len(batch), channel.Name, stats)
+	if stats.ColumnDistinctValues != nil {
+		o.logger.Debugf("estimated distinct values of the columns written using channel %s: %v", channel.Name, stats.ColumnDistinctValues)
+	}
 	commitStart := time.Now()
 	polls, err := channel.WaitUntilCommitted(ctx, o.commitTimeout)
 	if err != nil {
@@ -1069,11 +1946,20 @@ func (o *snowpipeIndexedOutput) WriteBatch(ctx context.Context, batch service.Me
 			// Keep around the same channel so retry opening later
 			o.channelPool.Release(channel.Name, channel)
 		}
-		return err
+		o.metrics.ReportError(o.table, err)
+		return streaming.ClassifyError(err)
 	}
 	commitDuration := time.Since(commitStart)
 	o.logger.Debugf("batch of %d rows committed using channel %s after %d polls in %s", len(batch), channel.Name, polls, commitDuration)
-	o.metrics.Report(stats, commitDuration)
+	o.metrics.Report(o.table, stats, commitDuration)
+	o.dataQuality.record(o.table, stats.ColumnSummaries)
+	if o.stageMetadata {
+		setStageMetadata(batch, stats, commitDuration)
+	}
+	o.metrics.channelRows.Incr(int64(len(batch)), o.table, channel.Name)
+	if o.tokenPublisher != nil {
+		o.tokenPublisher.committed(ctx, channel)
+	}
 	o.channelPool.Release(channel.Name, channel)
 	return nil
 }
@@ -1083,12 +1969,153 @@ func (o *snowpipeIndexedOutput) Close(ctx context.Context) error {
 	return nil
 }
 
+// copyConversionErrors copies the conversion errors of mapped messages back to
+// the messages they were created from.
+func copyConversionErrors(from, to service.MessageBatch) {
+	for i, msg := range from {
+		if v, ok := msg.MetaGetMut(streaming.ConversionErrorsMetadataKey); ok {
+			to[i].MetaSetMut(streaming.ConversionErrorsMetadataKey, v)
+		}
+	}
+}
+
+const (
+	stageBuildMetadataKey     = "snowflake_build_ms"
+	stageUploadMetadataKey    = "snowflake_upload_ms"
+	stageCommitMetadataKey    = "snowflake_commit_ms"
+	stageFileBytesMetadataKey = "snowflake_file_bytes"
+	stageFileRowsMetadataKey  = "snowflake_file_rows"
+	stageRowOffsetMetadataKey = "snowflake_file_row_offset"
+)
+
+var stageMetadataKeys = []string{
+	stageBuildMetadataKey,
+	stageUploadMetadataKey,
+	stageCommitMetadataKey,
+	stageFileBytesMetadataKey,
+	stageFileRowsMetadataKey,
+	stageRowOffsetMetadataKey,
+}
+
+// setStageMetadata sets the stage timings and size of the file of each message of a committed batch along with the
+// offset of its row within the file. The commit time is shared by all the files of the batch.
+func setStageMetadata(batch service.MessageBatch, stats streaming.InsertStats, commitTime time.Duration) {
+	millis := func(d time.Duration) any {
+		return float64(d) / float64(time.Millisecond)
+	}
+	for _, file := range stats.Files {
+		// The values of the file are boxed once and shared by its messages.
+		build, upload, commit := millis(file.BuildTime), millis(file.UploadTime), millis(file.RegisterTime+commitTime)
+		var size, rows any = file.Size, int(file.Rows)
+		end := min(file.FirstRow+int(file.Rows), len(batch))
+		for i := file.FirstRow; i < end; i++ {
+			msg := batch[i]
+			msg.MetaSetMut(stageBuildMetadataKey, build)
+			msg.MetaSetMut(stageUploadMetadataKey, upload)
+			msg.MetaSetMut(stageCommitMetadataKey, commit)
+			msg.MetaSetMut(stageFileBytesMetadataKey, size)
+			msg.MetaSetMut(stageFileRowsMetadataKey, rows)
+			offset := i - file.FirstRow
+			if file.RowPositions != nil {
+				offset = int(file.RowPositions[offset])
+			}
+			msg.MetaSetMut(stageRowOffsetMetadataKey, offset)
+		}
+	}
+}
+
+// copyStageMetadata copies the stage metadata of the rows that were written back to the messages of batch they were
+// created from, where sources holds the index of the message of each row or is nil when they have the same index.
+// Messages with multiple rows get the metadata of their first row.
+func copyStageMetadata(rows service.MessageBatch, sources []int, batch service.MessageBatch) {
+	copied := -1
+	for i, row := range rows {
+		source := i
+		if sources != nil {
+			source = sources[i]
+		}
+		if source == copied {
+			continue
+		}
+		copied = source
+		for _, key := range stageMetadataKeys {
+			if v, ok := row.MetaGetMut(key); ok {
+				batch[source].MetaSetMut(key, v)
+			}
+		}
+	}
+}
+
+// mapRows executes the row mapping on each message of batch and returns the rows that are written for them along with
+// the index of the message of each row. Messages which are mapped to an array result in a row for each element.
+// Messages which the mapping fails on are passed to failed and don't result in any rows.
+func mapRows(batch service.MessageBatch, rowMapping *bloblang.Executor, failed func(i int, err error)) (service.MessageBatch, []int) {
+	rows := make(service.MessageBatch, 0, len(batch))
+	sources := make([]int, 0, len(batch))
+	exec := batch.BloblangExecutor(rowMapping)
+	for i := range batch {
+		msgRows, err := mapMessageRows(exec, i)
+		if err != nil {
+			failed(i, fmt.Errorf("error executing %s: %w", ssoFieldRowMapping, err))
+			continue
+		}
+		for _, row := range msgRows {
+			rows = append(rows, row)
+			sources = append(sources, i)
+		}
+	}
+	return rows, sources
+}
+
+// mapMessageRows executes the row mapping on the message at index i and returns its rows.
+func mapMessageRows(exec *service.MessageBatchBloblangExecutor, i int) (service.MessageBatch, error) {
+	msg, err := exec.Query(i)
+	if err != nil || msg == nil {
+		return nil, err
+	}
+	v, err := msg.AsStructured()
+	if err != nil {
+		return nil, err
+	}
+	elements, ok := v.([]any)
+	if !ok {
+		return service.MessageBatch{msg}, nil
+	}
+	rows := make(service.MessageBatch, 0, len(elements))
+	for j, element := range elements {
+		if _, ok := element.(map[string]any); !ok {
+			return nil, fmt.Errorf("element %d must be an object, got %T", j, element)
+		}
+		row := msg.Copy()
+		row.SetStructured(element)
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// copyRowConversionErrors copies the conversion errors of the rows mapped from batch to the messages they were mapped
+// from, the errors of the rows of the same message are concatenated.
+func copyRowConversionErrors(rows service.MessageBatch, sources []int, batch service.MessageBatch) {
+	errs := map[int][]any{}
+	for i, row := range rows {
+		if v, ok := row.MetaGetMut(streaming.ConversionErrorsMetadataKey); ok {
+			rowErrs, _ := v.([]any)
+			errs[sources[i]] = append(errs[sources[i]], rowErrs...)
+		}
+	}
+	for i, v := range errs {
+		batch[i].MetaSetMut(streaming.ConversionErrorsMetadataKey, v)
+	}
+}
+
+// preprocessForExactlyOnce drops the messages of a batch whose offset token isn't greater than the latest token
+// committed through the channel, which were already written before the batch was retried or replayed after a restart,
+// and returns the range of offset tokens of the remaining messages.
 func preprocessForExactlyOnce(
-	channel *streaming.SnowflakeIngestionChannel,
+	latest *streaming.OffsetToken,
 	offsetTokenMapping *service.InterpolatedString,
 	batch service.MessageBatch,
 ) (service.MessageBatch, *streaming.OffsetTokenRange, error) {
-	latest := channel.LatestOffsetToken()
 	exec := batch.InterpolationExecutor(offsetTokenMapping)
 	firstRawToken, err := exec.TryString(0)
 	if err != nil {
@@ -1099,8 +2126,15 @@ func preprocessForExactlyOnce(
 		return nil, nil, err
 	}
 	// Common case, all data is new
-	if latest == nil || firstRawToken > string(*latest) {
-		return batch, &streaming.OffsetTokenRange{Start: streaming.OffsetToken(firstRawToken), End: streaming.OffsetToken(lastRawToken)}, nil
+	if latest == nil || compareOffsetTokens(firstRawToken, string(*latest)) > 0 {
+		return batch, &streaming.OffsetTokenRange{
+			Start: streaming.OffsetToken(firstRawToken),
+			End:   streaming.OffsetToken(lastRawToken),
+			TokenAt: func(i int) (streaming.OffsetToken, error) {
+				rawToken, err := exec.TryString(i)
+				return streaming.OffsetToken(rawToken), err
+			},
+		}, nil
 	}
 	// We need to filter out data that is too old.
 	filteredBatch := make(service.MessageBatch, 0, len(batch))
@@ -1110,7 +2144,7 @@ func preprocessForExactlyOnce(
 		if err != nil {
 			return nil, nil, err
 		}
-		if rawToken <= string(*latest) {
+		if compareOffsetTokens(rawToken, string(*latest)) <= 0 {
 			continue
 		}
 		filteredBatch = append(filteredBatch, batch[i])
@@ -1119,12 +2153,76 @@ func preprocessForExactlyOnce(
 		return filteredBatch, nil, nil
 	}
 	// This is a lazy way to compute the bounds, but filtering should be a rare operation.
-	return preprocessForExactlyOnce(channel, offsetTokenMapping, filteredBatch)
+	return preprocessForExactlyOnce(latest, offsetTokenMapping, filteredBatch)
+}
+
+// compareOffsetTokens compares two offset tokens, returning -1, 0 or +1. Tokens which only consist of digits are
+// compared numerically, so that unpadded numeric tokens such as Kafka offsets are ordered correctly, any other tokens
+// are compared lexicographically.
+func compareOffsetTokens(a, b string) int {
+	if !isNumericOffsetToken(a) || !isNumericOffsetToken(b) {
+		return strings.Compare(a, b)
+	}
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		return cmp.Compare(len(a), len(b))
+	}
+	return strings.Compare(a, b)
+}
+
+func isNumericOffsetToken(token string) bool {
+	if token == "" {
+		return false
+	}
+	for i := 0; i < len(token); i++ {
+		if token[i] < '0' || token[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// boundBatchPeriod makes sure that batches are flushed at least once every
+// maxFileAge.
+func boundBatchPeriod(policy service.BatchPolicy, maxFileAge time.Duration) (service.BatchPolicy, error) {
+	if maxFileAge < minFileAge {
+		return policy, fmt.Errorf("`%s` must be at least %v, got %v", ssoFieldMaxFileAge, minFileAge, maxFileAge)
+	}
+	if policy.Period != "" {
+		period, err := time.ParseDuration(policy.Period)
+		if err != nil {
+			return policy, fmt.Errorf("failed to parse batching period: %w", err)
+		}
+		if period <= maxFileAge {
+			return policy, nil
+		}
+	}
+	policy.Period = maxFileAge.String()
+	return policy, nil
+}
+
+// reloadChangedPrivateKey reloads the key of keySource when keyFile was modified since the key was loaded. The current
+// key is kept when the file can't be loaded, such as while it's being rotated, and the file is loaded again by the next
+// check.
+func reloadChangedPrivateKey(keyFile *privateKeyFile, keySource *streaming.PrivateKeySource, logger *service.Logger) {
+	changed, err := keyFile.changed()
+	if err != nil {
+		logger.Warnf("Unable to check private key file %s for changes: %s", keyFile.path, err)
+		return
+	}
+	if !changed {
+		return
+	}
+	if _, err := keySource.Reload(); err != nil {
+		logger.Warnf("Unable to reload changed private key file %s, the current key is kept: %s", keyFile.path, err)
+		return
+	}
+	logger.Infof("Reloaded the private key from %s", keyFile.path)
 }
 
 func wrapInsertError(err error) error {
 	if errors.Is(err, &streaming.InvalidTimestampFormatError{}) {
 		return fmt.Errorf("%w; if a custom format is required use a `%s` and bloblang functions `ts_parse` or `ts_strftime` to convert a custom format into a timestamp", err, ssoFieldMapping)
 	}
-	return err
+	return streaming.ClassifyError(err)
 }
@@ -11,12 +11,24 @@
 package snowflake
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+	"github.com/redpanda-data/benthos/v4/public/service"
 	"github.com/stretchr/testify/require"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/snowflake/streaming"
+	"github.com/redpanda-data/connect/v4/internal/pool"
 )
 
-func TestValidColumnTypeRegex(t *testing.T) {
+func TestValidateColumnType(t *testing.T) {
 	matches := []string{
 		"INT",
 		"NUMBER",
@@ -26,11 +38,13 @@ func TestValidColumnTypeRegex(t *testing.T) {
 		"DOUBLE   PRECISION",
 		"  varchar ( 99 )  ",
 		"  varchar ( 0 )  ",
+		"GEOGRAPHY",
+		"TIMESTAMP_TZ(3)",
 	}
 	for _, m := range matches {
 		m := m
 		t.Run(m, func(t *testing.T) {
-			require.Regexp(t, validColumnTypeRegex, m)
+			require.NoError(t, validateColumnType(m))
 		})
 	}
 	nonMatches := []string{
@@ -42,11 +56,763 @@ func TestValidColumnTypeRegex(t *testing.T) {
 		"VARCHAR(  )",
 		"GARBAGE VARCHAR(2)",
 		"VARCHAR(2) GARBAGE",
+		"VARCHAR(2)); DROP TABLE foo; --",
+		"UUID",
 	}
 	for _, m := range nonMatches {
 		m := m
 		t.Run(m, func(t *testing.T) {
-			require.NotRegexp(t, validColumnTypeRegex, m)
+			require.Error(t, validateColumnType(m))
+		})
+	}
+}
+
+func TestBoundBatchPeriod(t *testing.T) {
+	policy, err := boundBatchPeriod(service.BatchPolicy{Count: 100}, 5*time.Second)
+	require.NoError(t, err)
+	require.Equal(t, service.BatchPolicy{Count: 100, Period: "5s"}, policy)
+
+	policy, err = boundBatchPeriod(service.BatchPolicy{Period: "1m"}, 5*time.Second)
+	require.NoError(t, err)
+	require.Equal(t, "5s", policy.Period)
+
+	policy, err = boundBatchPeriod(service.BatchPolicy{Period: "2s"}, 5*time.Second)
+	require.NoError(t, err)
+	require.Equal(t, "2s", policy.Period)
+
+	_, err = boundBatchPeriod(service.BatchPolicy{}, 10*time.Millisecond)
+	require.ErrorContains(t, err, "max_file_age")
+}
+
+func TestSnowflakeStreamingFileLimitsLinting(t *testing.T) {
+	configTests := []struct {
+		name        string
+		config      string
+		errContains string
+	}{
+		{
+			name: "valid limits",
+			config: `
+max_file_size_bytes: 262144000
+max_rows_per_file: 1000000
+max_file_age: 5s
+`,
+		},
+		{
+			name:        "max file size too small",
+			config:      "max_file_size_bytes: 1024\n",
+			errContains: "max_file_size_bytes must be at least 1048576",
+		},
+		{
+			name:        "max rows not positive",
+			config:      "max_rows_per_file: 0\n",
+			errContains: "max_rows_per_file must be positive",
+		},
+		{
+			name:        "max file age too small",
+			config:      "max_file_age: 100ms\n",
+			errContains: "max_file_age must be at least 1s",
+		},
+	}
+
+	const baseConfig = `
+snowflake_streaming:
+  account: WQKFXQQ-WI77362
+  user: ROCKSET
+  role: ACCOUNTADMIN
+  database: BENCHMARK_DB
+  schema: PUBLIC
+  table: TEST
+  private_key_file: ./rsa_key.p8
+`
+	env := service.NewEnvironment()
+	for _, test := range configTests {
+		t.Run(test.name, func(t *testing.T) {
+			config := baseConfig
+			for _, line := range strings.Split(strings.TrimSpace(test.config), "\n") {
+				config += "  " + line + "\n"
+			}
+			err := env.NewStreamBuilder().AddOutputYAML(config)
+			if test.errContains == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, test.errContains)
+			}
+		})
+	}
+}
+
+func TestSnowflakeStreamingConversionErrorLinting(t *testing.T) {
+	configTests := []struct {
+		name        string
+		config      string
+		errContains string
+	}{
+		{
+			name: "valid modes",
+			config: `
+on_conversion_error: write_null
+on_conversion_error_by_column:
+  amount: reject
+  notes: write_null
+`,
+		},
+		{
+			name:        "invalid mode",
+			config:      "on_conversion_error: skip\n",
+			errContains: "value skip is not a valid option",
+		},
+		{
+			name: "invalid column mode",
+			config: `
+on_conversion_error_by_column:
+  amount: skip
+`,
+			errContains: `invalid value "skip", must be either reject or write_null`,
+		},
+		{
+			name: "column transforms",
+			config: `
+on_conversion_error: write_null
+column_transforms:
+  email: root = this.hash("sha256").encode("hex")
+  salary: root = null
+`,
+		},
+		{
+			name: "column encodings",
+			config: `
+column_encodings:
+  id:
+    compression: none
+  status:
+    dictionary: true
+  payload:
+    compression: gzip
+    dictionary: false
+`,
+		},
+		{
+			name: "unsupported column compression",
+			config: `
+column_encodings:
+  id:
+    compression: snappy
+`,
+			errContains: "value snappy is not a valid option",
+		},
+	}
+
+	const baseConfig = `
+snowflake_streaming:
+  account: WQKFXQQ-WI77362
+  user: ROCKSET
+  role: ACCOUNTADMIN
+  database: BENCHMARK_DB
+  schema: PUBLIC
+  table: TEST
+  private_key_file: ./rsa_key.p8
+`
+	env := service.NewEnvironment()
+	for _, test := range configTests {
+		t.Run(test.name, func(t *testing.T) {
+			config := baseConfig
+			for _, line := range strings.Split(strings.TrimSpace(test.config), "\n") {
+				config += "  " + line + "\n"
+			}
+			err := env.NewStreamBuilder().AddOutputYAML(config)
+			if test.errContains == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, test.errContains)
+			}
+		})
+	}
+}
+
+func TestSnowflakeStreamingDeclaredColumnsLinting(t *testing.T) {
+	configTests := []struct {
+		name        string
+		config      string
+		errContains string
+	}{
+		{
+			name: "auto create table",
+			config: `
+auto_create_table: true
+auto_add_columns: true
+columns:
+  id: NUMBER
+  name: STRING
+`,
+		},
+		{
+			name:        "auto create table without columns",
+			config:      "auto_create_table: true\n",
+			errContains: "`columns` must be set when `auto_create_table` or `auto_add_columns` is enabled",
+		},
+		{
+			name:        "auto add columns without columns",
+			config:      "auto_add_columns: true\n",
+			errContains: "`columns` must be set when `auto_create_table` or `auto_add_columns` is enabled",
+		},
+		{
+			name: "auto add columns with schema evolution",
+			config: `
+auto_add_columns: true
+columns:
+  id: NUMBER
+schema_evolution:
+  enabled: true
+`,
+			errContains: "`auto_create_table` and `auto_add_columns` can't be used together with `schema_evolution`",
+		},
+	}
+
+	const baseConfig = `
+snowflake_streaming:
+  account: WQKFXQQ-WI77362
+  user: ROCKSET
+  role: ACCOUNTADMIN
+  database: BENCHMARK_DB
+  schema: PUBLIC
+  table: TEST
+  private_key_file: ./rsa_key.p8
+`
+	env := service.NewEnvironment()
+	for _, test := range configTests {
+		t.Run(test.name, func(t *testing.T) {
+			config := baseConfig
+			for _, line := range strings.Split(strings.TrimSpace(test.config), "\n") {
+				config += "  " + line + "\n"
+			}
+			err := env.NewStreamBuilder().AddOutputYAML(config)
+			if test.errContains == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, test.errContains)
+			}
+		})
+	}
+}
+
+func TestSnowflakeStreamingMaxOpenChannelsLinting(t *testing.T) {
+	configTests := []struct {
+		name        string
+		config      string
+		errContains string
+	}{
+		{
+			name: "max open channels with channel name",
+			config: `
+channel_name: ${! @kafka_partition }
+offset_token: ${! @kafka_offset }
+max_open_channels: 16
+`,
+		},
+		{
+			name:        "max open channels without channel name",
+			config:      "max_open_channels: 16\n",
+			errContains: "`max_open_channels` can only be set together with `channel_name`",
+		},
+		{
+			name: "negative max open channels",
+			config: `
+channel_name: ${! @kafka_partition }
+max_open_channels: -1
+`,
+			errContains: "max_open_channels must not be negative",
+		},
+		{
+			name:        "negative max tables",
+			config:      "max_tables: -1\n",
+			errContains: "max_tables must not be negative",
+		},
+		{
+			name: "offset token cache with offset token",
+			config: `
+channel_name: ${! @kafka_partition }
+offset_token: ${! @kafka_offset }
+offset_token_cache: tokens
+`,
+		},
+		{
+			name:        "offset token cache without offset token",
+			config:      "offset_token_cache: tokens\n",
+			errContains: "`offset_token_cache` can only be set together with `offset_token`",
+		},
+	}
+
+	const baseConfig = `
+snowflake_streaming:
+  account: WQKFXQQ-WI77362
+  user: ROCKSET
+  role: ACCOUNTADMIN
+  database: BENCHMARK_DB
+  schema: PUBLIC
+  table: TEST
+  private_key_file: ./rsa_key.p8
+`
+	env := service.NewEnvironment()
+	for _, test := range configTests {
+		t.Run(test.name, func(t *testing.T) {
+			config := baseConfig
+			for _, line := range strings.Split(strings.TrimSpace(test.config), "\n") {
+				config += "  " + line + "\n"
+			}
+			err := env.NewStreamBuilder().AddOutputYAML(config)
+			if test.errContains == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, test.errContains)
+			}
+		})
+	}
+}
+
+func TestSnowflakeStreamingPrivateKeyRefreshLinting(t *testing.T) {
+	configTests := []struct {
+		name        string
+		config      string
+		errContains string
+	}{
+		{
+			name: "refresh interval with key file",
+			config: `
+private_key_file: ./rsa_key.p8
+private_key_refresh_interval: 1m
+`,
+		},
+		{
+			name: "refresh interval with key",
+			config: `
+private_key: dGVzdA==
+private_key_refresh_interval: 1m
+`,
+			errContains: "`private_key_refresh_interval` can only be set together with `private_key_file`",
+		},
+		{
+			name: "disabled refresh interval with key",
+			config: `
+private_key: dGVzdA==
+private_key_refresh_interval: 0s
+`,
+		},
+	}
+
+	const baseConfig = `
+snowflake_streaming:
+  account: WQKFXQQ-WI77362
+  user: ROCKSET
+  role: ACCOUNTADMIN
+  database: BENCHMARK_DB
+  schema: PUBLIC
+  table: TEST
+`
+	env := service.NewEnvironment()
+	for _, test := range configTests {
+		t.Run(test.name, func(t *testing.T) {
+			config := baseConfig
+			for _, line := range strings.Split(strings.TrimSpace(test.config), "\n") {
+				config += "  " + line + "\n"
+			}
+			err := env.NewStreamBuilder().AddOutputYAML(config)
+			if test.errContains == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, test.errContains)
+			}
 		})
 	}
 }
+
+func TestSplitBatchByChannel(t *testing.T) {
+	channelName, err := service.NewInterpolatedString(`${! @partition }`)
+	require.NoError(t, err)
+
+	var batch service.MessageBatch
+	for i, partition := range []string{"b", "a", "b", "c", "a"} {
+		msg := service.NewMessage([]byte{byte('0' + i)})
+		msg.MetaSetMut("partition", partition)
+		batch = append(batch, msg)
+	}
+
+	names, batches, err := splitBatchByChannel(batch, channelName)
+	require.NoError(t, err)
+	require.Equal(t, []string{"b", "a", "c"}, names)
+	for name, expected := range map[string]string{"a": "14", "b": "02", "c": "3"} {
+		var actual string
+		for _, msg := range batches[name] {
+			b, err := msg.AsBytes()
+			require.NoError(t, err)
+			actual += string(b)
+		}
+		require.Equal(t, expected, actual, name)
+	}
+}
+
+func newOffsetTokenBatch(offsets ...int) service.MessageBatch {
+	var batch service.MessageBatch
+	for _, offset := range offsets {
+		msg := service.NewMessage(nil)
+		msg.MetaSetMut("kafka_offset", offset)
+		batch = append(batch, msg)
+	}
+	return batch
+}
+
+func batchOffsets(t *testing.T, batch service.MessageBatch) []int {
+	t.Helper()
+	offsets := []int{}
+	for _, msg := range batch {
+		v, ok := msg.MetaGetMut("kafka_offset")
+		require.True(t, ok)
+		offsets = append(offsets, v.(int))
+	}
+	return offsets
+}
+
+func TestPreprocessForExactlyOnce(t *testing.T) {
+	offsetToken, err := service.NewInterpolatedString(`${! "%016X".format(@kafka_offset) }`)
+	require.NoError(t, err)
+	token := func(offset int) *streaming.OffsetToken {
+		tok := streaming.OffsetToken(fmt.Sprintf("%016X", offset))
+		return &tok
+	}
+
+	// A channel without a committed token writes the whole batch.
+	batch, offsets, err := preprocessForExactlyOnce(nil, offsetToken, newOffsetTokenBatch(1, 2, 3))
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2, 3}, batchOffsets(t, batch))
+	require.Equal(t, *token(1), offsets.Start)
+	require.Equal(t, *token(3), offsets.End)
+
+	// The output crashed after the files of offsets 0 to 9 were registered but before the batch was acknowledged, so
+	// the input replays them together with the following offsets. Only the messages which weren't committed are
+	// written, so there are neither duplicates nor gaps.
+	batch, offsets, err = preprocessForExactlyOnce(token(9), offsetToken, newOffsetTokenBatch(5, 6, 7, 8, 9, 10, 11))
+	require.NoError(t, err)
+	require.Equal(t, []int{10, 11}, batchOffsets(t, batch))
+	require.Equal(t, *token(10), offsets.Start)
+	require.Equal(t, *token(11), offsets.End)
+	tok, err := offsets.TokenAt(1)
+	require.NoError(t, err)
+	require.Equal(t, *token(11), tok)
+
+	// A batch which was entirely committed is acknowledged without being written.
+	batch, offsets, err = preprocessForExactlyOnce(token(9), offsetToken, newOffsetTokenBatch(0, 1, 9))
+	require.NoError(t, err)
+	require.Empty(t, batch)
+	require.Nil(t, offsets)
+
+	// Unpadded numeric tokens are compared numerically, so offset 10 isn't mistaken for a duplicate of offset 9.
+	unpadded, err := service.NewInterpolatedString(`${! @kafka_offset }`)
+	require.NoError(t, err)
+	latest := streaming.OffsetToken("9")
+	batch, offsets, err = preprocessForExactlyOnce(&latest, unpadded, newOffsetTokenBatch(8, 9, 10, 11))
+	require.NoError(t, err)
+	require.Equal(t, []int{10, 11}, batchOffsets(t, batch))
+	require.Equal(t, streaming.OffsetToken("10"), offsets.Start)
+	require.Equal(t, streaming.OffsetToken("11"), offsets.End)
+}
+
+func TestCompareOffsetTokens(t *testing.T) {
+	for _, test := range []struct {
+		a, b     string
+		expected int
+	}{
+		{a: "9", b: "10", expected: -1},
+		{a: "10", b: "9", expected: 1},
+		{a: "0010", b: "10", expected: 0},
+		{a: "0", b: "000", expected: 0},
+		{a: "123", b: "124", expected: -1},
+		{a: "0000000000000009", b: "000000000000000A", expected: -1},
+		{a: "offset-9", b: "offset-10", expected: 1},
+		{a: "", b: "0", expected: -1},
+	} {
+		require.Equal(t, test.expected, compareOffsetTokens(test.a, test.b), "%q vs %q", test.a, test.b)
+	}
+}
+
+func TestOffsetTokenPublisher(t *testing.T) {
+	mgr := service.MockResources(service.MockResourcesOptAddCache("tokens"))
+	p := newOffsetTokenPublisher("tokens", "DB.PUBLIC.TABLE", mgr)
+	require.NoError(t, p.checkCache())
+
+	ctx := context.Background()
+	p.store(ctx, "partition-1", "0000000000000010")
+	p.store(ctx, "partition-1", "0000000000000012")
+	p.store(ctx, "partition-2", "0000000000000003")
+	// The channels of another table with the same names don't overwrite the tokens of the first table.
+	other := newOffsetTokenPublisher("tokens", "DB.PUBLIC.OTHER", mgr)
+	other.store(ctx, "partition-1", "0000000000000001")
+	for key, expected := range map[string]string{
+		"DB.PUBLIC.TABLE/partition-1": "0000000000000012",
+		"DB.PUBLIC.TABLE/partition-2": "0000000000000003",
+		"DB.PUBLIC.OTHER/partition-1": "0000000000000001",
+	} {
+		var actual []byte
+		var getErr error
+		require.NoError(t, mgr.AccessCache(ctx, "tokens", func(c service.Cache) {
+			actual, getErr = c.Get(ctx, key)
+		}))
+		require.NoError(t, getErr)
+		require.Equal(t, expected, string(actual), key)
+	}
+
+	require.ErrorContains(t, newOffsetTokenPublisher("missing", "DB.PUBLIC.TABLE", mgr).checkCache(), `cache resource "missing"`)
+	require.NoError(t, newOffsetTokenPublisher("", "DB.PUBLIC.TABLE", mgr).checkCache())
+}
+
+func TestMapRows(t *testing.T) {
+	rowMapping, err := bloblang.Parse(`root = match {
+  this.type == "drop" => deleted(),
+  this.exists("events") => this.events.map_each(e -> e.assign({"id": this.id})),
+  _ => this.payload,
+}`)
+	require.NoError(t, err)
+
+	var batch service.MessageBatch
+	for _, body := range []string{
+		`{"id": 1, "events": [{"a": 1}, {"a": 2}]}`,
+		`{"type": "drop"}`,
+		`{"payload": {"a": 3}}`,
+		`{"id": 2, "events": []}`,
+	} {
+		msg := service.NewMessage([]byte(body))
+		msg.MetaSetMut("offset", body)
+		batch = append(batch, msg)
+	}
+
+	rows, sources := mapRows(batch, rowMapping, func(i int, err error) {
+		t.Fatalf("message %d failed: %s", i, err)
+	})
+	require.Equal(t, []int{0, 0, 2}, sources)
+	var actual []any
+	for i, row := range rows {
+		v, err := row.AsStructured()
+		require.NoError(t, err)
+		actual = append(actual, v)
+		offset, ok := row.MetaGetMut("offset")
+		require.True(t, ok)
+		expected, _ := batch[sources[i]].MetaGetMut("offset")
+		require.Equal(t, expected, offset)
+	}
+	require.Equal(t, []any{
+		map[string]any{"a": json.Number("1"), "id": json.Number("1")},
+		map[string]any{"a": json.Number("2"), "id": json.Number("1")},
+		map[string]any{"a": json.Number("3")},
+	}, actual)
+
+	rows[0].MetaSetMut(streaming.ConversionErrorsMetadataKey, []any{"first"})
+	rows[1].MetaSetMut(streaming.ConversionErrorsMetadataKey, []any{"second"})
+	copyRowConversionErrors(rows, sources, batch)
+	errs, ok := batch[0].MetaGetMut(streaming.ConversionErrorsMetadataKey)
+	require.True(t, ok)
+	require.Equal(t, []any{"first", "second"}, errs)
+	_, ok = batch[2].MetaGetMut(streaming.ConversionErrorsMetadataKey)
+	require.False(t, ok)
+
+	// Only the messages which the mapping fails on are rejected.
+	failed := map[int]error{}
+	rows, sources = mapRows(service.MessageBatch{
+		service.NewMessage([]byte(`{"payload": {"a": 1}}`)),
+		service.NewMessage([]byte(`{"payload": [{"a": 1}, 2]}`)),
+		service.NewMessage([]byte(`{"payload": 1}`)),
+		service.NewMessage([]byte(`{"events": 1}`)),
+	}, rowMapping, func(i int, err error) {
+		failed[i] = err
+	})
+	require.Len(t, rows, 2)
+	require.Equal(t, []int{0, 2}, sources)
+	require.Len(t, failed, 2)
+	require.ErrorContains(t, failed[1], "element 1 must be an object")
+	require.ErrorContains(t, failed[3], "error executing row_mapping")
+
+	throwMapping, err := bloblang.Parse(`root = throw("boom")`)
+	require.NoError(t, err)
+	clear(failed)
+	mapRows(service.MessageBatch{service.NewMessage([]byte(`{}`))}, throwMapping, func(i int, err error) {
+		failed[i] = err
+	})
+	require.ErrorContains(t, failed[0], "error executing row_mapping")
+}
+
+func TestStageMetadata(t *testing.T) {
+	var batch service.MessageBatch
+	for range 5 {
+		batch = append(batch, service.NewMessage([]byte(`{}`)))
+	}
+	stats := streaming.InsertStats{
+		Files: []streaming.FileStats{
+			{FirstRow: 0, Rows: 3, Size: 100, BuildTime: 2 * time.Millisecond, UploadTime: 3 * time.Millisecond, RegisterTime: time.Millisecond},
+			// The rows of the second file were sorted, so the offset of each row is its position after sorting.
+			{FirstRow: 3, Rows: 2, Size: 50, BuildTime: 500 * time.Microsecond, UploadTime: time.Millisecond, RegisterTime: 2 * time.Millisecond, RowPositions: []int32{1, 0}},
+		},
+	}
+	setStageMetadata(batch, stats, 10*time.Millisecond)
+
+	meta := func(msg *service.Message) map[string]any {
+		values := map[string]any{}
+		for _, key := range stageMetadataKeys {
+			if v, ok := msg.MetaGetMut(key); ok {
+				values[key] = v
+			}
+		}
+		return values
+	}
+	require.Equal(t, map[string]any{
+		"snowflake_build_ms":        2.0,
+		"snowflake_upload_ms":       3.0,
+		"snowflake_commit_ms":       11.0,
+		"snowflake_file_bytes":      100,
+		"snowflake_file_rows":       3,
+		"snowflake_file_row_offset": 2,
+	}, meta(batch[2]))
+	require.Equal(t, map[string]any{
+		"snowflake_build_ms":        0.5,
+		"snowflake_upload_ms":       1.0,
+		"snowflake_commit_ms":       12.0,
+		"snowflake_file_bytes":      50,
+		"snowflake_file_rows":       2,
+		"snowflake_file_row_offset": 1,
+	}, meta(batch[3]))
+	offset, _ := batch[4].MetaGetMut("snowflake_file_row_offset")
+	require.Equal(t, 0, offset)
+
+	// The rows mapped from the messages of another batch are copied back to them, messages with multiple rows get the
+	// metadata of their first row.
+	var sourceBatch service.MessageBatch
+	for range 3 {
+		sourceBatch = append(sourceBatch, service.NewMessage([]byte(`{}`)))
+	}
+	copyStageMetadata(batch, []int{0, 0, 1, 1, 1}, sourceBatch[:2])
+	require.Equal(t, meta(batch[0]), meta(sourceBatch[0]))
+	require.Equal(t, meta(batch[2]), meta(sourceBatch[1]))
+	require.Empty(t, meta(sourceBatch[2]))
+
+	copyStageMetadata(batch[:3], nil, sourceBatch)
+	require.Equal(t, meta(batch[2]), meta(sourceBatch[2]))
+}
+
+// mockTableImpl records the messages written to a table.
+type mockTableImpl struct {
+	table   string
+	mu      *sync.Mutex
+	written map[string][]string
+	closed  map[string]int
+}
+
+func (m *mockTableImpl) Connect(context.Context) error { return nil }
+
+func (m *mockTableImpl) WriteBatch(_ context.Context, batch service.MessageBatch) error {
+	if m.table == "bad" {
+		return errors.New("schema fetch failed")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, msg := range batch {
+		b, err := msg.AsBytes()
+		if err != nil {
+			return err
+		}
+		m.written[m.table] = append(m.written[m.table], string(b))
+	}
+	return nil
+}
+
+func (m *mockTableImpl) Close(context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed[m.table]++
+	return nil
+}
+
+type mockDynamicOutput struct {
+	*dynamicSnowpipeStreamingOutput
+
+	mu      sync.Mutex
+	written map[string][]string
+	opened  map[string]int
+	closed  map[string]int
+}
+
+func newMockDynamicOutput(t *testing.T, maxTables int) *mockDynamicOutput {
+	table, err := service.NewInterpolatedString(`${! @table.not_null() }`)
+	require.NoError(t, err)
+
+	m := &mockDynamicOutput{
+		dynamicSnowpipeStreamingOutput: &dynamicSnowpipeStreamingOutput{
+			table:   table,
+			logger:  service.MockResources().Logger(),
+			metrics: newSnowpipeMetrics(service.MockResources().Metrics()),
+		},
+		written: map[string][]string{},
+		opened:  map[string]int{},
+		closed:  map[string]int{},
+	}
+	m.byTable = pool.NewIndexedLimited(maxTables, func(_ context.Context, table string) (*snowpipeTableOutput, error) {
+		m.mu.Lock()
+		m.opened[table]++
+		m.mu.Unlock()
+		return &snowpipeTableOutput{output: &snowpipeStreamingOutput{
+			table:   table,
+			metrics: m.metrics,
+			logger:  m.logger,
+			impl:    &mockTableImpl{table: table, mu: &m.mu, written: m.written, closed: m.closed},
+		}}, nil
+	}, m.evictTable)
+	return m
+}
+
+func newTableBatch(tables ...string) service.MessageBatch {
+	var batch service.MessageBatch
+	for i, table := range tables {
+		msg := service.NewMessage([]byte{byte('0' + i)})
+		if table != "" {
+			msg.MetaSetMut("table", table)
+		}
+		batch = append(batch, msg)
+	}
+	return batch
+}
+
+func TestDynamicSnowpipeStreamingOutput(t *testing.T) {
+	output := newMockDynamicOutput(t, 0)
+	batch := newTableBatch("a", "b", "bad", "a", "", "b")
+
+	// Only the messages of the table which fails and the message without a table are rejected.
+	index := batch.Index()
+	err := output.WriteBatch(context.Background(), batch)
+	var batchErr *service.BatchError
+	require.ErrorAs(t, err, &batchErr)
+	failed := map[int]string{}
+	batchErr.WalkMessagesIndexedBy(index, func(i int, _ *service.Message, err error) bool {
+		if err != nil {
+			failed[i] = err.Error()
+		}
+		return true
+	})
+	require.Len(t, failed, 2)
+	require.Equal(t, "table bad: schema fetch failed", failed[2])
+	require.Contains(t, failed[4], "unable to interpolate `table`")
+	require.Equal(t, map[string][]string{"a": {"0", "3"}, "b": {"1", "5"}}, output.written)
+}
+
+func TestDynamicSnowpipeStreamingOutputMaxTables(t *testing.T) {
+	output := newMockDynamicOutput(t, 2)
+
+	// At most two tables are kept, so writing to another table closes the least recently used one, which is created
+	// again once it's written to.
+	for _, table := range []string{"a", "b", "c", "a"} {
+		require.NoError(t, output.WriteBatch(context.Background(), newTableBatch(table)))
+	}
+	output.evictions.Wait()
+
+	output.mu.Lock()
+	require.Equal(t, map[string][]string{"a": {"0", "0"}, "b": {"0"}, "c": {"0"}}, output.written)
+	require.Equal(t, map[string]int{"a": 2, "b": 1, "c": 1}, output.opened)
+	require.Equal(t, map[string]int{"a": 1, "b": 1}, output.closed)
+	output.mu.Unlock()
+	require.ElementsMatch(t, []string{"a", "c"}, output.byTable.Keys())
+}
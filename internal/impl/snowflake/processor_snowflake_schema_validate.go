@@ -0,0 +1,163 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+
+package snowflake
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/snowflake/streaming"
+	"github.com/redpanda-data/connect/v4/internal/license"
+)
+
+const (
+	sfsvFieldColumns = "columns"
+
+	schemaValidationMetadataKey = "snowflake_schema_validation"
+)
+
+func snowflakeSchemaValidateProcessorConfig() *service.ConfigSpec {
+	return service.NewConfigSpec().
+		Categories("Services").
+		Version("4.50.0").
+		Summary("Validates that messages can be written to the columns of a Snowflake table by the `snowflake_streaming` output, without writing them.").
+		Description(`
+Each message is converted into a row of a table with the columns declared in `+"`"+sfsvFieldColumns+"`"+`, exactly like the
+`+"`snowflake_streaming`"+` output with the same conversion fields converts it, but the values are discarded instead of being
+written to Snowflake. This allows checking sample payloads against a table in CI before a pipeline is deployed, rather
+than finding out about mismatches from rejected batches. Nothing is written to Snowflake and no connection is made, so the
+columns must be declared, such as with the `+"`"+ssoFieldColumns+"`"+` field of the output. Declared columns are nullable, like the
+columns which the output creates from them.
+
+The messages are passed through unchanged and the `+"`"+schemaValidationMetadataKey+"`"+` metadata field is set to an object
+with the following fields:
+
+- `+"`valid`"+`: Whether every value of the message can be written as is.
+- `+"`error`"+`: Why the message can't be converted into a row at all, such as when it isn't an object, in which case the columns aren't validated.
+- `+"`columns`"+`: An object with the result of each column, keyed by the column name in the form message keys are matched against it. Each result has a `+"`valid`"+` field, along with the `+"`error`"+` of invalid values, whether they would be `+"`written_as_null`"+` because of `+"`"+ssoFieldOnConversionError+"`"+` and whether timestamps would be `+"`clamped`"+` because of `+"`"+ssoFieldClampTimestamps+"`"+`.
+- `+"`unknown_columns`"+`: The keys of the message with non-null values which don't match any column, which the output drops unless schema evolution is enabled.
+`).
+		Fields(
+			slices.Concat(
+				[]*service.ConfigField{
+					service.NewStringMapField(sfsvFieldColumns).
+						Description("The columns of the table, as a map of column names to Snowflake data types, like the `" + ssoFieldColumns + "` field of the `snowflake_streaming` output. The column names are matched the same way as message keys.").
+						Example(map[string]any{"id": "NUMBER", "name": "STRING", "created_at": "TIMESTAMP_NTZ"}),
+				},
+				conversionFields(),
+			)...,
+		).
+		Example(
+			"Validate sample payloads in CI",
+			"Fails each message that can't be written to the table as is, so that the test reports the columns which don't match.",
+			`
+pipeline:
+  processors:
+    - snowflake_schema_validate:
+        columns:
+          id: NUMBER
+          amount: NUMBER(10, 2)
+          created_at: TIMESTAMP_NTZ
+    - mapping: |
+        root = if !@snowflake_schema_validation.valid {
+          throw(@snowflake_schema_validation.format_json())
+        }
+`,
+		)
+}
+
+func init() {
+	err := service.RegisterProcessor(
+		"snowflake_schema_validate",
+		snowflakeSchemaValidateProcessorConfig(),
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.Processor, error) {
+			if err := license.CheckRunningEnterprise(mgr); err != nil {
+				return nil, err
+			}
+			return newSchemaValidateProcessor(conf)
+		})
+	if err != nil {
+		panic(err)
+	}
+}
+
+type schemaValidateProcessor struct {
+	validator *streaming.SchemaValidator
+}
+
+func newSchemaValidateProcessor(conf *service.ParsedConfig) (*schemaValidateProcessor, error) {
+	convOpts, err := conversionOptionsFromParsed(conf)
+	if err != nil {
+		return nil, err
+	}
+	rawColumns, err := conf.FieldStringMap(sfsvFieldColumns)
+	if err != nil {
+		return nil, err
+	}
+	// The columns are checked the same way as the declared columns of the output.
+	if _, err := newDeclaredColumns(rawColumns, convOpts.caseSensitiveColumns); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", sfsvFieldColumns, err)
+	}
+	if len(rawColumns) == 0 {
+		return nil, fmt.Errorf("`%s` must not be empty", sfsvFieldColumns)
+	}
+	columns := make([]streaming.ColumnDefinition, 0, len(rawColumns))
+	for _, name := range slices.Sorted(maps.Keys(rawColumns)) {
+		columns = append(columns, streaming.ColumnDefinition{Name: name, DataType: rawColumns[name]})
+	}
+	validator, err := streaming.NewSchemaValidator(columns, convOpts.channelOptions())
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", sfsvFieldColumns, err)
+	}
+	return &schemaValidateProcessor{validator: validator}, nil
+}
+
+func (p *schemaValidateProcessor) Process(_ context.Context, msg *service.Message) (service.MessageBatch, error) {
+	msg.MetaSetMut(schemaValidationMetadataKey, schemaValidationReport(p.validator.Validate(msg)))
+	return service.MessageBatch{msg}, nil
+}
+
+func (*schemaValidateProcessor) Close(context.Context) error {
+	return nil
+}
+
+// schemaValidationReport returns the structured value of the schema validation metadata field.
+func schemaValidationReport(result *streaming.SchemaValidation) map[string]any {
+	columns := make(map[string]any, len(result.Columns))
+	for _, col := range result.Columns {
+		c := map[string]any{"valid": col.Valid}
+		if !col.Valid {
+			c["error"] = col.Error
+			c["written_as_null"] = col.WrittenAsNull
+		}
+		if col.Clamped {
+			c["clamped"] = true
+		}
+		columns[col.Column] = c
+	}
+	report := map[string]any{
+		"valid":   result.Valid,
+		"columns": columns,
+	}
+	if result.Error != "" {
+		report["error"] = result.Error
+	}
+	if len(result.UnknownColumns) > 0 {
+		unknown := make([]any, len(result.UnknownColumns))
+		for i, name := range result.UnknownColumns {
+			unknown[i] = name
+		}
+		report["unknown_columns"] = unknown
+	}
+	return report
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+
+package snowflake
+
+import (
+	"context"
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSchemaValidateProcessor(t *testing.T, yaml string) (*schemaValidateProcessor, error) {
+	t.Helper()
+	conf, err := snowflakeSchemaValidateProcessorConfig().ParseYAML(yaml, nil)
+	require.NoError(t, err)
+	return newSchemaValidateProcessor(conf)
+}
+
+func TestSchemaValidateProcessor(t *testing.T) {
+	proc, err := newTestSchemaValidateProcessor(t, `
+columns:
+  id: NUMBER
+  name: VARCHAR(100)
+  amount: NUMBER(6, 2)
+  active: BOOLEAN
+  created_at: TIMESTAMP_NTZ
+`)
+	require.NoError(t, err)
+
+	payload := `{"id":1,"name":"foo","amount":"not a number","active":true,"created_at":"2024-01-02T03:04:05Z","extra":"bar"}`
+	batch, err := proc.Process(context.Background(), service.NewMessage([]byte(payload)))
+	require.NoError(t, err)
+	require.Len(t, batch, 1)
+
+	// The message is left as is.
+	b, err := batch[0].AsBytes()
+	require.NoError(t, err)
+	require.Equal(t, payload, string(b))
+
+	report, ok := batch[0].MetaGetMut(schemaValidationMetadataKey)
+	require.True(t, ok)
+	columns := report.(map[string]any)["columns"].(map[string]any)
+	amount := columns["AMOUNT"].(map[string]any)
+	require.Contains(t, amount["error"], `invalid data for column "AMOUNT"`)
+	amount["error"] = ""
+	require.Equal(t, map[string]any{
+		"valid": false,
+		"columns": map[string]any{
+			"ID":         map[string]any{"valid": true},
+			"NAME":       map[string]any{"valid": true},
+			"AMOUNT":     map[string]any{"valid": false, "error": "", "written_as_null": false},
+			"ACTIVE":     map[string]any{"valid": true},
+			"CREATED_AT": map[string]any{"valid": true},
+		},
+		"unknown_columns": []any{"extra"},
+	}, report)
+
+	batch, err = proc.Process(context.Background(), service.NewMessage([]byte(`"not an object"`)))
+	require.NoError(t, err)
+	report, _ = batch[0].MetaGetMut(schemaValidationMetadataKey)
+	require.Equal(t, false, report.(map[string]any)["valid"])
+	require.Contains(t, report.(map[string]any)["error"], "expected object")
+}
+
+func TestSchemaValidateProcessorConversionOptions(t *testing.T) {
+	proc, err := newTestSchemaValidateProcessor(t, `
+columns:
+  id: NUMBER
+  "userId": STRING
+  day: DATE
+  notes: VARCHAR(4)
+case_sensitive_columns: true
+date_formats: [ "02/01/2006" ]
+on_conversion_error: write_null
+on_conversion_error_by_column:
+  id: reject
+ignore_columns: [ skipped ]
+`)
+	require.NoError(t, err)
+
+	batch, err := proc.Process(context.Background(), service.NewMessage([]byte(`{"id":"x","userId":"foo","day":"31/12/2024","notes":"this value is way too long","skipped":1}`)))
+	require.NoError(t, err)
+	report, _ := batch[0].MetaGetMut(schemaValidationMetadataKey)
+	columns := report.(map[string]any)["columns"].(map[string]any)
+	require.Len(t, columns, 4)
+	require.Equal(t, false, columns["id"].(map[string]any)["written_as_null"])
+	require.Equal(t, map[string]any{"valid": true}, columns["userId"])
+	require.Equal(t, map[string]any{"valid": true}, columns["day"])
+	require.Equal(t, true, columns["notes"].(map[string]any)["written_as_null"])
+	require.NotContains(t, report, "unknown_columns")
+
+	for yaml, errContains := range map[string]string{
+		`columns: {}`:                         "must not be empty",
+		`columns: { id: "NUMBER; DROP" }`:     "invalid type for column",
+		`columns: { id: NUMBER, ID: STRING }`: "declared more than once",
+		`
+columns: { id: NUMBER }
+column_transforms: { missing: "root = this" }
+`: `unknown column "missing" in column transforms`,
+		`
+columns: { id: NUMBER, ssn: STRING }
+ignore_columns: [ SSN ]
+column_transforms: { ssn: "root = null" }
+`: `invalid column_transforms: column "ssn" is listed in ignore_columns`,
+	} {
+		_, err := newTestSchemaValidateProcessor(t, yaml)
+		require.ErrorContains(t, err, errContains, yaml)
+	}
+}
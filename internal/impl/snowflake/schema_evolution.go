@@ -13,7 +13,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"regexp"
 	"strings"
 	"time"
 
@@ -69,16 +68,29 @@ func asSchemaMigrationError(err error) (*schemaMigrationNeededError, bool) {
 
 type snowpipeSchemaEvolver struct {
 	mode                   streaming.SchemaMode
+	caseSensitiveColumns   bool
 	schemaEvolutionMapping *bloblang.Executor
 	pipeline               []*service.OwnedProcessor
-	logger                 *service.Logger
+	// The decoder of the schema registry, whose schemas determine the types of the columns of their fields.
+	decoder *schemaRegistryDecoder
+	logger  *service.Logger
 	// The evolver does not close nor own this rest client.
 	restClient              *streaming.SnowflakeRestClient
 	db, schema, table, role string
+	// Columns declared in the config, which are used instead of inferring the
+	// types of columns when creating the table or adding columns to it.
+	declaredColumns declaredColumns
+	autoCreateTable bool
+	autoAddColumns  bool
 }
 
 func (o *snowpipeSchemaEvolver) ComputeMissingColumnType(ctx context.Context, col *streaming.MissingColumnError) (string, error) {
 	if len(o.pipeline) == 0 && o.schemaEvolutionMapping == nil {
+		if o.decoder != nil {
+			if columnType, ok := o.decoder.columnType(col.Message(), col.RawName()); ok {
+				return columnType, nil
+			}
+		}
 		// The default mapping if not specified by a user
 		switch col.Value().(type) {
 		case []byte:
@@ -205,6 +217,9 @@ func (o *snowpipeSchemaEvolver) CreateOutputTable(ctx context.Context, batch ser
 			continue
 		}
 		col := streaming.NewMissingColumnError(msg, k, v)
+		if o.caseSensitiveColumns {
+			col = streaming.NewCaseSensitiveMissingColumnError(msg, k, v)
+		}
 		colType, err := o.ComputeMissingColumnType(ctx, col)
 		if err != nil {
 			return err
@@ -240,13 +255,8 @@ func (o *snowpipeSchemaEvolver) RunSQLMigration(ctx context.Context, statement s
 	return err
 }
 
-// This doesn't need to fully match, but be enough to prevent SQL injection as well as
-// catch common errors.
-var validColumnTypeRegex = regexp.MustCompile(`^\s*(?i:NUMBER|DECIMAL|NUMERIC|INT|INTEGER|BIGINT|SMALLINT|TINYINT|BYTEINT|FLOAT|FLOAT4|FLOAT8|DOUBLE|DOUBLE\s+PRECISION|REAL|VARCHAR|CHAR|CHARACTER|STRING|TEXT|BINARY|VARBINARY|BOOLEAN|DATE|DATETIME|TIME|TIMESTAMP|TIMESTAMP_LTZ|TIMESTAMP_NTZ|TIMESTAMP_TZ|VARIANT|OBJECT|ARRAY)\s*(?:\(\s*\d+\s*\)|\(\s*\d+\s*,\s*\d+\s*\))?\s*$`)
-
+// validateColumnType checks that columns are only added with the data types which channels write and which the
+// snowflake_schema_validate processor validates against, which also prevents SQL injection.
 func validateColumnType(v string) error {
-	if validColumnTypeRegex.MatchString(v) {
-		return nil
-	}
-	return fmt.Errorf("invalid Snowflake column data type: %s", v)
+	return streaming.ValidateColumnDataType(v)
 }
@@ -0,0 +1,121 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package snowflake
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/snowflake/streaming"
+)
+
+type openChannelFn func(ctx context.Context, name string, id int16) (*streaming.SnowflakeIngestionChannel, error)
+
+// snowpipeSchemaRefresher reopens channels so that columns which have been added to the table after a channel was
+// opened are picked up. The schema of a channel never changes, so refreshing it between batches guarantees that a
+// single file never mixes schemas and that in-flight batches complete with the schema they were built with.
+type snowpipeSchemaRefresher struct {
+	interval  time.Duration
+	openFn    openChannelFn
+	logger    *service.Logger
+	refreshes *service.MetricCounter
+
+	mu sync.Mutex
+	// Unknown columns which already triggered a refresh of a channel, keyed by channel name, so that messages with keys
+	// that will never match a column don't cause a refresh for every batch.
+	attempted map[string][]string
+}
+
+func newSnowpipeSchemaRefresher(interval time.Duration, openFn openChannelFn, logger *service.Logger, metrics *snowpipeMetrics) *snowpipeSchemaRefresher {
+	return &snowpipeSchemaRefresher{
+		interval:  interval,
+		openFn:    openFn,
+		logger:    logger,
+		refreshes: metrics.schemaRefreshes,
+		attempted: map[string][]string{},
+	}
+}
+
+// MaybeRefresh returns the channel to use for inserting the batch. The channel is reopened if the refresh interval has
+// elapsed since it was opened or if the batch contains keys that don't match any known column. If reopening the channel
+// fails then the existing channel is returned.
+func (r *snowpipeSchemaRefresher) MaybeRefresh(ctx context.Context, channel *streaming.SnowflakeIngestionChannel, batch service.MessageBatch) *streaming.SnowflakeIngestionChannel {
+	expired := time.Since(channel.OpenTime()) >= r.interval
+	var unknown []string
+	if !expired {
+		attempted := r.getAttempted(channel.Name)
+		for _, col := range channel.UnknownColumns(batch) {
+			if _, found := slices.BinarySearch(attempted, col); !found {
+				unknown = append(unknown, col)
+			}
+		}
+		if len(unknown) == 0 {
+			return channel
+		}
+		r.logger.Debugf("refreshing schema of channel %s due to unknown columns: %v", channel.Name, unknown)
+	}
+
+	refreshed, err := r.openFn(ctx, channel.Name, channel.ID)
+	if err != nil {
+		r.logger.Warnf("unable to refresh schema of channel %s: %v", channel.Name, err)
+		return channel
+	}
+
+	if expired {
+		r.setAttempted(channel.Name, nil)
+	} else {
+		// Remember the columns which are still unknown so we don't try again until the next periodic refresh.
+		attempted := append(r.getAttempted(channel.Name), refreshed.UnknownColumns(batch)...)
+		slices.Sort(attempted)
+		r.setAttempted(channel.Name, slices.Compact(attempted))
+	}
+
+	added, removed := diffColumns(channel.Columns(), refreshed.Columns())
+	if len(added) > 0 || len(removed) > 0 {
+		r.refreshes.Incr(1, refreshed.TableName)
+		r.logger.Infof("schema of table `%s.%s.%s` changed for channel %s, added columns: %v, removed columns: %v", refreshed.DatabaseName, refreshed.SchemaName, refreshed.TableName, refreshed.Name, added, removed)
+	}
+	return refreshed
+}
+
+func (r *snowpipeSchemaRefresher) getAttempted(name string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.attempted[name])
+}
+
+func (r *snowpipeSchemaRefresher) setAttempted(name string, columns []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(columns) == 0 {
+		delete(r.attempted, name)
+		return
+	}
+	r.attempted[name] = columns
+}
+
+func diffColumns(before, after []string) (added, removed []string) {
+	for _, col := range after {
+		if !slices.Contains(before, col) {
+			added = append(added, col)
+		}
+	}
+	for _, col := range before {
+		if !slices.Contains(after, col) {
+			removed = append(removed, col)
+		}
+	}
+	return
+}
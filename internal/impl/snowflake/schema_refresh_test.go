@@ -0,0 +1,27 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package snowflake
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffColumns(t *testing.T) {
+	added, removed := diffColumns([]string{"A", "B", "C"}, []string{"A", "C", "D", "E"})
+	require.Equal(t, []string{"D", "E"}, added)
+	require.Equal(t, []string{"B"}, removed)
+
+	added, removed = diffColumns([]string{"A", "B"}, []string{"B", "A"})
+	require.Empty(t, added)
+	require.Empty(t, removed)
+}
@@ -0,0 +1,379 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+
+package snowflake
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/hamba/avro/v2"
+	franz_sr "github.com/twmb/franz-go/pkg/sr"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/confluent"
+	"github.com/redpanda-data/connect/v4/internal/impl/confluent/sr"
+)
+
+// schemaIDMetadataKey is the metadata key of the ID of the schema that a message was decoded with.
+const schemaIDMetadataKey = "schema_id"
+
+// schemaRegistryDecoder decodes messages that are encoded with Avro or Protobuf schemas of a schema registry in the
+// Confluent wire format into rows, whose keys are the column names that the fields of the schema map to.
+type schemaRegistryDecoder struct {
+	client      *sr.Client
+	columnNames *columnNameMapper
+
+	mu      sync.RWMutex
+	schemas map[int]*registrySchema
+	// Each schema is only fetched once by the batches which are waiting for it, while other schemas are fetched
+	// concurrently.
+	fetches singleflight.Group
+}
+
+// registrySchema is a schema of the registry, which is cached by its ID.
+type registrySchema struct {
+	decoder *confluent.SchemaDecoder
+	// The types of the columns that the top level fields of Avro schemas map to, keyed by the column names. Protobuf
+	// schemas don't have any, so the types of their columns are inferred from the values instead.
+	columnTypes map[string]string
+}
+
+func newSchemaRegistryDecoderFromConfig(conf *service.ParsedConfig, mgr *service.Resources) (*schemaRegistryDecoder, error) {
+	url, err := conf.FieldString(ssoFieldSchemaRegistryURL)
+	if err != nil {
+		return nil, err
+	}
+	reqSigner, err := conf.HTTPRequestAuthSignerFromParsed()
+	if err != nil {
+		return nil, err
+	}
+	tlsConf, err := conf.FieldTLS(ssoFieldSchemaRegistryTLS)
+	if err != nil {
+		return nil, err
+	}
+	client, err := sr.NewClient(url, reqSigner, tlsConf, mgr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create schema registry client: %w", err)
+	}
+	mode, err := conf.FieldString(ssoFieldSchemaRegistryColumnNameMapping)
+	if err != nil {
+		return nil, err
+	}
+	var custom *bloblang.Executor
+	if conf.Contains(ssoFieldSchemaRegistryCustomColumnNameMapping) {
+		if custom, err = conf.FieldBloblang(ssoFieldSchemaRegistryCustomColumnNameMapping); err != nil {
+			return nil, err
+		}
+	}
+	columnNames, err := newColumnNameMapper(mode, custom)
+	if err != nil {
+		return nil, err
+	}
+	return newSchemaRegistryDecoder(client, columnNames), nil
+}
+
+func newSchemaRegistryDecoder(client *sr.Client, columnNames *columnNameMapper) *schemaRegistryDecoder {
+	return &schemaRegistryDecoder{
+		client:      client,
+		columnNames: columnNames,
+		schemas:     map[int]*registrySchema{},
+	}
+}
+
+// decodeBatch decodes the messages of batch into copies of them and returns the decoded messages along with the index
+// of the message that each of them was decoded from. Messages that can't be decoded are passed to failed.
+func (d *schemaRegistryDecoder) decodeBatch(ctx context.Context, batch service.MessageBatch, failed func(i int, err error)) (service.MessageBatch, []int) {
+	decoded := make(service.MessageBatch, 0, len(batch))
+	sources := make([]int, 0, len(batch))
+	for i, msg := range batch {
+		row, err := d.decode(ctx, msg)
+		if err != nil {
+			failed(i, fmt.Errorf("unable to decode message with %s: %w", ssoFieldSchemaRegistry, err))
+			continue
+		}
+		decoded = append(decoded, row)
+		sources = append(sources, i)
+	}
+	return decoded, sources
+}
+
+func (d *schemaRegistryDecoder) decode(ctx context.Context, msg *service.Message) (*service.Message, error) {
+	b, err := msg.AsBytes()
+	if err != nil {
+		return nil, err
+	}
+	var header franz_sr.ConfluentHeader
+	id, payload, err := header.DecodeID(b)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := d.schema(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	v, err := schema.decoder.Decode(payload)
+	if err != nil {
+		return nil, err
+	}
+	row, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a record or message, got %T", v)
+	}
+	if row, err = d.columnNames.mapRow(row); err != nil {
+		return nil, err
+	}
+	decoded := msg.Copy()
+	decoded.SetStructuredMut(row)
+	decoded.MetaSetMut(schemaIDMetadataKey, id)
+	return decoded, nil
+}
+
+// columnType returns the type of the column that a field of the schema that msg was decoded with maps to, which is
+// false when the type should be inferred from its value instead.
+func (d *schemaRegistryDecoder) columnType(msg *service.Message, column string) (string, bool) {
+	v, ok := msg.MetaGetMut(schemaIDMetadataKey)
+	if !ok {
+		return "", false
+	}
+	id, ok := v.(int)
+	if !ok {
+		return "", false
+	}
+	d.mu.RLock()
+	schema, ok := d.schemas[id]
+	d.mu.RUnlock()
+	if !ok {
+		return "", false
+	}
+	columnType, ok := schema.columnTypes[column]
+	return columnType, ok
+}
+
+func (d *schemaRegistryDecoder) schema(ctx context.Context, id int) (*registrySchema, error) {
+	d.mu.RLock()
+	schema, ok := d.schemas[id]
+	d.mu.RUnlock()
+	if ok {
+		return schema, nil
+	}
+
+	v, err, _ := d.fetches.Do(strconv.Itoa(id), func() (any, error) {
+		// Another batch may have fetched the schema since it was looked up.
+		d.mu.RLock()
+		schema, ok := d.schemas[id]
+		d.mu.RUnlock()
+		if ok {
+			return schema, nil
+		}
+
+		info, err := d.client.GetSchemaByID(ctx, id, false)
+		if err != nil {
+			return nil, fmt.Errorf("unable to fetch schema %d: %w", id, err)
+		}
+		if schema, err = d.newSchema(ctx, info); err != nil {
+			return nil, fmt.Errorf("schema %d: %w", id, err)
+		}
+
+		d.mu.Lock()
+		d.schemas[id] = schema
+		d.mu.Unlock()
+		return schema, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*registrySchema), nil
+}
+
+func (d *schemaRegistryDecoder) newSchema(ctx context.Context, info franz_sr.Schema) (*registrySchema, error) {
+	decoder, err := confluent.NewSchemaDecoder(ctx, d.client, info)
+	if err != nil {
+		return nil, err
+	}
+	if decoder.AvroSchema == nil {
+		return &registrySchema{decoder: decoder}, nil
+	}
+
+	record, ok := decoder.AvroSchema.(*avro.RecordSchema)
+	if !ok {
+		return nil, fmt.Errorf("expected an Avro record schema, got %v", decoder.AvroSchema.Type())
+	}
+	columnTypes := map[string]string{}
+	for _, f := range record.Fields() {
+		column, err := d.columnNames.mapName(f.Name())
+		if err != nil {
+			return nil, err
+		}
+		if columnType := avroColumnType(f.Type()); columnType != "" {
+			columnTypes[column] = columnType
+		}
+	}
+	return &registrySchema{decoder: decoder, columnTypes: columnTypes}, nil
+}
+
+// avroColumnType returns the type of the column that a field of an Avro schema is written to, which is empty when it
+// should be inferred from the values of the field instead. The columns of unions with null are the columns of their
+// other member, which are nullable like all columns that are added by schema evolution.
+func avroColumnType(schema avro.Schema) string {
+	switch s := schema.(type) {
+	case *avro.RefSchema:
+		return avroColumnType(s.Schema())
+	case *avro.UnionSchema:
+		if !s.Nullable() {
+			return ""
+		}
+		for _, t := range s.Types() {
+			if t.Type() != avro.Null {
+				return avroColumnType(t)
+			}
+		}
+		return ""
+	}
+	if ls, ok := schema.(avro.LogicalTypeSchema); ok && ls.Logical() != nil {
+		if l, ok := ls.Logical().(*avro.DecimalLogicalSchema); ok {
+			if l.Precision() > 38 {
+				return ""
+			}
+			return fmt.Sprintf("NUMBER(%d,%d)", l.Precision(), l.Scale())
+		}
+		switch ls.Logical().Type() {
+		case avro.Date:
+			return "DATE"
+		case avro.TimeMillis:
+			return "TIME(3)"
+		case avro.TimeMicros:
+			return "TIME(6)"
+		case avro.TimestampMillis:
+			return "TIMESTAMP_LTZ(3)"
+		case avro.TimestampMicros:
+			return "TIMESTAMP_LTZ(6)"
+		case avro.LocalTimestampMillis:
+			return "TIMESTAMP_NTZ(3)"
+		case avro.LocalTimestampMicros:
+			return "TIMESTAMP_NTZ(6)"
+		case avro.UUID:
+			return "STRING"
+		}
+	}
+	switch schema.Type() {
+	case avro.Boolean:
+		return "BOOLEAN"
+	case avro.Int, avro.Long:
+		return "BIGINT"
+	case avro.Float, avro.Double:
+		return "DOUBLE"
+	case avro.String, avro.Enum:
+		return "STRING"
+	case avro.Bytes, avro.Fixed:
+		return "BINARY"
+	default:
+		return ""
+	}
+}
+
+// columnNameMapper maps the names of the top level fields of decoded messages to column names.
+type columnNameMapper struct {
+	mapping func(name string) (string, error)
+
+	mu    sync.RWMutex
+	names map[string]string
+}
+
+func newColumnNameMapper(mode string, custom *bloblang.Executor) (*columnNameMapper, error) {
+	m := &columnNameMapper{names: map[string]string{}}
+	switch mode {
+	case "none":
+		m.mapping = func(name string) (string, error) { return name, nil }
+	case "snake_upper":
+		m.mapping = func(name string) (string, error) { return snakeUpper(name), nil }
+	case "custom":
+		if custom == nil {
+			return nil, fmt.Errorf("`%s` must be set when `%s` is custom", ssoFieldSchemaRegistryCustomColumnNameMapping, ssoFieldSchemaRegistryColumnNameMapping)
+		}
+		m.mapping = func(name string) (string, error) {
+			v, err := custom.Query(name)
+			if err != nil {
+				return "", fmt.Errorf("unable to map field %q to a column name: %w", name, err)
+			}
+			column, ok := v.(string)
+			if !ok || column == "" {
+				return "", fmt.Errorf("mapping field %q to a column name must result in a non-empty string, got %T", name, v)
+			}
+			return column, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown %s: %q", ssoFieldSchemaRegistryColumnNameMapping, mode)
+	}
+	return m, nil
+}
+
+// mapName returns the column name of a field, the names are cached as they only depend on the field name.
+func (m *columnNameMapper) mapName(name string) (string, error) {
+	m.mu.RLock()
+	column, ok := m.names[name]
+	m.mu.RUnlock()
+	if ok {
+		return column, nil
+	}
+	column, err := m.mapping(name)
+	if err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	m.names[name] = column
+	m.mu.Unlock()
+	return column, nil
+}
+
+// mapRow returns row with its keys mapped to column names.
+func (m *columnNameMapper) mapRow(row map[string]any) (map[string]any, error) {
+	mapped := make(map[string]any, len(row))
+	fields := make(map[string]string, len(row))
+	for name, v := range row {
+		column, err := m.mapName(name)
+		if err != nil {
+			return nil, err
+		}
+		if other, exists := fields[column]; exists {
+			return nil, fmt.Errorf("fields %q and %q both map to column %q", other, name, column)
+		}
+		fields[column] = name
+		mapped[column] = v
+	}
+	return mapped, nil
+}
+
+// snakeUpper converts a field name such as orderId or HTTPStatus into an upper snake case column name such as ORDER_ID
+// or HTTP_STATUS. Dashes, dots and spaces are replaced with underscores.
+func snakeUpper(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	b.Grow(len(name) + 4)
+	for i, r := range runes {
+		switch {
+		case r == '-' || r == '.' || r == ' ':
+			r = '_'
+		case unicode.IsUpper(r) && i > 0:
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,485 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package snowflake
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io/fs"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hamba/avro/v2"
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/confluent/sr"
+	"github.com/redpanda-data/connect/v4/internal/impl/protobuf"
+	"github.com/redpanda-data/connect/v4/internal/impl/snowflake/streaming"
+)
+
+// testAvroSchema is a fixture with a field of each logical type and nullable unions.
+const testAvroSchema = `{
+  "type": "record",
+  "name": "order",
+  "fields": [
+    { "name": "orderId", "type": "long" },
+    { "name": "amount", "type": { "type": "bytes", "logicalType": "decimal", "precision": 10, "scale": 2 } },
+    { "name": "price", "type": { "type": "fixed", "name": "price", "size": 8, "logicalType": "decimal", "precision": 18, "scale": 4 } },
+    { "name": "orderDate", "type": { "type": "int", "logicalType": "date" } },
+    { "name": "pickupTimeMillis", "type": { "type": "int", "logicalType": "time-millis" } },
+    { "name": "pickupTimeMicros", "type": { "type": "long", "logicalType": "time-micros" } },
+    { "name": "createdAtMillis", "type": { "type": "long", "logicalType": "timestamp-millis" } },
+    { "name": "createdAtMicros", "type": { "type": "long", "logicalType": "timestamp-micros" } },
+    { "name": "localCreatedAt", "type": { "type": "long", "logicalType": "local-timestamp-millis" } },
+    { "name": "note", "type": [ "null", "string" ], "default": null },
+    { "name": "shippedAt", "type": [ "null", { "type": "long", "logicalType": "timestamp-millis" } ], "default": null }
+  ]
+}`
+
+type testOrder struct {
+	OrderID          int64         `avro:"orderId"`
+	Amount           *big.Rat      `avro:"amount"`
+	Price            *big.Rat      `avro:"price"`
+	OrderDate        time.Time     `avro:"orderDate"`
+	PickupTimeMillis time.Duration `avro:"pickupTimeMillis"`
+	PickupTimeMicros time.Duration `avro:"pickupTimeMicros"`
+	CreatedAtMillis  time.Time     `avro:"createdAtMillis"`
+	CreatedAtMicros  time.Time     `avro:"createdAtMicros"`
+	LocalCreatedAt   time.Time     `avro:"localCreatedAt"`
+	Note             *string       `avro:"note"`
+	ShippedAt        *time.Time    `avro:"shippedAt"`
+}
+
+const testProtobufSchema = `
+syntax = "proto3";
+package test;
+
+message Order {
+  int64 order_id = 1;
+  string customer_name = 2;
+}
+`
+
+// runTestSchemaRegistry serves the schemas by their ID and returns how often a path was requested.
+func runTestSchemaRegistry(t *testing.T, schemas map[int]string) (*sr.Client, func(path string) int) {
+	t.Helper()
+	var mu sync.Mutex
+	requested := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.URL.Path]++
+		mu.Unlock()
+		for id, schema := range schemas {
+			if r.URL.Path == "/schemas/ids/"+strconv.Itoa(id) {
+				_, _ = w.Write([]byte(schema))
+				return
+			}
+		}
+		http.Error(w, `{"error_code":40403,"message":"Schema not found"}`, http.StatusNotFound)
+	}))
+	t.Cleanup(ts.Close)
+
+	client, err := sr.NewClient(ts.URL, func(fs.FS, *http.Request) error { return nil }, nil, service.MockResources())
+	require.NoError(t, err)
+	return client, func(path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requested[path]
+	}
+}
+
+func schemaResponse(t *testing.T, schemaType, schema string) string {
+	t.Helper()
+	b, err := json.Marshal(map[string]any{"schemaType": schemaType, "schema": schema})
+	require.NoError(t, err)
+	return string(b)
+}
+
+// confluentMessage frames a payload in the Confluent wire format.
+func confluentMessage(id int, payload []byte) *service.Message {
+	b := []byte{0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(b[1:], uint32(id))
+	return service.NewMessage(append(b, payload...))
+}
+
+func newTestSchemaRegistryDecoder(t *testing.T, mode string, custom string) *schemaRegistryDecoder {
+	t.Helper()
+	client, _ := runTestSchemaRegistry(t, map[int]string{
+		1: schemaResponse(t, "AVRO", testAvroSchema),
+		2: schemaResponse(t, "PROTOBUF", testProtobufSchema),
+	})
+	var exec *bloblang.Executor
+	if custom != "" {
+		var err error
+		exec, err = bloblang.Parse(custom)
+		require.NoError(t, err)
+	}
+	columnNames, err := newColumnNameMapper(mode, exec)
+	require.NoError(t, err)
+	return newSchemaRegistryDecoder(client, columnNames)
+}
+
+func testAvroMessage(t *testing.T, note *string, shippedAt *time.Time) *service.Message {
+	t.Helper()
+	schema, err := avro.Parse(testAvroSchema)
+	require.NoError(t, err)
+	payload, err := avro.Marshal(schema, testOrder{
+		OrderID:          42,
+		Amount:           big.NewRat(12345, 100),
+		Price:            big.NewRat(-3, 2),
+		OrderDate:        time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+		PickupTimeMillis: 13*time.Hour + 30*time.Minute + 1500*time.Millisecond,
+		PickupTimeMicros: 13*time.Hour + 1500*time.Microsecond,
+		CreatedAtMillis:  time.Date(2025, 3, 1, 12, 0, 0, 123_000_000, time.UTC),
+		CreatedAtMicros:  time.Date(2025, 3, 1, 12, 0, 0, 123_456_000, time.UTC),
+		LocalCreatedAt:   time.Date(2025, 3, 1, 14, 0, 0, 0, time.UTC),
+		Note:             note,
+		ShippedAt:        shippedAt,
+	})
+	require.NoError(t, err)
+	return confluentMessage(1, payload)
+}
+
+func TestSchemaRegistryDecoderAvro(t *testing.T) {
+	ctx := context.Background()
+	d := newTestSchemaRegistryDecoder(t, "snake_upper", "")
+
+	note := "fragile"
+	shippedAt := time.Date(2025, 3, 2, 8, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		name      string
+		msg       *service.Message
+		note      any
+		shippedAt any
+	}{
+		{name: "nulls", msg: testAvroMessage(t, nil, nil)},
+		{name: "values", msg: testAvroMessage(t, &note, &shippedAt), note: note, shippedAt: shippedAt},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			decoded, err := d.decode(ctx, test.msg)
+			require.NoError(t, err)
+			row, err := decoded.AsStructured()
+			require.NoError(t, err)
+			assert.Equal(t, map[string]any{
+				"ORDER_ID":           int64(42),
+				"AMOUNT":             json.Number("123.45"),
+				"PRICE":              json.Number("-1.5000"),
+				"ORDER_DATE":         time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+				"PICKUP_TIME_MILLIS": time.Time{}.Add(13*time.Hour + 30*time.Minute + 1500*time.Millisecond),
+				"PICKUP_TIME_MICROS": time.Time{}.Add(13*time.Hour + 1500*time.Microsecond),
+				"CREATED_AT_MILLIS":  time.Date(2025, 3, 1, 12, 0, 0, 123_000_000, time.UTC),
+				"CREATED_AT_MICROS":  time.Date(2025, 3, 1, 12, 0, 0, 123_456_000, time.UTC),
+				"LOCAL_CREATED_AT":   time.Date(2025, 3, 1, 14, 0, 0, 0, time.UTC),
+				"NOTE":               test.note,
+				"SHIPPED_AT":         test.shippedAt,
+			}, row)
+			id, ok := decoded.MetaGetMut(schemaIDMetadataKey)
+			require.True(t, ok)
+			assert.Equal(t, 1, id)
+
+			// The original message is left untouched, so that it can be retried or rejected.
+			b, err := test.msg.AsBytes()
+			require.NoError(t, err)
+			assert.Equal(t, byte(0), b[0])
+		})
+	}
+
+	columnTypes := map[string]string{}
+	for _, column := range []string{
+		"ORDER_ID", "AMOUNT", "PRICE", "ORDER_DATE", "PICKUP_TIME_MILLIS", "PICKUP_TIME_MICROS",
+		"CREATED_AT_MILLIS", "CREATED_AT_MICROS", "LOCAL_CREATED_AT", "NOTE", "SHIPPED_AT",
+	} {
+		msg, err := d.decode(ctx, testAvroMessage(t, nil, nil))
+		require.NoError(t, err)
+		columnType, ok := d.columnType(msg, column)
+		require.True(t, ok, column)
+		columnTypes[column] = columnType
+	}
+	assert.Equal(t, map[string]string{
+		"ORDER_ID":           "BIGINT",
+		"AMOUNT":             "NUMBER(10,2)",
+		"PRICE":              "NUMBER(18,4)",
+		"ORDER_DATE":         "DATE",
+		"PICKUP_TIME_MILLIS": "TIME(3)",
+		"PICKUP_TIME_MICROS": "TIME(6)",
+		"CREATED_AT_MILLIS":  "TIMESTAMP_LTZ(3)",
+		"CREATED_AT_MICROS":  "TIMESTAMP_LTZ(6)",
+		"LOCAL_CREATED_AT":   "TIMESTAMP_NTZ(3)",
+		"NOTE":               "STRING",
+		"SHIPPED_AT":         "TIMESTAMP_LTZ(3)",
+	}, columnTypes)
+	for column, columnType := range columnTypes {
+		require.NoError(t, validateColumnType(columnType), column)
+	}
+}
+
+func TestSchemaRegistryDecoderProtobuf(t *testing.T) {
+	d := newTestSchemaRegistryDecoder(t, "snake_upper", "")
+
+	files, _, err := protobuf.RegistriesFromMap(map[string]string{"order.proto": testProtobufSchema})
+	require.NoError(t, err)
+	file, err := files.FindFileByPath("order.proto")
+	require.NoError(t, err)
+	desc := file.Messages().Get(0)
+	order := dynamicpb.NewMessage(desc)
+	order.Set(desc.Fields().ByName("order_id"), protoreflect.ValueOfInt64(42))
+	order.Set(desc.Fields().ByName("customer_name"), protoreflect.ValueOfString("foo"))
+	payload, err := proto.Marshal(order)
+	require.NoError(t, err)
+
+	// The message indexes of the first message are a single zero.
+	decoded, err := d.decode(context.Background(), confluentMessage(2, append([]byte{0}, payload...)))
+	require.NoError(t, err)
+	row, err := decoded.AsStructured()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"ORDER_ID": "42", "CUSTOMER_NAME": "foo"}, row)
+
+	// The types of the columns of Protobuf fields are inferred from their values.
+	_, ok := d.columnType(decoded, "ORDER_ID")
+	assert.False(t, ok)
+}
+
+func TestSchemaRegistryDecoderErrors(t *testing.T) {
+	ctx := context.Background()
+	d := newTestSchemaRegistryDecoder(t, "none", "")
+
+	for _, test := range []struct {
+		name        string
+		msg         *service.Message
+		errContains string
+	}{
+		{name: "not framed", msg: service.NewMessage([]byte(`{"orderId":42}`)), errContains: "magic byte"},
+		{name: "unknown schema", msg: confluentMessage(5, []byte{0}), errContains: "unable to fetch schema 5"},
+		{name: "truncated payload", msg: confluentMessage(1, []byte{0x54}), errContains: "unable to unmarshal avro"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := d.decode(ctx, test.msg)
+			require.Error(t, err)
+			assert.Contains(t, strings.ToLower(err.Error()), strings.ToLower(test.errContains))
+		})
+	}
+}
+
+func TestSchemaRegistryDecoderCachesSchemas(t *testing.T) {
+	ctx := context.Background()
+	client, requested := runTestSchemaRegistry(t, map[int]string{1: schemaResponse(t, "AVRO", testAvroSchema)})
+	columnNames, err := newColumnNameMapper("none", nil)
+	require.NoError(t, err)
+	d := newSchemaRegistryDecoder(client, columnNames)
+
+	// Concurrent batches wait for the schema which is being fetched instead of fetching it again.
+	var wg sync.WaitGroup
+	for range 3 {
+		msg := testAvroMessage(t, nil, nil)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := d.decode(ctx, msg)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	_, err = d.decode(ctx, testAvroMessage(t, nil, nil))
+	require.NoError(t, err)
+	assert.Equal(t, 1, requested("/schemas/ids/1"))
+}
+
+func TestSnowpipeStreamingOutputRejectsUndecodableMessages(t *testing.T) {
+	var mu sync.Mutex
+	written := map[string][]string{}
+	output := &snowpipeStreamingOutput{
+		decoder: newTestSchemaRegistryDecoder(t, "snake_upper", ""),
+		table:   "foo",
+		metrics: newSnowpipeMetrics(service.MockResources().Metrics()),
+		logger:  service.MockResources().Logger(),
+		impl:    &mockTableImpl{table: "foo", mu: &mu, written: written, closed: map[string]int{}},
+	}
+
+	batch := service.MessageBatch{
+		testAvroMessage(t, nil, nil),
+		service.NewMessage([]byte("nope")),
+		testAvroMessage(t, nil, nil),
+	}
+	index := batch.Index()
+	err := output.WriteBatch(context.Background(), batch)
+	var batchErr *service.BatchError
+	require.ErrorAs(t, err, &batchErr)
+	failed := map[int]string{}
+	batchErr.WalkMessagesIndexedBy(index, func(i int, _ *service.Message, err error) bool {
+		if err != nil {
+			failed[i] = err.Error()
+		}
+		return true
+	})
+	require.Len(t, failed, 1)
+	assert.Contains(t, failed[1], "unable to decode message with schema_registry")
+
+	// The rest of the batch is written as decoded rows.
+	require.Len(t, written["foo"], 2)
+	assert.Contains(t, written["foo"][0], `"AMOUNT":123.45`)
+}
+
+func TestDynamicSnowpipeStreamingOutputDecodesBeforeResolvingTables(t *testing.T) {
+	output := newMockDynamicOutput(t, 0)
+	output.decoder = newTestSchemaRegistryDecoder(t, "none", "")
+	table, err := service.NewInterpolatedString(`${! if this.note == null { "unshipped" } else { "shipped" } }`)
+	require.NoError(t, err)
+	output.table = table
+
+	note := "fragile"
+	batch := service.MessageBatch{
+		testAvroMessage(t, nil, nil),
+		service.NewMessage([]byte("nope")),
+		testAvroMessage(t, &note, nil),
+	}
+	index := batch.Index()
+	err = output.WriteBatch(context.Background(), batch)
+	var batchErr *service.BatchError
+	require.ErrorAs(t, err, &batchErr)
+	var failed []int
+	batchErr.WalkMessagesIndexedBy(index, func(i int, _ *service.Message, err error) bool {
+		if err != nil {
+			failed = append(failed, i)
+		}
+		return true
+	})
+	assert.Equal(t, []int{1}, failed)
+	assert.Len(t, output.written["unshipped"], 1)
+	assert.Len(t, output.written["shipped"], 1)
+}
+
+func TestSchemaEvolverAvroColumnTypes(t *testing.T) {
+	ctx := context.Background()
+	d := newTestSchemaRegistryDecoder(t, "snake_upper", "")
+	evolver := &snowpipeSchemaEvolver{decoder: d}
+
+	msg, err := d.decode(ctx, testAvroMessage(t, nil, nil))
+	require.NoError(t, err)
+	columnType, err := evolver.ComputeMissingColumnType(ctx, streaming.NewMissingColumnError(msg, "AMOUNT", json.Number("123.45")))
+	require.NoError(t, err)
+	assert.Equal(t, "NUMBER(10,2)", columnType)
+
+	// Keys that aren't fields of the schema are inferred from their values.
+	columnType, err = evolver.ComputeMissingColumnType(ctx, streaming.NewMissingColumnError(msg, "EXTRA", json.Number("1.5")))
+	require.NoError(t, err)
+	assert.Equal(t, "DOUBLE", columnType)
+}
+
+func TestSnakeUpper(t *testing.T) {
+	for name, expected := range map[string]string{
+		"orderId":       "ORDER_ID",
+		"OrderID":       "ORDER_ID",
+		"HTTPStatus":    "HTTP_STATUS",
+		"already_snake": "ALREADY_SNAKE",
+		"ALREADY_UPPER": "ALREADY_UPPER",
+		"field1Name":    "FIELD1_NAME",
+		"dotted.name":   "DOTTED_NAME",
+		"kebab-case":    "KEBAB_CASE",
+		"x":             "X",
+	} {
+		assert.Equal(t, expected, snakeUpper(name), name)
+	}
+}
+
+func TestColumnNameMapper(t *testing.T) {
+	exec, err := bloblang.Parse(`root = "c_" + this.lowercase()`)
+	require.NoError(t, err)
+	custom, err := newColumnNameMapper("custom", exec)
+	require.NoError(t, err)
+	row, err := custom.mapRow(map[string]any{"orderId": 1, "Note": "foo"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"c_orderid": 1, "c_note": "foo"}, row)
+
+	snake, err := newColumnNameMapper("snake_upper", nil)
+	require.NoError(t, err)
+	_, err = snake.mapRow(map[string]any{"orderId": 1, "order_id": 2})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `both map to column "ORDER_ID"`)
+
+	_, err = newColumnNameMapper("custom", nil)
+	require.Error(t, err)
+	_, err = newColumnNameMapper("nope", nil)
+	require.Error(t, err)
+}
+
+func TestSnowflakeStreamingSchemaRegistryLinting(t *testing.T) {
+	configTests := []struct {
+		name        string
+		config      string
+		errContains string
+	}{
+		{
+			name: "snake upper",
+			config: `
+schema_registry:
+  url: http://localhost:8081
+  column_name_mapping: snake_upper
+`,
+		},
+		{
+			name: "custom with mapping",
+			config: `
+schema_registry:
+  url: http://localhost:8081
+  column_name_mapping: custom
+  custom_column_name_mapping: root = this.uppercase()
+`,
+		},
+		{
+			name: "custom without mapping",
+			config: `
+schema_registry:
+  url: http://localhost:8081
+  column_name_mapping: custom
+`,
+			errContains: "`custom_column_name_mapping` must be set when `column_name_mapping` is custom",
+		},
+	}
+
+	const baseConfig = `
+snowflake_streaming:
+  account: WQKFXQQ-WI77362
+  user: ROCKSET
+  role: ACCOUNTADMIN
+  database: BENCHMARK_DB
+  schema: PUBLIC
+  table: TEST
+  private_key_file: ./rsa_key.p8
+`
+	env := service.NewEnvironment()
+	for _, test := range configTests {
+		t.Run(test.name, func(t *testing.T) {
+			config := baseConfig
+			for _, line := range strings.Split(strings.TrimSpace(test.config), "\n") {
+				config += "  " + line + "\n"
+			}
+			err := env.NewStreamBuilder().AddOutputYAML(config)
+			if test.errContains == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, test.errContains)
+			}
+		})
+	}
+}
@@ -11,10 +11,25 @@
 package streaming
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
 )
 
+// SnowflakeError is implemented by errors which contain an error code returned by Snowflake.
+type SnowflakeError interface {
+	error
+	// SFCode returns the error code returned by Snowflake.
+	SFCode() string
+}
+
 // APIError is an API response when the streaming API has an error.
 type APIError struct {
 	StatusCode int    `json:"status_code"`
@@ -32,8 +47,227 @@ func (e *APIError) Error() string {
 	return fmt.Sprintf("API error (status_code=%d): %s", e.StatusCode, msg)
 }
 
+// SFCode returns the status code of the response.
+func (e *APIError) SFCode() string {
+	return strconv.Itoa(e.StatusCode)
+}
+
+// HTTPError is returned when the streaming API responds with an unexpected HTTP status code and without a status code
+// in the response body.
+type HTTPError struct {
+	StatusCode int
+	Body       string
+	// RetryAfter is the delay requested by the Retry-After header of the response, or zero if it's unset.
+	RetryAfter time.Duration
+}
+
+var _ SnowflakeError = &HTTPError{}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("non successful status code (%d): %s", e.StatusCode, e.Body)
+}
+
+// SFCode returns the HTTP status code prefixed with `http_`.
+func (e *HTTPError) SFCode() string {
+	return "http_" + strconv.Itoa(e.StatusCode)
+}
+
+// NonRetryableError wraps an error returned by Snowflake which is not expected to be resolved by retrying, such as a
+// file which is rejected by server side validation.
+type NonRetryableError struct {
+	Err error
+}
+
+var _ SnowflakeError = &NonRetryableError{}
+
+func (e *NonRetryableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *NonRetryableError) Unwrap() error {
+	return e.Err
+}
+
+// SFCode returns the code of the wrapped error or an empty string if it doesn't have one.
+func (e *NonRetryableError) SFCode() string {
+	var sfErr SnowflakeError
+	if errors.As(e.Err, &sfErr) {
+		return sfErr.SFCode()
+	}
+	return ""
+}
+
+// IsTransientError returns true if the error is expected to be resolved by retrying the request, which is the case for
+// throttling, expired tokens and invalidated channels. Errors that don't contain a response from Snowflake, such as
+// network errors, are considered transient.
+func IsTransientError(err error) bool {
+	var ingestionErr *IngestionFailedError
+	if errors.As(err, &ingestionErr) {
+		return ingestionErr.CanRetry() || ingestionErr.LostOwnership() || ingestionErr.StatusCode == responseErrQueueFull
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return isTransientResponseCode(int64(apiErr.StatusCode))
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return isTransientHTTPStatus(httpErr.StatusCode)
+	}
+	return true
+}
+
+// ClassifyError wraps errors which are not transient in a NonRetryableError.
+func ClassifyError(err error) error {
+	if err == nil || IsTransientError(err) {
+		return err
+	}
+	var nonRetryableErr *NonRetryableError
+	if errors.As(err, &nonRetryableErr) {
+		return err
+	}
+	return &NonRetryableError{Err: err}
+}
+
+func isTransientResponseCode(code int64) bool {
+	switch code {
+	case responseErrQueueFull,
+		responseErrRetryRequest,
+		responseErrInvalidClientSequencer,
+		responseErrTransientError,
+		responseErrMissingColumnStats:
+		return true
+	default:
+		return false
+	}
+}
+
+func isTransientHTTPStatus(code int) bool {
+	switch code {
+	case http.StatusUnauthorized, // The JWT expired
+		http.StatusRequestTimeout,
+		http.StatusTooManyRequests:
+		return true
+	default:
+		return code >= 500
+	}
+}
+
+// isRetryableRegistrationError returns true if registering a file failed because Snowflake is throttling requests,
+// failed to process them or couldn't be reached, in which case the registration is retried after a backoff.
+func isRetryableRegistrationError(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case responseErrQueueFull, responseErrRetryRequest, responseErrTransientError:
+			return true
+		}
+		return false
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode >= 500
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	// The request never reached Snowflake, such as when the connection was
+	// refused.
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// isAuthError returns true if Snowflake rejected the JWT of a request, such as when it's signed with a key which is no
+// longer the public key of the user.
+func isAuthError(err error) bool {
+	var httpErr *HTTPError
+	return errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusUnauthorized
+}
+
+// mayHaveBeenProcessed returns true if a request timed out or its response was lost, in which case it can't be told
+// whether Snowflake processed it. Any other error means that the request wasn't processed.
+func mayHaveBeenProcessed(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		switch httpErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusBadGateway, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// retryAfter returns the delay requested by the Retry-After header of a failed response, or zero if there's none.
+func retryAfter(err error) time.Duration {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.RetryAfter
+	}
+	return 0
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a number of seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(0, time.Duration(seconds)*time.Second)
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(0, t.Sub(now))
+	}
+	return 0
+}
+
 // IsTableNotExistsError returns true if the table does not exist (or the user is not authorized to see it).
 func IsTableNotExistsError(err error) bool {
 	var restErr *APIError
 	return errors.As(err, &restErr) && restErr.StatusCode == responseTableNotExist
 }
+
+// Error codes returned by the SQL API for statements which failed.
+const (
+	sqlErrObjectAlreadyExists     = "002002"
+	sqlErrInsufficientPrivileges  = "003001"
+	sqlErrColumnAlreadyExists     = "001430"
+	sqlStateInsufficientPrivilege = "42501"
+)
+
+// sqlError is the body of a SQL API response for a statement which failed.
+type sqlError struct {
+	Code     string `json:"code"`
+	SQLState string `json:"sqlState"`
+}
+
+func asSQLError(err error) (sqlError, bool) {
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		return sqlError{}, false
+	}
+	var sqlErr sqlError
+	if json.Unmarshal([]byte(httpErr.Body), &sqlErr) != nil || sqlErr.Code == "" {
+		return sqlError{}, false
+	}
+	return sqlErr, true
+}
+
+// IsInsufficientPrivilegesError returns true if a SQL statement failed because the role lacks a privilege.
+func IsInsufficientPrivilegesError(err error) bool {
+	sqlErr, ok := asSQLError(err)
+	return ok && (sqlErr.Code == sqlErrInsufficientPrivileges || sqlErr.SQLState == sqlStateInsufficientPrivilege)
+}
+
+// IsAlreadyExistsError returns true if a SQL statement failed because the object or column it creates already exists,
+// which happens when concurrent statements race to create it despite `IF NOT EXISTS`.
+func IsAlreadyExistsError(err error) bool {
+	sqlErr, ok := asSQLError(err)
+	return ok && (sqlErr.Code == sqlErrObjectAlreadyExists || sqlErr.Code == sqlErrColumnAlreadyExists)
+}
@@ -0,0 +1,260 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package streaming
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redpanda-data/connect/v4/internal/typed"
+)
+
+func TestErrorClassification(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		body          string
+		transient     bool
+		code          string
+		expectedCalls int32
+	}{
+		{
+			name:          "throttled",
+			status:        http.StatusTooManyRequests,
+			body:          "slow down",
+			transient:     true,
+			code:          "http_429",
+			expectedCalls: 4,
+		},
+		{
+			name:          "token expired",
+			status:        http.StatusUnauthorized,
+			body:          "expired",
+			transient:     true,
+			code:          "http_401",
+			expectedCalls: 4,
+		},
+		{
+			name:          "server error",
+			status:        http.StatusServiceUnavailable,
+			body:          "unavailable",
+			transient:     true,
+			code:          "http_503",
+			expectedCalls: 4,
+		},
+		{
+			name:          "retryable response code",
+			status:        http.StatusBadRequest,
+			body:          `{"status_code": 10, "message": "please retry"}`,
+			transient:     true,
+			code:          "10",
+			expectedCalls: 4,
+		},
+		{
+			name:          "rejected request",
+			status:        http.StatusBadRequest,
+			body:          `{"status_code": 13, "message": "invalid row"}`,
+			code:          "13",
+			expectedCalls: 1,
+		},
+		{
+			name:          "rejected without response code",
+			status:        http.StatusForbidden,
+			body:          "forbidden",
+			code:          "http_403",
+			expectedCalls: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				calls.Add(1)
+				w.WriteHeader(test.status)
+				_, _ = w.Write([]byte(test.body))
+			}))
+			defer srv.Close()
+
+			c := &SnowflakeRestClient{
+				url:       srv.URL,
+				client:    srv.Client(),
+				logger:    service.MockResources().Logger(),
+				cachedJWT: typed.NewAtomicValue(signedJWT{}),
+			}
+			_, err := c.channelStatus(context.Background(), batchChannelStatusRequest{})
+			require.Error(t, err)
+			require.Equal(t, test.expectedCalls, calls.Load())
+			require.Equal(t, test.transient, IsTransientError(err))
+
+			err = ClassifyError(err)
+			var nonRetryableErr *NonRetryableError
+			require.Equal(t, !test.transient, errors.As(err, &nonRetryableErr))
+			var sfErr SnowflakeError
+			require.ErrorAs(t, err, &sfErr)
+			require.Equal(t, test.code, sfErr.SFCode())
+		})
+	}
+}
+
+func TestIngestionErrorClassification(t *testing.T) {
+	newErr := func(code int64) error {
+		return &IngestionFailedError{StatusCode: code, ExpectedClientSequencer: 1, ActualClientSequencer: 1}
+	}
+	for _, code := range []int64{responseErrQueueFull, responseErrRetryRequest, responseErrInvalidClientSequencer, responseErrTransientError, responseErrMissingColumnStats} {
+		require.True(t, IsTransientError(newErr(code)), "code %d", code)
+	}
+	// The channel was reopened elsewhere, which is resolved by reopening it.
+	require.True(t, IsTransientError(&IngestionFailedError{StatusCode: 19, ExpectedClientSequencer: 1, ActualClientSequencer: 2}))
+
+	err := ClassifyError(newErr(19))
+	var nonRetryableErr *NonRetryableError
+	require.ErrorAs(t, err, &nonRetryableErr)
+	require.Equal(t, "19", nonRetryableErr.SFCode())
+	require.Same(t, err, ClassifyError(err))
+
+	require.NoError(t, ClassifyError(nil))
+	require.False(t, errors.As(ClassifyError(errors.New("connection reset")), &nonRetryableErr))
+}
+
+func TestSQLErrorClassification(t *testing.T) {
+	newErr := func(body string) error {
+		return &HTTPError{StatusCode: http.StatusUnprocessableEntity, Body: body}
+	}
+
+	err := newErr(`{"code": "003001", "message": "SQL access control error: Insufficient privileges to operate on schema 'PUBLIC'", "sqlState": "42501"}`)
+	require.True(t, IsInsufficientPrivilegesError(err))
+	require.True(t, IsInsufficientPrivilegesError(fmt.Errorf("wrapped: %w", err)))
+	require.False(t, IsAlreadyExistsError(err))
+
+	err = newErr(`{"code": "002002", "message": "SQL compilation error: Object 'FOO' already exists.", "sqlState": "42710"}`)
+	require.True(t, IsAlreadyExistsError(err))
+	require.False(t, IsInsufficientPrivilegesError(err))
+
+	require.False(t, IsInsufficientPrivilegesError(newErr("forbidden")))
+	require.False(t, IsAlreadyExistsError(&APIError{StatusCode: responseTableNotExist}))
+	require.False(t, IsAlreadyExistsError(errors.New("already exists")))
+}
+
+func TestRegistrationErrorClassification(t *testing.T) {
+	require.True(t, isRetryableRegistrationError(&HTTPError{StatusCode: http.StatusTooManyRequests}))
+	require.True(t, isRetryableRegistrationError(fmt.Errorf("wrapped: %w", &HTTPError{StatusCode: http.StatusServiceUnavailable})))
+	require.True(t, isRetryableRegistrationError(&APIError{StatusCode: responseErrQueueFull}))
+	require.False(t, isRetryableRegistrationError(&HTTPError{StatusCode: http.StatusForbidden}))
+	require.False(t, isRetryableRegistrationError(&APIError{StatusCode: 13}))
+	require.False(t, isRetryableRegistrationError(errors.New("connection reset")))
+	require.True(t, isRetryableRegistrationError(&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}))
+	require.False(t, isRetryableRegistrationError(fmt.Errorf("wrapped: %w", context.DeadlineExceeded)))
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.Equal(t, 3*time.Second, parseRetryAfter("3", now))
+	require.Equal(t, 10*time.Second, parseRetryAfter(now.Add(10*time.Second).Format(http.TimeFormat), now))
+	require.Zero(t, parseRetryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now))
+	require.Zero(t, parseRetryAfter("", now))
+	require.Zero(t, parseRetryAfter("soon", now))
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "2")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	c := &SnowflakeRestClient{
+		url:       srv.URL,
+		client:    srv.Client(),
+		logger:    service.MockResources().Logger(),
+		cachedJWT: typed.NewAtomicValue(signedJWT{}),
+	}
+	// Registrations are attempted once, the channels retry them.
+	_, err := c.registerBlob(context.Background(), registerBlobRequest{})
+	require.Equal(t, 2*time.Second, retryAfter(err))
+	require.Equal(t, int32(1), calls.Load())
+}
+
+func TestRequestRetriesHonorRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	c := &SnowflakeRestClient{
+		url:       srv.URL,
+		client:    srv.Client(),
+		logger:    service.MockResources().Logger(),
+		cachedJWT: typed.NewAtomicValue(signedJWT{}),
+	}
+	start := time.Now()
+	_, err := c.channelStatus(context.Background(), batchChannelStatusRequest{})
+	require.NoError(t, err)
+	require.Equal(t, int32(2), calls.Load())
+	require.GreaterOrEqual(t, time.Since(start), time.Second)
+}
+
+func TestRegistrationNotRetriedWhenProcessed(t *testing.T) {
+	require.True(t, mayHaveBeenProcessed(&HTTPError{StatusCode: http.StatusBadGateway}))
+	require.True(t, mayHaveBeenProcessed(&HTTPError{StatusCode: http.StatusRequestTimeout}))
+	require.True(t, mayHaveBeenProcessed(&HTTPError{StatusCode: http.StatusGatewayTimeout}))
+	require.True(t, mayHaveBeenProcessed(fmt.Errorf("read: %w", syscall.ECONNRESET)))
+	require.True(t, mayHaveBeenProcessed(fmt.Errorf("read: %w", io.ErrUnexpectedEOF)))
+	require.True(t, mayHaveBeenProcessed(&net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}))
+	require.False(t, mayHaveBeenProcessed(&HTTPError{StatusCode: http.StatusServiceUnavailable}))
+	require.False(t, mayHaveBeenProcessed(&HTTPError{StatusCode: http.StatusInternalServerError}))
+	require.False(t, mayHaveBeenProcessed(fmt.Errorf("dial: %w", syscall.ECONNREFUSED)))
+	require.False(t, mayHaveBeenProcessed(errors.New("unable to marshal request")))
+	require.False(t, mayHaveBeenProcessed(&HTTPError{StatusCode: http.StatusTooManyRequests}))
+	require.False(t, mayHaveBeenProcessed(&HTTPError{StatusCode: http.StatusUnauthorized}))
+	require.False(t, mayHaveBeenProcessed(&APIError{StatusCode: responseErrQueueFull}))
+	require.False(t, mayHaveBeenProcessed(fmt.Errorf("wrapped: %w", context.Canceled)))
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	c := &SnowflakeRestClient{
+		url:       srv.URL,
+		client:    srv.Client(),
+		logger:    service.MockResources().Logger(),
+		cachedJWT: typed.NewAtomicValue(signedJWT{}),
+	}
+	// The blobs might have been registered, so the request isn't retried.
+	_, err := c.registerBlob(context.Background(), registerBlobRequest{})
+	var httpErr *HTTPError
+	require.ErrorAs(t, err, &httpErr)
+	require.Equal(t, int32(1), calls.Load())
+
+	// Other requests are still retried.
+	_, err = c.channelStatus(context.Background(), batchChannelStatusRequest{})
+	require.ErrorAs(t, err, &httpErr)
+	require.Equal(t, int32(5), calls.Load())
+}
@@ -110,27 +110,79 @@ func generateBlobPath(clientPrefix string, threadID, counter int64) string {
 	return fmt.Sprintf("%d/%d/%d/%d/%d/%s", year, month, day, hour, minute, blobShortName)
 }
 
-// truncateBytesAsHex truncates an array of bytes up to 32 bytes and optionally increment the last byte(s).
-// More the one byte can be incremented in case it overflows.
-func truncateBytesAsHex(bytes []byte, truncateUp bool) string {
+// truncateBytesAsHex truncates an array of bytes up to 32 bytes and optionally increments the end of the prefix so that
+// the result is an upper bound of the original value. Trailing bytes which would overflow are dropped instead, and "Z"
+// is returned when no upper bound exists, as the Java SDK does. When isUTF8 is set, the value is only ever cut at
+// character boundaries and the last character is incremented instead of the last byte, so the result is valid UTF-8.
+func truncateBytesAsHex(bytes []byte, truncateUp, isUTF8 bool) string {
 	const maxLobLen int = 32
 	if len(bytes) <= maxLobLen {
 		return hex.EncodeToString(bytes)
 	}
-	bytes = slices.Clone(bytes)
-	if truncateUp {
-		var i int
-		for i = maxLobLen - 1; i >= 0; i-- {
-			bytes[i]++
-			if bytes[i] != 0 {
-				break
-			}
+	prefix := bytes[:maxLobLen]
+	if isUTF8 {
+		// bytes[maxLobLen] is the first byte which is cut off, back up to the start of its character.
+		cut := maxLobLen
+		for cut > 0 && !utf8.RuneStart(bytes[cut]) {
+			cut--
 		}
-		if i < 0 {
-			return "Z"
+		prefix = bytes[:cut]
+	}
+	if !truncateUp {
+		return hex.EncodeToString(prefix)
+	}
+	var ok bool
+	if isUTF8 {
+		prefix, ok = incrementUTF8Prefix(prefix, maxLobLen)
+	} else {
+		prefix, ok = incrementBytesPrefix(prefix)
+	}
+	if !ok {
+		return "Z"
+	}
+	return hex.EncodeToString(prefix)
+}
+
+// incrementBytesPrefix returns the shortest value which is greater than all values starting with prefix, which is the
+// prefix without its trailing 0xFF bytes and with its last byte incremented.
+func incrementBytesPrefix(prefix []byte) ([]byte, bool) {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xFF {
+			out := slices.Clone(prefix[:i+1])
+			out[i]++
+			return out, true
 		}
 	}
-	return hex.EncodeToString(bytes[:maxLobLen])
+	return nil, false
+}
+
+// incrementUTF8Prefix returns a valid UTF-8 value of at most maxLen bytes which is greater than all values starting with
+// prefix. The last character is replaced with the next one, and characters which can't be incremented, either because
+// they are the last character or because the next one wouldn't fit, are dropped.
+func incrementUTF8Prefix(prefix []byte, maxLen int) ([]byte, bool) {
+	for len(prefix) > 0 {
+		r, size := utf8.DecodeLastRune(prefix)
+		prefix = prefix[:len(prefix)-size]
+		next := r + 1
+		if next >= 0xD800 && next <= 0xDFFF {
+			// Surrogates can't be encoded in UTF-8.
+			next = 0xE000
+		}
+		if next > utf8.MaxRune || len(prefix)+utf8.RuneLen(next) > maxLen {
+			continue
+		}
+		return utf8.AppendRune(slices.Clone(prefix), next), true
+	}
+	return nil, false
+}
+
+// NormalizeColumnName normalizes a message key or identifier to the name of the
+// column it's matched to, see ChannelOptions.CaseSensitiveColumns.
+func NormalizeColumnName(name string, caseSensitive bool) string {
+	if caseSensitive {
+		return normalizeColumnNameCaseSensitive(name)
+	}
+	return normalizeColumnName(name)
 }
 
 // normalizeColumnName normalizes the column to the same as Snowflake's
@@ -182,17 +234,32 @@ func normalizeColumnName(name string) string {
 	return string(transformed)
 }
 
+// normalizeColumnNameCaseSensitive is like normalizeColumnName, but
+// unquoted names are used as is instead of being converted to uppercase.
+func normalizeColumnNameCaseSensitive(name string) string {
+	if len(name) > 1 && strings.HasPrefix(name, `"`) && strings.HasSuffix(name, `"`) {
+		return normalizeColumnName(name)
+	}
+	return name
+}
+
 // quoteColumnName escapes an object identifier according to the
 // rules in Snowflake.
 //
 // https://docs.snowflake.com/en/sql-reference/identifiers-syntax
 func quoteColumnName(name string) string {
+	return quoteColumnNameCaseSensitive(strings.ToUpper(name))
+}
+
+// quoteColumnNameCaseSensitive is like quoteColumnName, but it preserves
+// the case of the name.
+func quoteColumnNameCaseSensitive(name string) string {
 	var quoted strings.Builder
 	// Default to assume we're just going to add quotes and there won't
 	// be any double quotes inside the string that needs escaped.
 	quoted.Grow(len(name) + 2)
 	quoted.WriteByte('"')
-	for _, r := range strings.ToUpper(name) {
+	for _, r := range name {
 		if r == '"' {
 			quoted.WriteString(`""`)
 		} else {
@@ -215,7 +282,7 @@ func snowflakeTimestampInt(t time.Time, scale int32, includeTZ bool) int128.Num
 		int128.Mul(epoch, int128.Pow10Table[9]),
 		int128.FromInt64(int64(fraction)),
 	)
-	scaledTime := int128.Div(timeInNanos, int128.Pow10Table[9-scale])
+	scaledTime := int128.DivPow10(timeInNanos, 9-scale)
 	if includeTZ {
 		_, tzOffsetSec := t.Zone()
 		offsetMinutes := tzOffsetSec / 60
@@ -18,6 +18,7 @@ import (
 	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/require"
 
@@ -45,42 +46,102 @@ func mustHexDecode(s string) []byte {
 
 func TestTruncateBytesAsHex(t *testing.T) {
 	// Test empty input
-	require.Equal(t, "", truncateBytesAsHex([]byte{}, false))
-	require.Equal(t, "", truncateBytesAsHex([]byte{}, true))
+	require.Equal(t, "", truncateBytesAsHex([]byte{}, false, false))
+	require.Equal(t, "", truncateBytesAsHex([]byte{}, true, false))
 
 	// Test basic case
 	decoded := mustHexDecode("aa")
-	require.Equal(t, "aa", truncateBytesAsHex(decoded, false))
-	require.Equal(t, "aa", truncateBytesAsHex(decoded, true))
+	require.Equal(t, "aa", truncateBytesAsHex(decoded, false, false))
+	require.Equal(t, "aa", truncateBytesAsHex(decoded, true, false))
 
 	// Test exactly 32 bytes
 	decoded = mustHexDecode("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
-	require.Equal(t, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", truncateBytesAsHex(decoded, false))
-	require.Equal(t, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", truncateBytesAsHex(decoded, true))
+	require.Equal(t, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", truncateBytesAsHex(decoded, false, false))
+	require.Equal(t, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", truncateBytesAsHex(decoded, true, false))
 
 	decoded = mustHexDecode("ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
-	require.Equal(t, "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", truncateBytesAsHex(decoded, false))
-	require.Equal(t, "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", truncateBytesAsHex(decoded, true))
+	require.Equal(t, "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", truncateBytesAsHex(decoded, false, false))
+	require.Equal(t, "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", truncateBytesAsHex(decoded, true, false))
 
 	// Test 1 truncate up
 	decoded = mustHexDecode("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
-	require.Equal(t, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", truncateBytesAsHex(decoded, false))
-	require.Equal(t, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaab", truncateBytesAsHex(decoded, true))
+	require.Equal(t, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", truncateBytesAsHex(decoded, false, false))
+	require.Equal(t, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaab", truncateBytesAsHex(decoded, true, false))
 
 	// Test one overflow
 	decoded = mustHexDecode("aaaaaaaaaaaaaaaaaaaaaaaaaaaaafffffffffffffffffffffffffffffffaaffffffff")
-	require.Equal(t, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaafffffffffffffffffffffffffffffffaaff", truncateBytesAsHex(decoded, false))
-	require.Equal(t, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaafffffffffffffffffffffffffffffffab00", truncateBytesAsHex(decoded, true))
+	require.Equal(t, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaafffffffffffffffffffffffffffffffaaff", truncateBytesAsHex(decoded, false, false))
+	require.Equal(t, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaafffffffffffffffffffffffffffffffab", truncateBytesAsHex(decoded, true, false))
 
 	// Test many overflow
 	decoded = mustHexDecode("aaaaaaaaaaaaaaaaaaaaaaaaaaaaafffffffffffffffffffffffffffffffffffffffffffffffffffff")
-	require.Equal(t, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaafffffffffffffffffffffffffffffffffff", truncateBytesAsHex(decoded, false))
-	require.Equal(t, "aaaaaaaaaaaaaaaaaaaaaaaaaaaab00000000000000000000000000000000000", truncateBytesAsHex(decoded, true))
+	require.Equal(t, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaafffffffffffffffffffffffffffffffffff", truncateBytesAsHex(decoded, false, false))
+	require.Equal(t, "aaaaaaaaaaaaaaaaaaaaaaaaaaaab0", truncateBytesAsHex(decoded, true, false))
 
 	// Test infinity
 	decoded = mustHexDecode("ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffcccccccccccc")
-	require.Equal(t, "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", truncateBytesAsHex(decoded, false))
-	require.Equal(t, "Z", truncateBytesAsHex(decoded, true))
+	require.Equal(t, "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", truncateBytesAsHex(decoded, false, false))
+	require.Equal(t, "Z", truncateBytesAsHex(decoded, true, false))
+}
+
+func TestTruncateUTF8AsHex(t *testing.T) {
+	hexOf := func(s string) string { return hex.EncodeToString([]byte(s)) }
+
+	// Short values are never truncated
+	require.Equal(t, hexOf("héllo"), truncateBytesAsHex([]byte("héllo"), false, true))
+	require.Equal(t, hexOf("héllo"), truncateBytesAsHex([]byte("héllo"), true, true))
+
+	// ASCII behaves like binary
+	long := strings.Repeat("a", 40)
+	require.Equal(t, hexOf(strings.Repeat("a", 32)), truncateBytesAsHex([]byte(long), false, true))
+	require.Equal(t, hexOf(strings.Repeat("a", 31)+"b"), truncateBytesAsHex([]byte(long), true, true))
+
+	// A two byte character straddling the boundary is dropped from the min and the max is the incremented previous
+	// character
+	straddle := strings.Repeat("a", 31) + "é" + "zzz"
+	require.Equal(t, hexOf(strings.Repeat("a", 31)), truncateBytesAsHex([]byte(straddle), false, true))
+	require.Equal(t, hexOf(strings.Repeat("a", 30)+"b"), truncateBytesAsHex([]byte(straddle), true, true))
+
+	// A four byte character straddling the boundary
+	straddle = strings.Repeat("a", 30) + "😀" + "zzz"
+	require.Equal(t, hexOf(strings.Repeat("a", 30)), truncateBytesAsHex([]byte(straddle), false, true))
+	require.Equal(t, hexOf(strings.Repeat("a", 29)+"b"), truncateBytesAsHex([]byte(straddle), true, true))
+
+	// A character ending exactly at the boundary is kept and incremented
+	exact := strings.Repeat("a", 30) + "é" + "zzz"
+	require.Equal(t, hexOf(strings.Repeat("a", 30)+"é"), truncateBytesAsHex([]byte(exact), false, true))
+	require.Equal(t, hexOf(strings.Repeat("a", 30)+"ê"), truncateBytesAsHex([]byte(exact), true, true))
+
+	// Incrementing a character which doesn't fit anymore drops it
+	grow := strings.Repeat("a", 31) + "\x7f" + "zzz"
+	require.Equal(t, hexOf(strings.Repeat("a", 31)+"\x7f"), truncateBytesAsHex([]byte(grow), false, true))
+	require.Equal(t, hexOf(strings.Repeat("a", 30)+"b"), truncateBytesAsHex([]byte(grow), true, true))
+
+	// Surrogates are skipped
+	surrogate := strings.Repeat("a", 29) + "\ud7ff" + "zzz"
+	require.Equal(t, hexOf(strings.Repeat("a", 29)+"\ue000"), truncateBytesAsHex([]byte(surrogate), true, true))
+
+	// The last character overflows
+	maxRune := strings.Repeat(string(utf8.MaxRune), 8) + "zzz"
+	require.Equal(t, hexOf(strings.Repeat(string(utf8.MaxRune), 8)), truncateBytesAsHex([]byte(maxRune), false, true))
+	require.Equal(t, "Z", truncateBytesAsHex([]byte(maxRune), true, true))
+	maxRune = "a" + strings.Repeat(string(utf8.MaxRune), 8) + "zzz"
+	require.Equal(t, hexOf("b"), truncateBytesAsHex([]byte(maxRune), true, true))
+
+	// All results are valid UTF-8
+	for _, s := range []string{straddle, exact, grow, surrogate, maxRune, strings.Repeat("ü", 20), strings.Repeat("日本", 10)} {
+		for _, up := range []bool{false, true} {
+			b, err := hex.DecodeString(truncateBytesAsHex([]byte(s), up, true))
+			require.NoError(t, err)
+			require.True(t, utf8.Valid(b))
+			require.LessOrEqual(t, len(b), 32)
+			if up {
+				require.Greater(t, string(b), s)
+			} else {
+				require.LessOrEqual(t, string(b), s)
+			}
+		}
+	}
 }
 
 func mustBase64Decode(s string) []byte {
@@ -128,6 +189,16 @@ func TestColumnNormalization(t *testing.T) {
 	require.Equal(t, `foo" bar "baz`, normalizeColumnName(`"foo"" bar ""baz"`))
 }
 
+func TestCaseSensitiveColumnNormalization(t *testing.T) {
+	require.Equal(t, "", normalizeColumnNameCaseSensitive(""))
+	require.Equal(t, `"`, normalizeColumnNameCaseSensitive(`"`))
+	require.Equal(t, "foo", normalizeColumnNameCaseSensitive("foo"))
+	require.Equal(t, "userId", normalizeColumnNameCaseSensitive("userId"))
+	require.Equal(t, "userId", normalizeColumnNameCaseSensitive(`"userId"`))
+	require.Equal(t, "FOO", normalizeColumnNameCaseSensitive(`"FOO"`))
+	require.Equal(t, `foo" bar "baz`, normalizeColumnNameCaseSensitive(`"foo"" bar ""baz"`))
+}
+
 func BenchmarkColumnNormalization(b *testing.B) {
 	makeBench := func(name string) func(b *testing.B) {
 		return func(b *testing.B) {
@@ -156,6 +227,8 @@ func TestColumnQuoting(t *testing.T) {
 	require.Equal(t, `"FOO""BAR"`, quoteColumnName(`foo"bar`))
 	require.Equal(t, `"FOO""BAR1"`, quoteColumnName(`foo"bar1`))
 	require.Equal(t, `""""""""""`, quoteColumnName(`""""`))
+	require.Equal(t, `"userId"`, quoteColumnNameCaseSensitive("userId"))
+	require.Equal(t, `"foo""Bar"`, quoteColumnNameCaseSensitive(`foo"Bar`))
 }
 
 func TestSnowflakeTimestamp(t *testing.T) {
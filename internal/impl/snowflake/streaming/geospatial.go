@@ -0,0 +1,194 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package streaming
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The number of nested arrays of positions in the coordinates of each GeoJSON
+// geometry type, a position being an array of numbers itself.
+var geoJSONCoordinateDepths = map[string]int{
+	"Point":           0,
+	"MultiPoint":      1,
+	"LineString":      1,
+	"MultiLineString": 2,
+	"Polygon":         2,
+	"MultiPolygon":    3,
+}
+
+// validateGeoJSON checks the basic structure of a GeoJSON geometry object,
+// which is that it has a known type with coordinates of the right shape, or
+// geometries for geometry collections. It doesn't check that the geometry
+// is valid, for example that polygons don't intersect themselves, which is
+// left to Snowflake.
+func validateGeoJSON(obj map[string]any) error {
+	typ, ok := obj["type"].(string)
+	if !ok {
+		return errors.New("GeoJSON object is missing a type")
+	}
+	if typ == "GeometryCollection" {
+		geometries, ok := obj["geometries"].([]any)
+		if !ok {
+			return errors.New("GeoJSON GeometryCollection is missing an array of geometries")
+		}
+		for i, g := range geometries {
+			child, ok := g.(map[string]any)
+			if !ok {
+				return fmt.Errorf("GeoJSON geometry %d of GeometryCollection is not an object", i)
+			}
+			if err := validateGeoJSON(child); err != nil {
+				return fmt.Errorf("GeoJSON geometry %d of GeometryCollection: %w", i, err)
+			}
+		}
+		return nil
+	}
+	depth, ok := geoJSONCoordinateDepths[typ]
+	if !ok {
+		return fmt.Errorf("unknown GeoJSON geometry type %q", typ)
+	}
+	coordinates, ok := obj["coordinates"]
+	if !ok {
+		return fmt.Errorf("GeoJSON %s is missing coordinates", typ)
+	}
+	if err := validateGeoJSONCoordinates(coordinates, depth); err != nil {
+		return fmt.Errorf("invalid coordinates of GeoJSON %s: %w", typ, err)
+	}
+	return nil
+}
+
+// geoJSONGeometry returns the geometry of a GeoJSON object once validated,
+// which is the geometry of a Feature, as its properties can't be stored, or
+// the object itself otherwise. A Feature without a geometry is nil.
+func geoJSONGeometry(obj map[string]any) (map[string]any, error) {
+	switch obj["type"] {
+	case "Feature":
+		geometry, ok := obj["geometry"]
+		if !ok {
+			return nil, errors.New("GeoJSON Feature is missing a geometry")
+		}
+		if geometry == nil {
+			return nil, nil
+		}
+		child, ok := geometry.(map[string]any)
+		if !ok {
+			return nil, errors.New("GeoJSON geometry of Feature is not an object")
+		}
+		if err := validateGeoJSON(child); err != nil {
+			return nil, fmt.Errorf("GeoJSON geometry of Feature: %w", err)
+		}
+		return child, nil
+	case "FeatureCollection":
+		return nil, errors.New("GeoJSON FeatureCollection is not supported, expected a geometry or a Feature")
+	}
+	if err := validateGeoJSON(obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// validateGeoJSONCoordinates checks that v is depth levels of nested arrays of
+// positions.
+func validateGeoJSONCoordinates(v any, depth int) error {
+	arr, ok := v.([]any)
+	if !ok {
+		return errors.New("expected an array")
+	}
+	if depth == 0 {
+		if len(arr) < 2 || len(arr) > 4 {
+			return fmt.Errorf("a position must have between 2 and 4 numbers, got %d", len(arr))
+		}
+		for _, n := range arr {
+			switch n.(type) {
+			case float64, json.Number, int, int64, float32, int32, uint64:
+			default:
+				return fmt.Errorf("a position must only contain numbers, got %T", n)
+			}
+		}
+		return nil
+	}
+	for _, child := range arr {
+		if err := validateGeoJSONCoordinates(child, depth-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wktGeometryTypes are the geometry keywords of WKT strings.
+var wktGeometryTypes = map[string]struct{}{
+	"POINT":              {},
+	"MULTIPOINT":         {},
+	"LINESTRING":         {},
+	"MULTILINESTRING":    {},
+	"POLYGON":            {},
+	"MULTIPOLYGON":       {},
+	"GEOMETRYCOLLECTION": {},
+}
+
+// validateWKT checks the basic structure of a WKT or EWKT string, which is a
+// known geometry keyword followed by either EMPTY or balanced parentheses.
+func validateWKT(s string) error {
+	s = strings.TrimSpace(s)
+	if srid, rest, ok := strings.Cut(s, ";"); ok && strings.HasPrefix(strings.ToUpper(srid), "SRID=") {
+		s = strings.TrimSpace(rest)
+	}
+	keywordEnd := strings.IndexFunc(s, func(r rune) bool {
+		return (r < 'A' || r > 'Z') && (r < 'a' || r > 'z')
+	})
+	if keywordEnd < 0 {
+		keywordEnd = len(s)
+	}
+	keyword := strings.ToUpper(s[:keywordEnd])
+	if _, ok := wktGeometryTypes[keyword]; !ok {
+		return fmt.Errorf("unknown WKT geometry type %q", s[:keywordEnd])
+	}
+	body := strings.TrimSpace(s[keywordEnd:])
+	// Dimensions of three or four coordinates.
+	for _, dims := range []string{"ZM", "Z", "M"} {
+		if len(body) > len(dims) && strings.EqualFold(body[:len(dims)], dims) && !isASCIILetter(body[len(dims)]) {
+			body = strings.TrimSpace(body[len(dims):])
+			break
+		}
+	}
+	if strings.EqualFold(body, "EMPTY") {
+		return nil
+	}
+	if !strings.HasPrefix(body, "(") {
+		return fmt.Errorf("expected WKT %s to be followed by EMPTY or coordinates in parentheses", keyword)
+	}
+	depth := 0
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return fmt.Errorf("unbalanced parentheses in WKT %s", keyword)
+			}
+			if depth == 0 && i != len(body)-1 {
+				return fmt.Errorf("unexpected characters after the coordinates of WKT %s", keyword)
+			}
+		}
+	}
+	if depth != 0 {
+		return fmt.Errorf("unbalanced parentheses in WKT %s", keyword)
+	}
+	return nil
+}
+
+func isASCIILetter(b byte) bool {
+	return (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z')
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package streaming
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+
+	"github.com/cespare/xxhash/v2"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/snowflake/streaming/int128"
+)
+
+// The number of bits of the hash used to select a register. 2^12 registers
+// take 4KiB per column and give a standard error of about 1.6%.
+const hllPrecision = 12
+
+const hllRegisters = 1 << hllPrecision
+
+// hyperLogLog is an approximate distinct value counter. Values are hashed
+// with xxhash, which isn't seeded, so the estimates are deterministic.
+//
+// See: https://algo.inria.fr/flajolet/Publications/FlFuGaMe07.pdf
+type hyperLogLog struct {
+	registers []uint8
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{registers: make([]uint8, hllRegisters)}
+}
+
+func (h *hyperLogLog) addHash(x uint64) {
+	idx := x >> (64 - hllPrecision)
+	// Set a sentinel bit so the rank is bounded when the remaining bits are all zero.
+	w := x<<hllPrecision | 1<<(hllPrecision-1)
+	rank := uint8(bits.LeadingZeros64(w) + 1)
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+func (h *hyperLogLog) AddBytes(v []byte) {
+	h.addHash(xxhash.Sum64(v))
+}
+
+func (h *hyperLogLog) AddInt(v int128.Num) {
+	var b [16]byte
+	h.addHash(xxhash.Sum64(v.AppendBigEndian(b[:0])))
+}
+
+func (h *hyperLogLog) AddFloat64(v float64) {
+	if v == 0 {
+		// Count -0 and +0 as the same value
+		v = 0
+	}
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+	h.addHash(xxhash.Sum64(b[:]))
+}
+
+// Merge returns a new sketch that counts the values of both sketches, either
+// of which can be nil.
+func (h *hyperLogLog) Merge(o *hyperLogLog) *hyperLogLog {
+	if h == nil && o == nil {
+		return nil
+	}
+	m := newHyperLogLog()
+	if h != nil {
+		copy(m.registers, h.registers)
+	}
+	if o != nil {
+		m.mergeFrom(o)
+	}
+	return m
+}
+
+// mergeFrom adds the values counted by o to the sketch.
+func (h *hyperLogLog) mergeFrom(o *hyperLogLog) {
+	for i, r := range o.registers {
+		h.registers[i] = max(h.registers[i], r)
+	}
+}
+
+// Estimate returns the approximate number of distinct values added to the sketch.
+func (h *hyperLogLog) Estimate() int64 {
+	const m = float64(hllRegisters)
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// Use linear counting for small cardinalities
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int64(math.Round(estimate))
+}
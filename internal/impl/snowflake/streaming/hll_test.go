@@ -0,0 +1,70 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package streaming
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/snowflake/streaming/int128"
+)
+
+func TestHyperLogLogEstimate(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 1_000, 100_000} {
+		t.Run(strconv.Itoa(n), func(t *testing.T) {
+			ints := newHyperLogLog()
+			floats := newHyperLogLog()
+			strs := newHyperLogLog()
+			// Add every value twice to ensure duplicates are not counted
+			for range 2 {
+				for i := range n {
+					ints.AddInt(int128.FromInt64(int64(i)))
+					floats.AddFloat64(float64(i) / 3)
+					strs.AddBytes([]byte(strconv.Itoa(i)))
+				}
+			}
+			for _, h := range []*hyperLogLog{ints, floats, strs} {
+				require.InDelta(t, n, h.Estimate(), float64(n)*0.05)
+			}
+		})
+	}
+}
+
+func TestHyperLogLogMerge(t *testing.T) {
+	a := newHyperLogLog()
+	b := newHyperLogLog()
+	for i := range 10_000 {
+		a.AddInt(int128.FromInt64(int64(i)))
+		b.AddInt(int128.FromInt64(int64(i + 5_000)))
+	}
+	merged := a.Merge(b)
+	require.InDelta(t, 15_000, merged.Estimate(), 15_000*0.05)
+	// The inputs are not modified
+	require.InDelta(t, 10_000, a.Estimate(), 10_000*0.05)
+	require.InDelta(t, 10_000, a.Merge(nil).Estimate(), 10_000*0.05)
+
+	var empty *hyperLogLog
+	require.Nil(t, empty.Merge(nil))
+}
+
+func TestMergeStatsNDV(t *testing.T) {
+	a := newStatsBuffer(true)
+	b := newStatsBuffer(true)
+	a.UpdateBytesStats([]byte("foo"))
+	a.UpdateBytesStats([]byte("bar"))
+	b.UpdateBytesStats([]byte("foo"))
+	b.UpdateBytesStats([]byte("baz"))
+	require.Equal(t, int64(3), mergeStats(a, b).ndv.Estimate())
+	require.Equal(t, int64(2), mergeStats(a, &statsBuffer{}).ndv.Estimate())
+	require.Nil(t, mergeStats(&statsBuffer{}, &statsBuffer{}).ndv)
+}
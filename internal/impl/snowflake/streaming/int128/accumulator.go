@@ -0,0 +1,107 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package int128
+
+import (
+	"encoding/binary"
+	"math/big"
+	"math/bits"
+)
+
+// Accumulator sums Num values without allocating by using a 256 bit
+// two's complement accumulator, which can hold the sum of at least 2^64
+// values of any magnitude without overflowing.
+//
+// The zero value is an empty accumulator.
+type Accumulator struct {
+	// The words of the sum, least significant first
+	words [4]uint64
+	count uint64
+}
+
+// Add adds v to the sum
+func (a *Accumulator) Add(v Num) {
+	// sign extend
+	ext := uint64(v.hi >> 63)
+	var carry uint64
+	a.words[0], carry = bits.Add64(a.words[0], v.lo, 0)
+	a.words[1], carry = bits.Add64(a.words[1], uint64(v.hi), carry)
+	a.words[2], carry = bits.Add64(a.words[2], ext, carry)
+	a.words[3], _ = bits.Add64(a.words[3], ext, carry)
+	a.count++
+}
+
+// Count returns the number of values that were added
+func (a *Accumulator) Count() uint64 {
+	return a.count
+}
+
+func (a *Accumulator) isNegative() bool {
+	return int64(a.words[3]) < 0
+}
+
+// Sum returns the sum of all values, or false if it doesn't fit in a Num.
+func (a *Accumulator) Sum() (Num, bool) {
+	// The upper words must be the sign extension of the lower 128 bits
+	ext := uint64(int64(a.words[1]) >> 63)
+	if a.words[2] != ext || a.words[3] != ext {
+		return Num{}, false
+	}
+	return Num{hi: int64(a.words[1]), lo: a.words[0]}, true
+}
+
+// magnitude returns the absolute value of the sum
+func (a *Accumulator) magnitude() [4]uint64 {
+	w := a.words
+	if !a.isNegative() {
+		return w
+	}
+	var borrow uint64
+	for i := range w {
+		w[i], borrow = bits.Sub64(0, w[i], borrow)
+	}
+	return w
+}
+
+// BigInt returns the sum of all values, which is always exact even if
+// it doesn't fit in a Num.
+func (a *Accumulator) BigInt() *big.Int {
+	w := a.magnitude()
+	var b [32]byte
+	for i, word := range w {
+		binary.BigEndian.PutUint64(b[24-8*i:], word)
+	}
+	bi := new(big.Int).SetBytes(b[:])
+	if a.isNegative() {
+		bi.Neg(bi)
+	}
+	return bi
+}
+
+// Mean returns the mean of all values rounded towards zero, or false
+// if no values were added. The mean always fits in a Num even if the
+// sum doesn't.
+func (a *Accumulator) Mean() (Num, bool) {
+	if a.count == 0 {
+		return Num{}, false
+	}
+	w := a.magnitude()
+	var q [4]uint64
+	var rem uint64
+	for i := len(w) - 1; i >= 0; i-- {
+		q[i], rem = bits.Div64(rem, w[i], a.count)
+	}
+	n := Num{hi: int64(q[1]), lo: q[0]}
+	if a.isNegative() {
+		n = Neg(n)
+	}
+	return n, true
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package int128
+
+import (
+	"math/big"
+	mrand "math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccumulator(t *testing.T) {
+	var a Accumulator
+	_, ok := a.Mean()
+	require.False(t, ok)
+	sum, ok := a.Sum()
+	require.True(t, ok)
+	require.Equal(t, FromInt64(0), sum)
+
+	a.Add(FromInt64(5))
+	a.Add(FromInt64(-8))
+	sum, ok = a.Sum()
+	require.True(t, ok)
+	require.Equal(t, FromInt64(-3), sum)
+	mean, ok := a.Mean()
+	require.True(t, ok)
+	require.Equal(t, FromInt64(-1), mean)
+	require.Equal(t, uint64(2), a.Count())
+
+	a = Accumulator{}
+	a.Add(MaxInt128)
+	a.Add(FromInt64(1))
+	_, ok = a.Sum()
+	require.False(t, ok)
+	expected := new(big.Int).Add(MaxInt128.bigInt(), big.NewInt(1))
+	require.Equal(t, expected.String(), a.BigInt().String())
+	mean, ok = a.Mean()
+	require.True(t, ok)
+	require.Equal(t, New(0x4000000000000000, 0), mean)
+
+	a = Accumulator{}
+	for range 4 {
+		a.Add(MinInt128)
+	}
+	_, ok = a.Sum()
+	require.False(t, ok)
+	mean, ok = a.Mean()
+	require.True(t, ok)
+	require.Equal(t, MinInt128, mean)
+}
+
+func TestAccumulatorRandomized(t *testing.T) {
+	for i := 0; i < 1_000; i++ {
+		var a Accumulator
+		expected := new(big.Int)
+		for range 1 + mrand.N(100) {
+			v := randomNum()
+			if mrand.N(2) == 0 {
+				v = Neg(v)
+			}
+			if mrand.N(20) == 0 {
+				v = []Num{MinInt128, MaxInt128}[mrand.N(2)]
+			}
+			a.Add(v)
+			expected.Add(expected, v.bigInt())
+		}
+
+		require.Equal(t, expected.String(), a.BigInt().String())
+
+		sum, ok := a.Sum()
+		expectedSum, expectedOk := bigInt(expected)
+		require.Equal(t, expectedOk, ok, "%s", expected)
+		if ok {
+			require.Equal(t, expectedSum, sum)
+		}
+
+		// big.Int.Quo truncates towards zero like Mean
+		expectedMean, ok := bigInt(new(big.Int).Quo(expected, new(big.Int).SetUint64(a.Count())))
+		require.True(t, ok)
+		mean, ok := a.Mean()
+		require.True(t, ok)
+		require.Equal(t, expectedMean, mean, "%s / %d", expected, a.Count())
+	}
+}
+
+func TestAccumulatorManyValues(t *testing.T) {
+	// The accumulator must not overflow when summing 2^64 extreme values,
+	// which is simulated by adding the values to an accumulator that
+	// already contains a sum close to that.
+	var a Accumulator
+	a.words = [4]uint64{0, 0xFFFFFFFFFFFFFFFF - 0x8000000000000000, 0x7FFFFFFFFFFFFFFF - 1, 0}
+	before := a.BigInt()
+	a.Add(MaxInt128)
+	require.Equal(t, new(big.Int).Add(before, MaxInt128.bigInt()).String(), a.BigInt().String())
+}
+
+func benchmarkAccumulatorValues() []Num {
+	values := make([]Num, 4096)
+	for i := range values {
+		values[i] = randomNum()
+		if mrand.N(2) == 0 {
+			values[i] = Neg(values[i])
+		}
+	}
+	return values
+}
+
+func BenchmarkAccumulator(b *testing.B) {
+	values := benchmarkAccumulatorValues()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var a Accumulator
+		for _, v := range values {
+			a.Add(v)
+		}
+		_, _ = a.Sum()
+	}
+}
+
+func BenchmarkAccumulatorBigInt(b *testing.B) {
+	values := benchmarkAccumulatorValues()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sum := new(big.Int)
+		for _, v := range values {
+			sum.Add(sum, v.bigInt())
+		}
+		_, _ = bigInt(sum)
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package int128
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// ToAny converts v into the value Bloblang and JSON handling
+// use for it, which is an int64 when it fits and otherwise
+// a json.Number so that no precision is lost.
+func ToAny(v Num) any {
+	if !Less(v, MinInt64) && !Greater(v, MaxInt64) {
+		return v.ToInt64()
+	}
+	return json.Number(v.String())
+}
+
+// FromAny converts the values produced by ToAny, Bloblang and
+// JSON handling into an Int128. Strings and json.Number must be
+// base 10 integers and floats must be integral, so that values
+// are never rounded.
+func FromAny(a any) (Num, error) {
+	switch v := a.(type) {
+	case Num:
+		return v, nil
+	case int:
+		return FromInt64(int64(v)), nil
+	case int64:
+		return FromInt64(v), nil
+	case uint64:
+		return FromUint64(v), nil
+	case json.Number:
+		return parseChecked(string(v))
+	case string:
+		return parseChecked(v)
+	case *big.Int:
+		if v == nil {
+			return Num{}, fmt.Errorf("unable to convert nil %T into Int128", a)
+		}
+		n, ok := bigInt(v)
+		if !ok {
+			return Num{}, fmt.Errorf("value %s is out of range for Int128", v)
+		}
+		return n, nil
+	case float64:
+		return fromIntegralFloat64(v)
+	}
+	return Num{}, fmt.Errorf("unable to convert %T into Int128", a)
+}
+
+// fromIntegralFloat64 converts a float64 exactly, which fails
+// for values with a fractional part instead of truncating them.
+func fromIntegralFloat64(v float64) (Num, error) {
+	if math.IsNaN(v) || math.IsInf(v, 0) || math.Trunc(v) != v {
+		return Num{}, fmt.Errorf("value %v is not an integer", v)
+	}
+	// All the integral floats within the int64 range except
+	// for 2^63 convert exactly.
+	if v >= math.MinInt64 && v < math.MaxInt64 {
+		return FromInt64(int64(v)), nil
+	}
+	bi, _ := big.NewFloat(v).Int(nil)
+	n, ok := bigInt(bi)
+	if !ok {
+		return Num{}, fmt.Errorf("value %v is out of range for Int128", v)
+	}
+	return n, nil
+}
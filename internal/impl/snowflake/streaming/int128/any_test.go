@@ -0,0 +1,137 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package int128
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/require"
+)
+
+var boundaryValues = []Num{
+	FromInt64(0),
+	FromInt64(1),
+	FromInt64(-1),
+	MaxInt64,
+	MinInt64,
+	Add(MaxInt64, FromInt64(1)),
+	Sub(MinInt64, FromInt64(1)),
+	FromUint64(math.MaxUint64),
+	Add(FromUint64(math.MaxUint64), FromInt64(1)),
+	Neg(FromUint64(math.MaxUint64)),
+	MaxInt128,
+	MinInt128,
+}
+
+func TestToAny(t *testing.T) {
+	require.Equal(t, int64(0), ToAny(FromInt64(0)))
+	require.Equal(t, int64(math.MaxInt64), ToAny(MaxInt64))
+	require.Equal(t, int64(math.MinInt64), ToAny(MinInt64))
+	require.Equal(t, json.Number("9223372036854775808"), ToAny(Add(MaxInt64, FromInt64(1))))
+	require.Equal(t, json.Number("-9223372036854775809"), ToAny(Sub(MinInt64, FromInt64(1))))
+	require.Equal(t, json.Number("170141183460469231731687303715884105727"), ToAny(MaxInt128))
+	require.Equal(t, json.Number("-170141183460469231731687303715884105728"), ToAny(MinInt128))
+}
+
+func TestFromAny(t *testing.T) {
+	tests := []struct {
+		in       any
+		expected Num
+		err      string
+	}{
+		{in: 42, expected: FromInt64(42)},
+		{in: int64(-42), expected: FromInt64(-42)},
+		{in: uint64(math.MaxUint64), expected: FromUint64(math.MaxUint64)},
+		{in: json.Number("-170141183460469231731687303715884105728"), expected: MinInt128},
+		{in: "170141183460469231731687303715884105727", expected: MaxInt128},
+		{in: big.NewInt(-7), expected: FromInt64(-7)},
+		{in: MaxInt128, expected: MaxInt128},
+		{in: float64(-1 << 53), expected: FromInt64(-1 << 53)},
+		{in: float64(1 << 63), expected: Add(MaxInt64, FromInt64(1))},
+		{in: float64(-1 << 63), expected: MinInt64},
+		{in: math.Ldexp(1, 100), expected: Shl(FromInt64(1), 100)},
+		{in: math.Ldexp(-1, 127), expected: MinInt128},
+		{in: math.Ldexp(1, 127), err: "out of range"},
+		{in: 1.5, err: "not an integer"},
+		{in: math.NaN(), err: "not an integer"},
+		{in: math.Inf(1), err: "not an integer"},
+		{in: json.Number("1.5"), err: "unable to parse"},
+		{in: "170141183460469231731687303715884105728", err: "out of range"},
+		{in: "foo", err: "unable to parse"},
+		{in: new(big.Int).Lsh(big.NewInt(1), 127), err: "out of range"},
+		{in: (*big.Int)(nil), err: "unable to convert nil"},
+		{in: true, err: "unable to convert bool"},
+		{in: nil, err: "unable to convert <nil>"},
+	}
+	for _, test := range tests {
+		n, err := FromAny(test.in)
+		if test.err != "" {
+			require.ErrorContains(t, err, test.err, "%v", test.in)
+			continue
+		}
+		require.NoError(t, err, "%v", test.in)
+		require.Equal(t, test.expected, n, "%v", test.in)
+	}
+}
+
+func TestAnyRoundTrip(t *testing.T) {
+	mapping, err := bloblang.Parse(`root.n = @n`)
+	require.NoError(t, err)
+
+	for _, v := range boundaryValues {
+		roundTrip := func(a any) {
+			t.Helper()
+			n, err := FromAny(a)
+			require.NoError(t, err, "%v (%T)", a, a)
+			require.Equal(t, v, n, "%v (%T)", a, a)
+		}
+
+		roundTrip(ToAny(v))
+		roundTrip(v.String())
+		roundTrip(v.bigInt())
+		if v.hi == 0 {
+			roundTrip(v.lo)
+		}
+		if f := v.ToFloat64(0); !Greater(v, MaxInt64) && !Less(v, MinInt64) && math.Abs(f) < 1<<53 {
+			roundTrip(f)
+		}
+
+		// Through JSON, decoded into the json.Number values which Bloblang uses for numbers.
+		b, err := json.Marshal(map[string]any{"n": ToAny(v)})
+		require.NoError(t, err)
+		var decoded map[string]any
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		require.NoError(t, dec.Decode(&decoded))
+		roundTrip(decoded["n"])
+
+		// Through message metadata and a Bloblang mapping.
+		msg := service.NewMessage(nil)
+		msg.MetaSetMut("n", ToAny(v))
+		meta, ok := msg.MetaGetMut("n")
+		require.True(t, ok)
+		roundTrip(meta)
+		metaStr, _ := msg.MetaGet("n")
+		roundTrip(metaStr)
+
+		res, err := msg.BloblangQuery(mapping)
+		require.NoError(t, err)
+		structured, err := res.AsStructured()
+		require.NoError(t, err)
+		roundTrip(structured.(map[string]any)["n"])
+	}
+}
@@ -22,10 +22,13 @@
 package int128
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"math"
-	"math/big"
+	"math/bits"
+	"strconv"
+	"strings"
 )
 
 // FitsInPrecision returns true or false if the value currently held by
@@ -39,7 +42,34 @@ func (i Num) FitsInPrecision(prec int32) bool {
 	if i == MinInt128 {
 		return false
 	}
-	return Less(i.Abs(), Pow10Table[prec])
+	p, ok := Pow10(prec)
+	if !ok {
+		// Every other value has at most 39 digits.
+		return prec > 0
+	}
+	return Less(i.Abs(), p)
+}
+
+// Precision returns the minimal decimal precision needed to represent v,
+// which is the number of digits of its absolute value. The precision of 0
+// is 1.
+func Precision(v Num) int32 {
+	// The abs call does nothing for this value, so we need to handle it properly
+	if v == MinInt128 {
+		return 39
+	}
+	v = v.Abs()
+	bitLen := bits.Len64(v.lo)
+	if v.hi != 0 {
+		bitLen = 64 + bits.Len64(uint64(v.hi))
+	}
+	// 1233/4096 is slightly less than log10(2), so this estimate of the
+	// number of digits is either exact or one too small.
+	prec := int32(bitLen * 1233 >> 12)
+	if p, ok := Pow10(prec); ok && !Less(v, p) {
+		prec++
+	}
+	return max(prec, 1)
 }
 
 func scalePositiveFloat64(v float64, prec, scale int32) (float64, error) {
@@ -127,15 +157,22 @@ func FromFloat64(v float64, prec, scale int32) (Num, error) {
 	return fromPositiveFloat64(v, prec, scale)
 }
 
-var (
-	pt5 = big.NewFloat(0.5)
-)
-
 // FromString converts a string into an Int128 as long as it fits within the given precision and scale.
 func FromString(v string, prec, scale int32) (n Num, err error) {
+	return fromString(v, prec, scale)
+}
+
+// FromStringBytes is like FromString, but parses the bytes of a string without
+// converting them into one, so that plain decimals of up to 38 characters are
+// parsed without allocating.
+func FromStringBytes(v []byte, prec, scale int32) (n Num, err error) {
+	return fromString(v, prec, scale)
+}
+
+func fromString[T string | []byte](v T, prec, scale int32) (n Num, err error) {
 	n, err = fromStringFast(v, prec, scale)
 	if err != nil {
-		n, err = fromStringSlow(v, prec, scale)
+		n, err = fromStringSlow(string(v), prec, scale)
 	}
 	return
 }
@@ -143,7 +180,7 @@ func FromString(v string, prec, scale int32) (n Num, err error) {
 var errFallbackNeeded = errors.New("fallback to slowpath needed")
 
 // A parsing fast path
-func fromStringFast(s string, prec, scale int32) (n Num, err error) {
+func fromStringFast[T string | []byte](s T, prec, scale int32) (n Num, err error) {
 	sLen := int32(len(s))
 	// Even though there could be decimal points or negative/positive signs
 	// we need to limit the length of the string to prevent overflow.
@@ -153,21 +190,22 @@ func fromStringFast(s string, prec, scale int32) (n Num, err error) {
 		err = errFallbackNeeded
 		return
 	}
-	s0 := s
+	neg := s[0] == '-'
 	if s[0] == '-' || s[0] == '+' {
 		s = s[1:]
-		if len(s) == 0 {
-			err = errFallbackNeeded
-			return
-		}
+	}
+	// A number without any digits is rejected by the slow path.
+	if len(s) == 0 || (len(s) == 1 && s[0] == '.') {
+		err = errFallbackNeeded
+		return
 	}
 
 	// The value between '.' - '0'
 	// we can't write that expression because
 	// go is strict about overflow in constants
 	const dotMinusZero = 254
-	for i, ch := range []byte(s) {
-		ch -= '0'
+	for i := 0; i < len(s); i++ {
+		ch := s[i] - '0'
 		if ch > 9 {
 			if ch == dotMinusZero {
 				s = s[i+1:]
@@ -178,15 +216,15 @@ func fromStringFast(s string, prec, scale int32) (n Num, err error) {
 		n = Add(Mul(n, ten), FromUint64(uint64(ch)))
 	}
 finish:
-	if s0[0] == '-' {
+	if neg {
 		n = Neg(n)
 	}
 	// Rescale validates the the new number fits within the precision
 	n, err = Rescale(n, prec, scale)
 	return
 fraction:
-	for i, ch := range []byte(s) {
-		ch -= '0'
+	for i := 0; i < len(s); i++ {
+		ch := s[i] - '0'
 		if ch > 9 {
 			return n, errFallbackNeeded
 		}
@@ -197,9 +235,8 @@ fraction:
 			}
 			// We need to validate the rest of the number is valid
 			// ie is not scientific notation
-			for _, ch := range []byte(s[i+1:]) {
-				ch -= '0'
-				if ch > 9 {
+			for j := i + 1; j < len(s); j++ {
+				if s[j]-'0' > 9 {
 					return n, errFallbackNeeded
 				}
 			}
@@ -211,55 +248,82 @@ fraction:
 	goto finish
 }
 
+// fromStringSlow parses any decimal the fast path can't, such as decimals in
+// scientific notation and decimals which are too long for it. The digits are
+// scaled exactly and the digits beyond the scale are rounded half away from
+// zero, like they are by the fast path.
 func fromStringSlow(v string, prec, scale int32) (n Num, err error) {
-	var out *big.Float
-	out, _, err = big.ParseFloat(v, 10, 128, big.ToNearestAway)
-	if err != nil {
-		return
+	s := v
+	neg := false
+	if len(s) > 0 && (s[0] == '-' || s[0] == '+') {
+		neg = s[0] == '-'
+		s = s[1:]
 	}
-
-	var ok bool
-	if scale < 0 {
-		var tmp big.Int
-		val, _ := out.Int(&tmp)
-		n, ok = bigInt(val)
-		if !ok {
-			err = fmt.Errorf("value out of range: %s", v)
-			return
+	var exp int64
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		if exp, err = strconv.ParseInt(s[i+1:], 10, 32); err != nil {
+			return Num{}, fmt.Errorf("invalid number %q: invalid exponent", v)
 		}
-		n = Div(n, Pow10Table[-scale])
-	} else {
-		p := (&big.Float{}).SetPrec(128).SetInt(Pow10Table[scale].bigInt())
-		out = out.Mul(out, p)
-		var tmp big.Int
-		val, _ := out.Int(&tmp)
-		// Round by subtracting the whole number so we only have the
-		// fractional bit left, then compare it to 0.5, then adjust
-		// the whole number according to IEEE RoundTiesToAway rounding
-		// mode, which is to round away from zero if the fractional
-		// part is |>=0.5|.
-		p = p.SetInt(val)
-		out = out.Sub(out, p)
-		if out.Signbit() {
-			if out.Cmp(pt5) <= 0 {
-				val = val.Sub(val, big.NewInt(1))
+		s = s[:i]
+	}
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" {
+		return Num{}, fmt.Errorf("invalid number %q: number has no digits", v)
+	}
+	for _, part := range [...]string{intPart, fracPart} {
+		for i := 0; i < len(part); i++ {
+			if part[i] < '0' || part[i] > '9' {
+				return Num{}, fmt.Errorf("invalid number %q", v)
 			}
+		}
+	}
+
+	// The value is digits * 10^(exp - len(fracPart)), which is scaled into
+	// digits * 10^shift by dropping the digits beyond the scale.
+	digits := strings.TrimLeft(intPart+fracPart, "0")
+	shift := exp - int64(len(fracPart)) + int64(scale)
+	roundUp := false
+	if shift < 0 {
+		if drop := -shift; drop > int64(len(digits)) {
+			digits = ""
 		} else {
-			if out.Cmp(pt5) >= 0 {
-				val = val.Add(val, big.NewInt(1))
-			}
+			roundUp = digits[int64(len(digits))-drop] >= '5'
+			digits = digits[:int64(len(digits))-drop]
+		}
+		shift = 0
+	}
+	if digits != "" {
+		// Checking the number of digits first also keeps the value within the
+		// range of an Int128.
+		if required := int64(len(digits)) + shift; required > int64(min(prec, 38)) {
+			return Num{}, precisionError(v, required, prec, scale)
 		}
-		n, ok = bigInt(val)
-		if !ok {
-			err = fmt.Errorf("value out of range: %s", v)
-			return
+		for i := 0; i < len(digits); i++ {
+			n = Add(Mul(n, ten), FromUint64(uint64(digits[i]-'0')))
+		}
+		if n, err = MulPow10(n, int32(shift)); err != nil {
+			return Num{}, err
 		}
 	}
-
-	if !n.FitsInPrecision(prec) {
-		err = fmt.Errorf("val %s doesn't fit in precision %d", n.String(), prec)
+	if roundUp {
+		n = Add(n, one)
+		if !n.FitsInPrecision(prec) {
+			return Num{}, precisionError(v, int64(Precision(n)), prec, scale)
+		}
 	}
-	return
+	if neg {
+		n = Neg(n)
+	}
+	return n, nil
+}
+
+// precisionError returns the error for a value which requires more digits
+// than the precision allows at the scale.
+func precisionError(v string, required int64, prec, scale int32) error {
+	return fmt.Errorf(
+		"value %s requires precision %d (%d integer and %d fractional digits) but the type is NUMBER(%d,%d)",
+		v, required, required-int64(scale), scale, prec, scale,
+	)
 }
 
 // ToFloat32 returns a float32 value representative of this Int128,
@@ -293,15 +357,87 @@ func (i Num) ToFloat64(scale int32) float64 {
 // within the specified precision.
 func Rescale(n Num, precision, scale int32) (out Num, err error) {
 	if !n.FitsInPrecision(precision - scale) {
-		err = fmt.Errorf("value (%s) out of range (precision=%d,scale=%d)", n.String(), precision, scale)
+		err = fmt.Errorf("value %s requires precision %d but the type is NUMBER(%d,%d)", n.String(), Precision(n)+scale, precision, scale)
 		return
 	}
-	if scale == 0 {
-		out = n
-		return
+	return MulPow10(n, scale)
+}
+
+// FormatDecimal formats n as a decimal number with scale digits after the
+// decimal point, for example 42 with a scale of 6 is formatted as "0.000042".
+// A scale of zero (or less) formats n as an integer.
+func FormatDecimal(n Num, scale int32) string {
+	if scale <= 0 {
+		return n.String()
 	}
-	out = Mul(n, Pow10Table[scale])
-	return
+	b := n.bigInt()
+	neg := b.Sign() < 0
+	digits := b.Abs(b).Append(nil, 10)
+	if pad := int(scale) - len(digits) + 1; pad > 0 {
+		digits = append(bytes.Repeat([]byte{'0'}, pad), digits...)
+	}
+	point := len(digits) - int(scale)
+	out := make([]byte, 0, len(digits)+2)
+	if neg {
+		out = append(out, '-')
+	}
+	out = append(out, digits[:point]...)
+	out = append(out, '.')
+	out = append(out, digits[point:]...)
+	return string(out)
+}
+
+// ParseDecimal parses a plain decimal number (an optional sign, digits and an
+// optional fractional part) into a Num with the given scale, such that
+// "1.5" with a scale of 2 is parsed as 150. Unlike FromString, values with more
+// fractional digits than the scale are rejected rather than rounded, and
+// exponents are not supported.
+func ParseDecimal(s string, scale int32) (Num, error) {
+	if _, ok := Pow10(scale); !ok {
+		return Num{}, fmt.Errorf("invalid scale %d for decimal %q", scale, s)
+	}
+	str := s
+	neg := false
+	if len(str) > 0 && (str[0] == '-' || str[0] == '+') {
+		neg = str[0] == '-'
+		str = str[1:]
+	}
+	intPart, fracPart, _ := strings.Cut(str, ".")
+	if intPart == "" && fracPart == "" {
+		return Num{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	if len(fracPart) > int(scale) {
+		return Num{}, fmt.Errorf("decimal %q has more than %d fractional digits", s, scale)
+	}
+	var n Num
+	significant := 0
+	for _, part := range [...]string{intPart, fracPart} {
+		for _, ch := range []byte(part) {
+			if ch < '0' || ch > '9' {
+				return Num{}, fmt.Errorf("invalid decimal %q", s)
+			}
+			if significant == 0 && ch == '0' {
+				continue
+			}
+			significant++
+			if significant > 38 {
+				return Num{}, fmt.Errorf("decimal %q out of range", s)
+			}
+			n = Add(Mul(n, ten), FromUint64(uint64(ch-'0')))
+		}
+	}
+	pad := int(scale) - len(fracPart)
+	if significant > 0 && significant+pad > 38 {
+		return Num{}, fmt.Errorf("decimal %q out of range (scale=%d)", s, scale)
+	}
+	n, err := MulPow10(n, int32(pad))
+	if err != nil {
+		return Num{}, fmt.Errorf("decimal %q out of range (scale=%d): %w", s, scale, err)
+	}
+	if neg {
+		n = Neg(n)
+	}
+	return n, nil
 }
 
 var (
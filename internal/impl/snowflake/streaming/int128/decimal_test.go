@@ -326,6 +326,33 @@ func TestFromString(t *testing.T) {
 	}
 }
 
+func TestFromStringExact(t *testing.T) {
+	tests := []struct {
+		s        string
+		scale    int32
+		expected string
+	}{
+		// Values with more significant digits than a float has are scaled exactly.
+		{"12345678901234567890123456789012345678e-37", 37, "12345678901234567890123456789012345678"},
+		{"1.2345678901234567890123456789012345678E0", 37, "12345678901234567890123456789012345678"},
+		{"-0.99999999999999999999999999999999999994", 37, "-9999999999999999999999999999999999999"},
+		{"0.99999999999999999999999999999999999995", 37, "10000000000000000000000000000000000000"},
+		{"0000000000000000000000000000000000000000000012.5", 1, "125"},
+		{"1.25e1", 0, "13"},
+		{"-1.25e1", 0, "-13"},
+	}
+	for _, tt := range tests {
+		n, err := FromString(tt.s, 38, tt.scale)
+		require.NoError(t, err, tt.s)
+		assert.Equal(t, MustParse(tt.expected), n, "%s: got %s", tt.s, n)
+	}
+
+	for _, s := range []string{".", "+.", "-", "e1", "1e", "1e1.5", "1.2.3", "1e99999999999"} {
+		_, err := FromString(s, 38, 2)
+		assert.Error(t, err, s)
+	}
+}
+
 func TestFromStringFast(t *testing.T) {
 	tests := []string{
 		"0",
@@ -392,6 +419,52 @@ func TestFromStringFast(t *testing.T) {
 	})
 }
 
+func TestFromStringBytes(t *testing.T) {
+	tests := []string{
+		"12.3",
+		"0.00123",
+		"1.23e-8",
+		"-1.23E+3",
+		"0000000",
+		".00000",
+		"+234.567",
+		"-2112.33",
+		"12E2",
+		"999999999999999999999999999999999999.9",
+		strings.Repeat("9", 40),
+		"+",
+		"-",
+		"",
+		".",
+		" 12.3",
+		"12.3 ",
+		"1\x002",
+		"12.\x00",
+		"++1",
+		"1.2.3",
+		"abc",
+	}
+	for _, str := range tests {
+		for _, scale := range []int32{0, 2, 5} {
+			expected, expectedErr := FromString(str, 38, scale)
+			actual, actualErr := FromStringBytes([]byte(str), 38, scale)
+			require.Equal(t, expectedErr, actualErr, "%q (scale=%d)", str, scale)
+			require.Equal(t, expected, actual, "%q (scale=%d)", str, scale)
+		}
+	}
+
+	for _, str := range []string{"1\x002", "12.\x00", "\x00"} {
+		_, err := FromStringBytes([]byte(str), 38, 2)
+		require.Error(t, err, "%q", str)
+	}
+
+	b := []byte("-480754368.9554427")
+	allocs := testing.AllocsPerRun(100, func() {
+		_, _ = FromStringBytes(b, 38, 7)
+	})
+	require.Zero(t, allocs)
+}
+
 func TestFromStringFastVsSlowRandomized(t *testing.T) {
 	for i := 0; i < 1000; i++ {
 		precision := rand.N(36) + 2
@@ -418,6 +491,93 @@ func TestFromStringFastVsSlowRandomized(t *testing.T) {
 	}
 }
 
+func TestFormatDecimal(t *testing.T) {
+	tests := []struct {
+		n        Num
+		scale    int32
+		expected string
+	}{
+		{FromInt64(42), 6, "0.000042"},
+		{FromInt64(-42), 6, "-0.000042"},
+		{FromInt64(42), 2, "0.42"},
+		{FromInt64(42), 1, "4.2"},
+		{FromInt64(42), 0, "42"},
+		{FromInt64(0), 3, "0.000"},
+		{FromInt64(-1234321), 4, "-123.4321"},
+		{MaxInt128, 37, "17.0141183460469231731687303715884105727"},
+		{MinInt128, 38, "-1.70141183460469231731687303715884105728"},
+	}
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			assert.Equal(t, test.expected, FormatDecimal(test.n, test.scale))
+		})
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		s        string
+		scale    int32
+		expected int64
+		err      string
+	}{
+		{s: "0.000042", scale: 6, expected: 42},
+		{s: "-0.000042", scale: 6, expected: -42},
+		{s: "+1.5", scale: 2, expected: 150},
+		{s: "12", scale: 3, expected: 12000},
+		{s: "12.", scale: 1, expected: 120},
+		{s: ".5", scale: 1, expected: 5},
+		{s: "000123", scale: 0, expected: 123},
+		{s: "-0", scale: 0, expected: 0},
+		{s: "1.23", scale: 1, err: "more than 1 fractional digits"},
+		{s: "1.0", scale: 0, err: "more than 0 fractional digits"},
+		{s: "", scale: 0, err: "invalid decimal"},
+		{s: "-", scale: 0, err: "invalid decimal"},
+		{s: ".", scale: 2, err: "invalid decimal"},
+		{s: "1e5", scale: 0, err: "invalid decimal"},
+		{s: "1.2.3", scale: 4, err: "invalid decimal"},
+		{s: "12 ", scale: 0, err: "invalid decimal"},
+		{s: "1", scale: 38, err: "out of range"},
+		{s: strings.Repeat("9", 39), scale: 0, err: "out of range"},
+		{s: "1", scale: -1, err: "invalid scale"},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s_%d", test.s, test.scale), func(t *testing.T) {
+			n, err := ParseDecimal(test.s, test.scale)
+			if test.err != "" {
+				require.ErrorContains(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, FromInt64(test.expected), n, "got: %s, want: %d", n.String(), test.expected)
+		})
+	}
+
+	n, err := ParseDecimal(strings.Repeat("9", 38), 0)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("9", 38), n.String())
+}
+
+func TestDecimalRoundTripRandomized(t *testing.T) {
+	for i := 0; i < 10000; i++ {
+		scale := int32(rand.N(38))
+		str := ""
+		for j := rand.N(38) + 1; j > 0; j-- {
+			str += strconv.Itoa(rand.N(10))
+		}
+		if rand.N(2) == 0 {
+			str = "-" + str
+		}
+		n, ok := Parse(str)
+		require.True(t, ok, str)
+
+		formatted := FormatDecimal(n, scale)
+		parsed, err := ParseDecimal(formatted, scale)
+		require.NoError(t, err, "%s (scale=%d)", formatted, scale)
+		require.Equal(t, n, parsed, "%s (scale=%d): %s vs %s", formatted, scale, n, parsed)
+	}
+}
+
 func BenchmarkParsing(b *testing.B) {
 	tests := []string{
 		"1",
@@ -469,3 +629,84 @@ func computeDecimalParameters(str string) (digitCount int32, leadingDigits int32
 	}
 	return
 }
+
+func TestPrecision(t *testing.T) {
+	tests := []struct {
+		n    Num
+		prec int32
+	}{
+		{Num{}, 1},
+		{FromInt64(1), 1},
+		{FromInt64(-1), 1},
+		{FromInt64(9), 1},
+		{FromInt64(10), 2},
+		{FromInt64(-10), 2},
+		{FromInt64(99), 2},
+		{FromInt64(100), 3},
+		{MaxInt64, 19},
+		{MinInt64, 19},
+		{FromUint64(math.MaxUint64), 20},
+		{MustParse("99999999999999999999999999999999999999"), 38},
+		{MustParse("-99999999999999999999999999999999999999"), 38},
+		{Pow10Table[38], 39},
+		{MaxInt128, 39},
+		{Add(MinInt128, FromInt64(1)), 39},
+		{MinInt128, 39},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.prec, Precision(test.n), test.n.String())
+	}
+
+	for p := 1; p < len(Pow10Table); p++ {
+		pow := Pow10Table[p]
+		below := Sub(pow, FromInt64(1))
+		assert.Equal(t, int32(p), Precision(below), below.String())
+		assert.Equal(t, int32(p), Precision(Neg(below)), Neg(below).String())
+		assert.Equal(t, int32(p+1), Precision(pow), pow.String())
+		assert.Equal(t, int32(p+1), Precision(Neg(pow)), Neg(pow).String())
+	}
+
+	for range 10_000 {
+		n := New(rand.Int64(), rand.Uint64())
+		if rand.N(2) == 0 {
+			n = uShr(n, rand.N(uint(128)))
+		}
+		expected := len(new(big.Int).Abs(n.bigInt()).String())
+		require.Equal(t, int32(expected), Precision(n), n.String())
+		for prec := int32(1); prec <= 38; prec++ {
+			require.Equal(t, Precision(n) <= prec, n.FitsInPrecision(prec), "%s (precision=%d)", n, prec)
+		}
+	}
+}
+
+func BenchmarkFitsInPrecision(b *testing.B) {
+	tests := []Num{
+		FromInt64(42),
+		MaxInt64,
+		MustParse("-12345678901234567890123456789"),
+		MaxInt128,
+	}
+	for _, test := range tests {
+		b.Run(test.String(), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_ = test.FitsInPrecision(38)
+			}
+		})
+	}
+}
+
+func BenchmarkPrecision(b *testing.B) {
+	tests := []Num{
+		FromInt64(42),
+		MaxInt64,
+		MustParse("-12345678901234567890123456789"),
+		MaxInt128,
+	}
+	for _, test := range tests {
+		b.Run(test.String(), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_ = Precision(test)
+			}
+		})
+	}
+}
@@ -17,7 +17,10 @@
 
 package int128
 
-import "cmp"
+import (
+	"cmp"
+	"math/bits"
+)
 
 // Div computes a / b
 //
@@ -27,6 +30,10 @@ func Div(dividend, divisor Num) Num {
 	if divisor == (Num{}) {
 		panic("int128 division by zero")
 	}
+	// Dispatch to the fast path if the high word is just the sign extension of the low word
+	if divisor.hi == int64(divisor.lo)>>63 {
+		return Div64(dividend, int64(divisor.lo))
+	}
 	negateQuotient := (dividend.hi < 0) != (divisor.hi < 0)
 	if dividend.IsNegative() {
 		dividend = Neg(dividend)
@@ -87,3 +94,31 @@ func uShr(v Num, amt uint) Num {
 		lo: v.lo>>amt | uint64(v.hi)>>n | uint64(v.hi)<<m,
 	}
 }
+
+// Div64 computes a / b for a divisor that fits in 64 bits, which is much
+// faster than Div for the general case.
+//
+// Division by zero panics
+func Div64(dividend Num, divisor int64) Num {
+	if divisor == 0 {
+		panic("int128 division by zero")
+	}
+	negateQuotient := (dividend.hi < 0) != (divisor < 0)
+	if dividend.IsNegative() {
+		dividend = Neg(dividend)
+	}
+	// Negating math.MinInt64 overflows, but the unsigned value is still correct.
+	d := uint64(divisor)
+	if divisor < 0 {
+		d = -d
+	}
+	// Two-word-by-one-word schoolbook division, the remainder of dividing the
+	// high word is always less than the divisor so bits.Div64 can't panic.
+	hi := uint64(dividend.hi)
+	quotient := Num{hi: int64(hi / d)}
+	quotient.lo, _ = bits.Div64(hi%d, dividend.lo, d)
+	if negateQuotient {
+		quotient = Neg(quotient)
+	}
+	return quotient
+}
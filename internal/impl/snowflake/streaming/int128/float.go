@@ -0,0 +1,252 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package int128
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// uint192 is an unsigned 192 bit integer stored as little endian limbs,
+// which is wide enough to hold a float64 mantissa multiplied by any
+// power of ten that fits in an Int128.
+type uint192 [3]uint64
+
+// mul64x128 returns a * (hi, lo) without overflow.
+func mul64x128(a, hi, lo uint64) uint192 {
+	h0, l0 := bits.Mul64(a, lo)
+	h1, l1 := bits.Mul64(a, hi)
+	mid, carry := bits.Add64(h0, l1, 0)
+	return uint192{l0, mid, h1 + carry}
+}
+
+func (w uint192) bitLen() int {
+	switch {
+	case w[2] != 0:
+		return 128 + bits.Len64(w[2])
+	case w[1] != 0:
+		return 64 + bits.Len64(w[1])
+	}
+	return bits.Len64(w[0])
+}
+
+func (w uint192) shl(n uint) (out uint192) {
+	limbs, s := int(n/64), n%64
+	for i := 2; i >= limbs; i-- {
+		out[i] = w[i-limbs] << s
+		if i-limbs > 0 {
+			out[i] |= w[i-limbs-1] >> (64 - s)
+		}
+	}
+	return
+}
+
+func (w uint192) shr(n uint) (out uint192) {
+	limbs, s := int(n/64), n%64
+	for i := 0; i+limbs < 3; i++ {
+		out[i] = w[i+limbs] >> s
+		if i+limbs < 2 {
+			out[i] |= w[i+limbs+1] << (64 - s)
+		}
+	}
+	return
+}
+
+// bit returns whether bit n is set.
+func (w uint192) bit(n uint) bool {
+	return w[n/64]>>(n%64)&1 == 1
+}
+
+// anyBelow returns whether any of the n least significant bits are set.
+func (w uint192) anyBelow(n uint) bool {
+	for i := range w {
+		switch {
+		case n >= 64:
+			if w[i] != 0 {
+				return true
+			}
+			n -= 64
+		case n > 0:
+			return w[i]&(1<<n-1) != 0
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+func (w uint192) inc() uint192 {
+	var carry uint64
+	w[0], carry = bits.Add64(w[0], 1, 0)
+	w[1], carry = bits.Add64(w[1], 0, carry)
+	w[2] += carry
+	return w
+}
+
+// shrHalfEven returns w / 2^n rounded to the nearest integer, with ties
+// rounded to the even integer.
+func (w uint192) shrHalfEven(n uint) uint192 {
+	if n == 0 {
+		return w
+	}
+	if n > 192 {
+		// w < 2^192 <= 2^(n-1), which is less than a half.
+		return uint192{}
+	}
+	q := w.shr(n)
+	if w.bit(n-1) && (q[0]&1 == 1 || w.anyBelow(n-1)) {
+		q = q.inc()
+	}
+	return q
+}
+
+// div64 returns w / d and whether the division had a remainder.
+func (w uint192) div64(d uint64) (q uint192, remainder bool) {
+	var r uint64
+	for i := 2; i >= 0; i-- {
+		q[i], r = bits.Div64(r, w[i], d)
+	}
+	return q, r != 0
+}
+
+// pow5Table contains the powers of five that fit in an uint64.
+var pow5Table = func() (t [28]uint64) {
+	t[0] = 1
+	for i := 1; i < len(t); i++ {
+		t[i] = t[i-1] * 5
+	}
+	return
+}()
+
+// FromFloat64Scaled returns f * 10^scale as an Int128, rounded to the nearest
+// integer with ties rounded to even, such that 0.125 with a scale of 2 is
+// 12 and 0.375 with a scale of 2 is 38.
+//
+// Unlike FromFloat64 the conversion is computed from the exact binary
+// expansion of f, so the result is the correctly rounded value of the
+// float rather than of its approximation by a power of ten. An error is
+// returned when f is NaN or infinite, when the result overflows an Int128
+// or when scale is outside of the range 0..38.
+func FromFloat64Scaled(f float64, scale int32) (Num, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return Num{}, fmt.Errorf("cannot convert %v to Int128", f)
+	}
+	p, ok := Pow10(scale)
+	if !ok {
+		return Num{}, fmt.Errorf("invalid scale %d, it must be between 0 and %d", scale, len(Pow10Table)-1)
+	}
+
+	b := math.Float64bits(f)
+	neg := b>>63 == 1
+	mant := b & (1<<52 - 1)
+	exp := int(b >> 52 & 0x7ff)
+	if exp == 0 {
+		// Subnormals have the same exponent as the smallest normal float.
+		exp = 1
+	} else {
+		mant |= 1 << 52
+	}
+	exp -= 1075
+
+	// f is exactly mant * 2^exp, so the scaled value is mant * 10^scale * 2^exp
+	// where mant * 10^scale fits in 192 bits.
+	w := mul64x128(mant, uint64(p.hi), p.lo)
+	if exp >= 0 {
+		if w.bitLen()+exp > 128 {
+			return Num{}, fmt.Errorf("cannot convert %v to Int128 with scale %d: overflow", f, scale)
+		}
+		w = w.shl(uint(exp))
+	} else {
+		w = w.shrHalfEven(uint(-exp))
+	}
+
+	// The magnitude of MinInt128 is one more than MaxInt128.
+	if w[2] != 0 || w[1] > 1<<63 || (w[1] == 1<<63 && (!neg || w[0] != 0)) {
+		return Num{}, fmt.Errorf("cannot convert %v to Int128 with scale %d: overflow", f, scale)
+	}
+	n := Num{hi: int64(w[1]), lo: w[0]}
+	if neg {
+		n = Neg(n)
+	}
+	return n, nil
+}
+
+// ToFloat64Scaled returns v / 10^scale as the nearest float64, with ties
+// rounded to even, and whether the float is exactly equal to it. For
+// example 1 with a scale of 1 is 0.1 but isn't exact, while 5 with a scale
+// of 1 is exactly 0.5.
+//
+// Unlike ToFloat64 the result is always correctly rounded. NaN is returned
+// when scale is outside of the range 0..38.
+func ToFloat64Scaled(v Num, scale int32) (f float64, exact bool) {
+	if _, ok := Pow10(scale); !ok {
+		return math.NaN(), false
+	}
+	neg := v.IsNegative()
+	if neg {
+		// MinInt128 wraps around to itself, which is its magnitude when
+		// interpreted as unsigned.
+		v = Neg(v)
+	}
+	hi, lo := uint64(v.hi), v.lo
+	if hi == 0 && lo == 0 {
+		return 0, true
+	}
+
+	if hi == 0 && lo <= 1<<53 && scale <= 22 {
+		// Both operands are exact so the division is correctly rounded, and
+		// the result is exact when the denominator reduces to a power of two.
+		f = float64(lo) / float64PowersOfTen[scale+38]
+		exact = lo%pow5Table[scale] == 0
+	} else {
+		f, exact = float64Scaled(hi, lo, scale)
+	}
+	if neg {
+		f = -f
+	}
+	return f, exact
+}
+
+// float64Scaled returns (hi, lo) / 10^scale correctly rounded and whether it
+// was exact. Since 10^scale is 5^scale * 2^scale the value is divided by
+// 5^scale and the power of two is only applied to the exponent.
+func float64Scaled(hi, lo uint64, scale int32) (float64, bool) {
+	n := uint192{lo, hi}
+
+	// 5^scale is split in two factors which fit in an uint64, the remainder
+	// of the division is zero only if the remainders of both divisions are.
+	first := min(scale, int32(len(pow5Table)-1))
+	d1, d2 := pow5Table[first], pow5Table[scale-first]
+
+	// Shift the dividend such that the quotient has at least 55 significant
+	// bits, which are the 53 bits of the mantissa, a rounding bit and at
+	// least one more bit that is part of the sticky bit.
+	shift := max(0, bits.Len64(d1)+bits.Len64(d2)+55-n.bitLen())
+	n = n.shl(uint(shift))
+
+	n, rem1 := n.div64(d1)
+	n, rem2 := n.div64(d2)
+	sticky := rem1 || rem2
+
+	drop := uint(n.bitLen() - 53)
+	mant := n.shr(drop)
+	round := n.bit(drop - 1)
+	below := n.anyBelow(drop-1) || sticky
+	if round && (below || mant[0]&1 == 1) {
+		mant = mant.inc()
+		if mant[0] == 1<<53 {
+			mant[0] >>= 1
+			drop++
+		}
+	}
+	return math.Ldexp(float64(mant[0]), int(drop)-shift-int(scale)), !round && !below
+}
@@ -0,0 +1,294 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package int128
+
+import (
+	"math"
+	"math/big"
+	"math/rand/v2"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fromFloat64ScaledReference converts f using its exact decimal expansion as
+// formatted by strconv, which never needs more than 1074 fractional digits.
+func fromFloat64ScaledReference(f float64, scale int32) (Num, bool) {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'f', 1074, 64))
+	if !ok {
+		panic("invalid float")
+	}
+	r.Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)))
+	q, m := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	// Round half to even, the sign of the remainder follows the quotient.
+	switch m.Abs(m).Lsh(m, 1).Cmp(r.Denom()) {
+	case 1:
+		q.Add(q, big.NewInt(int64(r.Sign())))
+	case 0:
+		if q.Bit(0) == 1 {
+			q.Add(q, big.NewInt(int64(r.Sign())))
+		}
+	}
+	return bigInt(q)
+}
+
+// toFloat64ScaledReference converts v using strconv, which is correctly
+// rounded.
+func toFloat64ScaledReference(v Num, scale int32) (float64, bool) {
+	s := FormatDecimal(v, scale)
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		panic(err)
+	}
+	r, _ := new(big.Rat).SetString(s)
+	return f, new(big.Rat).SetFloat64(f).Cmp(r) == 0
+}
+
+func requireFromFloat64Scaled(t *testing.T, f float64, scale int32) {
+	t.Helper()
+	expected, ok := fromFloat64ScaledReference(f, scale)
+	actual, err := FromFloat64Scaled(f, scale)
+	if !ok {
+		require.Error(t, err, "%v (scale=%d)", f, scale)
+		return
+	}
+	require.NoError(t, err, "%v (scale=%d)", f, scale)
+	require.Equal(t, expected, actual, "%v (scale=%d): %s vs %s", f, scale, expected, actual)
+}
+
+func requireToFloat64Scaled(t *testing.T, v Num, scale int32) {
+	t.Helper()
+	expected, expectedExact := toFloat64ScaledReference(v, scale)
+	actual, exact := ToFloat64Scaled(v, scale)
+	require.Equal(t, expected, actual, "%s (scale=%d)", v, scale)
+	require.Equal(t, expectedExact, exact, "%s (scale=%d)", v, scale)
+}
+
+func TestFromFloat64Scaled(t *testing.T) {
+	tests := []struct {
+		f        float64
+		scale    int32
+		expected string
+	}{
+		{0, 0, "0"},
+		{math.Copysign(0, -1), 10, "0"},
+		{0.5, 0, "0"},
+		{1.5, 0, "2"},
+		{2.5, 0, "2"},
+		{-2.5, 0, "-2"},
+		{-3.5, 0, "-4"},
+		{0.125, 2, "12"},
+		{0.375, 2, "38"},
+		// 0.1 is slightly above one tenth.
+		{0.1, 20, "10000000000000000555"},
+		{123.456, 3, "123456"},
+		{-123.456, 3, "-123456"},
+		{1 << 53, 0, "9007199254740992"},
+		{1<<53 + 2, 1, "90071992547409940"},
+		{math.Ldexp(1, 126), 0, "85070591730234615865843651857942052864"},
+		{-math.Ldexp(1, 127), 0, "-170141183460469231731687303715884105728"},
+		{math.SmallestNonzeroFloat64, 38, "0"},
+		{1e-38, 38, "1"},
+		{4.9e-39, 38, "0"},
+		{5.1e-39, 38, "1"},
+	}
+	for _, test := range tests {
+		actual, err := FromFloat64Scaled(test.f, test.scale)
+		require.NoError(t, err, "%v (scale=%d)", test.f, test.scale)
+		require.Equal(t, MustParse(test.expected), actual, "%v (scale=%d)", test.f, test.scale)
+	}
+
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1), math.Ldexp(1, 127), 1e38} {
+		_, err := FromFloat64Scaled(f, 1)
+		require.Error(t, err, "%v", f)
+	}
+	_, err := FromFloat64Scaled(1, -1)
+	require.Error(t, err)
+	_, err = FromFloat64Scaled(1, 39)
+	require.Error(t, err)
+}
+
+func TestFromFloat64ScaledReference(t *testing.T) {
+	for scale := int32(0); scale <= 38; scale++ {
+		// Powers of two, from subnormals up to overflowing values.
+		for exp := -1074; exp <= 128; exp++ {
+			requireFromFloat64Scaled(t, math.Ldexp(1, exp), scale)
+			requireFromFloat64Scaled(t, -math.Ldexp(1, exp), scale)
+		}
+		// Values near 2^53, where consecutive floats are 2 apart.
+		for delta := -4.0; delta <= 4; delta++ {
+			requireFromFloat64Scaled(t, 1<<53+delta, scale)
+			requireFromFloat64Scaled(t, -(1<<53 + delta), scale)
+		}
+		// Subnormals.
+		for _, f := range []float64{
+			math.SmallestNonzeroFloat64,
+			math.Float64frombits(1<<52 - 1),
+			math.Float64frombits(1 << 51),
+		} {
+			requireFromFloat64Scaled(t, f, scale)
+		}
+		// The largest and smallest floats that fit with the scale.
+		maxScaled, _ := ToFloat64Scaled(MaxInt128, scale)
+		minScaled, _ := ToFloat64Scaled(MinInt128, scale)
+		for _, f := range []float64{maxScaled, minScaled} {
+			requireFromFloat64Scaled(t, f, scale)
+			requireFromFloat64Scaled(t, math.Nextafter(f, 0), scale)
+			requireFromFloat64Scaled(t, math.Nextafter(f, 2*f), scale)
+		}
+		// Ties between two scaled integers.
+		for i := 0; i < 20; i++ {
+			requireFromFloat64Scaled(t, float64(i)+0.5, scale)
+			requireFromFloat64Scaled(t, -float64(i)-0.5, scale)
+		}
+	}
+}
+
+func TestFromFloat64ScaledRandomized(t *testing.T) {
+	for i := 0; i < 100_000; i++ {
+		scale := rand.N(int32(39))
+		var f float64
+		switch rand.N(3) {
+		case 0:
+			f = math.Float64frombits(rand.Uint64())
+			if math.IsNaN(f) || math.IsInf(f, 0) {
+				continue
+			}
+		case 1:
+			// Values in the range of the scale.
+			f = math.Ldexp(rand.Float64(), rand.N(128)-int(scale)*10/3)
+		case 2:
+			f = float64(rand.Int64()) / math.Pow10(int(scale))
+		}
+		requireFromFloat64Scaled(t, f, scale)
+	}
+}
+
+func TestToFloat64Scaled(t *testing.T) {
+	tests := []struct {
+		v        string
+		scale    int32
+		expected float64
+		exact    bool
+	}{
+		{"0", 0, 0, true},
+		{"0", 38, 0, true},
+		{"1", 1, 0.1, false},
+		{"5", 1, 0.5, true},
+		{"-5", 1, -0.5, true},
+		{"125", 3, 0.125, true},
+		{"12345", 2, 123.45, false},
+		{"9007199254740993", 0, 1 << 53, false},
+		{"90071992547409930", 1, 1 << 53, false},
+		{"9007199254740995", 0, 1<<53 + 4, false},
+		{"170141183460469231731687303715884105727", 0, math.Ldexp(1, 127), false},
+		{"-170141183460469231731687303715884105728", 0, -math.Ldexp(1, 127), true},
+		{"1", 38, 1e-38, false},
+	}
+	for _, test := range tests {
+		actual, exact := ToFloat64Scaled(MustParse(test.v), test.scale)
+		require.Equal(t, test.expected, actual, "%s (scale=%d)", test.v, test.scale)
+		require.Equal(t, test.exact, exact, "%s (scale=%d)", test.v, test.scale)
+	}
+
+	f, exact := ToFloat64Scaled(FromInt64(1), 39)
+	require.True(t, math.IsNaN(f))
+	require.False(t, exact)
+}
+
+func TestToFloat64ScaledReference(t *testing.T) {
+	for scale := int32(0); scale <= 38; scale++ {
+		values := []Num{MaxInt128, MinInt128, FromInt64(1), FromInt64(-1)}
+		for exp := uint(0); exp < 127; exp++ {
+			p := Shl(FromInt64(1), exp)
+			values = append(values, p, Sub(p, FromInt64(1)), Add(p, FromInt64(1)), Neg(p))
+		}
+		for delta := int64(-4); delta <= 4; delta++ {
+			values = append(values, FromInt64(1<<53+delta), FromInt64(-(1<<53 + delta)))
+		}
+		if p, ok := Pow10(scale); ok {
+			values = append(values, p, Mul(p, FromInt64(3)), Add(p, FromInt64(1)))
+		}
+		for _, v := range values {
+			requireToFloat64Scaled(t, v, scale)
+		}
+	}
+}
+
+func TestToFloat64ScaledRandomized(t *testing.T) {
+	for i := 0; i < 100_000; i++ {
+		scale := rand.N(int32(39))
+		v := Num{hi: rand.Int64(), lo: rand.Uint64()}
+		// Cover all magnitudes.
+		v = uShr(v, rand.N(uint(128)))
+		if rand.N(2) == 0 {
+			v = Neg(v)
+		}
+		requireToFloat64Scaled(t, v, scale)
+	}
+}
+
+func TestFloat64ScaledRoundTrip(t *testing.T) {
+	for i := 0; i < 10_000; i++ {
+		scale := rand.N(int32(39))
+		// The rounding error of values of up to 52 bits is below half of
+		// the last digit, so they survive the round trip.
+		v := Num{lo: rand.Uint64() >> 12}
+		f, _ := ToFloat64Scaled(v, scale)
+		n, err := FromFloat64Scaled(f, scale)
+		require.NoError(t, err)
+		require.Equal(t, v, n, "%v (scale=%d)", f, scale)
+	}
+}
+
+var benchmarkFloats = []float64{0, 1, -1.5, 123.456, 1e-10, 9007199254740993, 1e20, -3.14159265358979}
+
+func BenchmarkFromFloat64Scaled(b *testing.B) {
+	b.Run("exact", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, f := range benchmarkFloats {
+				_, _ = FromFloat64Scaled(f, 10)
+			}
+		}
+	})
+	b.Run("strconv", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, f := range benchmarkFloats {
+				_, _ = FromString(strconv.FormatFloat(f, 'f', 10, 64), 38, 10)
+			}
+		}
+	})
+}
+
+func BenchmarkToFloat64Scaled(b *testing.B) {
+	values := []Num{FromInt64(1), FromInt64(-15), FromInt64(123456), MaxInt128, MinInt128, MustParse("12345678901234567890123")}
+	for _, scale := range []int32{2, 10, 30} {
+		b.Run("exact_scale_"+strconv.Itoa(int(scale)), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for _, v := range values {
+					_, _ = ToFloat64Scaled(v, scale)
+				}
+			}
+		})
+		b.Run("strconv_scale_"+strconv.Itoa(int(scale)), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for _, v := range values {
+					_, _ = strconv.ParseFloat(FormatDecimal(v, scale), 64)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package int128
+
+const (
+	hashPrime1 = 0x9E3779B97F4A7C15
+	hashPrime2 = 0xC2B2AE3D27D4EB4F
+)
+
+// Hash64 returns a 64 bit hash of v, which is different
+// for each seed.
+//
+// Num is comparable so it can be used as a map key directly,
+// this is for sharding and other structures that need the
+// hash itself. Flipping any bit of v flips each bit of the
+// hash with a probability close to 1/2.
+func Hash64(v Num, seed uint64) uint64 {
+	h := fmix64((seed + hashPrime1) ^ v.lo)
+	return fmix64(h + uint64(v.hi)*hashPrime2)
+}
+
+// fmix64 is the finalizer of MurmurHash3, which mixes
+// every bit of k into every bit of the result.
+func fmix64(k uint64) uint64 {
+	k ^= k >> 33
+	k *= 0xFF51AFD7ED558CCD
+	k ^= k >> 33
+	k *= 0xC4CEB9FE1A85EC53
+	k ^= k >> 33
+	return k
+}
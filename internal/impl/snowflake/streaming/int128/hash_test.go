@@ -0,0 +1,76 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package int128
+
+import (
+	mrand "math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHash64(t *testing.T) {
+	require.Equal(t, Hash64(MaxInt128, 1), Hash64(MaxInt128, 1))
+	require.NotEqual(t, Hash64(MaxInt128, 1), Hash64(MaxInt128, 2))
+	require.NotEqual(t, Hash64(New(0, 1), 0), Hash64(New(1, 0), 0))
+	require.NotEqual(t, Hash64(FromInt64(0), 0), Hash64(FromInt64(-1), 0))
+
+	seen := map[uint64]Num{}
+	for i := range int64(10000) {
+		v := FromInt64(i)
+		h := Hash64(v, 0)
+		require.NotContains(t, seen, h, "collision between %v and %v", v, seen[h])
+		seen[h] = v
+	}
+}
+
+func TestHash64Avalanche(t *testing.T) {
+	// The tolerance is more than 6 standard deviations, so that
+	// none of the 8192 pairs of bits exceed it by chance.
+	const samples = 4000
+	rng := mrand.New(mrand.NewPCG(1, 2))
+
+	// flips[i][j] counts how often flipping input bit i flipped output bit j.
+	var flips [128][64]int
+	for range samples {
+		v := New(int64(rng.Uint64()), rng.Uint64())
+		seed := rng.Uint64()
+		h := Hash64(v, seed)
+		for i := range 128 {
+			flipped := v
+			if i < 64 {
+				flipped.lo ^= 1 << i
+			} else {
+				flipped.hi ^= 1 << (i - 64)
+			}
+			diff := h ^ Hash64(flipped, seed)
+			for j := range 64 {
+				flips[i][j] += int(diff >> j & 1)
+			}
+		}
+	}
+
+	for i := range 128 {
+		for j := range 64 {
+			p := float64(flips[i][j]) / samples
+			require.InDelta(t, 0.5, p, 0.05, "flipping input bit %d flips output bit %d with probability %v", i, j, p)
+		}
+	}
+}
+
+func BenchmarkHash64(b *testing.B) {
+	v := MustParse("123456789012345678901234567890")
+	var h uint64
+	for i := 0; i < b.N; i++ {
+		h ^= Hash64(v, uint64(i))
+	}
+	_ = h
+}
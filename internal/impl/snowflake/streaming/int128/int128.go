@@ -21,6 +21,7 @@ import (
 	"math"
 	"math/big"
 	"math/bits"
+	"strconv"
 )
 
 // Common constant values for int128
@@ -141,6 +142,57 @@ func Mul(a, b Num) Num {
 	return Num{hi: int64(hi), lo: lo}
 }
 
+// Pow10 returns 10^n, or false when n is outside of the range 0..38 which
+// can be represented by an Int128.
+func Pow10(n int32) (Num, bool) {
+	if n < 0 || int(n) >= len(Pow10Table) {
+		return Num{}, false
+	}
+	return Pow10Table[n], true
+}
+
+// maxPow10Multiplicands holds the largest absolute value which can be
+// multiplied by each power of 10 in Pow10Table without overflowing.
+var maxPow10Multiplicands = func() (m [len(Pow10Table)]Num) {
+	for i, p := range Pow10Table {
+		m[i] = Div(MaxInt128, p)
+	}
+	return
+}()
+
+// MulPow10 computes v * 10^n, which scales v up by n decimal digits. An error
+// is returned when n is outside of the range 0..38, including negative n,
+// which must be scaled down with DivPow10 instead, or when the result
+// overflows an Int128.
+func MulPow10(v Num, n int32) (Num, error) {
+	p, ok := Pow10(n)
+	if !ok {
+		return Num{}, fmt.Errorf("invalid exponent %d for a power of 10, it must be between 0 and %d", n, len(Pow10Table)-1)
+	}
+	if n == 0 {
+		return v, nil
+	}
+	if bound := maxPow10Multiplicands[n]; Greater(v, bound) || Less(v, Neg(bound)) {
+		return Num{}, fmt.Errorf("%s * 10^%d overflows an Int128", v, n)
+	}
+	return Mul(v, p), nil
+}
+
+// DivPow10 computes v / 10^n truncated towards zero, which scales v down by
+// n decimal digits. Since no Int128 has more than 39 digits, the result is 0
+// when n is greater than 38. A negative n is treated as 0 and returns v
+// unchanged, values must be scaled up with MulPow10 instead.
+func DivPow10(v Num, n int32) Num {
+	if n <= 0 {
+		return v
+	}
+	p, ok := Pow10(n)
+	if !ok {
+		return Num{}
+	}
+	return Div(v, p)
+}
+
 func fls128(n Num) int {
 	if n.hi != 0 {
 		return 127 - bits.LeadingZeros64(uint64(n.hi))
@@ -159,6 +211,9 @@ func Neg(n Num) Num {
 }
 
 // Abs computes v < 0 ? -v : v
+//
+// Note that Abs(MinInt128) overflows and wraps around to MinInt128,
+// use AbsCheck to detect this case.
 func (i Num) Abs() Num {
 	if i.IsNegative() {
 		return Neg(i)
@@ -166,6 +221,26 @@ func (i Num) Abs() Num {
 	return i
 }
 
+// AbsCheck computes v < 0 ? -v : v and returns false if
+// the result overflows, which only happens for MinInt128.
+func (i Num) AbsCheck() (Num, bool) {
+	if i == MinInt128 {
+		return i, false
+	}
+	return i.Abs(), true
+}
+
+// Sign returns -1 if v < 0, 0 if v == 0 and 1 if v > 0
+func (i Num) Sign() int {
+	switch {
+	case i.IsNegative():
+		return -1
+	case i == Num{}:
+		return 0
+	}
+	return 1
+}
+
 // IsNegative returns true if `i` is negative
 func (i Num) IsNegative() bool {
 	return i.hi < 0
@@ -260,7 +335,7 @@ func Min(a, b Num) Num {
 	}
 }
 
-// Max computes min(a, b)
+// Max computes max(a, b)
 func Max(a, b Num) Num {
 	if Greater(a, b) {
 		return a
@@ -269,6 +344,34 @@ func Max(a, b Num) Num {
 	}
 }
 
+// MinMax computes the minimum and maximum of values, it's equivalent to
+// calling Min and Max for each of them but compares the values with
+// arithmetic on their words. It panics if values is empty.
+func MinMax(values []Num) (minimum, maximum Num) {
+	if len(values) == 0 {
+		panic("int128.MinMax: empty list")
+	}
+	// Keep the high words with flipped sign bits so that each comparison is
+	// an unsigned 128 bit subtraction.
+	const signBit = 1 << 63
+	minHi, minLo := uint64(values[0].hi)^signBit, values[0].lo
+	maxHi, maxLo := minHi, minLo
+	for _, v := range values[1:] {
+		hi := uint64(v.hi) ^ signBit
+		_, borrow := bits.Sub64(v.lo, minLo, 0)
+		_, borrow = bits.Sub64(hi, minHi, borrow)
+		if borrow != 0 {
+			minHi, minLo = hi, v.lo
+		}
+		_, borrow = bits.Sub64(maxLo, v.lo, 0)
+		_, borrow = bits.Sub64(maxHi, hi, borrow)
+		if borrow != 0 {
+			maxHi, maxLo = hi, v.lo
+		}
+	}
+	return Num{hi: int64(minHi ^ signBit), lo: minLo}, Num{hi: int64(maxHi ^ signBit), lo: maxLo}
+}
+
 // MustParse converted a base 10 formatted string into an Int128
 // and panics otherwise
 //
@@ -293,20 +396,150 @@ func Parse(str string) (n Num, ok bool) {
 	return bigInt(bi)
 }
 
+// ParseBytes is like Parse, but parses the bytes of a base 10 formatted
+// string without converting them into one, so that integers of up to 38
+// digits are parsed without allocating.
+func ParseBytes(b []byte) (n Num, ok bool) {
+	if n, ok = parseFast(b); ok {
+		return
+	}
+	return Parse(string(b))
+}
+
+// parseFast parses an optional sign followed by up to 38 digits, which always
+// fit into an Int128, it returns false for anything else so that the caller
+// can fall back to Parse.
+func parseFast(b []byte) (n Num, ok bool) {
+	neg := len(b) > 0 && b[0] == '-'
+	if len(b) > 0 && (b[0] == '-' || b[0] == '+') {
+		b = b[1:]
+	}
+	if len(b) == 0 || len(b) > 38 {
+		return
+	}
+	for _, ch := range b {
+		ch -= '0'
+		if ch > 9 {
+			return
+		}
+		n = Add(Mul(n, ten), FromUint64(uint64(ch)))
+	}
+	if neg {
+		n = Neg(n)
+	}
+	return n, true
+}
+
+// maxDecimalLen is the length of the longest base 10
+// formatted Int128, which is MinInt128.
+const maxDecimalLen = 40
+
 // String returns the number as base 10 formatted string.
-//
-// This is not fast but it isn't on a hot path.
 func (i Num) String() string {
-	return string(i.bigInt().Append(nil, 10))
+	var buf [maxDecimalLen]byte
+	return string(AppendString(buf[:0], i))
+}
+
+// AppendString appends the base 10 formatted number to dst
+// and returns the extended buffer.
+//
+// This doesn't allocate unless dst needs to grow.
+func AppendString(dst []byte, v Num) []byte {
+	var buf [maxDecimalLen]byte
+	pos := len(buf)
+	neg := v.IsNegative()
+	if neg {
+		// The negation of MinInt128 overflows back to itself,
+		// but its bits are the magnitude as an unsigned value.
+		v = Neg(v)
+	}
+	hi, lo := uint64(v.hi), v.lo
+	// Divide the magnitude by 1e19, the largest power of 10
+	// that fits in a uint64, emitting 19 digits per chunk
+	// until it fits into the low word.
+	for hi != 0 {
+		var r uint64
+		hi, r = bits.Div64(0, hi, 1e19)
+		lo, r = bits.Div64(r, lo, 1e19)
+		for range 19 {
+			pos--
+			buf[pos] = byte('0' + r%10)
+			r /= 10
+		}
+	}
+	for lo >= 10 {
+		pos--
+		buf[pos] = byte('0' + lo%10)
+		lo /= 10
+	}
+	pos--
+	buf[pos] = byte('0' + lo)
+	if neg {
+		pos--
+		buf[pos] = '-'
+	}
+	return append(dst, buf[pos:]...)
+}
+
+// AppendText implements encoding.TextAppender using the
+// same base 10 format as String.
+func (i Num) AppendText(b []byte) ([]byte, error) {
+	return AppendString(b, i), nil
 }
 
 // MarshalJSON implements JSON serialization of
 // an int128 like BigInteger in the Snowflake
 // Java SDK with Jackson.
+func (i Num) MarshalJSON() ([]byte, error) {
+	return AppendString(nil, i), nil
+}
+
+// UnmarshalJSON implements JSON deserialization of
+// an int128 from a base 10 formatted number or string.
 //
 // This is not fast but it isn't on a hot path.
-func (i Num) MarshalJSON() ([]byte, error) {
-	return i.bigInt().Append(nil, 10), nil
+func (i *Num) UnmarshalJSON(b []byte) error {
+	str := string(b)
+	if unquoted, err := strconv.Unquote(str); err == nil {
+		str = unquoted
+	}
+	n, ok := Parse(str)
+	if !ok {
+		return fmt.Errorf("unable to parse %s into Int128", b)
+	}
+	*i = n
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler using the
+// same base 10 format as String.
+func (i Num) MarshalText() ([]byte, error) {
+	return AppendString(nil, i), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler for
+// base 10 formatted strings like Parse.
+func (i *Num) UnmarshalText(b []byte) error {
+	n, err := parseChecked(string(b))
+	if err != nil {
+		return err
+	}
+	*i = n
+	return nil
+}
+
+// parseChecked is like Parse, but distinguishes values that
+// are not integers from values that are out of range.
+func parseChecked(str string) (Num, error) {
+	bi, ok := big.NewInt(0).SetString(str, 10)
+	if !ok {
+		return Num{}, fmt.Errorf("unable to parse %q into Int128", str)
+	}
+	n, ok := bigInt(bi)
+	if !ok {
+		return Num{}, fmt.Errorf("value %s is out of range for Int128", str)
+	}
+	return n, nil
 }
 
 func (i Num) bigInt() *big.Int {
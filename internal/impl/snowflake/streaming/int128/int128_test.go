@@ -12,9 +12,13 @@ package int128
 
 import (
 	"crypto/rand"
+	"encoding/json"
 	"fmt"
 	"math"
+	"math/big"
+	mrand "math/rand/v2"
 	"slices"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -274,6 +278,91 @@ func TestDiv(t *testing.T) {
 	}
 }
 
+func TestDiv64(t *testing.T) {
+	cases := []struct {
+		dividend Num
+		divisor  int64
+		quotient Num
+	}{
+		{FromInt64(100), 10, FromInt64(10)},
+		{FromInt64(-100), 10, FromInt64(-10)},
+		{FromInt64(100), -10, FromInt64(-10)},
+		{FromInt64(-100), -10, FromInt64(10)},
+		{FromInt64(99), 100, FromInt64(0)},
+		{MustParse("99999999999999999999999999999999999999"), 1_000_000_000_000_000_000, MustParse("99999999999999999999")},
+		{MustParse("-99999999999999999999999999999999999999"), 1_000_000_000_000_000_000, MustParse("-99999999999999999999")},
+		{MaxInt128, 1, MaxInt128},
+		{MaxInt128, -1, Neg(MaxInt128)},
+		{MaxInt128, math.MaxInt64, MustParse("18446744073709551618")},
+		{MaxInt128, math.MinInt64, MustParse("-18446744073709551615")},
+		{MinInt128, 1, MinInt128},
+		// Overflows and wraps around like Div
+		{MinInt128, -1, MinInt128},
+		{MinInt128, 2, MustParse("-85070591730234615865843651857942052864")},
+		{MinInt128, math.MinInt64, MustParse("18446744073709551616")},
+		{MinInt128, math.MaxInt64, MustParse("-18446744073709551618")},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.quotient, Div64(c.dividend, c.divisor), "%s / %d", c.dividend, c.divisor)
+		require.Equal(t, c.quotient, Div(c.dividend, FromInt64(c.divisor)), "%s / %d", c.dividend, c.divisor)
+	}
+	require.Panics(t, func() { Div64(one, 0) })
+}
+
+func randomNum() Num {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	n := FromBigEndian(b[:])
+	// Use a random width so that small values are common
+	return uShr(n, uint(mrand.N(128)))
+}
+
+func TestDivRandomized(t *testing.T) {
+	for i := 0; i < 10_000; i++ {
+		dividend := randomNum()
+		if mrand.N(2) == 0 {
+			dividend = Neg(dividend)
+		}
+		var divisor Num
+		if mrand.N(2) == 0 {
+			divisor = FromInt64(int64(randomNum().lo))
+		} else {
+			divisor = randomNum()
+			if mrand.N(2) == 0 {
+				divisor = Neg(divisor)
+			}
+		}
+		if divisor == (Num{}) {
+			continue
+		}
+		expected, ok := bigInt(new(big.Int).Quo(dividend.bigInt(), divisor.bigInt()))
+		if !ok {
+			// MinInt128 / -1 overflows, which is covered by TestDiv64
+			continue
+		}
+		require.Equal(t, expected, Div(dividend, divisor), "%s / %s", dividend, divisor)
+		if divisor.hi == int64(divisor.lo)>>63 {
+			require.Equal(t, expected, Div64(dividend, int64(divisor.lo)), "%s / %s", dividend, divisor)
+		}
+	}
+}
+
+func BenchmarkDiv128by64(b *testing.B) {
+	dividend := MustParse("99999999999999999999999999999999999999")
+	divisor := Pow10Table[18]
+	for i := 0; i < b.N; i++ {
+		_ = Div(dividend, divisor)
+	}
+}
+
+func BenchmarkDiv128by128(b *testing.B) {
+	dividend := MustParse("99999999999999999999999999999999999999")
+	divisor := Pow10Table[20]
+	for i := 0; i < b.N; i++ {
+		_ = Div(dividend, divisor)
+	}
+}
+
 func TestPow10(t *testing.T) {
 	expected := FromInt64(1)
 	for _, v := range Pow10Table {
@@ -282,6 +371,65 @@ func TestPow10(t *testing.T) {
 	}
 }
 
+func TestPow10Bounds(t *testing.T) {
+	v, ok := Pow10(0)
+	require.True(t, ok)
+	require.Equal(t, FromInt64(1), v)
+	v, ok = Pow10(38)
+	require.True(t, ok)
+	require.Equal(t, "100000000000000000000000000000000000000", v.String())
+	_, ok = Pow10(39)
+	require.False(t, ok)
+	_, ok = Pow10(-1)
+	require.False(t, ok)
+}
+
+func TestMulPow10(t *testing.T) {
+	tests := []struct {
+		v     Num
+		n     int32
+		want  string
+		error string
+	}{
+		{v: FromInt64(42), n: 0, want: "42"},
+		{v: FromInt64(-42), n: 3, want: "-42000"},
+		{v: FromInt64(1), n: 38, want: "100000000000000000000000000000000000000"},
+		{v: FromInt64(-1), n: 38, want: "-100000000000000000000000000000000000000"},
+		{v: MaxInt128, n: 0, want: MaxInt128.String()},
+		{v: MinInt128, n: 0, want: MinInt128.String()},
+		{v: FromInt64(1), n: 39, error: "invalid exponent 39 for a power of 10, it must be between 0 and 38"},
+		{v: FromInt64(1), n: -1, error: "invalid exponent -1 for a power of 10, it must be between 0 and 38"},
+		{v: FromInt64(2), n: 38, error: "2 * 10^38 overflows an Int128"},
+		{v: FromInt64(-2), n: 38, error: "-2 * 10^38 overflows an Int128"},
+		{v: MaxInt64, n: 20, error: "9223372036854775807 * 10^20 overflows an Int128"},
+		{v: MinInt128, n: 1, error: "overflows an Int128"},
+		{v: MustParse("17014118346046923173168730371588410572"), n: 1, want: "170141183460469231731687303715884105720"},
+		{v: MustParse("17014118346046923173168730371588410573"), n: 1, error: "overflows an Int128"},
+	}
+	for _, tc := range tests {
+		t.Run(fmt.Sprintf("%s*10^%d", tc.v, tc.n), func(t *testing.T) {
+			v, err := MulPow10(tc.v, tc.n)
+			if tc.error != "" {
+				require.ErrorContains(t, err, tc.error)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, v.String())
+		})
+	}
+}
+
+func TestDivPow10(t *testing.T) {
+	require.Equal(t, FromInt64(42), DivPow10(FromInt64(42), 0))
+	require.Equal(t, FromInt64(4), DivPow10(FromInt64(42), 1))
+	require.Equal(t, FromInt64(-4), DivPow10(FromInt64(-42), 1), "rounds towards zero")
+	require.Equal(t, FromInt64(1), DivPow10(Pow10Table[38], 38))
+	require.Equal(t, FromInt64(1), DivPow10(MaxInt128, 38))
+	require.Equal(t, Num{}, DivPow10(MaxInt128, 39))
+	require.Equal(t, Num{}, DivPow10(MinInt128, 1000))
+	require.Equal(t, FromInt64(42), DivPow10(FromInt64(42), -1), "negative exponents don't scale")
+}
+
 func TestCompare(t *testing.T) {
 	tc := [][2]Num{
 		{FromInt64(0), FromInt64(1)},
@@ -347,9 +495,100 @@ func TestParse(t *testing.T) {
 	require.False(t, ok)
 }
 
+func TestParseBytes(t *testing.T) {
+	tests := []string{
+		MinInt128.String(),
+		MaxInt128.String(),
+		"-170141183460469231731687303715884105729",
+		"170141183460469231731687303715884105728",
+		strings.Repeat("9", 38),
+		"-" + strings.Repeat("9", 38),
+		"0000000000000000000000000000000000000000042",
+		"0",
+		"-0",
+		"+42",
+		"++42",
+		"-",
+		"+",
+		"",
+		" 42",
+		"42 ",
+		"4\x002",
+		"42\x00",
+		"4_2",
+		"1.5",
+		"1e3",
+		"0x2a",
+	}
+	for _, str := range tests {
+		expected, expectedOk := Parse(str)
+		actual, actualOk := ParseBytes([]byte(str))
+		require.Equal(t, expectedOk, actualOk, "%q", str)
+		require.Equal(t, expected, actual, "%q", str)
+	}
+
+	_, ok := ParseBytes([]byte("4\x002"))
+	require.False(t, ok)
+
+	b := []byte("-12345678901234567890123456789012345678")
+	allocs := testing.AllocsPerRun(100, func() {
+		_, _ = ParseBytes(b)
+	})
+	require.Zero(t, allocs)
+}
+
 func TestString(t *testing.T) {
 	require.Equal(t, "-170141183460469231731687303715884105728", MinInt128.String())
 	require.Equal(t, "170141183460469231731687303715884105727", MaxInt128.String())
+	require.Equal(t, "0", Num{}.String())
+	require.Equal(t, "-1", FromInt64(-1).String())
+	require.Equal(t, "18446744073709551615", FromUint64(math.MaxUint64).String())
+	require.Equal(t, "18446744073709551616", Add(FromUint64(math.MaxUint64), one).String())
+	require.Equal(t, "10000000000000000000", FromUint64(1e19).String())
+	require.Equal(t, "100000000000000000000000000000000000000", MustParse("100000000000000000000000000000000000000").String())
+	require.Equal(t, "-99999999999999999999999999999999999999", MustParse("-99999999999999999999999999999999999999").String())
+	for _, v := range Pow10Table {
+		require.Equal(t, v.bigInt().String(), v.String())
+		require.Equal(t, Neg(v).bigInt().String(), Neg(v).String())
+	}
+	for i := 0; i < 10_000; i++ {
+		v := randomNum()
+		if mrand.N(2) == 0 {
+			v = Neg(v)
+		}
+		require.Equal(t, v.bigInt().String(), v.String())
+	}
+}
+
+func TestAppendString(t *testing.T) {
+	b := AppendString([]byte("min="), MinInt128)
+	require.Equal(t, "min=-170141183460469231731687303715884105728", string(b))
+	b, err := MaxInt128.AppendText(b[:0])
+	require.NoError(t, err)
+	require.Equal(t, "170141183460469231731687303715884105727", string(b))
+
+	buf := make([]byte, 0, maxDecimalLen)
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = AppendString(buf[:0], MinInt128)
+	})
+	require.Zero(t, allocs)
+}
+
+func BenchmarkAppendString(b *testing.B) {
+	v := MustParse("-99999999999999999999999999999999999999")
+	buf := make([]byte, 0, maxDecimalLen)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf = AppendString(buf[:0], v)
+	}
+}
+
+func BenchmarkString(b *testing.B) {
+	v := MustParse("-99999999999999999999999999999999999999")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = v.String()
+	}
 }
 
 func TestByteWidth(t *testing.T) {
@@ -410,6 +649,7 @@ func TestIncreaseScaleBy(t *testing.T) {
 		{MaxInt128, 1, true},
 		{MinInt128, 1, true},
 		{MinInt128, 0, true},
+		{FromInt64(1), 39, true},
 	}
 	for _, tc := range tests {
 		tc := tc
@@ -435,6 +675,9 @@ func TestFitsInPrec(t *testing.T) {
 	n, err := FromString(snowflakeNumberTiny, 38, 37)
 	require.NoError(t, err)
 	require.True(t, n.FitsInPrecision(38), snowflakeNumberTiny)
+	require.True(t, MaxInt128.FitsInPrecision(39))
+	require.False(t, MinInt128.FitsInPrecision(39))
+	require.False(t, FromInt64(1).FitsInPrecision(-1))
 }
 
 func TestToBytes(t *testing.T) {
@@ -450,3 +693,210 @@ func TestToBytes(t *testing.T) {
 		require.Equal(t, input, cloned) // Make sure cloned isn't mutated
 	}
 }
+
+func TestAbsAndSign(t *testing.T) {
+	require.Equal(t, FromInt64(1), FromInt64(-1).Abs())
+	require.Equal(t, MaxInt128, Add(MinInt128, FromInt64(1)).Abs())
+	require.Equal(t, MinInt128, MinInt128.Abs())
+
+	v, ok := MinInt128.AbsCheck()
+	require.False(t, ok)
+	require.Equal(t, MinInt128, v)
+	v, ok = MinInt64.AbsCheck()
+	require.True(t, ok)
+	require.Equal(t, Neg(MinInt64), v)
+	v, ok = MaxInt128.AbsCheck()
+	require.True(t, ok)
+	require.Equal(t, MaxInt128, v)
+
+	require.Equal(t, -1, MinInt128.Sign())
+	require.Equal(t, -1, FromInt64(-1).Sign())
+	require.Equal(t, 0, FromInt64(0).Sign())
+	require.Equal(t, 1, FromInt64(1).Sign())
+	require.Equal(t, 1, FromUint64(math.MaxUint64).Sign())
+	require.Equal(t, 1, MaxInt128.Sign())
+}
+
+func TestMinMax(t *testing.T) {
+	require.Equal(t, MinInt128, Min(MinInt128, MaxInt128))
+	require.Equal(t, MinInt128, Min(MaxInt128, MinInt128))
+	require.Equal(t, MaxInt128, Max(MinInt128, MaxInt128))
+	require.Equal(t, MaxInt128, Max(MaxInt128, MinInt128))
+	require.Equal(t, FromInt64(-1), Min(FromInt64(-1), FromUint64(math.MaxUint64)))
+	require.Equal(t, FromUint64(math.MaxUint64), Max(FromInt64(-1), FromUint64(math.MaxUint64)))
+}
+
+func naiveMinMax(values []Num) (Num, Num) {
+	minimum, maximum := values[0], values[0]
+	for _, v := range values[1:] {
+		minimum = Min(minimum, v)
+		maximum = Max(maximum, v)
+	}
+	return minimum, maximum
+}
+
+func TestMinMaxBatch(t *testing.T) {
+	edges := []Num{
+		MinInt128,
+		Add(MinInt128, FromInt64(1)),
+		MinInt64,
+		FromInt64(-1),
+		FromInt64(0),
+		FromInt64(1),
+		MaxInt64,
+		FromUint64(math.MaxUint64),
+		Sub(MaxInt128, FromInt64(1)),
+		MaxInt128,
+	}
+	for _, a := range edges {
+		for _, b := range edges {
+			minimum, maximum := MinMax([]Num{a, b})
+			require.Equal(t, Min(a, b), minimum, "min(%s, %s)", a, b)
+			require.Equal(t, Max(a, b), maximum, "max(%s, %s)", a, b)
+		}
+	}
+	minimum, maximum := MinMax([]Num{FromInt64(42)})
+	require.Equal(t, FromInt64(42), minimum)
+	require.Equal(t, FromInt64(42), maximum)
+	require.Panics(t, func() { MinMax(nil) })
+}
+
+func TestMinMaxRandomized(t *testing.T) {
+	for i := 0; i < 1_000; i++ {
+		values := make([]Num, 1+mrand.N(100))
+		for j := range values {
+			values[j] = randomNum()
+			if mrand.N(2) == 0 {
+				values[j] = Neg(values[j])
+			}
+			if mrand.N(50) == 0 {
+				values[j] = []Num{MinInt128, MaxInt128}[mrand.N(2)]
+			}
+		}
+		expectedMin, expectedMax := naiveMinMax(values)
+		actualMin, actualMax := MinMax(values)
+		require.Equal(t, expectedMin, actualMin, "%v", values)
+		require.Equal(t, expectedMax, actualMax, "%v", values)
+	}
+}
+
+func benchmarkMinMaxValues() []Num {
+	values := make([]Num, 4096)
+	for i := range values {
+		values[i] = randomNum()
+		if mrand.N(2) == 0 {
+			values[i] = Neg(values[i])
+		}
+	}
+	return values
+}
+
+func BenchmarkMinMax(b *testing.B) {
+	values := benchmarkMinMaxValues()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = MinMax(values)
+	}
+}
+
+func BenchmarkMinMaxNaive(b *testing.B) {
+	values := benchmarkMinMaxValues()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = naiveMinMax(values)
+	}
+}
+
+func TestSort(t *testing.T) {
+	expected := []Num{
+		MinInt128,
+		Add(MinInt128, FromInt64(1)),
+		Sub(MinInt64, FromInt64(1)),
+		MinInt64,
+		MinInt32,
+		FromInt64(-1),
+		FromInt64(0),
+		FromInt64(1),
+		MaxInt32,
+		MaxInt64,
+		FromUint64(math.MaxUint64),
+		Add(FromUint64(math.MaxUint64), FromInt64(1)),
+		Sub(MaxInt128, FromInt64(1)),
+		MaxInt128,
+	}
+	for i := 0; i < 10; i++ {
+		actual := slices.Clone(expected)
+		mrand.Shuffle(len(actual), func(i, j int) {
+			actual[i], actual[j] = actual[j], actual[i]
+		})
+		slices.SortFunc(actual, Compare)
+		require.Equal(t, expected, actual)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	for _, expected := range [...]Num{
+		MinInt128,
+		MaxInt128,
+		MinInt64,
+		MaxInt64,
+		FromInt64(0),
+		FromInt64(-1),
+		FromUint64(math.MaxUint64),
+	} {
+		b, err := json.Marshal(expected)
+		require.NoError(t, err)
+		require.Equal(t, expected.String(), string(b))
+
+		var actual Num
+		require.NoError(t, json.Unmarshal(b, &actual))
+		require.Equal(t, expected, actual)
+
+		actual = Num{}
+		require.NoError(t, json.Unmarshal([]byte(`"`+expected.String()+`"`), &actual))
+		require.Equal(t, expected, actual)
+	}
+	var n Num
+	require.Error(t, json.Unmarshal([]byte(`"foo"`), &n))
+	require.Error(t, json.Unmarshal([]byte(`1.5`), &n))
+	require.Error(t, json.Unmarshal([]byte(`170141183460469231731687303715884105728`), &n))
+}
+
+func TestText(t *testing.T) {
+	type checkpoint struct {
+		Watermark Num            `json:"watermark"`
+		ByTopic   map[string]Num `json:"by_topic"`
+	}
+	expected := checkpoint{
+		Watermark: MinInt128,
+		ByTopic:   map[string]Num{"foo": MaxInt128, "bar": FromInt64(-1)},
+	}
+	b, err := json.Marshal(expected)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"watermark":`+MinInt128.String()+`,"by_topic":{"foo":`+MaxInt128.String()+`,"bar":-1}}`, string(b))
+	var actual checkpoint
+	require.NoError(t, json.Unmarshal(b, &actual))
+	require.Equal(t, expected, actual)
+
+	// Numbers are text when they are used as map keys.
+	keyed := map[Num]string{MaxInt128: "max", FromInt64(-5): "neg"}
+	b, err = json.Marshal(keyed)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"`+MaxInt128.String()+`":"max","-5":"neg"}`, string(b))
+	actualKeyed := map[Num]string{}
+	require.NoError(t, json.Unmarshal(b, &actualKeyed))
+	require.Equal(t, keyed, actualKeyed)
+
+	for _, n := range [...]Num{MinInt128, MaxInt128, FromInt64(0), FromUint64(math.MaxUint64)} {
+		text, err := n.MarshalText()
+		require.NoError(t, err)
+		require.Equal(t, n.String(), string(text))
+		var parsed Num
+		require.NoError(t, parsed.UnmarshalText(text))
+		require.Equal(t, n, parsed)
+	}
+
+	var n Num
+	require.EqualError(t, n.UnmarshalText([]byte("1.5")), `unable to parse "1.5" into Int128`)
+	require.EqualError(t, n.UnmarshalText([]byte("170141183460469231731687303715884105728")), "value 170141183460469231731687303715884105728 is out of range for Int128")
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package int128
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+)
+
+var (
+	_ sql.Scanner   = (*Num)(nil)
+	_ driver.Valuer = Num{}
+	_ sql.Scanner   = (*NullNum)(nil)
+	_ driver.Valuer = NullNum{}
+)
+
+// Scan implements sql.Scanner for base 10 formatted strings
+// and byte slices as well as int64 values.
+//
+// Scanning NULL is an error, use NullNum for nullable columns.
+func (i *Num) Scan(src any) error {
+	var n Num
+	switch v := src.(type) {
+	case nil:
+		return errors.New("unable to scan NULL into Int128")
+	case int64:
+		n = FromInt64(v)
+	case string:
+		var err error
+		if n, err = parseChecked(v); err != nil {
+			return err
+		}
+	case []byte:
+		var err error
+		if n, err = parseChecked(string(v)); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unable to scan %T into Int128", src)
+	}
+	*i = n
+	return nil
+}
+
+// Value implements driver.Valuer, the value is the base 10
+// formatted string so that the full range is preserved.
+func (i Num) Value() (driver.Value, error) {
+	return i.String(), nil
+}
+
+// NullNum is a Num that may be NULL, it's analogous to
+// sql.NullInt64.
+type NullNum struct {
+	Num   Num
+	Valid bool // Valid is true if Num is not NULL
+}
+
+// Scan implements sql.Scanner.
+func (n *NullNum) Scan(src any) error {
+	if src == nil {
+		n.Num, n.Valid = Num{}, false
+		return nil
+	}
+	if err := n.Num.Scan(src); err != nil {
+		return err
+	}
+	n.Valid = true
+	return nil
+}
+
+// Value implements driver.Valuer.
+func (n NullNum) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.Num.Value()
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package int128
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// rowDriver is a database/sql driver with a single row in a single column,
+// which is set by any statement with an argument and returned by any statement
+// without one, so that values make a full trip through database/sql.
+type rowDriver struct {
+	value driver.Value
+}
+
+func (d *rowDriver) Open(string) (driver.Conn, error) { return &rowConn{d}, nil }
+
+type connector struct{ d *rowDriver }
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return c.d.Open("") }
+func (c connector) Driver() driver.Driver                        { return c.d }
+
+type rowConn struct{ d *rowDriver }
+
+func (c *rowConn) Prepare(string) (driver.Stmt, error) { return &rowStmt{c.d}, nil }
+func (*rowConn) Close() error                          { return nil }
+func (*rowConn) Begin() (driver.Tx, error)             { return nil, driver.ErrSkip }
+
+type rowStmt struct{ d *rowDriver }
+
+func (*rowStmt) Close() error  { return nil }
+func (*rowStmt) NumInput() int { return -1 }
+
+func (s *rowStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.value = args[0]
+	return driver.RowsAffected(1), nil
+}
+
+func (s *rowStmt) Query([]driver.Value) (driver.Rows, error) {
+	return &rowRows{value: s.d.value}, nil
+}
+
+type rowRows struct {
+	value driver.Value
+	done  bool
+}
+
+func (*rowRows) Columns() []string { return []string{"v"} }
+func (*rowRows) Close() error      { return nil }
+
+func (r *rowRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.value
+	return nil
+}
+
+func TestSQL(t *testing.T) {
+	d := &rowDriver{}
+	db := sql.OpenDB(connector{d})
+	t.Cleanup(func() { _ = db.Close() })
+
+	ctx := context.Background()
+	for _, expected := range [...]Num{MinInt128, MaxInt128, MinInt64, FromInt64(0), FromInt64(-1), FromUint64(1 << 63)} {
+		_, err := db.ExecContext(ctx, "SET", expected)
+		require.NoError(t, err)
+		require.Equal(t, expected.String(), d.value)
+
+		var actual Num
+		require.NoError(t, db.QueryRowContext(ctx, "GET").Scan(&actual))
+		require.Equal(t, expected, actual)
+
+		var null NullNum
+		require.NoError(t, db.QueryRowContext(ctx, "GET").Scan(&null))
+		require.Equal(t, NullNum{Num: expected, Valid: true}, null)
+	}
+
+	_, err := db.ExecContext(ctx, "SET", NullNum{})
+	require.NoError(t, err)
+	require.Nil(t, d.value)
+	null := NullNum{Num: FromInt64(5), Valid: true}
+	require.NoError(t, db.QueryRowContext(ctx, "GET").Scan(&null))
+	require.Equal(t, NullNum{}, null)
+	var n Num
+	require.ErrorContains(t, db.QueryRowContext(ctx, "GET").Scan(&n), "unable to scan NULL into Int128")
+}
+
+func TestScan(t *testing.T) {
+	for _, tc := range []struct {
+		src      any
+		expected Num
+		err      string
+	}{
+		{src: int64(-42), expected: FromInt64(-42)},
+		{src: "170141183460469231731687303715884105727", expected: MaxInt128},
+		{src: []byte("-170141183460469231731687303715884105728"), expected: MinInt128},
+		{src: "170141183460469231731687303715884105728", err: "value 170141183460469231731687303715884105728 is out of range for Int128"},
+		{src: []byte("-170141183460469231731687303715884105729"), err: "value -170141183460469231731687303715884105729 is out of range for Int128"},
+		{src: "12.5", err: `unable to parse "12.5" into Int128`},
+		{src: 1.5, err: "unable to scan float64 into Int128"},
+		{src: nil, err: "unable to scan NULL into Int128"},
+	} {
+		n := FromInt64(7)
+		err := n.Scan(tc.src)
+		if tc.err != "" {
+			require.EqualError(t, err, tc.err)
+			require.Equal(t, FromInt64(7), n, "failed scans leave the value unchanged")
+			continue
+		}
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, n)
+	}
+
+	var null NullNum
+	require.EqualError(t, null.Scan("foo"), `unable to parse "foo" into Int128`)
+	require.False(t, null.Valid)
+}
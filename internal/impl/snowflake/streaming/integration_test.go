@@ -497,6 +497,83 @@ func TestTimestampCompat(t *testing.T) {
 	}, 3*time.Second, time.Second)
 }
 
+func TestGeospatialCompat(t *testing.T) {
+	ctx := context.Background()
+	restClient, streamClient := setup(t)
+	channelOpts := streaming.ChannelOptions{
+		Name:         t.Name(),
+		DatabaseName: envOr("SNOWFLAKE_DB", "BABY_DATABASE"),
+		SchemaName:   "PUBLIC",
+		TableName:    "TEST_GEOSPATIAL_TABLE",
+		BuildOptions: streaming.BuildOptions{Parallelism: 1, ChunkSize: 50_000},
+	}
+	_, err := restClient.RunSQL(ctx, streaming.RunSQLRequest{
+		Database: channelOpts.DatabaseName,
+		Schema:   channelOpts.SchemaName,
+		Statement: fmt.Sprintf(`
+      DROP TABLE IF EXISTS %s;
+      CREATE TABLE IF NOT EXISTS %s (
+        A NUMBER,
+        B GEOGRAPHY,
+        C GEOMETRY
+      );`, channelOpts.TableName, channelOpts.TableName),
+		Parameters: map[string]string{
+			"MULTI_STATEMENT_COUNT": "0",
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		err = streamClient.DropChannel(ctx, channelOpts)
+		if err != nil {
+			t.Log("unable to cleanup stream in SNOW:", err)
+		}
+	})
+	channel, err := streamClient.OpenChannel(ctx, channelOpts)
+	require.NoError(t, err)
+	_, err = channel.InsertRows(ctx, service.MessageBatch{
+		structuredMsg(map[string]any{
+			"a": 1,
+			"b": "POINT(-122.35 37.55)",
+			"c": "LINESTRING(1 2, 3 4)",
+		}),
+		structuredMsg(map[string]any{
+			"a": 2,
+			"b": map[string]any{"type": "Point", "coordinates": []any{-122.35, 37.55}},
+			"c": `{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,0]]]}`,
+		}),
+		structuredMsg(map[string]any{
+			"a": 3,
+			"b": map[string]any{
+				"type":       "Feature",
+				"geometry":   map[string]any{"type": "LineString", "coordinates": []any{[]any{1.0, 2.0}, []any{3.0, 4.0}}},
+				"properties": map[string]any{"name": "foo"},
+			},
+			"c": `{"type":"Feature","geometry":null,"properties":{}}`,
+		}),
+		structuredMsg(map[string]any{"a": 4}), // nulls
+	}, nil)
+	require.NoError(t, err)
+	require.EventuallyWithT(t, func(collect *assert.CollectT) {
+		// Always order by A so we get consistent ordering for our test
+		resp, err := restClient.RunSQL(ctx, streaming.RunSQLRequest{
+			Database:  channelOpts.DatabaseName,
+			Schema:    channelOpts.SchemaName,
+			Statement: fmt.Sprintf(`SELECT A, ST_ASWKT(B), ST_ASWKT(C) FROM %s ORDER BY A;`, channelOpts.TableName),
+		})
+		if !assert.NoError(collect, err) {
+			t.Logf("failed to scan table: %s", err)
+			return
+		}
+		assert.Equal(collect, "00000", resp.SQLState)
+		assert.Equal(collect, parseSnowflakeData([][]string{
+			{"1", "POINT(-122.35 37.55)", "LINESTRING(1 2,3 4)"},
+			{"2", "POINT(-122.35 37.55)", "POLYGON((0 0,1 0,1 1,0 0))"},
+			{"3", "LINESTRING(1 2,3 4)", ""},
+			{"4", "", ""},
+		}), parseSnowflakeData(resp.Data))
+	}, 3*time.Second, time.Second)
+}
+
 func TestChannelReopenFails(t *testing.T) {
 	ctx := context.Background()
 	restClient, streamClient := setup(t)
@@ -15,11 +15,17 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
 
 	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
 	"github.com/parquet-go/parquet-go/format"
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
 	"github.com/redpanda-data/benthos/v4/public/service"
 	"github.com/segmentio/encoding/thrift"
+	"golang.org/x/sync/errgroup"
 )
 
 // SchemaMode specifies how to handle schema mismatches when constructing parquet files
@@ -34,10 +40,24 @@ const (
 	SchemaModeStrictWithNulls
 )
 
+// ConversionErrorMode specifies how to handle values that can't be converted into the type of their column
+type ConversionErrorMode int
+
+const (
+	// ConversionErrorModeReject is a mode where values that fail conversion result in errors
+	ConversionErrorModeReject ConversionErrorMode = iota
+	// ConversionErrorModeNull is a mode where values of nullable columns that fail conversion are written as null
+	ConversionErrorModeNull
+)
+
+// ConversionErrorsMetadataKey is the metadata key of the errors of values that were written as null because they
+// failed conversion, which is an array of objects with the `column`, `value` and `error` of each value.
+const ConversionErrorsMetadataKey = "snowflake_conversion_errors"
+
 // messageToRow converts a message into columnar form using the provided name to index mapping.
 // We have to materialize the column into a row so that we can know if a column is null - the
-// msg can be sparse, but the row must not be sparse.
-func messageToRow(msg *service.Message, out []any, nameToPosition map[string]int, mode SchemaMode) error {
+// msg can be sparse, but the row must not be sparse. Keys mapped to a negative index are ignored.
+func messageToRow(msg *service.Message, out []any, nameToPosition map[string]int, mode SchemaMode, caseSensitive bool) error {
 	v, err := msg.AsStructured()
 	if err != nil {
 		return fmt.Errorf("error extracting object from message: %w", err)
@@ -46,17 +66,24 @@ func messageToRow(msg *service.Message, out []any, nameToPosition map[string]int
 	if !ok {
 		return fmt.Errorf("expected object, got: %T", v)
 	}
+	normalize, newMissingColumnError := normalizeColumnName, NewMissingColumnError
+	if caseSensitive {
+		normalize, newMissingColumnError = normalizeColumnNameCaseSensitive, NewCaseSensitiveMissingColumnError
+	}
 	var missingColumns []*MissingColumnError
 	for k, v := range row {
-		idx, ok := nameToPosition[normalizeColumnName(k)]
+		idx, ok := nameToPosition[normalize(k)]
 		if !ok {
 			if mode == SchemaModeStrict && v != nil {
-				missingColumns = append(missingColumns, NewMissingColumnError(msg, k, v))
+				missingColumns = append(missingColumns, newMissingColumnError(msg, k, v))
 			} else if mode == SchemaModeStrictWithNulls {
-				missingColumns = append(missingColumns, NewMissingColumnError(msg, k, v))
+				missingColumns = append(missingColumns, newMissingColumnError(msg, k, v))
 			}
 			continue
 		}
+		if idx < 0 {
+			continue
+		}
 		out[idx] = v
 	}
 	if len(missingColumns) > 0 {
@@ -69,63 +96,430 @@ func constructRowGroup(
 	batch service.MessageBatch,
 	schema *parquet.Schema,
 	transformers []*dataTransformer,
+	ignored map[string]struct{},
+	mode SchemaMode,
+	caseSensitive bool,
+	collectNDV bool,
+	columnParallelism int,
+) ([]parquet.Row, []*statsBuffer, error) {
+	b := &rowGroupBuffers{}
+	return b.constructRowGroup(batch, schema, transformers, ignored, mode, caseSensitive, collectNDV, columnParallelism)
+}
+
+// rowGroupPool reuses the buffers of the row groups of a channel, which are
+// garbage as soon as the file they're written to is encoded. The buffers hold
+// typed buffers for the columns of the channel, so a pool must not be shared by
+// channels with different columns. A nil pool doesn't reuse anything.
+type rowGroupPool struct {
+	pool sync.Pool
+}
+
+func (p *rowGroupPool) get() *rowGroupBuffers {
+	if p != nil {
+		if b, ok := p.pool.Get().(*rowGroupBuffers); ok {
+			return b
+		}
+	}
+	return &rowGroupBuffers{}
+}
+
+// put resets the buffers and returns them to the pool. The rows built with the
+// buffers must no longer be referenced, which is the case once they've been
+// written to a file.
+func (p *rowGroupPool) put(b *rowGroupBuffers) {
+	if p == nil {
+		return
+	}
+	b.Reset()
+	p.pool.Put(b)
+}
+
+// rowGroupBuffers holds the memory of a row group while it's built and
+// written.
+type rowGroupBuffers struct {
+	matrix  []parquet.Value
+	values  []any
+	rows    []parquet.Row
+	buffers []typedBuffer
+	stats   []*statsBuffer
+	// The position of each column by its name and the index of each column in
+	// the schema, which are only built again for other transformers.
+	nameToPosition map[string]int
+	columnIndexes  []int
+	transformers   []*dataTransformer
+}
+
+// Reset clears the buffers so that they don't keep the values of the messages
+// alive, their memory is kept for the next row group.
+func (b *rowGroupBuffers) Reset() {
+	clear(b.matrix)
+	b.matrix = b.matrix[:0]
+	clear(b.values)
+	b.values = b.values[:0]
+	clear(b.rows)
+	b.rows = b.rows[:0]
+	for _, buf := range b.buffers {
+		buf.Reset()
+	}
+	for _, s := range b.stats {
+		s.reset(s.ndv != nil)
+	}
+}
+
+// resize returns s with n zero elements, reusing its memory when it's large
+// enough. The elements past the length of s must be zero.
+func resize[T any](s []T, n int) []T {
+	if cap(s) < n {
+		return make([]T, n)
+	}
+	return s[:n]
+}
+
+func (b *rowGroupBuffers) constructRowGroup(
+	batch service.MessageBatch,
+	schema *parquet.Schema,
+	transformers []*dataTransformer,
+	ignored map[string]struct{},
 	mode SchemaMode,
+	caseSensitive bool,
+	collectNDV bool,
+	columnParallelism int,
 ) ([]parquet.Row, []*statsBuffer, error) {
 	// We write all of our data in a columnar fashion, but need to pivot that data so that we can feed it into
 	// out parquet library (which sadly will redo the pivot - maybe we need a lower level abstraction...).
 	// So create a massive matrix that we will write stuff in columnar form, but then we don't need to move any
-	// data to create rows of the data via an in-place transpose operation.
-	//
-	// TODO: Consider caching/pooling this matrix as I expect many are similarily sized.
+	// data to create rows of the data via an in-place transpose operation. The matrix is reused when the buffers
+	// come from a pool, as many are similarly sized.
 	rowWidth := len(schema.Fields())
-	matrix := make([]parquet.Value, len(batch)*rowWidth)
-	nameToPosition := make(map[string]int, rowWidth)
-	stats := make([]*statsBuffer, rowWidth)
-	buffers := make([]typedBuffer, rowWidth)
+	b.matrix = resize(b.matrix, len(batch)*rowWidth)
+	matrix := b.matrix
+	if b.nameToPosition == nil || !slices.Equal(b.transformers, transformers) {
+		b.nameToPosition = make(map[string]int, rowWidth+len(ignored))
+		for name := range ignored {
+			b.nameToPosition[name] = -1
+		}
+		b.columnIndexes = make([]int, len(transformers))
+		for idx, t := range transformers {
+			leaf, ok := schema.Lookup(t.name)
+			if !ok {
+				b.nameToPosition = nil
+				return nil, nil, fmt.Errorf("invariant failed: unable to find column %q", t.name)
+			}
+			b.nameToPosition[t.name] = idx
+			b.columnIndexes[idx] = leaf.ColumnIndex
+		}
+		b.transformers = transformers
+	}
+	nameToPosition := b.nameToPosition
+	if len(b.buffers) != rowWidth {
+		b.buffers = make([]typedBuffer, rowWidth)
+		b.stats = make([]*statsBuffer, rowWidth)
+	}
+	buffers := b.buffers
+	stats := b.stats
 	for idx, t := range transformers {
-		leaf, ok := schema.Lookup(t.name)
-		if !ok {
-			return nil, nil, fmt.Errorf("invariant failed: unable to find column %q", t.name)
+		if buffers[idx] == nil {
+			buffers[idx] = t.bufferFactory()
+		}
+		buffers[idx].Prepare(matrix, b.columnIndexes[idx], rowWidth)
+		if stats[idx] == nil {
+			stats[idx] = newStatsBuffer(collectNDV)
+		} else {
+			stats[idx].reset(collectNDV)
 		}
-		buffers[idx] = t.bufferFactory()
-		buffers[idx].Prepare(matrix, leaf.ColumnIndex, rowWidth)
-		stats[idx] = &statsBuffer{}
-		nameToPosition[t.name] = idx
 	}
 	// First we need to shred our record into columns, snowflake's data model
 	// is thankfully a flat list of columns, so no dremel style record shredding
 	// is needed
-	row := make([]any, rowWidth)
+	var err error
+	if columnParallelism > 1 {
+		b.values = resize(b.values, len(batch)*len(transformers))
+		err = convertColumns(batch, transformers, stats, buffers, b.values, nameToPosition, mode, caseSensitive, columnParallelism)
+	} else {
+		err = convertRows(batch, transformers, stats, buffers, nameToPosition, mode, caseSensitive)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	// Now all our values have been written to each buffer - here is where we do our matrix
+	// transpose mentioned above
+	b.rows = resize(b.rows, len(batch))
+	rows := b.rows
+	for i := range rows {
+		rowStart := i * rowWidth
+		rows[i] = matrix[rowStart : rowStart+rowWidth]
+	}
+	return rows, stats, nil
+}
+
+// convertRows converts the batch into the buffers one row at a time.
+func convertRows(
+	batch service.MessageBatch,
+	transformers []*dataTransformer,
+	stats []*statsBuffer,
+	buffers []typedBuffer,
+	nameToPosition map[string]int,
+	mode SchemaMode,
+	caseSensitive bool,
+) error {
+	nullOnConversionError := anyNullOnConversionError(transformers)
+	row := make([]any, len(transformers))
 	for _, msg := range batch {
-		err := messageToRow(msg, row, nameToPosition, mode)
+		err := messageToRow(msg, row, nameToPosition, mode, caseSensitive)
 		if err != nil {
-			return nil, nil, err
+			return err
 		}
+		var conversionErrors []any
+		rowMsg := rowMessage{msg: msg}
 		for i, v := range row {
-			t := transformers[i]
-			s := stats[i]
-			b := buffers[i]
-			err = t.converter.ValidateAndConvert(s, v, b)
+			conversionError, err := convertValue(transformers[i], stats[i], buffers[i], &rowMsg, v)
 			if err != nil {
-				if errors.Is(err, errNullValue) {
-					return nil, nil, &NonNullColumnError{msg, t.column.Name}
-				}
-				// There is not special typed error for a validation error, there really isn't
-				// anything we can do about it.
-				return nil, nil, fmt.Errorf("invalid data for column %s: %w", t.name, err)
+				return err
+			}
+			if conversionError != nil {
+				conversionErrors = append(conversionErrors, conversionError)
 			}
 			// reset the column as nil for the next row
 			row[i] = nil
 		}
+		setConversionErrors(msg, conversionErrors, nullOnConversionError)
 	}
-	// Now all our values have been written to each buffer - here is where we do our matrix
-	// transpose mentioned above
-	rows := make([]parquet.Row, len(batch))
-	for i := range rows {
-		rowStart := i * rowWidth
-		rows[i] = matrix[rowStart : rowStart+rowWidth]
+	return nil
+}
+
+// convertColumns converts the batch into the buffers with up to parallelism
+// goroutines. The messages are shredded into rows in parallel first, then each
+// column is converted independently of the others. The buffers, stats,
+// metadata and the returned error are the same as the ones of convertRows,
+// the error of the first row that fails is returned and ties are broken by the
+// column order. The rows are shredded into values, which must hold a nil value
+// for each column of each row.
+func convertColumns(
+	batch service.MessageBatch,
+	transformers []*dataTransformer,
+	stats []*statsBuffer,
+	buffers []typedBuffer,
+	values []any,
+	nameToPosition map[string]int,
+	mode SchemaMode,
+	caseSensitive bool,
+	parallelism int,
+) error {
+	rowWidth := len(transformers)
+
+	// Each chunk of rows records the first row that can't be shredded, the
+	// rows after the first one of the batch are never converted.
+	type failure struct {
+		row int
+		err error
 	}
-	return rows, stats, nil
+	chunkSize := (len(batch) + parallelism - 1) / parallelism
+	shredFailures := make([]failure, 0, parallelism)
+	for start := 0; start < len(batch); start += chunkSize {
+		shredFailures = append(shredFailures, failure{row: len(batch)})
+	}
+	wg := &errgroup.Group{}
+	for i := range shredFailures {
+		wg.Go(func() error {
+			start := i * chunkSize
+			end := min(start+chunkSize, len(batch))
+			for row := start; row < end; row++ {
+				out := values[row*rowWidth : (row+1)*rowWidth]
+				if err := messageToRow(batch[row], out, nameToPosition, mode, caseSensitive); err != nil {
+					shredFailures[i] = failure{row, err}
+					break
+				}
+			}
+			return nil
+		})
+	}
+	_ = wg.Wait()
+	first := failure{row: len(batch)}
+	for _, f := range shredFailures {
+		if f.row < first.row {
+			first = f
+		}
+	}
+	rowCount := first.row
+
+	columnFailures := make([]failure, rowWidth)
+	columnConversionErrors := make([][]any, rowWidth)
+	wg = &errgroup.Group{}
+	wg.SetLimit(parallelism)
+	for col, t := range transformers {
+		wg.Go(func() error {
+			columnFailures[col] = failure{row: rowCount}
+			for row := range rowCount {
+				// The columns are converted concurrently, so each of them
+				// copies the message of a row to transform its values.
+				rowMsg := rowMessage{msg: batch[row]}
+				conversionError, err := convertValue(t, stats[col], buffers[col], &rowMsg, values[row*rowWidth+col])
+				if err != nil {
+					columnFailures[col] = failure{row, err}
+					break
+				}
+				if conversionError != nil {
+					if columnConversionErrors[col] == nil {
+						columnConversionErrors[col] = make([]any, rowCount)
+					}
+					columnConversionErrors[col][row] = conversionError
+				}
+			}
+			return nil
+		})
+	}
+	_ = wg.Wait()
+	for _, f := range columnFailures {
+		if f.row < first.row {
+			first = f
+		}
+	}
+
+	// Like convertRows, the metadata of the rows before the failed one is
+	// updated even when the batch fails.
+	nullOnConversionError := anyNullOnConversionError(transformers)
+	for row := range first.row {
+		var conversionErrors []any
+		for _, errs := range columnConversionErrors {
+			if errs != nil && errs[row] != nil {
+				conversionErrors = append(conversionErrors, errs[row])
+			}
+		}
+		setConversionErrors(batch[row], conversionErrors, nullOnConversionError)
+	}
+	return first.err
+}
+
+func anyNullOnConversionError(transformers []*dataTransformer) bool {
+	for _, t := range transformers {
+		if t.nullOnConversionError {
+			return true
+		}
+	}
+	return false
+}
+
+// convertValue writes v into the buffer of the column of t, it returns the
+// conversion error that is added to the metadata of the message of the row
+// when the value failed conversion and was written as null instead.
+func convertValue(t *dataTransformer, s *statsBuffer, b typedBuffer, row *rowMessage, v any) (any, error) {
+	var conversionError any
+	if t.transform != nil && v != nil {
+		var err error
+		v, err = transformValue(t.transform, row.transformInput(), v)
+		if err != nil {
+			if !t.nullOnConversionError {
+				return nil, fmt.Errorf("unable to transform column %s: %w", quoteColumnNameCaseSensitive(t.name), err)
+			}
+			// The raw value is left out, as transforms are meant to
+			// keep it from being written anywhere.
+			s.conversionErrors++
+			conversionError = map[string]any{
+				"column": t.column.Name,
+				"error":  err.Error(),
+			}
+			return conversionError, t.converter.ValidateAndConvert(s, nil, b)
+		}
+	}
+	err := t.converter.ValidateAndConvert(s, v, b)
+	if err != nil && t.nullOnConversionError && !errors.Is(err, errNullValue) {
+		conversionError = map[string]any{
+			"column": t.column.Name,
+			"value":  v,
+			"error":  err.Error(),
+		}
+		s.conversionErrors++
+		// Converters never write anything when they fail, so this
+		// accounts for the value exactly like a null input.
+		err = t.converter.ValidateAndConvert(s, nil, b)
+	}
+	if err != nil {
+		if errors.Is(err, errNullValue) {
+			return nil, &NonNullColumnError{row.msg, t.column.Name}
+		}
+		// There is not special typed error for a validation error, there really isn't
+		// anything we can do about it.
+		return nil, fmt.Errorf("invalid data for column %s: %w", quoteColumnNameCaseSensitive(t.name), err)
+	}
+	return conversionError, nil
+}
+
+// rowMessage is the message of a row that is converted, of which a single
+// copy is made for the transforms of the row's columns.
+type rowMessage struct {
+	msg   *service.Message
+	input *service.Message
+}
+
+// transformInput returns the copy of the message that the transforms are
+// executed against.
+func (r *rowMessage) transformInput() *service.Message {
+	if r.input == nil {
+		r.input = r.msg.Copy()
+	}
+	return r.input
+}
+
+// transformValue executes the transform of a column with the raw value v as
+// its input and the metadata of the input message, a deleted root results in
+// null. Byte results are returned as strings.
+func transformValue(transform *bloblang.Executor, input *service.Message, v any) (any, error) {
+	input.SetStructuredMut(v)
+	out, err := input.BloblangQuery(transform)
+	if err != nil || out == nil {
+		return nil, err
+	}
+	if out.HasStructured() {
+		return out.AsStructured()
+	}
+	// Mappings that result in strings, bytes or null set the raw bytes of the
+	// message, which is the only way to execute them with both the value and
+	// the metadata, so null can't be told apart from the string "null", which
+	// is written as null too.
+	b, err := out.AsBytes()
+	if err != nil || string(b) == "null" {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func setConversionErrors(msg *service.Message, conversionErrors []any, nullOnConversionError bool) {
+	if len(conversionErrors) > 0 {
+		msg.MetaSetMut(ConversionErrorsMetadataKey, conversionErrors)
+	} else if nullOnConversionError {
+		// The batch may be converted more than once, so clear errors
+		// from a previous attempt that no longer apply.
+		msg.MetaDelete(ConversionErrorsMetadataKey)
+	}
+}
+
+// ColumnEncoding overrides how the values of a column are encoded in the files
+// written to Snowflake.
+type ColumnEncoding struct {
+	// The codec which compresses the column chunks instead of zstd, when set.
+	Compression compress.Codec
+	// Dictionary encode the values instead of using plain encoding, which
+	// makes columns with few distinct values much smaller.
+	Dictionary bool
+}
+
+// CompressionCodecs are the names of the compression codecs which can be
+// chosen for columns, which are the ones that the Snowflake Ingest SDK writes
+// as well as no compression.
+var CompressionCodecs = []string{"none", "zstd", "gzip"}
+
+// ParseCompressionCodec returns the compression codec with the given name,
+// which must be one of CompressionCodecs.
+func ParseCompressionCodec(name string) (compress.Codec, error) {
+	switch name {
+	case "none":
+		return &parquet.Uncompressed, nil
+	case "zstd":
+		return &parquet.Zstd, nil
+	case "gzip":
+		return &parquet.Gzip, nil
+	}
+	return nil, fmt.Errorf("unsupported compression codec %q, must be one of: %s", name, strings.Join(CompressionCodecs, ", "))
 }
 
 type parquetWriter struct {
@@ -149,6 +543,9 @@ func newParquetWriter(rpcnVersion string, schema *parquet.Schema) *parquetWriter
 
 // WriteFile writes a new parquet file using the rows and metadata.
 //
+// The returned file is backed by a buffer that is reused by the next call, so it
+// must no longer be referenced once the next file is written.
+//
 // NOTE: metadata is sticky - if you want the next file to remove metadata you need to set the value to the empty string
 // to actually remove it. In the usage of this method in this package, the metadata keys are all always the same.
 func (w *parquetWriter) WriteFile(rows []parquet.Row, metadata map[string]string) (out []byte, err error) {
@@ -171,26 +568,57 @@ func (w *parquetWriter) WriteFile(rows []parquet.Row, metadata map[string]string
 	return
 }
 
+// parquetFileSummary is the part of the metadata of a parquet file that is
+// reported when the file is registered, it's decoded without the metadata of
+// the columns which makes up most of the footer.
+type parquetFileSummary struct {
+	NumRows   int64                    `thrift:"3,required"`
+	RowGroups []parquetRowGroupSummary `thrift:"4,required"`
+}
+
+type parquetRowGroupSummary struct {
+	TotalByteSize int64 `thrift:"2,required"`
+}
+
+func readParquetSummary(parquetFile []byte) (summary parquetFileSummary, err error) {
+	footer, err := parquetFooter(parquetFile)
+	if err != nil {
+		return summary, err
+	}
+	if err := thrift.Unmarshal(new(thrift.CompactProtocol), footer, &summary); err != nil {
+		return summary, fmt.Errorf("unable to extract parquet metadata: %w", err)
+	}
+	return summary, nil
+}
+
 func readParquetMetadata(parquetFile []byte) (metadata format.FileMetaData, err error) {
+	footer, err := parquetFooter(parquetFile)
+	if err != nil {
+		return metadata, err
+	}
+	if err := thrift.Unmarshal(new(thrift.CompactProtocol), footer, &metadata); err != nil {
+		return metadata, fmt.Errorf("unable to extract parquet metadata: %w", err)
+	}
+	return
+}
+
+// parquetFooter returns the encoded metadata at the end of a parquet file.
+func parquetFooter(parquetFile []byte) ([]byte, error) {
 	if len(parquetFile) < 8 {
-		return format.FileMetaData{}, fmt.Errorf("too small of parquet file: %d", len(parquetFile))
+		return nil, fmt.Errorf("too small of parquet file: %d", len(parquetFile))
 	}
 	trailingBytes := parquetFile[len(parquetFile)-8:]
 	if string(trailingBytes[4:]) != "PAR1" {
-		return metadata, fmt.Errorf("missing magic bytes, got: %q", trailingBytes[4:])
+		return nil, fmt.Errorf("missing magic bytes, got: %q", trailingBytes[4:])
 	}
 	footerSize := int(binary.LittleEndian.Uint32(trailingBytes))
 	if len(parquetFile) < footerSize+8 {
-		return metadata, fmt.Errorf("too small of parquet file: %d, footer size: %d", len(parquetFile), footerSize)
-	}
-	footerBytes := parquetFile[len(parquetFile)-(footerSize+8) : len(parquetFile)-8]
-	if err := thrift.Unmarshal(new(thrift.CompactProtocol), footerBytes, &metadata); err != nil {
-		return metadata, fmt.Errorf("unable to extract parquet metadata: %w", err)
+		return nil, fmt.Errorf("too small of parquet file: %d, footer size: %d", len(parquetFile), footerSize)
 	}
-	return
+	return parquetFile[len(parquetFile)-(footerSize+8) : len(parquetFile)-8], nil
 }
 
-func totalUncompressedSize(metadata format.FileMetaData) int32 {
+func totalUncompressedSize(metadata parquetFileSummary) int32 {
 	var size int64
 	for _, rowGroup := range metadata.RowGroups {
 		size += rowGroup.TotalByteSize
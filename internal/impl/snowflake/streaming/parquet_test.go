@@ -12,11 +12,18 @@ package streaming
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"io"
+	"math/rand/v2"
 	"testing"
 
 	"github.com/aws/smithy-go/ptr"
 	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
 	"github.com/redpanda-data/benthos/v4/public/service"
 	"github.com/stretchr/testify/require"
 
@@ -61,7 +68,11 @@ func TestWriteParquet(t *testing.T) {
 		batch,
 		schema,
 		transformers,
+		nil,
 		SchemaModeIgnoreExtra,
+		false,
+		false,
+		1,
 	)
 	require.NoError(t, err)
 	w := newParquetWriter("latest", schema)
@@ -89,6 +100,44 @@ func TestWriteParquet(t *testing.T) {
 	}
 }
 
+func TestWriteParquetNumberTypeError(t *testing.T) {
+	inputDataSchema := parquet.Group{
+		"A": parquet.Decimal(0, 18, parquet.Int64Type),
+	}
+	transformers := []*dataTransformer{
+		{
+			name: "A",
+			converter: numberConverter{
+				nullable:  true,
+				scale:     0,
+				precision: 18,
+			},
+			column: &columnMetadata{
+				Name:         "A",
+				Ordinal:      1,
+				Type:         "NUMBER(18,0)",
+				LogicalType:  "fixed",
+				PhysicalType: "SB8",
+				Precision:    ptr.Int32(18),
+				Scale:        ptr.Int32(0),
+				Nullable:     true,
+			},
+			bufferFactory: int64TypedBufferFactory,
+		},
+	}
+	_, _, err := constructRowGroup(
+		service.MessageBatch{msg(`{"a":true}`)},
+		parquet.NewSchema("bdec", inputDataSchema),
+		transformers,
+		nil,
+		SchemaModeIgnoreExtra,
+		false,
+		false,
+		1,
+	)
+	require.ErrorContains(t, err, `invalid data for column "A": cannot convert value of type bool to NUMBER, use ::int or map via bloblang`)
+}
+
 func readGeneric(r io.ReaderAt, size int64, schema *parquet.Schema) (rows []map[string]any, err error) {
 	config, err := parquet.NewReaderConfig(schema)
 	if err != nil {
@@ -110,3 +159,898 @@ func readGeneric(r io.ReaderAt, size int64, schema *parquet.Schema) (rows []map[
 	reader.Close()
 	return rows[:n], err
 }
+
+func TestCaseSensitiveColumns(t *testing.T) {
+	columns := []columnMetadata{
+		{
+			Name:         "FOO",
+			Ordinal:      1,
+			Type:         "NUMBER(18,0)",
+			LogicalType:  "fixed",
+			PhysicalType: "SB8",
+			Precision:    ptr.Int32(18),
+			Scale:        ptr.Int32(0),
+			Nullable:     true,
+		},
+		{
+			Name:         `"foo"`,
+			Ordinal:      2,
+			Type:         "NUMBER(18,0)",
+			LogicalType:  "fixed",
+			PhysicalType: "SB8",
+			Precision:    ptr.Int32(18),
+			Scale:        ptr.Int32(0),
+			Nullable:     true,
+		},
+		{
+			Name:         `"userId"`,
+			Ordinal:      3,
+			Type:         "NUMBER(18,0)",
+			LogicalType:  "fixed",
+			PhysicalType: "SB8",
+			Precision:    ptr.Int32(18),
+			Scale:        ptr.Int32(0),
+			Nullable:     false,
+		},
+	}
+
+	_, _, _, err := constructParquetSchema(columns, ChannelOptions{})
+	require.ErrorContains(t, err, `columns FOO and "foo" have the same name when matched case-insensitively`)
+
+	schema, transformers, _, err := constructParquetSchema(columns, ChannelOptions{CaseSensitiveColumns: true})
+	require.NoError(t, err)
+
+	rows, _, err := constructRowGroup(
+		service.MessageBatch{msg(`{"FOO":1,"foo":2,"userId":3}`), msg(`{"foo":4,"\"FOO\"":5,"userId":6}`)},
+		schema,
+		transformers,
+		nil,
+		SchemaModeIgnoreExtra,
+		true,
+		false,
+		1,
+	)
+	require.NoError(t, err)
+	b, err := newParquetWriter("latest", schema).WriteFile(rows, nil)
+	require.NoError(t, err)
+	actual, err := readGeneric(bytes.NewReader(b), int64(len(b)), schema)
+	require.NoError(t, err)
+	require.Equal(t, []map[string]any{
+		{"FOO": int64(1), "foo": int64(2), "userId": int64(3)},
+		{"FOO": int64(5), "foo": int64(4), "userId": int64(6)},
+	}, actual)
+
+	_, _, err = constructRowGroup(
+		service.MessageBatch{msg(`{"FOO":1,"USERID":3}`)},
+		schema,
+		transformers,
+		nil,
+		SchemaModeStrict,
+		true,
+		false,
+		1,
+	)
+	var mismatch *BatchSchemaMismatchError[*MissingColumnError]
+	require.ErrorAs(t, err, &mismatch)
+	require.Len(t, mismatch.Errors, 1)
+	require.Equal(t, `"USERID"`, mismatch.Errors[0].ColumnName())
+
+	_, _, err = constructRowGroup(
+		service.MessageBatch{msg(`{"FOO":1,"userid":3}`)},
+		schema,
+		transformers,
+		nil,
+		SchemaModeStrict,
+		true,
+		false,
+		1,
+	)
+	require.ErrorAs(t, err, &mismatch)
+	require.Equal(t, `"userid"`, mismatch.Errors[0].ColumnName())
+
+	_, _, err = constructRowGroup(
+		service.MessageBatch{msg(`{"FOO":1,"userId":"bar"}`)},
+		schema,
+		transformers,
+		nil,
+		SchemaModeIgnoreExtra,
+		true,
+		false,
+		1,
+	)
+	require.ErrorContains(t, err, `invalid data for column "userId"`)
+}
+
+func TestConversionErrorModeNull(t *testing.T) {
+	columns := []columnMetadata{
+		{
+			Name:         "A",
+			Ordinal:      1,
+			Type:         "NUMBER(18,0)",
+			LogicalType:  "fixed",
+			PhysicalType: "SB8",
+			Precision:    ptr.Int32(18),
+			Scale:        ptr.Int32(0),
+			Nullable:     true,
+		},
+		{
+			Name:         "B",
+			Ordinal:      2,
+			Type:         "BOOLEAN",
+			LogicalType:  "boolean",
+			PhysicalType: "SB1",
+			Nullable:     true,
+		},
+		{
+			Name:         "C",
+			Ordinal:      3,
+			Type:         "NUMBER(18,0)",
+			LogicalType:  "fixed",
+			PhysicalType: "SB8",
+			Precision:    ptr.Int32(18),
+			Scale:        ptr.Int32(0),
+			Nullable:     false,
+		},
+	}
+	schema, transformers, _, err := constructParquetSchema(columns, ChannelOptions{
+		ConversionErrorMode:        ConversionErrorModeNull,
+		ColumnConversionErrorModes: map[string]ConversionErrorMode{"b": ConversionErrorModeReject},
+	})
+	require.NoError(t, err)
+	require.True(t, transformers[0].nullOnConversionError)
+	require.False(t, transformers[1].nullOnConversionError)
+	require.False(t, transformers[2].nullOnConversionError, "columns that are not nullable always reject")
+
+	build := func(batch service.MessageBatch) ([]map[string]any, []*statsBuffer) {
+		t.Helper()
+		rows, stats, err := constructRowGroup(batch, schema, transformers, nil, SchemaModeIgnoreExtra, false, false, 1)
+		require.NoError(t, err)
+		b, err := newParquetWriter("latest", schema).WriteFile(rows, nil)
+		require.NoError(t, err)
+		actual, err := readGeneric(bytes.NewReader(b), int64(len(b)), schema)
+		require.NoError(t, err)
+		return actual, stats
+	}
+
+	invalid := service.MessageBatch{msg(`{"a":"foo","b":true,"c":1}`), msg(`{"a":2,"b":false,"c":3}`)}
+	null := service.MessageBatch{msg(`{"a":null,"b":true,"c":1}`), msg(`{"a":2,"b":false,"c":3}`)}
+	invalidRows, invalidStats := build(invalid)
+	nullRows, nullStats := build(null)
+	require.Equal(t, nullRows, invalidRows)
+	require.Equal(t, int64(1), invalidStats[0].conversionErrors)
+	invalidStats[0].conversionErrors = 0
+	require.Equal(t, nullStats, invalidStats)
+	require.Equal(t, int64(1), nullStats[0].nullCount)
+
+	errs, ok := invalid[0].MetaGetMut(ConversionErrorsMetadataKey)
+	require.True(t, ok)
+	require.Equal(t, []any{
+		map[string]any{
+			"column": "A",
+			"value":  "foo",
+			"error":  `invalid number "foo"`,
+		},
+	}, errs)
+	for _, m := range append(invalid[1:], null...) {
+		_, ok := m.MetaGetMut(ConversionErrorsMetadataKey)
+		require.False(t, ok)
+	}
+
+	// Errors from a previous conversion of the same message are cleared.
+	retried := service.MessageBatch{msg(`{"a":1,"b":true,"c":1}`)}
+	retried[0].MetaSetMut(ConversionErrorsMetadataKey, []any{"stale"})
+	build(retried)
+	_, ok = retried[0].MetaGetMut(ConversionErrorsMetadataKey)
+	require.False(t, ok)
+
+	_, _, err = constructRowGroup(
+		service.MessageBatch{msg(`{"a":1,"b":"maybe","c":1}`)},
+		schema,
+		transformers,
+		nil,
+		SchemaModeIgnoreExtra,
+		false,
+		false,
+		1,
+	)
+	require.ErrorContains(t, err, `invalid data for column "B"`)
+
+	_, _, err = constructRowGroup(
+		service.MessageBatch{msg(`{"a":1,"b":true,"c":"foo"}`)},
+		schema,
+		transformers,
+		nil,
+		SchemaModeIgnoreExtra,
+		false,
+		false,
+		1,
+	)
+	require.ErrorContains(t, err, `invalid data for column "C"`)
+
+	_, _, err = constructRowGroup(
+		service.MessageBatch{msg(`{"a":1,"b":true}`)},
+		schema,
+		transformers,
+		nil,
+		SchemaModeIgnoreExtra,
+		false,
+		false,
+		1,
+	)
+	var nonNullErr *NonNullColumnError
+	require.ErrorAs(t, err, &nonNullErr)
+}
+
+func mustParseMapping(t *testing.T, mapping string) *bloblang.Executor {
+	t.Helper()
+	exec, err := bloblang.Parse(mapping)
+	require.NoError(t, err)
+	return exec
+}
+
+func TestColumnTransforms(t *testing.T) {
+	columns := []columnMetadata{
+		{
+			Name:         "EMAIL",
+			Ordinal:      1,
+			Type:         "VARCHAR(64)",
+			LogicalType:  "text",
+			PhysicalType: "LOB",
+			ByteLength:   ptr.Int32(64),
+			Nullable:     true,
+		},
+		{
+			Name:         "SALARY",
+			Ordinal:      2,
+			Type:         "NUMBER(18,0)",
+			LogicalType:  "fixed",
+			PhysicalType: "SB8",
+			Precision:    ptr.Int32(18),
+			Scale:        ptr.Int32(0),
+			Nullable:     true,
+		},
+	}
+	opts := ChannelOptions{
+		TableName: "MY_TABLE",
+		ColumnTransforms: map[string]*bloblang.Executor{
+			"email":  mustParseMapping(t, `root = this.hash("sha256").encode("hex")`),
+			"salary": mustParseMapping(t, `root = if @redact == "true" { null } else { this }`),
+		},
+	}
+	schema, transformers, _, err := constructParquetSchema(columns, opts)
+	require.NoError(t, err)
+
+	hashed := func(s string) string {
+		h := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(h[:])
+	}
+	for _, parallelism := range []int{1, 2} {
+		batch := service.MessageBatch{
+			msg(`{"email":"alice@example.com","salary":1000}`),
+			msg(`{"email":"bob@example.com","salary":2000}`),
+			msg(`{"email":null,"salary":3000}`),
+		}
+		batch[1].MetaSetMut("redact", "true")
+		rows, stats, err := constructRowGroup(batch, schema, transformers, nil, SchemaModeIgnoreExtra, false, false, parallelism)
+		require.NoError(t, err)
+		b, err := newParquetWriter("latest", schema).WriteFile(rows, nil)
+		require.NoError(t, err)
+		actual, err := readGeneric(bytes.NewReader(b), int64(len(b)), schema)
+		require.NoError(t, err)
+		require.Equal(t, []map[string]any{
+			{"EMAIL": hashed("alice@example.com"), "SALARY": int64(1000)},
+			{"EMAIL": hashed("bob@example.com"), "SALARY": nil},
+			{"EMAIL": nil, "SALARY": int64(3000)},
+		}, actual)
+
+		// The stats only ever see the transformed values.
+		minEmail, maxEmail := hashed("alice@example.com"), hashed("bob@example.com")
+		if minEmail > maxEmail {
+			minEmail, maxEmail = maxEmail, minEmail
+		}
+		require.Equal(t, minEmail, string(stats[0].minStrVal))
+		require.Equal(t, maxEmail, string(stats[0].maxStrVal))
+		require.Equal(t, int64(1), stats[0].nullCount)
+		require.Equal(t, int128.FromInt64(1000), stats[1].minIntVal)
+		require.Equal(t, int128.FromInt64(3000), stats[1].maxIntVal)
+		require.Equal(t, int64(1), stats[1].nullCount)
+	}
+
+	for mapping, expected := range map[string]any{
+		`root = deleted()`:     nil,
+		`root = null`:          nil,
+		`root = "null"`:        nil,
+		`root = "foo".bytes()`: "foo",
+		`root = this + 1`:      int64(2),
+		`root = content()`:     "1",
+		`meta foo = "bar"`:     int64(1),
+		`root = @.keys()`:      []any{"redact"},
+		`root = [this, @]`:     []any{int64(1), map[string]any{"redact": "true"}},
+		`root = this.type()`:   "number",
+	} {
+		m := msg(`{}`)
+		m.MetaSetMut("redact", "true")
+		v, err := transformValue(mustParseMapping(t, mapping), m.Copy(), int64(1))
+		require.NoError(t, err, mapping)
+		require.Equal(t, expected, v, mapping)
+	}
+
+	failing := map[string]*bloblang.Executor{"salary": mustParseMapping(t, `root = this.number() * 2`)}
+	batch := service.MessageBatch{msg(`{"email":"alice@example.com","salary":"secret"}`)}
+	schema, transformers, _, err = constructParquetSchema(columns, ChannelOptions{ColumnTransforms: failing})
+	require.NoError(t, err)
+	_, _, err = constructRowGroup(batch, schema, transformers, nil, SchemaModeIgnoreExtra, false, false, 1)
+	require.ErrorContains(t, err, `unable to transform column "SALARY"`)
+
+	// Failed transforms follow the conversion error mode without recording the raw value.
+	schema, transformers, _, err = constructParquetSchema(columns, ChannelOptions{
+		ConversionErrorMode: ConversionErrorModeNull,
+		ColumnTransforms:    failing,
+	})
+	require.NoError(t, err)
+	rows, stats, err := constructRowGroup(batch, schema, transformers, nil, SchemaModeIgnoreExtra, false, false, 1)
+	require.NoError(t, err)
+	require.True(t, rows[0][1].IsNull())
+	require.Equal(t, int64(1), stats[1].conversionErrors)
+	errs, ok := batch[0].MetaGetMut(ConversionErrorsMetadataKey)
+	require.True(t, ok)
+	require.Len(t, errs, 1)
+	require.Equal(t, "SALARY", errs.([]any)[0].(map[string]any)["column"])
+	require.NotContains(t, errs.([]any)[0], "value")
+
+	_, _, _, err = constructParquetSchema(columns, ChannelOptions{
+		TableName:        "MY_TABLE",
+		ColumnTransforms: map[string]*bloblang.Executor{"ssn": mustParseMapping(t, `root = null`)},
+	})
+	require.EqualError(t, err, `unknown column "ssn" in column transforms for table MY_TABLE`)
+
+	_, _, _, err = constructParquetSchema(columns, ChannelOptions{
+		TableName:        "MY_TABLE",
+		IgnoreColumns:    []string{"email"},
+		ColumnTransforms: map[string]*bloblang.Executor{"email": mustParseMapping(t, `root = null`)},
+	})
+	require.EqualError(t, err, `unknown column "email" in column transforms for table MY_TABLE`)
+}
+
+func TestIdentityAndDefaultColumns(t *testing.T) {
+	number := func(name string, ordinal int32) columnMetadata {
+		return columnMetadata{
+			Name:         name,
+			Ordinal:      ordinal,
+			Type:         "NUMBER(18,0)",
+			LogicalType:  "fixed",
+			PhysicalType: "SB8",
+			Precision:    ptr.Int32(18),
+			Scale:        ptr.Int32(0),
+			Nullable:     false,
+		}
+	}
+	columns := []columnMetadata{
+		number("ID", 1),
+		number("CREATED_AT", 2),
+		number("A", 3),
+		number("COMPUTED", 4),
+	}
+	// The result of DESCRIBE TABLE for the columns above.
+	require.NoError(t, markColumnDefaults(RunSQLResponse{
+		ResultSetMetadata: ResultSetMetadata{
+			RowType: []RowType{{Name: "name"}, {Name: "type"}, {Name: "kind"}, {Name: "null?"}, {Name: "default"}},
+		},
+		Data: [][]string{
+			{"ID", "NUMBER(38,0)", "COLUMN", "N", "IDENTITY START 1 INCREMENT 1 ORDER"},
+			{"CREATED_AT", "NUMBER(38,0)", "COLUMN", "N", "DATE_PART(EPOCH_SECOND, CURRENT_TIMESTAMP())"},
+			{"A", "NUMBER(38,0)", "COLUMN", "N", ""},
+			{"COMPUTED", "NUMBER(38,0)", "VIRTUAL", "N", ""},
+		},
+	}, columns))
+	require.True(t, columns[0].Identity)
+	require.True(t, columns[1].HasDefault)
+	require.False(t, columns[2].Identity || columns[2].HasDefault)
+
+	schema, transformers, _, err := constructParquetSchema(columns, ChannelOptions{IgnoreColumns: []string{"computed"}})
+	require.NoError(t, err)
+	require.Len(t, transformers, 3)
+	ignored := ignoredColumnNames(ChannelOptions{IgnoreColumns: []string{"computed"}})
+
+	build := func(s string) ([]map[string]any, error) {
+		t.Helper()
+		rows, _, err := constructRowGroup(service.MessageBatch{msg(s)}, schema, transformers, ignored, SchemaModeStrictWithNulls, false, false, 1)
+		if err != nil {
+			return nil, err
+		}
+		b, err := newParquetWriter("latest", schema).WriteFile(rows, nil)
+		require.NoError(t, err)
+		actual, err := readGeneric(bytes.NewReader(b), int64(len(b)), schema)
+		require.NoError(t, err)
+		return actual, nil
+	}
+
+	// Identity and default columns may be omitted, ignored columns are dropped.
+	rows, err := build(`{"a":1,"computed":2}`)
+	require.NoError(t, err)
+	require.Equal(t, []map[string]any{{"ID": nil, "CREATED_AT": nil, "A": int64(1)}}, rows)
+
+	// Default columns accept explicit values.
+	rows, err = build(`{"a":1,"created_at":1700000000}`)
+	require.NoError(t, err)
+	require.Equal(t, []map[string]any{{"ID": nil, "CREATED_AT": int64(1700000000), "A": int64(1)}}, rows)
+
+	// Identity columns reject explicit values.
+	_, err = build(`{"a":1,"id":5}`)
+	require.ErrorContains(t, err, `invalid data for column "ID": values can't be specified for identity columns`)
+
+	// Plain NOT NULL columns are still required.
+	_, err = build(`{"created_at":1700000000}`)
+	var nonNullErr *NonNullColumnError
+	require.ErrorAs(t, err, &nonNullErr)
+	require.Equal(t, "A", nonNullErr.ColumnName())
+}
+
+// wideTestSchema returns a schema of nullable NUMBER, REAL, TEXT and BOOLEAN
+// columns named C0, C1, etc.
+func wideTestSchema(t testing.TB, columns int, mode ConversionErrorMode) (*parquet.Schema, []*dataTransformer) {
+	t.Helper()
+	metadata := make([]columnMetadata, columns)
+	for i := range metadata {
+		column := columnMetadata{Name: fmt.Sprintf("C%d", i), Ordinal: int32(i + 1), Nullable: true}
+		switch i % 4 {
+		case 0:
+			column.Type, column.LogicalType, column.PhysicalType = "NUMBER(18,0)", "fixed", "SB8"
+			column.Precision, column.Scale = ptr.Int32(18), ptr.Int32(0)
+		case 1:
+			column.Type, column.LogicalType, column.PhysicalType = "FLOAT", "real", "DOUBLE"
+		case 2:
+			column.Type, column.LogicalType, column.PhysicalType = "VARCHAR(16777216)", "text", "LOB"
+		case 3:
+			column.Type, column.LogicalType, column.PhysicalType = "BOOLEAN", "boolean", "SB1"
+		}
+		metadata[i] = column
+	}
+	schema, transformers, _, err := constructParquetSchema(metadata, ChannelOptions{ConversionErrorMode: mode})
+	require.NoError(t, err)
+	return schema, transformers
+}
+
+// wideTestRows returns rows with values for the columns of wideTestSchema,
+// some of which are null or can't be converted.
+func wideTestRows(t testing.TB, rows, columns int, seed uint64) [][]byte {
+	t.Helper()
+	rng := rand.New(rand.NewPCG(seed, seed))
+	out := make([][]byte, rows)
+	for i := range out {
+		row := map[string]any{}
+		for j := range columns {
+			var v any
+			switch j % 4 {
+			case 0:
+				v = rng.Int64N(1_000_000) - 500_000
+			case 1:
+				v = rng.NormFloat64()
+			case 2:
+				v = fmt.Sprintf("value-%d", rng.IntN(10_000))
+			case 3:
+				v = rng.IntN(2) == 0
+			}
+			switch rng.IntN(50) {
+			case 0:
+				v = nil
+			case 1:
+				v = "not-a-number"
+				if j%4 == 2 {
+					v = 5
+				}
+			}
+			row[fmt.Sprintf("C%d", j)] = v
+		}
+		b, err := json.Marshal(row)
+		require.NoError(t, err)
+		out[i] = b
+	}
+	return out
+}
+
+func testBatch(rows [][]byte) service.MessageBatch {
+	batch := make(service.MessageBatch, len(rows))
+	for i, b := range rows {
+		batch[i] = service.NewMessage(b)
+	}
+	return batch
+}
+
+func TestConstructRowGroupColumnParallelism(t *testing.T) {
+	const columns = 37
+	schema, transformers := wideTestSchema(t, columns, ConversionErrorModeNull)
+	data := wideTestRows(t, 501, columns, 42)
+
+	type result struct {
+		rows             []parquet.Row
+		stats            []*statsBuffer
+		conversionErrors []any
+	}
+	build := func(parallelism int) result {
+		t.Helper()
+		batch := testBatch(data)
+		rows, stats, err := constructRowGroup(batch, schema, transformers, nil, SchemaModeIgnoreExtra, false, false, parallelism)
+		require.NoError(t, err)
+		res := result{rows: rows, stats: stats}
+		for _, m := range batch {
+			errs, _ := m.MetaGetMut(ConversionErrorsMetadataKey)
+			res.conversionErrors = append(res.conversionErrors, errs)
+		}
+		return res
+	}
+
+	expected := build(1)
+	var conversionErrors int64
+	for _, s := range expected.stats {
+		conversionErrors += s.conversionErrors
+	}
+	require.Positive(t, conversionErrors)
+	for _, parallelism := range []int{2, 3, 8, 64} {
+		require.Equal(t, expected, build(parallelism), "column parallelism %d", parallelism)
+	}
+
+	// The stats of row groups built from the chunks of a batch are merged.
+	first, firstStats, err := constructRowGroup(testBatch(data[:200]), schema, transformers, nil, SchemaModeIgnoreExtra, false, false, 4)
+	require.NoError(t, err)
+	second, secondStats, err := constructRowGroup(testBatch(data[200:]), schema, transformers, nil, SchemaModeIgnoreExtra, false, false, 4)
+	require.NoError(t, err)
+	require.Equal(t, expected.rows, append(first, second...))
+	for i := range expected.stats {
+		require.Equal(t, expected.stats[i], mergeStats(firstStats[i], secondStats[i]), "column %d", i)
+	}
+}
+
+func TestConstructRowGroupColumnParallelismErrors(t *testing.T) {
+	const columns = 12
+	schema, transformers := wideTestSchema(t, columns, ConversionErrorModeReject)
+	valid := func() map[string]any {
+		row := map[string]any{}
+		for j := range columns {
+			row[fmt.Sprintf("C%d", j)] = []any{j, float64(j), "foo", true}[j%4]
+		}
+		return row
+	}
+	rows := func(edits map[int]func(map[string]any)) [][]byte {
+		out := make([][]byte, 300)
+		for i := range out {
+			row := valid()
+			if edit, ok := edits[i]; ok {
+				edit(row)
+			}
+			b, err := json.Marshal(row)
+			require.NoError(t, err)
+			out[i] = b
+		}
+		return out
+	}
+
+	tests := []struct {
+		name        string
+		data        [][]byte
+		errContains string
+	}{
+		{
+			name: "first row wins",
+			data: rows(map[int]func(map[string]any){
+				250: func(r map[string]any) { r["C0"] = "foo" },
+				120: func(r map[string]any) { r["C8"] = "foo"; r["C4"] = "bar" },
+			}),
+			errContains: `invalid data for column "C4"`,
+		},
+		{
+			name: "schema error after conversion error",
+			data: rows(map[int]func(map[string]any){
+				100: func(r map[string]any) { r["C5"] = "foo" },
+				200: func(r map[string]any) { r["UNKNOWN"] = 1 },
+			}),
+			errContains: `invalid data for column "C5"`,
+		},
+		{
+			name: "schema error before conversion error",
+			data: rows(map[int]func(map[string]any){
+				100: func(r map[string]any) { r["UNKNOWN"] = 1 },
+				200: func(r map[string]any) { r["C5"] = "foo" },
+			}),
+			errContains: "UNKNOWN",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, parallelism := range []int{1, 4, 7} {
+				_, _, err := constructRowGroup(testBatch(test.data), schema, transformers, nil, SchemaModeStrict, false, false, parallelism)
+				require.ErrorContains(t, err, test.errContains, "column parallelism %d", parallelism)
+			}
+		})
+	}
+}
+
+func columnEncodingsTestColumns() []columnMetadata {
+	return []columnMetadata{
+		{Name: "ID", Ordinal: 1, Type: "VARCHAR(36)", LogicalType: "text", PhysicalType: "LOB", ByteLength: ptr.Int32(36)},
+		{Name: "STATUS", Ordinal: 2, Type: "VARCHAR(16)", LogicalType: "text", PhysicalType: "LOB", ByteLength: ptr.Int32(16), Nullable: true},
+		{Name: "PAYLOAD", Ordinal: 3, Type: "BINARY", LogicalType: "binary", PhysicalType: "LOB", Nullable: true},
+		{Name: "AMOUNT", Ordinal: 4, Type: "NUMBER(18,0)", LogicalType: "fixed", PhysicalType: "SB8", Precision: ptr.Int32(18), Scale: ptr.Int32(0)},
+	}
+}
+
+func columnEncodingsTestBatch(rows int) service.MessageBatch {
+	statuses := []string{"pending", "shipped", "delivered", "cancelled"}
+	batch := make(service.MessageBatch, rows)
+	for i := range batch {
+		payload := make([]byte, 64)
+		for j := range payload {
+			payload[j] = byte(rand.IntN(256))
+		}
+		batch[i] = service.NewMessage(nil)
+		batch[i].SetStructured(map[string]any{
+			"id":      fmt.Sprintf("%08x-%04x-%04x-%04x-%012x", rand.Uint32(), rand.IntN(1<<16), rand.IntN(1<<16), rand.IntN(1<<16), rand.Int64N(1<<48)),
+			"status":  statuses[i%len(statuses)],
+			"payload": payload,
+			"amount":  int64(i),
+		})
+	}
+	return batch
+}
+
+func TestColumnEncodings(t *testing.T) {
+	none, err := ParseCompressionCodec("none")
+	require.NoError(t, err)
+	gzip, err := ParseCompressionCodec("gzip")
+	require.NoError(t, err)
+	_, err = ParseCompressionCodec("snappy")
+	require.ErrorContains(t, err, `unsupported compression codec "snappy"`)
+
+	opts := ChannelOptions{
+		TableName: "MY_TABLE",
+		ColumnEncodings: map[string]ColumnEncoding{
+			"id":      {Compression: none},
+			"status":  {Dictionary: true},
+			"payload": {Compression: gzip, Dictionary: false},
+		},
+	}
+	schema, transformers, _, err := constructParquetSchema(columnEncodingsTestColumns(), opts)
+	require.NoError(t, err)
+
+	batch := columnEncodingsTestBatch(100)
+	rows, _, err := constructRowGroup(batch, schema, transformers, nil, SchemaModeIgnoreExtra, false, false, 1)
+	require.NoError(t, err)
+	w := newParquetWriter("latest", schema)
+	// The writer is reused for each file, so the dictionaries must not leak
+	// into the next file.
+	for range 2 {
+		b, err := w.WriteFile(rows, nil)
+		require.NoError(t, err)
+
+		metadata, err := readParquetMetadata(b)
+		require.NoError(t, err)
+		require.Len(t, metadata.RowGroups, 1)
+		chunks := map[string]format.ColumnMetaData{}
+		for _, c := range metadata.RowGroups[0].Columns {
+			chunks[c.MetaData.PathInSchema[0]] = c.MetaData
+		}
+		require.Equal(t, format.Uncompressed, chunks["ID"].Codec)
+		require.NotContains(t, chunks["ID"].Encoding, format.RLEDictionary)
+		require.Equal(t, format.Zstd, chunks["STATUS"].Codec)
+		require.Contains(t, chunks["STATUS"].Encoding, format.RLEDictionary)
+		require.NotNil(t, chunks["STATUS"].DictionaryPageOffset)
+		require.Equal(t, format.Gzip, chunks["PAYLOAD"].Codec)
+		require.NotContains(t, chunks["PAYLOAD"].Encoding, format.RLEDictionary)
+		// Unlisted columns keep the defaults.
+		require.Equal(t, format.Zstd, chunks["AMOUNT"].Codec)
+		require.Equal(t, []format.Encoding{format.Plain}, chunks["AMOUNT"].Encoding)
+
+		actual, err := readGeneric(bytes.NewReader(b), int64(len(b)), schema)
+		require.NoError(t, err)
+		require.Len(t, actual, len(batch))
+		for i, row := range actual {
+			expected, err := batch[i].AsStructured()
+			require.NoError(t, err)
+			m := expected.(map[string]any)
+			require.Equal(t, m["id"], row["ID"])
+			require.Equal(t, m["status"], row["STATUS"])
+			require.Equal(t, string(m["payload"].([]byte)), row["PAYLOAD"])
+		}
+	}
+
+	_, _, _, err = constructParquetSchema(columnEncodingsTestColumns(), ChannelOptions{
+		TableName:       "MY_TABLE",
+		ColumnEncodings: map[string]ColumnEncoding{"missing": {Dictionary: true}},
+	})
+	require.ErrorContains(t, err, `unknown column "missing" in column encodings for table MY_TABLE`)
+}
+
+// BenchmarkColumnEncodings compares the time to build files and their size
+// with the default encodings and with encodings tuned to the data, where the
+// random IDs and payloads are left uncompressed and the statuses are
+// dictionary encoded.
+func BenchmarkColumnEncodings(b *testing.B) {
+	none, err := ParseCompressionCodec("none")
+	require.NoError(b, err)
+	for name, encodings := range map[string]map[string]ColumnEncoding{
+		"default": nil,
+		"tuned": {
+			"id":      {Compression: none},
+			"status":  {Dictionary: true},
+			"payload": {Compression: none},
+		},
+	} {
+		b.Run(name, func(b *testing.B) {
+			schema, transformers, _, err := constructParquetSchema(columnEncodingsTestColumns(), ChannelOptions{ColumnEncodings: encodings})
+			require.NoError(b, err)
+			rows, _, err := constructRowGroup(columnEncodingsTestBatch(10_000), schema, transformers, nil, SchemaModeIgnoreExtra, false, false, 1)
+			require.NoError(b, err)
+			w := newParquetWriter("latest", schema)
+			var size int
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				out, err := w.WriteFile(rows, nil)
+				require.NoError(b, err)
+				size = len(out)
+			}
+			b.ReportMetric(float64(size), "file_bytes")
+		})
+	}
+}
+
+func BenchmarkConstructRowGroup(b *testing.B) {
+	const columns = 300
+	schema, transformers := wideTestSchema(b, columns, ConversionErrorModeNull)
+	data := wideTestRows(b, 1_000, columns, 1)
+	for _, parallelism := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("column_parallelism=%d", parallelism), func(b *testing.B) {
+			b.ReportAllocs()
+			for range b.N {
+				b.StopTimer()
+				batch := testBatch(data)
+				b.StartTimer()
+				_, _, err := constructRowGroup(batch, schema, transformers, nil, SchemaModeIgnoreExtra, false, false, parallelism)
+				require.NoError(b, err)
+			}
+		})
+	}
+}
+
+func TestNumberColumnPhysicalTypes(t *testing.T) {
+	columns := []columnMetadata{
+		{Name: "A", Ordinal: 1, Type: "NUMBER(9,0)", LogicalType: "fixed", PhysicalType: "SB16", Precision: ptr.Int32(9), Scale: ptr.Int32(0)},
+		{Name: "B", Ordinal: 2, Type: "NUMBER(9,2)", LogicalType: "fixed", PhysicalType: "SB16", Precision: ptr.Int32(9), Scale: ptr.Int32(2)},
+		{Name: "C", Ordinal: 3, Type: "NUMBER(18,0)", LogicalType: "fixed", PhysicalType: "SB16", Precision: ptr.Int32(18), Scale: ptr.Int32(0)},
+		{Name: "D", Ordinal: 4, Type: "NUMBER(18,4)", LogicalType: "fixed", PhysicalType: "SB16", Precision: ptr.Int32(18), Scale: ptr.Int32(4)},
+		{Name: "E", Ordinal: 5, Type: "NUMBER(38,0)", LogicalType: "fixed", PhysicalType: "SB16", Precision: ptr.Int32(38), Scale: ptr.Int32(0)},
+		{Name: "F", Ordinal: 6, Type: "NUMBER(12,0)", LogicalType: "fixed", PhysicalType: "SB4", Precision: ptr.Int32(12), Scale: ptr.Int32(0)},
+		{Name: "G", Ordinal: 7, Type: "NUMBER(4,0)", LogicalType: "fixed", PhysicalType: "SB2", Precision: ptr.Int32(4), Scale: ptr.Int32(0)},
+	}
+	schema, transformers, metadata, err := constructParquetSchema(columns, ChannelOptions{})
+	require.NoError(t, err)
+
+	type expectedColumn struct {
+		kind         parquet.Kind
+		precision    int
+		scale        int
+		physicalType string
+	}
+	expected := map[string]expectedColumn{
+		"A": {parquet.Int32, 9, 0, "SB4"},
+		"B": {parquet.Int32, 9, 2, "SB4"},
+		"C": {parquet.Int64, 18, 0, "SB8"},
+		"D": {parquet.Int64, 18, 4, "SB8"},
+		"E": {parquet.FixedLenByteArray, 38, 0, "SB16"},
+		"F": {parquet.Int64, 12, 0, "SB8"},
+		"G": {parquet.Int32, 4, 0, "SB2"},
+	}
+	for i, column := range columns {
+		e := expected[column.Name]
+		field := schema.Fields()[i]
+		require.Equal(t, column.Name, field.Name())
+		require.Equal(t, e.kind, field.Type().Kind(), column.Name)
+		if e.kind == parquet.FixedLenByteArray {
+			require.Equal(t, 16, field.Type().Length(), column.Name)
+		}
+		decimal := field.Type().LogicalType().Decimal
+		require.NotNil(t, decimal, column.Name)
+		require.Equal(t, int32(e.precision), decimal.Precision, column.Name)
+		require.Equal(t, int32(e.scale), decimal.Scale, column.Name)
+		require.Equal(t, fmt.Sprintf("2,%d", physicalTypeOrdinal(e.physicalType)), metadata[fmt.Sprint(column.Ordinal)], column.Name)
+	}
+
+	// Values are validated against the precision, so they can't be truncated
+	// by the narrower physical types.
+	for _, row := range []string{
+		`{"A":1000000000}`,
+		`{"B":10000000}`,
+		`{"C":"1000000000000000000"}`,
+		`{"F":1000000000000}`,
+	} {
+		_, _, err := constructRowGroup(
+			service.MessageBatch{msg(row)},
+			schema,
+			transformers,
+			nil,
+			SchemaModeIgnoreExtra,
+			false,
+			false,
+			1,
+		)
+		require.Error(t, err, row)
+	}
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	batch := make(service.MessageBatch, 1000)
+	for i := range batch {
+		batch[i] = msg(fmt.Sprintf(
+			`{"A":%d,"B":%d.%02d,"C":%d,"D":%d.%04d,"E":%d,"F":%d,"G":%d}`,
+			rng.Int32N(999999999),
+			rng.Int32N(9999999), rng.IntN(100),
+			rng.Int64N(999999999999999999),
+			rng.Int64N(99999999999999), rng.IntN(10000),
+			rng.Int64(),
+			rng.Int64N(999999999999),
+			rng.IntN(9999),
+		))
+	}
+	batch[0] = msg(`{"A":-999999999,"B":9999999.99,"C":-999999999999999999,"D":99999999999999.9999,"E":1,"F":-999999999999,"G":-9999}`)
+	writeFile := func(schema *parquet.Schema, transformers []*dataTransformer) ([]byte, []*statsBuffer) {
+		rows, stats, err := constructRowGroup(batch, schema, transformers, nil, SchemaModeIgnoreExtra, false, false, 1)
+		require.NoError(t, err)
+		b, err := newParquetWriter("latest", schema).WriteFile(rows, nil)
+		require.NoError(t, err)
+		return b, stats
+	}
+	narrow, narrowStats := writeFile(schema, transformers)
+
+	// Write the same data with every column as a 16 byte decimal, which is how
+	// all NUMBER columns with a scale or the SB16 physical type used to be written.
+	wideGroup := parquet.Group{}
+	wideTransformers := make([]*dataTransformer, len(transformers))
+	for i, t := range transformers {
+		wideGroup[t.name] = parquet.Encoded(parquet.FieldID(parquet.Decimal(int(*t.column.Scale), int(*t.column.Precision), parquet.FixedLenByteArrayType(16)), int(t.column.Ordinal)), &parquet.Plain)
+		wide := *t
+		wide.bufferFactory = defaultTypedBufferFactory
+		wideTransformers[i] = &wide
+	}
+	wide, wideStats := writeFile(parquet.NewSchema("bdec", wideGroup), wideTransformers)
+	require.Equal(t, wideStats, narrowStats)
+	require.Less(t, len(narrow), len(wide))
+
+	fileMetadata, err := readParquetMetadata(narrow)
+	require.NoError(t, err)
+	narrowSummary, err := readParquetSummary(narrow)
+	require.NoError(t, err)
+	require.Equal(t, fileMetadata.NumRows, narrowSummary.NumRows)
+	require.Len(t, narrowSummary.RowGroups, len(fileMetadata.RowGroups))
+	require.Equal(t, fileMetadata.RowGroups[0].TotalByteSize, narrowSummary.RowGroups[0].TotalByteSize)
+	wideSummary, err := readParquetSummary(wide)
+	require.NoError(t, err)
+	// Compression recovers some of the zero padding of the wide values, but
+	// the uncompressed size, which is what's reported to Snowflake, is about halved.
+	narrowSize, wideSize := totalUncompressedSize(narrowSummary), totalUncompressedSize(wideSummary)
+	require.Less(t, narrowSize, wideSize*9/16, "narrow: %d bytes, wide: %d bytes", narrowSize, wideSize)
+	require.Len(t, fileMetadata.RowGroups, 1)
+	for _, chunk := range fileMetadata.RowGroups[0].Columns {
+		name := chunk.MetaData.PathInSchema[0]
+		width := 16
+		switch expected[name].kind {
+		case parquet.Int32:
+			width = 4
+		case parquet.Int64:
+			width = 8
+		}
+		require.Len(t, chunk.MetaData.Statistics.MinValue, width, name)
+		require.Len(t, chunk.MetaData.Statistics.MaxValue, width, name)
+	}
+
+	actual, err := readGeneric(bytes.NewReader(narrow), int64(len(narrow)), schema)
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{
+		"A": int32(-999999999),
+		"B": int32(999999999),
+		"C": int64(-999999999999999999),
+		"D": int64(999999999999999999),
+		"E": int128.FromInt64(1).ToBigEndian(),
+		"F": int64(-999999999999),
+		"G": int32(-9999),
+	}, actual[0])
+}
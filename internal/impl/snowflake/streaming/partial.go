@@ -0,0 +1,111 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package streaming
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/cespare/xxhash/v2"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+// maxPartialInsertsPerTable bounds the number of partially inserted batches
+// that are remembered for each table, the oldest ones are forgotten first.
+const maxPartialInsertsPerTable = 16
+
+// partialInsert is a batch of which the leading rows were registered before
+// registering one of the following files failed.
+type partialInsert struct {
+	rows   int
+	digest uint64
+}
+
+// partialInserts remembers the batches which were only partially registered,
+// so that when the batch is inserted again, usually with a channel that was
+// reopened after the failure, the rows that were registered already are
+// skipped instead of being written twice.
+//
+// The batches are tracked per table rather than per channel, as a pooled
+// output may retry a batch with another channel of the same table.
+type partialInserts struct {
+	mu      sync.Mutex
+	inserts map[string][]partialInsert
+}
+
+func newPartialInserts() *partialInserts {
+	return &partialInserts{inserts: map[string][]partialInsert{}}
+}
+
+// digestRows returns a digest of the contents of the rows of a batch.
+func digestRows(batch service.MessageBatch) (uint64, error) {
+	h := xxhash.New()
+	var size [8]byte
+	for _, msg := range batch {
+		b, err := msg.AsBytes()
+		if err != nil {
+			return 0, err
+		}
+		// Include the length of each row so that the boundaries between rows
+		// are part of the digest.
+		binary.LittleEndian.PutUint64(size[:], uint64(len(b)))
+		_, _ = h.Write(size[:])
+		_, _ = h.Write(b)
+	}
+	return h.Sum64(), nil
+}
+
+// add records that the first rows of the batch were registered to the table.
+func (p *partialInserts) add(table string, batch service.MessageBatch, rows int) {
+	if p == nil || rows <= 0 {
+		return
+	}
+	digest, err := digestRows(batch[:rows])
+	if err != nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	inserts := append(p.inserts[table], partialInsert{rows: rows, digest: digest})
+	if len(inserts) > maxPartialInsertsPerTable {
+		inserts = inserts[len(inserts)-maxPartialInsertsPerTable:]
+	}
+	p.inserts[table] = inserts
+}
+
+// take returns the number of leading rows of the batch that were registered
+// to the table by a previous attempt to insert it, and forgets about them.
+func (p *partialInserts) take(table string, batch service.MessageBatch) int {
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	inserts := p.inserts[table]
+	for i, insert := range inserts {
+		if insert.rows > len(batch) {
+			continue
+		}
+		digest, err := digestRows(batch[:insert.rows])
+		if err != nil || digest != insert.digest {
+			continue
+		}
+		inserts = append(inserts[:i], inserts[i+1:]...)
+		if len(inserts) == 0 {
+			delete(p.inserts, table)
+		} else {
+			p.inserts[table] = inserts
+		}
+		return insert.rows
+	}
+	return 0
+}
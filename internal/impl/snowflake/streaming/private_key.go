@@ -0,0 +1,65 @@
+/*
+ * Copyright 2025 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package streaming
+
+import (
+	"crypto/rsa"
+	"errors"
+	"sync"
+)
+
+// PrivateKeySource holds the private key used to sign the JWTs of the clients which share it, so that a rotated key
+// pair is picked up without recreating the clients.
+type PrivateKeySource struct {
+	mu     sync.Mutex
+	key    *rsa.PrivateKey
+	reload func() (*rsa.PrivateKey, error)
+	// reloadMu serializes reloads, so that the key of an older reload never replaces the key of a newer one.
+	reloadMu sync.Mutex
+}
+
+// NewPrivateKeySource creates a source for key. When reload is not nil it's called to load the current key when the
+// key is reloaded, such as after Snowflake rejected a JWT signed with key.
+func NewPrivateKeySource(key *rsa.PrivateKey, reload func() (*rsa.PrivateKey, error)) *PrivateKeySource {
+	return &PrivateKeySource{key: key, reload: reload}
+}
+
+// Key returns the current private key, or nil for a nil source.
+func (s *PrivateKeySource) Key() *rsa.PrivateKey {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.key
+}
+
+// CanReload returns true if the key can be reloaded.
+func (s *PrivateKeySource) CanReload() bool {
+	return s != nil && s.reload != nil
+}
+
+// Reload loads the current key and returns it. The previous key is kept when loading fails.
+func (s *PrivateKeySource) Reload() (*rsa.PrivateKey, error) {
+	if !s.CanReload() {
+		return nil, errors.New("the private key can't be reloaded")
+	}
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	key, err := s.reload()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.key = key
+	return key, nil
+}
@@ -0,0 +1,182 @@
+/*
+ * Copyright 2025 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package streaming
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/require"
+)
+
+// keyPairAuthServer accepts requests with a JWT signed by the private key of its current public key.
+type keyPairAuthServer struct {
+	mu        sync.Mutex
+	publicKey *rsa.PublicKey
+
+	rejected atomic.Int64
+}
+
+func (s *keyPairAuthServer) setPublicKey(key *rsa.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.publicKey = key
+}
+
+func (s *keyPairAuthServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	publicKey := s.publicKey
+	s.mu.Unlock()
+	_, err := jwt.Parse(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), func(*jwt.Token) (any, error) {
+		return publicKey, nil
+	})
+	if err != nil {
+		s.rejected.Add(1)
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"code":"390144","message":"JWT token is invalid."}`))
+		return
+	}
+	_, _ = w.Write([]byte(`{}`))
+}
+
+func generateTestKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return key
+}
+
+func TestRestClientReloadsRotatedPrivateKey(t *testing.T) {
+	oldKey, newKey := generateTestKey(t), generateTestKey(t)
+	auth := &keyPairAuthServer{publicKey: &oldKey.PublicKey}
+	srv := httptest.NewServer(auth)
+	t.Cleanup(srv.Close)
+
+	var mu sync.Mutex
+	currentKey := oldKey
+	var reloads atomic.Int64
+	keySource := NewPrivateKeySource(oldKey, func() (*rsa.PrivateKey, error) {
+		reloads.Add(1)
+		mu.Lock()
+		defer mu.Unlock()
+		return currentKey, nil
+	})
+	client, err := NewRestClient(RestOptions{
+		Account:          "account",
+		User:             "user",
+		URL:              srv.URL,
+		PrivateKeySource: keySource,
+		Logger:           service.MockResources().Logger(),
+	})
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+
+	runSQL := func() error {
+		_, err := client.RunSQL(context.Background(), RunSQLRequest{Statement: "SELECT 1"})
+		return err
+	}
+	for range 5 {
+		require.NoError(t, runSQL())
+	}
+
+	// Rotate the key pair mid-run, the requests signed with the old key are rejected from now on.
+	mu.Lock()
+	currentKey = newKey
+	mu.Unlock()
+	auth.setPublicKey(&newKey.PublicKey)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- runSQL()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	require.Positive(t, reloads.Load())
+	require.LessOrEqual(t, auth.rejected.Load(), reloads.Load())
+	require.Same(t, newKey, keySource.Key())
+
+	// Once reloaded, requests are signed with the new key without reloading it again.
+	reloadsAfterRotation := reloads.Load()
+	for range 5 {
+		require.NoError(t, runSQL())
+	}
+	require.Equal(t, reloadsAfterRotation, reloads.Load())
+}
+
+func TestRestClientPicksUpReloadedPrivateKey(t *testing.T) {
+	oldKey, newKey := generateTestKey(t), generateTestKey(t)
+	auth := &keyPairAuthServer{publicKey: &oldKey.PublicKey}
+	srv := httptest.NewServer(auth)
+	t.Cleanup(srv.Close)
+
+	// The key is reloaded before Snowflake rejects the old one, such as when the key file is polled, and shared with
+	// other clients.
+	keySource := NewPrivateKeySource(oldKey, func() (*rsa.PrivateKey, error) { return newKey, nil })
+	client, err := NewRestClient(RestOptions{URL: srv.URL, PrivateKeySource: keySource, Logger: service.MockResources().Logger()})
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+
+	_, err = keySource.Reload()
+	require.NoError(t, err)
+	auth.setPublicKey(&newKey.PublicKey)
+
+	_, err = client.RunSQL(context.Background(), RunSQLRequest{Statement: "SELECT 1"})
+	require.NoError(t, err)
+	require.Zero(t, auth.rejected.Load())
+}
+
+func TestRestClientSurfacesAuthErrorsAfterReload(t *testing.T) {
+	oldKey, otherKey := generateTestKey(t), generateTestKey(t)
+	auth := &keyPairAuthServer{publicKey: &otherKey.PublicKey}
+	srv := httptest.NewServer(auth)
+	t.Cleanup(srv.Close)
+
+	// The reloaded key is still rejected, so the error is surfaced after a single reload.
+	var reloads atomic.Int64
+	keySource := NewPrivateKeySource(oldKey, func() (*rsa.PrivateKey, error) {
+		reloads.Add(1)
+		return oldKey, nil
+	})
+	client, err := NewRestClient(RestOptions{URL: srv.URL, PrivateKeySource: keySource, Logger: service.MockResources().Logger()})
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+
+	_, err = client.RunSQL(context.Background(), RunSQLRequest{Statement: "SELECT 1"})
+	var httpErr *HTTPError
+	require.ErrorAs(t, err, &httpErr)
+	require.Equal(t, http.StatusUnauthorized, httpErr.StatusCode)
+	require.Equal(t, int64(1), reloads.Load())
+
+	// A key which can't be reloaded isn't.
+	client, err = NewRestClient(RestOptions{URL: srv.URL, PrivateKey: oldKey, Logger: service.MockResources().Logger()})
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+	_, err = client.RunSQL(context.Background(), RunSQLRequest{Statement: "SELECT 1"})
+	require.ErrorAs(t, err, &httpErr)
+	require.Equal(t, http.StatusUnauthorized, httpErr.StatusCode)
+}
@@ -41,6 +41,7 @@ const (
 	responseErrQueueFull              = 7
 	responseErrRetryRequest           = 10
 	responseErrInvalidClientSequencer = 20
+	responseErrInvalidRowSequencer    = 21
 	responseErrTransientError         = 35 // Can be due to schema changes
 	responseErrMissingColumnStats     = 40 // Can be due to schema changes
 
@@ -132,6 +133,12 @@ type (
 		SourceIcebergDataType *string `json:"source_iceberg_data_type"`
 		// The column ordinal is an internal id of the column used by server scanner for the column identification.
 		Ordinal int32 `json:"ordinal"`
+		// Whether the column is an identity (autoincrement) column, which is
+		// not part of the open channel response and is read from the table.
+		Identity bool `json:"-"`
+		// Whether the column has a default expression, which is not part of
+		// the open channel response and is read from the table.
+		HasDefault bool `json:"-"`
 	}
 	openChannelResponse struct {
 		StatusCode          int64            `json:"status_code"`
@@ -173,12 +180,13 @@ type (
 		// current hex-encoded max value, truncated down to 32 bytes
 		MinStrValue *string `json:"minStrValue"`
 		// current hex-encoded max value, truncated up to 32 bytes
-		MaxStrValue  *string    `json:"maxStrValue"`
-		MinIntValue  int128.Num `json:"minIntValue"`
-		MaxIntValue  int128.Num `json:"maxIntValue"`
-		MinRealValue float64    `json:"minRealValue"`
-		MaxRealValue float64    `json:"maxRealValue"`
-		NullCount    int64      `json:"nullCount"`
+		MaxStrValue *string `json:"maxStrValue"`
+		// min and max values, null when the column only contains nulls
+		MinIntValue  *int128.Num `json:"minIntValue"`
+		MaxIntValue  *int128.Num `json:"maxIntValue"`
+		MinRealValue *float64    `json:"minRealValue"`
+		MaxRealValue *float64    `json:"maxRealValue"`
+		NullCount    int64       `json:"nullCount"`
 		// Currently not tracked
 		DistinctValues int64 `json:"distinctValues"`
 		MaxLength      int64 `json:"maxLength"`
@@ -307,13 +315,19 @@ type SnowflakeRestClient struct {
 	account    string
 	url        string
 	user       string
-	privateKey *rsa.PrivateKey
+	privateKey *PrivateKeySource
 	client     *http.Client
 	version    string
 	logger     *service.Logger
 
 	authRefreshLoop *asyncroutine.Periodic
-	cachedJWT       *typed.AtomicValue[string]
+	cachedJWT       *typed.AtomicValue[signedJWT]
+}
+
+// signedJWT is a JWT along with the key which signed it.
+type signedJWT struct {
+	token string
+	key   *rsa.PrivateKey
 }
 
 // RestOptions is the options to create a REST client.
@@ -323,7 +337,10 @@ type RestOptions struct {
 	URL        string
 	Version    string
 	PrivateKey *rsa.PrivateKey
-	Logger     *service.Logger
+	// PrivateKeySource replaces PrivateKey when set, so that the client signs its JWTs with the current key of the
+	// source.
+	PrivateKeySource *PrivateKeySource
+	Logger           *service.Logger
 }
 
 // NewRestClient creates a new REST client for the given parameters.
@@ -339,34 +356,33 @@ func NewRestClient(opts RestOptions) (c *SnowflakeRestClient, err error) {
 		// this should only show up in development, not released binaries
 		version = "99.0.0"
 	}
+	keySource := opts.PrivateKeySource
+	if keySource == nil {
+		keySource = NewPrivateKeySource(opts.PrivateKey, nil)
+	}
 	c = &SnowflakeRestClient{
 		account:    opts.Account,
 		url:        opts.URL,
 		user:       opts.User,
 		client:     http.DefaultClient,
-		privateKey: opts.PrivateKey,
+		privateKey: keySource,
 		logger:     opts.Logger,
 		version:    version,
-		cachedJWT:  typed.NewAtomicValue(""),
+		cachedJWT:  typed.NewAtomicValue(signedJWT{}),
 		authRefreshLoop: asyncroutine.NewPeriodic(
 			time.Hour-(2*time.Minute),
 			func() {
-				jwt, err := c.computeJWT()
 				// We've already done this once, and there is no external component here
 				// so this should never fail, but log just in case...
-				if err != nil {
+				if err := c.refreshJWT(c.privateKey.Key()); err != nil {
 					c.logger.Errorf("unable to mint JWT for snowflake output: %s", err)
-					return
 				}
-				c.cachedJWT.Store(jwt)
 			},
 		),
 	}
-	jwt, err := c.computeJWT()
-	if err != nil {
+	if err := c.refreshJWT(keySource.Key()); err != nil {
 		return nil, err
 	}
-	c.cachedJWT.Store(jwt)
 	c.authRefreshLoop.Start()
 	return c, nil
 }
@@ -376,14 +392,46 @@ func (c *SnowflakeRestClient) Close() {
 	c.authRefreshLoop.Stop()
 }
 
-func (c *SnowflakeRestClient) computeJWT() (string, error) {
-	pubBytes, err := x509.MarshalPKIXPublicKey(c.privateKey.Public())
+// currentJWT returns the cached JWT, which is minted again first if the key of the client was replaced since it was
+// signed, so that requests are signed with the current key.
+func (c *SnowflakeRestClient) currentJWT() (string, error) {
+	cached := c.cachedJWT.Load()
+	if key := c.privateKey.Key(); key != cached.key {
+		if err := c.refreshJWT(key); err != nil {
+			return "", err
+		}
+		return c.cachedJWT.Load().token, nil
+	}
+	return cached.token, nil
+}
+
+// refreshJWT mints a new JWT signed with key and caches it.
+func (c *SnowflakeRestClient) refreshJWT(key *rsa.PrivateKey) error {
+	token, err := computeJWT(c.account, c.user, key)
+	if err != nil {
+		return err
+	}
+	c.cachedJWT.Store(signedJWT{token: token, key: key})
+	return nil
+}
+
+// reloadPrivateKey reloads the private key of the client and mints a new JWT signed with it.
+func (c *SnowflakeRestClient) reloadPrivateKey() error {
+	key, err := c.privateKey.Reload()
+	if err != nil {
+		return err
+	}
+	return c.refreshJWT(key)
+}
+
+func computeJWT(account, user string, privateKey *rsa.PrivateKey) (string, error) {
+	pubBytes, err := x509.MarshalPKIXPublicKey(privateKey.Public())
 	if err != nil {
 		return "", err
 	}
 	hash := sha256.Sum256(pubBytes)
-	accountName := strings.ToUpper(c.account)
-	userName := strings.ToUpper(c.user)
+	accountName := strings.ToUpper(account)
+	userName := strings.ToUpper(user)
 	issueAtTime := time.Now().UTC()
 	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
 		"iss": fmt.Sprintf("%s.%s.%s", accountName, userName, "SHA256:"+base64.StdEncoding.EncodeToString(hash[:])),
@@ -391,7 +439,7 @@ func (c *SnowflakeRestClient) computeJWT() (string, error) {
 		"iat": issueAtTime.Unix(),
 		"exp": issueAtTime.Add(time.Hour).Unix(),
 	})
-	return token.SignedString(c.privateKey)
+	return token.SignedString(privateKey)
 }
 
 // RunSQL executes a series of SQL statements. It's expected that these statements execute in less than 45 seconds so
@@ -433,10 +481,34 @@ func (c *SnowflakeRestClient) dropChannel(ctx context.Context, req dropChannelRe
 // registerBlob registers a blob in object storage to be ingested into Snowflake.
 func (c *SnowflakeRestClient) registerBlob(ctx context.Context, req registerBlobRequest) (resp registerBlobResponse, err error) {
 	requestID := uuid.NewString()
-	err = c.doPost(ctx, fmt.Sprintf("%s/v1/streaming/channels/write/blobs?requestId=%s", c.url, requestID), req, &resp)
+	// The request is attempted once, the channels retry failed registrations
+	// with a backoff that honors Retry-After, after checking that the blobs
+	// weren't registered already when the request may have been processed.
+	err = c.doPostRetrying(ctx, fmt.Sprintf("%s/v1/streaming/channels/write/blobs?requestId=%s", c.url, requestID), req, &resp, func(error) bool {
+		return false
+	})
 	return
 }
 
+// maxRetryAfter caps the delays requested by Snowflake so that a request
+// can't be stalled indefinitely.
+const maxRetryAfter = time.Minute
+
+// retryAfterBackOff waits for at least as long as the Retry-After header of
+// the last failed response requests.
+type retryAfterBackOff struct {
+	backoff.BackOff
+	lastErr *error
+}
+
+func (b *retryAfterBackOff) NextBackOff() time.Duration {
+	wait := b.BackOff.NextBackOff()
+	if wait == backoff.Stop {
+		return wait
+	}
+	return max(wait, min(retryAfter(*b.lastErr), maxRetryAfter))
+}
+
 func debugf(l *service.Logger, msg string, args ...any) {
 	if debug {
 		fmt.Printf("%s\n", fmt.Sprintf(msg, args...))
@@ -445,6 +517,13 @@ func debugf(l *service.Logger, msg string, args ...any) {
 }
 
 func (c *SnowflakeRestClient) doPost(ctx context.Context, url string, req any, resp any) error {
+	return c.doPostRetrying(ctx, url, req, resp, IsTransientError)
+}
+
+// doPostRetrying performs the request and retries the failed attempts for
+// which retryable returns true, waiting for at least as long as the
+// Retry-After header of the failed response requests.
+func (c *SnowflakeRestClient) doPostRetrying(ctx context.Context, url string, req any, resp any, retryable func(error) bool) error {
 	marshaller := json.Marshal
 	if debug {
 		marshaller = func(v any) ([]byte, error) {
@@ -455,8 +534,14 @@ func (c *SnowflakeRestClient) doPost(ctx context.Context, url string, req any, r
 	if err != nil {
 		return err
 	}
-	respBody, err := backoff.RetryNotifyWithData(func() ([]byte, error) {
+	reloadedKey := false
+	var lastErr error
+	attempt := func() ([]byte, error) {
 		debugf(c.logger, "making request to %s with body %s", url, reqBody)
+		token, err := c.currentJWT()
+		if err != nil {
+			return nil, backoff.Permanent(fmt.Errorf("unable to mint JWT: %w", err))
+		}
 		httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqBody))
 		if errors.Is(err, context.Canceled) {
 			return nil, backoff.Permanent(err)
@@ -467,35 +552,67 @@ func (c *SnowflakeRestClient) doPost(ctx context.Context, url string, req any, r
 		httpReq.Header.Set("Accept", "application/json")
 		httpReq.Header.Set("User-Agent", fmt.Sprintf(partnerID+"/%v", c.version))
 		httpReq.Header.Set("X-Snowflake-Authorization-Token-Type", "KEYPAIR_JWT")
-		httpReq.Header.Set("Authorization", "Bearer "+c.cachedJWT.Load())
+		httpReq.Header.Set("Authorization", "Bearer "+token)
 		r, err := c.client.Do(httpReq)
 		if errors.Is(err, context.Canceled) {
 			return nil, backoff.Permanent(err)
 		} else if err != nil {
-			return nil, fmt.Errorf("unable to perform http request: %w", err)
+			err = fmt.Errorf("unable to perform http request: %w", err)
+			if !retryable(err) {
+				return nil, backoff.Permanent(err)
+			}
+			return nil, err
 		}
 		respBody, err := io.ReadAll(r.Body)
 		_ = r.Body.Close()
 		if errors.Is(err, context.Canceled) {
 			return nil, backoff.Permanent(err)
 		} else if err != nil {
-			return nil, fmt.Errorf("unable to read http response: %w", err)
+			err = fmt.Errorf("unable to read http response: %w", err)
+			if !retryable(err) {
+				return nil, backoff.Permanent(err)
+			}
+			return nil, err
 		}
 		if r.StatusCode != 200 {
 			var restErr APIError
 			if unmarshalErr := json.Unmarshal(respBody, &restErr); unmarshalErr == nil && restErr.StatusCode != responseSuccess {
-				return nil, &restErr
+				err = &restErr
+			} else {
+				err = &HTTPError{StatusCode: r.StatusCode, Body: string(respBody), RetryAfter: parseRetryAfter(r.Header.Get("Retry-After"), time.Now())}
+			}
+			// The key pair may have been rotated since the JWT was signed, so the key is reloaded once and the request
+			// is retried with a JWT signed with the reloaded key.
+			if isAuthError(err) && !reloadedKey && c.privateKey.CanReload() {
+				reloadedKey = true
+				if reloadErr := c.reloadPrivateKey(); reloadErr != nil {
+					return nil, backoff.Permanent(fmt.Errorf("%w, unable to reload private key: %v", err, reloadErr))
+				}
+				c.logger.Info("Reloaded the private key after Snowflake rejected the JWT of a request")
+				return nil, err
 			}
-			return nil, fmt.Errorf("non successful status code (%d): %s", r.StatusCode, respBody)
+			// There is no point in retrying requests which Snowflake rejected.
+			if !retryable(err) {
+				return nil, backoff.Permanent(err)
+			}
+			return nil, err
 		}
 		debugf(c.logger, "got response to %s with body %s", url, respBody)
 		return respBody, nil
+	}
+	respBody, err := backoff.RetryNotifyWithData(func() ([]byte, error) {
+		respBody, err := attempt()
+		lastErr = err
+		return respBody, err
 	},
 		backoff.WithContext(
-			backoff.WithMaxRetries(
-				backoff.NewConstantBackOff(100*time.Millisecond),
-				3,
-			),
+			&retryAfterBackOff{
+				BackOff: backoff.WithMaxRetries(
+					backoff.NewConstantBackOff(100*time.Millisecond),
+					3,
+				),
+				lastErr: &lastErr,
+			},
 			ctx,
 		),
 		func(err error, _ time.Duration) {
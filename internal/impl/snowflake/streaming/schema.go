@@ -11,13 +11,17 @@
 package streaming
 
 import (
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/dustin/go-humanize"
 	"github.com/parquet-go/parquet-go"
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
 )
 
 type dataTransformer struct {
@@ -25,9 +29,48 @@ type dataTransformer struct {
 	column        *columnMetadata
 	bufferFactory typedBufferFactory
 	name          string
+	// Write null instead of failing when a value can't be converted, this is
+	// only ever set for nullable columns.
+	nullOnConversionError bool
+	// Maps the raw value of the column before it's converted, may be nil.
+	transform *bloblang.Executor
 }
 
-func convertFixedType(column columnMetadata) (parquet.Node, dataConverter, typedBufferFactory, error) {
+// identityConverter rejects values for identity columns, which are always
+// generated by Snowflake, so rows can only omit them.
+type identityConverter struct {
+	dataConverter
+}
+
+func (c identityConverter) ValidateAndConvert(stats *statsBuffer, val any, buf typedBuffer) error {
+	if val != nil {
+		return errors.New("values can't be specified for identity columns")
+	}
+	return c.dataConverter.ValidateAndConvert(stats, nil, buf)
+}
+
+// ignoredColumnNames returns the names of the columns that are excluded from
+// ingestion in the form message keys are matched against them.
+func ignoredColumnNames(opts ChannelOptions) map[string]struct{} {
+	normalize := normalizeColumnName
+	if opts.CaseSensitiveColumns {
+		normalize = normalizeColumnNameCaseSensitive
+	}
+	ignored := make(map[string]struct{}, len(opts.IgnoreColumns))
+	for _, name := range opts.IgnoreColumns {
+		ignored[normalize(name)] = struct{}{}
+	}
+	return ignored
+}
+
+// convertFixedType returns the parquet type of a NUMBER column along with the
+// physical type that is reported for it in the file metadata. When the
+// precision of the column is known, values are written with the narrowest
+// physical type that can hold every value of that precision: INT32 up to a
+// precision of 9, INT64 up to 18 and a 16 byte fixed length array above that.
+// The converter validates values against the precision, so they can't be
+// truncated by the narrower types.
+func convertFixedType(column columnMetadata) (parquet.Node, dataConverter, typedBufferFactory, string, error) {
 	var scale int32
 	var precision int32
 	if column.Scale != nil {
@@ -37,68 +80,142 @@ func convertFixedType(column columnMetadata) (parquet.Node, dataConverter, typed
 		precision = *column.Precision
 	}
 	isDecimal := column.Scale != nil && column.Precision != nil
-	if (column.Scale != nil && *column.Scale != 0) || strings.ToUpper(column.PhysicalType) == "SB16" {
-		c := numberConverter{nullable: column.Nullable, scale: scale, precision: precision}
-		b := defaultTypedBufferFactory
-		t := parquet.FixedLenByteArrayType(16)
-		if isDecimal {
-			return parquet.Decimal(int(scale), int(precision), t), c, b, nil
+	physicalType := strings.ToUpper(column.PhysicalType)
+	if isDecimal {
+		byteWidth := byteWidthForPrecision(precision)
+		if physicalTypeByteWidth(physicalType) != byteWidth {
+			physicalType = physicalTypeForByteWidth(byteWidth)
 		}
-		return parquet.Leaf(t), c, b, nil
+		ptype, bufferFactory := parquetTypeForByteWidth(byteWidth)
+		c := numberConverter{nullable: column.Nullable, scale: scale, precision: precision}
+		return parquet.Decimal(int(scale), int(precision), ptype), c, bufferFactory, physicalType, nil
+	}
+	if scale != 0 || physicalType == "SB16" {
+		c := numberConverter{nullable: column.Nullable, scale: scale, precision: precision}
+		return parquet.Leaf(parquet.FixedLenByteArrayType(16)), c, defaultTypedBufferFactory, physicalType, nil
 	}
-	var ptype parquet.Type
-	var defaultPrecision int32
-	var bufferFactory typedBufferFactory
-	switch strings.ToUpper(column.PhysicalType) {
+	var byteWidth int
+	switch physicalType {
 	case "SB1":
-		ptype = parquet.Int32Type
-		defaultPrecision = maxPrecisionForByteWidth(1)
-		bufferFactory = int32TypedBufferFactory
+		byteWidth = 1
 	case "SB2":
-		ptype = parquet.Int32Type
-		defaultPrecision = maxPrecisionForByteWidth(2)
-		bufferFactory = int32TypedBufferFactory
+		byteWidth = 2
 	case "SB4":
-		ptype = parquet.Int32Type
-		defaultPrecision = maxPrecisionForByteWidth(4)
-		bufferFactory = int32TypedBufferFactory
+		byteWidth = 4
 	case "SB8":
-		ptype = parquet.Int64Type
-		defaultPrecision = maxPrecisionForByteWidth(8)
-		bufferFactory = int64TypedBufferFactory
+		byteWidth = 8
 	default:
-		return nil, nil, nil, fmt.Errorf("unsupported physical column type: %s", column.PhysicalType)
+		return nil, nil, nil, "", fmt.Errorf("unsupported physical column type: %s", column.PhysicalType)
 	}
-	validationPrecision := precision
 	if column.Precision == nil {
-		validationPrecision = defaultPrecision
+		precision = maxPrecisionForByteWidth(byteWidth)
 	}
-	c := numberConverter{nullable: column.Nullable, scale: scale, precision: validationPrecision}
-	if isDecimal {
-		return parquet.Decimal(int(scale), int(precision), ptype), c, bufferFactory, nil
+	ptype, bufferFactory := parquetTypeForByteWidth(byteWidth)
+	c := numberConverter{nullable: column.Nullable, scale: scale, precision: precision}
+	return parquet.Leaf(ptype), c, bufferFactory, physicalType, nil
+}
+
+// parquetTypeForByteWidth returns the parquet type and buffer for integers of
+// the given byte width, parquet has no integer types narrower than INT32.
+func parquetTypeForByteWidth(byteWidth int) (parquet.Type, typedBufferFactory) {
+	switch {
+	case byteWidth <= 4:
+		return parquet.Int32Type, int32TypedBufferFactory
+	case byteWidth <= 8:
+		return parquet.Int64Type, int64TypedBufferFactory
+	}
+	return parquet.FixedLenByteArrayType(16), defaultTypedBufferFactory
+}
+
+// byteWidthForPrecision returns the width of the narrowest parquet integer
+// type that can hold every decimal of the given precision.
+func byteWidthForPrecision(precision int32) int {
+	switch {
+	case precision <= maxPrecisionForByteWidth(4):
+		return 4
+	case precision <= maxPrecisionForByteWidth(8):
+		return 8
 	}
-	return parquet.Leaf(ptype), c, bufferFactory, nil
+	return 16
+}
+
+// physicalTypeByteWidth returns the width of the parquet type which is used
+// for a Snowflake physical type, or zero if it isn't an integer type.
+func physicalTypeByteWidth(physicalType string) int {
+	switch physicalType {
+	case "SB1", "SB2", "SB4":
+		return 4
+	case "SB8":
+		return 8
+	case "SB16":
+		return 16
+	}
+	return 0
+}
+
+func physicalTypeForByteWidth(byteWidth int) string {
+	switch byteWidth {
+	case 4:
+		return "SB4"
+	case 8:
+		return "SB8"
+	}
+	return "SB16"
 }
 
 // maxJSONSize is the size that any kind of semi-structured data can be, which is 16MiB minus a small overhead
 const maxJSONSize = 16*humanize.MiByte - 64
 
 // See ParquetTypeGenerator
-func constructParquetSchema(columns []columnMetadata) (*parquet.Schema, []*dataTransformer, map[string]string, error) {
+func constructParquetSchema(columns []columnMetadata, opts ChannelOptions) (*parquet.Schema, []*dataTransformer, map[string]string, error) {
 	groupNode := parquet.Group{}
-	transformers := make([]*dataTransformer, len(columns))
+	transformers := make([]*dataTransformer, 0, len(columns))
 	// Don't write the sfVer key as it allows us to not have to narrow the numeric types in parquet.
 	typeMetadata := map[string]string{ /*"sfVer": "1,1"*/ }
+	caseInsensitiveNames := map[string]string{}
+	normalize := normalizeColumnName
+	if opts.CaseSensitiveColumns {
+		normalize = normalizeColumnNameCaseSensitive
+	}
+	columnConversionErrorModes := make(map[string]ConversionErrorMode, len(opts.ColumnConversionErrorModes))
+	for name, mode := range opts.ColumnConversionErrorModes {
+		columnConversionErrorModes[normalize(name)] = mode
+	}
+	// The original names of the transformed columns, so that the ones which
+	// don't match a column of the table can be reported.
+	transformNames := make(map[string]string, len(opts.ColumnTransforms))
+	for name := range opts.ColumnTransforms {
+		transformNames[normalize(name)] = name
+	}
+	// The original names of the columns with encoding overrides, so that
+	// the ones which don't match a column of the table can be reported.
+	encodingNames := make(map[string]string, len(opts.ColumnEncodings))
+	columnEncodings := make(map[string]ColumnEncoding, len(opts.ColumnEncodings))
+	for name, encoding := range opts.ColumnEncodings {
+		encodingNames[normalize(name)] = name
+		columnEncodings[normalize(name)] = encoding
+	}
+	ignored := ignoredColumnNames(opts)
 	var err error
-	for idx, column := range columns {
+	for _, column := range columns {
+		name := normalizeColumnName(column.Name)
+		if _, ok := ignored[name]; ok {
+			continue
+		}
+		// Rows may omit identity and default columns, in which case the value
+		// is generated by Snowflake, so they are written like nullable columns.
+		if column.Identity || column.HasDefault {
+			column.Nullable = true
+		}
 		id := int(column.Ordinal)
 		var n parquet.Node
 		var converter dataConverter
 		bufferFactory := defaultTypedBufferFactory
+		physicalType := column.PhysicalType
 		logicalType := strings.ToLower(column.LogicalType)
 		switch logicalType {
 		case "fixed":
-			n, converter, bufferFactory, err = convertFixedType(column)
+			n, converter, bufferFactory, physicalType, err = convertFixedType(column)
 			if err != nil {
 				return nil, nil, nil, err
 			}
@@ -131,6 +248,13 @@ func constructParquetSchema(columns []columnMetadata) (*parquet.Schema, []*dataT
 			}
 			byteLength = min(byteLength, 16*humanize.MiByte)
 			converter = binaryConverter{nullable: column.Nullable, maxLength: byteLength}
+		case "geography", "geometry":
+			n = parquet.String()
+			byteLength := maxJSONSize
+			if column.ByteLength != nil {
+				byteLength = min(int(*column.ByteLength), maxJSONSize)
+			}
+			converter = geoConverter{nullable: column.Nullable, maxLength: byteLength}
 		case "boolean":
 			n = parquet.Leaf(parquet.BooleanType)
 			converter = boolConverter{column.Nullable}
@@ -155,14 +279,15 @@ func constructParquetSchema(columns []columnMetadata) (*parquet.Schema, []*dataT
 			// the Java SDK also seems to not validate precision of timestamps
 			// so ignore it and use the default precision for the column type
 			n = parquet.Decimal(int(scale), int(precision), pt)
-			converter = timestampConverter{
-				nullable:  column.Nullable,
-				scale:     scale,
-				precision: precision,
-				includeTZ: logicalType == "timestamp_tz",
-				trimTZ:    logicalType == "timestamp_ntz",
-				defaultTZ: time.UTC,
-			}
+			converter = newTimestampConverter(
+				column.Nullable,
+				scale,
+				precision,
+				logicalType == "timestamp_tz",
+				logicalType == "timestamp_ntz",
+				opts.BuildOptions.ClampTimestamps,
+				time.UTC,
+			)
 		case "time":
 			t := parquet.Int32Type
 			precision := 9
@@ -177,10 +302,10 @@ func constructParquetSchema(columns []columnMetadata) (*parquet.Schema, []*dataT
 				scale = *column.Scale
 			}
 			n = parquet.Decimal(int(scale), precision, t)
-			converter = timeConverter{column.Nullable, scale}
+			converter = newTimeConverter(column.Nullable, scale)
 		case "date":
 			n = parquet.Leaf(parquet.Int32Type)
-			converter = dateConverter{column.Nullable}
+			converter = newDateConverter(column.Nullable, opts.BuildOptions.DateFormats, opts.BuildOptions.DateIntegerUnit)
 			bufferFactory = int32TypedBufferFactory
 		default:
 			return nil, nil, nil, fmt.Errorf("unsupported logical column type: %s", column.LogicalType)
@@ -189,22 +314,61 @@ func constructParquetSchema(columns []columnMetadata) (*parquet.Schema, []*dataT
 			n = parquet.Optional(n)
 		}
 		n = parquet.FieldID(n, id)
-		// Use plain encoding for now as there seems to be compatibility issues with the default settings
-		// we might be able to tune this more.
-		n = parquet.Encoded(n, &parquet.Plain)
+		// Use plain encoding by default as there seems to be compatibility issues with the default settings,
+		// dictionary encoding and the compression codec can be chosen for each column.
+		columnEncoding := columnEncodings[name]
+		delete(encodingNames, name)
+		if columnEncoding.Dictionary {
+			n = parquet.Encoded(n, &parquet.RLEDictionary)
+		} else {
+			n = parquet.Encoded(n, &parquet.Plain)
+		}
+		if columnEncoding.Compression != nil {
+			n = parquet.Compressed(n, columnEncoding.Compression)
+		}
 		typeMetadata[strconv.Itoa(id)] = fmt.Sprintf(
 			"%d,%d",
 			logicalTypeOrdinal(column.LogicalType),
-			physicalTypeOrdinal(column.PhysicalType),
+			physicalTypeOrdinal(physicalType),
 		)
-		name := normalizeColumnName(column.Name)
+		if !opts.CaseSensitiveColumns {
+			// Message keys are matched to columns case-insensitively, so they would be ambiguous.
+			if other, ok := caseInsensitiveNames[strings.ToUpper(name)]; ok {
+				return nil, nil, nil, fmt.Errorf("columns %s and %s have the same name when matched case-insensitively", other, column.Name)
+			}
+			caseInsensitiveNames[strings.ToUpper(name)] = column.Name
+		}
 		groupNode[name] = n
-		transformers[idx] = &dataTransformer{
-			name:          name,
-			converter:     converter,
-			column:        &column,
-			bufferFactory: bufferFactory,
+		conversionErrorMode := opts.ConversionErrorMode
+		if mode, ok := columnConversionErrorModes[name]; ok {
+			conversionErrorMode = mode
+		}
+		if column.Identity {
+			converter = identityConverter{converter}
 		}
+		var transform *bloblang.Executor
+		if transformName, ok := transformNames[name]; ok {
+			transform = opts.ColumnTransforms[transformName]
+			delete(transformNames, name)
+		}
+		transformers = append(transformers, &dataTransformer{
+			name:                  name,
+			converter:             converter,
+			column:                &column,
+			bufferFactory:         bufferFactory,
+			nullOnConversionError: conversionErrorMode == ConversionErrorModeNull && column.Nullable && !column.Identity,
+			transform:             transform,
+		})
+	}
+	if len(transformNames) > 0 {
+		// Transforms of columns that aren't ingested would silently let the
+		// raw values through if the column is added later.
+		unknown := slices.Sorted(maps.Values(transformNames))
+		return nil, nil, nil, fmt.Errorf("unknown column %q in column transforms for table %s", unknown[0], opts.TableName)
+	}
+	if len(encodingNames) > 0 {
+		unknown := slices.Sorted(maps.Values(encodingNames))
+		return nil, nil, nil, fmt.Errorf("unknown column %q in column encodings for table %s", unknown[0], opts.TableName)
 	}
 	return parquet.NewSchema("bdec", groupNode), transformers, typeMetadata, nil
 }
@@ -80,14 +80,21 @@ var _ SchemaMismatchError = &MissingColumnError{}
 // MissingColumnError occurs when a column that is not in the table is
 // found on a record
 type MissingColumnError struct {
-	message    *service.Message
-	columnName string
-	val        any
+	message       *service.Message
+	columnName    string
+	val           any
+	caseSensitive bool
 }
 
 // NewMissingColumnError creates a new MissingColumnError object
 func NewMissingColumnError(message *service.Message, rawName string, val any) *MissingColumnError {
-	return &MissingColumnError{message, rawName, val}
+	return &MissingColumnError{message, rawName, val, false}
+}
+
+// NewCaseSensitiveMissingColumnError creates a new MissingColumnError object
+// for a column name which preserves its case when it's quoted
+func NewCaseSensitiveMissingColumnError(message *service.Message, rawName string, val any) *MissingColumnError {
+	return &MissingColumnError{message, rawName, val, true}
 }
 
 // Message returns the message that caused this error
@@ -100,6 +107,9 @@ func (e *MissingColumnError) Message() *service.Message {
 // NOTE this is escaped, so it's valid to use this directly in a SQL statement
 // but I wish that Snowflake would just allow `identifier` for ALTER column.
 func (e *MissingColumnError) ColumnName() string {
+	if e.caseSensitive {
+		return quoteColumnNameCaseSensitive(e.columnName)
+	}
 	return quoteColumnName(e.columnName)
 }
 
@@ -0,0 +1,164 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package streaming
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/snowflake/streaming/int128"
+)
+
+// rowSorter orders the rows of a file by the converted values of the sort
+// columns, which clusters the rows of each file by the clustering key of the
+// table so that Snowflake can prune more micro-partitions.
+type rowSorter struct {
+	// The indexes of the sort columns in each row, in order of precedence.
+	columns    []int
+	nullsFirst bool
+}
+
+// newRowSorter resolves the sort columns of the channel against the columns of
+// the table, it returns nil when no sort columns are configured.
+func newRowSorter(schema *parquet.Schema, transformers []*dataTransformer, opts ChannelOptions) (*rowSorter, error) {
+	if len(opts.SortColumns) == 0 {
+		return nil, nil
+	}
+	normalize := normalizeColumnName
+	if opts.CaseSensitiveColumns {
+		normalize = normalizeColumnNameCaseSensitive
+	}
+	s := &rowSorter{nullsFirst: opts.SortNullsFirst}
+	for _, name := range opts.SortColumns {
+		idx := slices.IndexFunc(transformers, func(t *dataTransformer) bool {
+			return t.name == normalize(name)
+		})
+		if idx < 0 {
+			return nil, fmt.Errorf("unknown sort column %q for table %s", name, opts.TableName)
+		}
+		leaf, ok := schema.Lookup(transformers[idx].name)
+		if !ok {
+			return nil, fmt.Errorf("invariant failed: unable to find column %q", transformers[idx].name)
+		}
+		s.columns = append(s.columns, leaf.ColumnIndex)
+	}
+	return s, nil
+}
+
+// sort orders rows by the sort columns, rows with the same values keep the
+// order of their messages. The position of each row after sorting is returned
+// in the order the rows were given.
+func (s *rowSorter) sort(rows []parquet.Row) []int32 {
+	// The values of the sort columns are extracted into compact keys and the
+	// indexes of the rows are sorted with ties broken by index, which is much
+	// faster than a stable sort of the rows as it avoids chasing the pointers
+	// of the rows and their values on every comparison.
+	keys := make([]sortKeys, len(s.columns))
+	for i, col := range s.columns {
+		keys[i] = newSortKeys(rows, col)
+	}
+	order := make([]int32, len(rows))
+	for i := range order {
+		order[i] = int32(i)
+	}
+	slices.SortFunc(order, func(a, b int32) int {
+		for i := range keys {
+			if c := keys[i].compare(a, b, s.nullsFirst); c != 0 {
+				return c
+			}
+		}
+		return cmp.Compare(a, b)
+	})
+	sorted := make([]parquet.Row, len(rows))
+	positions := make([]int32, len(rows))
+	for i, idx := range order {
+		sorted[i] = rows[idx]
+		positions[idx] = int32(i)
+	}
+	copy(rows, sorted)
+	return positions
+}
+
+// sortKeys holds the values of a column of every row in the form they are
+// compared in, only one of the slices is used depending on the kind of the
+// values. Numbers, booleans and timestamps, including numbers written as 16
+// byte arrays, are compared as 128 bit integers and other byte arrays, which
+// hold strings and binary values, are compared bytewise.
+type sortKeys struct {
+	nulls  []bool
+	ints   []int128.Num
+	floats []float64
+	bytes  [][]byte
+}
+
+func newSortKeys(rows []parquet.Row, col int) sortKeys {
+	k := sortKeys{nulls: make([]bool, len(rows))}
+	kind := parquet.Kind(-1)
+	for i, row := range rows {
+		v := row[col]
+		if v.IsNull() {
+			k.nulls[i] = true
+			continue
+		}
+		if kind < 0 {
+			kind = v.Kind()
+			switch kind {
+			case parquet.Double:
+				k.floats = make([]float64, len(rows))
+			case parquet.ByteArray:
+				k.bytes = make([][]byte, len(rows))
+			default:
+				k.ints = make([]int128.Num, len(rows))
+			}
+		}
+		switch kind {
+		case parquet.Boolean:
+			if v.Boolean() {
+				k.ints[i] = int128.FromInt64(1)
+			}
+		case parquet.Int32:
+			k.ints[i] = int128.FromInt64(int64(v.Int32()))
+		case parquet.Int64:
+			k.ints[i] = int128.FromInt64(v.Int64())
+		case parquet.FixedLenByteArray:
+			k.ints[i] = int128.FromBigEndian(v.ByteArray())
+		case parquet.Double:
+			k.floats[i] = v.Double()
+		default:
+			k.bytes[i] = v.ByteArray()
+		}
+	}
+	return k
+}
+
+func (k *sortKeys) compare(a, b int32, nullsFirst bool) int {
+	switch aNull, bNull := k.nulls[a], k.nulls[b]; {
+	case aNull && bNull:
+		return 0
+	case aNull != bNull:
+		if aNull == nullsFirst {
+			return -1
+		}
+		return 1
+	}
+	switch {
+	case k.ints != nil:
+		return int128.Compare(k.ints[a], k.ints[b])
+	case k.floats != nil:
+		return cmp.Compare(k.floats[a], k.floats[b])
+	default:
+		return bytes.Compare(k.bytes[a], k.bytes[b])
+	}
+}
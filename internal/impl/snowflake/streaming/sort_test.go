@@ -0,0 +1,143 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package streaming
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/aws/smithy-go/ptr"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/require"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/snowflake/streaming/int128"
+)
+
+func sortTestSchema(t *testing.T, opts ChannelOptions) (*parquet.Schema, []*dataTransformer, *rowSorter) {
+	t.Helper()
+	columns := []columnMetadata{
+		{Name: "SEQ", Ordinal: 1, Type: "NUMBER(18,0)", LogicalType: "fixed", PhysicalType: "SB8", Precision: ptr.Int32(18), Scale: ptr.Int32(0), Nullable: true},
+		{Name: "ID", Ordinal: 2, Type: "NUMBER(38,0)", LogicalType: "fixed", PhysicalType: "SB16", Precision: ptr.Int32(38), Scale: ptr.Int32(0), Nullable: true},
+		{Name: "NAME", Ordinal: 3, Type: "VARCHAR(16777216)", LogicalType: "text", PhysicalType: "LOB", Nullable: true},
+		{Name: "TS", Ordinal: 4, Type: "TIMESTAMP_NTZ(9)", LogicalType: "timestamp_ntz", PhysicalType: "SB16", Scale: ptr.Int32(9), Nullable: true},
+	}
+	opts.TableName = "MY_TABLE"
+	schema, transformers, _, err := constructParquetSchema(columns, opts)
+	require.NoError(t, err)
+	sorter, err := newRowSorter(schema, transformers, opts)
+	require.NoError(t, err)
+	return schema, transformers, sorter
+}
+
+func TestRowSorter(t *testing.T) {
+	batch := testBatch([][]byte{
+		[]byte(`{"seq": 0, "id": 5, "name": "b", "ts": "2024-01-01T00:00:02Z"}`),
+		[]byte(`{"seq": 1, "id": -99999999999999999999999999999999999999, "name": "b", "ts": "2024-01-01T00:00:01Z"}`),
+		[]byte(`{"seq": 2, "id": null, "name": "a", "ts": "2023-12-31T23:00:00-02:00"}`),
+		[]byte(`{"seq": 3, "id": 99999999999999999999999999999999999999, "name": null, "ts": null}`),
+		[]byte(`{"seq": 4, "id": -1, "name": "a", "ts": "1969-12-31T23:59:59Z"}`),
+		[]byte(`{"seq": 5, "id": 5, "name": "ab", "ts": "2024-01-01T00:00:02Z"}`),
+		[]byte(`{"seq": 6, "id": -1, "name": "b", "ts": "2024-01-01T00:00:00Z"}`),
+	})
+
+	tests := []struct {
+		name     string
+		opts     ChannelOptions
+		expected []int64
+	}{
+		{
+			name:     "numbers",
+			opts:     ChannelOptions{SortColumns: []string{"id"}},
+			expected: []int64{1, 4, 6, 0, 5, 3, 2},
+		},
+		{
+			name:     "numbers with nulls first",
+			opts:     ChannelOptions{SortColumns: []string{"ID"}, SortNullsFirst: true},
+			expected: []int64{2, 1, 4, 6, 0, 5, 3},
+		},
+		{
+			name:     "strings then numbers",
+			opts:     ChannelOptions{SortColumns: []string{"name", "id"}},
+			expected: []int64{4, 2, 5, 1, 6, 0, 3},
+		},
+		{
+			name:     "timestamps",
+			opts:     ChannelOptions{SortColumns: []string{"ts"}},
+			expected: []int64{4, 6, 1, 0, 5, 2, 3},
+		},
+		{
+			name:     "quoted column",
+			opts:     ChannelOptions{SortColumns: []string{`"NAME"`}, SortNullsFirst: true},
+			expected: []int64{3, 2, 4, 5, 0, 1, 6},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schema, transformers, sorter := sortTestSchema(t, test.opts)
+			rows, _, err := constructRowGroup(batch, schema, transformers, nil, SchemaModeIgnoreExtra, false, false, 1)
+			require.NoError(t, err)
+			positions := sorter.sort(rows)
+
+			seq, ok := schema.Lookup("SEQ")
+			require.True(t, ok)
+			var actual []int64
+			for i, row := range rows {
+				actual = append(actual, row[seq.ColumnIndex].Int64())
+				require.Equal(t, int32(i), positions[row[seq.ColumnIndex].Int64()])
+			}
+			require.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestRowSorterUnknownColumn(t *testing.T) {
+	schema, transformers, sorter := sortTestSchema(t, ChannelOptions{})
+	require.Nil(t, sorter)
+
+	_, err := newRowSorter(schema, transformers, ChannelOptions{TableName: "MY_TABLE", SortColumns: []string{"id", "missing"}})
+	require.EqualError(t, err, `unknown sort column "missing" for table MY_TABLE`)
+
+	// Case sensitive columns don't match unquoted names in a different case.
+	_, err = newRowSorter(schema, transformers, ChannelOptions{TableName: "MY_TABLE", SortColumns: []string{"id"}, CaseSensitiveColumns: true})
+	require.EqualError(t, err, `unknown sort column "id" for table MY_TABLE`)
+}
+
+func BenchmarkRowSorter(b *testing.B) {
+	const rowCount = 1_000_000
+	rng := rand.New(rand.NewPCG(1, 1))
+	rows := make([]parquet.Row, rowCount)
+	for i := range rows {
+		id := int128.FromInt64(rng.Int64N(1_000_000) - 500_000)
+		name := parquet.ByteArrayValue(fmt.Appendf(nil, "customer-%d", rng.IntN(10_000))).Level(0, 1, 1)
+		if rng.IntN(50) == 0 {
+			name = parquet.NullValue()
+		}
+		rows[i] = parquet.Row{
+			name,
+			parquet.FixedLenByteArrayValue(id.ToBigEndian()).Level(0, 1, 1),
+		}
+	}
+
+	for _, columns := range [][]int{{1}, {0, 1}} {
+		b.Run(fmt.Sprintf("columns=%d", len(columns)), func(b *testing.B) {
+			sorter := &rowSorter{columns: columns}
+			unsorted := make([]parquet.Row, rowCount)
+			b.ReportAllocs()
+			for range b.N {
+				b.StopTimer()
+				copy(unsorted, rows)
+				b.StartTimer()
+				sorter.sort(unsorted)
+			}
+		})
+	}
+}
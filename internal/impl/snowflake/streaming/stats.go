@@ -12,6 +12,7 @@ package streaming
 
 import (
 	"bytes"
+	"strings"
 
 	"github.com/redpanda-data/connect/v4/internal/impl/snowflake/streaming/int128"
 )
@@ -23,9 +24,28 @@ type statsBuffer struct {
 	maxStrLen              int
 	nullCount              int64
 	hasData                bool
+	// The number of values that failed conversion and were written as null,
+	// these are also included in nullCount.
+	conversionErrors int64
+	// The number of timestamps that were outside of the supported range
+	// and were replaced with the closest boundary.
+	clampedValues int64
+	// ndv is nil unless distinct value counting is enabled
+	ndv *hyperLogLog
+}
+
+func newStatsBuffer(collectNDV bool) *statsBuffer {
+	s := &statsBuffer{}
+	if collectNDV {
+		s.ndv = newHyperLogLog()
+	}
+	return s
 }
 
 func (s *statsBuffer) UpdateIntStats(v int128.Num) {
+	if s.ndv != nil {
+		s.ndv.AddInt(v)
+	}
 	if !s.hasData {
 		s.minIntVal = v
 		s.maxIntVal = v
@@ -37,6 +57,9 @@ func (s *statsBuffer) UpdateIntStats(v int128.Num) {
 }
 
 func (s *statsBuffer) UpdateFloat64Stats(v float64) {
+	if s.ndv != nil {
+		s.ndv.AddFloat64(v)
+	}
 	if !s.hasData {
 		s.minRealVal = v
 		s.maxRealVal = v
@@ -48,6 +71,9 @@ func (s *statsBuffer) UpdateFloat64Stats(v float64) {
 }
 
 func (s *statsBuffer) UpdateBytesStats(v []byte) {
+	if s.ndv != nil {
+		s.ndv.AddBytes(v)
+	}
 	if !s.hasData {
 		s.minStrVal = v
 		s.maxStrVal = v
@@ -64,60 +90,143 @@ func (s *statsBuffer) UpdateBytesStats(v []byte) {
 	}
 }
 
-func mergeStats(a, b *statsBuffer) *statsBuffer {
-	c := &statsBuffer{hasData: true}
+// reset clears the stats so that they can be collected again, reusing the
+// memory of the distinct values sketch.
+func (s *statsBuffer) reset(collectNDV bool) {
+	ndv := s.ndv
+	*s = statsBuffer{}
+	if !collectNDV {
+		return
+	}
+	if ndv == nil {
+		ndv = newHyperLogLog()
+	} else {
+		clear(ndv.registers)
+	}
+	s.ndv = ndv
+}
+
+// merge adds the stats of o to s.
+func (s *statsBuffer) merge(o *statsBuffer) {
 	switch {
-	case a.hasData && b.hasData:
-		c.minIntVal = int128.Min(a.minIntVal, b.minIntVal)
-		c.maxIntVal = int128.Max(a.maxIntVal, b.maxIntVal)
-		c.minRealVal = min(a.minRealVal, b.minRealVal)
-		c.maxRealVal = max(a.maxRealVal, b.maxRealVal)
-		c.maxStrLen = max(a.maxStrLen, b.maxStrLen)
-		c.minStrVal = a.minStrVal
-		if bytes.Compare(b.minStrVal, a.minStrVal) < 0 {
-			c.minStrVal = b.minStrVal
+	case s.hasData && o.hasData:
+		s.minIntVal = int128.Min(s.minIntVal, o.minIntVal)
+		s.maxIntVal = int128.Max(s.maxIntVal, o.maxIntVal)
+		s.minRealVal = min(s.minRealVal, o.minRealVal)
+		s.maxRealVal = max(s.maxRealVal, o.maxRealVal)
+		s.maxStrLen = max(s.maxStrLen, o.maxStrLen)
+		if bytes.Compare(o.minStrVal, s.minStrVal) < 0 {
+			s.minStrVal = o.minStrVal
 		}
-		c.maxStrVal = a.maxStrVal
-		if bytes.Compare(b.maxStrVal, a.maxStrVal) > 0 {
-			c.maxStrVal = b.maxStrVal
+		if bytes.Compare(o.maxStrVal, s.maxStrVal) > 0 {
+			s.maxStrVal = o.maxStrVal
 		}
-	case a.hasData:
-		*c = *a
-	case b.hasData:
-		*c = *b
-	default:
-		c.hasData = false
+	case o.hasData:
+		s.minIntVal, s.maxIntVal = o.minIntVal, o.maxIntVal
+		s.minRealVal, s.maxRealVal = o.minRealVal, o.maxRealVal
+		s.minStrVal, s.maxStrVal = o.minStrVal, o.maxStrVal
+		s.maxStrLen = o.maxStrLen
+		s.hasData = true
 	}
-	c.nullCount = a.nullCount + b.nullCount
+	s.nullCount += o.nullCount
+	s.conversionErrors += o.conversionErrors
+	s.clampedValues += o.clampedValues
+	if o.ndv != nil {
+		if s.ndv == nil {
+			s.ndv = newHyperLogLog()
+		}
+		s.ndv.mergeFrom(o.ndv)
+	}
+}
+
+func mergeStats(a, b *statsBuffer) *statsBuffer {
+	c := &statsBuffer{}
+	c.merge(a)
+	c.merge(b)
 	return c
 }
 
-func computeColumnEpInfo(transformers []*dataTransformer, stats []*statsBuffer) map[string]fileColumnProperties {
-	info := map[string]fileColumnProperties{}
+// computeColumnDistinctValues returns the estimated number of distinct values
+// for each column, or nil if distinct values were not collected.
+func computeColumnDistinctValues(transformers []*dataTransformer, stats []*statsBuffer) map[string]int64 {
+	var ndv map[string]int64
+	for idx, transformer := range transformers {
+		stat := stats[idx]
+		if stat.ndv == nil {
+			continue
+		}
+		if ndv == nil {
+			ndv = map[string]int64{}
+		}
+		ndv[transformer.column.Name] = stat.ndv.Estimate()
+	}
+	return ndv
+}
+
+// computeColumnConversionErrors returns the number of values of each column
+// that failed conversion and were written as null, or nil if there were none.
+func computeColumnConversionErrors(transformers []*dataTransformer, stats []*statsBuffer) map[string]int64 {
+	var errs map[string]int64
 	for idx, transformer := range transformers {
 		stat := stats[idx]
-		var minStrVal *string = nil
-		if stat.minStrVal != nil {
-			s := truncateBytesAsHex(stat.minStrVal, false)
-			minStrVal = &s
+		if stat.conversionErrors == 0 {
+			continue
 		}
-		var maxStrVal *string = nil
-		if stat.maxStrVal != nil {
-			s := truncateBytesAsHex(stat.maxStrVal, true)
-			maxStrVal = &s
+		if errs == nil {
+			errs = map[string]int64{}
 		}
-		info[transformer.column.Name] = fileColumnProperties{
+		errs[transformer.column.Name] = stat.conversionErrors
+	}
+	return errs
+}
+
+// computeColumnClampedValues returns the number of timestamps of each column
+// that were clamped to the supported range, or nil if there were none.
+func computeColumnClampedValues(transformers []*dataTransformer, stats []*statsBuffer) map[string]int64 {
+	var clamped map[string]int64
+	for idx, transformer := range transformers {
+		stat := stats[idx]
+		if stat.clampedValues == 0 {
+			continue
+		}
+		if clamped == nil {
+			clamped = map[string]int64{}
+		}
+		clamped[transformer.column.Name] = stat.clampedValues
+	}
+	return clamped
+}
+
+// computeColumnEpInfo returns the properties of each column which are
+// registered with the file. The min and max values are left unset for columns
+// which only contain nulls, as there is no value for them to be derived from.
+func computeColumnEpInfo(transformers []*dataTransformer, stats []*statsBuffer) map[string]fileColumnProperties {
+	info := map[string]fileColumnProperties{}
+	for idx, transformer := range transformers {
+		stat := stats[idx]
+		props := fileColumnProperties{
 			ColumnOrdinal:  transformer.column.Ordinal,
 			NullCount:      stat.nullCount,
-			MinStrValue:    minStrVal,
-			MaxStrValue:    maxStrVal,
-			MaxLength:      int64(stat.maxStrLen),
-			MinIntValue:    stat.minIntVal,
-			MaxIntValue:    stat.maxIntVal,
-			MinRealValue:   stat.minRealVal,
-			MaxRealValue:   stat.maxRealVal,
 			DistinctValues: -1,
 		}
+		if stat.hasData {
+			// Everything but binary columns is stored as UTF-8, so the truncated stats must be valid UTF-8 too.
+			isUTF8 := !strings.EqualFold(transformer.column.LogicalType, "binary")
+			if stat.minStrVal != nil {
+				s := truncateBytesAsHex(stat.minStrVal, false, isUTF8)
+				props.MinStrValue = &s
+			}
+			if stat.maxStrVal != nil {
+				s := truncateBytesAsHex(stat.maxStrVal, true, isUTF8)
+				props.MaxStrValue = &s
+			}
+			props.MaxLength = int64(stat.maxStrLen)
+			props.MinIntValue = &stat.minIntVal
+			props.MaxIntValue = &stat.maxIntVal
+			props.MinRealValue = &stat.minRealVal
+			props.MaxRealValue = &stat.maxRealVal
+		}
+		info[transformer.column.Name] = props
 	}
 	return info
 }
@@ -11,6 +11,7 @@
 package streaming
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -35,6 +36,21 @@ func TestMergeInt(t *testing.T) {
 	}, s)
 }
 
+func TestStatsReset(t *testing.T) {
+	s := newStatsBuffer(true)
+	s.UpdateBytesStats([]byte("foo"))
+	s.nullCount = 2
+	ndv := s.ndv
+
+	// The sketch is cleared and kept for the next stats.
+	s.reset(true)
+	require.Same(t, ndv, s.ndv)
+	require.Equal(t, &statsBuffer{ndv: newHyperLogLog()}, s)
+
+	s.reset(false)
+	require.Equal(t, &statsBuffer{}, s)
+}
+
 func TestMergeReal(t *testing.T) {
 	s := mergeStats(&statsBuffer{
 		minRealVal: -1.2,
@@ -77,3 +93,79 @@ func TestMergeStr(t *testing.T) {
 		hasData:   true,
 	}, s)
 }
+
+func TestAllNullColumnStats(t *testing.T) {
+	tests := []struct {
+		name        string
+		converter   dataConverter
+		logicalType string
+		value       any
+	}{
+		{name: "int", converter: numberConverter{nullable: true, scale: 0, precision: 38}, logicalType: "fixed", value: 0},
+		{name: "float", converter: doubleConverter{nullable: true}, logicalType: "real", value: 0.0},
+		{name: "bytes", converter: binaryConverter{nullable: true, maxLength: 16, utf8: true}, logicalType: "text", value: ""},
+		{name: "bool", converter: boolConverter{nullable: true}, logicalType: "boolean", value: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			transformers := []*dataTransformer{{
+				name:      "A",
+				converter: tc.converter,
+				column:    &columnMetadata{Name: "A", Ordinal: 1, LogicalType: tc.logicalType, Nullable: true},
+			}}
+
+			nulls := newStatsBuffer(false)
+			for range 3 {
+				require.NoError(t, tc.converter.ValidateAndConvert(nulls, nil, &testTypedBuffer{}))
+			}
+			require.False(t, nulls.hasData)
+			require.Equal(t, int64(3), nulls.nullCount)
+
+			// The min and max values of a column without values are null,
+			// rather than the zero values.
+			info := computeColumnEpInfo(transformers, []*statsBuffer{nulls})
+			require.Equal(t, fileColumnProperties{ColumnOrdinal: 1, NullCount: 3, DistinctValues: -1}, info["A"])
+			b, err := json.Marshal(info["A"])
+			require.NoError(t, err)
+			require.JSONEq(t, `{
+				"columnId": 1,
+				"minStrValue": null,
+				"maxStrValue": null,
+				"minIntValue": null,
+				"maxIntValue": null,
+				"minRealValue": null,
+				"maxRealValue": null,
+				"nullCount": 3,
+				"distinctValues": -1,
+				"maxLength": 0,
+				"collation": null,
+				"minStrNonCollated": null,
+				"maxStrNonCollated": null
+			}`, string(b))
+
+			// Merging the stats of files with only nulls doesn't make up
+			// values either.
+			merged := mergeStats(nulls, nulls)
+			require.False(t, merged.hasData)
+			require.Nil(t, computeColumnEpInfo(transformers, []*statsBuffer{merged})["A"].MinIntValue)
+
+			// A zero value is still reported as a value.
+			values := newStatsBuffer(false)
+			require.NoError(t, tc.converter.ValidateAndConvert(values, tc.value, &testTypedBuffer{}))
+			merged = mergeStats(nulls, values)
+			require.True(t, merged.hasData)
+			props := computeColumnEpInfo(transformers, []*statsBuffer{merged})["A"]
+			require.Equal(t, int64(3), props.NullCount)
+			require.NotNil(t, props.MinIntValue)
+			require.NotNil(t, props.MaxIntValue)
+			require.NotNil(t, props.MinRealValue)
+			require.NotNil(t, props.MaxRealValue)
+			if tc.name == "bytes" {
+				require.Equal(t, "", *props.MinStrValue)
+				require.Equal(t, "", *props.MaxStrValue)
+			} else {
+				require.Nil(t, props.MinStrValue)
+			}
+		})
+	}
+}
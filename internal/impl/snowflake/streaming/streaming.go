@@ -18,15 +18,18 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"math/rand/v2"
+	"hash/fnv"
 	"os"
 	"path"
+	"slices"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
 	"github.com/parquet-go/parquet-go"
-	"github.com/parquet-go/parquet-go/format"
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
 	"github.com/redpanda-data/benthos/v4/public/service"
 	"golang.org/x/sync/errgroup"
 
@@ -47,6 +50,8 @@ type ClientOptions struct {
 	Role string
 	// Private key for the user
 	PrivateKey *rsa.PrivateKey
+	// Source of the private key for the user, which replaces PrivateKey when set
+	PrivateKeySource *PrivateKeySource
 	// Logger for... logging?
 	Logger *service.Logger
 	// Connect version for the User-Agent in Snowflake
@@ -62,6 +67,7 @@ type SnowflakeServiceClient struct {
 	requestIDCounter *atomic.Int64
 
 	uploaderManager *uploaderManager
+	partialInserts  *partialInserts
 
 	flusher *asyncroutine.Batcher[blobMetadata, blobRegisterStatus]
 }
@@ -69,12 +75,13 @@ type SnowflakeServiceClient struct {
 // NewSnowflakeServiceClient creates a new API client for the Snowpipe Streaming API
 func NewSnowflakeServiceClient(ctx context.Context, opts ClientOptions) (*SnowflakeServiceClient, error) {
 	client, err := NewRestClient(RestOptions{
-		Account:    opts.Account,
-		URL:        opts.URL,
-		User:       opts.User,
-		Version:    opts.ConnectVersion,
-		PrivateKey: opts.PrivateKey,
-		Logger:     opts.Logger,
+		Account:          opts.Account,
+		URL:              opts.URL,
+		User:             opts.User,
+		Version:          opts.ConnectVersion,
+		PrivateKey:       opts.PrivateKey,
+		PrivateKeySource: opts.PrivateKeySource,
+		Logger:           opts.Logger,
 	})
 	if err != nil {
 		return nil, err
@@ -100,6 +107,7 @@ func NewSnowflakeServiceClient(ctx context.Context, opts ClientOptions) (*Snowfl
 		options:      opts,
 
 		uploaderManager:  um,
+		partialInserts:   newPartialInserts(),
 		requestIDCounter: &atomic.Int64{},
 	}
 	// Flush up to 100 blobs at once, that seems like a fairly high upper bound
@@ -135,7 +143,7 @@ func (c *SnowflakeServiceClient) registerBlobs(ctx context.Context, metadata []b
 		return nil, err
 	}
 	if resp.StatusCode != responseSuccess {
-		return nil, fmt.Errorf("unable to register blobs - status: %d, message: %s", resp.StatusCode, resp.Message)
+		return nil, fmt.Errorf("unable to register blobs: %w", &APIError{StatusCode: int(resp.StatusCode), Message: resp.Message})
 	}
 	return resp.Blobs, nil
 }
@@ -146,6 +154,33 @@ type BuildOptions struct {
 	Parallelism int
 	// The number of rows to chunk for parallelism
 	ChunkSize int
+	// The maximum number of columns of each chunk that are converted in
+	// parallel, values less than 2 convert the rows of each chunk one at a time
+	ColumnParallelism int
+	// Go time layouts that are tried in order when converting strings into DATE
+	// columns
+	DateFormats []string
+	// How integers are interpreted when converting them into DATE columns
+	DateIntegerUnit DateIntegerUnit
+	// Replace timestamps outside of the range supported by their column with
+	// the closest boundary instead of rejecting them
+	ClampTimestamps bool
+	// Estimate the number of distinct values in each column of every file
+	CollectColumnNDV bool
+	// Summarize the values written to each column by each insert, see
+	// InsertStats.ColumnSummaries.
+	CollectColumnSummaries bool
+	// The maximum size of a single file, batches that exceed it are split into
+	// multiple files. Zero means no limit.
+	MaxFileSizeBytes int
+	// The maximum number of rows in a single file, batches that exceed it are
+	// split into multiple files. Zero means no limit.
+	MaxRowsPerFile int
+	// The maximum number of files of a batch that are uploaded but not yet
+	// registered, building the next file is blocked until the oldest one is
+	// registered. Values less than 1 register each file before the next one
+	// is built.
+	MaxPendingRegistrations int
 }
 
 // ChannelOptions the parameters to opening a channel using SnowflakeServiceClient
@@ -164,6 +199,35 @@ type ChannelOptions struct {
 	BuildOptions BuildOptions
 	// How to handle schema differences
 	SchemaMode SchemaMode
+	// Match message keys to column names exactly instead of converting
+	// unquoted keys to uppercase like Snowflake does for unquoted identifiers
+	CaseSensitiveColumns bool
+	// How to handle values that can't be converted into the type of their
+	// column, values of columns that are not nullable are always rejected
+	ConversionErrorMode ConversionErrorMode
+	// Overrides ConversionErrorMode for specific columns, keyed by column
+	// names which are matched like message keys
+	ColumnConversionErrorModes map[string]ConversionErrorMode
+	// Columns which are excluded from ingestion entirely, the names are
+	// matched like message keys which are dropped from every row
+	IgnoreColumns []string
+	// Columns whose values the rows of each file are sorted by, in order of
+	// precedence, the names are matched like message keys
+	SortColumns []string
+	// Sort null values before other values instead of after them
+	SortNullsFirst bool
+	// Mappings that are applied to the values of specific columns before they
+	// are converted, keyed by column names which are matched like message
+	// keys. Each mapping is executed with the raw value as its input and the
+	// metadata of the message, and its result is written instead, deleting
+	// the root writes null.
+	ColumnTransforms map[string]*bloblang.Executor
+	// Overrides how the values of specific columns are encoded in the
+	// files, keyed by column names which are matched like message keys.
+	ColumnEncodings map[string]ColumnEncoding
+	// Called with 1 when a file was uploaded and is waiting to be
+	// registered, and with -1 once registering it succeeded or failed.
+	OnPendingRegistration func(delta int)
 }
 
 type encryptionInfo struct {
@@ -179,6 +243,15 @@ func (c *SnowflakeServiceClient) OpenChannel(ctx context.Context, opts ChannelOp
 	if opts.BuildOptions.ChunkSize <= 0 {
 		return nil, fmt.Errorf("invalid build chunk size: %d", opts.BuildOptions.ChunkSize)
 	}
+	if opts.BuildOptions.MaxFileSizeBytes < 0 {
+		return nil, fmt.Errorf("invalid max file size: %d", opts.BuildOptions.MaxFileSizeBytes)
+	}
+	if opts.BuildOptions.MaxRowsPerFile < 0 {
+		return nil, fmt.Errorf("invalid max rows per file: %d", opts.BuildOptions.MaxRowsPerFile)
+	}
+	if opts.BuildOptions.MaxPendingRegistrations < 0 {
+		return nil, fmt.Errorf("invalid max pending registrations: %d", opts.BuildOptions.MaxPendingRegistrations)
+	}
 	resp, err := c.client.openChannel(ctx, openChannelRequest{
 		RequestID: c.nextRequestID(),
 		Role:      c.options.Role,
@@ -194,7 +267,12 @@ func (c *SnowflakeServiceClient) OpenChannel(ctx context.Context, opts ChannelOp
 	if resp.StatusCode != responseSuccess {
 		return nil, fmt.Errorf("unable to open channel %s - status: %d, message: %s", opts.Name, resp.StatusCode, resp.Message)
 	}
-	schema, transformers, typeMetadata, err := constructParquetSchema(resp.TableColumns)
+	c.describeColumnDefaults(ctx, opts, resp.TableColumns)
+	schema, transformers, typeMetadata, err := constructParquetSchema(resp.TableColumns, opts)
+	if err != nil {
+		return nil, err
+	}
+	sorter, err := newRowSorter(schema, transformers, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -203,20 +281,26 @@ func (c *SnowflakeServiceClient) OpenChannel(ctx context.Context, opts ChannelOp
 		clientPrefix:    c.clientPrefix,
 		schema:          schema,
 		parquetWriter:   newParquetWriter(c.options.ConnectVersion, schema),
+		rowGroupPool:    &rowGroupPool{},
 		client:          c.client,
 		role:            c.options.Role,
 		uploaderManager: c.uploaderManager,
+		partialInserts:  c.partialInserts,
 		encryptionInfo: &encryptionInfo{
 			encryptionKeyID: resp.EncryptionKeyID,
 			encryptionKey:   resp.EncryptionKey,
 		},
-		flusher:          c.flusher,
-		clientSequencer:  resp.ClientSequencer,
-		rowSequencer:     resp.RowSequencer,
-		offsetToken:      resp.OffsetToken,
-		transformers:     transformers,
-		fileMetadata:     typeMetadata,
-		requestIDCounter: c.requestIDCounter,
+		flusher:               c.flusher,
+		registerBackOff:       newRegisterBackOff,
+		registerStatusBackOff: newRegisterStatusBackOff,
+		clientSequencer:       resp.ClientSequencer,
+		rowSequencer:          resp.RowSequencer,
+		offsetToken:           resp.OffsetToken,
+		transformers:          transformers,
+		ignoredColumns:        ignoredColumnNames(opts),
+		sorter:                sorter,
+		fileMetadata:          typeMetadata,
+		openTime:              time.Now(),
 	}
 	c.options.Logger.Debugf(
 		"successfully opened channel %s for table `%s.%s.%s` with client sequencer %v",
@@ -229,6 +313,69 @@ func (c *SnowflakeServiceClient) OpenChannel(ctx context.Context, opts ChannelOp
 	return ch, nil
 }
 
+// describeColumnDefaults marks the identity and default columns of the table,
+// which are not part of the open channel response. Failing to describe the
+// table is not fatal, those columns are then validated like any other.
+func (c *SnowflakeServiceClient) describeColumnDefaults(ctx context.Context, opts ChannelOptions, columns []columnMetadata) {
+	resp, err := c.client.RunSQL(ctx, RunSQLRequest{
+		Statement: "DESCRIBE TABLE IDENTIFIER(?)",
+		Timeout:   30,
+		Database:  opts.DatabaseName,
+		Schema:    opts.SchemaName,
+		Role:      c.options.Role,
+		Bindings: map[string]BindingValue{
+			"1": {Type: "TEXT", Value: opts.TableName},
+		},
+	})
+	if err == nil {
+		err = markColumnDefaults(resp, columns)
+	}
+	if err != nil {
+		c.options.Logger.Warnf(
+			"unable to read identity and default columns of table `%s.%s.%s`, rows must specify a value for every NOT NULL column: %v",
+			opts.DatabaseName,
+			opts.SchemaName,
+			opts.TableName,
+			err,
+		)
+	}
+}
+
+// markColumnDefaults sets whether each column is an identity or has a default
+// expression from the result of a DESCRIBE TABLE statement.
+func markColumnDefaults(resp RunSQLResponse, columns []columnMetadata) error {
+	nameIdx, defaultIdx := -1, -1
+	for i, rowType := range resp.ResultSetMetadata.RowType {
+		switch strings.ToLower(rowType.Name) {
+		case "name":
+			nameIdx = i
+		case "default":
+			defaultIdx = i
+		}
+	}
+	if nameIdx < 0 || defaultIdx < 0 {
+		return errors.New("missing name or default in table description")
+	}
+	defaults := make(map[string]string, len(resp.Data))
+	for _, row := range resp.Data {
+		if len(row) <= max(nameIdx, defaultIdx) {
+			return fmt.Errorf("invalid table description row with %d values", len(row))
+		}
+		defaults[row[nameIdx]] = strings.TrimSpace(row[defaultIdx])
+	}
+	for i := range columns {
+		// The table description contains the names without quotes.
+		expr := strings.ToUpper(defaults[normalizeColumnName(columns[i].Name)])
+		switch {
+		case strings.HasPrefix(expr, "IDENTITY") || strings.HasPrefix(expr, "AUTOINCREMENT"):
+			columns[i].Identity = true
+		case expr != "" && expr != "NULL":
+			columns[i].HasDefault = true
+		}
+	}
+	return nil
+}
+
 // OffsetToken is the persisted client offset of a stream. This can be used to implement exactly-once
 // processing.
 type OffsetToken string
@@ -287,19 +434,27 @@ type SnowflakeIngestionChannel struct {
 	role            string
 	clientPrefix    string
 	parquetWriter   *parquetWriter
+	rowGroupPool    *rowGroupPool
 	schema          *parquet.Schema
 	client          *SnowflakeRestClient
 	uploaderManager *uploaderManager
+	partialInserts  *partialInserts
 	flusher         *asyncroutine.Batcher[blobMetadata, blobRegisterStatus]
-	encryptionInfo  *encryptionInfo
-	clientSequencer int64
-	rowSequencer    int64
-	offsetToken     *OffsetToken
-	transformers    []*dataTransformer
-	fileMetadata    map[string]string
-	// This is shared among the various open channels to get some uniqueness
-	// when naming bdec files
-	requestIDCounter *atomic.Int64
+	// The backoff between attempts to register a file that were throttled or
+	// failed on the server side.
+	registerBackOff func() backoff.BackOff
+	// The backoff between checks of the channel status for a file that might
+	// have been registered.
+	registerStatusBackOff func() backoff.BackOff
+	encryptionInfo        *encryptionInfo
+	clientSequencer       int64
+	rowSequencer          int64
+	offsetToken           *OffsetToken
+	transformers          []*dataTransformer
+	ignoredColumns        map[string]struct{}
+	sorter                *rowSorter
+	fileMetadata          map[string]string
+	openTime              time.Time
 }
 
 // InsertStats holds some basic statistics about the InsertRows operation
@@ -310,35 +465,83 @@ type InsertStats struct {
 	UploadTime           time.Duration
 	RegisterTime         time.Duration
 	CompressedOutputSize int
+	// The estimated number of distinct values per column in the file, this is
+	// only set when BuildOptions.CollectColumnNDV is enabled.
+	ColumnDistinctValues map[string]int64
+	// The statistics of each file that was registered, batches are split into
+	// multiple files when they exceed the limits in BuildOptions.
+	Files []FileStats
+	// The number of values per column that failed conversion and were
+	// written as null, this is only set when any conversion failed.
+	ColumnConversionErrors map[string]int64
+	// The number of timestamps per column that were clamped to the range
+	// supported by the column, this is only set when any were clamped.
+	ColumnClampedValues map[string]int64
+	// The data quality summary of each column, this is only set when
+	// BuildOptions.CollectColumnSummaries is enabled.
+	ColumnSummaries *ColumnSummaries
+}
+
+// FileStats holds statistics about a single file written by InsertRows
+type FileStats struct {
+	// The index of the first row of the file in the batch.
+	FirstRow     int
+	Rows         int64
+	Size         int
+	BuildTime    time.Duration
+	UploadTime   time.Duration
+	RegisterTime time.Duration
+	// The number of times registering the file was retried because Snowflake
+	// throttled the request or failed to process it.
+	RegisterRetries int
+	// The number of files of the batch, including this one, that were
+	// uploaded but not yet registered when this file was uploaded.
+	PendingRegistrations int
+	// The position in the file of each of its rows, in the order of their
+	// messages, when the rows were sorted by ChannelOptions.SortColumns. It's
+	// nil when the rows are written in the order of their messages.
+	RowPositions []int32
 }
 
 type bdecPart struct {
 	unencryptedLen  int
 	parquetFile     []byte
-	parquetMetadata format.FileMetaData
+	parquetMetadata parquetFileSummary
 	stats           []*statsBuffer
 	convertTime     time.Duration
 	serializeTime   time.Duration
+	// The position of each row in the file, nil when the rows are written in
+	// the order of their messages.
+	rowPositions []int32
 }
 
 func (c *SnowflakeIngestionChannel) constructBdecPart(batch service.MessageBatch, metadata map[string]string) (bdecPart, error) {
 	wg := &errgroup.Group{}
 	wg.SetLimit(c.BuildOptions.Parallelism)
 	type rowGroup struct {
-		rows  []parquet.Row
-		stats []*statsBuffer
+		rows    []parquet.Row
+		stats   []*statsBuffer
+		buffers *rowGroupBuffers
 	}
-	rowGroups := []rowGroup{}
 	maxChunkSize := c.BuildOptions.ChunkSize
+	// The row groups are written concurrently, so the slice must not grow
+	// while they're built.
+	rowGroups := make([]rowGroup, (len(batch)+maxChunkSize-1)/maxChunkSize)
+	// The rows of the row groups are backed by their buffers until they're
+	// written to the file, which copies them.
+	defer func() {
+		for _, rg := range rowGroups {
+			c.rowGroupPool.put(rg.buffers)
+		}
+	}()
 	convertStart := time.Now()
-	for i := 0; i < len(batch); i += maxChunkSize {
-		end := min(maxChunkSize, len(batch[i:]))
-		j := len(rowGroups)
-		rowGroups = append(rowGroups, rowGroup{})
-		chunk := batch[i : i+end]
+	for j := range rowGroups {
+		i := j * maxChunkSize
+		chunk := batch[i:min(i+maxChunkSize, len(batch))]
 		wg.Go(func() error {
-			rows, stats, err := constructRowGroup(chunk, c.schema, c.transformers, c.SchemaMode)
-			rowGroups[j] = rowGroup{rows, stats}
+			buffers := c.rowGroupPool.get()
+			rows, stats, err := buffers.constructRowGroup(chunk, c.schema, c.transformers, c.ignoredColumns, c.SchemaMode, c.CaseSensitiveColumns, c.BuildOptions.CollectColumnNDV, c.BuildOptions.ColumnParallelism)
+			rowGroups[j] = rowGroup{rows, stats, buffers}
 			return err
 		})
 	}
@@ -347,23 +550,30 @@ func (c *SnowflakeIngestionChannel) constructBdecPart(batch service.MessageBatch
 	}
 	convertDone := time.Now()
 	allRows := make([]parquet.Row, 0, len(batch))
-	combinedStats := make([]*statsBuffer, len(c.schema.Fields()))
+	// The stats of the row groups belong to their buffers, so they're merged
+	// into stats of their own.
+	combined := make([]statsBuffer, len(c.schema.Fields()))
+	combinedStats := make([]*statsBuffer, len(combined))
 	for i := range combinedStats {
-		combinedStats[i] = &statsBuffer{}
+		combinedStats[i] = &combined[i]
 	}
 	for _, rg := range rowGroups {
 		allRows = append(allRows, rg.rows...)
 		for i, s := range combinedStats {
-			combinedStats[i] = mergeStats(s, rg.stats[i])
+			s.merge(rg.stats[i])
 		}
 	}
+	var rowPositions []int32
+	if c.sorter != nil {
+		rowPositions = c.sorter.sort(allRows)
+	}
 	// TODO(perf): It would be really nice to be able to compress in parallel,
 	// that actually ends up taking quite of bit of CPU.
 	buf, err := c.parquetWriter.WriteFile(allRows, metadata)
 	if err != nil {
 		return bdecPart{}, err
 	}
-	fileMetadata, err := readParquetMetadata(buf)
+	fileMetadata, err := readParquetSummary(buf)
 	if err != nil {
 		return bdecPart{}, fmt.Errorf("unable to parse parquet metadata: %w", err)
 	}
@@ -375,12 +585,40 @@ func (c *SnowflakeIngestionChannel) constructBdecPart(batch service.MessageBatch
 		stats:           combinedStats,
 		convertTime:     convertDone.Sub(convertStart),
 		serializeTime:   done.Sub(convertDone),
+		rowPositions:    rowPositions,
 	}, err
 }
 
 // OffsetTokenRange is the range of offsets for the data being written.
 type OffsetTokenRange struct {
 	Start, End OffsetToken
+	// TokenAt returns the offset token of the row at index i of the batch, it
+	// is required to compute the range of each file when a batch is split into
+	// multiple files.
+	TokenAt func(i int) (OffsetToken, error)
+}
+
+// sub returns the range of rows [from, to) of a batch with total rows.
+func (r *OffsetTokenRange) sub(from, to, total int) (*OffsetTokenRange, error) {
+	if r == nil || (from == 0 && to == total) {
+		return r, nil
+	}
+	if r.TokenAt == nil {
+		return nil, errors.New("unable to split a batch with an offset token range into multiple files without the offset token of each row")
+	}
+	sub := &OffsetTokenRange{Start: r.Start, End: r.End, TokenAt: r.TokenAt}
+	var err error
+	if from > 0 {
+		if sub.Start, err = r.TokenAt(from); err != nil {
+			return nil, err
+		}
+	}
+	if to < total {
+		if sub.End, err = r.TokenAt(to - 1); err != nil {
+			return nil, err
+		}
+	}
+	return sub, nil
 }
 
 func (r *OffsetTokenRange) start() *OffsetToken {
@@ -397,127 +635,336 @@ func (r *OffsetTokenRange) end() *OffsetToken {
 	return &r.End
 }
 
-// InsertRows creates a parquet file using the schema from the data,
-// then writes that file into the Snowflake table
+// InsertRows creates parquet files using the schema from the data,
+// then writes those files into the Snowflake table. The batch is split
+// into multiple files when it exceeds the limits in BuildOptions, each
+// of which advances the offset token of the channel to its last row.
+//
+// Files are registered in the background in the order they were built,
+// while the following files are built and uploaded, up to
+// BuildOptions.MaxPendingRegistrations files at a time.
+//
+// When registering a file fails after the previous files of the batch were
+// registered, the rows of those files are skipped the next time the same
+// batch is inserted to the table, so that retrying the batch doesn't write
+// them twice.
 func (c *SnowflakeIngestionChannel) InsertRows(ctx context.Context, batch service.MessageBatch, offsets *OffsetTokenRange) (InsertStats, error) {
 	insertStats := InsertStats{}
 	if len(batch) == 0 {
 		return insertStats, nil
 	}
+	// The leading rows of the batch were already registered when a previous
+	// attempt to insert it failed part way through.
+	table := c.DatabaseName + "." + c.SchemaName + "." + c.TableName
+	skipped := c.partialInserts.take(table, batch)
+	if skipped == len(batch) {
+		return insertStats, nil
+	}
+
+	// Each file holds a slot from before it's built until it's registered,
+	// which bounds the memory of the files waiting to be registered.
+	slots := make(chan struct{}, max(1, c.BuildOptions.MaxPendingRegistrations))
+	queue := make(chan *pendingRegistration, cap(slots))
+	registerErr := make(chan error, 1)
+	registerDone := make(chan struct{})
+	var registered []FileStats
+	go func() {
+		defer close(registerDone)
+		// The row sequencer of the channel must increase monotonically, so
+		// files are registered one at a time and the remaining ones are
+		// abandoned when one of them fails.
+		for reg := range queue {
+			fileStats, err := c.registerUploadedFile(ctx, reg)
+			c.pendingRegistration(-1)
+			<-slots
+			if err != nil {
+				registerErr <- err
+				return
+			}
+			registered = append(registered, fileStats)
+		}
+	}()
 
-	startTime := time.Now()
-	// Prevent multiple channels from having the same bdec file (it must be globally unique)
-	// so add the ID of the channel in the upper 16 bits and then get 48 bits of randomness outside that.
-	fakeThreadID := (int64(c.ID) << 48) | rand.Int64N(1<<48)
-	blobPath := generateBlobPath(c.clientPrefix, fakeThreadID, c.requestIDCounter.Add(1))
+	// The sequencers are only updated by the registrations, the files are
+	// assigned the following row sequencers as they are built.
+	clientSequencer := c.clientSequencer
+	var combinedStats []*statsBuffer
+	err := c.forEachFile(batch[skipped:], clientSequencer, c.rowSequencer, func() error {
+		select {
+		case slots <- struct{}{}:
+			return nil
+		case <-registerDone:
+			return errRegistrationFailed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}, func(blobPath string, rowSequencer int64, part bdecPart, startTime time.Time, from, to int) error {
+		from, to = from+skipped, to+skipped
+		fileOffsets, err := offsets.sub(from, to, len(batch))
+		if err != nil {
+			return err
+		}
+		reg, err := c.uploadFile(ctx, blobPath, part, fileOffsets, startTime, clientSequencer, rowSequencer)
+		if err != nil {
+			return err
+		}
+		reg.fileStats.FirstRow = from
+		reg.fileStats.PendingRegistrations = len(slots)
+		c.pendingRegistration(1)
+		select {
+		case queue <- reg:
+		case <-registerDone:
+			c.pendingRegistration(-1)
+			return errRegistrationFailed
+		}
+		insertStats.ConvertTime += part.convertTime
+		insertStats.SerializeTime += part.serializeTime
+		if combinedStats == nil {
+			combinedStats = part.stats
+		} else {
+			for i, s := range combinedStats {
+				combinedStats[i] = mergeStats(s, part.stats[i])
+			}
+		}
+		return nil
+	})
+	close(queue)
+	<-registerDone
+	// The files that were queued after a registration failed are abandoned.
+	for range queue {
+		c.pendingRegistration(-1)
+	}
+	for _, fileStats := range registered {
+		insertStats.CompressedOutputSize += fileStats.Size
+		insertStats.BuildTime += fileStats.BuildTime
+		insertStats.UploadTime += fileStats.UploadTime
+		insertStats.RegisterTime += fileStats.RegisterTime
+		insertStats.Files = append(insertStats.Files, fileStats)
+	}
+	select {
+	case regErr := <-registerErr:
+		err = regErr
+	default:
+	}
+	if err != nil {
+		inserted := skipped
+		if n := len(registered); n > 0 {
+			inserted = registered[n-1].FirstRow + int(registered[n-1].Rows)
+		}
+		c.partialInserts.add(table, batch, inserted)
+		return insertStats, err
+	}
+	insertStats.ColumnDistinctValues = computeColumnDistinctValues(c.transformers, combinedStats)
+	insertStats.ColumnConversionErrors = computeColumnConversionErrors(c.transformers, combinedStats)
+	insertStats.ColumnClampedValues = computeColumnClampedValues(c.transformers, combinedStats)
+	if c.BuildOptions.CollectColumnSummaries {
+		// Only the rows of the files registered by this insert are summarized, not the ones skipped because a previous
+		// attempt registered them.
+		var rows int64
+		for _, fileStats := range registered {
+			rows += fileStats.Rows
+		}
+		insertStats.ColumnSummaries = newColumnSummaries(rows, c.transformers, combinedStats)
+	}
+	return insertStats, nil
+}
+
+// errRegistrationFailed stops building files once registering a file failed,
+// the registration error is returned instead.
+var errRegistrationFailed = errors.New("registering a previous file failed")
+
+// forEachFile builds files from consecutive rows of the batch that don't
+// exceed the max file size and max rows per file, and calls fn in order with
+// each of them, the row sequencer they're assigned following rowSequencer and
+// the range of rows [from, to) of the batch they contain. When wait is not nil
+// it's called before building each file. The file of a part is only valid until
+// fn returns, as its memory is reused to build the following file.
+func (c *SnowflakeIngestionChannel) forEachFile(batch service.MessageBatch, clientSequencer, rowSequencer int64, wait func() error, fn func(blobPath string, rowSequencer int64, part bdecPart, startTime time.Time, from, to int) error) error {
+	rowsPerFile := len(batch)
+	if c.BuildOptions.MaxRowsPerFile > 0 {
+		rowsPerFile = min(rowsPerFile, c.BuildOptions.MaxRowsPerFile)
+	}
+	for from := 0; from < len(batch); {
+		if wait != nil {
+			if err := wait(); err != nil {
+				return err
+			}
+		}
+		startTime := time.Now()
+		rowSequencer++
+		blobPath := c.blobPath(clientSequencer, rowSequencer)
+		part, n, err := c.buildFile(batch[from:], rowsPerFile, blobPath)
+		if err != nil {
+			return err
+		}
+		if err := fn(blobPath, rowSequencer, part, startTime, from, from+n); err != nil {
+			return err
+		}
+		from += n
+		// Once a file had to be shrunk to fit, start the following files with
+		// the same number of rows so that they're usually only built once.
+		rowsPerFile = n
+	}
+	return nil
+}
+
+// blobPath returns the path of the file with the given sequencers. The file
+// name is derived from the channel and the sequencers rather than from a
+// counter, so that a file which is built again for the same rows of the same
+// channel gets the same name.
+func (c *SnowflakeIngestionChannel) blobPath(clientSequencer, rowSequencer int64) string {
+	// The file names must be globally unique, the Java SDK includes the ID
+	// of the thread which built the file and a counter, here they're replaced
+	// by a hash of the fully qualified channel with its client sequencer,
+	// which changes each time the channel is opened, and the row sequencer.
+	h := fnv.New64a()
+	_, _ = fmt.Fprintf(h, "%s.%s.%s.%s.%d", c.DatabaseName, c.SchemaName, c.TableName, c.Name, clientSequencer)
+	return generateBlobPath(c.clientPrefix, int64(h.Sum64()>>1), rowSequencer)
+}
+
+// buildFile constructs a file with the given path from at most limit rows at
+// the start of the batch and returns the number of rows in it. When the file
+// exceeds the max file size it is rebuilt with fewer rows, estimated from the
+// size of the file, until it fits or contains a single row.
+func (c *SnowflakeIngestionChannel) buildFile(batch service.MessageBatch, limit int, blobPath string) (bdecPart, int, error) {
+	n := min(limit, len(batch))
 	// This is extra metadata that is required for functionality in snowflake.
 	c.fileMetadata["primaryFileId"] = path.Base(blobPath)
-	part, err := c.constructBdecPart(batch, c.fileMetadata)
-	if err != nil {
-		return insertStats, fmt.Errorf("unable to construct output: %w", err)
+	for {
+		part, err := c.constructBdecPart(batch[:n], c.fileMetadata)
+		if err != nil {
+			return bdecPart{}, 0, fmt.Errorf("unable to construct output: %w", err)
+		}
+		maxSize := c.BuildOptions.MaxFileSizeBytes
+		if maxSize <= 0 || part.unencryptedLen <= maxSize || n == 1 {
+			return part, n, nil
+		}
+		// Aim slightly below the limit as the size of a file doesn't grow
+		// exactly linearly with the number of rows.
+		estimate := int(int64(n) * int64(maxSize) * 9 / (10 * int64(part.unencryptedLen)))
+		n = min(n-1, max(1, estimate))
 	}
+}
+
+// pendingRegistration is a file that was uploaded and is waiting to be
+// registered with the channel.
+type pendingRegistration struct {
+	metadata     blobMetadata
+	rowSequencer int64
+	offsets      *OffsetTokenRange
+	fileStats    FileStats
+}
+
+// uploadFile encrypts and uploads the file, then returns the metadata to
+// register it with the channel using the given sequencers.
+func (c *SnowflakeIngestionChannel) uploadFile(ctx context.Context, blobPath string, part bdecPart, offsets *OffsetTokenRange, startTime time.Time, clientSequencer, rowSequencer int64) (*pendingRegistration, error) {
 	if debug {
 		_ = os.WriteFile("latest_test.parquet", part.parquetFile, 0o644)
 	}
 
 	unencrypted := padBuffer(part.parquetFile, aes.BlockSize)
+	var err error
 	part.parquetFile, err = encrypt(unencrypted, c.encryptionInfo.encryptionKey, blobPath, 0)
 	if err != nil {
-		return insertStats, fmt.Errorf("unable to encrypt output: %w", err)
+		return nil, fmt.Errorf("unable to encrypt output: %w", err)
 	}
 	fullMD5Hash := md5.Sum(part.parquetFile)
 
 	uploadStartTime := time.Now()
-	for i := range 3 {
-		ur := c.uploaderManager.GetUploader()
-		if ur.err != nil {
-			return insertStats, fmt.Errorf("failed to acquire stage uploader (last fetch time=%v): %w", ur.timestamp, ur.err)
-		}
-		err = ur.uploader.upload(ctx, blobPath, part.parquetFile, fullMD5Hash[:], map[string]string{
-			"ingestclientname": partnerID + "_" + c.Name,
-			"ingestclientkey":  c.clientPrefix,
-		})
-		if err == nil {
-			break
-		}
-		err = fmt.Errorf("unable to upload to storage (last cred refresh time=%v): %w", ur.timestamp, err)
-		// Similar to the Java SDK, the first failure we retry immediately after attempting to refresh
-		// our uploader. It seems there are some cases where the 1 hour refresh interval is too slow
-		// and tokens are only valid for ~30min. This is a poor man's workaround for dynamic token
-		// refreshing.
-		if i == 0 {
-			c.uploaderManager.RefreshUploader(ctx)
-			continue
-		}
-		select {
-		case <-time.After(time.Second):
-		case <-ctx.Done():
-			return insertStats, ctx.Err()
-		}
-	}
+	err = c.uploaderManager.PutFile(ctx, blobPath, part.parquetFile, fullMD5Hash[:], map[string]string{
+		"ingestclientname": partnerID + "_" + c.Name,
+		"ingestclientkey":  c.clientPrefix,
+	})
 	if err != nil {
-		return insertStats, err
+		return nil, err
 	}
 	uploadFinishTime := time.Now()
 
-	resp, err := c.flusher.Submit(ctx, blobMetadata{
-		Path:        blobPath,
-		MD5:         hex.EncodeToString(fullMD5Hash[:]),
-		BDECVersion: 3,
-		BlobStats: blobStats{
-			FlushStartMs:     startTime.UnixMilli(),
-			BuildDurationMs:  uploadStartTime.UnixMilli() - startTime.UnixMilli(),
-			UploadDurationMs: uploadFinishTime.UnixMilli() - uploadStartTime.UnixMilli(),
-		},
-		Chunks: []chunkMetadata{
-			{
-				Database:                c.DatabaseName,
-				Schema:                  c.SchemaName,
-				Table:                   c.TableName,
-				ChunkStartOffset:        0,
-				ChunkLength:             int32(part.unencryptedLen),
-				ChunkLengthUncompressed: totalUncompressedSize(part.parquetMetadata),
-				ChunkMD5:                md5Hash(part.parquetFile[:part.unencryptedLen]),
-				EncryptionKeyID:         c.encryptionInfo.encryptionKeyID,
-				FirstInsertTimeInMillis: startTime.UnixMilli(),
-				LastInsertTimeInMillis:  startTime.UnixMilli(),
-				EPS: &epInfo{
-					Rows:    part.parquetMetadata.NumRows,
-					Columns: computeColumnEpInfo(c.transformers, part.stats),
-				},
-				Channels: []channelMetadata{
-					{
-						Channel:          c.Name,
-						ClientSequencer:  c.clientSequencer,
-						RowSequencer:     c.rowSequencer + 1,
-						StartOffsetToken: offsets.start(),
-						EndOffsetToken:   offsets.end(),
-						OffsetToken:      nil,
+	return &pendingRegistration{
+		metadata: blobMetadata{
+			Path:        blobPath,
+			MD5:         hex.EncodeToString(fullMD5Hash[:]),
+			BDECVersion: 3,
+			BlobStats: blobStats{
+				FlushStartMs:     startTime.UnixMilli(),
+				BuildDurationMs:  uploadStartTime.UnixMilli() - startTime.UnixMilli(),
+				UploadDurationMs: uploadFinishTime.UnixMilli() - uploadStartTime.UnixMilli(),
+			},
+			Chunks: []chunkMetadata{
+				{
+					Database:                c.DatabaseName,
+					Schema:                  c.SchemaName,
+					Table:                   c.TableName,
+					ChunkStartOffset:        0,
+					ChunkLength:             int32(part.unencryptedLen),
+					ChunkLengthUncompressed: totalUncompressedSize(part.parquetMetadata),
+					ChunkMD5:                md5Hash(part.parquetFile[:part.unencryptedLen]),
+					EncryptionKeyID:         c.encryptionInfo.encryptionKeyID,
+					FirstInsertTimeInMillis: startTime.UnixMilli(),
+					LastInsertTimeInMillis:  startTime.UnixMilli(),
+					EPS: &epInfo{
+						Rows:    part.parquetMetadata.NumRows,
+						Columns: computeColumnEpInfo(c.transformers, part.stats),
+					},
+					Channels: []channelMetadata{
+						{
+							Channel:          c.Name,
+							ClientSequencer:  clientSequencer,
+							RowSequencer:     rowSequencer,
+							StartOffsetToken: offsets.start(),
+							EndOffsetToken:   offsets.end(),
+							OffsetToken:      nil,
+						},
 					},
 				},
 			},
 		},
-	})
+		rowSequencer: rowSequencer,
+		offsets:      offsets,
+		fileStats: FileStats{
+			Rows:         part.parquetMetadata.NumRows,
+			Size:         part.unencryptedLen,
+			BuildTime:    uploadStartTime.Sub(startTime),
+			UploadTime:   uploadFinishTime.Sub(uploadStartTime),
+			RowPositions: part.rowPositions,
+		},
+	}, nil
+}
+
+func (c *SnowflakeIngestionChannel) pendingRegistration(delta int) {
+	if c.OnPendingRegistration != nil {
+		c.OnPendingRegistration(delta)
+	}
+}
+
+// registerUploadedFile registers an uploaded file with the channel and
+// advances the sequencers and offset token of the channel.
+func (c *SnowflakeIngestionChannel) registerUploadedFile(ctx context.Context, reg *pendingRegistration) (FileStats, error) {
+	fileStats := reg.fileStats
+	registerStartTime := time.Now()
+	resp, retries, err := c.registerBlob(ctx, reg.metadata)
+	fileStats.RegisterRetries = retries
 	if err != nil {
-		return insertStats, fmt.Errorf("registering output failed: %w", err)
+		return fileStats, fmt.Errorf("registering output failed: %w", err)
 	}
 	if len(resp.Chunks) != 1 {
-		return insertStats, fmt.Errorf("unexpected number of response blob chunks: %d", len(resp.Chunks))
+		return fileStats, fmt.Errorf("unexpected number of response blob chunks: %d", len(resp.Chunks))
 	}
 	chunk := resp.Chunks[0]
 	if len(chunk.Channels) != 1 {
-		return insertStats, fmt.Errorf("unexpected number of channels for blob chunk: %d", len(chunk.Channels))
+		return fileStats, fmt.Errorf("unexpected number of channels for blob chunk: %d", len(chunk.Channels))
 	}
 	channel := chunk.Channels[0]
+	expectedClientSequencer := reg.metadata.Chunks[0].Channels[0].ClientSequencer
 	if channel.StatusCode != responseSuccess {
 		msg := channel.Message
 		if msg == "" {
 			msg = "(no message)"
-			if channel.ClientSequencer != c.clientSequencer {
+			if channel.ClientSequencer != expectedClientSequencer {
 				msg = fmt.Sprintf(
 					"(client sequencer has changed (%v vs %v) - has another process opened this channel?)",
 					channel.ClientSequencer,
-					c.clientSequencer,
+					expectedClientSequencer,
 				)
 			}
 		}
@@ -528,21 +975,156 @@ func (c *SnowflakeIngestionChannel) InsertRows(ctx context.Context, batch servic
 			ChannelName:             c.Name,
 			StatusCode:              channel.StatusCode,
 			Message:                 msg,
-			ExpectedClientSequencer: c.clientSequencer,
+			ExpectedClientSequencer: expectedClientSequencer,
 			ActualClientSequencer:   channel.ClientSequencer,
 		}
-		return insertStats, err
+		return fileStats, err
 	}
-	c.rowSequencer++
+	c.rowSequencer = reg.rowSequencer
 	c.clientSequencer = channel.ClientSequencer
-	c.offsetToken = offsets.end()
-	insertStats.CompressedOutputSize = part.unencryptedLen
-	insertStats.BuildTime = uploadStartTime.Sub(startTime)
-	insertStats.UploadTime = uploadFinishTime.Sub(uploadStartTime)
-	insertStats.RegisterTime = time.Since(uploadFinishTime)
-	insertStats.ConvertTime = part.convertTime
-	insertStats.SerializeTime = part.serializeTime
-	return insertStats, err
+	c.offsetToken = reg.offsets.end()
+	fileStats.RegisterTime = time.Since(registerStartTime)
+	return fileStats, nil
+}
+
+const (
+	registerMaxRetries = 5
+	// The number of times the status of the channel is checked for a file
+	// that might have been registered before it's submitted again.
+	registerStatusChecks = 5
+)
+
+func newRegisterBackOff() backoff.BackOff {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = 200 * time.Millisecond
+	b.MaxInterval = 10 * time.Second
+	return backoff.WithMaxRetries(b, registerMaxRetries)
+}
+
+func newRegisterStatusBackOff() backoff.BackOff {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = 500 * time.Millisecond
+	b.MaxInterval = 5 * time.Second
+	return backoff.WithMaxRetries(b, registerStatusChecks-1)
+}
+
+// registerBlob submits the file to be registered and retries when Snowflake
+// throttled the request or failed to process it, waiting for at least as
+// long as the Retry-After header of the response requests. The number of
+// retries is returned along with the result.
+//
+// When the response to an attempt was lost, such as after a server error or
+// a network error, the file might have been registered already. Before it's
+// submitted again the status of the channel is polled until it committed the
+// row sequencer of the file, and the file is only submitted again when that
+// didn't happen. A file which was registered but not committed in time is
+// rejected with an invalid row sequencer when it's submitted again, which is
+// then considered a success.
+func (c *SnowflakeIngestionChannel) registerBlob(ctx context.Context, metadata blobMetadata) (blobRegisterStatus, int, error) {
+	b := c.registerBackOff()
+	channel := metadata.Chunks[0].Channels[0]
+	registered := blobRegisterStatus{Chunks: []chunkRegisterStatus{{
+		Channels: []channelRegisterStatus{{
+			StatusCode:      responseSuccess,
+			Channel:         channel.Channel,
+			ClientSequencer: channel.ClientSequencer,
+		}},
+	}}}
+	var responseLost bool
+	for retries := 0; ; retries++ {
+		resp, err := c.flusher.Submit(ctx, metadata)
+		if err == nil {
+			if responseLost && hasInvalidRowSequencer(resp) {
+				return registered, retries, nil
+			}
+			return resp, retries, nil
+		}
+		uncertain := mayHaveBeenProcessed(err)
+		if !uncertain && !isRetryableRegistrationError(err) {
+			return resp, retries, err
+		}
+		wait := b.NextBackOff()
+		if wait == backoff.Stop {
+			return resp, retries, err
+		}
+		wait = max(wait, min(retryAfter(err), maxRetryAfter))
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return resp, retries, ctx.Err()
+		}
+		if !uncertain {
+			continue
+		}
+		responseLost = true
+		ok, statusErr := c.awaitRegistered(ctx, channel)
+		if statusErr != nil {
+			return resp, retries, fmt.Errorf("unable to check whether the file was registered after %w: %w", err, statusErr)
+		}
+		if ok {
+			return registered, retries + 1, nil
+		}
+	}
+}
+
+// hasInvalidRowSequencer returns true when the file was rejected because the
+// channel already advanced to its row sequencer.
+func hasInvalidRowSequencer(resp blobRegisterStatus) bool {
+	if len(resp.Chunks) != 1 || len(resp.Chunks[0].Channels) != 1 {
+		return false
+	}
+	return resp.Chunks[0].Channels[0].StatusCode == responseErrInvalidRowSequencer
+}
+
+// awaitRegistered polls the status of the channel until it committed the row
+// sequencer of the file, and returns false when it didn't within the checks.
+func (c *SnowflakeIngestionChannel) awaitRegistered(ctx context.Context, channel channelMetadata) (bool, error) {
+	b := c.registerStatusBackOff()
+	for {
+		registered, err := c.isRegistered(ctx, channel)
+		if err != nil || registered {
+			return registered, err
+		}
+		wait := b.NextBackOff()
+		if wait == backoff.Stop {
+			return false, nil
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+}
+
+// isRegistered returns true when the channel has committed the row sequencer
+// of the file with the same client sequencer, which means the file was
+// registered already. A file which was registered but isn't committed yet
+// can't be told apart from one which wasn't registered.
+func (c *SnowflakeIngestionChannel) isRegistered(ctx context.Context, channel channelMetadata) (bool, error) {
+	resp, err := c.client.channelStatus(ctx, batchChannelStatusRequest{
+		Role: c.role,
+		Channels: []channelStatusRequest{
+			{
+				Table:           c.TableName,
+				Database:        c.DatabaseName,
+				Schema:          c.SchemaName,
+				Name:            c.Name,
+				ClientSequencer: &channel.ClientSequencer,
+			},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode != responseSuccess {
+		return false, fmt.Errorf("error fetching channel status: %w", &APIError{StatusCode: int(resp.StatusCode), Message: resp.Message})
+	}
+	if len(resp.Channels) != 1 {
+		return false, fmt.Errorf("unexpected number of channels for status request: %d", len(resp.Channels))
+	}
+	status := resp.Channels[0]
+	return status.PersistedClientSequencer == channel.ClientSequencer && status.PersistedRowSequencer >= channel.RowSequencer, nil
 }
 
 // IngestionFailedError is an error that occurs when registing a BDEC file with Snowflake.
@@ -555,6 +1137,13 @@ type IngestionFailedError struct {
 	ActualClientSequencer               int64
 }
 
+var _ SnowflakeError = &IngestionFailedError{}
+
+// SFCode returns the status code of the response.
+func (e *IngestionFailedError) SFCode() string {
+	return strconv.FormatInt(e.StatusCode, 10)
+}
+
 // LostOwnership returns true when another channel was opened and this one is invalidated now
 func (e *IngestionFailedError) LostOwnership() bool {
 	return e.ExpectedClientSequencer != e.ActualClientSequencer || e.StatusCode == responseErrInvalidClientSequencer
@@ -625,11 +1214,7 @@ func (c *SnowflakeIngestionChannel) WaitUntilCommitted(ctx context.Context, time
 			return err
 		}
 		if resp.StatusCode != responseSuccess {
-			msg := resp.Message
-			if msg == "" {
-				msg = "(no message)"
-			}
-			return fmt.Errorf("error fetching channel status (%d): %s", resp.StatusCode, msg)
+			return fmt.Errorf("error fetching channel status: %w", &APIError{StatusCode: int(resp.StatusCode), Message: resp.Message})
 		}
 		if len(resp.Channels) != 1 {
 			return fmt.Errorf("unexpected number of channels for status request: %d", len(resp.Channels))
@@ -666,3 +1251,59 @@ func (c *SnowflakeIngestionChannel) WaitUntilCommitted(ctx context.Context, time
 func (c *SnowflakeIngestionChannel) LatestOffsetToken() *OffsetToken {
 	return c.offsetToken
 }
+
+// OpenTime is when the channel was opened, which is also when the table schema was fetched.
+func (c *SnowflakeIngestionChannel) OpenTime() time.Time {
+	return c.openTime
+}
+
+// Columns returns the names of the table columns known to the channel in the
+// form message keys are matched against them.
+func (c *SnowflakeIngestionChannel) Columns() []string {
+	columns := make([]string, len(c.transformers))
+	for i, t := range c.transformers {
+		columns[i] = t.name
+	}
+	return columns
+}
+
+// UnknownColumns returns the sorted names of non-null message keys in the batch
+// which don't match any column known to the channel. Messages that are not
+// objects are skipped, as InsertRows reports those.
+func (c *SnowflakeIngestionChannel) UnknownColumns(batch service.MessageBatch) []string {
+	normalize := normalizeColumnName
+	if c.CaseSensitiveColumns {
+		normalize = normalizeColumnNameCaseSensitive
+	}
+	known := make(map[string]struct{}, len(c.transformers)+len(c.ignoredColumns))
+	for name := range c.ignoredColumns {
+		known[name] = struct{}{}
+	}
+	for _, t := range c.transformers {
+		known[t.name] = struct{}{}
+	}
+	var unknown []string
+	for _, msg := range batch {
+		v, err := msg.AsStructured()
+		if err != nil {
+			continue
+		}
+		row, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		for k, v := range row {
+			if v == nil {
+				continue
+			}
+			name := normalize(k)
+			if _, ok := known[name]; ok {
+				continue
+			}
+			known[name] = struct{}{}
+			unknown = append(unknown, name)
+		}
+	}
+	slices.Sort(unknown)
+	return unknown
+}
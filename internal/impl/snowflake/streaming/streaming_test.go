@@ -11,12 +11,687 @@
 package streaming
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/aws/smithy-go/ptr"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/redpanda-data/benthos/v4/public/service"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/redpanda-data/connect/v4/internal/asyncroutine"
+	"github.com/redpanda-data/connect/v4/internal/impl/snowflake/streaming/int128"
+	"github.com/redpanda-data/connect/v4/internal/typed"
 )
 
 func TestDebugModeDisabled(t *testing.T) {
 	// So I can't forget to disable this!
 	require.False(t, debug)
 }
+
+func TestUnknownColumns(t *testing.T) {
+	columns := []columnMetadata{
+		{
+			Name:         "FOO",
+			Ordinal:      1,
+			Type:         "NUMBER(18,0)",
+			LogicalType:  "fixed",
+			PhysicalType: "SB8",
+			Precision:    ptr.Int32(18),
+			Scale:        ptr.Int32(0),
+			Nullable:     true,
+		},
+		{
+			Name:         `"userId"`,
+			Ordinal:      2,
+			Type:         "NUMBER(18,0)",
+			LogicalType:  "fixed",
+			PhysicalType: "SB8",
+			Precision:    ptr.Int32(18),
+			Scale:        ptr.Int32(0),
+			Nullable:     true,
+		},
+	}
+	batch := service.MessageBatch{
+		msg(`{"foo":1,"userId":2,"bar":3}`),
+		msg(`{"FOO":1,"baz":null,"bar":4,"qux":5}`),
+		msg(`[1,2,3]`),
+	}
+
+	opts := ChannelOptions{}
+	_, transformers, _, err := constructParquetSchema(columns, opts)
+	require.NoError(t, err)
+	channel := &SnowflakeIngestionChannel{ChannelOptions: opts, transformers: transformers}
+	require.Equal(t, []string{"FOO", "userId"}, channel.Columns())
+	require.Equal(t, []string{"BAR", "QUX", "USERID"}, channel.UnknownColumns(batch))
+
+	opts = ChannelOptions{CaseSensitiveColumns: true}
+	_, transformers, _, err = constructParquetSchema(columns, opts)
+	require.NoError(t, err)
+	channel = &SnowflakeIngestionChannel{ChannelOptions: opts, transformers: transformers}
+	require.Equal(t, []string{"bar", "foo", "qux"}, channel.UnknownColumns(batch))
+}
+
+func newTestChannel(t *testing.T, buildOpts BuildOptions) *SnowflakeIngestionChannel {
+	t.Helper()
+	columns := []columnMetadata{
+		{
+			Name:         "ID",
+			Ordinal:      1,
+			Type:         "NUMBER(18,0)",
+			LogicalType:  "fixed",
+			PhysicalType: "SB8",
+			Precision:    ptr.Int32(18),
+			Scale:        ptr.Int32(0),
+			Nullable:     true,
+		},
+		{
+			Name:         "DATA",
+			Ordinal:      2,
+			Type:         "VARCHAR(16777216)",
+			LogicalType:  "text",
+			PhysicalType: "LOB",
+			Nullable:     true,
+		},
+	}
+	buildOpts.Parallelism = 1
+	buildOpts.ChunkSize = 50_000
+	opts := ChannelOptions{BuildOptions: buildOpts}
+	schema, transformers, typeMetadata, err := constructParquetSchema(columns, opts)
+	require.NoError(t, err)
+	return &SnowflakeIngestionChannel{
+		ChannelOptions: opts,
+		clientPrefix:   "test",
+		schema:         schema,
+		parquetWriter:  newParquetWriter("latest", schema),
+		rowGroupPool:   &rowGroupPool{},
+		transformers:   transformers,
+		fileMetadata:   typeMetadata,
+	}
+}
+
+// largeBatch returns a batch of rows with random values of rowSize bytes,
+// which don't compress well.
+func largeBatch(t *testing.T, rows, rowSize int) service.MessageBatch {
+	t.Helper()
+	batch := make(service.MessageBatch, rows)
+	for i := range batch {
+		data := make([]byte, rowSize/2)
+		_, err := rand.Read(data)
+		require.NoError(t, err)
+		b, err := json.Marshal(map[string]any{"ID": i, "DATA": hex.EncodeToString(data)})
+		require.NoError(t, err)
+		batch[i] = service.NewMessage(b)
+	}
+	return batch
+}
+
+type testFile struct {
+	from, to int
+	rows     int64
+	size     int
+}
+
+func collectFiles(t *testing.T, channel *SnowflakeIngestionChannel, batch service.MessageBatch) []testFile {
+	t.Helper()
+	var files []testFile
+	require.NoError(t, channel.forEachFile(batch, 0, 0, nil, func(_ string, _ int64, part bdecPart, _ time.Time, from, to int) error {
+		files = append(files, testFile{from: from, to: to, rows: part.parquetMetadata.NumRows, size: part.unencryptedLen})
+		return nil
+	}))
+	// The files must cover the whole batch in order.
+	next := 0
+	for _, f := range files {
+		require.Equal(t, next, f.from)
+		require.Equal(t, int64(f.to-f.from), f.rows)
+		next = f.to
+	}
+	require.Equal(t, len(batch), next)
+	return files
+}
+
+func TestForEachFileNoLimits(t *testing.T) {
+	channel := newTestChannel(t, BuildOptions{})
+	files := collectFiles(t, channel, largeBatch(t, 1000, 1024))
+	require.Len(t, files, 1)
+}
+
+func TestForEachFileMaxRows(t *testing.T) {
+	channel := newTestChannel(t, BuildOptions{MaxRowsPerFile: 300})
+	files := collectFiles(t, channel, largeBatch(t, 1000, 64))
+	require.Len(t, files, 4)
+	for _, f := range files[:3] {
+		require.Equal(t, int64(300), f.rows)
+	}
+	require.Equal(t, int64(100), files[3].rows)
+}
+
+func TestForEachFileMaxSize(t *testing.T) {
+	const maxSize = 64 * 1024
+	channel := newTestChannel(t, BuildOptions{MaxFileSizeBytes: maxSize})
+	files := collectFiles(t, channel, largeBatch(t, 2000, 1024))
+	require.Greater(t, len(files), 10)
+	for _, f := range files {
+		require.LessOrEqual(t, f.size, maxSize)
+	}
+}
+
+func TestForEachFileMaxSizeAndRows(t *testing.T) {
+	const maxSize = 64 * 1024
+	channel := newTestChannel(t, BuildOptions{MaxFileSizeBytes: maxSize, MaxRowsPerFile: 10})
+	files := collectFiles(t, channel, largeBatch(t, 200, 1024))
+	require.Len(t, files, 20)
+	for _, f := range files {
+		require.LessOrEqual(t, f.size, maxSize)
+	}
+}
+
+func TestForEachFileRowLargerThanMaxSize(t *testing.T) {
+	const maxSize = 4 * 1024
+	channel := newTestChannel(t, BuildOptions{MaxFileSizeBytes: maxSize})
+	files := collectFiles(t, channel, largeBatch(t, 5, 16*1024))
+	require.Len(t, files, 5)
+	for _, f := range files {
+		require.Equal(t, int64(1), f.rows)
+		require.Greater(t, f.size, maxSize)
+	}
+}
+
+func TestForEachFileReusesBuffersConcurrently(t *testing.T) {
+	columns := []columnMetadata{
+		{Name: "ID", Ordinal: 1, Type: "NUMBER(18,0)", LogicalType: "fixed", PhysicalType: "SB8", Precision: ptr.Int32(18), Scale: ptr.Int32(0), Nullable: true},
+		{Name: "BIG", Ordinal: 2, Type: "NUMBER(38,0)", LogicalType: "fixed", PhysicalType: "SB16", Precision: ptr.Int32(38), Scale: ptr.Int32(0), Nullable: true},
+		{Name: "DATA", Ordinal: 3, Type: "VARCHAR(16777216)", LogicalType: "text", PhysicalType: "LOB", Nullable: true},
+	}
+
+	// Each channel builds files from row groups which are built in parallel
+	// and reuse the buffers of the previous ones, the files must only contain
+	// the rows of their own batch.
+	wg := &errgroup.Group{}
+	for c := range 4 {
+		wg.Go(func() error {
+			opts := ChannelOptions{BuildOptions: BuildOptions{
+				Parallelism:       4,
+				ChunkSize:         37,
+				ColumnParallelism: 1 + c%2,
+				MaxRowsPerFile:    150 + 10*c,
+			}}
+			schema, transformers, typeMetadata, err := constructParquetSchema(columns, opts)
+			if err != nil {
+				return err
+			}
+			channel := &SnowflakeIngestionChannel{
+				ChannelOptions: opts,
+				clientPrefix:   "test",
+				schema:         schema,
+				parquetWriter:  newParquetWriter("latest", schema),
+				rowGroupPool:   &rowGroupPool{},
+				transformers:   transformers,
+				fileMetadata:   typeMetadata,
+			}
+			for round := range 5 {
+				batch := make(service.MessageBatch, 1000)
+				for i := range batch {
+					batch[i] = msg(fmt.Sprintf(`{"ID":%d,"BIG":"%d0000000000000000000","DATA":"channel-%d-row-%d"}`, round*len(batch)+i, i, c, i))
+				}
+				err := channel.forEachFile(batch, 0, 0, nil, func(_ string, _ int64, part bdecPart, _ time.Time, from, to int) error {
+					rows, err := readGeneric(bytes.NewReader(part.parquetFile), int64(len(part.parquetFile)), schema)
+					if err != nil {
+						return err
+					}
+					if len(rows) != to-from {
+						return fmt.Errorf("expected %d rows, got %d", to-from, len(rows))
+					}
+					for i, row := range rows {
+						expected := map[string]any{
+							"ID":   int64(round*len(batch) + from + i),
+							"BIG":  string(int128.MustParse(fmt.Sprintf("%d0000000000000000000", from+i)).AppendBigEndian(nil)),
+							"DATA": fmt.Sprintf("channel-%d-row-%d", c, from+i),
+						}
+						row["BIG"] = string(row["BIG"].([]byte))
+						if !reflect.DeepEqual(expected, row) {
+							return fmt.Errorf("expected row %v, got %v", expected, row)
+						}
+					}
+					return nil
+				})
+				if err != nil {
+					return fmt.Errorf("channel %d: %w", c, err)
+				}
+			}
+			return nil
+		})
+	}
+	require.NoError(t, wg.Wait())
+}
+
+func BenchmarkConstructBdecPart(b *testing.B) {
+	const columns = 40
+	schema, transformers := wideTestSchema(b, columns, ConversionErrorModeReject)
+	data := make([][]byte, 10_000)
+	for i := range data {
+		row := map[string]any{}
+		for j := range columns {
+			row[fmt.Sprintf("C%d", j)] = []any{i * j, float64(i) / 7, fmt.Sprintf("value-%d", i%1000), i%2 == 0}[j%4]
+		}
+		encoded, err := json.Marshal(row)
+		require.NoError(b, err)
+		data[i] = encoded
+	}
+	for _, pooled := range []bool{false, true} {
+		b.Run(fmt.Sprintf("pooled=%v", pooled), func(b *testing.B) {
+			channel := &SnowflakeIngestionChannel{
+				ChannelOptions: ChannelOptions{BuildOptions: BuildOptions{Parallelism: 4, ChunkSize: 1_000}},
+				schema:         schema,
+				parquetWriter:  newParquetWriter("latest", schema),
+				transformers:   transformers,
+			}
+			if pooled {
+				channel.rowGroupPool = &rowGroupPool{}
+			}
+			b.ReportAllocs()
+			for range b.N {
+				b.StopTimer()
+				batch := testBatch(data)
+				// Only the build is measured, not parsing the messages.
+				for _, m := range batch {
+					_, err := m.AsStructured()
+					require.NoError(b, err)
+				}
+				b.StartTimer()
+				_, err := channel.constructBdecPart(batch, nil)
+				require.NoError(b, err)
+			}
+		})
+	}
+}
+
+func TestOffsetTokenRangeSub(t *testing.T) {
+	tokenAt := func(i int) (OffsetToken, error) {
+		return OffsetToken(strconv.Itoa(100 + i)), nil
+	}
+	r := &OffsetTokenRange{Start: "100", End: "109", TokenAt: tokenAt}
+
+	sub, err := r.sub(0, 10, 10)
+	require.NoError(t, err)
+	require.Same(t, r, sub)
+
+	sub, err = r.sub(0, 4, 10)
+	require.NoError(t, err)
+	require.Equal(t, OffsetToken("100"), sub.Start)
+	require.Equal(t, OffsetToken("103"), sub.End)
+
+	sub, err = r.sub(4, 8, 10)
+	require.NoError(t, err)
+	require.Equal(t, OffsetToken("104"), sub.Start)
+	require.Equal(t, OffsetToken("107"), sub.End)
+
+	sub, err = r.sub(8, 10, 10)
+	require.NoError(t, err)
+	require.Equal(t, OffsetToken("108"), sub.Start)
+	require.Equal(t, OffsetToken("109"), sub.End)
+
+	var nilRange *OffsetTokenRange
+	sub, err = nilRange.sub(0, 4, 10)
+	require.NoError(t, err)
+	require.Nil(t, sub)
+
+	_, err = (&OffsetTokenRange{Start: "100", End: "109"}).sub(0, 4, 10)
+	require.Error(t, err)
+}
+
+// fakeRegistrar registers files after a delay and tracks the number of files
+// that were uploaded but not yet registered. It also serves the status of the
+// channel, for which every registered file is committed immediately.
+type fakeRegistrar struct {
+	delay time.Duration
+	// Fails the registration of the file with the given row sequencer.
+	failRowSequencer int64
+	// The number of times each registration is throttled before it succeeds.
+	throttle int
+	// The number of registrations which time out before the files are
+	// registered.
+	failRequests int
+	// The number of registrations for which the response is lost after the
+	// files were registered.
+	dropResponses int
+	// The number of the most recently registered files that the status of
+	// the channel doesn't report as committed yet.
+	uncommitted int
+
+	mu            sync.Mutex
+	pending       int
+	maxPending    int
+	throttled     map[string]int
+	submitted     []string
+	statusChecks  int
+	rowSequencers []int64
+	endOffsets    []OffsetToken
+}
+
+func (r *fakeRegistrar) upload(context.Context, string, []byte, []byte, map[string]string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending++
+	r.maxPending = max(r.maxPending, r.pending)
+	return nil
+}
+
+func (r *fakeRegistrar) register(_ context.Context, blobs []blobMetadata) ([]blobRegisterStatus, error) {
+	time.Sleep(r.delay)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	resp := make([]blobRegisterStatus, len(blobs))
+	for i, blob := range blobs {
+		r.submitted = append(r.submitted, blob.Path)
+		if r.failRequests > 0 {
+			r.failRequests--
+			return nil, fmt.Errorf("unable to register blobs: %w", &HTTPError{StatusCode: http.StatusGatewayTimeout})
+		}
+		if r.throttled[blob.Path] < r.throttle {
+			r.throttled[blob.Path]++
+			return nil, fmt.Errorf("unable to register blobs: %w", &HTTPError{StatusCode: http.StatusTooManyRequests, RetryAfter: 10 * time.Millisecond})
+		}
+		channel := blob.Chunks[0].Channels[0]
+		status := channelRegisterStatus{StatusCode: responseSuccess, ClientSequencer: channel.ClientSequencer}
+		if channel.RowSequencer == r.failRowSequencer {
+			status.StatusCode = 19
+		} else if n := len(r.rowSequencers); n > 0 && channel.RowSequencer <= r.rowSequencers[n-1] {
+			status.StatusCode = responseErrInvalidRowSequencer
+		} else {
+			r.pending--
+			r.rowSequencers = append(r.rowSequencers, channel.RowSequencer)
+			r.endOffsets = append(r.endOffsets, *channel.EndOffsetToken)
+		}
+		resp[i] = blobRegisterStatus{Chunks: []chunkRegisterStatus{{Channels: []channelRegisterStatus{status}}}}
+	}
+	if r.dropResponses > 0 {
+		r.dropResponses--
+		return nil, fmt.Errorf("unable to register blobs: %w", &HTTPError{StatusCode: http.StatusBadGateway})
+	}
+	return resp, nil
+}
+
+func (r *fakeRegistrar) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var statusReq batchChannelStatusRequest
+	if err := json.NewDecoder(req.Body).Decode(&statusReq); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statusChecks++
+	status := channelStatusResponse{PersistedClientSequencer: *statusReq.Channels[0].ClientSequencer}
+	if n := len(r.rowSequencers) - r.uncommitted; n > 0 {
+		status.PersistedRowSequencer = r.rowSequencers[n-1]
+		status.PersistedOffsetToken = string(r.endOffsets[n-1])
+	}
+	_ = json.NewEncoder(w).Encode(batchChannelStatusResponse{Channels: []channelStatusResponse{status}})
+}
+
+func newTestRegistrationChannel(t *testing.T, buildOpts BuildOptions, registrar *fakeRegistrar) *SnowflakeIngestionChannel {
+	t.Helper()
+	registrar.throttled = map[string]int{}
+	channel := newTestChannel(t, buildOpts)
+	channel.Name = "test_channel"
+	channel.clientSequencer = 3
+	channel.encryptionInfo = &encryptionInfo{encryptionKey: base64.StdEncoding.EncodeToString(make([]byte, 32))}
+	channel.uploaderManager = newTestUploaderManager(func(context.Context) (uploader, error) {
+		return registrar, nil
+	})
+	channel.uploaderManager.RefreshUploader(context.Background())
+	srv := httptest.NewServer(registrar)
+	t.Cleanup(srv.Close)
+	channel.client = &SnowflakeRestClient{
+		url:       srv.URL,
+		client:    srv.Client(),
+		logger:    service.MockResources().Logger(),
+		cachedJWT: typed.NewAtomicValue(signedJWT{}),
+	}
+	flusher, err := asyncroutine.NewBatcher(100, registrar.register)
+	require.NoError(t, err)
+	t.Cleanup(flusher.Close)
+	channel.flusher = flusher
+	channel.registerBackOff = func() backoff.BackOff {
+		return backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 3)
+	}
+	channel.registerStatusBackOff = func() backoff.BackOff {
+		return backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 2)
+	}
+	return channel
+}
+
+func testOffsetTokenRange(from, n int) *OffsetTokenRange {
+	return &OffsetTokenRange{
+		Start: OffsetToken(strconv.Itoa(from)),
+		End:   OffsetToken(strconv.Itoa(from + n - 1)),
+		TokenAt: func(i int) (OffsetToken, error) {
+			return OffsetToken(strconv.Itoa(from + i)), nil
+		},
+	}
+}
+
+func TestInsertRowsBoundsPendingRegistrations(t *testing.T) {
+	registrar := &fakeRegistrar{delay: 5 * time.Millisecond}
+	channel := newTestRegistrationChannel(t, BuildOptions{MaxRowsPerFile: 10, MaxPendingRegistrations: 3}, registrar)
+	var mu sync.Mutex
+	var pending, maxPending int
+	channel.OnPendingRegistration = func(delta int) {
+		mu.Lock()
+		defer mu.Unlock()
+		pending += delta
+		maxPending = max(maxPending, pending)
+	}
+
+	const batches, rows = 10, 100
+	for i := range batches {
+		stats, err := channel.InsertRows(context.Background(), largeBatch(t, rows, 64), testOffsetTokenRange(i*rows, rows))
+		require.NoError(t, err)
+		require.Len(t, stats.Files, rows/10)
+		for j, f := range stats.Files {
+			require.Equal(t, j*10, f.FirstRow)
+			require.Equal(t, int64(10), f.Rows)
+			require.LessOrEqual(t, f.PendingRegistrations, 3)
+		}
+	}
+
+	// The number of files waiting to be registered never exceeds the limit,
+	// and the files are registered in the order they were built.
+	require.LessOrEqual(t, registrar.maxPending, 3)
+	require.Zero(t, pending)
+	require.Positive(t, maxPending)
+	require.LessOrEqual(t, maxPending, 3)
+	require.Len(t, registrar.rowSequencers, batches*rows/10)
+	for i, seq := range registrar.rowSequencers {
+		require.Equal(t, int64(i+1), seq)
+		require.Equal(t, OffsetToken(strconv.Itoa(i*10+9)), registrar.endOffsets[i])
+	}
+	require.Equal(t, int64(batches*rows/10), channel.rowSequencer)
+	require.Equal(t, OffsetToken(strconv.Itoa(batches*rows-1)), *channel.LatestOffsetToken())
+}
+
+func TestInsertRowsSkipsEmptyBatch(t *testing.T) {
+	registrar := &fakeRegistrar{}
+	channel := newTestRegistrationChannel(t, BuildOptions{MaxRowsPerFile: 10, MaxPendingRegistrations: 2}, registrar)
+
+	// A flush without rows doesn't upload or register a file.
+	stats, err := channel.InsertRows(context.Background(), service.MessageBatch{}, nil)
+	require.NoError(t, err)
+	require.Empty(t, stats.Files)
+	require.Zero(t, registrar.maxPending)
+	require.Empty(t, registrar.submitted)
+	require.Zero(t, channel.rowSequencer)
+	require.Nil(t, channel.LatestOffsetToken())
+}
+
+func TestInsertRowsStopsAfterFailedRegistration(t *testing.T) {
+	registrar := &fakeRegistrar{failRowSequencer: 3}
+	channel := newTestRegistrationChannel(t, BuildOptions{MaxRowsPerFile: 10, MaxPendingRegistrations: 2}, registrar)
+	var pending atomic.Int64
+	channel.OnPendingRegistration = func(delta int) {
+		pending.Add(int64(delta))
+	}
+
+	stats, err := channel.InsertRows(context.Background(), largeBatch(t, 100, 64), testOffsetTokenRange(0, 100))
+	var ingestionErr *IngestionFailedError
+	require.ErrorAs(t, err, &ingestionErr)
+	require.Equal(t, int64(3), ingestionErr.ExpectedClientSequencer)
+
+	// The files after the failed one are never registered.
+	require.Equal(t, []int64{1, 2}, registrar.rowSequencers)
+	require.Zero(t, pending.Load())
+	require.Len(t, stats.Files, 2)
+	require.Equal(t, int64(2), channel.rowSequencer)
+	require.Equal(t, OffsetToken("19"), *channel.LatestOffsetToken())
+}
+
+func TestInsertRowsSkipsRegisteredRowsOfRetriedBatch(t *testing.T) {
+	registrar := &fakeRegistrar{failRowSequencer: 3}
+	channel := newTestRegistrationChannel(t, BuildOptions{MaxRowsPerFile: 10, MaxPendingRegistrations: 2}, registrar)
+	channel.partialInserts = newPartialInserts()
+
+	batch := largeBatch(t, 50, 64)
+	_, err := channel.InsertRows(context.Background(), batch, testOffsetTokenRange(0, 50))
+	require.Error(t, err)
+	require.Equal(t, []int64{1, 2}, registrar.rowSequencers)
+
+	// A batch with other rows is written entirely.
+	registrar.failRowSequencer = 0
+	stats, err := channel.InsertRows(context.Background(), largeBatch(t, 20, 64), testOffsetTokenRange(50, 20))
+	require.NoError(t, err)
+	require.Len(t, stats.Files, 2)
+	require.Equal(t, 0, stats.Files[0].FirstRow)
+
+	// Retrying the batch only writes the rows of the files that weren't
+	// registered by the failed attempt.
+	stats, err = channel.InsertRows(context.Background(), batch, testOffsetTokenRange(0, 50))
+	require.NoError(t, err)
+	require.Len(t, stats.Files, 3)
+	for i, f := range stats.Files {
+		require.Equal(t, 20+i*10, f.FirstRow)
+	}
+	require.Equal(t, []int64{1, 2, 3, 4, 5, 6, 7}, registrar.rowSequencers)
+	require.Equal(t, OffsetToken("49"), *channel.LatestOffsetToken())
+	require.Equal(t, OffsetToken("29"), registrar.endOffsets[4])
+
+	// Once the batch was written it isn't skipped anymore.
+	require.Zero(t, channel.partialInserts.take("..", batch))
+}
+
+func TestInsertRowsRetriesThrottledRegistrations(t *testing.T) {
+	registrar := &fakeRegistrar{throttle: 2}
+	channel := newTestRegistrationChannel(t, BuildOptions{MaxRowsPerFile: 50, MaxPendingRegistrations: 2}, registrar)
+
+	start := time.Now()
+	stats, err := channel.InsertRows(context.Background(), largeBatch(t, 100, 64), testOffsetTokenRange(0, 100))
+	require.NoError(t, err)
+	// The registrations wait for the delay requested by Retry-After.
+	require.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+	require.Len(t, stats.Files, 2)
+	for _, f := range stats.Files {
+		require.Equal(t, 2, f.RegisterRetries)
+	}
+	require.Equal(t, []int64{1, 2}, registrar.rowSequencers)
+
+	registrar.throttle = 10
+	_, err = channel.InsertRows(context.Background(), largeBatch(t, 10, 64), testOffsetTokenRange(100, 10))
+	var httpErr *HTTPError
+	require.ErrorAs(t, err, &httpErr)
+	require.Equal(t, http.StatusTooManyRequests, httpErr.StatusCode)
+	require.Equal(t, int64(2), channel.rowSequencer)
+}
+
+func TestInsertRowsSkipsRegisteredFilesAfterLostResponses(t *testing.T) {
+	registrar := &fakeRegistrar{dropResponses: 2}
+	channel := newTestRegistrationChannel(t, BuildOptions{MaxRowsPerFile: 10, MaxPendingRegistrations: 2}, registrar)
+
+	stats, err := channel.InsertRows(context.Background(), largeBatch(t, 30, 64), testOffsetTokenRange(0, 30))
+	require.NoError(t, err)
+
+	// The responses to the first two files were lost, the status of the
+	// channel shows they were registered so they aren't submitted again.
+	require.Equal(t, []int64{1, 2, 3}, registrar.rowSequencers)
+	require.Len(t, registrar.submitted, 3)
+	require.Equal(t, 2, registrar.statusChecks)
+	require.Len(t, stats.Files, 3)
+	for i, f := range stats.Files {
+		require.Equal(t, int64(10), f.Rows)
+		require.Equal(t, min(1, 2-i), f.RegisterRetries)
+	}
+	require.Equal(t, int64(3), channel.rowSequencer)
+	require.Equal(t, OffsetToken("29"), *channel.LatestOffsetToken())
+}
+
+func TestInsertRowsRetriesUnregisteredFilesWithSamePath(t *testing.T) {
+	registrar := &fakeRegistrar{failRequests: 1}
+	channel := newTestRegistrationChannel(t, BuildOptions{MaxRowsPerFile: 10, MaxPendingRegistrations: 2}, registrar)
+
+	_, err := channel.InsertRows(context.Background(), largeBatch(t, 20, 64), testOffsetTokenRange(0, 20))
+	require.NoError(t, err)
+
+	// The first file wasn't registered by the failed request, so the same
+	// file is submitted again once the status of the channel was checked.
+	require.Equal(t, []int64{1, 2}, registrar.rowSequencers)
+	require.Len(t, registrar.submitted, 3)
+	require.Equal(t, registrar.submitted[0], registrar.submitted[1])
+	require.NotEqual(t, registrar.submitted[1], registrar.submitted[2])
+	require.Equal(t, 3, registrar.statusChecks)
+}
+
+func TestInsertRowsSkipsUncommittedFilesAfterLostResponses(t *testing.T) {
+	registrar := &fakeRegistrar{dropResponses: 1, uncommitted: 1}
+	channel := newTestRegistrationChannel(t, BuildOptions{MaxRowsPerFile: 10, MaxPendingRegistrations: 2}, registrar)
+
+	stats, err := channel.InsertRows(context.Background(), largeBatch(t, 20, 64), testOffsetTokenRange(0, 20))
+	require.NoError(t, err)
+
+	// The first file was registered but the channel status never reports it
+	// as committed, so it's submitted again and rejected with an invalid row
+	// sequencer, which means its rows aren't duplicated.
+	require.Equal(t, []int64{1, 2}, registrar.rowSequencers)
+	require.Equal(t, []OffsetToken{"9", "19"}, registrar.endOffsets)
+	require.Len(t, registrar.submitted, 3)
+	require.Equal(t, registrar.submitted[0], registrar.submitted[1])
+	require.Equal(t, 3, registrar.statusChecks)
+	require.Len(t, stats.Files, 2)
+	require.Equal(t, 1, stats.Files[0].RegisterRetries)
+	require.Equal(t, 0, stats.Files[1].RegisterRetries)
+	require.Equal(t, int64(2), channel.rowSequencer)
+	require.Equal(t, OffsetToken("19"), *channel.LatestOffsetToken())
+}
+
+func TestBlobPathDeterministic(t *testing.T) {
+	channel := newTestChannel(t, BuildOptions{})
+	channel.Name = "test_channel"
+	name := func(clientSequencer, rowSequencer int64) string {
+		return path.Base(channel.blobPath(clientSequencer, rowSequencer))
+	}
+	// The name starts with the time in seconds, which is ignored.
+	suffix := func(name string) string {
+		return name[strings.Index(name, "_"):]
+	}
+
+	require.Equal(t, suffix(name(3, 7)), suffix(name(3, 7)))
+	require.NotEqual(t, suffix(name(3, 7)), suffix(name(3, 8)))
+	require.NotEqual(t, suffix(name(3, 7)), suffix(name(4, 7)))
+
+	other := newTestChannel(t, BuildOptions{})
+	other.Name = "other_channel"
+	require.NotEqual(t, suffix(name(3, 7)), suffix(path.Base(other.blobPath(3, 7))))
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package streaming
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/redpanda-data/connect/v4/internal/impl/snowflake/streaming/int128"
+)
+
+// ColumnSummaries holds data quality statistics about the values written to
+// each column of a table, which can be merged across inserts to summarize a
+// window of time. The statistics are the ones gathered while converting the
+// values, so collecting them doesn't need another pass over the data.
+type ColumnSummaries struct {
+	columns map[string]*columnSummary
+}
+
+type columnSummary struct {
+	column *columnMetadata
+	rows   int64
+	stats  *statsBuffer
+}
+
+// ColumnSummary is the data quality summary of a single column.
+type ColumnSummary struct {
+	// The number of rows written, including the nulls.
+	Rows int64
+	// The number of nulls written, including the values that failed
+	// conversion and were written as null.
+	Nulls int64
+	// The number of values that failed conversion and were written as null.
+	ConversionErrors int64
+	// The smallest and largest values written, which are nil when the column
+	// only contains nulls. Numbers with a scale are formatted as strings so
+	// that they're exact, as are timestamps and times, which are formatted as
+	// seconds since the epoch or since midnight. Binary values are formatted
+	// as hex and semi-structured values are compared as JSON.
+	Min, Max any
+	// The length in bytes of the longest value written to string, binary and
+	// semi-structured columns.
+	MaxLength int64
+}
+
+// newColumnSummaries summarizes the statistics of rows which were written
+// using transformers. The values of the statistics are copied, as they may
+// refer to buffers which are reused.
+func newColumnSummaries(rows int64, transformers []*dataTransformer, stats []*statsBuffer) *ColumnSummaries {
+	s := &ColumnSummaries{columns: make(map[string]*columnSummary, len(transformers))}
+	for idx, transformer := range transformers {
+		stat := *stats[idx]
+		stat.minStrVal = bytes.Clone(stat.minStrVal)
+		stat.maxStrVal = bytes.Clone(stat.maxStrVal)
+		stat.ndv = nil
+		s.columns[transformer.column.Name] = &columnSummary{column: transformer.column, rows: rows, stats: &stat}
+	}
+	return s
+}
+
+// Merge adds the statistics of other to s.
+func (s *ColumnSummaries) Merge(other *ColumnSummaries) {
+	if other == nil {
+		return
+	}
+	if s.columns == nil {
+		s.columns = make(map[string]*columnSummary, len(other.columns))
+	}
+	for name, o := range other.columns {
+		c, ok := s.columns[name]
+		if !ok {
+			stat := *o.stats
+			s.columns[name] = &columnSummary{column: o.column, rows: o.rows, stats: &stat}
+			continue
+		}
+		// The column may have been altered by schema evolution, in which case
+		// its latest metadata is used to format the values.
+		c.column = o.column
+		c.rows += o.rows
+		c.stats = mergeStats(c.stats, o.stats)
+	}
+}
+
+// Columns returns the summary of each column by its name.
+func (s *ColumnSummaries) Columns() map[string]ColumnSummary {
+	out := make(map[string]ColumnSummary, len(s.columns))
+	for name, c := range s.columns {
+		summary := ColumnSummary{
+			Rows:             c.rows,
+			Nulls:            c.stats.nullCount,
+			ConversionErrors: c.stats.conversionErrors,
+		}
+		if c.stats.hasData {
+			summary.Min, summary.Max = formatColumnBounds(c.column, c.stats)
+			summary.MaxLength = int64(c.stats.maxStrLen)
+		}
+		out[name] = summary
+	}
+	return out
+}
+
+func formatColumnBounds(column *columnMetadata, stats *statsBuffer) (minVal, maxVal any) {
+	logicalType := strings.ToLower(column.LogicalType)
+	var scale int32
+	if column.Scale != nil {
+		scale = *column.Scale
+	} else if logicalType == "time" {
+		scale = 9
+	}
+	switch logicalType {
+	case "fixed", "time", "timestamp_ntz", "timestamp_ltz":
+		return int128.FormatDecimal(stats.minIntVal, scale), int128.FormatDecimal(stats.maxIntVal, scale)
+	case "timestamp_tz":
+		return int128.FormatDecimal(timestampTZEpoch(stats.minIntVal), scale), int128.FormatDecimal(timestampTZEpoch(stats.maxIntVal), scale)
+	case "date":
+		return formatEpochDays(stats.minIntVal), formatEpochDays(stats.maxIntVal)
+	case "boolean":
+		return stats.minIntVal.ToInt64() != 0, stats.maxIntVal.ToInt64() != 0
+	case "real":
+		return stats.minRealVal, stats.maxRealVal
+	case "binary":
+		return hex.EncodeToString(stats.minStrVal), hex.EncodeToString(stats.maxStrVal)
+	}
+	return string(stats.minStrVal), string(stats.maxStrVal)
+}
+
+// timestampTZEpoch returns the scaled epoch of a TIMESTAMP_TZ value, whose
+// lowest 14 bits hold the timezone offset.
+func timestampTZEpoch(v int128.Num) int128.Num {
+	const tzMask = (1 << 14) - 1
+	offset := int128.FromInt64(v.ToInt64() & tzMask)
+	return int128.Div64(int128.Sub(v, offset), 1<<14)
+}
+
+func formatEpochDays(v int128.Num) string {
+	return time.Unix(v.ToInt64()*24*60*60, 0).UTC().Format(time.DateOnly)
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package streaming
+
+import (
+	"testing"
+
+	"github.com/aws/smithy-go/ptr"
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestColumnSummaries(t *testing.T) {
+	columns := []columnMetadata{
+		{
+			Name:         "AMOUNT",
+			Ordinal:      1,
+			Type:         "NUMBER(10,2)",
+			LogicalType:  "fixed",
+			PhysicalType: "SB8",
+			Precision:    ptr.Int32(10),
+			Scale:        ptr.Int32(2),
+			Nullable:     true,
+		},
+		{
+			Name:         "NAME",
+			Ordinal:      2,
+			Type:         "VARCHAR(16777216)",
+			LogicalType:  "text",
+			PhysicalType: "LOB",
+			Nullable:     true,
+		},
+		{
+			Name:         "ACTIVE",
+			Ordinal:      3,
+			Type:         "BOOLEAN",
+			LogicalType:  "boolean",
+			PhysicalType: "SB1",
+			Nullable:     true,
+		},
+		{
+			Name:         "DAY",
+			Ordinal:      4,
+			Type:         "DATE",
+			LogicalType:  "date",
+			PhysicalType: "SB4",
+			Nullable:     true,
+		},
+		{
+			Name:         "AT",
+			Ordinal:      5,
+			Type:         "TIMESTAMP_TZ(3)",
+			LogicalType:  "timestamp_tz",
+			PhysicalType: "SB16",
+			Scale:        ptr.Int32(3),
+			Nullable:     true,
+		},
+	}
+	schema, transformers, _, err := constructParquetSchema(columns, ChannelOptions{ConversionErrorMode: ConversionErrorModeNull})
+	require.NoError(t, err)
+
+	summarize := func(batch service.MessageBatch) *ColumnSummaries {
+		t.Helper()
+		_, stats, err := constructRowGroup(batch, schema, transformers, nil, SchemaModeIgnoreExtra, false, false, 1)
+		require.NoError(t, err)
+		return newColumnSummaries(int64(len(batch)), transformers, stats)
+	}
+
+	first := summarize(service.MessageBatch{
+		msg(`{"amount":12.5,"name":"bob","active":true,"day":"2024-01-02T12:00:00Z","at":"2024-01-02T03:04:05.678+01:00"}`),
+		msg(`{"amount":"nope","name":null,"active":"maybe","day":"2024-01-01T00:00:00Z"}`),
+		msg(`{"amount":-3,"name":"alexandra","active":false}`),
+	})
+	second := summarize(service.MessageBatch{
+		msg(`{"amount":null,"name":"zed","active":false,"day":"yesterday","at":"2023-12-31T23:00:00Z"}`),
+		msg(`{"amount":99.99}`),
+	})
+
+	var window ColumnSummaries
+	window.Merge(first)
+	window.Merge(second)
+	window.Merge(nil)
+	require.Equal(t, map[string]ColumnSummary{
+		"AMOUNT": {Rows: 5, Nulls: 2, ConversionErrors: 1, Min: "-3.00", Max: "99.99"},
+		"NAME":   {Rows: 5, Nulls: 2, Min: "alexandra", Max: "zed", MaxLength: 9},
+		"ACTIVE": {Rows: 5, Nulls: 2, ConversionErrors: 1, Min: false, Max: true},
+		"DAY":    {Rows: 5, Nulls: 3, ConversionErrors: 1, Min: "2024-01-01", Max: "2024-01-02"},
+		"AT":     {Rows: 5, Nulls: 3, Min: "1704063600.000", Max: "1704161045.678"},
+	}, window.Columns())
+
+	// The summaries of each insert are kept apart from the window they're
+	// merged into.
+	require.Equal(t, int64(3), first.Columns()["NAME"].Rows)
+	require.Equal(t, "bob", first.Columns()["NAME"].Max)
+}
+
+func TestColumnSummariesOnlyNulls(t *testing.T) {
+	columns := []columnMetadata{
+		{
+			Name:         "A",
+			Ordinal:      1,
+			Type:         "REAL",
+			LogicalType:  "real",
+			PhysicalType: "DOUBLE",
+			Nullable:     true,
+		},
+	}
+	schema, transformers, _, err := constructParquetSchema(columns, ChannelOptions{})
+	require.NoError(t, err)
+	_, stats, err := constructRowGroup(service.MessageBatch{msg(`{"a":null}`), msg(`{}`)}, schema, transformers, nil, SchemaModeIgnoreExtra, false, false, 1)
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]ColumnSummary{
+		"A": {Rows: 2, Nulls: 2},
+	}, newColumnSummaries(2, transformers, stats).Columns())
+}
@@ -0,0 +1,351 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package streaming
+
+import (
+	"time"
+)
+
+// timeLayoutParser parses strings using a list of Go time layouts which are
+// tried in order, like trying time.Parse with each of them would. Layouts
+// which can't match a value are skipped without parsing it, by checking the
+// characters which the layout fixes at the start of its values and the length
+// of its values when it only has fixed width elements, and the common RFC 3339
+// and date only layouts are parsed without time.Parse.
+//
+// The parser is safe for concurrent use.
+type timeLayoutParser struct {
+	layouts []timeLayout
+	// The location of the parsed values, nil parses them the same way as
+	// time.Parse does rather than time.ParseInLocation.
+	loc *time.Location
+}
+
+type timeLayoutKind int
+
+const (
+	timeLayoutOther timeLayoutKind = iota
+	timeLayoutRFC3339
+	timeLayoutWithoutTZ
+	timeLayoutDateOnly
+)
+
+// timeLayout is a layout along with what the values it can parse start with.
+type timeLayout struct {
+	layout string
+	kind   timeLayoutKind
+	// The leading characters of the values, where digitByte stands for any
+	// digit.
+	prefix []byte
+	// The length of the values, which is -1 when it varies.
+	length int
+}
+
+// digitByte stands for any digit in the prefix of a timeLayout, it's never a
+// character of a layout which doesn't fail to parse.
+const digitByte = 0
+
+func newTimeLayoutParser(loc *time.Location, layouts ...string) *timeLayoutParser {
+	p := &timeLayoutParser{layouts: make([]timeLayout, len(layouts)), loc: loc}
+	for i, layout := range layouts {
+		p.layouts[i] = newTimeLayout(layout)
+	}
+	return p
+}
+
+func newTimeLayout(layout string) timeLayout {
+	l := timeLayout{layout: layout, length: -1}
+	switch layout {
+	case time.RFC3339, time.RFC3339Nano:
+		l.kind = timeLayoutRFC3339
+	case timestampWithoutTZLayout:
+		l.kind = timeLayoutWithoutTZ
+	case time.DateOnly:
+		l.kind = timeLayoutDateOnly
+	}
+	// Only the elements which time.Parse matches with a fixed number of
+	// digits and the literal characters which can't start an element are
+	// followed, the values are unknown from the first other element onwards.
+	for i := 0; i < len(layout); {
+		rest := layout[i:]
+		switch {
+		case len(rest) >= 4 && rest[:4] == "2006":
+			l.prefix = append(l.prefix, digitByte, digitByte, digitByte, digitByte)
+			i += 4
+			continue
+		case len(rest) >= 2 && rest[0] == '0' && rest[1] >= '1' && rest[1] <= '5':
+			l.prefix = append(l.prefix, digitByte, digitByte)
+			i += 2
+			// Values may have fractional seconds after the seconds even
+			// when the layout doesn't.
+			if rest[1] == '5' {
+				return l
+			}
+			continue
+		case len(rest) >= 2 && rest[:2] == "06":
+			// Two digit years may start with a sign.
+			return l
+		case len(rest) >= 3 && rest[:3] == "002":
+			return l
+		}
+		c := rest[0]
+		switch {
+		case c == ' ' || c == '_' || c == 'J' || c == 'M' || c == 'P' || c == 'p' || c == 'Z' || c == '1' || c == '2' || c == '3' || c == '4' || c == '5':
+			return l
+		case c == '-' && len(rest) >= 3 && rest[:3] == "-07":
+			return l
+		case (c == '.' || c == ',') && len(rest) >= 2 && (rest[1] == '0' || rest[1] == '9'):
+			return l
+		case c == digitByte:
+			return l
+		}
+		l.prefix = append(l.prefix, c)
+		i++
+	}
+	l.length = len(layout)
+	return l
+}
+
+// mayMatch returns false when the layout can't parse s.
+func (l *timeLayout) mayMatch(s string) bool {
+	if len(s) < len(l.prefix) || (l.length >= 0 && len(s) != l.length) {
+		return false
+	}
+	for i, c := range l.prefix {
+		if c == digitByte {
+			if !isDigit(s[i]) {
+				return false
+			}
+		} else if s[i] != c {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *timeLayoutParser) parse(s string) (time.Time, bool) {
+	for i := range p.layouts {
+		if t, ok := p.parseLayout(&p.layouts[i], s); ok {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (p *timeLayoutParser) parseLayout(l *timeLayout, s string) (time.Time, bool) {
+	switch l.kind {
+	case timeLayoutRFC3339:
+		local := p.loc
+		if local == nil {
+			local = time.Local
+		}
+		if t, ok, rejected := parseRFC3339(s, true, local); ok || rejected {
+			return t, ok
+		}
+	case timeLayoutWithoutTZ:
+		defaultLoc := p.loc
+		if defaultLoc == nil {
+			defaultLoc = time.UTC
+		}
+		if t, ok, rejected := parseRFC3339(s, false, defaultLoc); ok || rejected {
+			return t, ok
+		}
+	}
+	if !l.mayMatch(s) {
+		return time.Time{}, false
+	}
+	if l.kind == timeLayoutDateOnly {
+		// The prefix already matched every character of the date.
+		return parseDateOnly(s, p.loc)
+	}
+	var t time.Time
+	var err error
+	if p.loc == nil {
+		t, err = time.Parse(l.layout, s)
+	} else {
+		t, err = time.ParseInLocation(l.layout, s, p.loc)
+	}
+	return t, err == nil
+}
+
+// parseRFC3339 parses the two most common forms of timestamps faster than
+// time.ParseInLocation, which are RFC 3339 with an offset when withOffset is
+// set, and without an offset otherwise, both with an optional fractional
+// second. Timestamps without an offset are in loc, while timestamps with an
+// offset use loc if it has the same offset at that time. The result is the
+// same as time.ParseInLocation with time.RFC3339Nano or
+// timestampWithoutTZLayout, but false is returned for any value which isn't
+// handled here so that it's parsed by time.ParseInLocation instead, unless
+// rejected is set, which means that time.ParseInLocation fails to parse it
+// too, such as a timestamp whose offset is missing or unexpected.
+func parseRFC3339(s string, withOffset bool, loc *time.Location) (parsed time.Time, ok, rejected bool) {
+	if len(s) < len("2006-01-02T15:04:05") || s[4] != '-' || s[7] != '-' || s[10] != 'T' || s[13] != ':' || s[16] != ':' {
+		return time.Time{}, false, false
+	}
+	century, ok1 := parseTwoDigits(s, 0)
+	year, ok2 := parseTwoDigits(s, 2)
+	month, ok3 := parseTwoDigits(s, 5)
+	day, ok4 := parseTwoDigits(s, 8)
+	hour, ok5 := parseTwoDigits(s, 11)
+	minute, ok6 := parseTwoDigits(s, 14)
+	sec, ok7 := parseTwoDigits(s, 17)
+	year += century * 100
+	if !(ok1 && ok2 && ok3 && ok4 && ok5 && ok6 && ok7) ||
+		month < 1 || month > 12 || day < 1 || day > daysInMonth(month, year) ||
+		hour > 23 || minute > 59 || sec > 59 {
+		return time.Time{}, false, false
+	}
+	s = s[19:]
+
+	var nsec int
+	if len(s) >= 2 && s[0] == '.' && isDigit(s[1]) {
+		n := 1
+		for n < len(s) && isDigit(s[n]) {
+			n++
+		}
+		// Digits beyond nanoseconds are truncated.
+		digits := s[1:min(n, 10)]
+		i := 0
+		for ; i+1 < len(digits); i += 2 {
+			pair, _ := parseTwoDigits(digits, i)
+			nsec = nsec*100 + pair
+		}
+		if i < len(digits) {
+			nsec = nsec*10 + int(digits[i]-'0')
+		}
+		nsec *= nanosecondScales[len(digits)]
+		s = s[n:]
+	}
+
+	if !withOffset {
+		if len(s) != 0 {
+			// The layout ends after the fractional second, so an offset is
+			// extra text.
+			return time.Time{}, false, s[0] == 'Z' || s[0] == '+' || s[0] == '-'
+		}
+		if loc != time.UTC {
+			return time.Date(year, time.Month(month), day, hour, minute, sec, nsec, loc), true, false
+		}
+	}
+	// The date and time are already validated, so the epoch can be computed
+	// directly, which is cheaper than normalizing them with time.Date.
+	unix := epochDays(year, month, day)*24*60*60 + int64(hour*60*60+minute*60+sec)
+	if !withOffset || (len(s) == 1 && s[0] == 'Z') {
+		return time.Unix(unix, int64(nsec)).UTC(), true, false
+	}
+	if len(s) == 0 {
+		// The offset is required.
+		return time.Time{}, false, true
+	}
+	if len(s) != len("-07:00") || (s[0] != '+' && s[0] != '-') || s[3] != ':' {
+		return time.Time{}, false, false
+	}
+	offsetHours, ok1 := parseTwoDigits(s, 1)
+	offsetMinutes, ok2 := parseTwoDigits(s, 4)
+	if !ok1 || !ok2 || offsetHours > 23 || offsetMinutes > 59 {
+		return time.Time{}, false, false
+	}
+	offset := (offsetHours*60 + offsetMinutes) * 60
+	if s[0] == '-' {
+		offset = -offset
+	}
+	t := time.Unix(unix-int64(offset), int64(nsec))
+	if loc == time.UTC {
+		if offset == 0 {
+			return t.UTC(), true, false
+		}
+	} else if inLoc := t.In(loc); zoneOffset(inLoc) == offset {
+		return inLoc, true, false
+	}
+	return t.In(time.FixedZone("", offset)), true, false
+}
+
+// parseDateOnly parses a date of time.DateOnly whose separators and digits were
+// already checked, the same way as time.ParseInLocation, or time.Parse when loc
+// is nil.
+func parseDateOnly(s string, loc *time.Location) (time.Time, bool) {
+	century, _ := parseTwoDigits(s, 0)
+	year, _ := parseTwoDigits(s, 2)
+	month, _ := parseTwoDigits(s, 5)
+	day, _ := parseTwoDigits(s, 8)
+	year += century * 100
+	if month < 1 || month > 12 || day < 1 || day > daysInMonth(month, year) {
+		return time.Time{}, false
+	}
+	if loc != nil && loc != time.UTC {
+		return time.Date(year, time.Month(month), day, 0, 0, 0, 0, loc), true
+	}
+	return time.Unix(epochDays(year, month, day)*24*60*60, 0).UTC(), true
+}
+
+// nanosecondScales scales fractional seconds of up to nine digits, indexed by
+// their number of digits, to nanoseconds.
+var nanosecondScales = [10]int{1e9, 1e8, 1e7, 1e6, 1e5, 1e4, 1e3, 1e2, 1e1, 1}
+
+func zoneOffset(t time.Time) int {
+	_, offset := t.Zone()
+	return offset
+}
+
+// epochDays returns the number of days since the Unix epoch of a date in the
+// proleptic Gregorian calendar, whose year must be after -10000.
+func epochDays(year, month, day int) int64 {
+	// Count the years from March so that leap days are at the end of each
+	// year, with eras of 400 years which all have the same number of days.
+	// The years are shifted by whole eras so that they're positive, which
+	// makes the divisions cheaper.
+	const shiftedEras = 25
+	y := uint64(year + shiftedEras*400)
+	marchMonth := month - 3
+	if marchMonth < 0 {
+		marchMonth += 12
+		y--
+	}
+	era := y / 400
+	yearOfEra := y - era*400
+	dayOfYear := uint64((153*marchMonth+2)/5 + day - 1)
+	dayOfEra := yearOfEra*365 + yearOfEra/4 - yearOfEra/100 + dayOfYear
+	return int64(era)*146097 + int64(dayOfEra) - 719468 - shiftedEras*146097
+}
+
+// parseTwoDigits parses the two digits of s at i, which must be in range.
+func parseTwoDigits(s string, i int) (int, bool) {
+	tens, units := s[i]-'0', s[i+1]-'0'
+	return int(tens)*10 + int(units), tens < 10 && units < 10
+}
+
+func parseDigits(s string) (int, bool) {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return 0, false
+		}
+		n = n*10 + int(s[i]-'0')
+	}
+	return n, true
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func daysInMonth(month, year int) int {
+	switch month {
+	case 2:
+		if year%4 == 0 && (year%100 != 0 || year%400 == 0) {
+			return 29
+		}
+		return 28
+	case 4, 6, 9, 11:
+		return 30
+	}
+	return 31
+}
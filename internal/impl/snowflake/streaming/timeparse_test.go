@@ -0,0 +1,220 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package streaming
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var parseRFC3339Inputs = []string{
+	"2024-01-02T03:04:05Z",
+	"2024-01-02T03:04:05.1Z",
+	"2024-01-02T03:04:05.123456789Z",
+	"2024-01-02T03:04:05.1234567891234Z",
+	"2024-01-02T03:04:05+01:00",
+	"2024-01-02T03:04:05.678-08:00",
+	"2024-07-02T03:04:05-07:00",
+	"2024-01-02T03:04:05+00:00",
+	"2024-01-02T03:04:05-00:00",
+	"2024-01-02T03:04:05+23:59",
+	"0000-01-01T00:00:00Z",
+	"9999-12-31T23:59:59.999999999Z",
+	"2024-02-29T00:00:00Z",
+	"2000-02-29T00:00:00",
+	"2024-01-02T03:04:05",
+	"2024-01-02T03:04:05.5",
+	"2024-01-02T03:04:05.123456789",
+	// Values which are rejected or handled by the slow path
+	"2023-02-29T00:00:00Z",
+	"1900-02-29T00:00:00",
+	"2024-13-02T03:04:05Z",
+	"2024-01-32T03:04:05Z",
+	"2024-01-02T24:04:05Z",
+	"2024-01-02T03:60:05Z",
+	"2024-01-02T03:04:60Z",
+	"2024-01-02T03:04:05+24:00",
+	"2024-01-02T03:04:05+01:60",
+	"2024-01-02T03:04:05+0100",
+	"2024-01-02T03:04:05,123Z",
+	"2024-01-02T03:04:05,123",
+	"2024-01-02T03:04:05.Z",
+	"2024-01-02T03:04:05.",
+	"2024-01-02t03:04:05Z",
+	"2024-01-02 03:04:05",
+	"2024-1-02T03:04:05Z",
+	"2024-01-02T3:04:05",
+	"2024-01-02T03:04:05Zjunk",
+	"2024-01-02T03:04:05 ",
+	"+024-01-02T03:04:05Z",
+	"2024-01-02",
+	"",
+}
+
+func TestParseRFC3339(t *testing.T) {
+	losAngeles, err := time.LoadLocation("America/Los_Angeles")
+	require.NoError(t, err)
+	for _, loc := range []*time.Location{time.UTC, losAngeles, time.FixedZone("", 60*60)} {
+		for _, input := range parseRFC3339Inputs {
+			for layout, withOffset := range map[string]bool{time.RFC3339Nano: true, timestampWithoutTZLayout: false} {
+				expected, err := time.ParseInLocation(layout, input, loc)
+				actual, ok, rejected := parseRFC3339(input, withOffset, loc)
+				if rejected {
+					require.Error(t, err, "%s %s", layout, input)
+				}
+				if !ok {
+					continue
+				}
+				require.NoError(t, err, "%s %s", layout, input)
+				require.Equal(t, expected, actual, "%s %s", layout, input)
+				require.Equal(t, expected.Location(), actual.Location(), "%s %s", layout, input)
+			}
+		}
+	}
+}
+
+func TestEpochDays(t *testing.T) {
+	for d := time.Date(-9999, 1, 1, 0, 0, 0, 0, time.UTC); d.Year() <= 10000; d = d.AddDate(0, 0, 17) {
+		require.Equal(t, d.Unix()/(24*60*60), epochDays(d.Year(), int(d.Month()), d.Day()), d.String())
+	}
+}
+
+func TestTimeLayoutParser(t *testing.T) {
+	losAngeles, err := time.LoadLocation("America/Los_Angeles")
+	require.NoError(t, err)
+	inputs := append([]string{
+		"2024-01-02", "2024-13-02", "02/01/2024", "02.01.2024", "Jan 2 03:04:05 2024", "24-01-02", "2024-002",
+		"2024-01-02 03:04", "2024-01-02  03:04", "2024-01-02T03:04:05-0700", "2024-01-02T03:04:05.123-07:00",
+		"20240102", "2024_01_02", "2024-01-02 3pm", "2024-02-29", "2023-02-29", "2024-04-31", "2024-00-10", "0000-01-01",
+	}, parseRFC3339Inputs...)
+	layouts := []string{
+		"2006-01-02", "2006-02-01", "02/01/2006", "02.01.2006", time.Stamp + " 2006", "06-01-02", "2006-002",
+		"2006-01-02 15:04", "2006-01-02T15:04:05-0700", "20060102", "2006_01_02", "2006-01-02 3pm",
+		time.RFC3339Nano, timestampWithoutTZLayout,
+	}
+	for _, loc := range []*time.Location{nil, time.UTC, losAngeles} {
+		p := newTimeLayoutParser(loc, layouts...)
+		for _, input := range inputs {
+			var expected time.Time
+			var err error
+			for _, layout := range layouts {
+				if loc == nil {
+					expected, err = time.Parse(layout, input)
+				} else {
+					expected, err = time.ParseInLocation(layout, input, loc)
+				}
+				if err == nil {
+					break
+				}
+			}
+			actual, ok := p.parse(input)
+			require.Equal(t, err == nil, ok, input)
+			require.Equal(t, expected, actual, input)
+		}
+	}
+}
+
+func TestTimeLayoutParserDeclaredOrder(t *testing.T) {
+	// Values which both layouts match are always parsed with the first one,
+	// even after a value which only the second one matches.
+	p := newTimeLayoutParser(time.UTC, "2006-01-02", "2006-02-01")
+	for _, test := range []struct {
+		input    string
+		expected time.Time
+	}{
+		{"2024-03-02", time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)},
+		{"2024-13-02", time.Date(2024, 2, 13, 0, 0, 0, 0, time.UTC)},
+		{"2024-03-02", time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)},
+	} {
+		actual, ok := p.parse(test.input)
+		require.True(t, ok, test.input)
+		require.Equal(t, test.expected, actual, test.input)
+	}
+}
+
+func TestTimeLayoutMayMatch(t *testing.T) {
+	for _, test := range []struct {
+		layout string
+		prefix string
+		length int
+	}{
+		{"2006-01-02", "\x00\x00\x00\x00-\x00\x00-\x00\x00", 10},
+		{"02/01/2006", "\x00\x00/\x00\x00/\x00\x00\x00\x00", 10},
+		{time.RFC3339Nano, "\x00\x00\x00\x00-\x00\x00-\x00\x00T", -1},
+		{"2006-01-02 15:04", "\x00\x00\x00\x00-\x00\x00-\x00\x00", -1},
+		{"2006-01-02T03:04:05", "\x00\x00\x00\x00-\x00\x00-\x00\x00T\x00\x00:\x00\x00:\x00\x00", -1},
+		{"20060102-0700", "\x00\x00\x00\x00\x00\x00\x00\x00", -1},
+		{"Jan 2006", "", -1},
+		{"06-01-02", "", -1},
+	} {
+		l := newTimeLayout(test.layout)
+		require.Equal(t, test.prefix, string(l.prefix), test.layout)
+		require.Equal(t, test.length, l.length, test.layout)
+	}
+}
+
+func TestTimeLayoutParserConcurrent(t *testing.T) {
+	p := newTimeLayoutParser(time.UTC, "2006-01-02", time.RFC3339Nano)
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			input, expected := "2024-01-02", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+			if i%2 == 0 {
+				input, expected = "2024-01-02T03:04:05Z", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+			}
+			for range 1000 {
+				actual, ok := p.parse(input)
+				if !ok || !actual.Equal(expected) {
+					t.Errorf("failed to parse %s: %v", input, actual)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkTimeLayoutParser(b *testing.B) {
+	for name, bench := range map[string]struct {
+		layouts []string
+		input   string
+	}{
+		"rfc3339":          {[]string{time.RFC3339Nano, timestampWithoutTZLayout}, "2024-01-02T03:04:05.123456+01:00"},
+		"rfc3339_no_tz":    {[]string{time.RFC3339Nano, timestampWithoutTZLayout}, "2024-01-02T03:04:05.123456"},
+		"date_formats":     {[]string{"2006-01-02", "02/01/2006", time.RFC3339Nano}, "2024-01-02T03:04:05Z"},
+		"date_first_match": {[]string{"2006-01-02", "02/01/2006", time.RFC3339Nano}, "2024-01-02"},
+	} {
+		b.Run(name+"/time.ParseInLocation", func(b *testing.B) {
+			b.ReportAllocs()
+			for range b.N {
+				for _, layout := range bench.layouts {
+					if _, err := time.ParseInLocation(layout, bench.input, time.UTC); err == nil {
+						break
+					}
+				}
+			}
+		})
+		b.Run(name+"/timeLayoutParser", func(b *testing.B) {
+			p := newTimeLayoutParser(time.UTC, bench.layouts...)
+			b.ReportAllocs()
+			for range b.N {
+				if _, ok := p.parse(bench.input); !ok {
+					b.Fatal("failed to parse")
+				}
+			}
+		})
+	}
+}
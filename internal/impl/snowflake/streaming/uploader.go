@@ -17,6 +17,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"path/filepath"
 	"strings"
@@ -24,13 +25,16 @@ import (
 	"time"
 
 	gcs "cloud.google.com/go/storage"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
 	"github.com/cenkalti/backoff/v4"
 	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
 	gcsopt "google.golang.org/api/option"
 
 	"github.com/redpanda-data/connect/v4/internal/asyncroutine"
@@ -97,13 +101,11 @@ func newUploader(fileLocationInfo fileLocationInfo) (uploader, error) {
 			pathPrefix: prefix,
 		}, err
 	case "AZURE":
-		sasToken := fileLocationInfo.Creds["AZURE_SAS_TOKEN"]
-		urlString := fmt.Sprintf("https://%s.%s/%s", fileLocationInfo.StorageAccount, fileLocationInfo.EndPoint, sasToken)
-		u, err := url.Parse(urlString)
+		u, err := azureServiceURL(fileLocationInfo)
 		if err != nil {
-			return nil, fmt.Errorf("invalid azure blob storage url: %w", err)
+			return nil, err
 		}
-		client, err := azblob.NewClientWithNoCredential(u.String(), nil)
+		client, err := azblob.NewClientWithNoCredential(u, nil)
 		if err != nil {
 			return nil, fmt.Errorf("unable to create azure blob storage client: %w", err)
 		}
@@ -120,6 +122,19 @@ func newUploader(fileLocationInfo fileLocationInfo) (uploader, error) {
 	return nil, fmt.Errorf("unsupported location type: %s", fileLocationInfo.LocationType)
 }
 
+// azureServiceURL returns the URL of the storage account of an Azure stage, which is authenticated with the SAS token
+// in its query.
+func azureServiceURL(fileLocationInfo fileLocationInfo) (string, error) {
+	// The SAS token is returned with or without the leading question mark depending on the deployment.
+	sasToken := strings.TrimPrefix(fileLocationInfo.Creds["AZURE_SAS_TOKEN"], "?")
+	urlString := fmt.Sprintf("https://%s.%s/?%s", fileLocationInfo.StorageAccount, fileLocationInfo.EndPoint, sasToken)
+	u, err := url.Parse(urlString)
+	if err != nil {
+		return "", fmt.Errorf("invalid azure blob storage url: %w", err)
+	}
+	return u.String(), nil
+}
+
 type azureUploader struct {
 	client                *azblob.Client
 	container, pathPrefix string
@@ -138,7 +153,7 @@ func (u *azureUploader) upload(ctx context.Context, path string, encrypted, md5H
 		return err
 	}
 	if !bytes.Equal(resp.ContentMD5, md5Hash) {
-		return fmt.Errorf("invalid md5 hash got: %s want: %s", hex.EncodeToString(resp.ContentMD5), md5Hash)
+		return fmt.Errorf("invalid md5 hash got: %s want: %s", hex.EncodeToString(resp.ContentMD5), hex.EncodeToString(md5Hash))
 	}
 	return nil
 }
@@ -187,6 +202,34 @@ func (u *gcsUploader) upload(ctx context.Context, path string, encrypted, md5Has
 	return ow.Close()
 }
 
+// isCredentialExpiredError returns true if an upload failed because the stage credentials were rejected, which happens
+// when they expire before they are refreshed.
+func isCredentialExpiredError(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "ExpiredToken", "ExpiredTokenException", "TokenRefreshRequired", "InvalidToken":
+			return true
+		}
+	}
+	isAuthStatus := func(code int) bool {
+		return code == http.StatusUnauthorized || code == http.StatusForbidden
+	}
+	var s3Err interface{ HTTPStatusCode() int }
+	if errors.As(err, &s3Err) && isAuthStatus(s3Err.HTTPStatusCode()) {
+		return true
+	}
+	var gcsErr *googleapi.Error
+	if errors.As(err, &gcsErr) && isAuthStatus(gcsErr.Code) {
+		return true
+	}
+	var azureErr *azcore.ResponseError
+	if errors.As(err, &azureErr) && isAuthStatus(azureErr.StatusCode) {
+		return true
+	}
+	return false
+}
+
 func splitBucketAndPath(stageLocation string) (string, string, error) {
 	bucketAndPath := strings.SplitN(stageLocation, "/", 2)
 	if len(bucketAndPath) != 2 {
@@ -211,11 +254,24 @@ type (
 		stateMu  sync.RWMutex
 		uploadMu sync.Mutex
 		periodic asyncroutine.Periodic
+		// Fetches the stage location with fresh credentials and creates an uploader for it.
+		fetch func(ctx context.Context) (uploader, error)
+		// The backoff between upload attempts.
+		backoff func() backoff.BackOff
 	}
 )
 
+const uploadMaxRetries = 3
+
 func newUploaderManager(client *SnowflakeRestClient, role string) *uploaderManager {
 	m := &uploaderManager{state: nil, client: client, role: role}
+	m.fetch = m.fetchUploader
+	m.backoff = func() backoff.BackOff {
+		b := backoff.NewExponentialBackOff()
+		b.InitialInterval = 500 * time.Millisecond
+		b.MaxInterval = 5 * time.Second
+		return backoff.WithMaxRetries(b, uploadMaxRetries)
+	}
 	// According to the Java SDK tokens are refreshed every hour on GCP
 	// and 2 hours on AWS. It seems in practice some customers only have
 	// tokens that live for 30 minutes, so we need to support ealier
@@ -249,20 +305,40 @@ func (m *uploaderManager) RefreshUploader(ctx context.Context) {
 	if r != nil && time.Now().Before(r.timestamp.Add(time.Minute)) {
 		return
 	}
-	u, err := backoff.RetryWithData(func() (uploader, error) {
-		resp, err := m.client.configureClient(ctx, clientConfigureRequest{Role: m.role})
-		if err == nil && resp.StatusCode != responseSuccess {
-			msg := "(no message)"
-			if resp.Message != "" {
-				msg = resp.Message
-			}
-			err = fmt.Errorf("unable to reconfigure client - status: %d, message: %s", resp.StatusCode, msg)
-		}
-		if err != nil {
-			return nil, err
+	m.refreshLocked(ctx, r)
+}
+
+// refreshStale refreshes the credentials unless they were already refreshed since stale was loaded, so that concurrent
+// uploads which fail because of the same expired credentials only refresh them once.
+func (m *uploaderManager) refreshStale(ctx context.Context, stale *uploaderLoadResult) {
+	m.uploadMu.Lock()
+	defer m.uploadMu.Unlock()
+	r := m.GetUploader()
+	if r != stale {
+		return
+	}
+	m.refreshLocked(ctx, r)
+}
+
+func (m *uploaderManager) fetchUploader(ctx context.Context) (uploader, error) {
+	resp, err := m.client.configureClient(ctx, clientConfigureRequest{Role: m.role})
+	if err == nil && resp.StatusCode != responseSuccess {
+		msg := "(no message)"
+		if resp.Message != "" {
+			msg = resp.Message
 		}
-		// TODO: Do the other checks here that the Java SDK does (deploymentID, etc)
-		return newUploader(resp.StageLocation)
+		err = fmt.Errorf("unable to reconfigure client - status: %d, message: %s", resp.StatusCode, msg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// TODO: Do the other checks here that the Java SDK does (deploymentID, etc)
+	return newUploader(resp.StageLocation)
+}
+
+func (m *uploaderManager) refreshLocked(ctx context.Context, r *uploaderLoadResult) {
+	u, err := backoff.RetryWithData(func() (uploader, error) {
+		return m.fetch(ctx)
 	}, backoff.WithMaxRetries(backoff.NewConstantBackOff(time.Second), 3))
 	if r != nil {
 		// Only log when this is running as a background task (so it's a refresh not initial setup).
@@ -277,6 +353,28 @@ func (m *uploaderManager) RefreshUploader(ctx context.Context) {
 	m.state = &uploaderLoadResult{uploader: u, timestamp: time.Now(), err: err}
 }
 
+// PutFile uploads a file to the stage, retrying failed uploads with a backoff. When an upload fails because the
+// credentials expired they are refreshed before the next attempt, which is necessary when they expire sooner than
+// they are periodically refreshed.
+func (m *uploaderManager) PutFile(ctx context.Context, path string, data, md5Hash []byte, metadata map[string]string) error {
+	return backoff.Retry(func() error {
+		ur := m.GetUploader()
+		if ur.err != nil {
+			m.refreshStale(ctx, ur)
+			return fmt.Errorf("failed to acquire stage uploader (last fetch time=%v): %w", ur.timestamp, ur.err)
+		}
+		err := ur.uploader.upload(ctx, path, data, md5Hash, metadata)
+		if err == nil {
+			return nil
+		}
+		if isCredentialExpiredError(err) {
+			m.client.logger.Debugf("snowflake storage credentials expired, refreshing: %v", err)
+			m.refreshStale(ctx, ur)
+		}
+		return fmt.Errorf("unable to upload to storage (last cred refresh time=%v): %w", ur.timestamp, err)
+	}, backoff.WithContext(m.backoff(), ctx))
+}
+
 func (m *uploaderManager) Stop() {
 	m.periodic.Stop()
 }
@@ -0,0 +1,253 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package streaming
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gcsopt "google.golang.org/api/option"
+)
+
+// fakeStage is an HTTP backend which stores the uploaded files or rejects them while its credentials are expired.
+type fakeStage struct {
+	mu      sync.Mutex
+	files   map[string][]byte
+	expired bool
+	// Writes the response for rejected uploads.
+	reject func(w http.ResponseWriter)
+}
+
+func (s *fakeStage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.expired {
+		s.reject(w)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if s.files == nil {
+		s.files = map[string][]byte{}
+	}
+	s.files[r.URL.Path] = body
+	sum := md5.Sum(body)
+	w.Header().Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	w.Header().Set("ETag", `"etag"`)
+	if strings.HasPrefix(r.URL.Path, "/upload/") {
+		// GCS multipart uploads respond with the object metadata.
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"bucket":"bucket","name":"prefix/file","md5Hash":%q}`, base64.StdEncoding.EncodeToString(sum[:]))
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// uploaded returns the file which was uploaded to a path ending with suffix. GCS multipart uploads store the whole
+// multipart body, so it's only checked to contain the data.
+func (s *fakeStage) uploaded(suffix string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for path, body := range s.files {
+		if strings.HasSuffix(path, suffix) || strings.HasPrefix(path, "/upload/") {
+			return body
+		}
+	}
+	return nil
+}
+
+func TestStageUploaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		reject func(w http.ResponseWriter)
+		create func(t *testing.T, endpoint string) uploader
+	}{
+		{
+			name: "S3",
+			reject: func(w http.ResponseWriter) {
+				w.Header().Set("Content-Type", "application/xml")
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>ExpiredToken</Code><Message>The provided token has expired.</Message></Error>`)
+			},
+			create: func(_ *testing.T, endpoint string) uploader {
+				return &s3Uploader{
+					client: s3.New(s3.Options{
+						Region:       "us-west-2",
+						BaseEndpoint: aws.String(endpoint),
+						UsePathStyle: true,
+						Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", "token"),
+					}),
+					bucket:     "bucket",
+					pathPrefix: "prefix",
+				}
+			},
+		},
+		{
+			name: "GCS",
+			reject: func(w http.ResponseWriter) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = io.WriteString(w, `{"error":{"code":401,"message":"Invalid Credentials"}}`)
+			},
+			create: func(t *testing.T, endpoint string) uploader {
+				client, err := gcs.NewClient(context.Background(), gcsopt.WithEndpoint(endpoint+"/storage/v1/"), gcsopt.WithoutAuthentication())
+				require.NoError(t, err)
+				return &gcsUploader{bucket: client.Bucket("bucket"), pathPrefix: "prefix"}
+			},
+		},
+		{
+			name: "AZURE",
+			reject: func(w http.ResponseWriter) {
+				w.Header().Set("x-ms-error-code", "AuthenticationFailed")
+				w.WriteHeader(http.StatusForbidden)
+			},
+			create: func(t *testing.T, endpoint string) uploader {
+				client, err := azblob.NewClientWithNoCredential(endpoint+"/?sig=token", &azblob.ClientOptions{
+					ClientOptions: azcore.ClientOptions{Retry: policy.RetryOptions{MaxRetries: -1}},
+				})
+				require.NoError(t, err)
+				return &azureUploader{client: client, container: "bucket", pathPrefix: "prefix"}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stage := &fakeStage{reject: test.reject}
+			srv := httptest.NewServer(stage)
+			t.Cleanup(srv.Close)
+
+			u := test.create(t, srv.URL)
+			data := []byte("encrypted parquet file")
+			sum := md5.Sum(data)
+
+			require.NoError(t, u.upload(context.Background(), "file", data, sum[:], map[string]string{"ingestclientname": "test"}))
+			assert.Contains(t, string(stage.uploaded("/prefix/file")), string(data))
+
+			stage.mu.Lock()
+			stage.expired = true
+			stage.mu.Unlock()
+
+			err := u.upload(context.Background(), "file", data, sum[:], nil)
+			require.Error(t, err)
+			assert.True(t, isCredentialExpiredError(err), "error should indicate expired credentials: %v", err)
+		})
+	}
+}
+
+func TestAzureServiceURL(t *testing.T) {
+	for _, token := range []string{"sv=2020&sig=abc", "?sv=2020&sig=abc"} {
+		u, err := azureServiceURL(fileLocationInfo{
+			StorageAccount: "account",
+			EndPoint:       "blob.core.windows.net",
+			Creds:          map[string]string{"AZURE_SAS_TOKEN": token},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "https://account.blob.core.windows.net/?sv=2020&sig=abc", u)
+	}
+}
+
+func TestIsCredentialExpiredError(t *testing.T) {
+	assert.False(t, isCredentialExpiredError(errors.New("connection reset")))
+	assert.True(t, isCredentialExpiredError(fmt.Errorf("wrapped: %w", &azcore.ResponseError{StatusCode: http.StatusForbidden})))
+	assert.False(t, isCredentialExpiredError(&azcore.ResponseError{StatusCode: http.StatusInternalServerError}))
+}
+
+// fakeUploader fails uploads with expired credentials until its generation is refreshed.
+type fakeUploader struct {
+	generation int64
+	current    *atomic.Int64
+	uploads    *atomic.Int64
+	err        error
+}
+
+func (u *fakeUploader) upload(context.Context, string, []byte, []byte, map[string]string) error {
+	u.uploads.Add(1)
+	if u.err != nil {
+		return u.err
+	}
+	if u.generation < u.current.Load() {
+		return &azcore.ResponseError{StatusCode: http.StatusForbidden, ErrorCode: "AuthenticationFailed"}
+	}
+	return nil
+}
+
+func newTestUploaderManager(fetch func(ctx context.Context) (uploader, error)) *uploaderManager {
+	return &uploaderManager{
+		client: &SnowflakeRestClient{logger: service.MockResources().Logger()},
+		fetch:  fetch,
+		backoff: func() backoff.BackOff {
+			return backoff.WithMaxRetries(&backoff.ZeroBackOff{}, uploadMaxRetries)
+		},
+	}
+}
+
+func TestUploaderManagerPutFileRefreshesExpiredCredentials(t *testing.T) {
+	var current, uploads, fetches atomic.Int64
+	m := newTestUploaderManager(func(context.Context) (uploader, error) {
+		return &fakeUploader{generation: fetches.Add(1), current: &current, uploads: &uploads}, nil
+	})
+	current.Store(1)
+	m.RefreshUploader(context.Background())
+	require.Equal(t, int64(1), fetches.Load())
+
+	// The credentials expire, all concurrent uploads fail once and only one of them refreshes the credentials.
+	current.Store(2)
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, m.PutFile(context.Background(), "file", nil, nil, nil))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(2), fetches.Load())
+}
+
+func TestUploaderManagerPutFileRetries(t *testing.T) {
+	var current, uploads, fetches atomic.Int64
+	m := newTestUploaderManager(func(context.Context) (uploader, error) {
+		fetches.Add(1)
+		return &fakeUploader{current: &current, uploads: &uploads, err: errors.New("connection reset")}, nil
+	})
+	m.RefreshUploader(context.Background())
+
+	err := m.PutFile(context.Background(), "file", nil, nil, nil)
+	require.ErrorContains(t, err, "connection reset")
+	assert.Equal(t, int64(uploadMaxRetries+1), uploads.Load())
+	// Errors which don't indicate expired credentials don't refresh them.
+	assert.Equal(t, int64(1), fetches.Load())
+}
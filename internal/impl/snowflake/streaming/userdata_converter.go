@@ -11,9 +11,13 @@
 package streaming
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"slices"
+	"strings"
 	"time"
 	"unicode/utf8"
 	"unsafe"
@@ -41,6 +45,10 @@ type typedBuffer interface {
 	// the data that will be written - this buffer will not modify
 	// the size of the data.
 	Prepare(matrix []parquet.Value, columnIndex, rowWidth int)
+	// Reset releases the matrix and keeps the memory of the buffer for
+	// writing the next one, the values written so far must no longer be
+	// referenced.
+	Reset()
 }
 
 type typedBufferImpl struct {
@@ -78,13 +86,17 @@ func (b *typedBufferImpl) WriteBytes(v []byte) {
 	b.WriteValue(parquet.ByteArrayValue(v).Level(0, 1, b.columnIndex))
 }
 func (b *typedBufferImpl) Prepare(matrix []parquet.Value, columnIndex, rowWidth int) {
-	b.currentRow = 0
+	b.Reset()
 	b.matrix = matrix
 	b.columnIndex = columnIndex
 	b.rowWidth = rowWidth
-	if b.scratch != nil {
-		b.scratch = b.scratch[:0]
-	}
+}
+func (b *typedBufferImpl) Reset() {
+	b.matrix = nil
+	b.currentRow = 0
+	b.columnIndex = 0
+	b.rowWidth = 0
+	b.scratch = b.scratch[:0]
 }
 
 var defaultTypedBufferFactory = typedBufferFactory(func() typedBuffer { return &typedBufferImpl{} })
@@ -128,7 +140,7 @@ func (c boolConverter) ValidateAndConvert(stats *statsBuffer, val any, buf typed
 		buf.WriteNull()
 		return nil
 	}
-	v, err := bloblang.ValueAsBool(val)
+	v, err := valueAsBool(val)
 	if err != nil {
 		return err
 	}
@@ -141,6 +153,66 @@ func (c boolConverter) ValidateAndConvert(stats *statsBuffer, val any, buf typed
 	return nil
 }
 
+// The strings which Snowflake's TO_BOOLEAN accepts, compared case-insensitively.
+var (
+	boolTrueStrings  = []string{"true", "t", "yes", "y", "on", "1"}
+	boolFalseStrings = []string{"false", "f", "no", "n", "off", "0"}
+)
+
+// valueAsBool converts val using the same rules as Snowflake's TO_BOOLEAN,
+// where numbers other than zero are true.
+func valueAsBool(val any) (bool, error) {
+	switch t := val.(type) {
+	case bool:
+		return t, nil
+	case string:
+		return stringAsBool(t)
+	case []byte:
+		return stringAsBool(string(t))
+	case json.Number:
+		f, err := t.Float64()
+		if err != nil {
+			return false, fmt.Errorf("invalid number %q for BOOLEAN column: %w", t.String(), err)
+		}
+		return f != 0, nil
+	case float32:
+		return floatAsBool(float64(t))
+	case float64:
+		return floatAsBool(t)
+	default:
+		// Integers are handled by bloblang, which also provides a good error
+		// message for other types.
+		return bloblang.ValueAsBool(val)
+	}
+}
+
+func stringAsBool(s string) (bool, error) {
+	s = strings.TrimSpace(s)
+	for _, t := range boolTrueStrings {
+		if strings.EqualFold(s, t) {
+			return true, nil
+		}
+	}
+	for _, f := range boolFalseStrings {
+		if strings.EqualFold(s, f) {
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf(
+		"invalid BOOLEAN value %q, expected a number or one of %s for true or %s for false (case-insensitive)",
+		s,
+		strings.Join(boolTrueStrings, ", "),
+		strings.Join(boolFalseStrings, ", "),
+	)
+}
+
+func floatAsBool(f float64) (bool, error) {
+	if math.IsNaN(f) {
+		return false, errors.New("NaN is not a valid BOOLEAN value")
+	}
+	return f != 0, nil
+}
+
 type numberConverter struct {
 	nullable  bool
 	scale     int32
@@ -197,6 +269,12 @@ func (c numberConverter) ValidateAndConvert(stats *statsBuffer, val any, buf typ
 		v, err = int128.FromString(t, c.precision, c.scale)
 	case json.Number:
 		v, err = int128.FromString(t.String(), c.precision, c.scale)
+	case []byte:
+		v, err = int128.FromStringBytes(t, c.precision, c.scale)
+	case bool, time.Time:
+		// These are commonly mapped into NUMBER columns by mistake, and the error from bloblang doesn't explain how to
+		// fix it.
+		return fmt.Errorf("cannot convert value of type %T to NUMBER, use ::int or map via bloblang to convert it to a number first", val)
 	default:
 		// fallback to the good error message that bloblang provides
 		var i int64
@@ -333,12 +411,146 @@ func (c jsonObjectConverter) ValidateAndConvert(stats *statsBuffer, val any, buf
 	return c.jsonConverter.ValidateAndConvert(stats, val, buf)
 }
 
+// geoConverter converts values of GEOGRAPHY and GEOMETRY columns, which are
+// either GeoJSON objects or strings of GeoJSON or WKT. Strings are passed
+// through as is once validated, while objects are serialized as JSON. The
+// geometry of a GeoJSON Feature is written in place of the Feature.
+type geoConverter struct {
+	nullable  bool
+	maxLength int
+}
+
+func (c geoConverter) ValidateAndConvert(stats *statsBuffer, val any, buf typedBuffer) error {
+	var v []byte
+	var err error
+	switch t := val.(type) {
+	case nil:
+	case map[string]any:
+		var geometry map[string]any
+		if geometry, err = geoJSONGeometry(t); err == nil && geometry != nil {
+			v = gabs.Wrap(geometry).Bytes()
+		}
+	case string:
+		v, err = geoStringValue([]byte(t))
+	case []byte:
+		v, err = geoStringValue(t)
+	default:
+		return fmt.Errorf("expected a GeoJSON object or a GeoJSON or WKT string, got %T", val)
+	}
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		if !c.nullable {
+			return errNullValue
+		}
+		stats.nullCount++
+		buf.WriteNull()
+		return nil
+	}
+	if len(v) > c.maxLength {
+		return fmt.Errorf("value too long, length: %d, max: %d", len(v), c.maxLength)
+	}
+	stats.UpdateBytesStats(v)
+	buf.WriteBytes(v)
+	return nil
+}
+
+// geoStringValue validates a string which is either GeoJSON, when it's a JSON
+// object, or WKT otherwise, and returns the value to write, which is nil for a
+// GeoJSON Feature without a geometry.
+func geoStringValue(s []byte) ([]byte, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(s), []byte("{")) {
+		return s, validateWKT(string(s))
+	}
+	var obj map[string]any
+	if err := json.Unmarshal(s, &obj); err != nil {
+		return nil, fmt.Errorf("invalid GeoJSON: %w", err)
+	}
+	geometry, err := geoJSONGeometry(obj)
+	if err != nil || geometry == nil {
+		return nil, err
+	}
+	if obj["type"] != "Feature" {
+		return s, nil
+	}
+	return json.Marshal(geometry)
+}
+
+// timestampWithoutTZLayout is RFC 3339 without the mandatory offset.
+const timestampWithoutTZLayout = "2006-01-02T15:04:05.999999999"
+
+// maxTimestampTZOffset is the largest timezone offset in seconds which is
+// accepted for TIMESTAMP_TZ columns.
+const maxTimestampTZOffset = 14 * 60 * 60
+
+// The range of years which Snowflake supports for timestamps.
+var (
+	minSnowflakeTimestamp = time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC)
+	maxSnowflakeTimestamp = time.Date(9999, 12, 31, 23, 59, 59, 999999999, time.UTC)
+)
+
 type timestampConverter struct {
 	nullable         bool
 	scale, precision int32
 	includeTZ        bool
 	trimTZ           bool
 	defaultTZ        *time.Location
+	// Replace timestamps outside of the supported range with the closest
+	// boundary instead of rejecting them
+	clamp bool
+	// The inclusive range of timestamps which can be stored in the column
+	minTime, maxTime time.Time
+	// Strings with an explicit offset keep it, the default timezone only
+	// applies to strings without any zone information.
+	parser *timeLayoutParser
+}
+
+func newTimestampConverter(nullable bool, scale, precision int32, includeTZ, trimTZ, clamp bool, defaultTZ *time.Location) timestampConverter {
+	c := timestampConverter{
+		nullable:  nullable,
+		scale:     scale,
+		precision: precision,
+		includeTZ: includeTZ,
+		trimTZ:    trimTZ,
+		defaultTZ: defaultTZ,
+		clamp:     clamp,
+		parser:    newTimeLayoutParser(defaultTZ, time.RFC3339Nano, timestampWithoutTZLayout),
+	}
+	c.minTime, c.maxTime = timestampRange(scale, precision, includeTZ)
+	return c
+}
+
+// timestampRange returns the inclusive range of timestamps which can be stored
+// in a column with the given scale and precision. It's limited by the years
+// which Snowflake supports as well as by the number of digits of the scaled
+// epoch, which for TIMESTAMP_TZ columns also includes the timezone offset in
+// its low 14 bits.
+func timestampRange(scale, precision int32, includeTZ bool) (minTime, maxTime time.Time) {
+	unit := time.Duration(pow10TableInt64[9-scale])
+	minTime, maxTime = minSnowflakeTimestamp, maxSnowflakeTimestamp.Truncate(unit)
+	maxScaled := int128.MaxInt128
+	if p, ok := int128.Pow10(precision); ok {
+		maxScaled = int128.Sub(p, int128.FromInt64(1))
+	}
+	if includeTZ {
+		const tzMask = (1 << 14) - 1
+		maxScaled = int128.Div(int128.Sub(maxScaled, int128.FromInt64(tzMask)), int128.FromInt64(tzMask+1))
+	}
+	maxScaled = int128.Max(maxScaled, int128.FromInt64(0))
+	scaleFactor := int128.Pow10Table[scale]
+	seconds := int128.Div(maxScaled, scaleFactor)
+	if int128.Greater(seconds, int128.FromInt64(maxTime.Unix())) {
+		return minTime, maxTime
+	}
+	nanos := int128.Sub(maxScaled, int128.Mul(seconds, scaleFactor)).ToInt64() * int64(unit)
+	if bound := time.Unix(seconds.ToInt64(), nanos).UTC(); bound.Before(maxTime) {
+		maxTime = bound
+	}
+	if bound := time.Unix(-seconds.ToInt64(), -nanos).UTC(); bound.After(minTime) {
+		minTime = bound
+	}
+	return minTime, maxTime
 }
 
 func (c timestampConverter) ValidateAndConvert(stats *statsBuffer, val any, buf typedBuffer) error {
@@ -354,6 +566,10 @@ func (c timestampConverter) ValidateAndConvert(stats *statsBuffer, val any, buf
 	var t time.Time
 	var err error
 	switch v := val.(type) {
+	case time.Time:
+		// Timestamps keep their own location, which is what's encoded for
+		// TIMESTAMP_TZ columns.
+		t = v
 	case []byte:
 		s = string(v)
 	case string:
@@ -365,31 +581,42 @@ func (c timestampConverter) ValidateAndConvert(stats *statsBuffer, val any, buf
 		}
 	}
 	if s != "" {
-		location := c.defaultTZ
-		t, err = time.ParseInLocation(time.RFC3339Nano, s, location)
-		if err != nil {
+		var ok bool
+		if t, ok = c.parser.parse(s); !ok {
 			return &InvalidTimestampFormatError{"timestamp", s}
 		}
 	}
 	if c.trimTZ {
 		t = t.UTC()
 	}
-	y := t.Year()
-	if y < 1 || y > 9999 {
-		return fmt.Errorf(
-			"timestamp out of representable inclusive range of years between 1 and 9999: %d",
-			y,
-		)
+	if c.includeTZ {
+		if _, offset := t.Zone(); offset%60 != 0 || offset < -maxTimestampTZOffset || offset > maxTimestampTZOffset {
+			return fmt.Errorf(
+				"timezone offset of timestamp %s is not supported: offsets must be whole minutes between -14:00 and +14:00",
+				t.Format(time.RFC3339Nano),
+			)
+		}
 	}
-	v := snowflakeTimestampInt(t, c.scale, c.includeTZ)
-	if !v.FitsInPrecision(c.precision) {
-		return fmt.Errorf(
-			"unable to fit timestamp (%s -> %s) within required precision: %v",
-			t.Format(time.RFC3339Nano),
-			v.String(),
-			c.precision,
-		)
+	// The scaled epoch truncates the timestamp to the scale of the column.
+	if truncated := t.Truncate(time.Duration(pow10TableInt64[9-c.scale])); truncated.Before(c.minTime) || truncated.After(c.maxTime) {
+		if !c.clamp {
+			return fmt.Errorf(
+				"timestamp %s is outside of the range between %s and %s which is supported by columns with scale %d and precision %d",
+				t.Format(time.RFC3339Nano),
+				c.minTime.Format(time.RFC3339Nano),
+				c.maxTime.Format(time.RFC3339Nano),
+				c.scale,
+				c.precision,
+			)
+		}
+		if truncated.Before(c.minTime) {
+			t = c.minTime.In(t.Location())
+		} else {
+			t = c.maxTime.In(t.Location())
+		}
+		stats.clampedValues++
 	}
+	v := snowflakeTimestampInt(t, c.scale, c.includeTZ)
 	stats.UpdateIntStats(v)
 	buf.WriteInt128(v)
 	return nil
@@ -398,6 +625,15 @@ func (c timestampConverter) ValidateAndConvert(stats *statsBuffer, val any, buf
 type timeConverter struct {
 	nullable bool
 	scale    int32
+	parser   *timeLayoutParser
+}
+
+func newTimeConverter(nullable bool, scale int32) timeConverter {
+	return timeConverter{
+		nullable: nullable,
+		scale:    scale,
+		parser:   newTimeLayoutParser(nil, time.RFC3339Nano),
+	}
 }
 
 func (c timeConverter) ValidateAndConvert(stats *statsBuffer, val any, buf typedBuffer) error {
@@ -409,12 +645,20 @@ func (c timeConverter) ValidateAndConvert(stats *statsBuffer, val any, buf typed
 		buf.WriteNull()
 		return nil
 	}
-	t, err := bloblang.ValueAsTimestamp(val)
-	if err != nil {
-		if s, ok := val.(string); ok {
-			return &InvalidTimestampFormatError{"time", s}
+	var t time.Time
+	switch v := val.(type) {
+	case time.Time:
+		t = v
+	case string:
+		var ok bool
+		if t, ok = c.parser.parse(v); !ok {
+			return &InvalidTimestampFormatError{"time", v}
+		}
+	default:
+		var err error
+		if t, err = bloblang.ValueAsTimestamp(val); err != nil {
+			return err
 		}
-		return err
 	}
 	t = t.In(time.UTC)
 	// 24 hours in nanoseconds fits within uint64, so we can't overflow
@@ -428,8 +672,32 @@ func (c timeConverter) ValidateAndConvert(stats *statsBuffer, val any, buf typed
 	return nil
 }
 
+// DateIntegerUnit specifies how integer values are interpreted when converting them into DATE columns.
+type DateIntegerUnit int
+
+const (
+	// DateIntegerUnitEpochSeconds interprets integers as seconds since the Unix epoch
+	DateIntegerUnitEpochSeconds DateIntegerUnit = iota
+	// DateIntegerUnitEpochDays interprets integers as days since the Unix epoch
+	DateIntegerUnitEpochDays
+	// DateIntegerUnitYYYYMMDD interprets integers as dates in the form YYYYMMDD, i.e. 20200721
+	DateIntegerUnitYYYYMMDD
+)
+
 type dateConverter struct {
 	nullable bool
+	// parser tries the configured Go time layouts for string values before
+	// falling back to the default timestamp parsing.
+	parser      *timeLayoutParser
+	integerUnit DateIntegerUnit
+}
+
+func newDateConverter(nullable bool, formats []string, integerUnit DateIntegerUnit) dateConverter {
+	return dateConverter{
+		nullable:    nullable,
+		parser:      newTimeLayoutParser(nil, append(slices.Clip(formats), time.RFC3339Nano)...),
+		integerUnit: integerUnit,
+	}
 }
 
 func (c dateConverter) ValidateAndConvert(stats *statsBuffer, val any, buf typedBuffer) error {
@@ -441,11 +709,8 @@ func (c dateConverter) ValidateAndConvert(stats *statsBuffer, val any, buf typed
 		buf.WriteNull()
 		return nil
 	}
-	t, err := bloblang.ValueAsTimestamp(val)
+	t, err := c.toTime(val)
 	if err != nil {
-		if s, ok := val.(string); ok {
-			return &InvalidTimestampFormatError{"date", s}
-		}
 		return err
 	}
 	t = t.UTC()
@@ -457,3 +722,43 @@ func (c dateConverter) ValidateAndConvert(stats *statsBuffer, val any, buf typed
 	buf.WriteInt128(v)
 	return nil
 }
+
+func (c dateConverter) toTime(val any) (time.Time, error) {
+	switch v := val.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		if t, ok := c.parser.parse(v); ok {
+			return t, nil
+		}
+		return time.Time{}, &InvalidTimestampFormatError{"date", v}
+	case []byte:
+		// Bytes are parsed the same way as strings below
+	default:
+		if c.integerUnit != DateIntegerUnitEpochSeconds {
+			return c.integerToTime(val)
+		}
+	}
+	return bloblang.ValueAsTimestamp(val)
+}
+
+func (c dateConverter) integerToTime(val any) (time.Time, error) {
+	i, err := bloblang.ValueAsInt64(val)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if c.integerUnit == DateIntegerUnitEpochDays {
+		// Guard against overflows when converting into seconds, the year is validated afterwards.
+		const maxDays = 10_000 * 366
+		if i < -maxDays || i > maxDays {
+			return time.Time{}, fmt.Errorf("DATE columns out of range, days since epoch: %d", i)
+		}
+		return time.Unix(i*24*60*60, 0), nil
+	}
+	year, month, day := i/10_000, (i/100)%100, i%100
+	t := time.Date(int(year), time.Month(month), int(day), 0, 0, 0, 0, time.UTC)
+	if year < 1 || t.Year() != int(year) || t.Month() != time.Month(month) || t.Day() != int(day) {
+		return time.Time{}, fmt.Errorf("invalid YYYYMMDD date: %d", i)
+	}
+	return t, nil
+}
@@ -12,6 +12,10 @@ package streaming
 
 import (
 	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -23,12 +27,13 @@ import (
 )
 
 type validateTestCase struct {
-	name      string
-	input     any
-	output    any
-	err       bool
-	scale     int32
-	precision int32
+	name        string
+	input       any
+	output      any
+	err         bool
+	errContains string
+	scale       int32
+	precision   int32
 }
 
 func TestTimeConverter(t *testing.T) {
@@ -103,10 +108,10 @@ func TestTimeConverter(t *testing.T) {
 			output: nil,
 		},
 	}
-	for _, tc := range tests {
+	for _, tc := range withTimeInputs(tests) {
 		tc := tc
 		t.Run("", func(t *testing.T) {
-			c := &timeConverter{nullable: true, scale: tc.scale}
+			c := newTimeConverter(true, tc.scale)
 			runTestcase(t, c, tc)
 		})
 	}
@@ -178,6 +183,13 @@ func TestNumberConverter(t *testing.T) {
 			scale:     10,
 			precision: 19,
 		},
+		{
+			name:      "Number(19, 4) Bytes",
+			input:     []byte("123.4321"),
+			output:    1234321,
+			scale:     4,
+			precision: 19,
+		},
 		{
 			name:      "Number(26, 4)",
 			input:     123456789987654321,
@@ -192,6 +204,111 @@ func TestNumberConverter(t *testing.T) {
 			scale:     4,
 			precision: 19,
 		},
+		{
+			name:      "Number(38, 0) uint64 above MaxInt64",
+			input:     uint64(math.MaxUint64),
+			output:    int128.FromUint64(math.MaxUint64),
+			precision: 38,
+		},
+		{
+			name:      "Number(18, 0) uint64 above MaxInt64 Error",
+			input:     uint64(math.MaxInt64) + 1,
+			err:       true,
+			precision: 18,
+		},
+		{
+			name:      "Number(38, 2) uint64 above MaxInt64",
+			input:     uint64(math.MaxInt64) + 1,
+			output:    int128.MustParse("922337203685477580800"),
+			scale:     2,
+			precision: 38,
+		},
+		{
+			name:        "Number(38, 0) bool Error",
+			input:       true,
+			err:         true,
+			errContains: "cannot convert value of type bool to NUMBER, use ::int or map via bloblang",
+			precision:   38,
+		},
+		{
+			name:        "Number(38, 0) time Error",
+			input:       time.Unix(1, 0),
+			err:         true,
+			errContains: "cannot convert value of type time.Time to NUMBER, use ::int or map via bloblang",
+			precision:   38,
+		},
+	}
+	for _, input := range []any{
+		int(-42), int8(-42), int16(-42), int32(-42), int64(-42),
+		uint(42), uint8(42), uint16(42), uint32(42), uint64(42),
+	} {
+		output := 42
+		if reflect.ValueOf(input).CanInt() {
+			output = -42
+		}
+		tests = append(tests, validateTestCase{
+			name:      fmt.Sprintf("Number(4, 1) %T", input),
+			input:     input,
+			output:    output * 10,
+			scale:     1,
+			precision: 4,
+		})
+	}
+	// Decimal literals in any notation are normalized into the scale of the column, rounding the digits beyond it half
+	// away from zero.
+	for _, lit := range []struct {
+		s           string
+		precision   int32
+		scale       int32
+		output      int
+		errContains string
+	}{
+		{s: "1e3", precision: 38, output: 1000},
+		{s: "1E3", precision: 4, output: 1000},
+		{s: "1e3", precision: 10, scale: 2, output: 100000},
+		{s: "1e3", precision: 3, errContains: "requires precision 4 (4 integer and 0 fractional digits) but the type is NUMBER(3,0)"},
+		{s: "1e3", precision: 38, scale: 37, errContains: "requires precision 41 (4 integer and 37 fractional digits) but the type is NUMBER(38,37)"},
+		{s: "1e+3", precision: 6, scale: 2, output: 100000},
+		{s: "1.2300e2", precision: 38, output: 123},
+		{s: "1.2300e2", precision: 5, scale: 2, output: 12300},
+		{s: "1.2300e2", precision: 4, scale: 2, errContains: "requires precision 5 (3 integer and 2 fractional digits)"},
+		{s: "+1.23E+2", precision: 10, scale: 4, output: 1230000},
+		{s: "12.5e-3", precision: 10, scale: 5, output: 1250},
+		{s: "1e-2", precision: 38, output: 0},
+		{s: "1e-2", precision: 3, scale: 2, output: 1},
+		{s: "1.5e-1", precision: 2, scale: 1, output: 2},
+		{s: "-1.5E-1", precision: 2, scale: 1, output: -2},
+		{s: "0.000e5", precision: 1, output: 0},
+		{s: "45.000", precision: 2, output: 45},
+		{s: "45.000", precision: 10, scale: 3, output: 45000},
+		{s: "45.000", precision: 38, scale: 10, output: 450000000000},
+		{s: "45.000", precision: 38, scale: 37, errContains: "requires precision 39 (2 integer and 37 fractional digits)"},
+		{s: "+5", precision: 1, output: 5},
+		{s: "+5", precision: 10, scale: 2, output: 500},
+		{s: ".5", precision: 1, scale: 1, output: 5},
+		{s: ".5", precision: 10, scale: 2, output: 50},
+		{s: ".5", precision: 1, output: 1},
+		{s: "-.5", precision: 1, scale: 1, output: -5},
+		{s: "-.5", precision: 1, output: -1},
+		{s: "-.45", precision: 2, scale: 1, output: -5},
+		{s: "-0.0", precision: 1, output: 0},
+		{s: "9.99", precision: 2, scale: 1, errContains: "requires precision 3 (2 integer and 1 fractional digits)"},
+		{s: "1e-38", precision: 38, scale: 37, output: 0},
+		{s: ".", precision: 38, errContains: "number has no digits"},
+		{s: "1e", precision: 38, errContains: "invalid exponent"},
+		{s: "1e3.5", precision: 38, errContains: "invalid exponent"},
+	} {
+		for _, input := range []any{json.Number(lit.s), lit.s} {
+			tests = append(tests, validateTestCase{
+				name:        fmt.Sprintf("Number(%d, %d) %T %s", lit.precision, lit.scale, input, lit.s),
+				input:       input,
+				output:      lit.output,
+				err:         lit.errContains != "",
+				errContains: lit.errContains,
+				scale:       lit.scale,
+				precision:   lit.precision,
+			})
+		}
 	}
 	for _, tc := range tests {
 		tc := tc
@@ -244,10 +361,180 @@ func TestBoolConverter(t *testing.T) {
 			input:  "false",
 			output: false,
 		},
+		{
+			input:  "true",
+			output: true,
+		},
+		{
+			input:  "TRUE",
+			output: true,
+		},
+		{
+			input:  "True",
+			output: true,
+		},
+		{
+			input:  "t",
+			output: true,
+		},
+		{
+			input:  "T",
+			output: true,
+		},
+		{
+			input:  "yes",
+			output: true,
+		},
+		{
+			input:  "YES",
+			output: true,
+		},
+		{
+			input:  "y",
+			output: true,
+		},
+		{
+			input:  "on",
+			output: true,
+		},
+		{
+			input:  "On",
+			output: true,
+		},
+		{
+			input:  "1",
+			output: true,
+		},
+		{
+			input:  "FALSE",
+			output: false,
+		},
+		{
+			input:  "f",
+			output: false,
+		},
+		{
+			input:  "F",
+			output: false,
+		},
+		{
+			input:  "no",
+			output: false,
+		},
+		{
+			input:  "No",
+			output: false,
+		},
+		{
+			input:  "n",
+			output: false,
+		},
+		{
+			input:  "off",
+			output: false,
+		},
+		{
+			input:  "OFF",
+			output: false,
+		},
+		{
+			input:  "0",
+			output: false,
+		},
+		{
+			name:   "leading and trailing whitespace",
+			input:  "  yes \t",
+			output: true,
+		},
+		{
+			name:   "whitespace around false",
+			input:  "\nOff ",
+			output: false,
+		},
+		{
+			input:  []byte("Y"),
+			output: true,
+		},
+		{
+			input:  0,
+			output: false,
+		},
+		{
+			input:  1,
+			output: true,
+		},
+		{
+			input:  int64(-7),
+			output: true,
+		},
+		{
+			input:  uint8(0),
+			output: false,
+		},
+		{
+			input:  0.0,
+			output: false,
+		},
+		{
+			input:  0.5,
+			output: true,
+		},
+		{
+			input:  float32(-1.5),
+			output: true,
+		},
+		{
+			input:  json.Number("1"),
+			output: true,
+		},
+		{
+			input:  json.Number("0"),
+			output: false,
+		},
+		{
+			input:  json.Number("0.0"),
+			output: false,
+		},
+		{
+			input:  json.Number("-2.5e3"),
+			output: true,
+		},
+		{
+			input:       math.NaN(),
+			err:         true,
+			errContains: "NaN",
+		},
+		{
+			input:       float32(math.NaN()),
+			err:         true,
+			errContains: "NaN",
+		},
+		{
+			input:       "maybe",
+			err:         true,
+			errContains: "expected a number or one of true, t, yes, y, on, 1 for true or false, f, no, n, off, 0 for false",
+		},
+		{
+			input:       "2",
+			err:         true,
+			errContains: `invalid BOOLEAN value "2"`,
+		},
+		{
+			input: "",
+			err:   true,
+		},
+		{
+			input: json.Number("abc"),
+			err:   true,
+		},
+		{
+			input: []any{true},
+			err:   true,
+		},
 	}
 	for _, tc := range tests {
 		tc := tc
-		t.Run("", func(t *testing.T) {
+		t.Run(tc.name, func(t *testing.T) {
 			c := &boolConverter{nullable: true}
 			runTestcase(t, c, tc)
 		})
@@ -298,6 +585,167 @@ func TestStringConverter(t *testing.T) {
 	}
 }
 
+func TestGeoConverter(t *testing.T) {
+	tests := []validateTestCase{
+		{
+			name: "GeoJSON Point object",
+			input: map[string]any{
+				"type":        "Point",
+				"coordinates": []any{-122.35, 37.55},
+			},
+			output: []byte(`{"coordinates":[-122.35,37.55],"type":"Point"}`),
+		},
+		{
+			name:   "GeoJSON Polygon string",
+			input:  `{"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 0]]]}`,
+			output: []byte(`{"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 0]]]}`),
+		},
+		{
+			name:   "GeoJSON GeometryCollection",
+			input:  `{"type":"GeometryCollection","geometries":[{"type":"Point","coordinates":[1,2,3]},{"type":"MultiPoint","coordinates":[]}]}`,
+			output: []byte(`{"type":"GeometryCollection","geometries":[{"type":"Point","coordinates":[1,2,3]},{"type":"MultiPoint","coordinates":[]}]}`),
+		},
+		{
+			name: "GeoJSON Feature object",
+			input: map[string]any{
+				"type":       "Feature",
+				"geometry":   map[string]any{"type": "Point", "coordinates": []any{1.0, 2.0}},
+				"properties": map[string]any{"name": "foo"},
+			},
+			output: []byte(`{"coordinates":[1,2],"type":"Point"}`),
+		},
+		{
+			name:   "GeoJSON Feature string",
+			input:  `{"type":"Feature","geometry":{"type":"LineString","coordinates":[[1,2],[3.5,4]]},"properties":null}`,
+			output: []byte(`{"coordinates":[[1,2],[3.5,4]],"type":"LineString"}`),
+		},
+		{
+			name:   "GeoJSON Feature without geometry",
+			input:  `{"type":"Feature","geometry":null,"properties":{}}`,
+			output: nil,
+		},
+		{
+			name:        "GeoJSON Feature with invalid geometry",
+			input:       map[string]any{"type": "Feature", "geometry": map[string]any{"type": "Point"}},
+			err:         true,
+			errContains: "GeoJSON geometry of Feature: GeoJSON Point is missing coordinates",
+		},
+		{
+			name:        "GeoJSON FeatureCollection",
+			input:       `{"type":"FeatureCollection","features":[]}`,
+			err:         true,
+			errContains: "FeatureCollection is not supported",
+		},
+		{
+			name:   "WKT LineString",
+			input:  "LINESTRING(-122.35 37.55, -122.36 37.56)",
+			output: []byte("LINESTRING(-122.35 37.55, -122.36 37.56)"),
+		},
+		{
+			name:   "WKT Polygon bytes",
+			input:  []byte("polygon ((0 0, 1 0, 1 1, 0 0), (0.2 0.2, 0.4 0.2, 0.4 0.4, 0.2 0.2))"),
+			output: []byte("polygon ((0 0, 1 0, 1 1, 0 0), (0.2 0.2, 0.4 0.2, 0.4 0.4, 0.2 0.2))"),
+		},
+		{
+			name:   "EWKT with dimensions",
+			input:  "SRID=4326;POINT Z (1 2 3)",
+			output: []byte("SRID=4326;POINT Z (1 2 3)"),
+		},
+		{
+			name:   "WKT empty",
+			input:  "MULTIPOLYGON EMPTY",
+			output: []byte("MULTIPOLYGON EMPTY"),
+		},
+		{
+			name:   "null",
+			input:  nil,
+			output: nil,
+		},
+		{
+			name:        "GeoJSON without type",
+			input:       map[string]any{"coordinates": []any{1.0, 2.0}},
+			err:         true,
+			errContains: "missing a type",
+		},
+		{
+			name:        "GeoJSON unknown type",
+			input:       `{"type":"Circle","coordinates":[1,2]}`,
+			err:         true,
+			errContains: "unknown GeoJSON geometry type",
+		},
+		{
+			name:        "GeoJSON Polygon with coordinates of a Point",
+			input:       `{"type":"Polygon","coordinates":[1,2]}`,
+			err:         true,
+			errContains: "invalid coordinates of GeoJSON Polygon",
+		},
+		{
+			name:        "GeoJSON Point with too few numbers",
+			input:       map[string]any{"type": "Point", "coordinates": []any{1.0}},
+			err:         true,
+			errContains: "between 2 and 4 numbers",
+		},
+		{
+			name:        "GeoJSON Point without coordinates",
+			input:       `{"type":"Point"}`,
+			err:         true,
+			errContains: "missing coordinates",
+		},
+		{
+			name:        "malformed GeoJSON",
+			input:       `{"type":"Point",`,
+			err:         true,
+			errContains: "invalid GeoJSON",
+		},
+		{
+			name:        "unknown WKT keyword",
+			input:       "CIRCLE(1 2, 3)",
+			err:         true,
+			errContains: "unknown WKT geometry type",
+		},
+		{
+			name:        "unbalanced WKT",
+			input:       "LINESTRING((1 2, 3 4)",
+			err:         true,
+			errContains: "unbalanced parentheses",
+		},
+		{
+			name:        "WKT trailing characters",
+			input:       "POINT(1 2) foo",
+			err:         true,
+			errContains: "unexpected characters",
+		},
+		{
+			name:        "WKT without coordinates",
+			input:       "POINT",
+			err:         true,
+			errContains: "EMPTY or coordinates",
+		},
+		{
+			name:  "unsupported type",
+			input: 42,
+			err:   true,
+		},
+		{
+			name:        "too long",
+			input:       "LINESTRING(" + strings.Repeat("1 2, ", 30) + "1 2)",
+			err:         true,
+			errContains: "value too long",
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			c := &geoConverter{nullable: true, maxLength: 128}
+			runTestcase(t, c, tc)
+		})
+	}
+
+	c := &geoConverter{nullable: false, maxLength: 96}
+	require.ErrorIs(t, c.ValidateAndConvert(&statsBuffer{}, nil, &testTypedBuffer{}), errNullValue)
+	require.ErrorIs(t, c.ValidateAndConvert(&statsBuffer{}, `{"type":"Feature","geometry":null}`, &testTypedBuffer{}), errNullValue)
+}
+
 func TestTimestampNTZConverter(t *testing.T) {
 	tests := []validateTestCase{
 		{
@@ -343,19 +791,12 @@ func TestTimestampNTZConverter(t *testing.T) {
 			precision: 18,
 		},
 	}
-	for _, tc := range tests {
+	for _, tc := range withTimeInputs(tests) {
 		tc := tc
 		t.Run("", func(t *testing.T) {
 			loc, err := time.LoadLocation("America/New_York")
 			require.NoError(t, err)
-			c := &timestampConverter{
-				nullable:  true,
-				scale:     tc.scale,
-				precision: tc.precision,
-				includeTZ: false,
-				trimTZ:    true,
-				defaultTZ: loc,
-			}
+			c := newTimestampConverter(true, tc.scale, tc.precision, false, true, false, loc)
 			runTestcase(t, c, tc)
 		})
 	}
@@ -369,23 +810,91 @@ func TestTimestampTZConverter(t *testing.T) {
 			scale:     3,
 			precision: 18,
 		},
+		{
+			input:     "2013-04-28T20:57:01.000+05:30",
+			output:    22399595659265770,
+			scale:     3,
+			precision: 18,
+		},
+		{
+			input:     "2013-04-28T20:57:01.000-08:00",
+			output:    22400391921664960,
+			scale:     3,
+			precision: 18,
+		},
+		{
+			input:     "2013-04-28T20:57:01.000-03:30",
+			output:    22400126500865230,
+			scale:     3,
+			precision: 18,
+		},
+		{
+			input:     "2013-04-28T20:57:01.000+05:45",
+			output:    22399580913665785,
+			scale:     3,
+			precision: 18,
+		},
+		{
+			input:     "2013-04-28T20:57:01.000+14:00",
+			output:    22399094308866280,
+			scale:     3,
+			precision: 18,
+		},
+		{
+			input:     "2013-04-28T20:57:01.000-14:00",
+			output:    22400745816064600,
+			scale:     3,
+			precision: 18,
+		},
+		{
+			name:      "default timezone",
+			input:     "2013-04-28T20:57:01.000",
+			output:    22400155992065200,
+			scale:     3,
+			precision: 18,
+		},
+		{
+			input:       "2013-04-28T20:57:01.000+14:30",
+			err:         true,
+			errContains: "offsets must be whole minutes between -14:00 and +14:00",
+			scale:       3,
+			precision:   18,
+		},
+		{
+			input:       time.Date(2013, 4, 28, 20, 57, 1, 0, time.FixedZone("", 30)),
+			err:         true,
+			errContains: "offsets must be whole minutes between -14:00 and +14:00",
+			scale:       3,
+			precision:   18,
+		},
 	}
-	for _, tc := range tests {
+	for _, tc := range withTimeInputs(tests) {
 		tc := tc
 		t.Run("", func(t *testing.T) {
 			loc, err := time.LoadLocation("America/New_York")
 			require.NoError(t, err)
-			c := &timestampConverter{
-				nullable:  true,
-				scale:     tc.scale,
-				precision: tc.precision,
-				includeTZ: true,
-				trimTZ:    false,
-				defaultTZ: loc,
-			}
+			c := newTimestampConverter(true, tc.scale, tc.precision, true, false, false, loc)
 			runTestcase(t, c, tc)
 		})
 	}
+
+	// The low 14 bits encode the offset in minutes, biased by 1440.
+	offsets := map[string]int{
+		"Z":      0,
+		"+05:30": 330,
+		"-08:00": -480,
+		"-03:30": -210,
+		"+05:45": 345,
+		"+14:00": 840,
+		"-14:00": -840,
+	}
+	for zone, offsetMinutes := range offsets {
+		c := newTimestampConverter(true, 3, 18, true, false, false, time.UTC)
+		s := statsBuffer{}
+		b := testTypedBuffer{}
+		require.NoError(t, c.ValidateAndConvert(&s, "2013-04-28T20:57:01.000"+zone, &b))
+		require.Equal(t, offsetMinutes+1440, b.output.(int)&(1<<14-1), zone)
+	}
 }
 
 func TestTimestampLTZConverter(t *testing.T) {
@@ -403,30 +912,100 @@ func TestTimestampLTZConverter(t *testing.T) {
 			precision: 18,
 		},
 		{
-			input:     "2013-04-28T20:57:00Z",
-			err:       true,
-			scale:     0,
-			precision: 9, // Mor precision needed
+			input:       "2013-04-28T20:57:00Z",
+			err:         true,
+			errContains: "timestamp 2013-04-28T20:57:00Z is outside of the range between 1938-04-24T22:13:21Z and 2001-09-09T01:46:39Z which is supported by columns with scale 0 and precision 9",
+			scale:       0,
+			precision:   9, // More precision needed
 		},
 	}
-	for _, tc := range tests {
+	for _, tc := range withTimeInputs(tests) {
 		tc := tc
 		t.Run("", func(t *testing.T) {
 			loc, err := time.LoadLocation("America/New_York")
 			require.NoError(t, err)
-			c := &timestampConverter{
-				nullable:  true,
-				scale:     tc.scale,
-				precision: tc.precision,
-				includeTZ: false,
-				trimTZ:    false,
-				defaultTZ: loc,
-			}
+			c := newTimestampConverter(true, tc.scale, tc.precision, false, false, false, loc)
 			runTestcase(t, c, tc)
 		})
 	}
 }
 
+func TestTimestampConverterRange(t *testing.T) {
+	const (
+		maxSentinel = "9999-12-31T23:59:59.999999999Z"
+		minSentinel = "0001-01-01T00:00:00Z"
+	)
+	tests := []struct {
+		scale, precision int32
+		input            string
+		output           any
+		errContains      string
+		clamped          any
+	}{
+		{scale: 0, precision: 18, input: maxSentinel, output: 253402300799},
+		{scale: 0, precision: 18, input: minSentinel, output: -62135596800},
+		{scale: 3, precision: 18, input: maxSentinel, output: 253402300799999},
+		{scale: 3, precision: 18, input: minSentinel, output: -62135596800000},
+		{scale: 6, precision: 18, input: maxSentinel, output: 253402300799999999},
+		{scale: 6, precision: 18, input: minSentinel, output: -62135596800000000},
+		{
+			scale:       9,
+			precision:   18,
+			input:       maxSentinel,
+			errContains: "timestamp 9999-12-31T23:59:59.999999999Z is outside of the range between 1938-04-24T22:13:20.000000001Z and 2001-09-09T01:46:39.999999999Z which is supported by columns with scale 9 and precision 18",
+			clamped:     999999999999999999,
+		},
+		{
+			scale:       9,
+			precision:   18,
+			input:       minSentinel,
+			errContains: "timestamp 0001-01-01T00:00:00Z is outside of the range between 1938-04-24T22:13:20.000000001Z and 2001-09-09T01:46:39.999999999Z which is supported by columns with scale 9 and precision 18",
+			clamped:     -999999999999999999,
+		},
+		{scale: 0, precision: 38, input: maxSentinel, output: 253402300799},
+		{scale: 0, precision: 38, input: minSentinel, output: -62135596800},
+		{scale: 3, precision: 38, input: maxSentinel, output: 253402300799999},
+		{scale: 3, precision: 38, input: minSentinel, output: -62135596800000},
+		{scale: 6, precision: 38, input: maxSentinel, output: 253402300799999999},
+		{scale: 6, precision: 38, input: minSentinel, output: -62135596800000000},
+		{scale: 9, precision: 38, input: maxSentinel, output: int128.MustParse("253402300799999999999")},
+		{scale: 9, precision: 38, input: minSentinel, output: int128.MustParse("-62135596800000000000")},
+	}
+	for _, tc := range tests {
+		t.Run(fmt.Sprintf("%s scale %d precision %d", tc.input, tc.scale, tc.precision), func(t *testing.T) {
+			for _, clamp := range []bool{false, true} {
+				c := newTimestampConverter(true, tc.scale, tc.precision, false, true, clamp, time.UTC)
+				s := statsBuffer{}
+				b := testTypedBuffer{}
+				err := c.ValidateAndConvert(&s, tc.input, &b)
+				switch {
+				case tc.errContains == "":
+					require.NoError(t, err)
+					require.Equal(t, tc.output, b.output)
+					require.Zero(t, s.clampedValues)
+				case clamp:
+					require.NoError(t, err)
+					require.Equal(t, tc.clamped, b.output)
+					require.Equal(t, int64(1), s.clampedValues)
+				default:
+					require.ErrorContains(t, err, tc.errContains)
+					require.Nil(t, b.output)
+				}
+			}
+		})
+	}
+
+	// The timezone offset takes up the low 14 bits of TIMESTAMP_TZ columns,
+	// which reduces their range.
+	c := newTimestampConverter(true, 3, 18, true, false, true, time.UTC)
+	s := statsBuffer{}
+	b := testTypedBuffer{}
+	require.NoError(t, c.ValidateAndConvert(&s, "9999-12-31T23:59:59.999+01:00", &b))
+	require.Equal(t, int64(1), s.clampedValues)
+	require.True(t, int128.FromInt64(int64(b.output.(int))).FitsInPrecision(18))
+	require.Equal(t, 60+1440, b.output.(int)&(1<<14-1))
+}
+
 func TestDateConverter(t *testing.T) {
 	tests := []validateTestCase{
 		{
@@ -454,13 +1033,79 @@ func TestDateConverter(t *testing.T) {
 			err:   true,
 		},
 	}
-	for _, tc := range tests {
+	for _, tc := range withTimeInputs(tests) {
 		tc := tc
 		t.Run("", func(t *testing.T) {
-			c := &dateConverter{nullable: true}
+			c := newDateConverter(true, nil, DateIntegerUnitEpochSeconds)
 			runTestcase(t, c, tc)
 		})
 	}
+	formatTests := []validateTestCase{
+		{
+			input:  "2020-07-21",
+			output: 18464,
+		},
+		{
+			input:  "21/07/2020",
+			output: 18464,
+		},
+		{
+			input:  "2020-07-21T00:00:00Z",
+			output: 18464,
+		},
+		{
+			input: "07/21/2020",
+			err:   true,
+		},
+		{
+			input: "10000-01-01",
+			err:   true,
+		},
+	}
+	for _, tc := range formatTests {
+		tc := tc
+		t.Run("", func(t *testing.T) {
+			c := newDateConverter(true, []string{"2006-01-02", "02/01/2006"}, DateIntegerUnitEpochSeconds)
+			runTestcase(t, c, tc)
+		})
+	}
+	integerTests := map[DateIntegerUnit][]validateTestCase{
+		DateIntegerUnitEpochSeconds: {
+			{input: 20200721, output: 233},
+			{input: 18464, output: 0},
+		},
+		DateIntegerUnitEpochDays: {
+			{input: 18464, output: 18464},
+			{input: -923, output: -923},
+			{input: json.Number("18464"), output: 18464},
+			{input: 20200721, err: true},
+			{input: 2_932_896, output: 2_932_896},
+			{input: 2_932_897, err: true},
+			{input: "2020-07-21T00:00:00Z", output: 18464},
+		},
+		DateIntegerUnitYYYYMMDD: {
+			{input: 20200721, output: 18464},
+			{input: int64(19670623), output: -923},
+			{input: json.Number("20200721"), output: 18464},
+			{input: 18464, err: true},
+			{input: 20200229, output: 18321},
+			{input: 20210229, err: true},
+			{input: 20201301, err: true},
+			{input: 99991231, output: 2_932_896},
+			{input: 100000101, err: true},
+			{input: -20200721, err: true},
+			{input: "2020-07-21T00:00:00Z", output: 18464},
+		},
+	}
+	for unit, tests := range integerTests {
+		for _, tc := range tests {
+			tc := tc
+			t.Run("", func(t *testing.T) {
+				c := newDateConverter(true, nil, unit)
+				runTestcase(t, c, tc)
+			})
+		}
+	}
 }
 
 type testTypedBuffer struct {
@@ -502,8 +1147,57 @@ func runTestcase(t *testing.T, dc dataConverter, tc validateTestCase) {
 	err := dc.ValidateAndConvert(&s, tc.input, &b)
 	if tc.err {
 		require.Errorf(t, err, "instead got: %#v", b.output)
+		if tc.errContains != "" {
+			require.ErrorContains(t, err, tc.errContains)
+		}
 	} else {
 		require.NoError(t, err)
 		require.Equal(t, tc.output, b.output)
 	}
 }
+
+// withTimeInputs appends a copy of each test case with an RFC 3339 string input
+// that uses the equivalent time.Time as input instead, which must be converted
+// identically.
+func withTimeInputs(tests []validateTestCase) []validateTestCase {
+	out := slices.Clone(tests)
+	for _, tc := range tests {
+		s, ok := tc.input.(string)
+		if !ok {
+			continue
+		}
+		ts, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			continue
+		}
+		tc.name = "time.Time " + s
+		tc.input = ts
+		out = append(out, tc)
+	}
+	return out
+}
+
+func BenchmarkTimestampConverter(b *testing.B) {
+	const s = "2022-09-18T22:05:07.123456789+01:00"
+	ts, err := time.Parse(time.RFC3339Nano, s)
+	require.NoError(b, err)
+	for _, input := range []struct {
+		name string
+		val  any
+	}{
+		{"string", s},
+		{"time.Time", ts},
+	} {
+		b.Run(input.name, func(b *testing.B) {
+			c := newTimestampConverter(true, 9, 38, true, false, false, time.UTC)
+			stats := statsBuffer{}
+			buf := testTypedBuffer{}
+			b.ReportAllocs()
+			for range b.N {
+				if err := c.ValidateAndConvert(&stats, input.val, &buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package streaming
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/parquet-go/parquet-go"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+// ColumnDefinition declares a column of a table by its Snowflake data type,
+// such as `NUMBER(10, 2)` or `TIMESTAMP_NTZ`.
+type ColumnDefinition struct {
+	// The name of the column, which is matched like message keys.
+	Name string
+	// The Snowflake data type of the column.
+	DataType string
+}
+
+// ColumnValidation is the result of converting the value of a message for a
+// single column.
+type ColumnValidation struct {
+	// The name of the column in the form message keys are matched against it.
+	Column string
+	// Whether the value can be written to the column as is.
+	Valid bool
+	// Why the value can't be written to the column, empty for valid values.
+	Error string
+	// Whether the value would be written as null instead of being rejected,
+	// because of the conversion error mode of the column.
+	WrittenAsNull bool
+	// Whether the timestamp is outside of the range supported by the column
+	// and would be replaced with the closest supported timestamp.
+	Clamped bool
+}
+
+// SchemaValidation is the result of converting a message into a row of a
+// table.
+type SchemaValidation struct {
+	// Whether every value of the message can be written as is.
+	Valid bool
+	// Why the message can't be converted into a row at all, such as when it
+	// isn't an object, in which case the columns aren't validated.
+	Error string
+	// The results of the columns of the table, in the order of the table.
+	Columns []ColumnValidation
+	// The keys of the message with non-null values which don't match any
+	// column, which are dropped unless schema evolution adds them.
+	UnknownColumns []string
+}
+
+// SchemaValidator converts messages into the rows of a table exactly like a
+// channel with the same options does, but only reports whether the values can
+// be converted without writing them anywhere. This allows checking messages
+// against a table before they are written.
+//
+// The validator is safe for concurrent use.
+type SchemaValidator struct {
+	transformers   []*dataTransformer
+	columnIndexes  []int
+	nameToPosition map[string]int
+	caseSensitive  bool
+}
+
+// NewSchemaValidator creates a validator for a table with the given columns,
+// which are all nullable like the columns created from their definitions. The
+// options which don't affect how values are converted, such as the names of
+// the table and channel, are ignored.
+func NewSchemaValidator(columns []ColumnDefinition, opts ChannelOptions) (*SchemaValidator, error) {
+	metadata := make([]columnMetadata, 0, len(columns))
+	for i, col := range columns {
+		column, err := columnMetadataFromDataType(col.Name, col.DataType, opts.CaseSensitiveColumns)
+		if err != nil {
+			return nil, fmt.Errorf("invalid type for column %q: %w", col.Name, err)
+		}
+		column.Ordinal = int32(i + 1)
+		metadata = append(metadata, column)
+	}
+	schema, transformers, _, err := constructParquetSchema(metadata, opts)
+	if err != nil {
+		return nil, err
+	}
+	v := &SchemaValidator{
+		transformers:   transformers,
+		columnIndexes:  make([]int, len(transformers)),
+		nameToPosition: make(map[string]int, len(transformers)),
+		caseSensitive:  opts.CaseSensitiveColumns,
+	}
+	for name := range ignoredColumnNames(opts) {
+		v.nameToPosition[name] = -1
+	}
+	for idx, t := range transformers {
+		leaf, ok := schema.Lookup(t.name)
+		if !ok {
+			return nil, fmt.Errorf("invariant failed: unable to find column %q", t.name)
+		}
+		v.columnIndexes[idx] = leaf.ColumnIndex
+		v.nameToPosition[t.name] = idx
+	}
+	return v, nil
+}
+
+// Validate converts msg into a row of the table.
+func (v *SchemaValidator) Validate(msg *service.Message) *SchemaValidation {
+	result := &SchemaValidation{Valid: true}
+	row := make([]any, len(v.transformers))
+	// Unknown keys are ignored by messageToRow after every other key is
+	// matched, so they're only reported.
+	err := messageToRow(msg, row, v.nameToPosition, SchemaModeStrict, v.caseSensitive)
+	var missing *BatchSchemaMismatchError[*MissingColumnError]
+	if errors.As(err, &missing) {
+		for _, col := range missing.Errors {
+			result.UnknownColumns = append(result.UnknownColumns, col.RawName())
+		}
+	} else if err != nil {
+		result.Valid = false
+		result.Error = err.Error()
+		return result
+	}
+
+	// Each value is written to a throwaway matrix with a single row, which
+	// is only ever read by the buffer of its column.
+	matrix := make([]parquet.Value, len(v.transformers))
+	rowMsg := rowMessage{msg: msg}
+	for i, t := range v.transformers {
+		buf := t.bufferFactory()
+		buf.Prepare(matrix, v.columnIndexes[i], len(matrix))
+		stats := newStatsBuffer(false)
+		col := ColumnValidation{Column: t.name, Valid: true}
+		conversionError, err := convertValue(t, stats, buf, &rowMsg, row[i])
+		switch {
+		case err != nil:
+			col.Valid = false
+			col.Error = err.Error()
+		case conversionError != nil:
+			col.Valid = false
+			col.WrittenAsNull = true
+			col.Error, _ = conversionError.(map[string]any)["error"].(string)
+		}
+		col.Clamped = stats.clampedValues > 0
+		result.Valid = result.Valid && col.Valid
+		result.Columns = append(result.Columns, col)
+	}
+	return result
+}
+
+var dataTypeRegex = regexp.MustCompile(`^\s*([A-Za-z_0-9]+(?:\s+[Pp][Rr][Ee][Cc][Ii][Ss][Ii][Oo][Nn])?)\s*(?:\(\s*(\d+)\s*(?:,\s*(\d+)\s*)?\))?\s*$`)
+
+// ValidateColumnDataType returns an error if dataType isn't a Snowflake data
+// type which channels can write, such as the types of the columns which are
+// declared or added by schema evolution. Data types which pass are also safe to
+// use in SQL statements.
+func ValidateColumnDataType(dataType string) error {
+	_, err := columnMetadataFromDataType("", dataType, true)
+	return err
+}
+
+// columnMetadataFromDataType returns the metadata of a nullable column with
+// the given Snowflake data type, like the metadata which is returned for the
+// column when a channel is opened. Numbers, times and timestamps are stored with
+// the narrowest physical type which holds every value of their precision or
+// scale, like the values which channels write to them.
+func columnMetadataFromDataType(name, dataType string, caseSensitive bool) (columnMetadata, error) {
+	match := dataTypeRegex.FindStringSubmatch(dataType)
+	if match == nil {
+		return columnMetadata{}, fmt.Errorf("invalid Snowflake column data type: %s", dataType)
+	}
+	baseType := strings.Join(strings.Fields(strings.ToUpper(match[1])), " ")
+	var params []int32
+	for _, p := range match[2:] {
+		if p == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(p, 10, 32)
+		if err != nil {
+			return columnMetadata{}, fmt.Errorf("invalid Snowflake column data type: %s", dataType)
+		}
+		params = append(params, int32(n))
+	}
+	param := func(i int, defaultValue int32) *int32 {
+		if i < len(params) {
+			return &params[i]
+		}
+		return &defaultValue
+	}
+
+	// The column is named with the quoted normalized name, so that message
+	// keys are matched against it exactly like against the declared name.
+	column := columnMetadata{
+		Name:     quoteColumnNameCaseSensitive(NormalizeColumnName(name, caseSensitive)),
+		Type:     dataType,
+		Nullable: true,
+	}
+	switch baseType {
+	case "NUMBER", "DECIMAL", "NUMERIC":
+		column.Precision, column.Scale = param(0, 38), param(1, 0)
+		if *column.Precision < 1 || *column.Precision > 38 || *column.Scale > *column.Precision {
+			return columnMetadata{}, fmt.Errorf("invalid precision or scale of Snowflake column data type: %s", dataType)
+		}
+		column.LogicalType, column.PhysicalType = "FIXED", fixedPhysicalType(*column.Precision)
+	case "INT", "INTEGER", "BIGINT", "SMALLINT", "TINYINT", "BYTEINT":
+		// Integer types are synonyms for NUMBER(38, 0).
+		column.LogicalType, column.PhysicalType = "FIXED", "SB16"
+		precision, scale := int32(38), int32(0)
+		column.Precision, column.Scale = &precision, &scale
+	case "FLOAT", "FLOAT4", "FLOAT8", "DOUBLE", "DOUBLE PRECISION", "REAL":
+		column.LogicalType, column.PhysicalType = "REAL", "DOUBLE"
+	case "VARCHAR", "STRING", "TEXT", "CHAR", "CHARACTER":
+		defaultLength := int32(16 * humanize.MiByte)
+		if baseType == "CHAR" || baseType == "CHARACTER" {
+			defaultLength = 1
+		}
+		column.LogicalType, column.PhysicalType = "TEXT", "LOB"
+		column.Length = param(0, defaultLength)
+		// Characters take up to 4 bytes in UTF-8.
+		byteLength := int32(min(4*int64(*column.Length), 16*humanize.MiByte))
+		column.ByteLength = &byteLength
+	case "BINARY", "VARBINARY":
+		column.LogicalType, column.PhysicalType = "BINARY", "LOB"
+		column.ByteLength = param(0, 8*humanize.MiByte)
+	case "BOOLEAN":
+		column.LogicalType, column.PhysicalType = "BOOLEAN", "BINARY"
+	case "DATE":
+		column.LogicalType, column.PhysicalType = "DATE", "SB4"
+	case "TIME":
+		column.LogicalType, column.Scale = "TIME", param(0, 9)
+		if *column.Scale > 9 {
+			return columnMetadata{}, fmt.Errorf("invalid scale of Snowflake column data type: %s", dataType)
+		}
+		column.PhysicalType = "SB8"
+		if *column.Scale <= 4 {
+			// The nanoseconds of a day take 14 digits, so times with up to
+			// 4 fractional digits fit in 4 bytes.
+			column.PhysicalType = "SB4"
+		}
+	case "TIMESTAMP", "DATETIME", "TIMESTAMP_NTZ", "TIMESTAMP_LTZ", "TIMESTAMP_TZ":
+		column.LogicalType, column.Scale = baseType, param(0, 9)
+		if *column.Scale > 9 {
+			return columnMetadata{}, fmt.Errorf("invalid scale of Snowflake column data type: %s", dataType)
+		}
+		if baseType == "TIMESTAMP" || baseType == "DATETIME" {
+			column.LogicalType = "TIMESTAMP_NTZ"
+		}
+		column.PhysicalType = timestampPhysicalType(*column.Scale, column.LogicalType == "TIMESTAMP_TZ")
+	case "GEOGRAPHY", "GEOMETRY":
+		column.LogicalType, column.PhysicalType = baseType, "LOB"
+	case "VARIANT", "OBJECT", "ARRAY":
+		column.LogicalType, column.PhysicalType = baseType, "LOB"
+	default:
+		return columnMetadata{}, fmt.Errorf("unsupported Snowflake column data type: %s", dataType)
+	}
+	return column, nil
+}
+
+// fixedPhysicalType returns the narrowest physical type which holds every
+// number of the precision.
+func fixedPhysicalType(precision int32) string {
+	switch {
+	case precision <= 2:
+		return "SB1"
+	case precision <= 4:
+		return "SB2"
+	}
+	return physicalTypeForByteWidth(byteWidthForPrecision(precision))
+}
+
+// timestampPhysicalType returns the narrowest physical type which holds every
+// timestamp which Snowflake supports with the scale.
+func timestampPhysicalType(scale int32, includeTZ bool) string {
+	narrowMin, narrowMax := timestampRange(scale, maxPrecisionForByteWidth(8), includeTZ)
+	wideMin, wideMax := timestampRange(scale, maxPrecisionForByteWidth(16), includeTZ)
+	if narrowMin.Equal(wideMin) && narrowMax.Equal(wideMax) {
+		return "SB8"
+	}
+	return "SB16"
+}
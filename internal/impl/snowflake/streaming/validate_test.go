@@ -0,0 +1,154 @@
+/*
+ * Copyright 2024 Redpanda Data, Inc.
+ *
+ * Licensed as a Redpanda Enterprise file under the Redpanda Community
+ * License (the "License"); you may not use this file except in compliance with
+ * the License. You may obtain a copy of the License at
+ *
+ * https://github.com/redpanda-data/redpanda/blob/master/licenses/rcl.md
+ */
+
+package streaming
+
+import (
+	"testing"
+
+	"github.com/aws/smithy-go/ptr"
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+	"github.com/stretchr/testify/require"
+)
+
+var validatorColumns = []ColumnDefinition{
+	{Name: "id", DataType: "NUMBER(10, 0)"},
+	{Name: "name", DataType: "VARCHAR(5)"},
+	{Name: "amount", DataType: "NUMBER(6,2)"},
+	{Name: "active", DataType: "BOOLEAN"},
+	{Name: "created_at", DataType: "TIMESTAMP_NTZ"},
+}
+
+func TestSchemaValidator(t *testing.T) {
+	v, err := NewSchemaValidator(validatorColumns, ChannelOptions{})
+	require.NoError(t, err)
+
+	result := v.Validate(msg(`{"id":1,"name":"abc","amount":"12.34","active":true,"created_at":"2024-01-02T03:04:05Z"}`))
+	require.Equal(t, &SchemaValidation{
+		Valid: true,
+		Columns: []ColumnValidation{
+			{Column: "ID", Valid: true},
+			{Column: "NAME", Valid: true},
+			{Column: "AMOUNT", Valid: true},
+			{Column: "ACTIVE", Valid: true},
+			{Column: "CREATED_AT", Valid: true},
+		},
+	}, result)
+
+	result = v.Validate(msg(`{"id":1,"name":"abc","amount":123456.7,"active":true,"created_at":"2024-01-02T03:04:05Z","extra":1,"nothing":null}`))
+	require.False(t, result.Valid)
+	require.Empty(t, result.Error)
+	require.Equal(t, []string{"extra"}, result.UnknownColumns)
+	require.Len(t, result.Columns, 5)
+	for _, col := range result.Columns {
+		if col.Column != "AMOUNT" {
+			require.True(t, col.Valid, col.Column)
+			require.Empty(t, col.Error, col.Column)
+			continue
+		}
+		require.False(t, col.Valid)
+		require.False(t, col.WrittenAsNull)
+		require.Contains(t, col.Error, `invalid data for column "AMOUNT"`)
+	}
+
+	result = v.Validate(msg(`[1, 2]`))
+	require.False(t, result.Valid)
+	require.Contains(t, result.Error, "expected object")
+	require.Empty(t, result.Columns)
+}
+
+func TestSchemaValidatorOptions(t *testing.T) {
+	transform, err := bloblang.Parse(`root = this.uppercase()`)
+	require.NoError(t, err)
+	v, err := NewSchemaValidator(validatorColumns, ChannelOptions{
+		ConversionErrorMode: ConversionErrorModeNull,
+		ColumnTransforms:    map[string]*bloblang.Executor{"name": transform},
+		IgnoreColumns:       []string{"extra"},
+		BuildOptions:        BuildOptions{ClampTimestamps: true},
+	})
+	require.NoError(t, err)
+
+	result := v.Validate(msg(`{"id":1,"name":"abcdefghijklmnopqrstuvwxyz","active":"nope","created_at":"0000-01-01T00:00:00Z","extra":1}`))
+	require.Equal(t, &SchemaValidation{
+		Valid: false,
+		Columns: []ColumnValidation{
+			{Column: "ID", Valid: true},
+			{Column: "NAME", Valid: false, WrittenAsNull: true, Error: result.Columns[1].Error},
+			{Column: "AMOUNT", Valid: true},
+			{Column: "ACTIVE", Valid: false, WrittenAsNull: true, Error: result.Columns[3].Error},
+			{Column: "CREATED_AT", Valid: true, Clamped: true},
+		},
+	}, result)
+	require.NotEmpty(t, result.Columns[1].Error)
+	require.NotEmpty(t, result.Columns[3].Error)
+
+	_, err = NewSchemaValidator([]ColumnDefinition{{Name: "id", DataType: "NUMBER(40)"}}, ChannelOptions{})
+	require.ErrorContains(t, err, `invalid type for column "id"`)
+	_, err = NewSchemaValidator([]ColumnDefinition{{Name: "id", DataType: "UUID"}}, ChannelOptions{})
+	require.ErrorContains(t, err, "unsupported Snowflake column data type: UUID")
+	_, err = NewSchemaValidator(validatorColumns, ChannelOptions{ColumnTransforms: map[string]*bloblang.Executor{"missing": transform}})
+	require.ErrorContains(t, err, `unknown column "missing" in column transforms`)
+}
+
+func TestSchemaValidatorGeospatial(t *testing.T) {
+	v, err := NewSchemaValidator([]ColumnDefinition{{Name: "location", DataType: "GEOGRAPHY"}}, ChannelOptions{})
+	require.NoError(t, err)
+
+	result := v.Validate(msg(`{"location":{"type":"Point","coordinates":[-122.35,37.55]}}`))
+	require.True(t, result.Valid, result)
+	result = v.Validate(msg(`{"location":"not a geography"}`))
+	require.False(t, result.Valid)
+	require.NotEmpty(t, result.Columns[0].Error)
+}
+
+func TestColumnMetadataFromDataType(t *testing.T) {
+	for dataType, expected := range map[string]columnMetadata{
+		"NUMBER":             {LogicalType: "FIXED", PhysicalType: "SB16", Precision: ptr.Int32(38), Scale: ptr.Int32(0)},
+		"decimal(10, 2)":     {LogicalType: "FIXED", PhysicalType: "SB8", Precision: ptr.Int32(10), Scale: ptr.Int32(2)},
+		"NUMERIC(5)":         {LogicalType: "FIXED", PhysicalType: "SB4", Precision: ptr.Int32(5), Scale: ptr.Int32(0)},
+		"BIGINT":             {LogicalType: "FIXED", PhysicalType: "SB16", Precision: ptr.Int32(38), Scale: ptr.Int32(0)},
+		"double  precision":  {LogicalType: "REAL", PhysicalType: "DOUBLE"},
+		"VARCHAR(10)":        {LogicalType: "TEXT", PhysicalType: "LOB", Length: ptr.Int32(10), ByteLength: ptr.Int32(40)},
+		"STRING":             {LogicalType: "TEXT", PhysicalType: "LOB", Length: ptr.Int32(16777216), ByteLength: ptr.Int32(16777216)},
+		"CHAR":               {LogicalType: "TEXT", PhysicalType: "LOB", Length: ptr.Int32(1), ByteLength: ptr.Int32(4)},
+		"BINARY":             {LogicalType: "BINARY", PhysicalType: "LOB", ByteLength: ptr.Int32(8388608)},
+		"BOOLEAN":            {LogicalType: "BOOLEAN", PhysicalType: "BINARY"},
+		"DATE":               {LogicalType: "DATE", PhysicalType: "SB4"},
+		"TIME(3)":            {LogicalType: "TIME", PhysicalType: "SB4", Scale: ptr.Int32(3)},
+		"DATETIME":           {LogicalType: "TIMESTAMP_NTZ", PhysicalType: "SB16", Scale: ptr.Int32(9)},
+		"TIMESTAMP_TZ(6)":    {LogicalType: "TIMESTAMP_TZ", PhysicalType: "SB16", Scale: ptr.Int32(6)},
+		"TIMESTAMP_TZ(2)":    {LogicalType: "TIMESTAMP_TZ", PhysicalType: "SB8", Scale: ptr.Int32(2)},
+		"TIMESTAMP_NTZ(6)":   {LogicalType: "TIMESTAMP_NTZ", PhysicalType: "SB8", Scale: ptr.Int32(6)},
+		"TIME":               {LogicalType: "TIME", PhysicalType: "SB8", Scale: ptr.Int32(9)},
+		"NUMBER(2)":          {LogicalType: "FIXED", PhysicalType: "SB1", Precision: ptr.Int32(2), Scale: ptr.Int32(0)},
+		"NUMBER(4, 1)":       {LogicalType: "FIXED", PhysicalType: "SB2", Precision: ptr.Int32(4), Scale: ptr.Int32(1)},
+		"GEOGRAPHY":          {LogicalType: "GEOGRAPHY", PhysicalType: "LOB"},
+		"geometry":           {LogicalType: "GEOMETRY", PhysicalType: "LOB"},
+		" variant ":          {LogicalType: "VARIANT", PhysicalType: "LOB"},
+		"ARRAY":              {LogicalType: "ARRAY", PhysicalType: "LOB"},
+		"TIMESTAMP_LTZ( 0 )": {LogicalType: "TIMESTAMP_LTZ", PhysicalType: "SB8", Scale: ptr.Int32(0)},
+	} {
+		expected.Name = `"COL"`
+		expected.Type = dataType
+		expected.Nullable = true
+		actual, err := columnMetadataFromDataType("col", dataType, false)
+		require.NoError(t, err, dataType)
+		require.Equal(t, expected, actual, dataType)
+	}
+
+	actual, err := columnMetadataFromDataType("userId", "STRING", true)
+	require.NoError(t, err)
+	require.Equal(t, `"userId"`, actual.Name)
+
+	for _, dataType := range []string{"", "NUMBER(0)", "NUMBER(10,11)", "VARCHAR(", "TIME(10)", "TIMESTAMP_TZ(12)", "NUMBER(1,2,3)"} {
+		_, err := columnMetadataFromDataType("col", dataType, false)
+		require.Error(t, err, dataType)
+	}
+}
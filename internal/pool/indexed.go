@@ -35,8 +35,19 @@ type (
 	}
 	indexedImpl[T any] struct {
 		ctor  func(context.Context, string) (T, error)
-		items map[string]chan T
+		items map[string]*indexedItem[T]
 		mu    chan any
+
+		// The maximum number of items, which is unlimited when zero.
+		limit   int
+		onEvict func(string, T)
+		clock   uint64
+	}
+	indexedItem[T any] struct {
+		ch chan T
+		// The number of Acquire calls waiting for the item to be released.
+		waiters  int
+		lastUsed uint64
 	}
 )
 
@@ -44,10 +55,20 @@ var _ Indexed[any] = &indexedImpl[any]{}
 
 // NewIndexed creates a new Indexed pool that uses the following constructor to create new items.
 func NewIndexed[T any](ctor func(context.Context, string) (T, error)) Indexed[T] {
+	return NewIndexedLimited(0, ctor, nil)
+}
+
+// NewIndexedLimited creates a new Indexed pool that uses the following constructor to create new items and keeps at
+// most limit items. When the limit is exceeded, the least recently used items which are not acquired are removed from
+// the pool and passed to onEvict, which may be nil. Items which are acquired are never evicted, so the pool can
+// temporarily exceed the limit when more items than that are acquired at the same time.
+func NewIndexedLimited[T any](limit int, ctor func(context.Context, string) (T, error), onEvict func(name string, item T)) Indexed[T] {
 	i := &indexedImpl[T]{
-		ctor:  ctor,
-		items: map[string]chan T{},
-		mu:    make(chan any, 1),
+		ctor:    ctor,
+		items:   map[string]*indexedItem[T]{},
+		mu:      make(chan any, 1),
+		limit:   limit,
+		onEvict: onEvict,
 	}
 	i.mu <- nil
 	return i
@@ -66,32 +87,93 @@ func (p *indexedImpl[T]) unlock() {
 	p.mu <- nil
 }
 
+func (p *indexedImpl[T]) touch(it *indexedItem[T]) {
+	p.clock++
+	it.lastUsed = p.clock
+}
+
 func (p *indexedImpl[T]) Acquire(ctx context.Context, name string) (item T, err error) {
 	if err = p.lock(ctx); err != nil {
 		return
 	}
-	ch, ok := p.items[name]
+	it, ok := p.items[name]
 	if ok {
+		it.waiters++
+		p.touch(it)
 		p.unlock()
+		defer func() {
+			_ = p.lock(context.Background())
+			it.waiters--
+			p.unlock()
+		}()
 		select {
-		case item := <-ch:
+		case item := <-it.ch:
 			return item, nil
 		case <-ctx.Done():
 			return item, ctx.Err()
 		}
 	}
 	item, err = p.ctor(ctx, name)
+	var evicted map[string]T
 	if err == nil {
-		p.items[name] = make(chan T, 1)
+		it = &indexedItem[T]{ch: make(chan T, 1)}
+		p.touch(it)
+		p.items[name] = it
+		evicted = p.evictLocked()
 	}
 	p.unlock()
+	p.evicted(evicted)
 	return item, err
 }
 
 func (p *indexedImpl[T]) Release(name string, item T) {
 	_ = p.lock(context.Background())
-	defer p.unlock()
-	p.items[name] <- item
+	it, ok := p.items[name]
+	if !ok {
+		// The pool was reset while the item was acquired, so it's dropped like the other items.
+		p.unlock()
+		return
+	}
+	it.ch <- item
+	p.touch(it)
+	evicted := p.evictLocked()
+	p.unlock()
+	p.evicted(evicted)
+}
+
+// evictLocked removes the least recently used items which are not acquired until the pool doesn't exceed its limit.
+func (p *indexedImpl[T]) evictLocked() map[string]T {
+	var evicted map[string]T
+	for p.limit > 0 && len(p.items) > p.limit {
+		var lruName string
+		var lru *indexedItem[T]
+		for name, it := range p.items {
+			if it.waiters > 0 || len(it.ch) == 0 {
+				continue
+			}
+			if lru == nil || it.lastUsed < lru.lastUsed {
+				lruName, lru = name, it
+			}
+		}
+		if lru == nil {
+			break
+		}
+		delete(p.items, lruName)
+		if evicted == nil {
+			evicted = map[string]T{}
+		}
+		evicted[lruName] = <-lru.ch
+	}
+	return evicted
+}
+
+func (p *indexedImpl[T]) evicted(items map[string]T) {
+	if p.onEvict == nil {
+		return
+	}
+	for name, item := range items {
+		p.onEvict(name, item)
+	}
 }
 
 func (p *indexedImpl[T]) Reset() {
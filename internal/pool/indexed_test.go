@@ -75,3 +75,72 @@ func TestIndexedCtorCancellation(t *testing.T) {
 	_, err := p.Acquire(ctx, "foo")
 	require.Equal(t, context.Canceled, err)
 }
+
+func TestIndexedLimitedEviction(t *testing.T) {
+	var evicted []string
+	p := pool.NewIndexedLimited(2, func(ctx context.Context, name string) (bar, error) {
+		return bar{name}, nil
+	}, func(name string, item bar) {
+		require.Equal(t, name, item.string)
+		evicted = append(evicted, name)
+	})
+	ctx := context.Background()
+
+	acquire := func(name string) bar {
+		b, err := p.Acquire(ctx, name)
+		require.NoError(t, err)
+		return b
+	}
+
+	p.Release("a", acquire("a"))
+	p.Release("b", acquire("b"))
+	// Using a makes b the least recently used item.
+	p.Release("a", acquire("a"))
+	p.Release("c", acquire("c"))
+	require.Equal(t, []string{"b"}, evicted)
+	require.ElementsMatch(t, []string{"a", "c"}, p.Keys())
+
+	// Acquired items are never evicted, so the limit is exceeded until they are released.
+	a, c, d := acquire("a"), acquire("c"), acquire("d")
+	require.Equal(t, []string{"b"}, evicted)
+	require.Len(t, p.Keys(), 3)
+	p.Release("a", a)
+	require.Equal(t, []string{"b", "a"}, evicted)
+	p.Release("c", c)
+	p.Release("d", d)
+	require.Equal(t, []string{"b", "a"}, evicted)
+	require.ElementsMatch(t, []string{"c", "d"}, p.Keys())
+
+	// Items released after a reset are dropped.
+	c = acquire("c")
+	p.Reset()
+	p.Release("c", c)
+	require.Empty(t, p.Keys())
+	require.Equal(t, []string{"b", "a"}, evicted)
+}
+
+func TestIndexedLimitedWaiters(t *testing.T) {
+	p := pool.NewIndexedLimited(1, func(ctx context.Context, name string) (bar, error) {
+		return bar{name}, nil
+	}, nil)
+	ctx := context.Background()
+
+	a, err := p.Acquire(ctx, "a")
+	require.NoError(t, err)
+
+	acquired := make(chan bar)
+	go func() {
+		b, err := p.Acquire(ctx, "a")
+		require.NoError(t, err)
+		acquired <- b
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	// a is waited for, so it isn't evicted by b.
+	b, err := p.Acquire(ctx, "b")
+	require.NoError(t, err)
+	p.Release("b", b)
+	p.Release("a", a)
+	require.Equal(t, bar{"a"}, <-acquired)
+	require.ElementsMatch(t, []string{"a"}, p.Keys())
+}